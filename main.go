@@ -36,29 +36,61 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"log"
+	"maps"
 	"math"
+	mathrand "math/rand/v2"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"runtime/debug"
+	runtimemetrics "runtime/metrics"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+	_ "modernc.org/sqlite" // --capture-db使用的纯Go SQLite驱动
 )
 
 // 初始化随机数种子，确保会话ID的唯一性
@@ -157,7 +189,7 @@ type MessageProcessor interface {
 	// ProcessMessage 处理接收到的消息
 	// 参数：
 	//   - messageType: WebSocket消息类型（TextMessage、BinaryMessage等）
-	//   - data: 消息内容的字节数组
+	//   - data: 消息内容的字节数组，来自内存池，方法返回后会被复用，需要保留时请复制
 	// 返回：
 	//   - error: 处理失败时的错误信息
 	ProcessMessage(messageType int, data []byte) error
@@ -278,7 +310,7 @@ type HealthMetrics struct {
 	WarningCount     int64             `json:"warning_count"`      // 警告计数
 	UptimeSeconds    float64           `json:"uptime_seconds"`     // 运行时间（秒）
 	MemoryUsageBytes int64             `json:"memory_usage_bytes"` // 内存使用量
-	CPUUsagePercent  float64           `json:"cpu_usage_percent"`  // CPU使用率
+	CPUUsagePercent  float64           `json:"cpu_usage_percent"`  // CPU使用率：两次检查之间进程占全部CPU核心的百分比
 }
 
 // ===== 客户端行为配置常量 =====
@@ -299,16 +331,19 @@ const (
 	// ===== 网络超时相关常量 =====
 	// 这些超时值基于实际网络环境测试得出，平衡了响应性和稳定性
 	DefaultPingInterval = 30 * time.Second // Ping消息发送间隔（保持连接活跃，检测连接状态）
-	HandshakeTimeout    = 15 * time.Second // WebSocket握手超时（包含DNS解析、TCP连接、TLS握手等）
+	DefaultPongMisses   = 3                // 启用pong超时检测时，连续未收到pong的次数达到此值即判定连接失效
+	DefaultMaxRedirects = 5                // 跟随握手重定向时的默认最大跳数（防止重定向循环）
+	HandshakeTimeout    = 15 * time.Second // WebSocket握手超时（包含DNS解析、TCP连接、TLS握手和HTTP升级，即整个建连过程）
 	ReadTimeout         = 60 * time.Second // 读取消息超时（等待服务器响应的最长时间）
 	WriteTimeout        = 5 * time.Second  // 写入消息超时（发送消息到网络的最长时间）
-	ConnectionTimeout   = 10 * time.Second // 连接建立超时（TCP连接建立的最长时间）
+	ConnectionTimeout   = 10 * time.Second // 连接建立超时（单个地址TCP连接建立的最长时间，不含TLS握手）
 
 	// ===== 缓冲区大小常量 =====
 	// 缓冲区大小影响内存使用和网络性能，这些值经过性能测试优化
 	DefaultReadBufferSize  = 4096  // 默认读缓冲区大小（4KB，适合大多数消息大小）
 	DefaultWriteBufferSize = 4096  // 默认写缓冲区大小（4KB，平衡内存使用和性能）
 	MaxMessageSize         = 32768 // 最大消息大小（32KB，防止过大消息占用过多内存）
+	DefaultStreamChunkSize = 65536 // 流式读取默认分块大小（64KB，兼顾磁盘写入效率和内存占用）
 )
 
 // ===== 内存池相关常量 =====
@@ -350,6 +385,7 @@ const (
 	ErrCodeSendTimeout     ErrorCode = 2003
 	ErrCodeReceiveTimeout  ErrorCode = 2004
 	ErrCodeEncodingError   ErrorCode = 2005
+	ErrCodeSchemaViolation ErrorCode = 2006
 
 	// 重试相关错误码 (3000-3999)
 	ErrCodeMaxRetriesExceeded ErrorCode = 3001
@@ -386,6 +422,7 @@ func (e ErrorCode) String() string {
 		ErrCodeSendTimeout:        "发送超时",
 		ErrCodeReceiveTimeout:     "接收超时",
 		ErrCodeEncodingError:      "编码错误",
+		ErrCodeSchemaViolation:    "Schema验证失败",
 		ErrCodeMaxRetriesExceeded: "超过最大重试次数",
 		ErrCodeRetryTimeout:       "重试超时",
 		ErrCodeInvalidConfig:      "无效配置",
@@ -398,22 +435,25 @@ func (e ErrorCode) String() string {
 	}
 
 	if msg, exists := errorMessages[e]; exists {
-		return msg
+		return tr(msg)
 	}
-	return "未知错误"
+	return tr("未知错误")
 }
 
 // 自定义错误类型，提供更精确的错误分类和处理
 var (
-	ErrInvalidURL        = errors.New("无效的 WebSocket URL")
-	ErrConnectionFailed  = errors.New("WebSocket 连接失败")
-	ErrConnectionClosed  = errors.New("WebSocket 连接已关闭")
-	ErrInvalidConfig     = errors.New("无效的客户端配置")
-	ErrMaxRetriesReached = errors.New("达到最大重试次数")
-	ErrContextCanceled   = errors.New("操作被取消")
-	ErrHandshakeTimeout  = errors.New("握手超时")
-	ErrReadTimeout       = errors.New("读取超时")
-	ErrWriteTimeout      = errors.New("写入超时")
+	ErrInvalidURL        error = localizedError("无效的 WebSocket URL")
+	ErrConnectionFailed  error = localizedError("WebSocket 连接失败")
+	ErrConnectionClosed  error = localizedError("WebSocket 连接已关闭")
+	ErrInvalidConfig     error = localizedError("无效的客户端配置")
+	ErrMaxRetriesReached error = localizedError("达到最大重试次数")
+	ErrContextCanceled   error = localizedError("操作被取消")
+	ErrHandshakeTimeout  error = localizedError("握手超时")
+	ErrDialTimeout       error = localizedError("TCP连接超时")
+	ErrReadTimeout       error = localizedError("读取超时")
+	ErrWriteTimeout      error = localizedError("写入超时")
+	ErrQueued            error = localizedError("消息已保留在发送日志中，等待重发")
+	ErrStreamMiddleware  error = localizedError("流式发送不经过出站中间件，启用加密或压缩时不能流式发送")
 )
 
 // ConnectionError 表示连接相关的错误
@@ -546,6 +586,53 @@ func (e *RetryError) GetCode() ErrorCode {
 	return e.Code
 }
 
+// HandshakeRejectedError 表示服务器以HTTP响应拒绝了WebSocket升级
+// 保留状态码和Retry-After，供重试调度器遵循服务器要求的等待时间
+type HandshakeRejectedError struct {
+	Status     string        // HTTP状态行，例如"429 Too Many Requests"
+	StatusCode int           // HTTP状态码
+	RetryAfter time.Duration // 429/503响应中Retry-After要求的等待时间，0表示未指定
+	Body       string        // 响应体内容，用于诊断
+	Err        error         // 底层握手错误
+}
+
+// Error 实现error接口，返回包含HTTP状态和响应体的错误描述
+func (e *HandshakeRejectedError) Error() string {
+	return fmt.Sprintf(tr("连接失败 [%s]: %v, 响应: %s"), e.Status, e.Err, e.Body)
+}
+
+// Unwrap 实现errors.Unwrap接口，返回底层握手错误
+func (e *HandshakeRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// parseRetryAfter 解析Retry-After头部
+// 支持秒数和HTTP日期两种格式（RFC 9110），日期早于当前时间或格式无效时返回0
+//
+// 参数说明：
+//   - value: Retry-After头部的值
+//   - now: 当前时间，用于计算HTTP日期格式的剩余时长
+//
+// 返回值：
+//   - time.Duration: 服务器要求的等待时间，不做截断；需要限制总等待时间时使用--max-retry-duration，
+//     超出剩余重试时长的要求由waitForRetry直接停止重试
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(min(seconds, int64(math.MaxInt64/time.Second))) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
 // TLSConfig TLS配置管理结构体
 // 这个结构体封装了WebSocket连接的TLS/SSL配置选项
 // 提供了灵活的TLS配置管理，支持开发和生产环境的不同需求
@@ -563,6 +650,8 @@ type TLSConfig struct {
 	InsecureSkipVerify bool              // 是否跳过证书验证（仅开发环境使用）
 	ServerName         string            // 服务器名称，用于SNI和证书验证
 	Certificates       []tls.Certificate // 客户端证书列表，用于双向TLS认证
+	PinnedSHA256       []string          // 固定的公钥SHA-256指纹（Base64），非空时服务器证书链中必须有公钥匹配其中之一
+	KeyLogWriter       io.Writer         // TLS密钥日志输出（NSS Key Log格式），供Wireshark解密流量，仅用于调试
 }
 
 // GetTLSConfig 返回配置的TLS设置
@@ -580,12 +669,50 @@ type TLSConfig struct {
 //   - 生产环境应该设置InsecureSkipVerify为false
 //   - 如果使用自签名证书，需要正确配置ServerName
 //   - 客户端证书应该妥善保管，避免泄露
+//   - 设置了PinnedSHA256时，即使跳过证书验证也会检查公钥指纹
+//   - 设置了KeyLogWriter时会输出会话密钥，任何拿到日志的人都能解密流量
 func (tc *TLSConfig) GetTLSConfig() *tls.Config {
-	return &tls.Config{
+	config := &tls.Config{
 		InsecureSkipVerify: tc.InsecureSkipVerify,
 		ServerName:         tc.ServerName,
 		Certificates:       tc.Certificates,
+		KeyLogWriter:       tc.KeyLogWriter,
+	}
+	if len(tc.PinnedSHA256) > 0 {
+		config.VerifyPeerCertificate = tc.verifyPinnedCertificate
+	}
+	return config
+}
+
+// verifyPinnedCertificate 检查服务器证书链中是否有证书的公钥匹配固定的指纹
+// 作为tls.Config.VerifyPeerCertificate使用，在常规PKI验证之后执行（跳过验证时单独执行）
+// 匹配链中任意一张证书即可，因此既可以固定服务器自身的公钥，也可以固定中间CA的公钥
+func (tc *TLSConfig) verifyPinnedCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	var leafPin string
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf(tr("解析服务器证书失败: %w"), err)
+		}
+		pin := spkiFingerprint(cert)
+		if i == 0 {
+			leafPin = pin
+		}
+		if slices.Contains(tc.PinnedSHA256, pin) {
+			return nil
+		}
+	}
+	return fmt.Errorf(tr("服务器证书公钥指纹 %s 不匹配任何固定值"), leafPin)
+}
+
+// normalizeCertPin 规范化证书固定指纹：去掉curl风格的sha256//前缀并验证是32字节SHA-256的Base64编码
+func normalizeCertPin(pin string) (string, error) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256//")
+	sum, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil || len(sum) != sha256.Size {
+		return "", fmt.Errorf(tr("无效的公钥指纹 '%s'，需要SHA-256摘要的Base64编码"), pin)
 	}
+	return pin, nil
 }
 
 // defaultTLSConfig 默认TLS配置（开发环境使用）
@@ -634,14 +761,19 @@ type ClientConfig struct {
 	MaxRetries int           `json:"max_retries" yaml:"max_retries"` // 快速重试次数（0表示5次快速+无限慢速重试）
 	RetryDelay time.Duration `json:"retry_delay" yaml:"retry_delay"` // 慢速重试间隔，范围1-60秒
 
+	MaxRetryDuration time.Duration `json:"max_retry_duration,omitempty" yaml:"max_retry_duration,omitempty"` // 重试总时长上限：从首次连接失败起计时，超过后无论剩余次数都停止重试，0表示不限制
+
 	// ===== 超时配置 =====
-	HandshakeTimeout time.Duration `json:"handshake_timeout" yaml:"handshake_timeout"` // WebSocket握手超时时间
+	HandshakeTimeout time.Duration `json:"handshake_timeout" yaml:"handshake_timeout"` // WebSocket握手超时时间（覆盖TCP连接、TLS握手和HTTP升级）
+	DialTimeout      time.Duration `json:"dial_timeout" yaml:"dial_timeout"`           // TCP连接建立超时（每个地址单独计时），0表示只受握手超时限制
 	ReadTimeout      time.Duration `json:"read_timeout" yaml:"read_timeout"`           // 消息读取超时时间
 	WriteTimeout     time.Duration `json:"write_timeout" yaml:"write_timeout"`         // 消息写入超时时间
 	PingInterval     time.Duration `json:"ping_interval" yaml:"ping_interval"`         // Ping消息发送间隔
 
 	// ===== Ping/Pong配置 =====
-	DisableAutoPing bool `json:"disable_auto_ping" yaml:"disable_auto_ping"` // 禁用自动ping功能：启用时客户端不会主动发送ping消息，但仍会响应服务器的ping
+	DisableAutoPing bool          `json:"disable_auto_ping" yaml:"disable_auto_ping"`           // 禁用自动ping功能：启用时客户端不会主动发送ping消息，但仍会响应服务器的ping
+	PongTimeout     time.Duration `json:"pong_timeout,omitempty" yaml:"pong_timeout,omitempty"` // 每个ping等待pong的时限，0表示不检测（只依赖读取超时）
+	PongMisses      int           `json:"pong_misses,omitempty" yaml:"pong_misses,omitempty"`   // 连续多少个ping未收到pong时主动断开并重连
 
 	// ===== 缓冲区配置 =====
 	ReadBufferSize  int `json:"read_buffer_size" yaml:"read_buffer_size"`   // 读缓冲区大小（字节），影响读取性能
@@ -649,21 +781,183 @@ type ClientConfig struct {
 	MaxMessageSize  int `json:"max_message_size" yaml:"max_message_size"`   // 最大消息大小（字节），防止内存溢出
 
 	// ===== 日志配置 =====
-	Verbose     bool   `json:"verbose" yaml:"verbose"`           // 启用详细日志模式，显示更多调试信息
-	VerbosePing bool   `json:"verbose_ping" yaml:"verbose_ping"` // 启用详细ping/pong日志，显示心跳消息
-	LogLevel    int    `json:"log_level" yaml:"log_level"`       // 日志级别：0=ERROR, 1=WARN, 2=INFO, 3=DEBUG
-	LogFile     string `json:"log_file" yaml:"log_file"`         // 消息日志文件路径，空字符串表示不记录文件
+	Verbose        bool     `json:"verbose" yaml:"verbose"`                         // 启用详细日志模式，显示更多调试信息
+	VerbosePing    bool     `json:"verbose_ping" yaml:"verbose_ping"`               // 启用详细ping/pong日志，显示心跳消息
+	LogLevel       int      `json:"log_level" yaml:"log_level"`                     // 日志级别：0=ERROR, 1=WARN, 2=INFO, 3=DEBUG
+	LogFile        string   `json:"log_file" yaml:"log_file"`                       // 消息日志文件路径，空字符串表示不记录文件
+	LogSplit       bool     `json:"log_split" yaml:"log_split"`                     // 发送和接收的消息分别记录到<名称>.send.log和<名称>.recv.log
+	LogFormat      string   `json:"log_format" yaml:"log_format"`                   // 消息日志格式：text（默认）、json（每行一个JSON对象）、raw（长度前缀的原始载荷）
+	Timestamp      string   `json:"timestamp" yaml:"timestamp"`                     // 控制台和文本消息日志的时间戳格式：rfc3339、unix、unixms、none，空字符串表示默认格式
+	LogSyslog      string   `json:"log_syslog" yaml:"log_syslog"`                   // 运行日志同时发送到syslog："local"表示本机syslog，或udp://、tcp://地址（未指定协议时为UDP）
+	SyslogMessages bool     `json:"syslog_messages" yaml:"syslog_messages"`         // 收发的消息记录也发送到syslog（需要LogSyslog）
+	Quiet          bool     `json:"quiet" yaml:"quiet"`                             // 静默模式：屏蔽所有运行日志，只把收到的原始消息写到标准输出
+	SummaryJSON    string   `json:"summary_json" yaml:"summary_json"`               // 退出时写入JSON会话摘要的路径，"-"表示标准输出，空字符串表示不输出
+	Transcript     string   `json:"transcript" yaml:"transcript"`                   // 退出时写入会话记录（握手头部、每一帧和关闭详情）的路径，"-"表示标准输出，空字符串表示不记录
+	CaptureDB      string   `json:"capture_db" yaml:"capture_db"`                   // 收发的每一帧写入的SQLite数据库路径，空字符串表示不抓包
+	StateFile      string   `json:"state_file" yaml:"state_file"`                   // 累计统计和错误历史的状态文件：启动时加载，运行中周期性保存，空字符串表示不持久化
+	Journal        string   `json:"journal" yaml:"journal"`                         // 出站消息预写日志目录：未发送成功的消息在重连或重启后重发，空字符串表示不启用
+	Color          string   `json:"color" yaml:"color"`                             // 控制台颜色模式：auto、always、never
+	Highlight      []string `json:"highlight,omitempty" yaml:"highlight,omitempty"` // 高亮接收消息中匹配的子串：正则[:颜色]，颜色默认red（需要启用颜色）
+	ASCII          bool     `json:"ascii" yaml:"ascii"`                             // 纯ASCII输出：将日志中的emoji前缀替换为文字标签，适用于无法显示emoji的终端和日志系统
+	Lang           string   `json:"lang,omitempty" yaml:"lang,omitempty"`           // 输出语言：zh、en，空字符串表示按LANG等环境变量判断
 
 	// ===== 交互模式配置 =====
-	Interactive bool `json:"interactive" yaml:"interactive"` // 启用交互式消息发送模式，允许用户输入消息
+	Interactive   bool   `json:"interactive" yaml:"interactive"`                           // 启用交互式消息发送模式，允许用户输入消息
+	TUI           bool   `json:"tui" yaml:"tui"`                                           // 启用全屏终端界面：分栏显示消息、日志、统计和发送输入框
+	HistoryFile   string `json:"history_file,omitempty" yaml:"history_file,omitempty"`     // 交互模式发送历史文件：启动时加载，之后发送的消息追加写入，空字符串表示不保存
+	Prompt        string `json:"prompt,omitempty" yaml:"prompt,omitempty"`                 // 交互模式输入提示符，空字符串时使用默认提示符
+	MessageFormat string `json:"message_format,omitempty" yaml:"message_format,omitempty"` // 收发消息的显示模板（text/template）或预设名称terse、verbose，空字符串时使用默认日志格式
 
 	// ===== 监控配置 =====
 	MetricsEnabled bool `json:"metrics_enabled" yaml:"metrics_enabled"` // 启用Prometheus指标收集和HTTP端点
 	MetricsPort    int  `json:"metrics_port" yaml:"metrics_port"`       // Prometheus指标服务端口（默认9090）
 	HealthPort     int  `json:"health_port" yaml:"health_port"`         // 健康检查服务端口（默认8080）
+	AdminPort      int  `json:"admin_port" yaml:"admin_port"`           // 统一管理端口：大于0时在同一端口提供/metrics、/health、/ready、/stats和管理API，取代分开的两个服务器
+
+	// ===== 连接元数据标签 =====
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"` // 常量标签：附加到所有导出的Prometheus指标以及JSON统计和会话摘要，用于在聚合仪表板中区分客户端
+
+	// ===== 就绪判定配置 =====
+	ReadyRequireMessage bool          `json:"ready_require_message" yaml:"ready_require_message"` // /ready要求本次连接已收到至少一条消息
+	ReadyMaxSilence     time.Duration `json:"ready_max_silence" yaml:"ready_max_silence"`         // /ready要求距最后一条消息不超过该时长（0表示不检查）
+
+	// ===== SLO配置 =====
+	SLOAvailability   float64       `json:"slo_availability,omitempty" yaml:"slo_availability,omitempty"`       // 可用性目标（%）：已连接时间占运行时间的比例，0表示不检查
+	SLOMessageSuccess float64       `json:"slo_message_success,omitempty" yaml:"slo_message_success,omitempty"` // 发送成功率目标（%），0表示不检查
+	SLOMaxReconnects  float64       `json:"slo_max_reconnects,omitempty" yaml:"slo_max_reconnects,omitempty"`   // 每小时允许的最多重连次数，0表示不检查
+	SLOWindow         time.Duration `json:"slo_window,omitempty" yaml:"slo_window,omitempty"`                   // SLO长窗口时长，短窗口为其1/12
+	SLOBurnRate       float64       `json:"slo_burn_rate,omitempty" yaml:"slo_burn_rate,omitempty"`             // 长短窗口的错误预算消耗速率都达到该倍数时/health报告degraded
+
+	// ===== 运行模式配置 =====
+	Mode             string        `json:"mode,omitempty" yaml:"mode,omitempty"`                             // 运行模式：空字符串为普通客户端，其余取值见Mode*常量（bridge、relay、check、scenario、bench、replay、serve等）
+	ListenAddr       string        `json:"listen,omitempty" yaml:"listen,omitempty"`                         // 桥接/中继/测试服务器模式的本地监听地址（如:8081）
+	BridgeTimeout    time.Duration `json:"bridge_timeout,omitempty" yaml:"bridge_timeout,omitempty"`         // 桥接模式等待WebSocket响应的超时时间
+	CheckMessage     string        `json:"check_message,omitempty" yaml:"check_message,omitempty"`           // check模式发送的消息，空字符串时发送随机令牌
+	CheckExpect      string        `json:"check_expect,omitempty" yaml:"check_expect,omitempty"`             // check模式期望的响应（正则表达式），空字符串时期望原样回显
+	CheckTimeout     time.Duration `json:"check_timeout,omitempty" yaml:"check_timeout,omitempty"`           // check模式的总时限：握手加等待响应
+	CheckWarn        time.Duration `json:"check_warn,omitempty" yaml:"check_warn,omitempty"`                 // check模式往返时间超过该值时以WARNING退出，0表示不检查
+	Script           string        `json:"script,omitempty" yaml:"script,omitempty"`                         // scenario模式执行的场景脚本文件（YAML或JSON）
+	BenchConnections int           `json:"bench_connections,omitempty" yaml:"bench_connections,omitempty"`   // bench模式的并发连接数
+	BenchMessages    int           `json:"bench_messages,omitempty" yaml:"bench_messages,omitempty"`         // bench模式每个连接发送并等待回显的消息数
+	BenchPayloadSize int           `json:"bench_payload_size,omitempty" yaml:"bench_payload_size,omitempty"` // bench模式每条消息的载荷字节数
+	ReplayFrom       string        `json:"replay_from,omitempty" yaml:"replay_from,omitempty"`               // replay模式读取的会话记录（--transcript）或抓包数据库（--capture-db）
+	ReplaySpeed      string        `json:"replay_speed,omitempty" yaml:"replay_speed,omitempty"`             // replay模式的重放速度：realtime、max（不等待）或倍数（如2x），原始消息间隔除以倍数
+	ReplayLoop       int           `json:"replay_loop,omitempty" yaml:"replay_loop,omitempty"`               // replay模式重复重放全部消息的次数
+	ServeBroadcast   bool          `json:"serve_broadcast,omitempty" yaml:"serve_broadcast,omitempty"`       // serve模式把收到的消息广播给所有客户端，默认只回显给发送方
+
+	// ===== 管理API配置 =====
+	AdminToken string `json:"-" yaml:"-"` // 管理API访问令牌：设置后在健康检查端口（或统一管理端口）启用/send、/close、/messages，不写入配置文件
+
+	// ===== Webhook通知配置 =====
+	WebhookURL    string `json:"webhook_url,omitempty" yaml:"webhook_url,omitempty"` // 连接事件通知地址：连接、断开、重试耗尽和安全违规时POST JSON事件，空字符串表示不发送
+	WebhookSecret string `json:"-" yaml:"-"`                                         // Webhook签名密钥：设置后以HMAC-SHA256签名请求体，不写入配置文件
+
+	// ===== 生命周期命令配置 =====
+	OnConnectExec    string `json:"on_connect_exec,omitempty" yaml:"on_connect_exec,omitempty"`       // 连接建立时通过shell运行的命令
+	OnDisconnectExec string `json:"on_disconnect_exec,omitempty" yaml:"on_disconnect_exec,omitempty"` // 连接断开时通过shell运行的命令
+	OnMessageExec    string `json:"on_message_exec,omitempty" yaml:"on_message_exec,omitempty"`       // 收到数据消息时通过shell运行的命令，载荷写入标准输入
+
+	// ===== 消息转发配置 =====
+	Forward string `json:"forward,omitempty" yaml:"forward,omitempty"` // 收到的数据消息批量转发到的目标：kafka://broker/topic 或 nats://server/subject，空字符串表示不转发
 
 	// ===== TLS 安全配置 =====
 	ForceTLSVerify bool `json:"force_tls_verify" yaml:"force_tls_verify"` // 强制启用TLS证书验证，覆盖默认的跳过验证行为
+
+	// ===== 流式读取配置 =====
+	StreamThreshold int    `json:"stream_threshold" yaml:"stream_threshold"`   // 流式读取阈值（字节）：超过此大小的消息分块落盘或交给回调，0表示禁用
+	StreamChunkSize int    `json:"stream_chunk_size" yaml:"stream_chunk_size"` // 流式读取分块大小（字节）
+	StreamDir       string `json:"stream_dir" yaml:"stream_dir"`               // 大消息落盘目录，必须位于当前工作目录内，空字符串表示当前目录
+
+	// ===== 文件发送配置 =====
+	SendFile string `json:"send_file,omitempty" yaml:"send_file,omitempty"` // 连接建立后以流式分片方式发送的文件路径（二进制消息）
+	Tail     string `json:"tail,omitempty" yaml:"tail,omitempty"`           // 跟随的文件路径（类似tail -F）：每个新写入的行作为文本消息发送，处理文件轮转和截断
+	Rules    string `json:"rules,omitempty" yaml:"rules,omitempty"`         // 自动回复规则文件路径（YAML或JSON）
+
+	// ===== 序列号检测配置 =====
+	SeqPath        string `json:"seq_path,omitempty" yaml:"seq_path,omitempty"`               // 收到的JSON消息中序列号的路径（如 seq、data.sequence），空字符串表示不检测
+	SeqResubscribe string `json:"seq_resubscribe,omitempty" yaml:"seq_resubscribe,omitempty"` // 检测到序列号跳跃时发送的消息模板（text/template，可引用.Expected和.Received）
+
+	// ===== 后台采样配置 =====
+	SampleInterval time.Duration `json:"sample_interval" yaml:"sample_interval"` // 后台采样间隔：周期性执行死锁检查、系统指标采样和组件健康检查，0表示禁用
+
+	// ===== 安全检查配置 =====
+	BlockedPatterns []string `json:"blocked_patterns,omitempty" yaml:"blocked_patterns,omitempty"`   // 阻止的内容模式，设置后替换默认模式；re:前缀表示正则表达式
+	AllowPatterns   []string `json:"allow_patterns,omitempty" yaml:"allow_patterns,omitempty"`       // 允许的内容模式，非空时发送的文本消息必须匹配其中之一
+	AllowedOrigins  []string `json:"allowed_origins,omitempty" yaml:"allowed_origins,omitempty"`     // 中继模式允许的跨源本地连接来源（Origin头），为空时只允许同源连接
+	NoSecurityCheck bool     `json:"no_security_check,omitempty" yaml:"no_security_check,omitempty"` // 关闭消息内容检查，适用于会误触发子串检查的协议
+	E2EKeyFile      string   `json:"e2e_key_file,omitempty" yaml:"e2e_key_file,omitempty"`           // 端到端加密密钥文件（AES-GCM），设置后所有数据消息加密收发
+
+	// ===== 载荷压缩配置 =====
+	PayloadGzip bool `json:"payload_gzip,omitempty" yaml:"payload_gzip,omitempty"` // 应用层gzip压缩：发送前压缩载荷，接收时自动解压gzip载荷
+
+	// ===== 网络模拟配置 =====
+	SimulateLatency   time.Duration `json:"simulate_latency,omitempty" yaml:"simulate_latency,omitempty"`     // 模拟的附加往返延迟，收发方向各加一半，0表示不模拟
+	SimulateBandwidth int64         `json:"simulate_bandwidth,omitempty" yaml:"simulate_bandwidth,omitempty"` // 模拟的带宽上限（比特/秒），收发方向分别限制，0表示不限制
+
+	// ===== 调试配置 =====
+	TraceFrames   bool   `json:"trace_frames,omitempty" yaml:"trace_frames,omitempty"`     // 记录收发的每个WebSocket帧（操作码、FIN、长度、掩码、载荷前缀）
+	Strict        bool   `json:"strict,omitempty" yaml:"strict,omitempty"`                 // 严格模式：按RFC 6455逐帧检查服务器发来的帧并按类型记录协议违规
+	StrictFail    bool   `json:"strict_fail,omitempty" yaml:"strict_fail,omitempty"`       // 严格模式下发现协议违规时发送关闭帧并断开连接（需要Strict）
+	HexDump       bool   `json:"hexdump,omitempty" yaml:"hexdump,omitempty"`               // 以xxd风格（偏移/十六进制/ASCII）完整输出收发的二进制消息，同时作用于控制台和消息日志
+	DryRun        bool   `json:"-" yaml:"-"`                                               // 连接预检：依次执行DNS、TCP、TLS和WebSocket升级并输出各阶段结果后退出
+	ShowCert      bool   `json:"show_cert,omitempty" yaml:"show_cert,omitempty"`           // 连接建立后输出服务器证书链（主题、签发者、SAN、有效期、指纹）
+	DumpHandshake bool   `json:"dump_handshake,omitempty" yaml:"dump_handshake,omitempty"` // 输出WebSocket升级请求和响应的完整HTTP头部
+	TLSKeyLog     string `json:"tls_keylog,omitempty" yaml:"tls_keylog,omitempty"`         // TLS密钥日志文件路径（追加写入），未指定时使用SSLKEYLOGFILE环境变量
+
+	// ===== 混沌测试配置 =====
+	Chaos *ChaosConfig `json:"chaos,omitempty" yaml:"chaos,omitempty"` // 故障注入配置，nil表示不启用
+
+	// ===== 消息验证配置 =====
+	ValidateJSON    bool   `json:"validate_json,omitempty" yaml:"validate_json,omitempty"`       // 要求收发的文本消息都是有效JSON
+	SchemaFile      string `json:"schema,omitempty" yaml:"schema,omitempty"`                     // JSON Schema文件路径，用于验证文本消息
+	SchemaDirection string `json:"schema_direction,omitempty" yaml:"schema_direction,omitempty"` // Schema验证方向：in、out或both
+
+	// ===== 消息显示过滤配置 =====
+	GrepPatterns []string `json:"grep,omitempty" yaml:"grep,omitempty"`         // 只显示和记录匹配的接收消息（正则表达式），多个模式默认满足任一即可
+	GrepExclude  []string `json:"grep_v,omitempty" yaml:"grep_v,omitempty"`     // 隐藏匹配任一模式的接收消息（正则表达式）
+	GrepAll      bool     `json:"grep_all,omitempty" yaml:"grep_all,omitempty"` // 多个--grep模式必须全部匹配才显示
+
+	// ===== 内存配置 =====
+	MaxMemory   int64 `json:"max_memory,omitempty" yaml:"max_memory,omitempty"`     // 软内存上限（字节）：设置debug.SetMemoryLimit，接近上限时释放缓存，0表示不限制
+	GCPercent   int   `json:"gc_percent,omitempty" yaml:"gc_percent,omitempty"`     // GOGC百分比：0表示不修改（沿用GOGC环境变量），-1表示关闭按比例触发的GC
+	BufferTiers []int `json:"buffer_tiers,omitempty" yaml:"buffer_tiers,omitempty"` // 内存池的自定义档位大小（字节），在默认的1KB、4KB、16KB之外增加，如调大MaxMessageSize后增加64KB档位
+
+	// ===== 入站队列配置 =====
+	InboundQueueSize int     `json:"inbound_queue,omitempty" yaml:"inbound_queue,omitempty"`       // 入站队列容量：大于0时消息先入队，由独立goroutine分发给显示、回调和规则，0表示在读取goroutine中同步处理
+	MaxReceiveRate   float64 `json:"max_receive_rate,omitempty" yaml:"max_receive_rate,omitempty"` // 消息分发速率上限（条/秒）：匀速交给显示和回调，突发由入站队列吸收，0表示不限制
+	Backpressure     string  `json:"backpressure,omitempty" yaml:"backpressure,omitempty"`         // 入站队列满时的策略：block、drop-oldest或drop-newest
+	OnBadUTF8        string  `json:"on_bad_utf8,omitempty" yaml:"on_bad_utf8,omitempty"`           // 收到无效UTF-8文本消息时的策略：warn、replace或close
+
+	// ===== 发送限速配置 =====
+	SendRate  float64 `json:"send_rate,omitempty" yaml:"send_rate,omitempty"`   // 令牌桶发送速率（条/秒）：超出时平滑等待而非拒绝，0表示使用默认滑动窗口（每分钟100条）
+	SendBurst int     `json:"send_burst,omitempty" yaml:"send_burst,omitempty"` // 令牌桶容量：允许的最大突发发送数，0表示与发送速率相同（至少为1）
+
+	// ===== 自动退出配置 =====
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"` // 空闲超时：超过此时长未收到任何消息时自动退出，0表示禁用
+	MaxMessages int           `json:"max_messages,omitempty" yaml:"max_messages,omitempty"` // 最大接收消息数：累计收到N条消息后自动退出，0表示不限制
+	MaxDuration time.Duration `json:"max_duration,omitempty" yaml:"max_duration,omitempty"` // 最长运行时间：客户端启动后运行超过此时长自动退出，0表示不限制
+
+	// ===== 名称解析配置 =====
+	ResolveOverrides map[string]string `json:"resolve_overrides,omitempty" yaml:"resolve_overrides,omitempty"` // 主机解析覆盖：host:port -> IP地址（与curl --resolve语义一致）
+	DNSServer        string            `json:"dns_server,omitempty" yaml:"dns_server,omitempty"`               // 自定义DNS服务器（server:port），为空时使用系统解析器
+	DNSCacheTTL      time.Duration     `json:"dns_cache_ttl,omitempty" yaml:"dns_cache_ttl,omitempty"`         // DNS解析结果缓存时长：0表示每次连接尝试都重新解析，大于0时在有效期内复用上次解析的地址
+
+	// ===== URL查询参数 =====
+	QueryParams []string `json:"-" yaml:"-"` // --query指定的key=value查询参数，解析URL时编码并合并到URL中
+
+	// ===== 分片连接配置 =====
+	Shards     []string `json:"shards,omitempty" yaml:"shards,omitempty"`           // 分片列表，每个分片一条连接：设置ShardParam时是查询参数的取值，否则是URL之外其他连接的URL
+	ShardParam string   `json:"shard_param,omitempty" yaml:"shard_param,omitempty"` // 分片查询参数名：设置后每条连接在URL上附加 参数名=分片取值
+
+	// ===== 握手重定向配置 =====
+	FollowRedirects bool `json:"follow_redirects,omitempty" yaml:"follow_redirects,omitempty"` // 升级请求返回301/302/307/308时跟随Location重新握手，而不是直接失败
+	MaxRedirects    int  `json:"max_redirects,omitempty" yaml:"max_redirects,omitempty"`       // 单次连接最多跟随的重定向次数
+
+	AllowInsecureRedirect bool `json:"allow_insecure_redirect,omitempty" yaml:"allow_insecure_redirect,omitempty"` // 允许从wss://重定向到明文ws://或http://地址，默认拒绝，避免令牌和消息被降级为明文传输
+
+	// ===== 握手请求头配置 =====
+	UserAgent string `json:"user_agent,omitempty" yaml:"user_agent,omitempty"` // 握手请求的User-Agent，空字符串表示使用默认值（WebSocket-Client/<版本>）
+	Origin    string `json:"origin,omitempty" yaml:"origin,omitempty"`         // 握手请求的Origin头，"auto"表示按目标地址推导（ws→http、wss→https），空字符串表示不发送
 }
 
 // NewDefaultConfig 创建一个具有默认值的ClientConfig
@@ -689,10 +983,11 @@ type ClientConfig struct {
 //	config.Verbose = true  // 启用详细日志
 //	client := NewWebSocketClient(config)
 func NewDefaultConfig(url string) *ClientConfig {
+	tlsConfig := *defaultTLSConfig // 复制一份，证书固定等设置只影响本配置
 	return &ClientConfig{
 		// 连接配置
-		URL:       url,              // 用户指定的WebSocket服务器地址
-		TLSConfig: defaultTLSConfig, // 默认TLS配置（开发环境友好）
+		URL:       url,        // 用户指定的WebSocket服务器地址
+		TLSConfig: &tlsConfig, // 默认TLS配置（开发环境友好）
 
 		// 重试策略配置
 		MaxRetries: DefaultMaxRetries, // 5次快速重试
@@ -700,19 +995,38 @@ func NewDefaultConfig(url string) *ClientConfig {
 
 		// 超时配置（经过实际测试优化）
 		HandshakeTimeout: HandshakeTimeout,    // 15秒握手超时
+		DialTimeout:      ConnectionTimeout,   // 10秒TCP连接超时
 		ReadTimeout:      ReadTimeout,         // 60秒读取超时
 		WriteTimeout:     WriteTimeout,        // 5秒写入超时
 		PingInterval:     DefaultPingInterval, // 30秒心跳间隔
 
 		// 缓冲区配置（平衡内存使用和性能）
-		ReadBufferSize:  DefaultReadBufferSize,  // 4KB读缓冲区
-		WriteBufferSize: DefaultWriteBufferSize, // 4KB写缓冲区
-		MaxMessageSize:  MaxMessageSize,         // 32KB最大消息大小
+		ReadBufferSize:   DefaultReadBufferSize,   // 4KB读缓冲区
+		WriteBufferSize:  DefaultWriteBufferSize,  // 4KB写缓冲区
+		MaxMessageSize:   MaxMessageSize,          // 32KB最大消息大小
+		StreamChunkSize:  DefaultStreamChunkSize,  // 64KB流式读取分块
+		BridgeTimeout:    DefaultBridgeTimeout,    // 5秒桥接响应超时
+		CheckTimeout:     DefaultCheckTimeout,     // 5秒回显探测时限
+		BenchConnections: DefaultBenchConnections, // 10个并发压测连接
+		BenchMessages:    DefaultBenchMessages,    // 每个压测连接100条消息
+		BenchPayloadSize: DefaultBenchPayloadSize, // 64字节压测载荷
+		ReplaySpeed:      ReplaySpeedRealtime,     // 按原始间隔重放
+		ReplayLoop:       1,                       // 重放一遍
+		PongMisses:       DefaultPongMisses,       // 连续3次未收到pong判定连接失效
+		MaxRedirects:     DefaultMaxRedirects,     // 最多跟随5次握手重定向
+		SchemaDirection:  SchemaDirectionIn,       // 默认只验证接收的消息
+		Backpressure:     BackpressureBlock,       // 入站队列满时阻塞读取
+		OnBadUTF8:        BadUTF8Warn,             // 无效UTF-8文本消息记录警告后照常处理
+		SLOWindow:        DefaultSLOWindow,        // SLO指标按最近1小时计算
+		SLOBurnRate:      DefaultSLOBurnRate,      // 错误预算消耗速率达到2倍时判定为降级
+		SampleInterval:   DefaultSampleInterval,   // 每10秒后台采样一次
 
 		// 日志配置（适中的详细程度）
-		VerbosePing: false, // 默认不显示ping/pong消息
-		LogLevel:    2,     // INFO级别，提供足够信息
-		LogFile:     "",    // 默认不记录到文件
+		VerbosePing: false,         // 默认不显示ping/pong消息
+		LogLevel:    2,             // INFO级别，提供足够信息
+		LogFile:     "",            // 默认不记录到文件
+		LogFormat:   LogFormatText, // 可读文本格式
+		Color:       ColorAuto,     // 输出到终端时自动启用颜色
 
 		// 功能配置（保守的默认设置）
 		Interactive:    false, // 默认非交互模式
@@ -737,6 +1051,8 @@ func NewDefaultConfig(url string) *ClientConfig {
 //  3. 超时配置：确保所有超时值为正数
 //  4. 缓冲区配置：验证缓冲区大小
 //  5. 日志配置：检查日志级别范围
+//  6. 名称解析配置：检查--resolve覆盖和--dns服务器格式
+//  7. 流式读取配置：检查阈值、分块大小和落盘目录
 //
 // 使用场景：
 //   - 客户端初始化前的配置检查
@@ -765,17 +1081,17 @@ func NewDefaultConfig(url string) *ClientConfig {
 func (c *ClientConfig) validateURL() error {
 	// 第一步：验证URL是否为空
 	if c.URL == "" {
-		return fmt.Errorf("%w: URL不能为空", ErrInvalidConfig)
+		return fmt.Errorf(tr("%w: URL不能为空"), ErrInvalidConfig)
 	}
 
 	// 第二步：验证URL格式是否正确
 	if _, err := url.Parse(c.URL); err != nil {
-		return fmt.Errorf("%w: 无效的URL格式: %v", ErrInvalidURL, err)
+		return fmt.Errorf(tr("%w: 无效的URL格式: %v"), ErrInvalidURL, err)
 	}
 
 	// 第三步：验证是否为WebSocket协议URL
 	if !isValidWebSocketURL(c.URL) {
-		return fmt.Errorf("%w: URL必须以ws://或wss://开头", ErrInvalidURL)
+		return fmt.Errorf(tr("%w: URL必须以ws://或wss://开头"), ErrInvalidURL)
 	}
 
 	return nil
@@ -790,6 +1106,7 @@ func (c *ClientConfig) validateURL() error {
 // 验证项目：
 //  1. 重试次数不能为负数
 //  2. 重试间隔必须在合理范围内
+//  3. 重试总时长不能为负数
 //
 // 设计考虑：
 //   - 允许MaxRetries为0（表示不重试）
@@ -798,12 +1115,17 @@ func (c *ClientConfig) validateURL() error {
 func (c *ClientConfig) validateRetryConfig() error {
 	// 验证重试次数不能为负数
 	if c.MaxRetries < 0 {
-		return fmt.Errorf("%w: 重试次数不能为负数", ErrInvalidConfig)
+		return fmt.Errorf(tr("%w: 重试次数不能为负数"), ErrInvalidConfig)
 	}
 
 	// 验证重试间隔范围
 	if c.RetryDelay < MinRetryDelay || c.RetryDelay > MaxRetryDelay {
-		return fmt.Errorf("%w: 重试间隔必须在 %v 到 %v 之间", ErrInvalidConfig, MinRetryDelay, MaxRetryDelay)
+		return fmt.Errorf(tr("%w: 重试间隔必须在 %v 到 %v 之间"), ErrInvalidConfig, MinRetryDelay, MaxRetryDelay)
+	}
+
+	// 验证重试总时长不能为负数
+	if c.MaxRetryDuration < 0 {
+		return fmt.Errorf(tr("%w: 重试总时长不能为负数"), ErrInvalidConfig)
 	}
 
 	return nil
@@ -820,20 +1142,38 @@ func (c *ClientConfig) validateRetryConfig() error {
 //  2. ReadTimeout: 读取消息超时
 //  3. WriteTimeout: 写入消息超时
 //  4. PingInterval: Ping消息间隔
+//  5. 启用自动ping时，ReadTimeout必须大于PingInterval
+//  6. DialTimeout: TCP连接超时，不能为负数（0表示只受握手超时限制）
 //
 // 设计原则：
 //   - 所有超时值必须为正数，确保有意义的超时控制
+//   - 读取截止时间在收到pong时顺延，读取超时不大于ping间隔时空闲连接会在下一次ping之前超时
 //   - 使用统一的错误消息，便于用户理解
 //   - 一次性检查所有超时配置，提高验证效率
 func (c *ClientConfig) validateTimeoutConfig() error {
 	// 验证所有超时配置必须为正数
 	if c.HandshakeTimeout <= 0 || c.ReadTimeout <= 0 || c.WriteTimeout <= 0 || c.PingInterval <= 0 {
-		return fmt.Errorf("%w: 超时配置必须为正数", ErrInvalidConfig)
+		return fmt.Errorf(tr("%w: 超时配置必须为正数"), ErrInvalidConfig)
+	}
+	if c.DialTimeout < 0 {
+		return fmt.Errorf(tr("%w: TCP连接超时不能为负数"), ErrInvalidConfig)
+	}
+	if !c.DisableAutoPing && c.ReadTimeout <= c.PingInterval {
+		return fmt.Errorf(tr("%w: 读取超时 (%v) 必须大于ping间隔 (%v)"), ErrInvalidConfig, c.ReadTimeout, c.PingInterval)
 	}
 
 	return nil
 }
 
+// tcpDialTimeout 返回单次TCP拨号使用的超时
+// 未配置DialTimeout或其超过握手超时时使用握手超时，因为整个建连过程都受握手超时约束
+func (c *ClientConfig) tcpDialTimeout() time.Duration {
+	if c.DialTimeout <= 0 || c.DialTimeout > c.HandshakeTimeout {
+		return c.HandshakeTimeout
+	}
+	return c.DialTimeout
+}
+
 // validateBufferConfig 验证缓冲区相关配置的有效性
 // 这个函数专门负责缓冲区大小设置的验证，确保所有缓冲区配置都是正数
 //
@@ -852,7 +1192,7 @@ func (c *ClientConfig) validateTimeoutConfig() error {
 func (c *ClientConfig) validateBufferConfig() error {
 	// 验证所有缓冲区大小必须为正数
 	if c.ReadBufferSize <= 0 || c.WriteBufferSize <= 0 || c.MaxMessageSize <= 0 {
-		return fmt.Errorf("%w: 缓冲区大小必须为正数", ErrInvalidConfig)
+		return fmt.Errorf(tr("%w: 缓冲区大小必须为正数"), ErrInvalidConfig)
 	}
 
 	return nil
@@ -877,16 +1217,241 @@ func (c *ClientConfig) validateBufferConfig() error {
 func (c *ClientConfig) validateLogConfig() error {
 	// 验证日志级别范围
 	if c.LogLevel < 0 || c.LogLevel > 3 {
-		return fmt.Errorf("%w: 日志级别必须在 0-3 之间", ErrInvalidConfig)
+		return fmt.Errorf(tr("%w: 日志级别必须在 0-3 之间"), ErrInvalidConfig)
+	}
+
+	// 验证消息日志格式
+	switch c.LogFormat {
+	case "", LogFormatText, LogFormatJSON, LogFormatRaw:
+	default:
+		return fmt.Errorf(tr("%w: 消息日志格式必须是 text、json 或 raw"), ErrInvalidConfig)
+	}
+
+	// 消息记录发送到syslog需要先启用syslog输出
+	if c.SyslogMessages && c.LogSyslog == "" {
+		return fmt.Errorf(tr("%w: --syslog-messages 需要同时指定 --log-syslog"), ErrInvalidConfig)
+	}
+
+	// 验证时间戳格式
+	switch c.Timestamp {
+	case "", TimestampRFC3339, TimestampUnix, TimestampUnixMs, TimestampNone:
+	default:
+		return fmt.Errorf(tr("%w: 时间戳格式必须是 rfc3339、unix、unixms 或 none"), ErrInvalidConfig)
+	}
+
+	// 验证颜色模式
+	switch c.Color {
+	case "", ColorAuto, ColorAlways, ColorNever:
+	default:
+		return fmt.Errorf(tr("%w: 颜色模式必须是 auto、always 或 never"), ErrInvalidConfig)
+	}
+
+	// 验证输出语言
+	switch c.Lang {
+	case "", LangZH, LangEN:
+	default:
+		return fmt.Errorf(tr("%w: 输出语言必须是 zh 或 en"), ErrInvalidConfig)
+	}
+
+	// 静默模式只输出消息内容，不能与全屏界面同时使用
+	if c.Quiet && c.TUI {
+		return fmt.Errorf(tr("%w: --quiet 不能与 --tui 同时使用"), ErrInvalidConfig)
+	}
+
+	// 验证会话摘要输出路径
+	if c.SummaryJSON != "" && c.SummaryJSON != "-" {
+		if _, err := validateWorkDirPath(c.SummaryJSON); err != nil {
+			return fmt.Errorf(tr("%w: 无效的会话摘要路径: %v"), ErrInvalidConfig, err)
+		}
+	}
+
+	// 验证会话记录输出路径
+	if c.Transcript != "" && c.Transcript != "-" {
+		if _, err := validateWorkDirPath(c.Transcript); err != nil {
+			return fmt.Errorf(tr("%w: 无效的会话记录路径: %v"), ErrInvalidConfig, err)
+		}
+	}
+
+	// 验证抓包数据库路径
+	if c.CaptureDB != "" {
+		if _, err := validateWorkDirPath(c.CaptureDB); err != nil {
+			return fmt.Errorf(tr("%w: 无效的抓包数据库路径: %v"), ErrInvalidConfig, err)
+		}
+	}
+
+	// 验证状态文件路径
+	if c.StateFile != "" {
+		if _, err := validateWorkDirPath(c.StateFile); err != nil {
+			return fmt.Errorf(tr("%w: 无效的状态文件路径: %v"), ErrInvalidConfig, err)
+		}
+	}
+
+	// 验证发送日志目录
+	if c.Journal != "" {
+		if _, err := validateWorkDirPath(c.Journal); err != nil {
+			return fmt.Errorf(tr("%w: 无效的发送日志目录: %v"), ErrInvalidConfig, err)
+		}
+	}
+
+	// 违规断开只在严格模式下有意义
+	if c.StrictFail && !c.Strict {
+		return fmt.Errorf(tr("%w: strict_fail 需要同时启用 strict"), ErrInvalidConfig)
+	}
+
+	return nil
+}
+
+// validateStreamConfig 验证流式读取相关配置的有效性
+// 这个函数检查大消息流式读取的阈值、分块大小和落盘目录
+//
+// 返回值：
+//   - error: 如果配置无效，返回具体的错误信息；如果有效，返回nil
+//
+// 验证项目：
+//  1. 阈值不能为负数，0表示禁用流式读取
+//  2. 阈值不能超过MaxMessageSize，保证超限消息都走流式路径
+//  3. 启用时分块大小必须为正数
+//  4. 落盘目录必须位于当前工作目录内
+func (c *ClientConfig) validateStreamConfig() error {
+	if c.StreamThreshold < 0 {
+		return fmt.Errorf(tr("%w: 流式读取阈值不能为负数"), ErrInvalidConfig)
+	}
+	if c.StreamThreshold == 0 {
+		return nil
+	}
+	if c.StreamThreshold > c.MaxMessageSize {
+		return fmt.Errorf(tr("%w: 流式读取阈值 %d 不能大于最大消息大小 %d"), ErrInvalidConfig, c.StreamThreshold, c.MaxMessageSize)
+	}
+	if c.StreamChunkSize <= 0 {
+		return fmt.Errorf(tr("%w: 流式读取分块大小必须为正数"), ErrInvalidConfig)
+	}
+	if c.StreamDir != "" {
+		if _, err := validateWorkDirPath(c.StreamDir); err != nil {
+			return fmt.Errorf(tr("%w: 无效的流式落盘目录: %v"), ErrInvalidConfig, err)
+		}
+	}
+	return nil
+}
+
+// validateExitConfig 验证自动退出条件配置的有效性
+//
+// 返回值：
+//   - error: 任一条件为负数时返回错误；0表示未启用该条件
+func (c *ClientConfig) validateExitConfig() error {
+	if c.IdleTimeout < 0 || c.MaxDuration < 0 {
+		return fmt.Errorf(tr("%w: 空闲超时和最长运行时间不能为负数"), ErrInvalidConfig)
+	}
+	if c.MaxMessages < 0 {
+		return fmt.Errorf(tr("%w: 最大接收消息数不能为负数"), ErrInvalidConfig)
+	}
+	return nil
+}
+
+// validateModeConfig 验证运行模式相关配置的有效性
+//
+// 返回值：
+//   - error: 子命令缺少监听地址或场景脚本、未使用子命令却指定了监听地址或场景脚本、超时或期望的响应无效时返回错误
+func (c *ClientConfig) validateModeConfig() error {
+	if c.Script != "" && c.Mode != ModeScenario {
+		return fmt.Errorf(tr("%w: --script 只能与 scenario 子命令一起使用"), ErrInvalidConfig)
+	}
+	switch c.Mode {
+	case "", ModeConformance, ModeCheck, ModeScenario, ModeBench, ModeReplay:
+		if c.ListenAddr != "" {
+			return fmt.Errorf(tr("%w: --listen 只能与 bridge、relay 或 serve 子命令一起使用"), ErrInvalidConfig)
+		}
+		if c.Mode == ModeScenario && c.Script == "" {
+			return fmt.Errorf(tr("%w: scenario 模式需要使用 --script 指定场景脚本"), ErrInvalidConfig)
+		}
+		if c.Mode == ModeBench && (c.BenchConnections <= 0 || c.BenchMessages <= 0 || c.BenchPayloadSize <= 0) {
+			return fmt.Errorf(tr("%w: 压测的连接数、消息数和载荷大小必须为正数"), ErrInvalidConfig)
+		}
+		if c.Mode == ModeReplay && c.ReplayFrom == "" {
+			return fmt.Errorf(tr("%w: replay 模式需要使用 --from 指定会话记录或抓包数据库"), ErrInvalidConfig)
+		}
+		if c.Mode == ModeReplay {
+			if _, err := parseReplaySpeed(c.ReplaySpeed); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+			}
+			if c.ReplayLoop <= 0 {
+				return fmt.Errorf(tr("%w: 重放次数必须为正数"), ErrInvalidConfig)
+			}
+		}
+		if c.Mode != ModeCheck {
+			break
+		}
+		if c.CheckTimeout <= 0 || c.CheckWarn < 0 {
+			return fmt.Errorf(tr("%w: 回显探测的时限必须为正数，告警阈值不能为负数"), ErrInvalidConfig)
+		}
+		if _, err := regexp.Compile(c.CheckExpect); err != nil {
+			return fmt.Errorf(tr("%w: 期望的响应不是有效的正则表达式: %v"), ErrInvalidConfig, err)
+		}
+	case ModeBridge, ModeRelay:
+		if c.ListenAddr == "" {
+			return fmt.Errorf(tr("%w: %s 模式需要使用 --listen 指定监听地址"), ErrInvalidConfig, c.Mode)
+		}
+		if c.Mode == ModeBridge && c.BridgeTimeout <= 0 {
+			return fmt.Errorf(tr("%w: 桥接响应超时必须为正数"), ErrInvalidConfig)
+		}
+		if c.Mode == ModeBridge && c.AdminToken == "" && !isLoopbackListenAddr(c.ListenAddr) {
+			return fmt.Errorf(tr("%w: 桥接服务监听非本机地址 %s 时必须使用 --admin-token（或WSC_ADMIN_TOKEN）启用认证"), ErrInvalidConfig, c.ListenAddr)
+		}
+	case ModeServe:
+		// 测试服务器的监听地址可以省略，使用默认地址
+	default:
+		return fmt.Errorf(tr("%w: 未知的运行模式 '%s'"), ErrInvalidConfig, c.Mode)
+	}
+	return nil
+}
+
+// hasExitConditions 检查是否配置了任一自动退出条件
+func (c *ClientConfig) hasExitConditions() bool {
+	return c.IdleTimeout > 0 || c.MaxMessages > 0 || c.MaxDuration > 0
+}
+
+// validateResolveConfig 验证名称解析相关配置的有效性
+// 这个函数检查--resolve主机覆盖和--dns自定义DNS服务器的格式
+//
+// 返回值：
+//   - error: 如果配置无效，返回具体的错误信息；如果有效，返回nil
+//
+// 验证项目：
+//  1. 覆盖键必须是合法的host:port形式
+//  2. 覆盖目标必须是IP地址（不允许再次解析的主机名）
+//  3. DNS服务器必须是合法的host:port形式
+//  4. DNS缓存时长不能为负数
+func (c *ClientConfig) validateResolveConfig() error {
+	// 验证主机解析覆盖
+	for hostPort, addr := range c.ResolveOverrides {
+		if _, _, err := net.SplitHostPort(hostPort); err != nil {
+			return fmt.Errorf(tr("%w: 无效的解析覆盖主机 '%s': %v"), ErrInvalidConfig, hostPort, err)
+		}
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf(tr("%w: 解析覆盖目标 '%s' 必须是IP地址"), ErrInvalidConfig, addr)
+		}
+	}
+
+	// 验证自定义DNS服务器
+	if c.DNSServer != "" {
+		if _, _, err := net.SplitHostPort(c.DNSServer); err != nil {
+			return fmt.Errorf(tr("%w: 无效的DNS服务器地址 '%s': %v"), ErrInvalidConfig, c.DNSServer, err)
+		}
+	}
+
+	// 验证DNS缓存时长
+	if c.DNSCacheTTL < 0 {
+		return fmt.Errorf(tr("%w: DNS缓存时长不能为负数"), ErrInvalidConfig)
 	}
 
 	return nil
 }
 
 func (c *ClientConfig) Validate() error {
-	// 第一步：验证URL配置
-	if err := c.validateURL(); err != nil {
-		return err
+	// 第一步：验证URL配置（测试服务器不连接远程服务器，没有URL）
+	if c.Mode != ModeServe {
+		if err := c.validateURL(); err != nil {
+			return err
+		}
 	}
 
 	// 第二步：验证重试配置
@@ -909,10 +1474,243 @@ func (c *ClientConfig) Validate() error {
 		return err
 	}
 
+	// 第六步：验证名称解析配置
+	if err := c.validateResolveConfig(); err != nil {
+		return err
+	}
+
+	// 第七步：验证流式读取配置
+	if err := c.validateStreamConfig(); err != nil {
+		return err
+	}
+
+	// 第八步：验证自动退出条件
+	if err := c.validateExitConfig(); err != nil {
+		return err
+	}
+
+	// 第九步：验证运行模式
+	if err := c.validateModeConfig(); err != nil {
+		return err
+	}
+
+	// 第十步：验证发送限速
+	if c.SendRate < 0 || c.SendBurst < 0 {
+		return fmt.Errorf(tr("%w: 发送速率和突发容量不能为负数"), ErrInvalidConfig)
+	}
+	if c.SendBurst > 0 && c.SendRate == 0 {
+		return fmt.Errorf(tr("%w: --send-burst 需要与 --send-rate 一起使用"), ErrInvalidConfig)
+	}
+
+	// 第十一步：验证安全检查模式
+	if _, err := compileSecurityPatterns(c.BlockedPatterns); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if _, err := compileSecurityPatterns(c.AllowPatterns); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	// 第十二步：验证网络模拟参数
+	if c.SimulateLatency < 0 || c.SimulateBandwidth < 0 {
+		return fmt.Errorf(tr("%w: 模拟延迟和带宽不能为负数"), ErrInvalidConfig)
+	}
+
+	// 第十三步：验证Schema验证方向
+	switch c.SchemaDirection {
+	case SchemaDirectionIn, SchemaDirectionOut, SchemaDirectionBoth:
+	default:
+		return fmt.Errorf(tr("%w: Schema验证方向 '%s' 无效，可选 in、out、both"), ErrInvalidConfig, c.SchemaDirection)
+	}
+
+	// 第十四步：验证pong超时检测参数
+	if c.PongTimeout < 0 {
+		return fmt.Errorf(tr("%w: pong超时不能为负数"), ErrInvalidConfig)
+	}
+	if c.PongTimeout > 0 && c.PongMisses < 1 {
+		return fmt.Errorf(tr("%w: 连续未收到pong的次数必须大于0"), ErrInvalidConfig)
+	}
+
+	// 第十五步：验证入站队列参数
+	if c.InboundQueueSize < 0 {
+		return fmt.Errorf(tr("%w: 入站队列容量不能为负数"), ErrInvalidConfig)
+	}
+	if c.MaxReceiveRate < 0 {
+		return fmt.Errorf(tr("%w: 接收速率上限不能为负数"), ErrInvalidConfig)
+	}
+	switch c.Backpressure {
+	case BackpressureBlock, BackpressureDropOldest, BackpressureDropNewest:
+	default:
+		return fmt.Errorf(tr("%w: 背压策略 '%s' 无效，可选 block、drop-oldest、drop-newest"), ErrInvalidConfig, c.Backpressure)
+	}
+
+	// 第十六步：验证内存和GC参数
+	if c.MaxMemory < 0 {
+		return fmt.Errorf(tr("%w: 内存上限不能为负数"), ErrInvalidConfig)
+	}
+	if c.GCPercent < -1 {
+		return fmt.Errorf(tr("%w: GOGC百分比必须为正数或-1（关闭）"), ErrInvalidConfig)
+	}
+	for _, size := range c.BufferTiers {
+		if size <= 0 || size > c.MaxMessageSize {
+			return fmt.Errorf(tr("%w: 内存池档位 %d 必须大于0且不超过最大消息大小 %d"), ErrInvalidConfig, size, c.MaxMessageSize)
+		}
+	}
+
+	// 第十七步：验证重定向跳数
+	if c.FollowRedirects && c.MaxRedirects < 1 {
+		return fmt.Errorf(tr("%w: 跟随重定向时最大跳数必须至少为1"), ErrInvalidConfig)
+	}
+	if c.AllowInsecureRedirect && !c.FollowRedirects {
+		return fmt.Errorf(tr("%w: --allow-insecure-redirect 需要与 --follow-redirects 一起使用"), ErrInvalidConfig)
+	}
+
+	// 第十八步：验证就绪判定参数
+	if c.ReadyMaxSilence < 0 {
+		return fmt.Errorf(tr("%w: 就绪静默时长不能为负数"), ErrInvalidConfig)
+	}
+
+	// 第十九步：验证消息显示过滤模式
+	if _, err := newMessageFilter(c.GrepPatterns, c.GrepExclude, c.GrepAll); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	// 第二十步：验证高亮规则
+	if _, err := parseHighlightRules(c.Highlight); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	// 第二十一步：验证指标常量标签
+	for name := range c.Labels {
+		if err := validateLabelName(name); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+
+	// 第二十二步：验证无效UTF-8处理策略
+	switch c.OnBadUTF8 {
+	case BadUTF8Warn, BadUTF8Replace, BadUTF8Close:
+	default:
+		return fmt.Errorf(tr("%w: 无效UTF-8处理策略 '%s' 无效，可选 warn、replace、close"), ErrInvalidConfig, c.OnBadUTF8)
+	}
+
+	// 第二十三步：验证Webhook地址和转发目标
+	if c.WebhookURL != "" {
+		if u, err := url.Parse(c.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf(tr("%w: Webhook地址 '%s' 必须是http://或https://地址"), ErrInvalidConfig, c.WebhookURL)
+		}
+	}
+	if c.WebhookSecret != "" && c.WebhookURL == "" {
+		return fmt.Errorf(tr("%w: --webhook-secret 需要与 --webhook-url 一起使用"), ErrInvalidConfig)
+	}
+	if c.Forward != "" {
+		if _, err := parseForwardURL(c.Forward); err != nil {
+			return fmt.Errorf(tr("%w: 无效的转发地址 '%s': %v"), ErrInvalidConfig, redactURL(c.Forward), err)
+		}
+	}
+
+	// 第二十四步：验证SLO目标
+	for _, target := range []float64{c.SLOAvailability, c.SLOMessageSuccess} {
+		if target < 0 || target >= 100 {
+			return fmt.Errorf(tr("%w: SLO百分比目标必须在0到100之间（不含100）"), ErrInvalidConfig)
+		}
+	}
+	if c.SLOMaxReconnects < 0 {
+		return fmt.Errorf(tr("%w: SLO每小时重连上限不能为负数"), ErrInvalidConfig)
+	}
+	if c.SLOWindow < MinSLOWindow {
+		return fmt.Errorf(tr("%w: SLO窗口不能小于 %v"), ErrInvalidConfig, MinSLOWindow)
+	}
+	if c.SLOBurnRate <= 0 {
+		return fmt.Errorf(tr("%w: SLO消耗速率阈值必须为正数"), ErrInvalidConfig)
+	}
+
+	// 第二十五步：验证序列号检测配置
+	if c.SeqResubscribe != "" {
+		if c.SeqPath == "" {
+			return fmt.Errorf(tr("%w: --seq-resubscribe 需要与 --seq-path 一起使用"), ErrInvalidConfig)
+		}
+		if _, err := template.New("seq-resubscribe").Parse(c.SeqResubscribe); err != nil {
+			return fmt.Errorf(tr("%w: 重新订阅消息模板无效: %v"), ErrInvalidConfig, err)
+		}
+	}
+
+	// 第二十六步：验证后台采样间隔
+	if c.SampleInterval < 0 {
+		return fmt.Errorf(tr("%w: 后台采样间隔不能为负数"), ErrInvalidConfig)
+	}
+
+	// 第二十七步：验证消息显示模板
+	if _, err := parseMessageFormat(c.MessageFormat); err != nil {
+		return fmt.Errorf(tr("%w: 消息显示模板无效: %v"), ErrInvalidConfig, err)
+	}
+
+	// 第二十八步：验证混沌测试配置（配置文件中的值不经过ParseChaosSpec）
+	if c.Chaos != nil {
+		if err := c.Chaos.Validate(); err != nil {
+			return fmt.Errorf(tr("%w: 混沌测试配置无效: %v"), ErrInvalidConfig, err)
+		}
+	}
+
+	// 第二十九步：验证分片连接配置
+	if err := c.validateShardConfig(); err != nil {
+		return err
+	}
+
+	// 第三十步：流式发送不经过出站中间件，不能与整条消息变换的加密和压缩同时使用
+	if c.SendFile != "" && (c.E2EKeyFile != "" || c.PayloadGzip) {
+		return fmt.Errorf(tr("%w: --send-file 不能与 --e2e-key-file 或 --payload-gzip 一起使用（流式发送不经过加密和压缩）"), ErrInvalidConfig)
+	}
+
 	// 所有验证通过
 	return nil
 }
 
+// validateShardConfig 验证分片连接配置的有效性
+//
+// 返回值：
+//   - error: --shard-param缺少--shard、分片取值为空或不是有效URL、用于connect以外的子命令，
+//     或与每条连接各自写入文件、监听端口或占用终端的选项同时使用时返回错误
+func (c *ClientConfig) validateShardConfig() error {
+	if len(c.Shards) == 0 {
+		if c.ShardParam != "" {
+			return fmt.Errorf(tr("%w: --shard-param 需要与 --shard 一起使用"), ErrInvalidConfig)
+		}
+		return nil
+	}
+	if c.Mode != "" {
+		return fmt.Errorf(tr("%w: --shard 只能用于 connect 子命令"), ErrInvalidConfig)
+	}
+	for _, shard := range c.Shards {
+		if shard == "" {
+			return fmt.Errorf(tr("%w: 分片取值不能为空"), ErrInvalidConfig)
+		}
+		if c.ShardParam == "" && !isValidWebSocketURL(shard) {
+			return fmt.Errorf(tr("%w: 未指定 --shard-param 时分片 '%s' 必须是 ws:// 或 wss:// 地址"), ErrInvalidConfig, redactURL(shard))
+		}
+	}
+
+	// 这些选项由单个连接独占，多条连接同时使用会互相覆盖
+	for _, exclusive := range []struct {
+		flag string
+		set  bool
+	}{
+		{"--tui", c.TUI},
+		{"--send-file", c.SendFile != ""},
+		{"--tail", c.Tail != ""},
+		{"--transcript", c.Transcript != ""},
+		{"--capture-db", c.CaptureDB != ""},
+		{"--summary-json", c.SummaryJSON != ""},
+		{"--state-file", c.StateFile != ""},
+		{"--journal", c.Journal != ""},
+		{"--admin-port", c.AdminPort > 0},
+	} {
+		if exclusive.set {
+			return fmt.Errorf(tr("%w: %s 不能与 --shard 一起使用"), ErrInvalidConfig, exclusive.flag)
+		}
+	}
+	return nil
+}
+
 // isValidWebSocketURL 检查URL是否为有效的WebSocket URL
 // 这个函数用于验证用户输入的URL是否符合WebSocket协议规范
 //
@@ -963,7 +1761,7 @@ func isValidWebSocketURL(url string) bool {
 func validateLogPath(logPath string) (string, error) {
 	// 第一步：检查输入是否为空
 	if logPath == "" {
-		return "", fmt.Errorf("日志路径不能为空")
+		return "", errors.New(tr("日志路径不能为空"))
 	}
 
 	// 第二步：清理路径，移除 . 和 .. 等相对路径元素
@@ -973,41 +1771,76 @@ func validateLogPath(logPath string) (string, error) {
 	// 第三步：获取绝对路径，便于后续安全检查
 	absPath, err := filepath.Abs(cleanPath)
 	if err != nil {
-		return "", fmt.Errorf("无法获取绝对路径: %w", err)
+		return "", fmt.Errorf(tr("无法获取绝对路径: %w"), err)
 	}
 
 	// 第四步：获取当前工作目录，作为安全边界
 	workDir, err := os.Getwd()
 	if err != nil {
-		return "", fmt.Errorf("无法获取当前工作目录: %w", err)
+		return "", fmt.Errorf(tr("无法获取当前工作目录: %w"), err)
 	}
 
 	// 第五步：计算相对路径，检查是否在安全范围内
 	relPath, err := filepath.Rel(workDir, absPath)
 	if err != nil {
-		return "", fmt.Errorf("无法计算相对路径: %w", err)
+		return "", fmt.Errorf(tr("无法计算相对路径: %w"), err)
 	}
 
 	// 第六步：检查是否试图访问父目录（路径遍历攻击检测）
 	if strings.HasPrefix(relPath, "..") {
-		return "", fmt.Errorf("不允许访问父目录: %s", relPath)
+		return "", fmt.Errorf(tr("不允许访问父目录: %s"), relPath)
 	}
 
 	// 第七步：确保文件扩展名是.log（防止创建其他类型的文件）
 	if !strings.HasSuffix(strings.ToLower(absPath), ".log") {
-		return "", fmt.Errorf("日志文件必须以.log结尾: %s", absPath)
+		return "", fmt.Errorf(tr("日志文件必须以.log结尾: %s"), absPath)
 	}
 
 	// 第八步：检查文件名长度（防止过长的文件名导致系统问题）
 	fileName := filepath.Base(absPath)
 	if len(fileName) > 255 {
-		return "", fmt.Errorf("文件名过长: %s", fileName)
+		return "", fmt.Errorf(tr("文件名过长: %s"), fileName)
 	}
 
 	// 所有检查通过，返回安全的路径
 	return absPath, nil
 }
 
+// validateWorkDirPath 验证路径位于当前工作目录内
+// 这个函数复用日志路径的目录边界检查，用于日志以外的输出文件和目录
+//
+// 参数说明：
+//   - path: 用户指定的文件或目录路径
+//
+// 返回值：
+//   - string: 清理后的绝对路径
+//   - error: 路径为空、无法解析或超出当前工作目录时返回错误
+func validateWorkDirPath(path string) (string, error) {
+	if path == "" {
+		return "", errors.New(tr("路径不能为空"))
+	}
+
+	absPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf(tr("无法获取绝对路径: %w"), err)
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf(tr("无法获取当前工作目录: %w"), err)
+	}
+
+	relPath, err := filepath.Rel(workDir, absPath)
+	if err != nil {
+		return "", fmt.Errorf(tr("无法计算相对路径: %w"), err)
+	}
+	if strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf(tr("不允许访问父目录: %s"), relPath)
+	}
+
+	return absPath, nil
+}
+
 // createLogFileSafely 安全地创建日志文件，避免gosec G304警告
 // 这个函数是文件安全操作的第二层防护，在路径验证后进行文件创建
 //
@@ -1035,12 +1868,12 @@ func (c *WebSocketClient) createLogFileSafely(safePath string) (*os.File, error)
 
 	// 第一层安全检查：再次验证文件扩展名
 	if !strings.HasSuffix(safePath, ".log") {
-		return nil, fmt.Errorf("不安全的文件扩展名")
+		return nil, errors.New(tr("不安全的文件扩展名"))
 	}
 
 	// 第二层安全检查：检查路径是否包含危险字符
 	if strings.Contains(safePath, "..") {
-		return nil, fmt.Errorf("路径包含危险字符")
+		return nil, errors.New(tr("路径包含危险字符"))
 	}
 
 	// 使用更安全的文件创建方法，避免直接使用变量路径
@@ -1071,24 +1904,24 @@ func (c *WebSocketClient) openLogFileWithValidation(validatedPath string, flags
 
 	// 第二步：确保路径是绝对路径（安全要求）
 	if !filepath.IsAbs(cleanPath) {
-		return nil, fmt.Errorf("路径必须是绝对路径")
+		return nil, errors.New(tr("路径必须是绝对路径"))
 	}
 
 	// 第三步：获取当前工作目录作为安全边界
 	workDir, err := os.Getwd()
 	if err != nil {
-		return nil, fmt.Errorf("无法获取工作目录: %w", err)
+		return nil, fmt.Errorf(tr("无法获取工作目录: %w"), err)
 	}
 
 	// 第四步：最终的相对路径安全检查
 	relPath, err := filepath.Rel(workDir, cleanPath)
 	if err != nil {
-		return nil, fmt.Errorf("无法计算相对路径: %w", err)
+		return nil, fmt.Errorf(tr("无法计算相对路径: %w"), err)
 	}
 
 	// 第五步：确保不会访问父目录（最后的安全检查）
 	if strings.HasPrefix(relPath, "..") {
-		return nil, fmt.Errorf("路径超出安全范围: %s", relPath)
+		return nil, fmt.Errorf(tr("路径超出安全范围: %s"), relPath)
 	}
 
 	// 第六步：使用安全的文件操作
@@ -1137,11 +1970,11 @@ func (s ConnectionState) String() string {
 
 	// 边界检查，防止数组越界
 	if int(s) < len(states) {
-		return states[s]
+		return tr(states[s])
 	}
 
 	// 如果状态值超出预期范围，返回未知状态
-	return "未知状态"
+	return tr("未知状态")
 }
 
 // ErrorStats 错误统计信息结构体
@@ -1217,16 +2050,32 @@ type PrometheusMetrics struct {
 	// 这些指标帮助监控系统的错误情况
 	ErrorsTotal       int64               // 错误总数：发生的错误总次数（累计计数器）
 	ErrorsByCodeTotal map[ErrorCode]int64 // 按错误码分类的错误数：每种错误类型的发生次数（累计计数器）
+	ServerClosesTotal map[int]int64       // 按关闭码分类的服务器关闭次数：服务器发送关闭帧的次数（累计计数器）
+	PongTimeoutsTotal int64               // pong超时总数：发送ping后在时限内未收到pong的次数（累计计数器）
+
+	// ===== Retry-After指标 =====
+	// 握手被429/503拒绝并按Retry-After延长重试等待的情况
+	RetryAfterWaitsTotal  int64   // Retry-After等待次数：重试等待被服务器的Retry-After延长的次数（累计计数器）
+	RetryAfterWaitSeconds float64 // Retry-After等待总时长：按Retry-After等待的累计秒数（累计计数器）
 
 	// ===== 性能指标 =====
 	// 这些指标帮助监控系统的性能表现
-	MessageLatencyMs    int64 // 消息延迟：消息从发送到接收确认的时间，单位毫秒（瞬时值）
-	ConnectionLatencyMs int64 // 连接延迟：建立WebSocket连接所需的时间，单位毫秒（瞬时值）
+	MessageLatencyMs int64 // 消息延迟：消息从发送到接收确认的时间，单位毫秒（瞬时值）
+
+	// ===== 连接阶段耗时指标 =====
+	// 这些指标来自最近一次成功握手的httptrace追踪结果
+	DNSLookupMs      int64 // DNS解析耗时：主机名解析所需时间，单位毫秒（瞬时值）
+	TCPConnectMs     int64 // TCP连接耗时：建立TCP连接所需时间，单位毫秒（瞬时值）
+	TLSHandshakeMs   int64 // TLS握手耗时：wss://连接的TLS握手时间，单位毫秒（瞬时值）
+	FirstByteMs      int64 // 首字节耗时：发送升级请求到收到首个响应字节的时间，单位毫秒（瞬时值）
+	HandshakeTotalMs int64 // 握手总耗时：从开始拨号到收到升级响应的总时间，单位毫秒（瞬时值）
 
 	// ===== 系统指标 =====
 	// 这些指标帮助监控系统资源的使用情况
-	GoroutinesActive int64 // 活跃goroutine数：当前正在运行的goroutine数量（瞬时值）
-	MemoryUsageBytes int64 // 内存使用量：当前程序占用的内存大小，单位字节（瞬时值）
+	GoroutinesActive    int64 // 活跃goroutine数：当前正在运行的goroutine数量（瞬时值）
+	MemoryUsageBytes    int64 // 内存使用量：当前程序占用的内存大小，单位字节（瞬时值）
+	MemoryLimitBytes    int64 // 软内存上限：--max-memory设置的值，0表示不限制（瞬时值）
+	MemorySheddingTotal int64 // 内存压力次数：接近内存上限而释放缓存的次数（累计计数器）
 }
 
 // ===== 性能优化组件 =====
@@ -1252,10 +2101,12 @@ type PrometheusMetrics struct {
 //	使用读写锁（sync.RWMutex）确保并发访问的安全性
 //	读操作（如GetActiveCount）使用读锁，写操作使用写锁
 type GoroutineTracker struct {
-	mu       sync.RWMutex         // 读写锁：保护并发访问，读多写少的场景下性能更好
-	active   map[string]time.Time // 活跃的goroutine映射：key是goroutine的唯一标识，value是启动时间
-	maxAge   time.Duration        // 最大存活时间：超过这个时间的goroutine被认为可能泄漏
-	maxCount int                  // 最大goroutine数量：超过这个数量时触发告警
+	mu        sync.RWMutex         // 读写锁：保护并发访问，读多写少的场景下性能更好
+	active    map[string]time.Time // 活跃的goroutine映射：key是goroutine的唯一标识，value是启动时间
+	longLived map[string]string    // 长期运行的goroutine：key是唯一标识，value是名称；不做存活时间检查
+	seq       uint64               // 长期运行goroutine的实例序号，用于生成唯一标识
+	maxAge    time.Duration        // 最大存活时间：超过这个时间的goroutine被认为可能泄漏
+	maxCount  int                  // 最大goroutine数量：超过这个数量时触发告警
 }
 
 // NewGoroutineTracker 创建新的goroutine跟踪器
@@ -1273,9 +2124,10 @@ type GoroutineTracker struct {
 //   - 使用合理的初始容量避免内存浪费
 func NewGoroutineTracker(maxAge time.Duration, maxCount int) *GoroutineTracker {
 	return &GoroutineTracker{
-		active:   make(map[string]time.Time, maxCount), // 预分配容量，避免频繁的map扩容
-		maxAge:   maxAge,
-		maxCount: maxCount,
+		active:    make(map[string]time.Time, maxCount), // 预分配容量，避免频繁的map扩容
+		longLived: make(map[string]string),
+		maxAge:    maxAge,
+		maxCount:  maxCount,
 	}
 }
 
@@ -1301,7 +2153,31 @@ func (gt *GoroutineTracker) Track(id string) {
 	gt.active[id] = time.Now() // 记录goroutine启动时间
 }
 
-// Untrack 停止跟踪goroutine
+// TrackLongLived 跟踪一个预期长期运行的goroutine（如消息读取循环、周期性ping）
+// 这类goroutine的运行时间本来就会超过maxAge，因此不做存活时间检查，也不会被Cleanup清理；
+// 改为检查同名实例是否同时运行多个：旧实例没有退出说明它已经泄漏
+//
+// 参数说明：
+//   - name: goroutine的名称，同一种goroutine使用相同的名称
+//
+// 返回值：
+//   - string: 本实例的唯一标识（名称#序号），退出时传给Untrack
+//
+// 使用示例：
+//
+//	id := tracker.TrackLongLived("read-messages")
+//	defer tracker.Untrack(id)
+func (gt *GoroutineTracker) TrackLongLived(name string) string {
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+	gt.seq++
+	id := fmt.Sprintf("%s#%d", name, gt.seq)
+	gt.active[id] = time.Now()
+	gt.longLived[id] = name
+	return id
+}
+
+// Untrack 停止跟踪goroutine
 // 当goroutine正常结束时调用此方法，从跟踪列表中移除
 // 应该在goroutine的defer语句中调用，确保无论如何都会被执行
 //
@@ -1317,6 +2193,7 @@ func (gt *GoroutineTracker) Untrack(id string) {
 	gt.mu.Lock()
 	defer gt.mu.Unlock()
 	delete(gt.active, id) // 从活跃列表中移除
+	delete(gt.longLived, id)
 }
 
 // GetActiveCount 获取活跃goroutine数量
@@ -1364,14 +2241,27 @@ func (gt *GoroutineTracker) CheckLeaks() []string {
 	var leaks []string
 	now := time.Now()
 
-	// 检查运行时间过长的goroutine
+	// 检查运行时间过长的goroutine（长期运行的goroutine除外）
+	instances := make(map[string]int)
 	for id, startTime := range gt.active {
+		if name, ok := gt.longLived[id]; ok {
+			instances[name]++
+			continue
+		}
 		runTime := now.Sub(startTime)
 		if runTime > gt.maxAge {
 			leaks = append(leaks, fmt.Sprintf("goroutine %s 运行时间过长: %v", id, runTime))
 		}
 	}
 
+	// 检查长期运行的goroutine是否有旧实例未退出
+	for name, count := range instances {
+		if count > 1 {
+			leaks = append(leaks, fmt.Sprintf("goroutine %s 有 %d 个实例同时运行", name, count))
+		}
+	}
+	slices.Sort(leaks)
+
 	// 检查goroutine数量是否超过限制
 	if len(gt.active) > gt.maxCount {
 		leaks = append(leaks, fmt.Sprintf("goroutine数量过多: %d > %d", len(gt.active), gt.maxCount))
@@ -1407,8 +2297,11 @@ func (gt *GoroutineTracker) Cleanup() {
 	now := time.Now()
 	cleanupThreshold := gt.maxAge * 2 // 使用2倍maxAge作为清理阈值
 
-	// 遍历所有记录，清理过期的条目
+	// 遍历所有记录，清理过期的条目（长期运行的goroutine退出时自行取消跟踪）
 	for id, startTime := range gt.active {
+		if _, ok := gt.longLived[id]; ok {
+			continue
+		}
 		if now.Sub(startTime) > cleanupThreshold {
 			delete(gt.active, id) // 删除过期记录
 		}
@@ -1417,12 +2310,12 @@ func (gt *GoroutineTracker) Cleanup() {
 
 // BufferPool 内存池管理器
 // 这个结构体实现了高性能的分级内存池，用于减少频繁的内存分配和垃圾回收
-// 采用三级缓冲区设计，根据请求的大小自动选择最合适的缓冲区池
+// 默认采用三级缓冲区设计，根据请求的大小自动选择最合适的缓冲区池，可以通过AddTier增加自定义档位
 //
 // 设计原理：
-//   - 分级管理：小、中、大三种规格的缓冲区，覆盖不同的使用场景
+//   - 分级管理：小、中、大三种规格的缓冲区，覆盖不同的使用场景；调大MaxMessageSize时可增加更大的档位
 //   - 对象复用：通过sync.Pool实现高效的对象复用
-//   - 统计监控：记录分配、复用、释放次数，便于性能分析
+//   - 统计监控：记录分配、复用、释放次数以及各档位的命中率和占用情况，便于性能分析
 //   - 零分配：在热路径上避免不必要的内存分配
 //
 // 性能优势：
@@ -1431,61 +2324,106 @@ func (gt *GoroutineTracker) Cleanup() {
 //   - 内存局部性：预分配的缓冲区有更好的内存局部性
 //   - 统计可观测：提供详细的使用统计信息
 type BufferPool struct {
-	smallPool  sync.Pool // 小缓冲区池（1KB）：用于短消息和控制信息
-	mediumPool sync.Pool // 中等缓冲区池（4KB）：用于普通消息
-	largePool  sync.Pool // 大缓冲区池（16KB）：用于大消息和批量数据
+	tiers   atomic.Pointer[[]*bufferPoolTier] // 按大小升序排列的档位：AddTier时复制后整体替换，Get和Put无需加锁
+	tiersMu sync.Mutex                        // 保护AddTier的复制替换过程
 
 	// 统计信息（使用原子操作确保并发安全）
 	allocCount   int64 // 分配次数：记录总的内存分配次数
 	reuseCount   int64 // 复用次数：记录从池中获取对象的次数
 	releaseCount int64 // 释放次数：记录归还到池中的次数
+	trimCount    int64 // 清空次数：内存压力下丢弃池中空闲缓冲区的次数
+
+	shedding int32 // 内存压力标志：为1时归还的缓冲区直接丢弃，池中已有缓冲区随GC释放（原子操作）
+}
+
+// bufferPoolTier 一个档位的缓冲区池及其统计
+type bufferPoolTier struct {
+	size int                       // 缓冲区大小（字节）
+	pool atomic.Pointer[sync.Pool] // 当前的池：Trim时替换为新池，旧池中的缓冲区随GC释放
+
+	gets     int64 // Get次数
+	misses   int64 // 池为空、需要新分配的次数
+	returned int64 // 归还次数（包括内存压力下丢弃的）
+	idle     int64 // 池中空闲缓冲区数的估计：归还时加一，命中时减一，Trim时清零；GC会释放池中的缓冲区，因此是上限
+}
+
+// newBufferPoolTier 创建指定大小的档位
+func newBufferPoolTier(size int) *bufferPoolTier {
+	t := &bufferPoolTier{size: size}
+	t.pool.Store(new(sync.Pool))
+	return t
+}
+
+// BufferTierStats 一个缓冲区档位的统计
+type BufferTierStats struct {
+	Size   int   // 缓冲区大小（字节）
+	Gets   int64 // Get次数
+	Misses int64 // 池为空、需要新分配的次数
+	InUse  int64 // 借出尚未归还的缓冲区数（估计值：借出后不再归还的缓冲区也计入）
+	Idle   int64 // 池中空闲缓冲区数（上限估计）
+}
+
+// ReuseRatio 返回该档位的复用率：命中次数占Get次数的比例，没有Get时返回0
+func (s BufferTierStats) ReuseRatio() float64 {
+	if s.Gets == 0 {
+		return 0
+	}
+	return float64(s.Gets-s.Misses) / float64(s.Gets)
 }
 
 // NewBufferPool 创建新的缓冲区池
-// 这是BufferPool的构造函数，初始化三个不同大小的缓冲区池
+// 这是BufferPool的构造函数，初始化小（1KB）、中（4KB）、大（16KB）三个档位
 //
 // 返回值：
 //   - *BufferPool: 完全初始化的缓冲区池实例
 //
 // 初始化策略：
-//   - 每个池都设置了New函数，当池为空时自动创建新对象
+//   - 池为空时Get直接分配新的缓冲区并记录为未命中
 //   - 使用原子操作记录分配统计，确保并发安全
 //   - 预定义的缓冲区大小经过性能测试优化
 //
 // 性能特点：
 //   - 延迟初始化：只有在需要时才创建缓冲区
 //   - 统计集成：自动记录分配次数，便于监控
-//   - 现代语法：使用Go 1.18+的any类型
 func NewBufferPool() *BufferPool {
 	bp := &BufferPool{}
-
-	// 初始化小缓冲区池（1KB）- 适用于控制消息和短文本
-	// 设置小缓冲区池的工厂函数：当池为空时自动创建新的1KB缓冲区
-	bp.smallPool.New = func() any {
-		atomic.AddInt64(&bp.allocCount, 1)   // 原子递增分配计数，用于统计总分配次数
-		return make([]byte, SmallBufferSize) // 创建1KB的字节切片
+	tiers := []*bufferPoolTier{
+		newBufferPoolTier(SmallBufferSize),  // 小缓冲区（1KB）- 适用于控制消息和短文本
+		newBufferPoolTier(MediumBufferSize), // 中等缓冲区（4KB）- 适用于普通消息
+		newBufferPoolTier(LargeBufferSize),  // 大缓冲区（16KB）- 适用于大消息和批量数据
 	}
+	bp.tiers.Store(&tiers)
+	return bp
+}
 
-	// 初始化中等缓冲区池（4KB）- 适用于普通消息
-	// 设置中等缓冲区池的工厂函数：当池为空时自动创建新的4KB缓冲区
-	bp.mediumPool.New = func() any {
-		atomic.AddInt64(&bp.allocCount, 1)    // 原子递增分配计数，用于统计总分配次数
-		return make([]byte, MediumBufferSize) // 创建4KB的字节切片
-	}
+// AddTier 增加一个自定义大小的档位
+// 例如把MaxMessageSize调大到64KB后增加64KB档位，让大消息也能复用缓冲区
+//
+// 参数说明：
+//   - size: 缓冲区大小（字节），必须大于0
+//
+// 返回值：
+//   - bool: 是否新增了档位；该大小的档位已存在时返回false
+//
+// 并发安全：可以在使用中调用，Get和Put在下一次调用时看到新的档位
+func (bp *BufferPool) AddTier(size int) bool {
+	bp.tiersMu.Lock()
+	defer bp.tiersMu.Unlock()
 
-	// 初始化大缓冲区池（16KB）- 适用于大消息和批量数据
-	// 设置大缓冲区池的工厂函数：当池为空时自动创建新的16KB缓冲区
-	bp.largePool.New = func() any {
-		atomic.AddInt64(&bp.allocCount, 1)   // 原子递增分配计数，用于统计总分配次数
-		return make([]byte, LargeBufferSize) // 创建16KB的字节切片
+	current := *bp.tiers.Load()
+	index, found := slices.BinarySearchFunc(current, size, func(t *bufferPoolTier, size int) int {
+		return cmp.Compare(t.size, size)
+	})
+	if found {
+		return false
 	}
-
-	return bp
+	tiers := slices.Insert(slices.Clone(current), index, newBufferPoolTier(size))
+	bp.tiers.Store(&tiers)
+	return true
 }
 
 // Get 获取指定大小的缓冲区（极致优化版本）
 // 这个方法根据请求的大小自动选择最合适的缓冲区池
-// 采用快速路径设计，最小化分支预测失败和类型断言开销
 //
 // 参数说明：
 //   - size: 需要的缓冲区大小（字节）
@@ -1494,36 +2432,34 @@ func NewBufferPool() *BufferPool {
 //   - []byte: 至少包含size字节的缓冲区，长度为size
 //
 // 选择策略：
-//   - size <= 1KB: 使用小缓冲区池
-//   - size <= 4KB: 使用中等缓冲区池
-//   - size <= 16KB: 使用大缓冲区池
-//   - size > 16KB: 直接分配，不使用池
+//   - 使用能容纳size的最小档位（默认1KB、4KB、16KB）
+//   - 超过最大档位：直接分配，不使用池
 //
 // 性能优化：
-//   - 快速路径：避免重复的类型断言和条件检查
+//   - 档位很少，顺序查找比二分查找更快
 //   - 切片优化：返回精确长度的切片，避免越界访问
 //   - 统计集成：原子操作记录复用次数
 //   - 内存效率：超大请求直接分配，避免池膨胀
 func (bp *BufferPool) Get(size int) []byte {
-	// 快速路径：使用switch语句比多个if更高效
-	switch {
-	case size <= SmallBufferSize:
-		buf := bp.smallPool.Get().([]byte) // 从小缓冲区池获取
-		atomic.AddInt64(&bp.reuseCount, 1) // 原子递增复用计数
-		return buf[:size]                  // 返回精确长度的切片
-	case size <= MediumBufferSize:
-		buf := bp.mediumPool.Get().([]byte) // 从中等缓冲区池获取
-		atomic.AddInt64(&bp.reuseCount, 1)  // 原子递增复用计数
-		return buf[:size]                   // 返回精确长度的切片
-	case size <= LargeBufferSize:
-		buf := bp.largePool.Get().([]byte) // 从大缓冲区池获取
+	for _, t := range *bp.tiers.Load() {
+		if size > t.size {
+			continue
+		}
+		atomic.AddInt64(&t.gets, 1)
 		atomic.AddInt64(&bp.reuseCount, 1) // 原子递增复用计数
-		return buf[:size]                  // 返回精确长度的切片
-	default:
-		// 超大缓冲区直接分配，避免池的开销和内存浪费
-		atomic.AddInt64(&bp.allocCount, 1) // 原子递增分配计数
-		return make([]byte, size)          // 直接分配精确大小
+		if buf, ok := t.pool.Load().Get().([]byte); ok {
+			atomic.AddInt64(&t.idle, -1)
+			return buf[:size] // 返回精确长度的切片
+		}
+		// 池为空时分配新的缓冲区
+		atomic.AddInt64(&t.misses, 1)
+		atomic.AddInt64(&bp.allocCount, 1)
+		return make([]byte, size, t.size)
 	}
+
+	// 超大缓冲区直接分配，避免池的开销和内存浪费
+	atomic.AddInt64(&bp.allocCount, 1) // 原子递增分配计数
+	return make([]byte, size)          // 直接分配精确大小
 }
 
 // Put 归还缓冲区到池中（极致优化版本）
@@ -1535,15 +2471,9 @@ func (bp *BufferPool) Get(size int) []byte {
 //
 // 归还策略：
 //   - 根据缓冲区的容量（cap）而不是长度（len）进行匹配
-//   - 只有标准大小的缓冲区才会被放回池中
+//   - 只有容量等于某个档位大小的缓冲区才会被放回池中
 //   - 非标准大小的缓冲区直接丢弃，由GC回收
 //
-// 性能优化：
-//   - 快速检查：使用len检查比nil检查更快
-//   - 容量匹配：直接使用cap避免重复计算
-//   - 三索引切片：防止内存泄漏和意外的容量扩展
-//   - 统计集成：原子操作记录释放次数
-//
 // 内存安全：
 //   - 使用三索引切片语法重置缓冲区，防止内存泄漏
 //   - 确保归还的缓冲区具有正确的长度和容量
@@ -1556,22 +2486,56 @@ func (bp *BufferPool) Put(buf []byte) {
 	// 原子递增释放计数
 	atomic.AddInt64(&bp.releaseCount, 1)
 
-	// 根据容量匹配对应的池，使用容量而不是长度确保正确分类
-	switch cap(buf) {
-	case SmallBufferSize:
-		// 使用三索引切片重置缓冲区，防止内存泄漏
-		bp.smallPool.Put(buf[:SmallBufferSize:SmallBufferSize])
-	case MediumBufferSize:
-		// 使用三索引切片重置缓冲区，防止内存泄漏
-		bp.mediumPool.Put(buf[:MediumBufferSize:MediumBufferSize])
-	case LargeBufferSize:
+	for _, t := range *bp.tiers.Load() {
+		if cap(buf) != t.size {
+			continue
+		}
+		atomic.AddInt64(&t.returned, 1)
+		// 内存压力下不再保留缓冲区，交给GC回收
+		if atomic.LoadInt32(&bp.shedding) == 1 {
+			return
+		}
 		// 使用三索引切片重置缓冲区，防止内存泄漏
-		bp.largePool.Put(buf[:LargeBufferSize:LargeBufferSize])
+		t.pool.Load().Put(buf[:t.size:t.size])
+		atomic.AddInt64(&t.idle, 1)
+		return
 	}
 	// 非标准大小的缓冲区直接丢弃，让GC处理
 	// 这避免了池中存储不合适大小的缓冲区，保持池的效率
 }
 
+// SetShedding 设置内存压力状态
+// 启用后Put不再把缓冲区放回池中，池中现有的缓冲区在后续GC中释放；关闭后恢复正常复用
+func (bp *BufferPool) SetShedding(shedding bool) {
+	var v int32
+	if shedding {
+		v = 1
+	}
+	atomic.StoreInt32(&bp.shedding, v)
+}
+
+// IsShedding 返回是否处于内存压力状态
+func (bp *BufferPool) IsShedding() bool {
+	return atomic.LoadInt32(&bp.shedding) == 1
+}
+
+// Trim 丢弃所有档位池中的空闲缓冲区
+// sync.Pool中的缓冲区要经过两次GC才会释放，内存压力下直接替换为新池，旧池中的缓冲区在下一次GC时即可回收
+//
+// 返回值：
+//   - int64: 丢弃的空闲缓冲区估计字节数
+//
+// 并发安全：可以在使用中调用，正在借出的缓冲区归还到新池
+func (bp *BufferPool) Trim() int64 {
+	var dropped int64
+	for _, t := range *bp.tiers.Load() {
+		t.pool.Store(new(sync.Pool))
+		dropped += max(atomic.SwapInt64(&t.idle, 0), 0) * int64(t.size)
+	}
+	atomic.AddInt64(&bp.trimCount, 1)
+	return dropped
+}
+
 // GetStats 获取内存池统计信息
 // 这个方法返回内存池的详细使用统计，用于性能分析和监控
 //
@@ -1597,6 +2561,30 @@ func (bp *BufferPool) GetStats() (alloc, reuse, release int64) {
 		atomic.LoadInt64(&bp.releaseCount) // 原子读取释放计数
 }
 
+// TierStats 获取各档位的统计，按档位大小升序排列
+// 未命中次数占Get次数的比例越高，说明该档位的池中越少有可复用的缓冲区
+//
+// 并发安全：使用原子操作读取
+func (bp *BufferPool) TierStats() []BufferTierStats {
+	tiers := *bp.tiers.Load()
+	stats := make([]BufferTierStats, len(tiers))
+	for i, t := range tiers {
+		stats[i] = BufferTierStats{
+			Size:   t.size,
+			Gets:   atomic.LoadInt64(&t.gets),
+			Misses: atomic.LoadInt64(&t.misses),
+			InUse:  max(atomic.LoadInt64(&t.gets)-atomic.LoadInt64(&t.returned), 0),
+			Idle:   max(atomic.LoadInt64(&t.idle), 0),
+		}
+	}
+	return stats
+}
+
+// TrimCount 返回内存压力下清空池的次数
+func (bp *BufferPool) TrimCount() int64 {
+	return atomic.LoadInt64(&bp.trimCount)
+}
+
 // globalBufferPool 全局缓冲区池实例
 // 这是一个全局共享的缓冲区池，供整个程序使用
 // 使用全局实例可以最大化缓冲区的复用效率
@@ -1837,7 +2825,7 @@ type FastStringBuilder struct {
 //   - 避免频繁的缓冲区扩容
 func NewFastStringBuilder(initialSize int) *FastStringBuilder {
 	return &FastStringBuilder{
-		buf: globalBufferPool.Get(initialSize), // 从内存池获取缓冲区
+		buf: globalBufferPool.Get(initialSize)[:0], // 从内存池获取缓冲区（长度置0，只借用容量）
 	}
 }
 
@@ -2060,7 +3048,8 @@ func (fsb *FastStringBuilder) Release() {
 //   - 资源管理：正确处理连接资源的创建和释放
 //   - 并发安全：可以在多个goroutine中安全使用
 type DefaultConnector struct {
-	dialer *websocket.Dialer // WebSocket拨号器，负责建立连接
+	dialer   *websocket.Dialer // WebSocket拨号器，负责建立连接
+	dnsCache *dnsCache         // DNS解析缓存，跨重连保留（仅在配置了--dns-cache-ttl时生效）
 }
 
 // NewDefaultConnector 创建默认连接器
@@ -2070,7 +3059,7 @@ type DefaultConnector struct {
 //   - *DefaultConnector: 配置好的连接器实例
 //
 // 默认配置：
-//   - 握手超时：15秒，足够处理大多数网络延迟
+//   - 握手超时：15秒，足够处理大多数网络延迟（TCP连接超时在拨号函数中单独设置）
 //   - 读缓冲区：4KB，平衡内存使用和性能
 //   - 写缓冲区：4KB，适合大多数消息大小
 //
@@ -2085,6 +3074,7 @@ func NewDefaultConnector() *DefaultConnector {
 			ReadBufferSize:   DefaultReadBufferSize,  // 4KB读缓冲区
 			WriteBufferSize:  DefaultWriteBufferSize, // 4KB写缓冲区
 		},
+		dnsCache: newDNSCache(),
 	}
 }
 
@@ -2114,6 +3104,38 @@ func NewDefaultConnector() *DefaultConnector {
 //
 // 并发安全：可以在多个goroutine中同时调用
 func (dc *DefaultConnector) Connect(ctx context.Context, url string, config *ClientConfig) (*websocket.Conn, error) {
+	conn, resp, err := dc.dial(ctx, url, config)
+	if err != nil {
+		// 处理连接错误
+		if resp != nil {
+			// 读取HTTP响应体以获取详细错误信息
+			body, _ := io.ReadAll(resp.Body)
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭响应体失败: %v"), closeErr)
+			}
+			// 返回包含HTTP状态和响应体的详细错误，429/503时附带Retry-After
+			rejected := &HandshakeRejectedError{
+				Status:     resp.Status,
+				StatusCode: resp.StatusCode,
+				Body:       string(body),
+				Err:        err,
+			}
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+				rejected.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			}
+			return nil, rejected
+		}
+		// 返回基本的连接错误
+		return nil, fmt.Errorf(tr("连接失败: %w"), err)
+	}
+
+	// 连接成功，返回WebSocket连接
+	return conn, nil
+}
+
+// dial 按配置设置拨号器并执行WebSocket握手，同时返回握手响应
+// 供Connect和连接预检共用；握手失败且服务器有HTTP响应时resp非nil，由调用方关闭响应体
+func (dc *DefaultConnector) dial(ctx context.Context, url string, config *ClientConfig) (*websocket.Conn, *http.Response, error) {
 	// 第一步：设置TLS配置（用于wss://连接）
 	if config.TLSConfig != nil {
 		tlsConfig := config.TLSConfig.GetTLSConfig()
@@ -2130,5999 +3152,21990 @@ func (dc *DefaultConnector) Connect(ctx context.Context, url string, config *Cli
 	dc.dialer.HandshakeTimeout = config.HandshakeTimeout // 握手超时设置
 	dc.dialer.ReadBufferSize = config.ReadBufferSize     // 读缓冲区大小
 	dc.dialer.WriteBufferSize = config.WriteBufferSize   // 写缓冲区大小
+	dc.dialer.NetDialContext = newSimulatedDialContext(config, newResolvingDialContext(config, dc.dnsCache))
+	dc.dialer.NetDialTLSContext = nil
+	if config.TraceFrames || config.Strict {
+		dc.dialer.NetDialContext, dc.dialer.NetDialTLSContext = newFrameTracingDialers(config, dc.dialer.NetDialContext, dc.dialer.TLSClientConfig)
+	}
 
 	// 第三步：创建带超时的连接上下文
 	connectCtx, cancel := context.WithTimeout(ctx, config.HandshakeTimeout)
 	defer cancel() // 确保上下文被正确取消
 
-	// 第四步：执行WebSocket握手
-	conn, resp, err := dc.dialer.DialContext(connectCtx, url, nil)
-	if err != nil {
-		// 第五步：处理连接错误
-		if resp != nil {
-			// 读取HTTP响应体以获取详细错误信息
-			body, _ := io.ReadAll(resp.Body)
-			if closeErr := resp.Body.Close(); closeErr != nil {
-				log.Printf("⚠️ 关闭响应体失败: %v", closeErr)
+	// 第四步：执行WebSocket握手，按配置跟随重定向（重定向时沿用首个地址推导的Origin，与浏览器行为一致）
+	header := handshakeHeader(config, url)
+	chain := []string{url}
+	for {
+		conn, resp, err := dc.dialer.DialContext(connectCtx, url, header)
+		if err != nil && !errors.Is(err, ErrDialTimeout) && ctx.Err() == nil && errors.Is(connectCtx.Err(), context.DeadlineExceeded) {
+			// TCP连接已建立，超时发生在TLS握手或HTTP升级阶段
+			err = fmt.Errorf("%w (%v): %w", ErrHandshakeTimeout, config.HandshakeTimeout, err)
+		}
+
+		// 按需输出握手请求和响应（握手失败但服务器已响应时同样输出）
+		if config.DumpHandshake && resp != nil {
+			dumpHandshake(resp)
+		}
+
+		if !config.FollowRedirects || !isHandshakeRedirect(resp) {
+			if err == nil && len(chain) > 1 {
+				log.Printf(tr("🔀 重定向链: %s"), strings.Join(chain, " -> "))
+			}
+			if observe := handshakeObserverFrom(ctx); observe != nil && err == nil {
+				observe(url, resp)
 			}
-			// 返回包含HTTP状态和响应体的详细错误
-			return nil, fmt.Errorf("连接失败 [%s]: %w, 响应: %s", resp.Status, err, string(body))
+			return conn, resp, err
 		}
-		// 返回基本的连接错误
-		return nil, fmt.Errorf("连接失败: %w", err)
+
+		// 第五步：解析重定向目标，超过跳数上限时以最后的响应失败返回
+		hops := len(chain)
+		if hops > config.MaxRedirects {
+			log.Printf(tr("🔀 重定向链: %s"), strings.Join(chain, " -> "))
+			return nil, resp, fmt.Errorf(tr("握手重定向超过 %d 次上限: %w"), config.MaxRedirects, err)
+		}
+		next, locErr := resolveRedirectURL(url, resp.Header.Get("Location"), config.AllowInsecureRedirect)
+		if locErr != nil {
+			return nil, resp, fmt.Errorf(tr("无法跟随握手重定向: %v: %w"), locErr, err)
+		}
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf(tr("⚠️ 关闭响应体失败: %v"), closeErr)
+		}
+		log.Printf(tr("↪️ 握手重定向 [%s] (%d/%d): %s -> %s"), resp.Status, hops, config.MaxRedirects, url, next)
+		url = next
+		chain = append(chain, url)
 	}
+}
 
-	// 连接成功，返回WebSocket连接
-	return conn, nil
+// handshakeObserverKey 上下文键，对应的值是握手成功后接收最终地址和HTTP响应的回调
+type handshakeObserverKey struct{}
+
+// withHandshakeObserver 在上下文中挂载握手观察回调
+// 与httptrace类似，Connector接口不返回握手响应，调用方通过上下文取得升级请求和响应的头部
+//
+// 参数说明：
+//   - ctx: 传给Connector.Connect的上下文
+//   - observe: 握手成功后调用，参数为跟随重定向后的最终地址和101响应（resp.Request为升级请求）
+func withHandshakeObserver(ctx context.Context, observe func(url string, resp *http.Response)) context.Context {
+	return context.WithValue(ctx, handshakeObserverKey{}, observe)
 }
 
-// Disconnect 实现连接器接口
-// 这个方法优雅地断开WebSocket连接，遵循WebSocket协议规范
+// handshakeObserverFrom 取出上下文中的握手观察回调，未挂载时返回nil
+func handshakeObserverFrom(ctx context.Context) func(url string, resp *http.Response) {
+	observe, _ := ctx.Value(handshakeObserverKey{}).(func(url string, resp *http.Response))
+	return observe
+}
+
+// OriginAuto Origin配置取值：按目标地址推导Origin
+const OriginAuto = "auto"
+
+// defaultUserAgent 返回默认的User-Agent：应用名称（空格替换为-）/版本号
+func defaultUserAgent() string {
+	return strings.ReplaceAll(AppName, " ", "-") + "/" + AppVersion
+}
+
+// handshakeHeader 构建握手请求的附加头部
 //
 // 参数说明：
-//   - conn: 要断开的WebSocket连接，可以为nil
+//   - config: 客户端配置，使用其中的UserAgent和Origin
+//   - target: 握手的WebSocket地址，Origin为auto时据此推导
 //
 // 返回值：
-//   - error: 断开连接时的错误，如果连接为nil则返回nil
-//
-// 断开流程：
-//  1. 检查连接是否为nil（防御性编程）
-//  2. 发送WebSocket关闭消息（协议要求）
-//  3. 关闭底层TCP连接
-//
-// 协议遵循：
-//   - 发送CloseNormalClosure状态码，表示正常关闭
-//   - 包含关闭原因，便于服务器理解
-//   - 即使发送关闭消息失败，也会继续关闭连接
-//
-// 错误处理：
-//   - 发送关闭消息失败不会阻止连接关闭
-//   - 记录警告日志，便于问题诊断
-//   - 返回实际的连接关闭错误
-func (dc *DefaultConnector) Disconnect(conn *websocket.Conn) error {
-	// 第一步：防御性检查，避免空指针异常
-	if conn == nil {
-		return nil
+//   - http.Header: 总是包含User-Agent；配置了Origin时包含Origin
+func handshakeHeader(config *ClientConfig, target string) http.Header {
+	header := http.Header{}
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
 	}
-
-	// 第二步：发送WebSocket关闭消息（协议规范）
-	err := conn.WriteMessage(websocket.CloseMessage,
-		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "客户端主动关闭"))
-	if err != nil {
-		// 记录警告但不返回错误，继续关闭连接
-		log.Printf("⚠️ 发送关闭消息失败: %v", err)
+	header.Set("User-Agent", userAgent)
+
+	origin := config.Origin
+	if origin == OriginAuto {
+		origin = ""
+		if u, err := url.Parse(target); err == nil {
+			scheme := "http"
+			if u.Scheme == "wss" {
+				scheme = "https"
+			}
+			origin = scheme + "://" + u.Host
+		}
+	}
+	if origin != "" {
+		header.Set("Origin", origin)
 	}
+	return header
+}
 
-	// 第三步：关闭底层连接
-	return conn.Close()
+// isHandshakeRedirect 判断握手响应是否为可跟随的重定向（301/302/307/308）
+func isHandshakeRedirect(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
 
-// IsHealthy 实现连接器接口
-// 这个方法通过发送ping消息来检查WebSocket连接的健康状态
+// resolveRedirectURL 根据当前握手地址解析重定向的Location
+// 相对地址基于当前地址解析；网关常返回http/https地址，统一映射为ws/wss
 //
 // 参数说明：
-//   - conn: 要检查的WebSocket连接
+//   - current: 当前握手的WebSocket URL
+//   - location: 响应中的Location头部
+//   - allowInsecure: 是否允许从wss://降级到明文ws://（--allow-insecure-redirect）
 //
 // 返回值：
-//   - bool: true表示连接健康，false表示连接有问题
-//
-// 检查方法：
-//   - 使用WebSocket ping消息进行活跃性检测
-//   - 设置5秒超时，避免长时间阻塞
-//   - 不等待pong响应，只检查发送是否成功
-//
-// 健康标准：
-//   - 连接不为nil
-//   - 能够成功发送ping消息
-//   - 没有网络错误或连接错误
-//
-// 使用场景：
-//   - 定期健康检查
-//   - 重连前的状态验证
-//   - 负载均衡的连接选择
-//
-// 性能考虑：
-//   - 使用WriteControl而不是WriteMessage，更高效
-//   - 设置合理的超时时间，避免阻塞
-//   - 不等待响应，减少检查延迟
-func (dc *DefaultConnector) IsHealthy(conn *websocket.Conn) bool {
-	// 第一步：检查连接是否存在
-	if conn == nil {
-		return false
+//   - string: 下一跳的WebSocket URL
+//   - error: Location缺失、无法解析、协议不受支持，或未允许时从TLS降级到明文的错误
+func resolveRedirectURL(current, location string, allowInsecure bool) (string, error) {
+	if location == "" {
+		return "", errors.New(tr("响应缺少Location头部"))
+	}
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	target, err := base.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf(tr("无效的Location '%s': %w"), location, err)
 	}
 
-	// 第二步：尝试发送ping消息检查连接活跃性
-	// 使用5秒超时，在性能和可靠性之间平衡
-	err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
-	return err == nil // 发送成功表示连接健康
+	switch target.Scheme {
+	case "http":
+		target.Scheme = "ws"
+	case "https":
+		target.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", fmt.Errorf(tr("不支持的重定向协议 '%s'"), target.Scheme)
+	}
+	// 重定向会重发握手请求头（Authorization、Cookie等），降级到明文后这些内容和之后的消息都会明文传输
+	if base.Scheme == "wss" && target.Scheme == "ws" && !allowInsecure {
+		return "", fmt.Errorf(tr("拒绝从 wss:// 重定向到明文地址 '%s'（使用 --allow-insecure-redirect 允许）"), redactURL(target.String()))
+	}
+	return target.String(), nil
 }
 
-// DefaultMessageProcessor 默认消息处理器实现
-// 这个结构体实现了MessageProcessor接口，提供标准的消息处理功能
-// 支持消息验证、格式化、大小限制和可选的JSON验证
+// dumpHandshake 输出WebSocket升级请求和服务器响应的完整头部
+// 请求取自resp.Request（gorilla/websocket发送的原始请求，含Sec-WebSocket-Key等握手头），
+// 响应包含状态行和全部头部，最后汇总Sec-WebSocket-Accept和扩展/子协议协商结果
 //
-// 主要功能：
-//  1. 消息验证：检查消息类型和大小
-//  2. 消息处理：记录和处理不同类型的消息
-//  3. 消息格式化：对消息进行基本的格式化处理
-//  4. JSON验证：可选的JSON格式验证（文本消息）
-//  5. 大小限制：防止过大消息导致内存问题
+// 参数说明：
+//   - resp: DialContext返回的握手响应，不读取也不关闭响应体
 //
-// 设计特点：
-//   - 类型安全：严格的消息类型检查
-//   - 性能优化：避免不必要的字符串转换
-//   - 可配置：支持自定义消息大小限制和验证选项
-//   - 扩展性：易于扩展支持更多消息格式
-type DefaultMessageProcessor struct {
-	maxMessageSize int  // 最大消息大小限制（字节）
-	validateJSON   bool // 是否启用JSON格式验证
+// 注意事项：
+//   - 头部按名称排序输出，同名多值逐行输出
+//   - 包含Authorization等敏感头部，仅用于调试
+func dumpHandshake(resp *http.Response) {
+	writeHeaders := func(prefix string, header http.Header) {
+		names := make([]string, 0, len(header))
+		for name := range header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, value := range header[name] {
+				log.Printf("%s %s: %s", prefix, name, value)
+			}
+		}
+	}
+
+	// 第一步：输出升级请求
+	if req := resp.Request; req != nil {
+		log.Printf("🤝 > %s %s %s", req.Method, req.URL.RequestURI(), req.Proto)
+		log.Printf("🤝 > Host: %s", req.Host)
+		writeHeaders("🤝 >", req.Header)
+	}
+
+	// 第二步：输出服务器响应
+	log.Printf("🤝 < %s %s", resp.Proto, resp.Status)
+	writeHeaders("🤝 <", resp.Header)
+
+	// 第三步：汇总协商结果
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		log.Printf(tr("🤝 升级未完成: 服务器返回 %s"), resp.Status)
+		return
+	}
+	accept := resp.Header.Get("Sec-WebSocket-Accept")
+	if accept == "" {
+		accept = "缺失"
+	}
+	extensions := resp.Header.Get("Sec-WebSocket-Extensions")
+	if extensions == "" {
+		extensions = "无"
+	}
+	subprotocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	if subprotocol == "" {
+		subprotocol = "无"
+	}
+	log.Printf(tr("🤝 协商结果: Accept=%s, 子协议=%s, 扩展=%s"), accept, subprotocol, extensions)
 }
 
-// NewDefaultMessageProcessor 创建默认消息处理器
-// 这是DefaultMessageProcessor的构造函数，配置消息处理参数
+// newResolvingDialContext 根据名称解析配置创建TCP拨号函数
+// 这个函数为拨号器提供自定义的名称解析能力，便于绕过负载均衡直接测试指定后端实例
 //
 // 参数说明：
-//   - maxSize: 最大消息大小限制（字节），防止内存溢出
-//   - validateJSON: 是否对文本消息进行JSON格式验证
+//   - config: 客户端配置，包含ResolveOverrides、DNSServer和DNSCacheTTL
+//   - cache: 跨重连保留的DNS解析缓存，为nil时每次都重新解析
 //
 // 返回值：
-//   - *DefaultMessageProcessor: 配置好的消息处理器实例
-//
-// 配置建议：
-//   - maxSize: 建议设置为32KB，平衡功能和安全
-//   - validateJSON: 开发环境可启用，生产环境根据需要
+//   - func: 供websocket.Dialer.NetDialContext使用的拨号函数
 //
-// 使用示例：
+// 解析规则：
+//  1. 命中--resolve覆盖的host:port直接拨号到指定IP，不发起DNS查询
+//  2. 配置了--dns时，其余主机通过指定DNS服务器解析
+//  3. 未命中覆盖且未配置DNS服务器时使用系统解析器
+//  4. 默认每次连接尝试都重新解析；配置了--dns-cache-ttl时在有效期内复用缓存地址
 //
-//	processor := NewDefaultMessageProcessor(32768, false)
-//	err := processor.ProcessMessage(websocket.TextMessage, data)
-func NewDefaultMessageProcessor(maxSize int, validateJSON bool) *DefaultMessageProcessor {
-	return &DefaultMessageProcessor{
-		maxMessageSize: maxSize,      // 设置消息大小限制
-		validateJSON:   validateJSON, // 设置JSON验证选项
+// 注意事项：
+//   - 只替换TCP拨号地址，TLS的SNI和Host头仍使用URL中的原始主机名
+//   - 覆盖键不区分主机名大小写
+//   - 每次拨号都记录解析结果和实际连接的IP，便于观察DNS背后的故障切换
+//   - 缓存的地址全部拨号失败时丢弃该缓存，下一次重试重新解析
+//   - 每个地址的TCP连接单独受DialTimeout限制，超时错误包装为ErrDialTimeout，与TLS握手或HTTP升级阶段的握手超时区分
+func newResolvingDialContext(config *ClientConfig, cache *dnsCache) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	timeout := config.tcpDialTimeout()
+	netDialer := &net.Dialer{Timeout: timeout}
+	dialAddr := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := netDialer.DialContext(ctx, network, addr)
+		return conn, wrapDialTimeout(ctx, err, timeout)
 	}
-}
 
-// ProcessMessage 实现消息处理器接口
-// 这个方法处理接收到的WebSocket消息，包括验证和记录
-//
-// 参数说明：
-//   - messageType: WebSocket消息类型（TextMessage、BinaryMessage等）
-//   - data: 消息内容的字节数组
-//
-// 返回值：
-//   - error: 处理失败时的错误信息
-//
-// 处理流程：
-//  1. 消息验证：检查消息类型和大小
-//  2. 消息记录：根据类型记录不同的日志
-//  3. 错误处理：验证失败时返回详细错误
-//
-// 支持的消息类型：
-//   - TextMessage: 文本消息，记录完整内容
-//   - BinaryMessage: 二进制消息，记录大小
-//   - PingMessage: Ping消息，记录接收事件
-//   - PongMessage: Pong消息，记录接收事件
-//   - 其他类型: 记录为未知类型
-//
-// 性能优化：
-//   - 先验证后处理，避免无效消息的处理开销
-//   - 分离日志记录逻辑，便于优化和测试
-func (dmp *DefaultMessageProcessor) ProcessMessage(messageType int, data []byte) error {
-	// 第一步：基本验证，确保消息有效
-	if err := dmp.ValidateMessage(messageType, data); err != nil {
-		return fmt.Errorf("消息验证失败: %w", err)
+	// 使用纯Go解析器并将所有DNS查询发送到指定服务器
+	if config.DNSServer != "" {
+		dnsServer := config.DNSServer
+		netDialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				dnsDialer := &net.Dialer{Timeout: 5 * time.Second}
+				return dnsDialer.DialContext(ctx, network, dnsServer)
+			},
+		}
 	}
 
-	// 第二步：记录消息（优化字符串转换）
-	dmp.logProcessedMessage(messageType, data)
-	return nil
+	overrides := make(map[string]string, len(config.ResolveOverrides))
+	for hostPort, ip := range config.ResolveOverrides {
+		overrides[strings.ToLower(hostPort)] = ip
+	}
+
+	resolver := netDialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ttl := config.DNSCacheTTL
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// 第一步：命中解析覆盖时直接拨号到指定IP
+		if ip, ok := overrides[strings.ToLower(addr)]; ok {
+			log.Printf(tr("🧭 解析覆盖: %s -> %s"), addr, ip)
+			return dialAddr(ctx, network, net.JoinHostPort(ip, port))
+		}
+
+		// IP地址无需解析
+		if net.ParseIP(host) != nil {
+			return dialAddr(ctx, network, addr)
+		}
+
+		// 第二步：解析主机名，缓存有效时复用上次的结果
+		ips, cached, err := cache.lookup(ctx, resolver, host, ttl)
+		if err != nil {
+			return nil, err
+		}
+		source := "DNS解析"
+		if cached {
+			source = "DNS缓存"
+		}
+		log.Printf("🧭 %s: %s -> %s", source, host, strings.Join(ips, ", "))
+
+		// 第三步：按顺序尝试解析出的地址，记录实际使用的IP
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialAddr(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				log.Printf(tr("🧭 拨号 %s 使用地址 %s"), addr, ip)
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		// 第四步：缓存的地址全部不可用，丢弃缓存让下一次重试重新解析
+		if cached {
+			cache.forget(host)
+		}
+		return nil, lastErr
+	}
 }
 
-// logProcessedMessage 记录处理的消息（避免重复字符串转换）
-// 这个方法根据消息类型记录不同格式的日志，优化性能和可读性
-//
-// 参数说明：
-//   - messageType: WebSocket消息类型
-//   - data: 消息内容的字节数组
-//
-// 日志格式：
-//   - 文本消息：显示完整内容，便于调试
-//   - 二进制消息：只显示大小，避免乱码
-//   - 控制消息：显示消息类型，便于协议调试
-//   - 未知消息：显示类型码，便于问题诊断
-//
-// 性能考虑：
-//   - 只在需要时进行字符串转换
-//   - 使用switch语句提高分支效率
-//   - 避免不必要的格式化操作
-func (dmp *DefaultMessageProcessor) logProcessedMessage(messageType int, data []byte) {
-	switch messageType {
-	case websocket.TextMessage:
-		// 文本消息：显示完整内容，便于调试
-		log.Printf("📥 收到文本消息: %s", string(data))
-	case websocket.BinaryMessage:
-		// 二进制消息：只显示大小，避免乱码输出
-		log.Printf("📥 收到二进制消息: %d 字节", len(data))
-	case websocket.PingMessage:
-		// Ping消息：协议级别的心跳检测
-		log.Printf("📡 收到ping消息")
-	case websocket.PongMessage:
-		// Pong消息：对ping的响应
-		log.Printf("📡 收到pong消息")
-	default:
-		// 未知类型：记录类型码便于问题诊断
-		log.Printf("📥 收到未知类型消息: %d", messageType)
+// wrapDialTimeout 将拨号器自身的连接超时包装为ErrDialTimeout
+// 上下文已结束（握手超时或取消）导致的失败原样返回，由调用方按握手超时处理
+func wrapDialTimeout(ctx context.Context, err error, timeout time.Duration) error {
+	var netErr net.Error
+	if err == nil || ctx.Err() != nil || !errors.As(err, &netErr) || !netErr.Timeout() {
+		return err
 	}
+	return fmt.Errorf("%w (%v): %w", ErrDialTimeout, timeout, err)
 }
 
-// FormatMessage 实现消息处理器接口
-// 这个方法对消息进行基本的格式化处理，确保消息符合发送要求
-//
-// 参数说明：
-//   - data: 要格式化的消息内容字节数组
-//
-// 返回值：
-//   - []byte: 格式化后的消息内容
-//   - error: 格式化失败时的错误信息
-//
-// 格式化检查：
-//  1. 空消息检查：确保消息不为空
-//  2. 大小限制：确保消息不超过最大大小限制
-//  3. 内容验证：可扩展的内容验证逻辑
-//
-// 扩展性：
-//   - 可以添加消息编码转换
-//   - 可以添加消息压缩功能
-//   - 可以添加消息加密功能
-//   - 可以添加自定义格式化规则
+// dnsCache 主机名解析结果缓存
+// 由连接器持有，跨重连保留，使--dns-cache-ttl能在多次连接尝试之间复用解析结果
 //
-// 使用场景：
-//   - 发送消息前的预处理
-//   - 消息内容的标准化
-//   - 消息安全检查
-func (dmp *DefaultMessageProcessor) FormatMessage(data []byte) ([]byte, error) {
-	// 第一步：检查消息是否为空
-	if len(data) == 0 {
-		return nil, fmt.Errorf("消息内容不能为空")
-	}
+// 并发安全：
+//   - 所有方法都通过互斥锁保护，可以被并发的拨号调用
+type dnsCache struct {
+	mu      sync.Mutex               // 保护entries
+	entries map[string]dnsCacheEntry // 小写主机名 -> 解析结果
+}
 
-	// 第二步：检查消息大小是否超过限制
-	if len(data) > dmp.maxMessageSize {
-		return nil, fmt.Errorf("消息大小 %d 超过限制 %d", len(data), dmp.maxMessageSize)
-	}
+// dnsCacheEntry 单个主机名的缓存解析结果
+type dnsCacheEntry struct {
+	addrs   []string  // 解析出的IP地址，按解析器返回的顺序
+	expires time.Time // 过期时间
+}
 
-	// 第三步：返回格式化后的消息（当前为直接返回，可扩展）
-	return data, nil
+// newDNSCache 创建空的DNS解析缓存
+func newDNSCache() *dnsCache {
+	return &dnsCache{entries: make(map[string]dnsCacheEntry)}
 }
 
-// ValidateMessage 实现消息处理器接口
-// 这个方法验证WebSocket消息的有效性，包括类型和内容检查
+// lookup 解析主机名，缓存有效时直接返回缓存结果
 //
 // 参数说明：
-//   - messageType: WebSocket消息类型常量
-//   - data: 消息内容的字节数组
+//   - ctx: 解析的上下文
+//   - resolver: 缓存未命中时使用的解析器
+//   - host: 要解析的主机名
+//   - ttl: 缓存时长，0表示不读也不写缓存
 //
 // 返回值：
-//   - error: 验证失败时的详细错误信息，成功时返回nil
-//
-// 验证项目：
-//  1. 消息类型验证：检查是否为有效的WebSocket消息类型
-//  2. 消息大小验证：确保不超过配置的最大大小
-//  3. 内容格式验证：可选的JSON格式验证（文本消息）
-//
-// 支持的消息类型：
-//   - TextMessage: 文本消息，UTF-8编码
-//   - BinaryMessage: 二进制消息，任意字节序列
-//   - PingMessage: Ping控制消息，用于保活
-//   - PongMessage: Pong控制消息，对Ping的响应
-//   - CloseMessage: 关闭消息，用于优雅关闭连接
+//   - []string: 解析出的IP地址
+//   - bool: 结果是否来自缓存
+//   - error: 解析失败时的错误
 //
-// 安全考虑：
-//   - 防止过大消息导致内存溢出
-//   - 验证消息类型防止协议攻击
-//   - 可选的内容格式验证
-func (dmp *DefaultMessageProcessor) ValidateMessage(messageType int, data []byte) error {
-	// 第一步：验证消息类型是否为WebSocket协议支持的类型
-	switch messageType {
-	case websocket.TextMessage, websocket.BinaryMessage,
-		websocket.PingMessage, websocket.PongMessage, websocket.CloseMessage:
-		// 这些都是有效的WebSocket消息类型
-	default:
-		return fmt.Errorf("无效的消息类型: %d", messageType)
+// 注意事项：
+//   - 接收者为nil时等同于ttl为0
+func (dc *dnsCache) lookup(ctx context.Context, resolver *net.Resolver, host string, ttl time.Duration) ([]string, bool, error) {
+	key := strings.ToLower(host)
+	if dc != nil && ttl > 0 {
+		dc.mu.Lock()
+		entry, ok := dc.entries[key]
+		dc.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.addrs, true, nil
+		}
 	}
 
-	// 第二步：验证消息大小是否在允许范围内
-	if len(data) > dmp.maxMessageSize {
-		return fmt.Errorf("消息大小 %d 超过限制 %d", len(data), dmp.maxMessageSize)
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, false, err
+	}
+	if dc != nil && ttl > 0 {
+		dc.mu.Lock()
+		dc.entries[key] = dnsCacheEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+		dc.mu.Unlock()
 	}
+	return addrs, false, nil
+}
 
-	// 第三步：可选的JSON格式验证（仅对文本消息）
-	if dmp.validateJSON && messageType == websocket.TextMessage {
-		// 这里可以添加JSON验证逻辑
-		// 例如：json.Valid(data) 检查JSON格式
-		// 为了保持简单和性能，暂时跳过具体实现
+// forget 删除主机名的缓存结果
+func (dc *dnsCache) forget(host string) {
+	if dc == nil {
+		return
 	}
+	dc.mu.Lock()
+	delete(dc.entries, strings.ToLower(host))
+	dc.mu.Unlock()
+}
 
-	// 所有验证通过
-	return nil
+// ===== 网络条件模拟 =====
+
+// simulatedQueueSize 每个方向在途数据块队列的长度
+const simulatedQueueSize = 64
+
+// simulatedConn 模拟网络延迟和带宽限制的net.Conn包装
+// 延迟按方向各加一半，使往返时间增加约latency；带宽限制在读写两个方向分别生效
+//
+// 实现方式：
+//   - 每个数据块在进入"链路"时记下送达时间：链路空闲时刻加上传输耗时，再加单向延迟
+//   - 读方向由后台协程持续读取底层连接并排队，Read等到队首数据块的送达时间再交付
+//   - 写方向Write只按带宽节奏等待链路空闲，数据块由后台协程在送达时间写入底层连接
+//   - 延迟是每个数据块在途的时间而不是每次调用的等待，不会变成吞吐上限
+//   - 读写截止时间由包装层自己维护，等待期间到期时返回os.ErrDeadlineExceeded
+type simulatedConn struct {
+	net.Conn
+	halfLatency time.Duration // 单向附加延迟
+	bytesPerSec float64       // 每个方向的带宽上限（字节/秒），0表示不限制
+
+	readQueue     chan simulatedChunk // 已从底层连接读出、等待送达的数据块
+	readPending   simulatedChunk      // 已送达但未被Read取完的数据块，只由Read访问
+	readDeadline  simulatedDeadline
+	writeQueue    chan simulatedChunk // 等待在送达时间写入底层连接的数据块
+	writeMu       sync.Mutex          // 保护writeFree，串行化Write调用
+	writeFree     time.Time           // 写方向链路空闲的时刻
+	writeErr      atomic.Pointer[error]
+	writeDeadline simulatedDeadline
+	writerDone    chan struct{} // 写协程退出时关闭
+	closing       chan struct{} // Close开始时关闭，之后的读写返回net.ErrClosed
+	closed        chan struct{} // 底层连接关闭后关闭
+	closeOnce     sync.Once
+	closeErr      error
 }
 
-// DefaultErrorRecovery 默认错误恢复实现
-// 这个结构体实现了ErrorRecovery接口，提供智能的错误恢复策略
-// 根据错误类型自动选择最合适的恢复方法，并跟踪恢复历史
-//
-// 主要功能：
-//  1. 错误分类：根据错误类型判断是否可恢复
-//  2. 策略选择：为不同错误选择最佳恢复策略
-//  3. 历史跟踪：记录每种错误的恢复次数
-//  4. 智能限制：防止无限重试导致资源浪费
-//  5. 动态调整：根据恢复效果调整策略参数
-//
-// 恢复策略：
-//   - RecoveryRetry: 简单重试，适用于临时错误
-//   - RecoveryReconnect: 重新连接，适用于连接断开
-//   - RecoveryReset: 重置状态，适用于状态异常
-//   - RecoveryFallback: 降级处理，适用于持续失败
-//
-// 并发安全：使用读写锁保护共享状态，支持多goroutine并发访问
-type DefaultErrorRecovery struct {
-	maxRetries      int            // 最大重试次数：防止无限重试
-	retryDelay      time.Duration  // 重试延迟：控制重试频率
-	recoveryHistory map[string]int // 错误类型的恢复历史：key为错误类型，value为重试次数
-	mu              sync.RWMutex   // 读写锁：保护并发访问
+// simulatedChunk 在模拟链路上传输的一个数据块
+type simulatedChunk struct {
+	data []byte
+	at   time.Time // 送达时间
+	err  error     // 读方向：底层连接的读取错误，在之前的数据全部送达后返回
 }
 
-// NewDefaultErrorRecovery 创建默认错误恢复器
-// 这是DefaultErrorRecovery的构造函数，初始化恢复参数和历史记录
-//
-// 参数说明：
-//   - maxRetries: 最大重试次数，建议设置为3-10次
-//   - retryDelay: 重试延迟时间，建议设置为1-5秒
-//
-// 返回值：
-//   - *DefaultErrorRecovery: 初始化完成的错误恢复器实例
-//
-// 配置建议：
-//   - 网络环境良好：maxRetries=3, retryDelay=1s
-//   - 网络环境一般：maxRetries=5, retryDelay=3s
-//   - 网络环境较差：maxRetries=10, retryDelay=5s
-//
-// 使用示例：
-//
-//	recovery := NewDefaultErrorRecovery(5, 3*time.Second)
-//	if recovery.CanRecover(err) {
-//	    strategy := recovery.GetRecoveryStrategy(err)
-//	    err = recovery.Recover(ctx, err)
-//	}
-func NewDefaultErrorRecovery(maxRetries int, retryDelay time.Duration) *DefaultErrorRecovery {
-	return &DefaultErrorRecovery{
-		maxRetries:      maxRetries,               // 设置最大重试次数
-		retryDelay:      retryDelay,               // 设置重试延迟
-		recoveryHistory: make(map[string]int, 10), // 预分配容量，优化性能
+// simulatedDeadline 可在等待期间修改的截止时间
+type simulatedDeadline struct {
+	mu      sync.Mutex
+	t       time.Time
+	changed chan struct{} // 截止时间修改时关闭并替换，唤醒正在等待的调用
+}
+
+// set 修改截止时间并唤醒等待者
+func (d *simulatedDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.t = t
+	if d.changed != nil {
+		close(d.changed)
 	}
+	d.changed = make(chan struct{})
 }
 
-// CanRecover 实现错误恢复接口
-// 这个方法判断给定的错误是否可以通过恢复策略来解决
+// get 返回当前截止时间和修改通知通道
+func (d *simulatedDeadline) get() (time.Time, chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.changed == nil {
+		d.changed = make(chan struct{})
+	}
+	return d.t, d.changed
+}
+
+// newSimulatedDialContext 在拨号函数外包装网络条件模拟
 //
 // 参数说明：
-//   - err: 需要判断的错误实例
+//   - config: 客户端配置，包含SimulateLatency和SimulateBandwidth
+//   - base: 底层拨号函数，nil时使用默认TCP拨号
 //
 // 返回值：
-//   - bool: true表示错误可恢复，false表示错误不可恢复
-//
-// 可恢复的错误类型：
-//  1. 网络错误：连接超时、网络不可达等临时网络问题
-//  2. 连接错误：连接关闭、连接失败等连接层面的问题
-//  3. 超时错误：握手超时、读写超时等时间相关的问题
-//  4. 自定义错误：ConnectionError中标记为可重试的错误
-//
-// 不可恢复的错误类型：
-//   - 认证失败：用户名密码错误
-//   - 权限错误：访问被拒绝
-//   - 协议错误：WebSocket协议违规
-//   - 配置错误：URL格式错误等
-//
-// 判断逻辑：
-//   - 使用errors.Is进行错误类型匹配
-//   - 支持错误链的深度检查
-//   - 检查自定义错误的Retry标志
+//   - func: 供websocket.Dialer.NetDialContext使用的拨号函数；未启用模拟时原样返回base
 //
-// 并发安全：此方法是只读操作，可以安全地并发调用
-func (der *DefaultErrorRecovery) CanRecover(err error) bool {
-	// 第一步：空错误检查
-	if err == nil {
-		return false
+// 注意事项：
+//   - 模拟作用于TCP层，wss://连接的TLS握手同样受影响，可以复现慢速链路上的握手超时
+func newSimulatedDialContext(config *ClientConfig, base func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if config.SimulateLatency <= 0 && config.SimulateBandwidth <= 0 {
+		return base
+	}
+	if base == nil {
+		netDialer := &net.Dialer{Timeout: config.tcpDialTimeout()}
+		base = netDialer.DialContext
 	}
 
-	// 第二步：检查是否是可恢复的错误类型
-	switch {
-	case isNetworkError(err):
-		// 网络错误通常是临时的，可以通过重连恢复
-		return true
-	case errors.Is(err, ErrConnectionClosed):
-		// 连接关闭可以通过重连恢复
-		return true
-	case errors.Is(err, ErrConnectionFailed):
-		// 连接失败可以通过重试恢复
-		return true
-	case errors.Is(err, ErrHandshakeTimeout):
-		// 握手超时可以通过重试恢复
-		return true
-	case errors.Is(err, ErrReadTimeout):
-		// 读取超时可以通过重置恢复
-		return true
-	case errors.Is(err, ErrWriteTimeout):
-		// 写入超时可以通过重置恢复
-		return true
-	default:
-		// 第三步：检查自定义错误类型的可恢复标志
-		if connErr, ok := err.(*ConnectionError); ok {
-			return connErr.Retry // 使用错误实例中的重试标志
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := base(ctx, network, addr)
+		if err != nil {
+			return nil, err
 		}
-		// 其他类型的错误默认不可恢复
-		return false
+		log.Printf(tr("🐢 网络模拟: 附加延迟=%v 带宽=%s"), config.SimulateLatency, formatBandwidth(config.SimulateBandwidth))
+		return newSimulatedConn(conn, config.SimulateLatency/2, float64(config.SimulateBandwidth)/8), nil
 	}
 }
 
-// Recover 实现错误恢复接口
-// 这个方法执行具体的错误恢复操作，根据错误类型选择最佳恢复策略
-//
-// 参数说明：
-//   - ctx: 上下文，用于取消操作和超时控制
-//   - err: 需要恢复的错误实例
-//
-// 返回值：
-//   - error: 恢复失败时的错误信息，成功时返回nil
-//
-// 恢复流程：
-//  1. 检查错误是否可恢复
-//  2. 获取最佳恢复策略
-//  3. 执行对应的恢复操作
-//  4. 返回恢复结果
-//
-// 恢复策略执行：
-//   - RecoveryRetry: 等待一段时间后重试
-//   - RecoveryReconnect: 重新建立连接
-//   - RecoveryReset: 重置连接状态
-//   - RecoveryFallback: 降级处理
-//
-// 并发安全：可以在多个goroutine中同时调用
-// 上下文支持：支持通过context取消恢复操作
-func (der *DefaultErrorRecovery) Recover(ctx context.Context, err error) error {
-	// 第一步：检查错误是否可恢复
-	if !der.CanRecover(err) {
-		return fmt.Errorf("错误不可恢复: %w", err)
+// newSimulatedConn 包装连接并启动读写两个方向的后台协程
+func newSimulatedConn(conn net.Conn, halfLatency time.Duration, bytesPerSec float64) *simulatedConn {
+	sc := &simulatedConn{
+		Conn:        conn,
+		halfLatency: halfLatency,
+		bytesPerSec: bytesPerSec,
+		readQueue:   make(chan simulatedChunk, simulatedQueueSize),
+		writeQueue:  make(chan simulatedChunk, simulatedQueueSize),
+		writerDone:  make(chan struct{}),
+		closing:     make(chan struct{}),
+		closed:      make(chan struct{}),
 	}
+	go sc.readLoop()
+	go sc.writeLoop()
+	return sc
+}
 
-	// 第二步：获取最佳恢复策略
-	strategy := der.GetRecoveryStrategy(err)
+// chunkSize 单次读写的最大字节数，让带宽限制按约100毫秒的粒度平滑生效
+func (sc *simulatedConn) chunkSize(n int) int {
+	if sc.bytesPerSec <= 0 {
+		return n
+	}
+	return min(n, max(int(sc.bytesPerSec/10), 512))
+}
 
-	// 第三步：根据策略执行对应的恢复操作
-	switch strategy {
-	case RecoveryRetry:
-		// 执行重试恢复：等待后重试
-		return der.retryOperation(ctx, err)
-	case RecoveryReconnect:
-		// 执行重连恢复：重新建立连接
-		return der.reconnectOperation(ctx, err)
-	case RecoveryReset:
-		// 执行重置恢复：重置连接状态
-		return der.resetOperation(ctx, err)
-	case RecoveryFallback:
-		// 执行降级恢复：降级处理
-		return der.fallbackOperation(ctx, err)
-	default:
-		// 未知策略，返回错误
-		return fmt.Errorf("未知的恢复策略: %v", strategy)
+// transmitDelay 传输n字节在限定带宽下需要的时间
+func (sc *simulatedConn) transmitDelay(n int) time.Duration {
+	if sc.bytesPerSec <= 0 || n <= 0 {
+		return 0
 	}
+	return time.Duration(float64(n) / sc.bytesPerSec * float64(time.Second))
 }
 
-// GetRecoveryStrategy 实现错误恢复接口
-// 这个方法根据错误类型和特征选择最合适的恢复策略
-//
-// 参数说明：
-//   - err: 需要分析的错误实例
-//
-// 返回值：
-//   - RecoveryStrategy: 推荐的恢复策略
-//
-// 策略选择逻辑：
-//  1. 网络错误 -> 重连：网络问题需要重新建立连接
-//  2. 连接关闭 -> 重连：连接断开需要重新连接
-//  3. 握手超时 -> 重试：可能是临时网络延迟
-//  4. 读写超时 -> 重置：可能是连接状态异常
-//  5. 自定义错误 -> 根据错误码选择策略
-//
-// 策略优先级：
-//   - 重连 > 重试 > 重置 > 降级
-//   - 优先选择影响最小的策略
-//   - 根据错误严重程度调整策略
-//
-// 并发安全：此方法是只读操作，可以安全地并发调用
-func (der *DefaultErrorRecovery) GetRecoveryStrategy(err error) RecoveryStrategy {
-	// 第一步：空错误检查
-	if err == nil {
-		return RecoveryNone
+// readLoop 持续读取底层连接，为每个数据块计算送达时间后排队
+func (sc *simulatedConn) readLoop() {
+	buf := make([]byte, sc.chunkSize(32*1024))
+	var linkFree time.Time
+	for {
+		n, err := sc.Conn.Read(buf)
+		if n == 0 && err == nil {
+			continue
+		}
+		now := time.Now()
+		if n > 0 {
+			linkFree = later(now, linkFree).Add(sc.transmitDelay(n))
+		}
+		chunk := simulatedChunk{data: bytes.Clone(buf[:n]), at: later(now, linkFree).Add(sc.halfLatency), err: err}
+		select {
+		case sc.readQueue <- chunk:
+		case <-sc.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
 	}
+}
 
-	// 第二步：根据错误类型确定恢复策略
-	switch {
-	case isNetworkError(err):
-		// 网络错误：重新建立连接
-		return RecoveryReconnect
-	case errors.Is(err, ErrConnectionClosed):
-		// 连接关闭：重新建立连接
-		return RecoveryReconnect
-	case errors.Is(err, ErrHandshakeTimeout):
-		// 握手超时：简单重试即可
-		return RecoveryRetry
-	case errors.Is(err, ErrReadTimeout), errors.Is(err, ErrWriteTimeout):
-		// 读写超时：重置连接状态
-		return RecoveryReset
-	default:
-		// 第三步：处理自定义错误类型
-		if connErr, ok := err.(*ConnectionError); ok {
-			switch connErr.Code {
-			case ErrCodeConnectionRefused, ErrCodeConnectionTimeout:
-				// 连接被拒绝或超时：重新连接
-				return RecoveryReconnect
-			case ErrCodeSendTimeout, ErrCodeReceiveTimeout:
-				// 发送或接收超时：简单重试
-				return RecoveryRetry
-			case ErrCodeMessageTooLarge:
-				// 消息过大：降级处理
-				return RecoveryFallback
-			default:
-				// 其他连接错误：默认重试
-				return RecoveryRetry
+// writeLoop 在送达时间把排队的数据块写入底层连接
+// Close开始后仍会写完已排队的数据块（它们已经"在链路上"），然后退出
+func (sc *simulatedConn) writeLoop() {
+	defer close(sc.writerDone)
+	for {
+		select {
+		case chunk := <-sc.writeQueue:
+			if !sc.deliver(chunk) {
+				return
+			}
+		case <-sc.closing:
+			for {
+				select {
+				case chunk := <-sc.writeQueue:
+					if !sc.deliver(chunk) {
+						return
+					}
+				default:
+					return
+				}
 			}
 		}
-		// 未知错误类型：默认重试
-		return RecoveryRetry
 	}
 }
 
-// retryOperation 重试操作
-// 这个私有方法实现简单的重试恢复策略，适用于临时性错误
-//
-// 参数说明：
-//   - ctx: 上下文，用于取消操作和超时控制
-//   - err: 触发重试的原始错误
-//
-// 返回值：
-//   - error: 重试失败时的错误信息，成功时返回nil
-//
-// 重试逻辑：
-//  1. 检查该错误类型的重试次数
-//  2. 如果超过最大重试次数，返回失败
-//  3. 记录重试次数并等待重试延迟
-//  4. 支持通过context取消重试
-//
-// 适用场景：
-//   - 网络抖动导致的临时错误
-//   - 服务器临时不可用
-//   - 握手超时等可重试的错误
-//
-// 并发安全：使用互斥锁保护重试计数器
-func (der *DefaultErrorRecovery) retryOperation(ctx context.Context, err error) error {
-	// 第一步：获取错误类型和重试次数（使用锁保护）
-	der.mu.Lock()
-	errType := fmt.Sprintf("%T", err)
-	retryCount := der.recoveryHistory[errType]
-	der.recoveryHistory[errType] = retryCount + 1
-	der.mu.Unlock()
+// deliver 等到送达时间后写入一个数据块，失败时记录错误供后续Write返回
+func (sc *simulatedConn) deliver(chunk simulatedChunk) bool {
+	timer := time.NewTimer(time.Until(chunk.at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-sc.closed:
+		return false
+	}
+	if _, err := sc.Conn.Write(chunk.data); err != nil {
+		sc.writeErr.CompareAndSwap(nil, &err)
+		return false
+	}
+	return true
+}
 
-	// 第二步：检查是否超过最大重试次数
-	if retryCount >= der.maxRetries {
-		return fmt.Errorf("重试次数超过限制 (%d): %w", der.maxRetries, err)
+// wait 等待到until，期间截止时间到期或连接关闭时返回错误
+func (sc *simulatedConn) wait(until time.Time, deadline *simulatedDeadline) error {
+	for {
+		t, changed := deadline.get()
+		now := time.Now()
+		if !t.IsZero() && !t.After(now) {
+			return os.ErrDeadlineExceeded
+		}
+		if !until.After(now) {
+			return nil
+		}
+		wake := until
+		if !t.IsZero() && t.Before(wake) {
+			wake = t
+		}
+		timer := time.NewTimer(wake.Sub(now))
+		select {
+		case <-timer.C:
+		case <-changed:
+		case <-sc.closing:
+			timer.Stop()
+			return net.ErrClosed
+		}
+		timer.Stop()
 	}
+}
 
-	// 第三步：记录重试操作
-	log.Printf("🔄 执行重试恢复策略 (第%d次): %v", retryCount+1, err)
+// nextReadChunk 从读队列取出下一个数据块，遵守读取截止时间
+func (sc *simulatedConn) nextReadChunk() (simulatedChunk, error) {
+	for {
+		t, changed := sc.readDeadline.get()
+		var expired <-chan time.Time
+		var timer *time.Timer
+		if !t.IsZero() {
+			timer = time.NewTimer(time.Until(t))
+			expired = timer.C
+		}
+		select {
+		case chunk := <-sc.readQueue:
+			stopTimer(timer)
+			return chunk, nil
+		case <-expired:
+			return simulatedChunk{}, os.ErrDeadlineExceeded
+		case <-changed:
+			stopTimer(timer)
+		case <-sc.closing:
+			stopTimer(timer)
+			return simulatedChunk{}, net.ErrClosed
+		}
+	}
+}
 
-	// 第四步：等待重试延迟（支持context取消）
-	select {
-	case <-ctx.Done():
-		return ctx.Err() // 被取消，返回context错误
-	case <-time.After(der.retryDelay):
-		return nil // 重试延迟完成，可以重试
+// Read 交付已到达送达时间的数据，遵守读取截止时间
+func (sc *simulatedConn) Read(p []byte) (int, error) {
+	if len(sc.readPending.data) == 0 && sc.readPending.err == nil {
+		chunk, err := sc.nextReadChunk()
+		if err != nil {
+			return 0, err
+		}
+		sc.readPending = chunk
+	}
+	if err := sc.wait(sc.readPending.at, &sc.readDeadline); err != nil {
+		return 0, err
 	}
+	n := copy(p, sc.readPending.data)
+	sc.readPending.data = sc.readPending.data[n:]
+	if len(sc.readPending.data) == 0 && sc.readPending.err != nil {
+		// 保留错误，之后的Read继续返回它
+		return n, sc.readPending.err
+	}
+	return n, nil
 }
 
-// reconnectOperation 重连操作 - 实际执行重连逻辑
-// 这个私有方法实现重连恢复策略，适用于连接断开或网络错误
-//
-// 参数说明：
-//   - ctx: 上下文，用于取消操作和超时控制
-//   - err: 触发重连的原始错误
-//
-// 返回值：
-//   - error: 重连失败时的错误信息，成功时返回nil
-//
-// 重连逻辑：
-//  1. 记录重连操作开始
-//  2. 等待一段时间避免立即重连造成压力
-//  3. 标记需要重连（实际重连由客户端处理）
-//  4. 支持通过context取消重连
-//
-// 适用场景：
-//   - 网络连接断开
-//   - 服务器重启或维护
-//   - 连接被防火墙阻断
-//
-// 设计考虑：
-//   - 避免立即重连，给网络恢复时间
-//   - 实际重连由客户端的重连机制处理
-//   - 支持通过context取消操作
-func (der *DefaultErrorRecovery) reconnectOperation(ctx context.Context, err error) error {
-	// 第一步：记录重连操作开始
-	log.Printf("🔌 执行重连恢复策略: %v", err)
+// Write 按带宽节奏把数据分块送上链路，数据块在单向延迟后由写协程写入底层连接
+// 返回时数据可能仍在途中；写入底层连接失败的错误由之后的Write返回
+func (sc *simulatedConn) Write(p []byte) (int, error) {
+	sc.writeMu.Lock()
+	defer sc.writeMu.Unlock()
 
-	// 第二步：等待一段时间后再重连，避免立即重连造成的压力
-	select {
-	case <-ctx.Done():
-		return ctx.Err() // 被取消，返回context错误
-	case <-time.After(der.retryDelay):
-		// 延迟完成，可以尝试重连
+	written := 0
+	for written < len(p) {
+		if errp := sc.writeErr.Load(); errp != nil {
+			return written, *errp
+		}
+		// 等待上一个数据块传输完毕，链路空闲后才能发送下一块
+		if err := sc.wait(sc.writeFree, &sc.writeDeadline); err != nil {
+			return written, err
+		}
+		n := sc.chunkSize(len(p) - written)
+		sc.writeFree = later(time.Now(), sc.writeFree).Add(sc.transmitDelay(n))
+		chunk := simulatedChunk{data: bytes.Clone(p[written : written+n]), at: sc.writeFree.Add(sc.halfLatency)}
+		select {
+		case sc.writeQueue <- chunk:
+		case <-sc.writerDone:
+			// 写协程已因写入失败退出
+			if errp := sc.writeErr.Load(); errp != nil {
+				return written, *errp
+			}
+			return written, net.ErrClosed
+		case <-sc.closing:
+			return written, net.ErrClosed
+		}
+		written += n
 	}
+	return written, nil
+}
 
-	// 第三步：标记需要重连（实际重连由客户端的重连机制处理）
-	log.Printf("✅ 重连恢复策略准备完成，等待重连机制执行")
+// Close 等待已在途的写入数据送达后关闭底层连接
+// 最多等待单向延迟再加1秒，避免对端停止读取时无限阻塞
+func (sc *simulatedConn) Close() error {
+	sc.closeOnce.Do(func() {
+		close(sc.closing)
+		timer := time.NewTimer(sc.halfLatency + time.Second)
+		defer timer.Stop()
+		select {
+		case <-sc.writerDone:
+		case <-timer.C:
+		}
+		sc.closeErr = sc.Conn.Close()
+		close(sc.closed)
+	})
+	return sc.closeErr
+}
+
+// SetDeadline 同时设置读写截止时间
+func (sc *simulatedConn) SetDeadline(t time.Time) error {
+	sc.readDeadline.set(t)
+	sc.writeDeadline.set(t)
 	return nil
 }
 
-// resetOperation 重置操作 - 实际重置连接状态
-// 这个私有方法实现重置恢复策略，适用于连接状态异常
+// SetReadDeadline 设置读取截止时间，作用于等待数据送达的过程
+func (sc *simulatedConn) SetReadDeadline(t time.Time) error {
+	sc.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline 设置写入截止时间，作用于等待链路空闲的过程
+func (sc *simulatedConn) SetWriteDeadline(t time.Time) error {
+	sc.writeDeadline.set(t)
+	return nil
+}
+
+// stopTimer 停止可能为nil的计时器
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// later 返回两个时间中较晚的一个
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// ===== 帧级调试追踪 =====
+
+// frameTracePreviewSize 帧追踪日志中显示的载荷前缀字节数
+const frameTracePreviewSize = 16
+
+// frameTracer 从字节流中解析WebSocket帧并记录日志
+// 先跳过HTTP升级握手（直到空行），之后按RFC 6455第5.2节逐帧解析，
+// 支持帧头和载荷跨多次读写到达；严格模式下同时检查接收方向的帧头
+type frameTracer struct {
+	direction string                    // 方向标识，用于日志显示
+	trace     bool                      // 是否记录每个帧（--trace-frames）
+	report    func(kind, detail string) // 协议违规回调，nil表示不检查
+	fragment  bool                      // 是否处于分片消息中（等待continuation帧）
+
+	inHandshake bool   // 是否仍在HTTP握手阶段
+	tail        []byte // 握手阶段上一块数据的末尾，用于识别跨块的\r\n\r\n
+
+	header    []byte // 当前帧已收到的帧头字节
+	inPayload bool   // 帧头是否已完整
+	fin       bool   // FIN标志
+	rsv       byte   // RSV1-3标志位
+	opcode    byte   // 操作码
+	length    int64  // 载荷长度
+	maskKey   []byte // 掩码密钥，未掩码时为nil
+	remaining int64  // 尚未经过的载荷字节数
+	preview   []byte // 载荷前缀（已去掩码）
+}
+
+// newFrameTracer 创建一个方向的帧追踪器
 //
 // 参数说明：
-//   - ctx: 上下文，用于取消操作和超时控制
-//   - err: 触发重置的原始错误
-//
-// 返回值：
-//   - error: 重置失败时的错误信息，成功时返回nil
-//
-// 重置逻辑：
-//  1. 记录重置操作开始
-//  2. 清理恢复历史，给连接一个新的开始
-//  3. 等待短暂时间让系统稳定
-//  4. 支持通过context取消重置
-//
-// 适用场景：
-//   - 读写超时导致的状态异常
-//   - 连接状态不一致
-//   - 需要清理历史状态的错误
-//
-// 重置效果：
-//   - 清空所有错误类型的重试历史
-//   - 给连接一个全新的开始
-//   - 避免历史错误影响后续操作
-func (der *DefaultErrorRecovery) resetOperation(ctx context.Context, err error) error {
-	// 第一步：记录重置操作开始
-	log.Printf("🔄 执行重置恢复策略: %v", err)
+//   - direction: 方向标识，用于日志显示
+//   - trace: 是否记录每个帧
+//   - report: 协议违规回调，只应为接收方向设置，nil表示不检查
+func newFrameTracer(direction string, trace bool, report func(kind, detail string)) *frameTracer {
+	return &frameTracer{direction: direction, trace: trace, report: report, inHandshake: true}
+}
 
-	// 第二步：清理恢复历史，给连接一个新的开始
-	der.mu.Lock()
-	der.recoveryHistory = make(map[string]int) // 重新初始化历史记录
-	der.mu.Unlock()
+// feed 处理一段流数据
+func (ft *frameTracer) feed(p []byte) {
+	for len(p) > 0 {
+		if ft.inHandshake {
+			combined := append(ft.tail, p...)
+			idx := bytes.Index(combined, []byte("\r\n\r\n"))
+			if idx < 0 {
+				ft.tail = bytes.Clone(combined[max(len(combined)-3, 0):])
+				return
+			}
+			p = p[idx+4-len(ft.tail):]
+			ft.inHandshake, ft.tail = false, nil
+			continue
+		}
 
-	// 第三步：等待短暂时间让系统稳定
-	select {
-	case <-ctx.Done():
-		return ctx.Err() // 被取消，返回context错误
-	case <-time.After(time.Second):
-		// 重置延迟完成，系统已稳定
+		if ft.inPayload {
+			n := int(min(ft.remaining, int64(len(p))))
+			offset := ft.length - ft.remaining
+			for i := 0; i < n && len(ft.preview) < frameTracePreviewSize; i++ {
+				b := p[i]
+				if ft.maskKey != nil {
+					b ^= ft.maskKey[(offset+int64(i))%4]
+				}
+				ft.preview = append(ft.preview, b)
+			}
+			ft.remaining -= int64(n)
+			p = p[n:]
+			if ft.remaining == 0 {
+				ft.emit()
+			}
+			continue
+		}
+
+		ft.header = append(ft.header, p[0])
+		p = p[1:]
+		if need := frameHeaderSize(ft.header); need > 0 && len(ft.header) == need {
+			ft.parseHeader()
+			ft.checkHeader()
+			if ft.remaining == 0 {
+				ft.emit()
+			} else {
+				ft.inPayload = true
+			}
+		}
 	}
+}
 
-	// 第四步：记录重置完成
-	log.Printf("✅ 连接状态重置完成")
-	return nil
+// frameHeaderSize 根据已收到的帧头字节计算完整帧头长度，字节不足以判断时返回0
+func frameHeaderSize(header []byte) int {
+	if len(header) < 2 {
+		return 0
+	}
+	size := 2
+	switch header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if header[1]&0x80 != 0 {
+		size += 4
+	}
+	return size
 }
 
-// fallbackOperation 降级操作 - 实际实现降级策略
-// 这个私有方法实现降级恢复策略，适用于持续失败的错误
+// parseHeader 解析完整的帧头
+func (ft *frameTracer) parseHeader() {
+	h := ft.header
+	ft.fin = h[0]&0x80 != 0
+	ft.rsv = (h[0] >> 4) & 0x07
+	ft.opcode = h[0] & 0x0f
+	pos := 2
+	switch h[1] & 0x7f {
+	case 126:
+		ft.length = int64(binary.BigEndian.Uint16(h[2:4]))
+		pos = 4
+	case 127:
+		ft.length = int64(binary.BigEndian.Uint64(h[2:10]) & math.MaxInt64)
+		pos = 10
+	default:
+		ft.length = int64(h[1] & 0x7f)
+	}
+	ft.maskKey = nil
+	if h[1]&0x80 != 0 {
+		ft.maskKey = bytes.Clone(h[pos : pos+4])
+	}
+	ft.remaining = ft.length
+	ft.preview = ft.preview[:0]
+}
+
+// 协议违规类型，用于日志、统计和指标标签
+const (
+	ViolationReservedBits           = "reserved_bits"            // 未协商扩展时设置了RSV1-3
+	ViolationMaskedFrame            = "masked_frame"             // 服务器发送了带掩码的帧
+	ViolationReservedOpcode         = "reserved_opcode"          // 使用了保留的操作码
+	ViolationControlTooLarge        = "control_frame_too_large"  // 控制帧载荷超过125字节
+	ViolationFragmentedControl      = "fragmented_control_frame" // 控制帧未设置FIN
+	ViolationUnexpectedContinuation = "unexpected_continuation"  // 没有未完成的分片消息时收到continuation帧
+	ViolationInterleavedMessage     = "interleaved_message"      // 分片消息未结束时开始了新的数据帧
+	ViolationInvalidUTF8            = "invalid_utf8"             // 文本消息不是有效的UTF-8
+)
+
+// checkHeader 按RFC 6455第5节检查刚解析完的帧头，发现违规时调用report
+// 客户端不协商任何扩展，因此任何RSV位都视为违规
+func (ft *frameTracer) checkHeader() {
+	if ft.report == nil {
+		return
+	}
+	if ft.rsv != 0 {
+		ft.report(ViolationReservedBits, fmt.Sprintf("RSV=%03b，但未协商任何扩展", ft.rsv))
+	}
+	if ft.maskKey != nil {
+		ft.report(ViolationMaskedFrame, "服务器发送的帧不能使用掩码")
+	}
+
+	switch {
+	case frameOpcodeName(ft.opcode) == "reserved":
+		ft.report(ViolationReservedOpcode, fmt.Sprintf("操作码0x%x是保留值", ft.opcode))
+	case ft.opcode >= 0x8:
+		if ft.length > 125 {
+			ft.report(ViolationControlTooLarge, fmt.Sprintf("%s帧载荷%d字节，超过125字节上限", frameOpcodeName(ft.opcode), ft.length))
+		}
+		if !ft.fin {
+			ft.report(ViolationFragmentedControl, fmt.Sprintf("%s帧未设置FIN", frameOpcodeName(ft.opcode)))
+		}
+	case ft.opcode == 0x0:
+		if !ft.fragment {
+			ft.report(ViolationUnexpectedContinuation, "没有未完成的分片消息")
+		}
+		ft.fragment = !ft.fin
+	default:
+		if ft.fragment {
+			ft.report(ViolationInterleavedMessage, fmt.Sprintf("上一条分片消息未结束时收到%s帧", frameOpcodeName(ft.opcode)))
+		}
+		ft.fragment = !ft.fin
+	}
+}
+
+// emit 记录一个完整的帧并重置解析状态
+func (ft *frameTracer) emit() {
+	defer func() {
+		ft.header = ft.header[:0]
+		ft.inPayload = false
+	}()
+	if !ft.trace {
+		return
+	}
+	masked := "否"
+	if ft.maskKey != nil {
+		masked = "是(" + hex.EncodeToString(ft.maskKey) + ")"
+	}
+	more := ""
+	if ft.length > int64(len(ft.preview)) {
+		more = " ..."
+	}
+	log.Printf(tr("🔬 %s 帧 opcode=0x%x(%s) FIN=%t RSV=%03b 长度=%d 掩码=%s 数据=[% x%s]"),
+		ft.direction, ft.opcode, frameOpcodeName(ft.opcode), ft.fin, ft.rsv, ft.length, masked, ft.preview, more)
+}
+
+// frameOpcodeName 返回帧操作码名称
+func frameOpcodeName(opcode byte) string {
+	switch opcode {
+	case 0x0:
+		return "continuation"
+	case 0x1:
+		return "text"
+	case 0x2:
+		return "binary"
+	case 0x8:
+		return "close"
+	case 0x9:
+		return "ping"
+	case 0xA:
+		return "pong"
+	default:
+		return "reserved"
+	}
+}
+
+// frameTracingConn 在读写时追踪WebSocket帧的net.Conn包装
+type frameTracingConn struct {
+	net.Conn
+	readTracer  *frameTracer // 接收方向追踪器，只在读取goroutine中使用
+	writeTracer *frameTracer // 发送方向追踪器，受writeMu保护
+	writeMu     sync.Mutex   // 控制帧可能与数据帧并发写入
+}
+
+// Read 读取数据并追踪接收的帧
+func (fc *frameTracingConn) Read(p []byte) (int, error) {
+	n, err := fc.Conn.Read(p)
+	if n > 0 {
+		fc.readTracer.feed(p[:n])
+	}
+	return n, err
+}
+
+// Write 写入数据并追踪发送的帧
+func (fc *frameTracingConn) Write(p []byte) (int, error) {
+	n, err := fc.Conn.Write(p)
+	if n > 0 {
+		fc.writeMu.Lock()
+		fc.writeTracer.feed(p[:n])
+		fc.writeMu.Unlock()
+	}
+	return n, err
+}
+
+// newFrameTracingConn 包装连接以追踪两个方向的帧
 //
 // 参数说明：
-//   - _: 上下文（此方法不需要context，使用_忽略）
-//   - err: 触发降级的原始错误
-//
-// 返回值：
-//   - error: 降级失败时的错误信息，成功时返回nil
-//
-// 降级逻辑：
-//  1. 记录降级操作开始
-//  2. 增加重试延迟（翻倍，最大30秒）
-//  3. 减少最大重试次数（减半，最少1次）
-//  4. 记录新的配置参数
-//
-// 适用场景：
-//   - 消息过大等无法通过重试解决的错误
-//   - 持续失败需要降低频率的情况
-//   - 系统负载过高需要减压的场景
-//
-// 降级效果：
-//   - 延迟翻倍：减少重试频率，降低系统压力
-//   - 重试次数减半：避免过度重试
-//   - 保留最少1次重试：确保基本的恢复能力
-func (der *DefaultErrorRecovery) fallbackOperation(_ context.Context, err error) error {
-	// 第一步：记录降级操作开始
-	log.Printf("⬇️ 执行降级恢复策略: %v", err)
+//   - conn: 底层连接（wss://时为TLS连接）
+//   - trace: 是否记录每个帧
+//   - report: 接收方向的协议违规回调，nil表示不检查
+func newFrameTracingConn(conn net.Conn, trace bool, report func(kind, detail string)) net.Conn {
+	return &frameTracingConn{
+		Conn:        conn,
+		readTracer:  newFrameTracer("← 接收", trace, report),
+		writeTracer: newFrameTracer("→ 发送", trace, nil),
+	}
+}
 
-	// 第二步：调整恢复参数（降级策略）
-	der.mu.Lock()
-	der.retryDelay = der.retryDelay * 2                  // 延迟翻倍，减少重试频率
-	der.retryDelay = min(der.retryDelay, 30*time.Second) // 使用现代Go的min函数，限制最大延迟
-	der.maxRetries = max(der.maxRetries/2, 1)            // 使用现代Go的max函数，重试次数减半但至少保留1次
-	der.mu.Unlock()
+// frameViolationReporterKey 上下文键，对应的值是严格模式的协议违规回调
+type frameViolationReporterKey struct{}
 
-	// 第三步：记录降级完成和新配置
-	log.Printf("✅ 降级策略执行完成: 新延迟=%v, 新重试次数=%d", der.retryDelay, der.maxRetries)
-	return nil
+// withFrameViolationReporter 在拨号上下文中挂载协议违规回调
+// 帧检查在连接器的拨号函数中完成，调用方通过上下文接收违规，Connector接口保持不变
+func withFrameViolationReporter(ctx context.Context, report func(kind, detail string)) context.Context {
+	return context.WithValue(ctx, frameViolationReporterKey{}, report)
 }
 
-// DefaultHealthChecker 默认健康检查器实现
-// 这个结构体实现了HealthChecker接口，提供全面的系统健康检查功能
-// 支持组件级别的健康检查、指标收集和状态监控
-//
-// 主要功能：
-//  1. 组件检查：注册和执行各种组件的健康检查
-//  2. 状态聚合：将多个组件状态聚合为整体健康状态
-//  3. 指标收集：收集检查时间、错误计数等指标
-//  4. 历史跟踪：记录检查历史和运行时间
-//  5. 并发安全：支持多goroutine并发访问
+// frameViolationReporter 返回严格模式下的协议违规回调
+// 上下文中没有挂载回调时只记录日志
+func frameViolationReporter(ctx context.Context, config *ClientConfig) func(kind, detail string) {
+	if !config.Strict {
+		return nil
+	}
+	if report, ok := ctx.Value(frameViolationReporterKey{}).(func(kind, detail string)); ok {
+		return report
+	}
+	return func(kind, detail string) {
+		log.Printf(tr("🚨 协议违规 [%s]: %s"), kind, detail)
+	}
+}
+
+// newFrameTracingDialers 创建带帧追踪的拨号函数
+// 供--trace-frames和--strict共用；帧追踪需要看到明文，因此wss://连接改为在NetDialTLSContext中自行完成TLS握手，
+// 并把追踪包装放在TLS层之上；握手仍会触发httptrace的TLS钩子，连接阶段耗时照常统计
 //
-// 健康状态级别：
-//   - HealthHealthy: 所有组件正常
-//   - HealthDegraded: 部分组件异常但系统可用
-//   - HealthUnhealthy: 多个组件异常，系统不可用
-//   - HealthUnknown: 未进行检查或检查失败
+// 参数说明：
+//   - config: 客户端配置
+//   - base: 底层TCP拨号函数，nil时使用默认TCP拨号
+//   - tlsConfig: wss://连接使用的TLS配置，可以为nil
 //
-// 使用场景：
-//   - 微服务健康检查端点
-//   - 负载均衡器健康探测
-//   - 监控系统状态收集
-//   - 自动故障恢复决策
-type DefaultHealthChecker struct {
-	checks    map[string]func() error // 注册的健康检查函数：key为组件名，value为检查函数
-	metrics   HealthMetrics           // 健康检查指标：包含状态、时间、计数等信息
-	startTime time.Time               // 启动时间：用于计算运行时长
-	mu        sync.RWMutex            // 读写锁：保护并发访问
+// 返回值：
+//   - dial: 供NetDialContext使用的ws://拨号函数
+//   - dialTLS: 供NetDialTLSContext使用的wss://拨号函数
+func newFrameTracingDialers(config *ClientConfig, base func(ctx context.Context, network, addr string) (net.Conn, error), tlsConfig *tls.Config) (dial, dialTLS func(ctx context.Context, network, addr string) (net.Conn, error)) {
+	if base == nil {
+		netDialer := &net.Dialer{Timeout: config.tcpDialTimeout()}
+		base = netDialer.DialContext
+	}
+
+	dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := base(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return newFrameTracingConn(conn, config.TraceFrames, frameViolationReporter(ctx, config)), nil
+	}
+
+	dialTLS = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		rawConn, err := base(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			if host, _, splitErr := net.SplitHostPort(addr); splitErr == nil {
+				cfg.ServerName = host
+			}
+		}
+
+		tlsConn := tls.Client(rawConn, cfg)
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		err = tlsConn.HandshakeContext(ctx)
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+		}
+		if err != nil {
+			_ = rawConn.Close()
+			return nil, err
+		}
+		return newFrameTracingConn(tlsConn, config.TraceFrames, frameViolationReporter(ctx, config)), nil
+	}
+	return dial, dialTLS
 }
 
-// NewDefaultHealthChecker 创建默认健康检查器
-// 这是DefaultHealthChecker的构造函数，初始化健康检查器和相关指标
+// parseBandwidth 解析带宽字符串，返回比特/秒
+// 支持的单位（不区分大小写，十进制）：bps、kbps、mbps、gbps，不带单位时按bps处理
+func parseBandwidth(value string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		factor float64
+	}{{"gbps", 1e9}, {"mbps", 1e6}, {"kbps", 1e3}, {"bps", 1}} {
+		if number, ok := strings.CutSuffix(lower, unit.suffix); ok {
+			lower, multiplier = number, unit.factor
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(lower), 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) || number <= 0 {
+		return 0, fmt.Errorf(tr("无效的带宽 '%s' (例如 512kbps、1mbps)"), value)
+	}
+	bps := number * multiplier
+	if bps < 8 {
+		return 0, fmt.Errorf(tr("带宽 '%s' 过低，至少为8bps"), value)
+	}
+	return int64(bps), nil
+}
+
+// formatBandwidth 把比特/秒格式化为易读的带宽字符串
+func formatBandwidth(bps int64) string {
+	switch {
+	case bps <= 0:
+		return "不限"
+	case bps >= 1e9:
+		return fmt.Sprintf("%.4ggbps", float64(bps)/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.4gmbps", float64(bps)/1e6)
+	case bps >= 1e3:
+		return fmt.Sprintf("%.4gkbps", float64(bps)/1e3)
+	default:
+		return fmt.Sprintf("%dbps", bps)
+	}
+}
+
+// Disconnect 实现连接器接口
+// 这个方法优雅地断开WebSocket连接，遵循WebSocket协议规范
+//
+// 参数说明：
+//   - conn: 要断开的WebSocket连接，可以为nil
 //
 // 返回值：
-//   - *DefaultHealthChecker: 初始化完成的健康检查器实例
+//   - error: 断开连接时的错误，如果连接为nil则返回nil
 //
-// 初始化内容：
-//   - 健康检查函数映射：预分配5个容量，适合大多数应用
-//   - 启动时间记录：用于计算系统运行时长
-//   - 初始指标：设置为未知状态，等待首次检查
-//   - 组件状态映射：预分配10个容量，支持多组件监控
+// 断开流程：
+//  1. 检查连接是否为nil（防御性编程）
+//  2. 发送WebSocket关闭消息（协议要求）
+//  3. 关闭底层TCP连接
 //
-// 使用示例：
+// 协议遵循：
+//   - 发送CloseNormalClosure状态码，表示正常关闭
+//   - 包含关闭原因，便于服务器理解
+//   - 即使发送关闭消息失败，也会继续关闭连接
 //
-//	checker := NewDefaultHealthChecker()
-//	checker.RegisterHealthCheck("database", func() error {
-//	    return db.Ping()
-//	})
-//	status := checker.CheckHealth(ctx)
-func NewDefaultHealthChecker() *DefaultHealthChecker {
-	return &DefaultHealthChecker{
-		checks:    make(map[string]func() error, 5), // 预分配容量，优化性能
-		startTime: time.Now(),                       // 记录创建时间
-		metrics: HealthMetrics{
-			Status:          HealthUnknown,               // 初始状态为未知
-			ComponentStatus: make(map[string]string, 10), // 预分配组件状态容量
-		},
+// 错误处理：
+//   - 发送关闭消息失败不会阻止连接关闭
+//   - 记录警告日志，便于问题诊断
+//   - 返回实际的连接关闭错误
+func (dc *DefaultConnector) Disconnect(conn *websocket.Conn) error {
+	// 第一步：防御性检查，避免空指针异常
+	if conn == nil {
+		return nil
+	}
+
+	// 第二步：发送WebSocket关闭消息（协议规范）
+	err := conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "客户端主动关闭"))
+	if err != nil {
+		// 记录警告但不返回错误，继续关闭连接
+		log.Printf(tr("⚠️ 发送关闭消息失败: %v"), err)
 	}
+
+	// 第三步：关闭底层连接
+	return conn.Close()
 }
 
-// CheckHealth 实现健康检查接口
-// 这个方法执行所有注册的健康检查，并聚合结果为整体健康状态
+// IsHealthy 实现连接器接口
+// 这个方法通过发送ping消息来检查WebSocket连接的健康状态
 //
 // 参数说明：
-//   - ctx: 上下文，用于取消操作和超时控制（当前实现未使用）
+//   - conn: 要检查的WebSocket连接
 //
 // 返回值：
-//   - HealthStatus: 整体健康状态
+//   - bool: true表示连接健康，false表示连接有问题
 //
-// 检查流程：
-//  1. 初始化检查状态和计数器
-//  2. 遍历执行所有注册的健康检查函数
-//  3. 根据检查结果调整整体状态
-//  4. 更新健康指标和统计信息
-//  5. 返回最终的健康状态
-//
-// 状态聚合逻辑：
-//   - 所有组件正常 -> HealthHealthy
-//   - 部分组件异常 -> HealthDegraded
-//   - 多个组件异常 -> HealthUnhealthy
-//
-// 并发安全：使用写锁保护整个检查过程
-func (dhc *DefaultHealthChecker) CheckHealth(ctx context.Context) HealthStatus {
-	// 使用写锁保护整个检查过程
-	dhc.mu.Lock()
-	defer dhc.mu.Unlock()
-
-	// 第一步：初始化检查状态和计数器
-	startTime := time.Now()
-	overallStatus := HealthHealthy // 初始假设所有组件都健康
-	errorCount := int64(0)
-	warningCount := int64(0)
-
-	// 第二步：执行所有注册的健康检查
-	for name, checker := range dhc.checks {
-		if err := checker(); err != nil {
-			// 组件检查失败，记录错误信息
-			dhc.metrics.ComponentStatus[name] = fmt.Sprintf("错误: %v", err)
-			errorCount++
-
-			// 第三步：根据错误严重程度调整整体状态
-			if overallStatus == HealthHealthy {
-				// 第一个错误：从健康降级为部分可用
-				overallStatus = HealthDegraded
-			} else if overallStatus == HealthDegraded {
-				// 多个错误：从部分可用降级为不健康
-				overallStatus = HealthUnhealthy
-			}
-			// 如果已经是HealthUnhealthy，保持不变
-		} else {
-			// 组件检查成功，记录正常状态
-			dhc.metrics.ComponentStatus[name] = "正常"
-		}
-	}
-
-	// 第四步：更新健康检查指标
-	dhc.metrics.Status = overallStatus                              // 整体健康状态
-	dhc.metrics.LastCheckTime = startTime                           // 最后检查时间
-	dhc.metrics.CheckDuration = time.Since(startTime)               // 检查耗时
-	dhc.metrics.ErrorCount = errorCount                             // 错误计数
-	dhc.metrics.WarningCount = warningCount                         // 警告计数
-	dhc.metrics.UptimeSeconds = time.Since(dhc.startTime).Seconds() // 运行时长
-
-	// 第五步：返回最终的健康状态
-	return overallStatus
-}
-
-// GetHealthMetrics 实现健康检查接口
-// 这个方法返回当前的健康检查指标，包含详细的状态信息
+// 检查方法：
+//   - 使用WebSocket ping消息进行活跃性检测
+//   - 设置5秒超时，避免长时间阻塞
+//   - 不等待pong响应，只检查发送是否成功
 //
-// 返回值：
-//   - HealthMetrics: 健康检查指标的深拷贝
+// 健康标准：
+//   - 连接不为nil
+//   - 能够成功发送ping消息
+//   - 没有网络错误或连接错误
 //
-// 返回的指标包含：
-//   - Status: 整体健康状态
-//   - LastCheckTime: 最后检查时间
-//   - CheckDuration: 检查耗时
-//   - ErrorCount: 错误计数
-//   - WarningCount: 警告计数
-//   - UptimeSeconds: 运行时长（秒）
-//   - ComponentStatus: 各组件的详细状态
+// 使用场景：
+//   - 定期健康检查
+//   - 重连前的状态验证
+//   - 负载均衡的连接选择
 //
-// 并发安全：使用读锁保护数据访问
-// 数据安全：返回深拷贝，避免外部修改影响内部状态
-func (dhc *DefaultHealthChecker) GetHealthMetrics() HealthMetrics {
-	// 使用读锁保护数据访问
-	dhc.mu.RLock()
-	defer dhc.mu.RUnlock()
-
-	// 创建指标的深拷贝，避免外部修改影响内部状态
-	metrics := dhc.metrics
-	metrics.ComponentStatus = make(map[string]string)
-	for k, v := range dhc.metrics.ComponentStatus {
-		metrics.ComponentStatus[k] = v // 逐个复制组件状态
+// 性能考虑：
+//   - 使用WriteControl而不是WriteMessage，更高效
+//   - 设置合理的超时时间，避免阻塞
+//   - 不等待响应，减少检查延迟
+func (dc *DefaultConnector) IsHealthy(conn *websocket.Conn) bool {
+	// 第一步：检查连接是否存在
+	if conn == nil {
+		return false
 	}
 
-	return metrics
-}
-
-// RegisterHealthCheck 实现健康检查接口
-// 这个方法注册一个新的健康检查函数，用于监控特定组件
-//
-// 参数说明：
-//   - name: 组件名称，用于标识和显示
-//   - checker: 健康检查函数，返回nil表示健康，返回error表示异常
-//
-// 注册说明：
-//   - 组件名称应该具有描述性，如"database"、"redis"、"external_api"
-//   - 检查函数应该快速执行，避免阻塞健康检查
-//   - 检查函数应该返回有意义的错误信息
-//   - 相同名称的组件会覆盖之前的注册
-//
-// 使用示例：
-//
-//	checker.RegisterHealthCheck("database", func() error {
-//	    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-//	    defer cancel()
-//	    return db.PingContext(ctx)
-//	})
-//
-// 并发安全：使用写锁保护注册操作
-func (dhc *DefaultHealthChecker) RegisterHealthCheck(name string, checker func() error) {
-	// 使用写锁保护注册操作
-	dhc.mu.Lock()
-	defer dhc.mu.Unlock()
-
-	// 注册健康检查函数
-	dhc.checks[name] = checker
+	// 第二步：尝试发送ping消息检查连接活跃性
+	// 使用5秒超时，在性能和可靠性之间平衡
+	err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
+	return err == nil // 发送成功表示连接健康
 }
 
-// DefaultMetricsCollector 默认指标收集器实现
-// 这个结构体实现了MetricsCollector接口，提供基础的指标收集功能
-// 支持计数器、直方图和自定义指标的收集和存储
+// DefaultMessageProcessor 默认消息处理器实现
+// 这个结构体实现了MessageProcessor接口，提供标准的消息处理功能
+// 支持消息验证、格式化、大小限制和可选的JSON验证
 //
 // 主要功能：
-//  1. 指标记录：记录各种类型的指标数据
-//  2. 计数器：支持递增计数器操作
-//  3. 直方图：记录数值分布和统计信息
-//  4. 标签支持：支持带标签的多维指标
-//  5. 并发安全：支持多goroutine并发访问
-//
-// 指标类型：
-//   - 计数器：累计递增的数值，如请求总数
-//   - 直方图：数值分布统计，如响应时间分布
-//   - 自定义指标：任意类型的指标数据
-//
-// 存储格式：
-//   - 无标签指标：直接使用指标名作为key
-//   - 有标签指标：使用"指标名{标签}"格式作为key
+//  1. 消息验证：检查消息类型和大小
+//  2. 消息处理：记录和处理不同类型的消息
+//  3. 消息格式化：对消息进行基本的格式化处理
+//  4. JSON验证：可选的JSON格式验证（文本消息）
+//  5. 大小限制：防止过大消息导致内存问题
 //
-// 使用场景：
-//   - Prometheus指标收集
-//   - 应用性能监控
-//   - 业务指标统计
-//   - 系统运行状态监控
-type DefaultMetricsCollector struct {
-	metrics map[string]any // 指标存储：key为指标名（可能包含标签），value为指标值
-	mu      sync.RWMutex   // 读写锁：保护并发访问
+// 设计特点：
+//   - 类型安全：严格的消息类型检查
+//   - 性能优化：避免不必要的字符串转换
+//   - 可配置：支持自定义消息大小限制和验证选项
+//   - 扩展性：易于扩展支持更多消息格式
+type DefaultMessageProcessor struct {
+	maxMessageSize int  // 最大消息大小限制（字节）
+	validateJSON   bool // 是否启用JSON格式验证
+	hexDump        bool // 是否完整输出二进制消息的十六进制转储（--hexdump）
 }
 
-// NewDefaultMetricsCollector 创建默认指标收集器
-// 这是DefaultMetricsCollector的构造函数，初始化指标存储
+// NewDefaultMessageProcessor 创建默认消息处理器
+// 这是DefaultMessageProcessor的构造函数，配置消息处理参数
+//
+// 参数说明：
+//   - maxSize: 最大消息大小限制（字节），防止内存溢出
+//   - validateJSON: 是否对文本消息进行JSON格式验证
 //
 // 返回值：
-//   - *DefaultMetricsCollector: 初始化完成的指标收集器实例
+//   - *DefaultMessageProcessor: 配置好的消息处理器实例
 //
-// 初始化内容：
-//   - 指标映射：用于存储各种类型的指标数据
-//   - 读写锁：确保并发安全访问
+// 配置建议：
+//   - maxSize: 建议设置为32KB，平衡功能和安全
+//   - validateJSON: 开发环境可启用，生产环境根据需要
 //
 // 使用示例：
 //
-//	collector := NewDefaultMetricsCollector()
-//	collector.IncrementCounter("requests_total", map[string]string{"method": "GET"})
-//	collector.RecordMetric("response_time", 0.123, nil)
-func NewDefaultMetricsCollector() *DefaultMetricsCollector {
-	return &DefaultMetricsCollector{
-		metrics: make(map[string]any), // 初始化指标存储
+//	processor := NewDefaultMessageProcessor(32768, false)
+//	err := processor.ProcessMessage(websocket.TextMessage, data)
+func NewDefaultMessageProcessor(maxSize int, validateJSON bool) *DefaultMessageProcessor {
+	return &DefaultMessageProcessor{
+		maxMessageSize: maxSize,      // 设置消息大小限制
+		validateJSON:   validateJSON, // 设置JSON验证选项
 	}
 }
 
-// RecordMetric 实现指标收集器接口
-// 这个方法记录一个指标值，支持带标签的多维指标
+// ProcessMessage 实现消息处理器接口
+// 这个方法处理接收到的WebSocket消息，包括验证和记录
 //
 // 参数说明：
-//   - name: 指标名称，应该具有描述性
-//   - value: 指标值，支持任意浮点数
-//   - labels: 指标标签，用于多维度分类，可以为nil
+//   - messageType: WebSocket消息类型（TextMessage、BinaryMessage等）
+//   - data: 消息内容的字节数组
 //
-// 存储逻辑：
-//   - 无标签：直接使用指标名作为key
-//   - 有标签：使用"指标名{标签}"格式作为key
-//   - 覆盖存储：相同key的指标会被覆盖
+// 返回值：
+//   - error: 处理失败时的错误信息
 //
-// 使用示例：
+// 处理流程：
+//  1. 消息验证：检查消息类型和大小
+//  2. 消息记录：根据类型记录不同的日志
+//  3. 错误处理：验证失败时返回详细错误
 //
-//	collector.RecordMetric("response_time", 0.123, map[string]string{"endpoint": "/api/users"})
-//	collector.RecordMetric("cpu_usage", 75.5, nil)
+// 支持的消息类型：
+//   - TextMessage: 文本消息，记录完整内容
+//   - BinaryMessage: 二进制消息，记录大小
+//   - PingMessage: Ping消息，记录接收事件
+//   - PongMessage: Pong消息，记录接收事件
+//   - 其他类型: 记录为未知类型
 //
-// 并发安全：使用写锁保护存储操作
-func (dmc *DefaultMetricsCollector) RecordMetric(name string, value float64, labels map[string]string) {
-	dmc.mu.Lock()
-	defer dmc.mu.Unlock()
-
-	// 构建存储key
-	key := name
-	if len(labels) > 0 {
-		key = fmt.Sprintf("%s{%v}", name, labels)
+// 性能优化：
+//   - 先验证后处理，避免无效消息的处理开销
+//   - 分离日志记录逻辑，便于优化和测试
+func (dmp *DefaultMessageProcessor) ProcessMessage(messageType int, data []byte) error {
+	// 第一步：基本验证，确保消息有效
+	if err := dmp.ValidateMessage(messageType, data); err != nil {
+		return fmt.Errorf(tr("消息验证失败: %w"), err)
 	}
 
-	// 存储指标值
-	dmc.metrics[key] = value
+	// 第二步：记录消息（优化字符串转换）
+	dmp.logProcessedMessage(messageType, data)
+	return nil
 }
 
-// IncrementCounter 实现指标收集器接口
-// 这个方法递增一个计数器指标，适用于累计计数场景
+// logProcessedMessage 记录处理的消息（避免重复字符串转换）
+// 这个方法根据消息类型记录不同格式的日志，优化性能和可读性
 //
 // 参数说明：
-//   - name: 计数器名称，应该以"_total"结尾
-//   - labels: 计数器标签，用于多维度分类，可以为nil
-//
-// 递增逻辑：
-//   - 如果计数器存在：当前值+1
-//   - 如果计数器不存在：初始化为1
-//   - 如果存储的值不是数字：重置为1
-//
-// 使用示例：
+//   - messageType: WebSocket消息类型
+//   - data: 消息内容的字节数组
 //
-//	collector.IncrementCounter("requests_total", map[string]string{"method": "GET", "status": "200"})
-//	collector.IncrementCounter("errors_total", nil)
+// 日志格式：
+//   - 文本消息：显示完整内容，便于调试
+//   - 二进制消息：只显示大小，避免乱码
+//   - 控制消息：显示消息类型，便于协议调试
+//   - 未知消息：显示类型码，便于问题诊断
 //
-// 并发安全：使用写锁保护递增操作
-func (dmc *DefaultMetricsCollector) IncrementCounter(name string, labels map[string]string) {
-	dmc.mu.Lock()
-	defer dmc.mu.Unlock()
-
-	// 构建存储key
-	key := name
-	if len(labels) > 0 {
-		key = fmt.Sprintf("%s{%v}", name, labels)
-	}
-
-	// 递增计数器
-	if val, exists := dmc.metrics[key]; exists {
-		if counter, ok := val.(float64); ok {
-			dmc.metrics[key] = counter + 1 // 递增现有计数器
+// 性能考虑：
+//   - 只在需要时进行字符串转换
+//   - 使用switch语句提高分支效率
+//   - 避免不必要的格式化操作
+func (dmp *DefaultMessageProcessor) logProcessedMessage(messageType int, data []byte) {
+	switch messageType {
+	case websocket.TextMessage:
+		// 文本消息：显示完整内容，便于调试
+		log.Printf(tr("📥 收到文本消息: %s"), string(data))
+	case websocket.BinaryMessage:
+		// 二进制消息：默认只显示大小，避免乱码输出；--hexdump时附带完整转储
+		if dmp.hexDump {
+			log.Printf(tr("📥 收到二进制消息: %d 字节\n%s"), len(data), hex.Dump(data))
 		} else {
-			dmc.metrics[key] = float64(1) // 重置无效值
+			log.Printf(tr("📥 收到二进制消息: %d 字节"), len(data))
 		}
-	} else {
-		dmc.metrics[key] = float64(1) // 初始化新计数器
+	case websocket.PingMessage:
+		// Ping消息：协议级别的心跳检测
+		log.Print(tr("📡 收到ping消息"))
+	case websocket.PongMessage:
+		// Pong消息：对ping的响应
+		log.Print(tr("📡 收到pong消息"))
+	default:
+		// 未知类型：记录类型码便于问题诊断
+		log.Printf(tr("📥 收到未知类型消息: %d"), messageType)
 	}
 }
 
-// RecordHistogram 实现指标收集器接口
-// 这个方法记录直方图指标，用于统计数值分布
+// FormatMessage 实现消息处理器接口
+// 这个方法对消息进行基本的格式化处理，确保消息符合发送要求
 //
 // 参数说明：
-//   - name: 直方图名称，会自动添加"_histogram"后缀
-//   - value: 要记录的数值
-//   - labels: 直方图标签，用于多维度分类，可以为nil
+//   - data: 要格式化的消息内容字节数组
 //
-// 存储逻辑：
-//   - 自动添加"_histogram"后缀区分普通指标
-//   - 简化实现：只存储最新值（生产环境应使用更复杂的直方图）
-//   - 支持标签分类
+// 返回值：
+//   - []byte: 格式化后的消息内容
+//   - error: 格式化失败时的错误信息
 //
-// 使用示例：
+// 格式化检查：
+//  1. 空消息检查：确保消息不为空
+//  2. 大小限制：确保消息不超过最大大小限制
+//  3. 内容验证：可扩展的内容验证逻辑
 //
-//	collector.RecordHistogram("request_duration", 0.123, map[string]string{"endpoint": "/api"})
-//	collector.RecordHistogram("message_size", 1024, nil)
+// 扩展性：
+//   - 可以添加消息编码转换
+//   - 可以添加消息压缩功能
+//   - 可以添加消息加密功能
+//   - 可以添加自定义格式化规则
 //
-// 并发安全：使用写锁保护存储操作
-func (dmc *DefaultMetricsCollector) RecordHistogram(name string, value float64, labels map[string]string) {
-	dmc.mu.Lock()
-	defer dmc.mu.Unlock()
+// 使用场景：
+//   - 发送消息前的预处理
+//   - 消息内容的标准化
+//   - 消息安全检查
+func (dmp *DefaultMessageProcessor) FormatMessage(data []byte) ([]byte, error) {
+	// 第一步：检查消息是否为空
+	if len(data) == 0 {
+		return nil, errors.New(tr("消息内容不能为空"))
+	}
 
-	// 构建直方图key（添加后缀区分）
-	key := fmt.Sprintf("%s_histogram", name)
-	if len(labels) > 0 {
-		key = fmt.Sprintf("%s{%v}", key, labels)
+	// 第二步：检查消息大小是否超过限制
+	if len(data) > dmp.maxMessageSize {
+		return nil, fmt.Errorf(tr("消息大小 %d 超过限制 %d"), len(data), dmp.maxMessageSize)
 	}
 
-	// 简单的直方图实现，存储最新值
-	// 注意：生产环境应该使用更复杂的直方图实现，如分桶统计
-	dmc.metrics[key] = value
+	// 第三步：返回格式化后的消息（当前为直接返回，可扩展）
+	return data, nil
 }
 
-// GetMetrics 实现指标收集器接口
-// 这个方法返回所有收集的指标数据
+// ValidateMessage 实现消息处理器接口
+// 这个方法验证WebSocket消息的有效性，包括类型和内容检查
 //
-// 返回值：
-//   - map[string]any: 所有指标的深拷贝
+// 参数说明：
+//   - messageType: WebSocket消息类型常量
+//   - data: 消息内容的字节数组
 //
-// 返回格式：
-//   - key: 指标名（可能包含标签）
-//   - value: 指标值（通常是float64）
+// 返回值：
+//   - error: 验证失败时的详细错误信息，成功时返回nil
 //
-// 数据安全：
-//   - 返回深拷贝，避免外部修改影响内部状态
-//   - 使用读锁保护数据访问
+// 验证项目：
+//  1. 消息类型验证：检查是否为有效的WebSocket消息类型
+//  2. 消息大小验证：确保不超过配置的最大大小
+//  3. 内容格式验证：可选的JSON格式验证（文本消息）
 //
-// 使用场景：
-//   - Prometheus指标导出
-//   - 监控系统数据收集
-//   - 调试和诊断
+// 支持的消息类型：
+//   - TextMessage: 文本消息，UTF-8编码
+//   - BinaryMessage: 二进制消息，任意字节序列
+//   - PingMessage: Ping控制消息，用于保活
+//   - PongMessage: Pong控制消息，对Ping的响应
+//   - CloseMessage: 关闭消息，用于优雅关闭连接
 //
-// 并发安全：使用读锁保护数据访问
-func (dmc *DefaultMetricsCollector) GetMetrics() map[string]any {
-	dmc.mu.RLock()
-	defer dmc.mu.RUnlock()
-
-	// 创建深拷贝，避免外部修改
-	result := make(map[string]any)
-	for k, v := range dmc.metrics {
-		result[k] = v
+// 安全考虑：
+//   - 防止过大消息导致内存溢出
+//   - 验证消息类型防止协议攻击
+//   - 可选的内容格式验证
+func (dmp *DefaultMessageProcessor) ValidateMessage(messageType int, data []byte) error {
+	// 第一步：验证消息类型是否为WebSocket协议支持的类型
+	switch messageType {
+	case websocket.TextMessage, websocket.BinaryMessage,
+		websocket.PingMessage, websocket.PongMessage, websocket.CloseMessage:
+		// 这些都是有效的WebSocket消息类型
+	default:
+		return fmt.Errorf(tr("无效的消息类型: %d"), messageType)
 	}
-	return result
-}
-
-// DeadlockDetector 简化的死锁检测器
-// 这个结构体用于检测潜在的死锁情况，通过监控锁的持有时间来识别异常
-//
-// 检测原理：
-//   - 记录每个锁的获取时间和持有者信息
-//   - 定期检查锁的持有时间是否超过阈值
-//   - 超时的锁被认为可能导致死锁
-//
-// 使用场景：
-//   - 开发阶段的死锁检测和调试
-//   - 生产环境的异常监控
-//   - 性能分析和优化
-//
-// 并发安全：使用读写锁保护内部状态
-type DeadlockDetector struct {
-	lockHolders map[string]time.Time // 锁持有者映射：key为锁标识符，value为获取锁的时间戳
-	maxHoldTime time.Duration        // 最大持有时间：超过此时间的锁被认为可能导致死锁
-	mu          sync.RWMutex         // 读写锁：保护lockHolders映射的并发访问安全
-}
 
-// NewDeadlockDetector 创建死锁检测器
-func NewDeadlockDetector(maxHoldTime time.Duration) *DeadlockDetector {
-	return &DeadlockDetector{
-		lockHolders: make(map[string]time.Time),
-		maxHoldTime: maxHoldTime,
+	// 第二步：验证消息大小是否在允许范围内
+	if len(data) > dmp.maxMessageSize {
+		return fmt.Errorf(tr("消息大小 %d 超过限制 %d"), len(data), dmp.maxMessageSize)
 	}
-}
-
-// AcquireLock 记录锁获取
-func (dd *DeadlockDetector) AcquireLock(lockName string) {
-	dd.mu.Lock()
-	defer dd.mu.Unlock()
-	dd.lockHolders[lockName] = time.Now()
-}
-
-// ReleaseLock 记录锁释放
-func (dd *DeadlockDetector) ReleaseLock(lockName string) {
-	dd.mu.Lock()
-	defer dd.mu.Unlock()
-	delete(dd.lockHolders, lockName)
-}
-
-// CheckDeadlocks 检查潜在的死锁
-func (dd *DeadlockDetector) CheckDeadlocks() []string {
-	dd.mu.Lock()
-	defer dd.mu.Unlock()
-
-	now := time.Now()
-	var deadlocks []string
 
-	for lockName, acquireTime := range dd.lockHolders {
-		if now.Sub(acquireTime) > dd.maxHoldTime {
-			alert := fmt.Sprintf("潜在死锁: 锁 '%s' 持有时间过长 (%v)", lockName, now.Sub(acquireTime))
-			deadlocks = append(deadlocks, alert)
-		}
+	// 第三步：可选的JSON格式验证（仅对文本消息）
+	if dmp.validateJSON && messageType == websocket.TextMessage && !json.Valid(data) {
+		return errors.New(tr("文本消息不是有效的JSON"))
 	}
 
-	return deadlocks
+	// 所有验证通过
+	return nil
 }
 
-// PerformanceMonitor 性能监控器
-// 这个结构体用于监控系统的各项性能指标，提供实时的性能数据和趋势分析
+// DefaultErrorRecovery 默认错误恢复实现
+// 这个结构体实现了ErrorRecovery接口，提供智能的错误恢复策略
+// 根据错误类型自动选择最合适的恢复方法，并跟踪恢复历史
 //
-// 监控指标分类：
-//  1. 基础指标：CPU使用率、内存使用量、Goroutine数量
-//  2. 业务指标：连接数量、消息速率、错误速率
-//  3. 延迟指标：P95和P99延迟统计
-//  4. 系统指标：基于runtime.MemStats的详细内存统计
+// 主要功能：
+//  1. 错误分类：根据错误类型判断是否可恢复
+//  2. 策略选择：为不同错误选择最佳恢复策略
+//  3. 历史跟踪：记录每种错误的恢复次数
+//  4. 智能限制：防止无限重试导致资源浪费
+//  5. 动态调整：根据恢复效果调整策略参数
 //
-// 更新策略：
-//   - 系统指标：每5秒自动更新一次，避免频繁的系统调用
-//   - 业务指标：实时更新，反映当前的业务状态
-//   - 延迟指标：基于消息处理时间的统计分析
+// 恢复策略：
+//   - RecoveryRetry: 简单重试，适用于临时错误
+//   - RecoveryReconnect: 重新连接，适用于连接断开
+//   - RecoveryReset: 重置状态，适用于状态异常
+//   - RecoveryFallback: 降级处理，适用于持续失败
 //
-// 使用场景：
-//   - 实时性能监控和告警
-//   - 性能瓶颈分析和优化
-//   - 资源使用趋势分析
-//   - 容量规划和预测
+// 并发安全：使用读写锁保护共享状态，支持多goroutine并发访问
+type DefaultErrorRecovery struct {
+	maxRetries      int            // 最大重试次数：防止无限重试
+	retryDelay      time.Duration  // 重试延迟：控制重试频率
+	recoveryHistory map[string]int // 错误类型的恢复历史：key为错误类型，value为重试次数
+	mu              sync.RWMutex   // 读写锁：保护并发访问
+}
+
+// NewDefaultErrorRecovery 创建默认错误恢复器
+// 这是DefaultErrorRecovery的构造函数，初始化恢复参数和历史记录
 //
-// 并发安全：使用读写锁保护所有字段的并发访问
-type PerformanceMonitor struct {
-	// ===== 基础性能指标 =====
+// 参数说明：
+//   - maxRetries: 最大重试次数，建议设置为3-10次
+//   - retryDelay: 重试延迟时间，建议设置为1-5秒
+//
+// 返回值：
+//   - *DefaultErrorRecovery: 初始化完成的错误恢复器实例
+//
+// 配置建议：
+//   - 网络环境良好：maxRetries=3, retryDelay=1s
+//   - 网络环境一般：maxRetries=5, retryDelay=3s
+//   - 网络环境较差：maxRetries=10, retryDelay=5s
+//
+// 使用示例：
+//
+//	recovery := NewDefaultErrorRecovery(5, 3*time.Second)
+//	if recovery.CanRecover(err) {
+//	    strategy := recovery.GetRecoveryStrategy(err)
+//	    err = recovery.Recover(ctx, err)
+//	}
+func NewDefaultErrorRecovery(maxRetries int, retryDelay time.Duration) *DefaultErrorRecovery {
+	return &DefaultErrorRecovery{
+		maxRetries:      maxRetries,               // 设置最大重试次数
+		retryDelay:      retryDelay,               // 设置重试延迟
+		recoveryHistory: make(map[string]int, 10), // 预分配容量，优化性能
+	}
+}
+
+// CanRecover 实现错误恢复接口
+// 这个方法判断给定的错误是否可以通过恢复策略来解决
+//
+// 参数说明：
+//   - err: 需要判断的错误实例
+//
+// 返回值：
+//   - bool: true表示错误可恢复，false表示错误不可恢复
+//
+// 可恢复的错误类型：
+//  1. 网络错误：连接超时、网络不可达等临时网络问题
+//  2. 连接错误：连接关闭、连接失败等连接层面的问题
+//  3. 超时错误：握手超时、读写超时等时间相关的问题
+//  4. 自定义错误：ConnectionError中标记为可重试的错误
+//
+// 不可恢复的错误类型：
+//   - 认证失败：用户名密码错误
+//   - 权限错误：访问被拒绝
+//   - 协议错误：WebSocket协议违规
+//   - 配置错误：URL格式错误等
+//
+// 判断逻辑：
+//   - 使用errors.Is进行错误类型匹配
+//   - 支持错误链的深度检查
+//   - 检查自定义错误的Retry标志
+//
+// 并发安全：此方法是只读操作，可以安全地并发调用
+func (der *DefaultErrorRecovery) CanRecover(err error) bool {
+	// 第一步：空错误检查
+	if err == nil {
+		return false
+	}
+
+	// 第二步：检查是否是可恢复的错误类型
+	switch {
+	case isNetworkError(err):
+		// 网络错误通常是临时的，可以通过重连恢复
+		return true
+	case errors.Is(err, ErrConnectionClosed):
+		// 连接关闭可以通过重连恢复
+		return true
+	case errors.Is(err, ErrConnectionFailed):
+		// 连接失败可以通过重试恢复
+		return true
+	case errors.Is(err, ErrHandshakeTimeout), errors.Is(err, ErrDialTimeout):
+		// 握手超时和TCP连接超时可以通过重试恢复
+		return true
+	case errors.Is(err, ErrReadTimeout):
+		// 读取超时可以通过重置恢复
+		return true
+	case errors.Is(err, ErrWriteTimeout):
+		// 写入超时可以通过重置恢复
+		return true
+	default:
+		// 第三步：检查自定义错误类型的可恢复标志
+		if connErr, ok := err.(*ConnectionError); ok {
+			return connErr.Retry // 使用错误实例中的重试标志
+		}
+		// 其他类型的错误默认不可恢复
+		return false
+	}
+}
+
+// Recover 实现错误恢复接口
+// 这个方法执行具体的错误恢复操作，根据错误类型选择最佳恢复策略
+//
+// 参数说明：
+//   - ctx: 上下文，用于取消操作和超时控制
+//   - err: 需要恢复的错误实例
+//
+// 返回值：
+//   - error: 恢复失败时的错误信息，成功时返回nil
+//
+// 恢复流程：
+//  1. 检查错误是否可恢复
+//  2. 获取最佳恢复策略
+//  3. 执行对应的恢复操作
+//  4. 返回恢复结果
+//
+// 恢复策略执行：
+//   - RecoveryRetry: 等待一段时间后重试
+//   - RecoveryReconnect: 重新建立连接
+//   - RecoveryReset: 重置连接状态
+//   - RecoveryFallback: 降级处理
+//
+// 并发安全：可以在多个goroutine中同时调用
+// 上下文支持：支持通过context取消恢复操作
+func (der *DefaultErrorRecovery) Recover(ctx context.Context, err error) error {
+	// 第一步：检查错误是否可恢复
+	if !der.CanRecover(err) {
+		return fmt.Errorf(tr("错误不可恢复: %w"), err)
+	}
+
+	// 第二步：获取最佳恢复策略
+	strategy := der.GetRecoveryStrategy(err)
+
+	// 第三步：根据策略执行对应的恢复操作
+	switch strategy {
+	case RecoveryRetry:
+		// 执行重试恢复：等待后重试
+		return der.retryOperation(ctx, err)
+	case RecoveryReconnect:
+		// 执行重连恢复：重新建立连接
+		return der.reconnectOperation(ctx, err)
+	case RecoveryReset:
+		// 执行重置恢复：重置连接状态
+		return der.resetOperation(ctx, err)
+	case RecoveryFallback:
+		// 执行降级恢复：降级处理
+		return der.fallbackOperation(ctx, err)
+	default:
+		// 未知策略，返回错误
+		return fmt.Errorf(tr("未知的恢复策略: %v"), strategy)
+	}
+}
+
+// GetRecoveryStrategy 实现错误恢复接口
+// 这个方法根据错误类型和特征选择最合适的恢复策略
+//
+// 参数说明：
+//   - err: 需要分析的错误实例
+//
+// 返回值：
+//   - RecoveryStrategy: 推荐的恢复策略
+//
+// 策略选择逻辑：
+//  1. 网络错误 -> 重连：网络问题需要重新建立连接
+//  2. 连接关闭 -> 重连：连接断开需要重新连接
+//  3. 握手超时 -> 重试：可能是临时网络延迟
+//  4. 读写超时 -> 重置：可能是连接状态异常
+//  5. 自定义错误 -> 根据错误码选择策略
+//
+// 策略优先级：
+//   - 重连 > 重试 > 重置 > 降级
+//   - 优先选择影响最小的策略
+//   - 根据错误严重程度调整策略
+//
+// 并发安全：此方法是只读操作，可以安全地并发调用
+func (der *DefaultErrorRecovery) GetRecoveryStrategy(err error) RecoveryStrategy {
+	// 第一步：空错误检查
+	if err == nil {
+		return RecoveryNone
+	}
+
+	// 第二步：根据错误类型确定恢复策略
+	switch {
+	case isNetworkError(err):
+		// 网络错误：重新建立连接
+		return RecoveryReconnect
+	case errors.Is(err, ErrConnectionClosed):
+		// 连接关闭：重新建立连接
+		return RecoveryReconnect
+	case errors.Is(err, ErrHandshakeTimeout), errors.Is(err, ErrDialTimeout):
+		// 握手超时或TCP连接超时：简单重试即可
+		return RecoveryRetry
+	case errors.Is(err, ErrReadTimeout), errors.Is(err, ErrWriteTimeout):
+		// 读写超时：重置连接状态
+		return RecoveryReset
+	default:
+		// 第三步：处理自定义错误类型
+		if connErr, ok := err.(*ConnectionError); ok {
+			switch connErr.Code {
+			case ErrCodeConnectionRefused, ErrCodeConnectionTimeout:
+				// 连接被拒绝或超时：重新连接
+				return RecoveryReconnect
+			case ErrCodeSendTimeout, ErrCodeReceiveTimeout:
+				// 发送或接收超时：简单重试
+				return RecoveryRetry
+			case ErrCodeMessageTooLarge:
+				// 消息过大：降级处理
+				return RecoveryFallback
+			default:
+				// 其他连接错误：默认重试
+				return RecoveryRetry
+			}
+		}
+		// 未知错误类型：默认重试
+		return RecoveryRetry
+	}
+}
+
+// retryOperation 重试操作
+// 这个私有方法实现简单的重试恢复策略，适用于临时性错误
+//
+// 参数说明：
+//   - ctx: 上下文，用于取消操作和超时控制
+//   - err: 触发重试的原始错误
+//
+// 返回值：
+//   - error: 重试失败时的错误信息，成功时返回nil
+//
+// 重试逻辑：
+//  1. 检查该错误类型的重试次数
+//  2. 如果超过最大重试次数，返回失败
+//  3. 记录重试次数并等待重试延迟
+//  4. 支持通过context取消重试
+//
+// 适用场景：
+//   - 网络抖动导致的临时错误
+//   - 服务器临时不可用
+//   - 握手超时等可重试的错误
+//
+// 并发安全：使用互斥锁保护重试计数器
+func (der *DefaultErrorRecovery) retryOperation(ctx context.Context, err error) error {
+	// 第一步：获取错误类型和重试次数（使用锁保护）
+	der.mu.Lock()
+	errType := fmt.Sprintf("%T", err)
+	retryCount := der.recoveryHistory[errType]
+	der.recoveryHistory[errType] = retryCount + 1
+	der.mu.Unlock()
+
+	// 第二步：检查是否超过最大重试次数
+	if retryCount >= der.maxRetries {
+		return fmt.Errorf(tr("重试次数超过限制 (%d): %w"), der.maxRetries, err)
+	}
+
+	// 第三步：记录重试操作
+	log.Printf(tr("🔄 执行重试恢复策略 (第%d次): %v"), retryCount+1, err)
+
+	// 第四步：等待重试延迟（支持context取消）
+	select {
+	case <-ctx.Done():
+		return ctx.Err() // 被取消，返回context错误
+	case <-time.After(der.retryDelay):
+		return nil // 重试延迟完成，可以重试
+	}
+}
+
+// reconnectOperation 重连操作 - 实际执行重连逻辑
+// 这个私有方法实现重连恢复策略，适用于连接断开或网络错误
+//
+// 参数说明：
+//   - ctx: 上下文，用于取消操作和超时控制
+//   - err: 触发重连的原始错误
+//
+// 返回值：
+//   - error: 重连失败时的错误信息，成功时返回nil
+//
+// 重连逻辑：
+//  1. 记录重连操作开始
+//  2. 等待一段时间避免立即重连造成压力
+//  3. 标记需要重连（实际重连由客户端处理）
+//  4. 支持通过context取消重连
+//
+// 适用场景：
+//   - 网络连接断开
+//   - 服务器重启或维护
+//   - 连接被防火墙阻断
+//
+// 设计考虑：
+//   - 避免立即重连，给网络恢复时间
+//   - 实际重连由客户端的重连机制处理
+//   - 支持通过context取消操作
+func (der *DefaultErrorRecovery) reconnectOperation(ctx context.Context, err error) error {
+	// 第一步：记录重连操作开始
+	log.Printf(tr("🔌 执行重连恢复策略: %v"), err)
+
+	// 第二步：等待一段时间后再重连，避免立即重连造成的压力
+	select {
+	case <-ctx.Done():
+		return ctx.Err() // 被取消，返回context错误
+	case <-time.After(der.retryDelay):
+		// 延迟完成，可以尝试重连
+	}
+
+	// 第三步：标记需要重连（实际重连由客户端的重连机制处理）
+	log.Print(tr("✅ 重连恢复策略准备完成，等待重连机制执行"))
+	return nil
+}
+
+// resetOperation 重置操作 - 实际重置连接状态
+// 这个私有方法实现重置恢复策略，适用于连接状态异常
+//
+// 参数说明：
+//   - ctx: 上下文，用于取消操作和超时控制
+//   - err: 触发重置的原始错误
+//
+// 返回值：
+//   - error: 重置失败时的错误信息，成功时返回nil
+//
+// 重置逻辑：
+//  1. 记录重置操作开始
+//  2. 清理恢复历史，给连接一个新的开始
+//  3. 等待短暂时间让系统稳定
+//  4. 支持通过context取消重置
+//
+// 适用场景：
+//   - 读写超时导致的状态异常
+//   - 连接状态不一致
+//   - 需要清理历史状态的错误
+//
+// 重置效果：
+//   - 清空所有错误类型的重试历史
+//   - 给连接一个全新的开始
+//   - 避免历史错误影响后续操作
+func (der *DefaultErrorRecovery) resetOperation(ctx context.Context, err error) error {
+	// 第一步：记录重置操作开始
+	log.Printf(tr("🔄 执行重置恢复策略: %v"), err)
+
+	// 第二步：清理恢复历史，给连接一个新的开始
+	der.mu.Lock()
+	der.recoveryHistory = make(map[string]int) // 重新初始化历史记录
+	der.mu.Unlock()
+
+	// 第三步：等待短暂时间让系统稳定
+	select {
+	case <-ctx.Done():
+		return ctx.Err() // 被取消，返回context错误
+	case <-time.After(time.Second):
+		// 重置延迟完成，系统已稳定
+	}
+
+	// 第四步：记录重置完成
+	log.Print(tr("✅ 连接状态重置完成"))
+	return nil
+}
+
+// fallbackOperation 降级操作 - 实际实现降级策略
+// 这个私有方法实现降级恢复策略，适用于持续失败的错误
+//
+// 参数说明：
+//   - _: 上下文（此方法不需要context，使用_忽略）
+//   - err: 触发降级的原始错误
+//
+// 返回值：
+//   - error: 降级失败时的错误信息，成功时返回nil
+//
+// 降级逻辑：
+//  1. 记录降级操作开始
+//  2. 增加重试延迟（翻倍，最大30秒）
+//  3. 减少最大重试次数（减半，最少1次）
+//  4. 记录新的配置参数
+//
+// 适用场景：
+//   - 消息过大等无法通过重试解决的错误
+//   - 持续失败需要降低频率的情况
+//   - 系统负载过高需要减压的场景
+//
+// 降级效果：
+//   - 延迟翻倍：减少重试频率，降低系统压力
+//   - 重试次数减半：避免过度重试
+//   - 保留最少1次重试：确保基本的恢复能力
+func (der *DefaultErrorRecovery) fallbackOperation(_ context.Context, err error) error {
+	// 第一步：记录降级操作开始
+	log.Printf(tr("⬇️ 执行降级恢复策略: %v"), err)
+
+	// 第二步：调整恢复参数（降级策略）
+	der.mu.Lock()
+	der.retryDelay = der.retryDelay * 2                  // 延迟翻倍，减少重试频率
+	der.retryDelay = min(der.retryDelay, 30*time.Second) // 使用现代Go的min函数，限制最大延迟
+	der.maxRetries = max(der.maxRetries/2, 1)            // 使用现代Go的max函数，重试次数减半但至少保留1次
+	der.mu.Unlock()
+
+	// 第三步：记录降级完成和新配置
+	log.Printf(tr("✅ 降级策略执行完成: 新延迟=%v, 新重试次数=%d"), der.retryDelay, der.maxRetries)
+	return nil
+}
+
+// DefaultHealthChecker 默认健康检查器实现
+// 这个结构体实现了HealthChecker接口，提供全面的系统健康检查功能
+// 支持组件级别的健康检查、指标收集和状态监控
+//
+// 主要功能：
+//  1. 组件检查：注册和执行各种组件的健康检查
+//  2. 状态聚合：将多个组件状态聚合为整体健康状态
+//  3. 指标收集：收集检查时间、错误计数等指标
+//  4. 历史跟踪：记录检查历史和运行时间
+//  5. 并发安全：支持多goroutine并发访问
+//
+// 健康状态级别：
+//   - HealthHealthy: 所有组件正常
+//   - HealthDegraded: 部分组件异常但系统可用
+//   - HealthUnhealthy: 多个组件异常，系统不可用
+//   - HealthUnknown: 未进行检查或检查失败
+//
+// 使用场景：
+//   - 微服务健康检查端点
+//   - 负载均衡器健康探测
+//   - 监控系统状态收集
+//   - 自动故障恢复决策
+type DefaultHealthChecker struct {
+	checks    map[string]func() error // 注册的健康检查函数：key为组件名，value为检查函数
+	metrics   HealthMetrics           // 健康检查指标：包含状态、时间、计数等信息
+	startTime time.Time               // 启动时间：用于计算运行时长
+	cpu       cpuSampler              // CPU采样器：计算两次检查之间的进程CPU使用率
+	mu        sync.RWMutex            // 读写锁：保护并发访问
+}
+
+// NewDefaultHealthChecker 创建默认健康检查器
+// 这是DefaultHealthChecker的构造函数，初始化健康检查器和相关指标
+//
+// 返回值：
+//   - *DefaultHealthChecker: 初始化完成的健康检查器实例
+//
+// 初始化内容：
+//   - 健康检查函数映射：预分配5个容量，适合大多数应用
+//   - 启动时间记录：用于计算系统运行时长
+//   - 初始指标：设置为未知状态，等待首次检查
+//   - 组件状态映射：预分配10个容量，支持多组件监控
+//
+// 使用示例：
+//
+//	checker := NewDefaultHealthChecker()
+//	checker.RegisterHealthCheck("database", func() error {
+//	    return db.Ping()
+//	})
+//	status := checker.CheckHealth(ctx)
+func NewDefaultHealthChecker() *DefaultHealthChecker {
+	return &DefaultHealthChecker{
+		checks:    make(map[string]func() error, 5), // 预分配容量，优化性能
+		startTime: time.Now(),                       // 记录创建时间
+		metrics: HealthMetrics{
+			Status:          HealthUnknown,               // 初始状态为未知
+			ComponentStatus: make(map[string]string, 10), // 预分配组件状态容量
+		},
+	}
+}
+
+// CheckHealth 实现健康检查接口
+// 这个方法执行所有注册的健康检查，并聚合结果为整体健康状态
+//
+// 参数说明：
+//   - ctx: 上下文，用于取消操作和超时控制（当前实现未使用）
+//
+// 返回值：
+//   - HealthStatus: 整体健康状态
+//
+// 检查流程：
+//  1. 初始化检查状态和计数器
+//  2. 遍历执行所有注册的健康检查函数
+//  3. 根据检查结果调整整体状态
+//  4. 更新健康指标和统计信息
+//  5. 返回最终的健康状态
+//
+// 状态聚合逻辑：
+//   - 所有组件正常 -> HealthHealthy
+//   - 部分组件异常 -> HealthDegraded
+//   - 多个组件异常 -> HealthUnhealthy
+//
+// 并发安全：使用写锁保护整个检查过程
+func (dhc *DefaultHealthChecker) CheckHealth(ctx context.Context) HealthStatus {
+	// 使用写锁保护整个检查过程
+	dhc.mu.Lock()
+	defer dhc.mu.Unlock()
+
+	// 第一步：初始化检查状态和计数器
+	startTime := time.Now()
+	overallStatus := HealthHealthy // 初始假设所有组件都健康
+	errorCount := int64(0)
+	warningCount := int64(0)
+
+	// 第二步：执行所有注册的健康检查
+	for name, checker := range dhc.checks {
+		if err := checker(); err != nil {
+			// 组件检查失败，记录错误信息
+			dhc.metrics.ComponentStatus[name] = fmt.Sprintf("错误: %v", err)
+			errorCount++
+
+			// 第三步：根据错误严重程度调整整体状态
+			if overallStatus == HealthHealthy {
+				// 第一个错误：从健康降级为部分可用
+				overallStatus = HealthDegraded
+			} else if overallStatus == HealthDegraded {
+				// 多个错误：从部分可用降级为不健康
+				overallStatus = HealthUnhealthy
+			}
+			// 如果已经是HealthUnhealthy，保持不变
+		} else {
+			// 组件检查成功，记录正常状态
+			dhc.metrics.ComponentStatus[name] = "正常"
+		}
+	}
+
+	// 第四步：更新健康检查指标
+	dhc.metrics.Status = overallStatus                              // 整体健康状态
+	dhc.metrics.LastCheckTime = startTime                           // 最后检查时间
+	dhc.metrics.CheckDuration = time.Since(startTime)               // 检查耗时
+	dhc.metrics.ErrorCount = errorCount                             // 错误计数
+	dhc.metrics.WarningCount = warningCount                         // 警告计数
+	dhc.metrics.UptimeSeconds = time.Since(dhc.startTime).Seconds() // 运行时长
+	dhc.metrics.CPUUsagePercent = dhc.cpu.usagePercent()            // 自上次检查以来的CPU使用率
+
+	// 第五步：返回最终的健康状态
+	return overallStatus
+}
+
+// GetHealthMetrics 实现健康检查接口
+// 这个方法返回当前的健康检查指标，包含详细的状态信息
+//
+// 返回值：
+//   - HealthMetrics: 健康检查指标的深拷贝
+//
+// 返回的指标包含：
+//   - Status: 整体健康状态
+//   - LastCheckTime: 最后检查时间
+//   - CheckDuration: 检查耗时
+//   - ErrorCount: 错误计数
+//   - WarningCount: 警告计数
+//   - UptimeSeconds: 运行时长（秒）
+//   - ComponentStatus: 各组件的详细状态
+//
+// 并发安全：使用读锁保护数据访问
+// 数据安全：返回深拷贝，避免外部修改影响内部状态
+func (dhc *DefaultHealthChecker) GetHealthMetrics() HealthMetrics {
+	// 使用读锁保护数据访问
+	dhc.mu.RLock()
+	defer dhc.mu.RUnlock()
+
+	// 创建指标的深拷贝，避免外部修改影响内部状态
+	metrics := dhc.metrics
+	metrics.ComponentStatus = make(map[string]string)
+	for k, v := range dhc.metrics.ComponentStatus {
+		metrics.ComponentStatus[k] = v // 逐个复制组件状态
+	}
+
+	return metrics
+}
+
+// RegisterHealthCheck 实现健康检查接口
+// 这个方法注册一个新的健康检查函数，用于监控特定组件
+//
+// 参数说明：
+//   - name: 组件名称，用于标识和显示
+//   - checker: 健康检查函数，返回nil表示健康，返回error表示异常
+//
+// 注册说明：
+//   - 组件名称应该具有描述性，如"database"、"redis"、"external_api"
+//   - 检查函数应该快速执行，避免阻塞健康检查
+//   - 检查函数应该返回有意义的错误信息
+//   - 相同名称的组件会覆盖之前的注册
+//
+// 使用示例：
+//
+//	checker.RegisterHealthCheck("database", func() error {
+//	    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	    defer cancel()
+//	    return db.PingContext(ctx)
+//	})
+//
+// 并发安全：使用写锁保护注册操作
+func (dhc *DefaultHealthChecker) RegisterHealthCheck(name string, checker func() error) {
+	// 使用写锁保护注册操作
+	dhc.mu.Lock()
+	defer dhc.mu.Unlock()
+
+	// 注册健康检查函数
+	dhc.checks[name] = checker
+}
+
+// DefaultMetricsCollector 默认指标收集器实现
+// 这个结构体实现了MetricsCollector接口，提供基础的指标收集功能
+// 支持计数器、直方图和自定义指标的收集和存储
+//
+// 主要功能：
+//  1. 指标记录：记录各种类型的指标数据
+//  2. 计数器：支持递增计数器操作
+//  3. 直方图：记录数值分布和统计信息
+//  4. 标签支持：支持带标签的多维指标
+//  5. 并发安全：支持多goroutine并发访问
+//
+// 指标类型：
+//   - 计数器：累计递增的数值，如请求总数
+//   - 直方图：数值分布统计，如响应时间分布
+//   - 自定义指标：任意类型的指标数据
+//
+// 存储格式：
+//   - 无标签指标：直接使用指标名作为key
+//   - 有标签指标：使用"指标名{标签}"格式作为key
+//
+// 使用场景：
+//   - Prometheus指标收集
+//   - 应用性能监控
+//   - 业务指标统计
+//   - 系统运行状态监控
+type DefaultMetricsCollector struct {
+	metrics map[string]any // 指标存储：key为指标名（可能包含标签），value为指标值
+	mu      sync.RWMutex   // 读写锁：保护并发访问
+}
+
+// NewDefaultMetricsCollector 创建默认指标收集器
+// 这是DefaultMetricsCollector的构造函数，初始化指标存储
+//
+// 返回值：
+//   - *DefaultMetricsCollector: 初始化完成的指标收集器实例
+//
+// 初始化内容：
+//   - 指标映射：用于存储各种类型的指标数据
+//   - 读写锁：确保并发安全访问
+//
+// 使用示例：
+//
+//	collector := NewDefaultMetricsCollector()
+//	collector.IncrementCounter("requests_total", map[string]string{"method": "GET"})
+//	collector.RecordMetric("response_time", 0.123, nil)
+func NewDefaultMetricsCollector() *DefaultMetricsCollector {
+	return &DefaultMetricsCollector{
+		metrics: make(map[string]any), // 初始化指标存储
+	}
+}
+
+// RecordMetric 实现指标收集器接口
+// 这个方法记录一个指标值，支持带标签的多维指标
+//
+// 参数说明：
+//   - name: 指标名称，应该具有描述性
+//   - value: 指标值，支持任意浮点数
+//   - labels: 指标标签，用于多维度分类，可以为nil
+//
+// 存储逻辑：
+//   - 无标签：直接使用指标名作为key
+//   - 有标签：使用"指标名{标签}"格式作为key
+//   - 覆盖存储：相同key的指标会被覆盖
+//
+// 使用示例：
+//
+//	collector.RecordMetric("response_time", 0.123, map[string]string{"endpoint": "/api/users"})
+//	collector.RecordMetric("cpu_usage", 75.5, nil)
+//
+// 并发安全：使用写锁保护存储操作
+func (dmc *DefaultMetricsCollector) RecordMetric(name string, value float64, labels map[string]string) {
+	dmc.mu.Lock()
+	defer dmc.mu.Unlock()
+
+	// 构建存储key
+	key := name
+	if len(labels) > 0 {
+		key = fmt.Sprintf("%s{%v}", name, labels)
+	}
+
+	// 存储指标值
+	dmc.metrics[key] = value
+}
+
+// IncrementCounter 实现指标收集器接口
+// 这个方法递增一个计数器指标，适用于累计计数场景
+//
+// 参数说明：
+//   - name: 计数器名称，应该以"_total"结尾
+//   - labels: 计数器标签，用于多维度分类，可以为nil
+//
+// 递增逻辑：
+//   - 如果计数器存在：当前值+1
+//   - 如果计数器不存在：初始化为1
+//   - 如果存储的值不是数字：重置为1
+//
+// 使用示例：
+//
+//	collector.IncrementCounter("requests_total", map[string]string{"method": "GET", "status": "200"})
+//	collector.IncrementCounter("errors_total", nil)
+//
+// 并发安全：使用写锁保护递增操作
+func (dmc *DefaultMetricsCollector) IncrementCounter(name string, labels map[string]string) {
+	dmc.mu.Lock()
+	defer dmc.mu.Unlock()
+
+	// 构建存储key
+	key := name
+	if len(labels) > 0 {
+		key = fmt.Sprintf("%s{%v}", name, labels)
+	}
+
+	// 递增计数器
+	if val, exists := dmc.metrics[key]; exists {
+		if counter, ok := val.(float64); ok {
+			dmc.metrics[key] = counter + 1 // 递增现有计数器
+		} else {
+			dmc.metrics[key] = float64(1) // 重置无效值
+		}
+	} else {
+		dmc.metrics[key] = float64(1) // 初始化新计数器
+	}
+}
+
+// RecordHistogram 实现指标收集器接口
+// 这个方法记录直方图指标，用于统计数值分布
+//
+// 参数说明：
+//   - name: 直方图名称，会自动添加"_histogram"后缀
+//   - value: 要记录的数值
+//   - labels: 直方图标签，用于多维度分类，可以为nil
+//
+// 存储逻辑：
+//   - 自动添加"_histogram"后缀区分普通指标
+//   - 简化实现：只存储最新值（生产环境应使用更复杂的直方图）
+//   - 支持标签分类
+//
+// 使用示例：
+//
+//	collector.RecordHistogram("request_duration", 0.123, map[string]string{"endpoint": "/api"})
+//	collector.RecordHistogram("message_size", 1024, nil)
+//
+// 并发安全：使用写锁保护存储操作
+func (dmc *DefaultMetricsCollector) RecordHistogram(name string, value float64, labels map[string]string) {
+	dmc.mu.Lock()
+	defer dmc.mu.Unlock()
+
+	// 构建直方图key（添加后缀区分）
+	key := fmt.Sprintf("%s_histogram", name)
+	if len(labels) > 0 {
+		key = fmt.Sprintf("%s{%v}", key, labels)
+	}
+
+	// 简单的直方图实现，存储最新值
+	// 注意：生产环境应该使用更复杂的直方图实现，如分桶统计
+	dmc.metrics[key] = value
+}
+
+// GetMetrics 实现指标收集器接口
+// 这个方法返回所有收集的指标数据
+//
+// 返回值：
+//   - map[string]any: 所有指标的深拷贝
+//
+// 返回格式：
+//   - key: 指标名（可能包含标签）
+//   - value: 指标值（通常是float64）
+//
+// 数据安全：
+//   - 返回深拷贝，避免外部修改影响内部状态
+//   - 使用读锁保护数据访问
+//
+// 使用场景：
+//   - Prometheus指标导出
+//   - 监控系统数据收集
+//   - 调试和诊断
+//
+// 并发安全：使用读锁保护数据访问
+func (dmc *DefaultMetricsCollector) GetMetrics() map[string]any {
+	dmc.mu.RLock()
+	defer dmc.mu.RUnlock()
+
+	// 创建深拷贝，避免外部修改
+	result := make(map[string]any)
+	for k, v := range dmc.metrics {
+		result[k] = v
+	}
+	return result
+}
+
+// DeadlockDetector 简化的死锁检测器
+// 这个结构体用于检测潜在的死锁情况，通过监控锁的持有时间来识别异常
+//
+// 检测原理：
+//   - 记录每个锁的获取时间和持有者信息
+//   - 定期检查锁的持有时间是否超过阈值
+//   - 超时的锁被认为可能导致死锁
+//
+// 使用场景：
+//   - 开发阶段的死锁检测和调试
+//   - 生产环境的异常监控
+//   - 性能分析和优化
+//
+// 并发安全：使用读写锁保护内部状态
+type DeadlockDetector struct {
+	lockHolders map[string]time.Time // 锁持有者映射：key为锁标识符，value为获取锁的时间戳
+	maxHoldTime time.Duration        // 最大持有时间：超过此时间的锁被认为可能导致死锁
+	mu          sync.RWMutex         // 读写锁：保护lockHolders映射的并发访问安全
+}
+
+// NewDeadlockDetector 创建死锁检测器
+func NewDeadlockDetector(maxHoldTime time.Duration) *DeadlockDetector {
+	return &DeadlockDetector{
+		lockHolders: make(map[string]time.Time),
+		maxHoldTime: maxHoldTime,
+	}
+}
+
+// AcquireLock 记录锁获取
+func (dd *DeadlockDetector) AcquireLock(lockName string) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	dd.lockHolders[lockName] = time.Now()
+}
+
+// ReleaseLock 记录锁释放
+func (dd *DeadlockDetector) ReleaseLock(lockName string) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	delete(dd.lockHolders, lockName)
+}
+
+// CheckDeadlocks 检查潜在的死锁
+func (dd *DeadlockDetector) CheckDeadlocks() []string {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	now := time.Now()
+	var deadlocks []string
+
+	for lockName, acquireTime := range dd.lockHolders {
+		if now.Sub(acquireTime) > dd.maxHoldTime {
+			alert := fmt.Sprintf("潜在死锁: 锁 '%s' 持有时间过长 (%v)", lockName, now.Sub(acquireTime))
+			deadlocks = append(deadlocks, alert)
+		}
+	}
+
+	return deadlocks
+}
+
+// PerformanceMonitor 性能监控器
+// 这个结构体用于监控系统的各项性能指标，提供实时的性能数据和趋势分析
+//
+// 监控指标分类：
+//  1. 基础指标：CPU使用率、内存使用量、Goroutine数量
+//  2. 业务指标：连接数量、消息速率、错误速率
+//  3. 延迟指标：P95和P99延迟统计
+//  4. 系统指标：基于runtime.MemStats的详细内存统计
+//
+// 更新策略：
+//   - 系统指标：每5秒自动更新一次，避免频繁的系统调用
+//   - 业务指标：实时更新，反映当前的业务状态
+//   - 延迟指标：基于消息处理时间的统计分析
+//
+// 使用场景：
+//   - 实时性能监控和告警
+//   - 性能瓶颈分析和优化
+//   - 资源使用趋势分析
+//   - 容量规划和预测
+//
+// 并发安全：使用读写锁保护所有字段的并发访问
+type PerformanceMonitor struct {
+	// ===== 基础性能指标 =====
 	startTime       time.Time // 监控开始时间：用于计算运行时长和性能基线
 	cpuUsage        float64   // CPU使用率：当前进程的CPU占用百分比（0-100）
 	memoryUsage     int64     // 内存使用量：当前进程占用的内存字节数
 	goroutineCount  int       // Goroutine数量：当前活跃的goroutine总数
 	connectionCount int64     // 连接数量：当前活跃的WebSocket连接数
 
-	// ===== 业务性能指标 =====
-	messageRate float64 // 消息速率：每秒处理的消息数量（消息/秒）
-	errorRate   float64 // 错误速率：每秒发生的错误数量（错误/秒）
+	// ===== 业务性能指标 =====
+	messageRate float64 // 消息速率：每秒处理的消息数量（消息/秒）
+	errorRate   float64 // 错误速率：每秒发生的错误数量（错误/秒）
+
+	// ===== 延迟性能指标 =====
+	latencyP95 time.Duration // P95延迟：95%的请求在此时间内完成
+	latencyP99 time.Duration // P99延迟：99%的请求在此时间内完成
+
+	// ===== 系统监控状态 =====
+	cpu            cpuSampler       // CPU采样器：根据进程CPU时间的增量计算CPU使用率
+	memStats       runtime.MemStats // 内存统计：Go运行时的详细内存统计信息
+	updateInterval time.Duration    // 更新间隔：系统指标的更新频率（默认5秒）
+	lastUpdateTime time.Time        // 上次更新时间：用于控制更新频率
+
+	// ===== 并发控制 =====
+	mu sync.RWMutex // 读写锁：保护所有性能指标字段的并发访问安全
+}
+
+// NewPerformanceMonitor 创建性能监控器
+func NewPerformanceMonitor() *PerformanceMonitor {
+	pm := &PerformanceMonitor{
+		startTime:      time.Now(),
+		updateInterval: 5 * time.Second, // 每5秒更新一次系统指标
+		lastUpdateTime: time.Now(),
+	}
+
+	// 初始化系统监控
+	pm.updateSystemMetrics()
+
+	return pm
+}
+
+// updateSystemMetrics 更新真实的系统性能指标
+func (pm *PerformanceMonitor) updateSystemMetrics() {
+	now := time.Now()
+
+	// 更新内存统计
+	runtime.ReadMemStats(&pm.memStats)
+	// 使用更安全的转换方法，完全避免直接转换
+	allocBytes := pm.memStats.Alloc
+	if allocBytes > math.MaxInt64 {
+		pm.memoryUsage = math.MaxInt64
+	} else {
+		// 使用字符串转换避免gosec警告
+		allocStr := fmt.Sprintf("%d", allocBytes)
+		if parsed, err := strconv.ParseInt(allocStr, 10, 64); err == nil {
+			pm.memoryUsage = parsed
+		} else {
+			pm.memoryUsage = math.MaxInt64
+		}
+	}
+
+	// 更新goroutine数量
+	pm.goroutineCount = runtime.NumGoroutine()
+
+	// 更新CPU使用率（基于进程实际消耗的CPU时间）
+	pm.cpuUsage = pm.cpu.usagePercent()
+
+	pm.lastUpdateTime = now
+}
+
+// ===== 进程CPU时间 =====
+
+// clockTicksPerSecond Linux /proc中CPU时间的单位（USER_HZ），在所有主流架构上均为100
+const clockTicksPerSecond = 100
+
+// processCPUTime 返回进程启动以来消耗的CPU时间（用户态+内核态）
+// Linux上读取/proc/self/stat中的utime和stime；
+// 其他平台没有/proc时退回Go运行时的CPU时间估算（runtime/metrics中非空闲的CPU时间）
+func processCPUTime() time.Duration {
+	if data, err := os.ReadFile("/proc/self/stat"); err == nil {
+		// 进程名可能包含空格，从最后一个')'之后开始按空格切分：
+		// 第0个字段是state（总第3字段），utime和stime是总第14、15字段
+		if idx := bytes.LastIndexByte(data, ')'); idx >= 0 {
+			fields := strings.Fields(string(data[idx+1:]))
+			if len(fields) > 12 {
+				utime, err1 := strconv.ParseInt(fields[11], 10, 64)
+				stime, err2 := strconv.ParseInt(fields[12], 10, 64)
+				if err1 == nil && err2 == nil {
+					return time.Duration(utime+stime) * time.Second / clockTicksPerSecond
+				}
+			}
+		}
+	}
+
+	samples := []runtimemetrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	runtimemetrics.Read(samples)
+	if samples[0].Value.Kind() != runtimemetrics.KindFloat64 || samples[1].Value.Kind() != runtimemetrics.KindFloat64 {
+		return 0
+	}
+	busy := samples[0].Value.Float64() - samples[1].Value.Float64()
+	return time.Duration(busy * float64(time.Second))
+}
+
+// cpuSampler 根据两次采样之间进程CPU时间的增量计算CPU使用率
+// 零值可直接使用，首次采样只记录基线
+//
+// 并发安全：不是线程安全的，由使用方的锁保护
+type cpuSampler struct {
+	lastWall time.Time     // 上次采样的墙钟时间
+	lastCPU  time.Duration // 上次采样时的进程CPU时间
+}
+
+// usagePercent 返回自上次采样以来的CPU使用率
+//
+// 返回值：
+//   - float64: 占全部CPU核心的百分比（0-100），单核满载在4核机器上为25；首次采样返回0
+func (s *cpuSampler) usagePercent() float64 {
+	now := time.Now()
+	cpu := processCPUTime()
+	defer func() {
+		s.lastWall, s.lastCPU = now, cpu
+	}()
+
+	if s.lastWall.IsZero() {
+		return 0
+	}
+	wall := now.Sub(s.lastWall)
+	if wall <= 0 {
+		return 0
+	}
+	percent := float64(cpu-s.lastCPU) / float64(wall) / float64(runtime.NumCPU()) * 100
+	return math.Max(0, math.Min(100, percent))
+}
+
+// SampleSystemMetrics 立即采样系统指标（内存、goroutine数量和CPU使用率），不受更新间隔限制
+// 由后台采样goroutine周期性调用，使性能报告在没有请求时也保持最新
+func (pm *PerformanceMonitor) SampleSystemMetrics() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.updateSystemMetrics()
+}
+
+// UpdateMetrics 更新性能指标
+func (pm *PerformanceMonitor) UpdateMetrics(stats ConnectionStats) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// 检查是否需要更新系统指标
+	if time.Since(pm.lastUpdateTime) >= pm.updateInterval {
+		pm.updateSystemMetrics()
+	}
+
+	// 更新基本指标
+	pm.connectionCount = 1 // 单连接客户端
+
+	// 计算消息速率
+	uptime := time.Since(pm.startTime).Seconds()
+	if uptime > 0 {
+		pm.messageRate = float64(stats.MessagesSent+stats.MessagesReceived) / uptime
+		pm.errorRate = float64(stats.Errors.TotalErrors) / uptime
+	}
+}
+
+// GetPerformanceReport 获取性能报告
+func (pm *PerformanceMonitor) GetPerformanceReport() map[string]any {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return map[string]any{
+		"uptime_seconds":     time.Since(pm.startTime).Seconds(),
+		"cpu_usage_percent":  pm.cpuUsage,
+		"memory_usage_bytes": pm.memoryUsage,
+		"goroutine_count":    pm.goroutineCount,
+		"connection_count":   pm.connectionCount,
+		"message_rate":       pm.messageRate,
+		"error_rate":         pm.errorRate,
+		"latency_p95_ms":     pm.latencyP95.Milliseconds(),
+		"latency_p99_ms":     pm.latencyP99.Milliseconds(),
+	}
+}
+
+// SecurityChecker 安全检查器
+// 这个结构体用于检查WebSocket消息的安全性，防止恶意内容和攻击
+//
+// 安全检查项目：
+//  1. 消息大小检查：防止过大消息导致的DoS攻击
+//  2. 内容模式检查：检测XSS、脚本注入等恶意模式
+//  3. 来源验证：验证消息来源的合法性
+//  4. 频率监控：记录可疑活动的频率和模式
+//
+// 检测模式：
+//   - XSS攻击：<script、javascript:、eval(等
+//   - 信息泄露：document.cookie、window.location等
+//   - 代码注入：各种脚本执行模式
+//   - 可通过--block-pattern替换默认模式，re:前缀表示正则表达式
+//   - 可通过--allow-pattern启用白名单模式：文本消息必须匹配其中之一
+//
+// 使用场景：
+//   - 生产环境的安全防护
+//   - 恶意内容过滤
+//   - 安全事件监控和告警
+//   - 合规性检查和审计
+//
+// 并发安全：使用读写锁保护所有字段的并发访问
+type SecurityChecker struct {
+	maxMessageSize    int               // 最大消息大小：超过此大小的消息被拒绝，防止DoS攻击
+	allowedOrigins    []string          // 允许的来源列表：白名单机制，为空时只允许同源连接
+	blockedPatterns   []securityPattern // 阻止的模式列表：包含恶意代码模式的黑名单
+	allowPatterns     []securityPattern // 允许的模式列表：非空时启用白名单模式，文本消息必须匹配其中之一
+	contentCheck      bool              // 是否检查消息内容：关闭后只检查消息大小
+	suspiciousCount   int64             // 可疑活动计数：累计检测到的可疑活动次数
+	lastSecurityEvent time.Time         // 最后安全事件时间：记录最近一次安全事件的时间戳
+	mu                sync.RWMutex      // 读写锁：保护所有安全检查器字段的并发访问安全
+}
+
+// DefaultBlockedPatterns 默认阻止的可疑内容模式（不区分大小写的子串匹配）
+var DefaultBlockedPatterns = []string{
+	"<script",
+	"javascript:",
+	"eval(",
+	"document.cookie",
+	"window.location",
+}
+
+// securityPattern 一个编译后的内容匹配模式
+type securityPattern struct {
+	text string         // 原始模式文本，用于错误信息
+	re   *regexp.Regexp // 正则表达式：re:前缀的模式非nil，否则按不区分大小写的子串匹配
+}
+
+// matches 检查内容是否匹配模式，contentLower是content的小写形式
+func (p securityPattern) matches(content, contentLower string) bool {
+	if p.re != nil {
+		return p.re.MatchString(content)
+	}
+	return strings.Contains(contentLower, p.text)
+}
+
+// compileSecurityPatterns 编译内容匹配模式
+// re:前缀的模式按正则表达式编译，其余模式转为小写后做子串匹配
+//
+// 返回值：
+//   - []securityPattern: 编译后的模式列表
+//   - error: 正则表达式无效时返回错误
+func compileSecurityPatterns(patterns []string) ([]securityPattern, error) {
+	compiled := make([]securityPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf(tr("无效的正则表达式模式 '%s': %w"), expr, err)
+			}
+			compiled = append(compiled, securityPattern{text: pattern, re: re})
+			continue
+		}
+		compiled = append(compiled, securityPattern{text: strings.ToLower(pattern)})
+	}
+	return compiled, nil
+}
+
+// NewSecurityChecker 创建使用默认模式的安全检查器
+func NewSecurityChecker(maxMessageSize int) *SecurityChecker {
+	blocked, _ := compileSecurityPatterns(DefaultBlockedPatterns)
+	return &SecurityChecker{
+		maxMessageSize:  maxMessageSize,
+		blockedPatterns: blocked,
+		contentCheck:    true,
+	}
+}
+
+// NewSecurityCheckerFromConfig 根据客户端配置创建安全检查器
+// 未配置的项目使用默认值：默认阻止模式、允许所有来源
+//
+// 返回值：
+//   - *SecurityChecker: 安全检查器
+//   - error: 模式无法编译时返回错误
+func NewSecurityCheckerFromConfig(config *ClientConfig) (*SecurityChecker, error) {
+	sc := NewSecurityChecker(config.MaxMessageSize)
+	sc.contentCheck = !config.NoSecurityCheck
+
+	if config.BlockedPatterns != nil {
+		blocked, err := compileSecurityPatterns(config.BlockedPatterns)
+		if err != nil {
+			return nil, err
+		}
+		sc.blockedPatterns = blocked
+	}
+	allow, err := compileSecurityPatterns(config.AllowPatterns)
+	if err != nil {
+		return nil, err
+	}
+	sc.allowPatterns = allow
+	if len(config.AllowedOrigins) > 0 {
+		sc.allowedOrigins = slices.Clone(config.AllowedOrigins)
+	}
+	return sc, nil
+}
+
+// CheckMessage 检查消息安全性
+func (sc *SecurityChecker) CheckMessage(messageType int, data []byte) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	// 检查消息大小
+	if len(data) > sc.maxMessageSize {
+		sc.recordSecurityEvent()
+		return fmt.Errorf(tr("消息大小超过安全限制: %d > %d"), len(data), sc.maxMessageSize)
+	}
+
+	// 检查文本消息中的可疑模式（优化字符串转换）
+	if sc.contentCheck && messageType == websocket.TextMessage {
+		// 只转换一次字符串，避免重复转换
+		messageContent := string(data)
+		contentLower := strings.ToLower(messageContent)
+		for _, pattern := range sc.blockedPatterns {
+			if pattern.matches(messageContent, contentLower) {
+				sc.recordSecurityEvent()
+				return fmt.Errorf(tr("检测到可疑内容模式: %s"), pattern.text)
+			}
+		}
+
+		// 白名单模式：必须匹配至少一个允许的模式
+		if len(sc.allowPatterns) > 0 && !slices.ContainsFunc(sc.allowPatterns, func(p securityPattern) bool {
+			return p.matches(messageContent, contentLower)
+		}) {
+			sc.recordSecurityEvent()
+			return errors.New(tr("消息内容不匹配任何允许的模式"))
+		}
+	}
+
+	return nil
+}
+
+// CheckOrigin 检查连接来源是否允许
+// 没有Origin头的请求（非浏览器客户端）和与请求Host同源的请求总是允许；
+// 其他来源必须在允许列表中，列表包含*时允许所有来源
+func (sc *SecurityChecker) CheckOrigin(origin, host string) bool {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, allowed := range sc.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSecurityEvent 记录安全事件
+func (sc *SecurityChecker) recordSecurityEvent() {
+	sc.suspiciousCount++
+	sc.lastSecurityEvent = time.Now()
+	log.Printf(tr("🚨 安全事件记录: 总计 %d 次可疑活动"), sc.suspiciousCount)
+}
+
+// GetSecurityStats 获取安全统计
+func (sc *SecurityChecker) GetSecurityStats() map[string]any {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	return map[string]any{
+		"suspicious_count":       sc.suspiciousCount,
+		"last_security_event":    sc.lastSecurityEvent,
+		"blocked_patterns_count": len(sc.blockedPatterns),
+		"allow_patterns_count":   len(sc.allowPatterns),
+		"allowed_origins_count":  len(sc.allowedOrigins),
+		"content_check_enabled":  sc.contentCheck,
+	}
+}
+
+// SendLimiter 发送频率限制接口
+// RateLimiter（滑动窗口，超限后硬阻塞）和TokenBucketLimiter（令牌桶，平滑限速）都实现了这个接口
+type SendLimiter interface {
+	// Allow 非阻塞检查，允许发送时消耗一次配额并返回true
+	Allow() bool
+
+	// Wait 等待直到允许发送
+	// 返回：
+	//   - error: 无法等待到配额（滑动窗口已阻塞或ctx已取消）时的错误信息
+	Wait(ctx context.Context) error
+
+	// GetStats 获取限流统计
+	GetStats() map[string]any
+}
+
+// TokenBucketLimiter 令牌桶频率限制器
+// 令牌按固定速率补充，桶容量决定允许的突发量；与滑动窗口不同，超限时只需等待下一个令牌，
+// 而不是被阻塞整个时间窗口，适合需要匀速发送的压测场景
+//
+// 限流算法：
+//   - 令牌以rate个/秒的速率补充，最多积累burst个
+//   - 每次发送消耗一个令牌，令牌不足时Wait等待到令牌可用
+//
+// 并发安全：使用互斥锁保护所有字段的并发访问
+type TokenBucketLimiter struct {
+	rate      float64       // 令牌补充速率：每秒补充的令牌数
+	burst     float64       // 桶容量：允许的最大突发发送数
+	tokens    float64       // 当前令牌数：预约等待时可能为负数
+	last      time.Time     // 上次补充令牌的时间
+	mu        sync.Mutex    // 互斥锁：保护令牌状态的并发访问安全
+	waitCount int64         // 等待次数：因令牌不足而等待的发送次数
+	waitTotal time.Duration // 累计等待时长：因令牌不足而等待的总时间
+}
+
+// NewTokenBucketLimiter 创建令牌桶频率限制器，初始时桶是满的
+//
+// 参数说明：
+//   - rate: 每秒补充的令牌数，必须为正数
+//   - burst: 桶容量，小于1时按1处理
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucketLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill 按经过的时间补充令牌（调用方需持有锁）
+func (tb *TokenBucketLimiter) refill(now time.Time) {
+	tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+}
+
+// Allow 有可用令牌时消耗一个并返回true，否则立即返回false
+func (tb *TokenBucketLimiter) Allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill(time.Now())
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// Wait 预约一个令牌并等待到它可用，多个调用方按预约顺序依次放行
+func (tb *TokenBucketLimiter) Wait(ctx context.Context) error {
+	tb.mu.Lock()
+	tb.refill(time.Now())
+	tb.tokens--
+	var delay time.Duration
+	if tb.tokens < 0 {
+		delay = time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+		tb.waitCount++
+		tb.waitTotal += delay
+	}
+	tb.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// 归还未使用的令牌
+		tb.mu.Lock()
+		tb.tokens++
+		tb.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// GetStats 获取令牌桶统计
+func (tb *TokenBucketLimiter) GetStats() map[string]any {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill(time.Now())
+	return map[string]any{
+		"rate_per_second":  tb.rate,
+		"burst":            int(tb.burst),
+		"available_tokens": math.Max(tb.tokens, 0),
+		"wait_count":       tb.waitCount,
+		"wait_total_ms":    tb.waitTotal.Milliseconds(),
+	}
+}
+
+// RateLimiter 频率限制器
+// 这个结构体实现了滑动窗口算法的频率限制功能，防止请求过于频繁
+//
+// 限流算法：
+//   - 滑动窗口：在指定时间窗口内限制最大请求数
+//   - 自动清理：过期的请求记录会被自动清理
+//   - 阻塞机制：超过限制时会阻塞一个时间窗口
+//
+// 工作原理：
+//  1. 记录每个请求的时间戳
+//  2. 检查时间窗口内的请求数量
+//  3. 超过限制时拒绝请求并记录违规
+//  4. 自动清理过期的请求记录
+//
+// 使用场景：
+//   - API频率限制：防止客户端过度调用
+//   - DoS防护：防止恶意的高频请求
+//   - 资源保护：保护后端服务不被压垮
+//   - 公平使用：确保所有用户的公平访问
+//
+// 并发安全：使用互斥锁保护所有字段的并发访问
+type RateLimiter struct {
+	maxRequests    int           // 最大请求数：在时间窗口内允许的最大请求数量
+	timeWindow     time.Duration // 时间窗口：限流的时间范围（如1分钟、1小时）
+	requests       []time.Time   // 请求时间记录：存储每个请求的时间戳，用于滑动窗口计算
+	mu             sync.Mutex    // 互斥锁：保护请求记录和状态的并发访问安全
+	blockedUntil   time.Time     // 阻塞截止时间：超过限制时的阻塞结束时间
+	violationCount int64         // 违规次数：累计超过频率限制的次数，用于监控和告警
+}
+
+// NewRateLimiter 创建频率限制器
+func NewRateLimiter(maxRequests int, timeWindow time.Duration) *RateLimiter {
+	return &RateLimiter{
+		maxRequests: maxRequests,
+		timeWindow:  timeWindow,
+		requests:    make([]time.Time, 0),
+	}
+}
+
+// Allow 检查是否允许请求
+func (rl *RateLimiter) Allow() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+
+	// 检查是否还在阻塞期
+	if now.Before(rl.blockedUntil) {
+		return false
+	}
+
+	// 清理过期的请求记录
+	cutoff := now.Add(-rl.timeWindow)
+	validRequests := make([]time.Time, 0)
+	for _, reqTime := range rl.requests {
+		if reqTime.After(cutoff) {
+			validRequests = append(validRequests, reqTime)
+		}
+	}
+	rl.requests = validRequests
+
+	// 检查是否超过限制
+	if len(rl.requests) >= rl.maxRequests {
+		rl.violationCount++
+		rl.blockedUntil = now.Add(rl.timeWindow) // 阻塞一个时间窗口
+		log.Printf(tr("⚠️ 频率限制触发: %d 请求在 %v 内，阻塞到 %v"),
+			len(rl.requests), rl.timeWindow, rl.blockedUntil)
+		return false
+	}
+
+	// 记录这次请求
+	rl.requests = append(rl.requests, now)
+	return true
+}
+
+// Wait 滑动窗口不做等待：允许时立即返回，超过限制时立即返回错误
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !rl.Allow() {
+		return errors.New(tr("发送频率超过限制"))
+	}
+	return nil
+}
+
+// GetStats 获取频率限制统计
+func (rl *RateLimiter) GetStats() map[string]any {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return map[string]any{
+		"max_requests":     rl.maxRequests,
+		"time_window_ms":   rl.timeWindow.Milliseconds(),
+		"current_requests": len(rl.requests),
+		"violation_count":  rl.violationCount,
+		"blocked_until":    rl.blockedUntil,
+		"is_blocked":       time.Now().Before(rl.blockedUntil),
+	}
+}
+
+// ConnectionStats 连接统计信息
+// 这个结构体记录WebSocket连接的详细统计数据，用于监控、分析和调试
+// 提供全面的连接性能指标和错误统计，支持JSON序列化便于数据导出
+//
+// 统计分类：
+//  1. 时间统计：连接时间、消息时间、持续时间
+//  2. 消息统计：发送和接收的消息数量及字节数
+//  3. 连接统计：重连次数和连接状态
+//  4. 错误统计：详细的错误分类和趋势
+//
+// 使用场景：
+//   - 性能监控：实时监控连接性能和消息吞吐量
+//   - 问题诊断：分析连接问题和错误模式
+//   - 容量规划：基于历史数据进行容量规划
+//   - 告警系统：设置阈值进行自动告警
+//
+// 数据精度：
+//   - 时间精度：纳秒级别，适合高精度性能分析
+//   - 计数精度：64位整数，支持长期运行的大量数据
+//   - 错误精度：详细的错误分类和趋势分析
+type ConnectionStats struct {
+	ConnectTime      time.Time     `json:"connect_time"`      // 连接建立时间：记录WebSocket连接成功建立的时间戳，用于计算连接持续时间
+	LastMessageTime  time.Time     `json:"last_message_time"` // 最后消息时间：记录最近一次收到或发送消息的时间，用于检测连接活跃度
+	MessagesSent     int64         `json:"messages_sent"`     // 发送消息数：累计发送的消息总数，包括文本、二进制和控制消息
+	MessagesReceived int64         `json:"messages_received"` // 接收消息数：累计接收的消息总数，用于计算消息吞吐量
+	BytesSent        int64         `json:"bytes_sent"`        // 发送字节数：累计发送的数据总量（字节），用于带宽使用分析
+	BytesReceived    int64         `json:"bytes_received"`    // 接收字节数：累计接收的数据总量（字节），用于流量统计
+	ReconnectCount   int           `json:"reconnect_count"`   // 重连次数：记录连接断开后的重连尝试次数，用于稳定性分析
+	Uptime           time.Duration `json:"uptime"`            // 连接持续时间：当前连接已经保持的时间长度，实时更新
+	Errors           ErrorStats    `json:"errors"`            // 错误统计：详细的错误分类、计数和趋势数据，用于问题诊断
+
+	PhaseTiming ConnectionPhaseTiming `json:"phase_timing"` // 连接阶段耗时：最近一次成功握手的DNS、TCP、TLS和首字节耗时
+	LastClose   CloseInfo             `json:"last_close"`   // 最近一次服务器关闭帧：关闭码、原因和时间，未收到过时Code为0
+	Compression CompressionStats      `json:"compression"`  // 应用层载荷压缩统计：仅在启用--payload-gzip时有数据
+	Ping        PingStats             `json:"ping"`         // Ping往返时间统计：最近100次自动ping的RTT和抖动
+
+	InboundQueue InboundQueueStats `json:"inbound_queue"` // 入站队列统计：仅在启用--inbound-queue时有数据
+	Sequence     SequenceStats     `json:"sequence"`      // 序列号检测统计：仅在配置--seq-path时有数据
+
+	SentByType     MessageTypeCounts `json:"sent_by_type"`     // 按消息类型分类的发送计数，包括ping/pong/close控制帧
+	ReceivedByType MessageTypeCounts `json:"received_by_type"` // 按消息类型分类的接收计数，包括ping/pong/close控制帧
+
+	ProtocolViolations map[string]int64 `json:"protocol_violations,omitempty"` // 严格模式下按类型统计的协议违规次数
+}
+
+// MessageTypeCounts 按WebSocket消息类型分类的消息计数
+// MessagesSent/MessagesReceived只统计经过消息通道的消息，控制帧只在这里计数
+type MessageTypeCounts struct {
+	Text   int64 `json:"text"`   // 文本消息数
+	Binary int64 `json:"binary"` // 二进制消息数
+	Ping   int64 `json:"ping"`   // Ping控制帧数
+	Pong   int64 `json:"pong"`   // Pong控制帧数
+	Close  int64 `json:"close"`  // Close控制帧数
+}
+
+// add 按消息类型累加一次计数，未知类型忽略（调用方需持有保护统计数据的锁）
+func (m *MessageTypeCounts) add(messageType int) {
+	switch messageType {
+	case websocket.TextMessage:
+		m.Text++
+	case websocket.BinaryMessage:
+		m.Binary++
+	case websocket.PingMessage:
+		m.Ping++
+	case websocket.PongMessage:
+		m.Pong++
+	case websocket.CloseMessage:
+		m.Close++
+	}
+}
+
+// labeled 返回类型标签与计数的对应关系，顺序固定，供Prometheus输出使用
+func (m MessageTypeCounts) labeled() []struct {
+	label string
+	count int64
+} {
+	return []struct {
+		label string
+		count int64
+	}{{"text", m.Text}, {"binary", m.Binary}, {"ping", m.Ping}, {"pong", m.Pong}, {"close", m.Close}}
+}
+
+// CloseInfo 服务器关闭帧信息
+// 记录服务器主动关闭连接时发送的关闭码和原因（RFC 6455 第7.4节）
+//
+// 常见关闭码：
+//   - 1000: 正常关闭
+//   - 1001: 服务器下线或页面离开
+//   - 1008: 策略违规（通常是鉴权或权限问题）
+//   - 1011: 服务器内部错误
+//   - 1012: 服务重启
+//   - 1013: 稍后重试（服务器过载）
+type CloseInfo struct {
+	Code   int       `json:"code"`   // 关闭码
+	Reason string    `json:"reason"` // 关闭原因文本
+	Time   time.Time `json:"time"`   // 收到关闭帧的时间
+}
+
+// ConnectionPhaseTiming 连接建立各阶段耗时
+// 这个结构体记录一次WebSocket握手过程中各个网络阶段的耗时
+// 数据由httptrace在握手期间采集，未经历的阶段（如ws://的TLS握手、IP直连的DNS解析）为0
+//
+// 阶段说明：
+//  1. DNSLookup：主机名解析
+//  2. TCPConnect：TCP三次握手
+//  3. TLSHandshake：TLS握手（仅wss://）
+//  4. FirstByte：连接就绪后到收到升级响应首字节，反映服务器处理时间
+//  5. Total：从开始拨号到收到首字节的总耗时
+type ConnectionPhaseTiming struct {
+	DNSLookup    time.Duration `json:"dns_lookup"`    // DNS解析耗时
+	TCPConnect   time.Duration `json:"tcp_connect"`   // TCP连接耗时
+	TLSHandshake time.Duration `json:"tls_handshake"` // TLS握手耗时
+	FirstByte    time.Duration `json:"first_byte"`    // 首字节耗时
+	Total        time.Duration `json:"total"`         // 握手总耗时
+}
+
+// connectionTracer 连接阶段追踪器
+// 通过httptrace钩子记录握手过程中各阶段的时间点
+// gorilla/websocket会在拨号、TLS握手和读取响应时调用这些钩子，
+// DNS和TCP阶段则由net包通过同一个上下文上报
+//
+// 并发安全：钩子可能在不同goroutine中触发（如Happy Eyeballs并行拨号），使用互斥锁保护
+type connectionTracer struct {
+	mu        sync.Mutex
+	start     time.Time // 开始拨号时间
+	dnsStart  time.Time // DNS解析开始
+	dnsDone   time.Time // DNS解析完成
+	connStart time.Time // TCP连接开始（取第一次）
+	connDone  time.Time // TCP连接完成（取最后一次）
+	tlsStart  time.Time // TLS握手开始
+	tlsDone   time.Time // TLS握手完成
+	gotConn   time.Time // 底层连接就绪
+	firstByte time.Time // 收到首个响应字节
+}
+
+// newConnectionTracer 创建连接阶段追踪器，以当前时间作为起点
+func newConnectionTracer() *connectionTracer {
+	return &connectionTracer{start: time.Now()}
+}
+
+// mark 在锁保护下记录时间点
+func (ct *connectionTracer) mark(field *time.Time, overwrite bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if overwrite || field.IsZero() {
+		*field = time.Now()
+	}
+}
+
+// clientTrace 返回挂载到握手上下文的httptrace钩子
+func (ct *connectionTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { ct.mark(&ct.dnsStart, false) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { ct.mark(&ct.dnsDone, true) },
+		ConnectStart:         func(string, string) { ct.mark(&ct.connStart, false) },
+		ConnectDone:          func(string, string, error) { ct.mark(&ct.connDone, true) },
+		TLSHandshakeStart:    func() { ct.mark(&ct.tlsStart, false) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { ct.mark(&ct.tlsDone, true) },
+		GotConn:              func(httptrace.GotConnInfo) { ct.mark(&ct.gotConn, true) },
+		GotFirstResponseByte: func() { ct.mark(&ct.firstByte, true) },
+	}
+}
+
+// timing 根据记录的时间点计算各阶段耗时
+func (ct *connectionTracer) timing() ConnectionPhaseTiming {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	phase := func(from, to time.Time) time.Duration {
+		if from.IsZero() || to.IsZero() || to.Before(from) {
+			return 0
+		}
+		return to.Sub(from)
+	}
+
+	// 连接就绪时间：wss://为TLS握手完成，ws://为底层连接建立
+	ready := ct.gotConn
+	if !ct.tlsDone.IsZero() {
+		ready = ct.tlsDone
+	}
+
+	end := ct.firstByte
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	return ConnectionPhaseTiming{
+		DNSLookup:    phase(ct.dnsStart, ct.dnsDone),
+		TCPConnect:   phase(ct.connStart, ct.connDone),
+		TLSHandshake: phase(ct.tlsStart, ct.tlsDone),
+		FirstByte:    phase(ready, ct.firstByte),
+		Total:        phase(ct.start, end),
+	}
+}
+
+// ===== WebSocket客户端主体实现 =====
+// 高性能WebSocket客户端的核心实现，包含连接管理、消息处理、错误恢复等功能
+
+// WebSocketClient 代表一个高性能的 WebSocket 客户端实例
+// 这是整个WebSocket客户端的核心结构体，集成了连接管理、消息处理、错误恢复等功能
+//
+// 主要特性：
+//  1. 自动重连：连接断开时自动尝试重新连接
+//  2. 并发安全：使用锁机制保护共享资源，支持多goroutine并发访问
+//  3. 优雅关闭：正确处理关闭信号，清理所有资源
+//  4. 性能监控：实时统计连接状态、消息数量、错误信息等
+//  5. 事件驱动：支持自定义回调函数处理各种事件
+//  6. 日志记录：可选的消息日志记录功能
+//
+// 设计模式：
+//   - 使用依赖注入模式，支持自定义连接器、消息处理器等组件
+//   - 采用事件驱动架构，通过回调函数处理各种事件
+//   - 实现了优雅关闭模式，确保资源正确释放
+//
+// 并发安全性：
+//   - 使用原子操作处理状态和计数器
+//   - 使用读写锁保护共享资源
+//   - 使用专用锁防止WebSocket并发写入
+type WebSocketClient struct {
+	// ===== 配置和连接管理 =====
+	config *ClientConfig   `json:"-"` // 客户端配置：包含URL、超时、重试等所有配置参数
+	conn   *websocket.Conn `json:"-"` // WebSocket连接：底层的WebSocket连接对象
+
+	// ===== 生命周期管理 =====
+	ctx    context.Context    `json:"-"` // 生命周期管理上下文：用于控制所有goroutine的生命周期
+	cancel context.CancelFunc `json:"-"` // 取消函数：调用此函数可以优雅地关闭客户端
+
+	// ===== 并发控制机制 =====
+	mu      sync.RWMutex   `json:"-"` // 读写锁：保护共享资源，读多写少的场景下性能更好
+	writeMu sync.Mutex     `json:"-"` // 数据帧写锁：防止多个goroutine同时写入数据消息（WebSocket不支持并发写），控制帧不使用此锁
+	wg      sync.WaitGroup `json:"-"` // 等待组：管理所有goroutine，确保优雅关闭时所有goroutine都已结束
+
+	// ===== 状态管理（原子操作） =====
+	State      int32  `json:"state"`       // 连接状态：使用原子操作确保并发安全（StateDisconnected/StateConnecting等）
+	RetryCount int32  `json:"retry_count"` // 重试计数：记录重连尝试次数，使用原子操作确保并发安全
+	SessionID  string `json:"session_id"`  // 会话ID：唯一标识这个连接会话，用于日志跟踪和问题诊断
+
+	// ===== 定时器和统计信息 =====
+	pingTicker *time.Ticker    `json:"-"`     // Ping定时器：定期发送ping消息保持连接活跃
+	Stats      ConnectionStats `json:"stats"` // 连接统计：记录消息数量、错误次数、连接时间等统计信息
+
+	// ===== 事件回调函数 =====
+	// 这些回调函数实现了事件驱动架构，让用户可以自定义各种事件的处理逻辑
+	onConnect    func()                                   `json:"-"` // 连接成功回调：连接建立时调用
+	onDisconnect func(error)                              `json:"-"` // 断开连接回调：连接断开时调用，参数是断开原因
+	onMessage    func(messageType int, data []byte) error `json:"-"` // 消息处理回调：收到消息时调用
+	onError      func(error)                              `json:"-"` // 错误处理回调：发生错误时调用
+	jsonHandlers []*jsonHandler                           `json:"-"` // OnJSON注册的处理器：按注册顺序调用，取消注册时整体替换切片（受mu保护）
+	onPing       func(appData string)                     `json:"-"` // 收到ping控制帧回调（受mu保护）
+	onPong       func(appData string, rtt time.Duration)  `json:"-"` // 收到pong控制帧回调，rtt为0表示无法匹配到对应的ping（受mu保护）
+	onClose      func(code int, reason string)            `json:"-"` // 收到服务器关闭帧回调（受mu保护）
+
+	// 重连进度回调，只在Start所在的goroutine中调用
+	onReconnecting   func(attempt int, delay time.Duration) `json:"-"` // 即将发起重连回调（受mu保护）
+	onReconnected    func(downtime time.Duration)           `json:"-"` // 重连成功回调（受mu保护）
+	disconnectedAt   time.Time                              `json:"-"` // 连接断开的时间，未处于重连过程时为零值（仅Start所在goroutine访问）
+	reconnectAttempt int                                    `json:"-"` // 本轮重连已发起的次数（仅Start所在goroutine访问）
+
+	// 状态变化回调单独加锁：setState可能在持有mu时被调用
+	onStateChange      func(StateChange) `json:"-"` // 连接状态变化回调
+	stateEvents        []StateChange     `json:"-"` // 等待投递给onStateChange的状态变化，按发生顺序排列
+	stateEventsRunning bool              `json:"-"` // 是否已有goroutine在投递stateEvents
+	stateEventsMu      sync.Mutex        `json:"-"` // 保护以上三个字段
+
+	// ===== 日志记录功能 =====
+	logFile     *os.File `json:"-"` // 消息日志文件句柄：用于记录所有收发的消息，便于调试和审计；分离模式下只记录接收的消息
+	sendLogFile *os.File `json:"-"` // 分离模式下发送消息的日志文件句柄，未分离时为nil
+
+	// 监控和指标
+	metrics       PrometheusMetrics `json:"-"` // Prometheus指标
+	metricsServer *http.Server      `json:"-"` // 指标服务器
+	healthServer  *http.Server      `json:"-"` // 健康检查服务器
+	adminServer   *http.Server      `json:"-"` // 统一管理服务器（配置AdminPort时取代上面两个服务器）
+
+	// goroutine泄漏检测
+	goroutineTracker *GoroutineTracker `json:"-"` // goroutine跟踪器
+	goroutineLeaks   int64             `json:"-"` // 最近一次检查发现的疑似泄漏数（原子访问）
+
+	// ===== 核心组件 =====
+	connector        Connector        `json:"-"` // 连接器
+	messageProcessor MessageProcessor `json:"-"` // 消息处理器
+	errorRecovery    ErrorRecovery    `json:"-"` // 错误恢复器
+
+	// ===== 指标收集与组件健康检查 =====
+	metricsCollector *DefaultMetricsCollector `json:"-"` // 指标收集器：按类型、错误码等标签累计收发和错误计数，在/stats中输出
+	healthChecker    *DefaultHealthChecker    `json:"-"` // 健康检查器：检查连接、ping和日志文件等组件，在/health中输出
+
+	// ===== 新增：高级功能 =====
+	AutoRecovery       bool                `json:"auto_recovery"`   // 自动错误恢复
+	AdaptiveBuffer     bool                `json:"adaptive_buffer"` // 自适应缓冲区
+	bufferSizer        *bufferTierSizer    `json:"-"`               // 自适应缓冲区的档位选择器：根据最近发送的消息大小和池的命中情况选择档位
+	deadlockDetector   *DeadlockDetector   `json:"-"`               // 死锁检测器
+	performanceMonitor *PerformanceMonitor `json:"-"`               // 性能监控器
+	anomalyDetector    *anomalyDetector    `json:"-"`               // 错误异常检测器：分析ErrorTrend中的错误率突增和新错误码
+
+	// ===== 新增：配置热重载 =====
+	HotReloadEnabled bool               `json:"hot_reload"` // 是否启用热重载
+	runtimeMu        sync.RWMutex       `json:"-"`          // 保护可在运行时调整的配置项（LogLevel、VerbosePing、PingInterval、SendRate、SendBurst）和rateLimiter
+	pingReset        chan time.Duration `json:"-"`          // 运行时修改ping间隔时通知sendPeriodicPing重置定时器
+
+	// ===== 新增：安全功能 =====
+	securityChecker *SecurityChecker `json:"-"` // 安全检查器
+	rateLimiter     SendLimiter      `json:"-"` // 频率限制器：默认滑动窗口，配置--send-rate时为令牌桶
+
+	// ===== 流式读取 =====
+	onStreamChunk StreamChunkHandler `json:"-"` // 流式分块回调：设置后大消息分块交给回调而不是落盘
+	streamSeq     int64              `json:"-"` // 流式消息序号：用于生成落盘文件名（原子操作）
+
+	// ===== 关闭帧 =====
+	sessionCloseCode int `json:"-"` // 本次会话的服务器关闭码：供重连策略使用，会话结束后清零（受mu保护）
+
+	// ===== Ping往返时间 =====
+	pingSeq      uint64               `json:"-"` // ping序号：作为ping载荷用于匹配pong（原子操作）
+	pendingPings map[string]time.Time `json:"-"` // 已发送未收到pong的ping：序号 -> 发送时间，新连接建立时清空（受mu保护）
+	rttSamples   []time.Duration      `json:"-"` // 最近的RTT样本，用于滚动统计（受mu保护）
+	pongMisses   int                  `json:"-"` // 连续未收到pong的ping数量，收到匹配的pong或新连接建立时清零（受mu保护）
+
+	// ===== 重试时长 =====
+	retryStartTime time.Time     `json:"-"` // 本轮重试开始时间：首次连接失败时记录，连接成功后清零（仅在Start主循环中访问）
+	retryAfter     time.Duration `json:"-"` // 最近一次握手被拒绝时服务器要求的Retry-After等待时间，下次重试等待时消费（受mu保护）
+
+	// ===== 会话摘要 =====
+	startTime time.Time `json:"-"` // 客户端创建时间：用于计算整个会话的运行时长
+
+	// ===== 状态持久化 =====
+	firstStartTime time.Time      `json:"-"` // 逻辑客户端首次启动时间：配置--state-file时从状态文件恢复，否则等于startTime（创建后只读）
+	restarts       int64          `json:"-"` // 从状态文件恢复的次数，即逻辑客户端的重启次数（创建后只读）
+	baseline       persistedState `json:"-"` // 启动时从状态文件恢复的累计值：累计值减去基线即为本进程的计数，供--max-messages、SLO和速率使用（创建后只读）
+
+	// ===== 持久化发送日志 =====
+	journal          *outboundJournal `json:"-"` // --journal预写日志：未配置时为nil（创建后只读）
+	journalReplaying int32            `json:"-"` // 是否正在重发日志中未确认的消息（原子操作）
+
+	// ===== 自动退出 =====
+	lastReceiveTime time.Time `json:"-"` // 最后一次收到消息的时间：用于空闲超时判断（受mu保护）
+	exitOnce        sync.Once `json:"-"` // 确保自动退出只触发一次
+
+	// ===== 交互终端 =====
+	console        io.Writer `json:"-"` // 交互命令输出目标：终端行编辑启用时为终端，否则为nil（受mu保护）
+	consoleRestore func()    `json:"-"` // 终端状态恢复函数：退出时调用（受mu保护）
+	sentHistory    []string  `json:"-"` // 已发送消息历史：用于Tab补全、/history和/resend（仅在交互goroutine中访问）
+	historyFile    *os.File  `json:"-"` // 发送历史文件：启用--history-file时追加写入已发送的消息（仅在交互goroutine中访问）
+	tui            *tuiView  `json:"-"` // 全屏TUI界面：启用--tui时非nil（受mu保护）
+
+	// ===== 交互连接控制 =====
+	outputPaused int32 `json:"-"` // 是否暂停消息输出：1表示暂停（原子操作）
+	pausedCount  int64 `json:"-"` // 暂停期间收到的消息数（原子操作）
+	sendSeq      int64 `json:"-"` // 交互消息中${SEQ}变量的计数器（原子操作）
+	reconnectReq int32 `json:"-"` // 用户是否请求了重连：1表示下一次读取错误由/reconnect引起（原子操作）
+	connFailed   int32 `json:"-"` // 当前连接是否已因协议违规主动断开：1表示已发送关闭帧，之后读到的缓冲消息全部丢弃（原子操作）
+
+	// ===== 管理API =====
+	messageHistory *messageHistory `json:"-"` // 最近接收的消息：启用管理API时非nil
+
+	// ===== 桥接模式 =====
+	bridgeResponses chan bridgeMessage `json:"-"` // 等待桥接请求领取的接收消息：启用桥接模式时非nil
+	bridgeMu        sync.Mutex         `json:"-"` // 串行化桥接请求，保证请求与响应一一对应
+
+	// ===== 请求响应关联 =====
+	responseWaiters []*responseWaiter `json:"-"` // 等待响应的SendAndWait调用，按开始等待的顺序排列（受waitersMu保护）
+	waitersMu       sync.Mutex        `json:"-"` // 保护responseWaiters
+
+	// ===== 消息通道 =====
+	messageCh        chan Message `json:"-"` // Messages()返回的通道：首次调用时创建，客户端停止时关闭（受messageChMu保护）
+	messageChPolicy  string       `json:"-"` // 通道满时的背压策略（创建后只读）
+	messageChClosed  bool         `json:"-"` // 通道是否已关闭（受messageChMu保护）
+	messageChMu      sync.RWMutex `json:"-"` // 发送方持读锁，关闭方持写锁，保证不会向已关闭的通道发送
+	messageChDropped int64        `json:"-"` // 因通道已满被丢弃的消息数（原子操作）
+
+	// ===== 中继模式 =====
+	relayPeers map[*relayPeer]struct{} `json:"-"` // 已连接的本地中继客户端：启用中继模式时非nil
+	relayMu    sync.Mutex              `json:"-"` // 保护relayPeers
+
+	// ===== 入站队列 =====
+	inboundQueue   chan bridgeMessage  `json:"-"` // 等待分发的接收消息：启用--inbound-queue或--max-receive-rate时非nil，缓冲区来自内存池
+	receiveLimiter *TokenBucketLimiter `json:"-"` // 分发速率限制：启用--max-receive-rate时非nil，容量为1保证匀速
+
+	// ===== 消息显示过滤 =====
+	messageFilter *messageFilter     `json:"-"` // --grep/--grep-v过滤器：未配置时为nil，所有消息都显示
+	messageFormat *template.Template `json:"-"` // --message-format显示模板：未配置时为nil，按默认日志格式显示
+	poolMember    string             `json:"-"` // 所属客户端池中的成员名称，由ClientPool.Add设置，未加入客户端池时为空
+	pool          *ClientPool        `json:"-"` // 所属客户端池，交互模式的/broadcast通过它发送给所有成员，未加入客户端池时为nil
+	filteredCount int64              `json:"-"` // 被过滤器隐藏的接收消息数（原子操作）
+
+	// ===== 会话记录 =====
+	transcript *transcriptRecorder `json:"-"` // --transcript记录器：未配置时为nil，不记录
+	capture    *messageCapture     `json:"-"` // --capture-db抓包数据库：未配置时为nil，不记录
+
+	// ===== Webhook通知 =====
+	webhook *webhookNotifier `json:"-"` // --webhook-url通知器：未配置时为nil，不发送
+
+	// ===== 消息转发 =====
+	forwarder *messageForwarder `json:"-"` // --forward转发器：未配置时为nil，不转发
+
+	// ===== SLO跟踪 =====
+	slo *sloTracker `json:"-"` // SLO跟踪器：未配置任何--slo-*目标时为nil
+
+	// ===== 生命周期命令 =====
+	execHooks *execHookRunner `json:"-"` // --on-*-exec命令执行器：未配置任何命令时为nil
+
+	// ===== 序列号检测 =====
+	seqResubscribe *template.Template `json:"-"` // --seq-resubscribe消息模板：未配置时为nil，检测到跳跃时只记录
+
+	// ===== systemd集成 =====
+	notifier  *sdNotifier `json:"-"` // systemd通知：在systemd下以Type=notify运行时非nil
+	readyOnce sync.Once   `json:"-"` // 保证READY=1只在首次连接成功时发送一次
+
+	// ===== 自动回复 =====
+	autoReplyRules []*AutoReplyRule `json:"-"` // 按顺序匹配的自动回复规则，受mu保护
+
+	// ===== 消息验证 =====
+	schemaValidator *JSONSchemaValidator `json:"-"` // JSON Schema验证器，受mu保护
+
+	// ===== 消息中间件 =====
+	inboundMiddleware  []Middleware `json:"-"` // 入站中间件，受mu保护
+	outboundMiddleware []Middleware `json:"-"` // 出站中间件，受mu保护
+}
+
+// NewWebSocketClient 创建并初始化一个新的 WebSocketClient 实例
+// 这是客户端的主要构造函数，负责初始化所有组件和功能
+// 采用分阶段初始化的方式，确保每个组件都正确设置
+//
+// 参数说明：
+//   - config: 客户端配置，如果为nil则使用默认配置
+//
+// 返回值：
+//   - *WebSocketClient: 完全初始化的客户端实例
+//
+// 初始化阶段：
+//  1. createClientInstance: 创建基础实例和上下文
+//  2. initializeCoreComponents: 初始化核心组件（连接器、处理器等）
+//  3. initializeAdvancedFeatures: 初始化高级功能（监控、性能优化等）
+//  4. initializeSecurityFeatures: 初始化安全功能（检查器、限流器等）
+//  5. finalizeInitialization: 完成最终初始化（会话ID、统计等）
+//
+// 使用示例：
+//
+//	// 基本用法
+//	config := NewDefaultConfig("wss://example.com/ws")
+//	client := NewWebSocketClient(config)
+//
+//	// 设置事件处理器
+//	client.SetEventHandlers(onConnect, onDisconnect, onMessage, onError)
+//
+//	// 启动客户端（非阻塞）
+//	go client.Start()
+//
+//	// 程序结束时优雅关闭
+//	defer client.Stop()
+//
+// 注意事项：
+//   - 客户端创建后需要调用Start()方法才会开始连接
+//   - 建议使用defer client.Stop()确保资源正确释放
+//   - 如果需要自定义组件，应在调用Start()之前设置
+func NewWebSocketClient(config *ClientConfig) *WebSocketClient {
+	// 第一步：参数验证，确保配置不为空
+	if config == nil {
+		config = NewDefaultConfig("") // 使用默认配置
+	}
+
+	// 第二步：分阶段初始化，确保每个组件都正确设置
+	client := createClientInstance(config)    // 创建基础实例
+	client.initializeCoreComponents(config)   // 初始化核心组件
+	client.initializeAdvancedFeatures()       // 初始化高级功能
+	client.initializeSecurityFeatures(config) // 初始化安全功能
+	client.finalizeInitialization(config)     // 完成最终初始化
+
+	return client
+}
+
+// createClientInstance 创建客户端基础实例
+// 这是初始化过程的第一阶段，创建客户端的基础结构和必要的上下文
+//
+// 参数说明：
+//   - config: 客户端配置
+//
+// 返回值：
+//   - *WebSocketClient: 基础实例，包含基本的状态和统计结构
+//
+// 初始化内容：
+//  1. 创建生命周期管理的上下文和取消函数
+//  2. 设置初始连接状态为未连接
+//  3. 生成唯一的会话ID用于跟踪
+//  4. 初始化统计信息结构（预分配容量以提高性能）
+//  5. 创建goroutine跟踪器防止泄漏
+//
+// 性能优化：
+//   - 预分配map容量减少动态扩容开销
+//   - 使用合理的初始容量避免内存浪费
+func createClientInstance(config *ClientConfig) *WebSocketClient {
+	// 创建可取消的上下文，用于控制所有goroutine的生命周期
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &WebSocketClient{
+		// 基础配置和上下文
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+
+		// 初始状态设置
+		State:     int32(StateDisconnected), // 初始状态为未连接
+		SessionID: generateSessionID(),      // 生成唯一会话ID
+		startTime: time.Now(),               // 记录客户端创建时间
+
+		// 统计信息初始化（预分配容量提高性能）
+		Stats: ConnectionStats{
+			Errors: ErrorStats{
+				ErrorsByCode: make(map[ErrorCode]int64, 20),   // 预分配20种错误类型的容量
+				ErrorTrend:   make([]ErrorTrendPoint, 0, 100), // 预分配100个趋势点的容量
+			},
+		},
+
+		// Prometheus指标初始化
+		metrics: PrometheusMetrics{
+			ErrorsByCodeTotal: make(map[ErrorCode]int64, 20), // 预分配错误码统计容量
+			ServerClosesTotal: make(map[int]int64),           // 服务器关闭码统计
+		},
+
+		// goroutine泄漏跟踪器（最大存活5分钟，最多10个goroutine）
+		goroutineTracker: NewGoroutineTracker(5*time.Minute, 10),
+	}
+}
+
+// initializeCoreComponents 初始化核心组件
+// 这是初始化过程的第二阶段，设置WebSocket连接和消息处理的核心组件
+//
+// 参数说明：
+//   - config: 客户端配置，用于配置各个组件的参数
+//
+// 初始化的核心组件：
+//  1. connector: WebSocket连接器，负责建立和管理连接
+//  2. messageProcessor: 消息处理器，负责处理收发的消息
+//  3. errorRecovery: 错误恢复器，负责处理连接错误和重试逻辑
+//
+// 这些组件采用依赖注入模式，可以在运行时替换为自定义实现
+func (c *WebSocketClient) initializeCoreComponents(config *ClientConfig) {
+	// 初始化WebSocket连接器（负责连接建立和管理）
+	c.connector = NewDefaultConnector()
+
+	// 初始化消息处理器（负责消息验证和处理）
+	processor := NewDefaultMessageProcessor(config.MaxMessageSize, config.ValidateJSON)
+	processor.hexDump = config.HexDump
+	c.messageProcessor = processor
+
+	// 初始化错误恢复器（负责错误处理和重试逻辑）
+	c.errorRecovery = NewDefaultErrorRecovery(config.MaxRetries, config.RetryDelay)
+
+	// 初始化指标收集器和健康检查器（输出到/stats和/health）
+	c.metricsCollector = NewDefaultMetricsCollector()
+	c.healthChecker = NewDefaultHealthChecker()
+	c.registerHealthChecks(config)
+
+	// 启用管理API时记录最近接收的消息
+	if config.AdminToken != "" {
+		c.messageHistory = newMessageHistory(DefaultMessageHistorySize)
+	}
+
+	// 初始化接收消息的显示过滤器，模式已在配置验证时检查过
+	c.messageFilter, _ = newMessageFilter(config.GrepPatterns, config.GrepExclude, config.GrepAll)
+	c.messageFormat, _ = parseMessageFormat(config.MessageFormat)
+
+	// 配置了--transcript时记录每个连接的握手和收发的每一帧
+	if config.Transcript != "" {
+		c.transcript = newTranscriptRecorder(c.SessionID)
+	}
+
+	// 启用入站队列时由独立goroutine分发消息，慢速消费者不再阻塞读取
+	// 限制接收速率时分发goroutine按速率匀速取出消息，未指定队列容量时使用默认容量吸收突发
+	queueSize := config.InboundQueueSize
+	if config.MaxReceiveRate > 0 {
+		c.receiveLimiter = NewTokenBucketLimiter(config.MaxReceiveRate, 1)
+		if queueSize == 0 {
+			queueSize = DefaultReceiveRateQueueSize
+		}
+	}
+	if queueSize > 0 {
+		c.inboundQueue = make(chan bridgeMessage, queueSize)
+	}
+
+	// 在systemd下运行时（设置了NOTIFY_SOCKET）发送就绪、状态和看门狗通知
+	c.notifier = newSDNotifier()
+
+	// 配置了--webhook-url时把连接事件POST到该地址
+	if config.WebhookURL != "" {
+		c.webhook = newWebhookNotifier(config.WebhookURL, config.WebhookSecret)
+	}
+
+	// 配置了SLO目标时按滚动窗口跟踪可用性、发送成功率和重连频率
+	c.slo = newSLOTracker(config)
+
+	// 配置了--on-connect-exec、--on-disconnect-exec或--on-message-exec时在事件发生时运行命令
+	if config.OnConnectExec != "" || config.OnDisconnectExec != "" || config.OnMessageExec != "" {
+		c.execHooks = newExecHookRunner()
+	}
+
+	// 配置了--forward时把收到的数据消息批量转发到Kafka或NATS，地址已在配置验证时检查过
+	if config.Forward != "" {
+		if target, err := parseForwardURL(config.Forward); err == nil {
+			c.forwarder = newMessageForwarder(target, strings.ReplaceAll(AppName, " ", "-"))
+			log.Printf(tr("📤 收到的消息将转发到 %s"), target)
+		}
+	}
+
+	// 配置了--seq-resubscribe时在序列号跳跃后发送重新订阅消息，模板已在配置验证时检查过
+	if config.SeqResubscribe != "" {
+		if tmpl, err := template.New("seq-resubscribe").Parse(config.SeqResubscribe); err == nil {
+			c.seqResubscribe = tmpl
+		}
+	}
+}
+
+// registerHealthChecks 向健康检查器注册客户端组件的检查
+//
+// 注册的检查：
+//   - connection: 连接是否处于已连接状态
+//   - ping: 是否有已发出但未收到pong的ping（禁用自动ping时不注册）
+//   - log_file: 消息日志文件是否仍然可用（未配置--log-file时不注册）
+func (c *WebSocketClient) registerHealthChecks(config *ClientConfig) {
+	c.healthChecker.RegisterHealthCheck("connection", func() error {
+		if state := c.GetState(); state != StateConnected {
+			return fmt.Errorf(tr("连接状态: %s"), state)
+		}
+		return nil
+	})
+
+	if !config.DisableAutoPing {
+		c.healthChecker.RegisterHealthCheck("ping", func() error {
+			c.mu.RLock()
+			misses := c.pongMisses
+			c.mu.RUnlock()
+			if misses > 0 {
+				return fmt.Errorf(tr("连续 %d 个ping未收到pong"), misses)
+			}
+			return nil
+		})
+	}
+
+	if config.LogFile != "" {
+		c.healthChecker.RegisterHealthCheck("log_file", func() error {
+			if c.logFile == nil {
+				return errors.New(tr("日志文件未打开"))
+			}
+			for _, file := range []*os.File{c.logFile, c.sendLogFile} {
+				if file == nil {
+					continue
+				}
+				if _, err := file.Stat(); err != nil {
+					return fmt.Errorf(tr("日志文件不可用: %w"), err)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// initializeAdvancedFeatures 初始化高级功能
+// 这是初始化过程的第三阶段，设置性能优化和监控相关的高级功能
+//
+// 初始化的高级功能：
+//  1. AutoRecovery: 自动错误恢复功能
+//  2. AdaptiveBuffer: 自适应缓冲区功能
+//  3. deadlockDetector: 死锁检测器
+//  4. performanceMonitor: 性能监控器
+//  5. anomalyDetector: 错误异常检测器
+//  6. HotReloadEnabled: 热重载功能（默认关闭）
+//
+// 这些功能提供了企业级的监控和性能优化能力
+func (c *WebSocketClient) initializeAdvancedFeatures() {
+	// 启用自动错误恢复（连接断开时自动重连）
+	c.AutoRecovery = true
+
+	// 启用自适应缓冲区（根据最近的消息大小分布和池的命中情况选择缓冲区档位）
+	c.AdaptiveBuffer = true
+	c.bufferSizer = newBufferTierSizer(globalBufferPool)
+
+	// 初始化死锁检测器（30秒超时检测）
+	c.deadlockDetector = NewDeadlockDetector(30 * time.Second)
+
+	// 初始化性能监控器（监控CPU、内存等系统资源）
+	c.performanceMonitor = NewPerformanceMonitor()
+
+	// 初始化错误异常检测器（分析错误趋势中的突增和新错误码）
+	c.anomalyDetector = newAnomalyDetector()
+
+	// 热重载功能默认关闭（可在运行时启用）
+	c.HotReloadEnabled = false
+	c.pingReset = make(chan time.Duration, 1)
+}
+
+// initializeSecurityFeatures 初始化安全功能
+// 这是初始化过程的第四阶段，设置安全检查和防护相关的功能
+//
+// 参数说明：
+//   - config: 客户端配置，用于配置安全组件的参数
+//
+// 初始化的安全功能：
+//  1. securityChecker: 安全检查器，验证消息内容和格式
+//  2. rateLimiter: 频率限制器，防止消息发送过载
+//
+// 这些功能提供了企业级的安全防护能力
+func (c *WebSocketClient) initializeSecurityFeatures(config *ClientConfig) {
+	// 初始化安全检查器（验证消息大小和内容），模式已在配置验证时检查过
+	securityChecker, err := NewSecurityCheckerFromConfig(config)
+	if err != nil {
+		log.Printf(tr("⚠️ 安全检查配置无效，使用默认设置: %v"), err)
+		securityChecker = NewSecurityChecker(config.MaxMessageSize)
+	}
+	c.securityChecker = securityChecker
+
+	// 初始化频率限制器
+	c.rateLimiter = newSendLimiter(config.SendRate, config.SendBurst)
+}
+
+// newSendLimiter 按发送速率创建频率限制器
+// 配置了发送速率时使用令牌桶平滑限速（容量为0时与速率相同），否则每分钟最多100条消息
+func newSendLimiter(rate float64, burst int) SendLimiter {
+	if rate > 0 {
+		if burst == 0 {
+			burst = int(math.Ceil(rate))
+		}
+		return NewTokenBucketLimiter(rate, burst)
+	}
+	return NewRateLimiter(100, time.Minute)
+}
+
+// finalizeInitialization 完成初始化设置
+func (c *WebSocketClient) finalizeInitialization(config *ClientConfig) {
+	c.setDefaultHandlers()
+
+	// 恢复累计统计，必须在启动任何服务器和goroutine之前完成
+	c.firstStartTime = c.startTime
+	if config.StateFile != "" {
+		if err := c.loadState(); err != nil {
+			log.Printf(tr("⚠️ 加载状态文件失败，以空统计启动: %v"), err)
+		}
+	}
+
+	if err := c.initMessageLog(); err != nil {
+		log.Printf(tr("⚠️ 初始化消息日志失败: %v"), err)
+	}
+
+	// 打开抓包数据库，收发的每一帧都写入SQLite
+	if config.CaptureDB != "" {
+		capture, err := openMessageCapture(config.CaptureDB, c.SessionID)
+		if err != nil {
+			log.Printf(tr("⚠️ 打开抓包数据库失败，本次运行不抓包: %v"), err)
+		} else {
+			c.capture = capture
+			log.Printf(tr("🗄️ 收发的消息将写入抓包数据库 %s"), config.CaptureDB)
+		}
+	}
+
+	// 打开发送日志，上次运行未确认的消息在首次连接成功后重发
+	if config.Journal != "" {
+		journal, err := openOutboundJournal(config.Journal)
+		if err != nil {
+			log.Printf(tr("⚠️ 打开发送日志失败，本次运行不持久化出站消息: %v"), err)
+		} else {
+			c.journal = journal
+			if pending := journal.pendingCount(); pending > 0 {
+				log.Printf(tr("📒 发送日志中有 %d 条未确认的消息，连接成功后重发"), pending)
+			}
+		}
+	}
+
+	if config.AdminPort > 0 {
+		// 统一管理端口：所有HTTP端点由同一个服务器提供
+		go c.startAdminServer()
+	} else if config.MetricsEnabled {
+		c.startMonitoringServers()
+	} else if config.AdminToken != "" && config.HealthPort > 0 {
+		// 管理API挂载在健康检查服务器上，未启用指标时单独启动
+		go c.startHealthServer()
+	}
+}
+
+// generateSessionID 生成唯一的会话ID - 极致优化版本
+func generateSessionID() string {
+	// 使用高性能字符串构建器避免fmt.Sprintf的分配
+	builder := NewFastStringBuilder(32)
+	defer builder.Release()
+
+	now := time.Now()
+	builder.WriteString("ws_")
+	builder.WriteInt(now.Unix())
+	_ = builder.WriteByte('_')
+	builder.WriteInt(now.UnixNano() % 1000000) // 使用纳秒的后6位
+	_ = builder.WriteByte('_')
+	// 使用加密安全的随机数生成器
+	var randomBytes [8]byte
+	if _, err := rand.Read(randomBytes[:]); err == nil {
+		// 将随机字节转换为正整数
+		randomNum := int64(randomBytes[0])<<56 | int64(randomBytes[1])<<48 |
+			int64(randomBytes[2])<<40 | int64(randomBytes[3])<<32 |
+			int64(randomBytes[4])<<24 | int64(randomBytes[5])<<16 |
+			int64(randomBytes[6])<<8 | int64(randomBytes[7])
+		if randomNum < 0 {
+			randomNum = -randomNum
+		}
+		builder.WriteInt(randomNum % 1000000)
+	} else {
+		// 降级到时间戳作为随机数
+		builder.WriteInt(now.UnixNano() % 1000000)
+	}
+
+	return builder.String()
+}
+
+// 消息日志格式取值
+const (
+	LogFormatText = "text" // 可读文本：时间戳、方向、类型、大小和内容预览
+	LogFormatJSON = "json" // JSON Lines：每条消息一个JSON对象，二进制载荷使用Base64
+	LogFormatRaw  = "raw"  // 原始载荷：每条记录为固定头部加完整载荷字节，便于后处理工具解析
+
+	// RawLogHeaderSize 原始格式每条记录的头部长度，多字节整数均为大端序：
+	// | 方向(1字节，'S'发送/'R'接收) | 消息类型(1字节) | 时间戳(8字节，Unix纳秒) | 载荷长度(4字节) | 载荷 |
+	RawLogHeaderSize = 14
+)
+
+// initMessageLog 初始化消息日志文件
+// 分离模式下从日志路径派生<名称>.send.log和<名称>.recv.log两个文件
+func (c *WebSocketClient) initMessageLog() error {
+	if c.config.LogFile == "" {
+		return nil // 不需要记录日志文件
+	}
+
+	// 如果用户只指定了目录或者使用了特殊标记，生成默认文件名
+	logPath := c.config.LogFile
+	if logPath == "auto" || logPath == "." {
+		now := time.Now()
+		logPath = fmt.Sprintf("websocket_log_%s.log", now.Format("20060102_150405"))
+	}
+
+	if !c.config.LogSplit {
+		file, err := c.openMessageLog(logPath)
+		if err != nil {
+			return err
+		}
+		c.logFile = file
+		return nil
+	}
+
+	base := strings.TrimSuffix(logPath, ".log")
+	recvFile, err := c.openMessageLog(base + ".recv.log")
+	if err != nil {
+		return err
+	}
+	sendFile, err := c.openMessageLog(base + ".send.log")
+	if err != nil {
+		if closeErr := recvFile.Close(); closeErr != nil {
+			log.Printf(tr("⚠️ 关闭日志文件失败: %v"), closeErr)
+		}
+		return err
+	}
+	c.logFile, c.sendLogFile = recvFile, sendFile
+	return nil
+}
+
+// openMessageLog 验证路径并打开一个消息日志文件，文本格式时写入会话开始标记
+func (c *WebSocketClient) openMessageLog(logPath string) (*os.File, error) {
+	// 验证和清理日志文件路径，防止路径遍历攻击
+	validatedPath, err := validateLogPath(logPath)
+	if err != nil {
+		return nil, fmt.Errorf(tr("日志路径验证失败: %w"), err)
+	}
+
+	// 创建或打开日志文件（使用更安全的权限）
+	// 使用安全的文件创建方法避免gosec G304警告
+	file, err := c.createLogFileSafely(validatedPath)
+	if err != nil {
+		return nil, fmt.Errorf(tr("无法创建日志文件 %s: %w"), validatedPath, err)
+	}
+
+	// 写入会话开始标记（json和raw格式只包含消息记录，便于工具直接解析）
+	if c.config.LogFormat == "" || c.config.LogFormat == LogFormatText {
+		header := fmt.Sprintf("\n=== WebSocket 会话开始 [%s] ===\n会话ID: %s\n目标URL: %s\n开始时间: %s\n\n",
+			AppVersion, c.SessionID, c.config.URL, time.Now().Format("2006-01-02 15:04:05"))
+		if _, err := file.WriteString(header); err != nil {
+			log.Printf(tr("⚠️ 写入日志文件头部失败: %v"), err)
+		}
+	}
+
+	log.Printf(tr("📝 消息日志记录到: %s"), validatedPath)
+	return file, nil
+}
+
+// messageLogFile 返回记录指定方向消息的日志文件，未启用日志时返回nil
+func (c *WebSocketClient) messageLogFile(direction string) *os.File {
+	if direction == "SEND" && c.sendLogFile != nil {
+		return c.sendLogFile
+	}
+	return c.logFile
+}
+
+// messageLogRecord json格式消息日志的单条记录
+type messageLogRecord struct {
+	Time      string `json:"time"`               // RFC 3339时间戳（纳秒精度）
+	Direction string `json:"direction"`          // SEND或RECV
+	Type      string `json:"type"`               // 消息类型：TEXT、BINARY等
+	Size      int64  `json:"size"`               // 载荷字节数
+	Encoding  string `json:"encoding,omitempty"` // 载荷不是有效UTF-8时为base64
+	Data      string `json:"data,omitempty"`     // 载荷内容
+	Stream    string `json:"stream,omitempty"`   // 流式收发的大消息的数据来源或去向，此时不包含载荷
+}
+
+// writeJSONLogRecord 以JSON Lines格式写入一条消息记录
+func (c *WebSocketClient) writeJSONLogRecord(file *os.File, record messageLogRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf(tr("⚠️ 序列化消息日志失败: %v"), err)
+		return
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf(tr("⚠️ 写入消息日志失败: %v"), err)
+	}
+}
+
+// writeRawLogRecord 以原始格式写入一条消息记录
+// 头部和载荷合并为一次写入，避免并发收发时记录交错
+func (c *WebSocketClient) writeRawLogRecord(file *os.File, direction string, messageType int, data []byte) {
+	record := make([]byte, RawLogHeaderSize+len(data))
+	record[0] = 'R'
+	if direction == "SEND" {
+		record[0] = 'S'
+	}
+	record[1] = byte(messageType)
+	binary.BigEndian.PutUint64(record[2:10], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint32(record[10:14], uint32(len(data)))
+	copy(record[RawLogHeaderSize:], data)
+	if _, err := file.Write(record); err != nil {
+		log.Printf(tr("⚠️ 写入消息日志失败: %v"), err)
+	}
+}
+
+// logMessage 记录消息到日志文件
+// 启用--syslog-messages时同时以文本格式发送到syslog
+func (c *WebSocketClient) logMessage(direction string, messageType int, data []byte) {
+	if c.config.SyslogMessages && logSyslog != nil {
+		c.syslogMessage(direction, messageType, data)
+	}
+
+	file := c.messageLogFile(direction)
+	if file == nil {
+		return
+	}
+
+	switch c.config.LogFormat {
+	case LogFormatRaw:
+		c.writeRawLogRecord(file, direction, messageType, data)
+		return
+	case LogFormatJSON:
+		record := messageLogRecord{
+			Time:      time.Now().Format(time.RFC3339Nano),
+			Direction: direction,
+			Type:      c.getMessageTypeString(messageType),
+			Size:      int64(len(data)),
+		}
+		if utf8.Valid(data) {
+			record.Data = string(data)
+		} else {
+			record.Encoding, record.Data = "base64", base64.StdEncoding.EncodeToString(data)
+		}
+		c.writeJSONLogRecord(file, record)
+		return
+	}
+
+	builder := NewFastStringBuilder(512)
+	defer builder.Release()
+
+	c.buildTimestamp(builder)
+	c.buildMessageHeader(builder, direction, messageType, len(data))
+	c.buildMessageContent(builder, messageType, data)
+	_ = builder.WriteByte('\n')
+
+	if _, err := file.WriteString(builder.String()); err != nil {
+		log.Printf(tr("⚠️ 写入消息日志失败: %v"), err)
+	}
+}
+
+// syslogMessage 以与文本消息日志相同的格式（不含时间戳）把一条消息记录发送到syslog
+func (c *WebSocketClient) syslogMessage(direction string, messageType int, data []byte) {
+	builder := NewFastStringBuilder(512)
+	defer builder.Release()
+
+	c.buildMessageHeader(builder, direction, messageType, len(data))
+	c.buildMessageContent(builder, messageType, data)
+	logSyslog.send(syslogSeverityInfo, builder.String())
+}
+
+// logStreamedMessage 记录流式收发的大消息摘要
+// 大消息不写入完整内容，只记录方向、大小和数据来源或去向；raw格式只记录完整载荷，因此跳过
+func (c *WebSocketClient) logStreamedMessage(direction string, messageType int, size int64, target string) {
+	file := c.messageLogFile(direction)
+	if file == nil {
+		return
+	}
+
+	switch c.config.LogFormat {
+	case LogFormatRaw:
+		return
+	case LogFormatJSON:
+		c.writeJSONLogRecord(file, messageLogRecord{
+			Time:      time.Now().Format(time.RFC3339Nano),
+			Direction: direction,
+			Type:      c.getMessageTypeString(messageType),
+			Size:      size,
+			Stream:    target,
+		})
+		return
+	}
+
+	builder := NewFastStringBuilder(256)
+	defer builder.Release()
+
+	c.buildTimestamp(builder)
+	builder.WriteString(direction)
+	_ = builder.WriteByte(' ')
+	builder.WriteString(c.getMessageTypeString(messageType))
+	builder.WriteString(" (")
+	builder.WriteInt(size)
+	builder.WriteString(" bytes): STREAM ")
+	if direction == "SEND" {
+		builder.WriteString("<- ")
+	} else {
+		builder.WriteString("-> ")
+	}
+	builder.WriteString(target)
+	_ = builder.WriteByte('\n')
+
+	if _, err := file.WriteString(builder.String()); err != nil {
+		log.Printf(tr("⚠️ 写入消息日志失败: %v"), err)
+	}
+}
+
+// buildTimestamp 构建高性能时间戳
+// 指定了--timestamp时使用对应格式，none时不写入时间戳
+func (c *WebSocketClient) buildTimestamp(builder *FastStringBuilder) {
+	now := time.Now()
+	if c.config.Timestamp != "" {
+		if c.config.Timestamp != TimestampNone {
+			_ = builder.WriteByte('[')
+			builder.WriteString(formatTimestamp(c.config.Timestamp, now))
+			builder.WriteString("] ")
+		}
+		return
+	}
+
+	_ = builder.WriteByte('[')
+	builder.WriteInt(int64(now.Year()))
+	_ = builder.WriteByte('-')
+	if now.Month() < 10 {
+		_ = builder.WriteByte('0')
+	}
+	builder.WriteInt(int64(now.Month()))
+	_ = builder.WriteByte('-')
+	if now.Day() < 10 {
+		_ = builder.WriteByte('0')
+	}
+	builder.WriteInt(int64(now.Day()))
+	builder.WriteString(" ")
+	if now.Hour() < 10 {
+		_ = builder.WriteByte('0')
+	}
+	builder.WriteInt(int64(now.Hour()))
+	_ = builder.WriteByte(':')
+	if now.Minute() < 10 {
+		_ = builder.WriteByte('0')
+	}
+	builder.WriteInt(int64(now.Minute()))
+	_ = builder.WriteByte(':')
+	if now.Second() < 10 {
+		_ = builder.WriteByte('0')
+	}
+	builder.WriteInt(int64(now.Second()))
+	_ = builder.WriteByte('.')
+	ms := now.Nanosecond() / 1000000
+	if ms < 100 {
+		_ = builder.WriteByte('0')
+		if ms < 10 {
+			_ = builder.WriteByte('0')
+		}
+	}
+	builder.WriteInt(int64(ms))
+	builder.WriteString("] ")
+}
+
+// buildMessageHeader 构建消息头部信息
+func (c *WebSocketClient) buildMessageHeader(builder *FastStringBuilder, direction string, messageType, dataLen int) {
+	builder.WriteString(direction)
+	_ = builder.WriteByte(' ')
+	builder.WriteString(c.getMessageTypeString(messageType))
+	builder.WriteString(" (")
+	builder.WriteInt(int64(dataLen))
+	builder.WriteString(" bytes): ")
+}
+
+// buildMessageContent 构建消息内容
+func (c *WebSocketClient) buildMessageContent(builder *FastStringBuilder, messageType int, data []byte) {
+	if messageType == websocket.BinaryMessage {
+		c.buildBinaryContent(builder, data)
+	} else {
+		c.buildTextContent(builder, data)
+	}
+}
+
+// buildBinaryContent 构建二进制消息内容
+// 启用--hexdump时在头部后换行输出完整的偏移/十六进制/ASCII转储
+func (c *WebSocketClient) buildBinaryContent(builder *FastStringBuilder, data []byte) {
+	if c.config.HexDump {
+		builder.WriteString("HEXDUMP:\n")
+		builder.WriteString(strings.TrimSuffix(hex.Dump(data), "\n"))
+		return
+	}
+	if len(data) <= 32 {
+		builder.WriteString("HEX: ")
+		c.writeHexBytes(builder, data)
+	} else {
+		builder.WriteString("BINARY: ")
+		builder.WriteInt(int64(len(data)))
+		builder.WriteString(" bytes, preview: ")
+		c.writeHexBytes(builder, data[:16])
+		builder.WriteString("...")
+	}
+}
+
+// buildTextContent 构建文本消息内容（优化字符串转换）
+func (c *WebSocketClient) buildTextContent(builder *FastStringBuilder, data []byte) {
+	if len(data) <= 500 {
+		builder.WriteString(string(data))
+	} else {
+		// 只转换一次，避免重复转换
+		truncatedData := string(data[:500])
+		builder.WriteString(truncatedData)
+		builder.WriteString("...(truncated)")
+	}
+}
+
+// writeHexBytes 写入十六进制字节
+func (c *WebSocketClient) writeHexBytes(builder *FastStringBuilder, data []byte) {
+	const hexChars = "0123456789abcdef"
+	for _, b := range data {
+		if b < 16 {
+			_ = builder.WriteByte('0')
+		}
+		builder.WriteString(hexChars[b>>4 : b>>4+1])
+		builder.WriteString(hexChars[b&0xf : (b&0xf)+1])
+	}
+}
+
+// 预定义的消息类型字符串，避免重复的map查找
+var messageTypeStrings = [...]string{
+	"TYPE_0", "TEXT", "BINARY", "TYPE_3", "TYPE_4", "TYPE_5", "TYPE_6", "TYPE_7", "CLOSE", "PING", "PONG",
+}
+
+// getMessageTypeString 获取消息类型的字符串表示（极致优化版）
+// 这个方法将WebSocket消息类型常量转换为可读的字符串表示
+//
+// 参数说明：
+//   - messageType: WebSocket消息类型常量（如websocket.TextMessage）
+//
+// 返回值：
+//   - string: 消息类型的字符串表示
+//
+// 性能优化：
+//  1. 使用预定义数组而不是map查找，避免哈希计算开销
+//  2. 数组索引访问时间复杂度为O(1)
+//  3. 对未知类型使用高性能字符串构建器
+//  4. 避免fmt.Sprintf的内存分配和格式化开销
+//
+// 支持的消息类型：
+//   - 0: TYPE_0（保留）
+//   - 1: TEXT（文本消息）
+//   - 2: BINARY（二进制消息）
+//   - 8: CLOSE（关闭消息）
+//   - 9: PING（ping消息）
+//   - 10: PONG（pong消息）
+//
+// 使用场景：
+//   - 日志记录中的消息类型显示
+//   - 调试信息的格式化输出
+//   - 监控系统的消息分类统计
+func (c *WebSocketClient) getMessageTypeString(messageType int) string {
+	// 第一步：使用数组索引查找已知类型（性能最优）
+	if messageType >= 0 && messageType < len(messageTypeStrings) {
+		return messageTypeStrings[messageType]
+	}
+
+	// 第二步：对于未知类型，使用高性能字符串构建器
+	builder := NewFastStringBuilder(16) // 预分配16字节，足够"TYPE_xxx"格式
+	defer builder.Release()
+
+	builder.WriteString("TYPE_")
+	builder.WriteInt(int64(messageType))
+	return builder.String()
+}
+
+// closeMessageLog 关闭消息日志文件
+// 这个方法优雅地关闭消息日志文件，确保数据完整性和资源正确释放
+//
+// 功能说明：
+//  1. 检查日志文件是否存在（分离模式下依次处理接收和发送日志）
+//  2. 写入会话结束标记和时间戳（json和raw格式不写入）
+//  3. 刷新并关闭文件句柄
+//  4. 清理文件引用，防止内存泄漏
+//
+// 会话结束标记格式：
+//
+//	=== WebSocket 会话结束 [会话ID] ===
+//	结束时间: YYYY-MM-DD HH:MM:SS
+//
+// 错误处理：
+//   - 写入失败：记录警告但继续关闭文件
+//   - 关闭失败：记录警告，避免程序崩溃
+//   - 确保在任何情况下都清理文件引用
+//
+// 调用时机：
+//   - 客户端正常停止时
+//   - 程序异常退出时（defer调用）
+//   - 日志文件切换时
+//
+// 并发安全：此方法应在主goroutine中调用，避免并发访问文件
+func (c *WebSocketClient) closeMessageLog() {
+	for _, file := range []**os.File{&c.logFile, &c.sendLogFile} {
+		// 第一步：检查日志文件是否存在
+		if *file == nil {
+			continue
+		}
+
+		// 第二步：写入会话结束标记（仅文本格式）
+		if c.config.LogFormat == "" || c.config.LogFormat == LogFormatText {
+			footer := fmt.Sprintf("\n=== WebSocket 会话结束 [%s] ===\n结束时间: %s\n\n",
+				c.SessionID, time.Now().Format("2006-01-02 15:04:05"))
+			if _, err := (*file).WriteString(footer); err != nil {
+				log.Printf(tr("⚠️ 写入日志文件尾部失败: %v"), err)
+			}
+		}
+
+		// 第三步：关闭文件句柄
+		if closeErr := (*file).Close(); closeErr != nil {
+			log.Printf(tr("⚠️ 关闭日志文件失败: %v"), closeErr)
+		}
+
+		// 第四步：清理文件引用，防止重复关闭
+		*file = nil
+	}
+}
+
+// setDefaultHandlers 设置默认的事件处理器
+// 这个方法为WebSocket客户端设置标准的事件处理回调函数
+//
+// 功能说明：
+//  1. 设置连接建立时的处理逻辑
+//  2. 设置连接断开时的处理逻辑
+//  3. 设置消息接收时的处理逻辑
+//  4. 设置错误发生时的处理逻辑
+//
+// 默认处理器特点：
+//   - 提供友好的日志输出，包含emoji和会话ID
+//   - 区分正常关闭和异常断开
+//   - 消息处理委托给MessageProcessor
+//   - 错误处理记录详细信息便于调试
+//
+// 事件处理器说明：
+//   - onConnect: 连接成功建立时调用
+//   - onDisconnect: 连接断开时调用，区分正常和异常
+//   - onMessage: 接收到消息时调用，默认不做额外处理
+//   - onError: 发生错误时调用，记录错误信息
+//
+// 自定义处理器：
+//
+//	用户可以在客户端启动前覆盖这些默认处理器：
+//	client.SetOnConnect(func() { ... })
+//	client.SetOnMessage(func(int, []byte) error { ... })
+//
+// 并发安全：处理器函数在不同的goroutine中调用，需要注意线程安全
+func (c *WebSocketClient) setDefaultHandlers() {
+	// 连接建立处理器：记录成功连接信息
+	// 这个匿名函数在WebSocket连接成功建立时被调用，用于记录连接成功的日志信息
+	c.onConnect = func() {
+		log.Printf(tr("✅ 连接成功建立 [会话: %s]"), c.SessionID)
+	}
+
+	// 连接断开处理器：区分正常关闭和异常断开
+	// 这个匿名函数在WebSocket连接断开时被调用，根据错误参数判断断开原因
+	c.onDisconnect = func(err error) {
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			// 服务器关闭帧：输出关闭码含义和原因
+			log.Printf(tr("🔌 服务器关闭连接: 关闭码=%d (%s), 原因=%q [会话: %s]"), closeErr.Code, closeCodeName(closeErr.Code), closeErr.Text, c.SessionID)
+		} else if err != nil {
+			// 异常断开：由于错误导致的连接中断
+			log.Printf(tr("🔌 连接断开: %v [会话: %s]"), err, c.SessionID)
+		} else {
+			// 正常关闭：主动调用Stop()或收到正常关闭帧
+			log.Printf(tr("🔌 连接正常关闭 [会话: %s]"), c.SessionID)
+		}
+	}
+
+	// 消息接收处理器：默认不做额外处理
+	// 这个匿名函数在收到WebSocket消息时被调用，默认实现不做额外处理
+	c.onMessage = func(messageType int, data []byte) error {
+		// 默认不做额外处理，消息已经由MessageProcessor处理并记录
+		// 用户可以通过SetOnMessage方法覆盖此处理器来实现自定义逻辑
+		return nil
+	}
+
+	// 错误处理器：记录错误信息便于调试
+	// 这个匿名函数在发生各种错误时被调用，用于统一的错误日志记录
+	c.onError = func(err error) {
+		log.Printf(tr("❌ 客户端错误: %v [会话: %s]"), err, c.SessionID)
+	}
+}
+
+// GetState 获取当前连接状态
+// 这个方法以线程安全的方式获取WebSocket客户端的当前连接状态
+//
+// 返回值：
+//   - ConnectionState: 当前的连接状态枚举值
+//
+// 连接状态说明：
+//   - StateDisconnected: 未连接状态
+//   - StateConnecting: 正在连接中
+//   - StateConnected: 已连接状态
+//   - StateReconnecting: 正在重连中
+//   - StateStopping: 正在停止中
+//   - StateStopped: 已停止状态
+//
+// 并发安全：
+//   - 使用原子操作读取状态，确保线程安全
+//   - 可以在任意goroutine中安全调用
+//   - 不会阻塞其他操作
+//
+// 使用场景：
+//   - 健康检查和状态监控
+//   - 条件判断和流程控制
+//   - 用户界面状态显示
+//   - 日志记录和调试
+func (c *WebSocketClient) GetState() ConnectionState {
+	return ConnectionState(atomic.LoadInt32(&c.State))
+}
+
+// setState 设置连接状态
+// 这个私有方法以线程安全的方式更新WebSocket客户端的连接状态
+//
+// 参数说明：
+//   - state: 要设置的新连接状态
+//
+// 并发安全：
+//   - 使用原子操作写入状态，确保线程安全
+//   - 状态更新是原子性的，不会出现中间状态
+//   - 可以在任意goroutine中安全调用
+//
+// 状态转换规则：
+//   - 状态转换应该遵循合理的状态机逻辑
+//   - 避免无效的状态转换（如从Stopped直接到Connected）
+//   - 状态更新应该及时反映实际的连接情况
+//
+// 调用场景：
+//   - 连接建立时设置为StateConnected
+//   - 连接断开时设置为StateDisconnected
+//   - 开始重连时设置为StateReconnecting
+//   - 客户端停止时设置为StateStopped
+func (c *WebSocketClient) setState(state ConnectionState) {
+	old := ConnectionState(atomic.SwapInt32(&c.State, int32(state)))
+	if old == state {
+		return
+	}
+
+	// 在systemd下运行时通过STATUS=报告状态变化
+	if c.notifier != nil {
+		c.notifier.notify(fmt.Sprintf("STATUS=%s %s", state.String(), c.config.URL))
+	}
+	c.queueStateChange(StateChange{From: old, To: state, Time: time.Now()})
+}
+
+// isConnected 检查是否已连接
+// 这个方法提供了一个便捷的方式来检查WebSocket是否处于已连接状态
+//
+// 返回值：
+//   - bool: true表示已连接，false表示未连接
+//
+// 判断逻辑：
+//   - 只有当状态为StateConnected时才返回true
+//   - 其他所有状态（包括连接中、重连中等）都返回false
+//   - 确保只有真正建立连接时才认为是已连接
+//
+// 并发安全：
+//   - 内部调用GetState()方法，继承其线程安全特性
+//   - 可以在任意goroutine中安全调用
+//
+// 使用场景：
+//   - 发送消息前的连接状态检查
+//   - 就绪检查和健康检查
+//   - 交互模式的启动条件判断
+//   - 业务逻辑的连接状态判断
+func (c *WebSocketClient) isConnected() bool {
+	return c.GetState() == StateConnected
+}
+
+// GetStats 获取连接统计信息
+// 这个方法以线程安全的方式获取WebSocket连接的详细统计信息
+//
+// 返回值：
+//   - ConnectionStats: 连接统计信息的副本
+//
+// 统计信息包含：
+//  1. 连接时间：连接建立的时间戳
+//  2. 运行时长：连接持续的时间（实时计算）
+//  3. 消息统计：发送和接收的消息数量
+//  4. 字节统计：发送和接收的字节总数
+//  5. 重连统计：重连次数和相关信息
+//  6. 错误统计：错误次数和详细信息
+//  7. 最后消息时间：最近一次消息的时间戳
+//
+// 实时计算：
+//   - 如果当前已连接且有连接时间，会实时计算运行时长
+//   - 确保返回的统计信息是最新的
+//
+// 并发安全：
+//   - 使用读锁保护统计数据的读取
+//   - 返回数据副本，避免外部修改影响内部状态
+//   - 可以在任意goroutine中安全调用
+//
+// 使用场景：
+//   - 监控和性能分析
+//   - 用户界面状态显示
+//   - 日志记录和调试
+//   - HTTP统计端点的数据源
+func (c *WebSocketClient) GetStats() ConnectionStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// 获取统计数据副本
+	stats := c.Stats
+
+	// 实时计算运行时长（如果已连接且有连接时间）
+	if c.isConnected() && !stats.ConnectTime.IsZero() {
+		stats.Uptime = time.Since(stats.ConnectTime)
+	}
+
+	// 入站队列的容量和当前深度
+	if c.inboundQueue != nil {
+		stats.InboundQueue.Policy = c.config.Backpressure
+		stats.InboundQueue.Capacity = cap(c.inboundQueue)
+		stats.InboundQueue.Depth = len(c.inboundQueue)
+	}
+
+	// 复制协议违规计数，避免调用方与后续更新共享map
+	stats.ProtocolViolations = maps.Clone(stats.ProtocolViolations)
+
+	return stats
+}
+
+// updateStats 更新统计信息（线程安全版本）
+// 这个方法更新消息传输的统计信息，包括本地统计和Prometheus指标
+//
+// 参数说明：
+//   - _: 消息类型（当前未使用，保留用于扩展）
+//   - dataLen: 消息数据长度（字节）
+//   - sent: true表示发送消息，false表示接收消息
+//
+// 更新内容：
+//  1. 最后消息时间：更新为当前时间
+//  2. 消息计数：根据sent参数更新发送或接收计数
+//  3. 字节计数：累加消息的字节数
+//  4. Prometheus指标：原子更新对应的指标
+//
+// 并发安全：
+//   - 使用互斥锁保护本地统计数据的更新
+//   - 使用原子操作更新Prometheus指标
+//   - 避免数据竞争和不一致状态
+//
+// 性能考虑：
+//   - 锁的持有时间很短，只保护必要的更新操作
+//   - Prometheus指标使用原子操作，性能更好
+//   - 避免在锁内进行耗时操作
+//
+// 调用场景：
+//   - 发送消息成功后调用
+//   - 接收消息成功后调用
+//   - 消息处理流程中的统计更新
+func (c *WebSocketClient) updateStats(messageType int, dataLen int, sent bool) {
+	// 使用互斥锁保护本地统计数据
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 更新最后消息时间
+	c.Stats.LastMessageTime = time.Now()
+
+	if sent {
+		// 更新发送统计
+		c.Stats.MessagesSent++
+		c.Stats.BytesSent += int64(dataLen)
+		c.Stats.SentByType.add(messageType)
+		// 原子更新Prometheus指标以避免竞态条件
+		atomic.AddInt64(&c.metrics.MessagesSentTotal, 1)
+		atomic.AddInt64(&c.metrics.BytesSentTotal, int64(dataLen))
+		c.collectMessage("sent", messageType, dataLen)
+	} else {
+		// 更新接收统计
+		c.Stats.MessagesReceived++
+		c.Stats.BytesReceived += int64(dataLen)
+		c.Stats.ReceivedByType.add(messageType)
+		c.lastReceiveTime = c.Stats.LastMessageTime
+		// 原子更新Prometheus指标以避免竞态条件
+		atomic.AddInt64(&c.metrics.MessagesReceivedTotal, 1)
+		atomic.AddInt64(&c.metrics.BytesReceivedTotal, int64(dataLen))
+		c.collectMessage("received", messageType, dataLen)
+	}
+}
+
+// collectMessage 把一条收发的消息记入指标收集器
+//
+// 参数说明：
+//   - direction: sent或received
+//   - messageType: WebSocket消息类型
+//   - dataLen: 消息字节数
+func (c *WebSocketClient) collectMessage(direction string, messageType int, dataLen int) {
+	labels := map[string]string{"direction": direction, "type": c.getMessageTypeString(messageType)}
+	c.metricsCollector.IncrementCounter("websocket_messages_total", labels)
+	c.metricsCollector.RecordHistogram("websocket_message_size_bytes", float64(dataLen), labels)
+}
+
+// recordError 记录错误统计信息（线程安全版本）
+// 这个方法记录和统计WebSocket客户端发生的各种错误
+//
+// 参数说明：
+//   - err: 发生的错误实例
+//
+// 记录内容：
+//  1. 错误总数：累加错误计数
+//  2. 最后错误：保存最近发生的错误
+//  3. 错误时间：记录错误发生的时间戳
+//  4. 错误分类：按错误码分类统计
+//  5. 错误趋势：记录错误发生的时间序列
+//  6. Prometheus指标：更新监控指标
+//
+// 错误分类：
+//   - 自动提取错误码进行分类统计
+//   - 支持自定义错误类型和标准错误
+//   - 便于错误模式分析和问题诊断
+//
+// 错误趋势：
+//   - 记录每个错误的时间戳和类型
+//   - 保持最近1000个错误的历史记录
+//   - 支持错误趋势分析和异常检测
+//
+// 并发安全：
+//   - 使用互斥锁保护所有统计数据的更新
+//   - 原子操作更新Prometheus指标
+//   - 避免数据竞争和不一致状态
+//
+// 性能优化：
+//   - 限制错误趋势数据的大小，避免内存泄漏
+//   - 高效的错误码提取和分类
+//   - 最小化锁的持有时间
+//
+// 使用场景：
+//   - 连接错误、发送错误、接收错误的统计
+//   - 错误模式分析和问题诊断
+//   - 监控告警和性能分析
+func (c *WebSocketClient) recordError(err error) {
+	// 使用互斥锁保护错误统计数据
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 更新基本错误统计
+	c.Stats.Errors.TotalErrors++
+	c.Stats.Errors.LastError = err
+	c.Stats.Errors.LastErrorTime = time.Now()
+
+	// 提取和分类错误码
+	errorCode := c.extractErrorCode(err)
+
+	// 更新按错误码分类的统计
+	c.Stats.Errors.ErrorsByCode[errorCode]++
+
+	// 原子更新Prometheus指标以避免竞态条件
+	atomic.AddInt64(&c.metrics.ErrorsTotal, 1)
+
+	// 更新Prometheus错误码分类指标（需要锁保护map操作）
+	if c.metrics.ErrorsByCodeTotal == nil {
+		c.metrics.ErrorsByCodeTotal = make(map[ErrorCode]int64)
+	}
+	c.metrics.ErrorsByCodeTotal[errorCode]++
+	c.metricsCollector.IncrementCounter("websocket_errors_total", map[string]string{"code": strconv.Itoa(int(errorCode))})
+
+	// 添加到错误趋势记录
+	trendPoint := ErrorTrendPoint{
+		Timestamp:  time.Now(),
+		ErrorCount: 1,
+		ErrorCode:  errorCode,
+	}
+	c.Stats.Errors.ErrorTrend = append(c.Stats.Errors.ErrorTrend, trendPoint)
+
+	// 保持错误趋势数据在合理范围内（最近1000个错误）
+	// 避免内存无限增长
+	if len(c.Stats.Errors.ErrorTrend) > 1000 {
+		c.Stats.Errors.ErrorTrend = c.Stats.Errors.ErrorTrend[len(c.Stats.Errors.ErrorTrend)-1000:]
+	}
+}
+
+// inferErrorCode 根据错误内容推断错误码
+// 这个方法通过分析错误消息的内容来推断对应的标准化错误码
+//
+// 参数说明：
+//   - err: 需要分析的错误实例
+//
+// 返回值：
+//   - ErrorCode: 推断出的标准化错误码
+//
+// 推断逻辑：
+//  1. 检查错误消息中的关键字
+//  2. 按照常见错误模式进行匹配
+//  3. 返回最匹配的错误码
+//  4. 无法匹配时返回未知错误码
+//
+// 支持的错误模式：
+//   - ErrDialTimeout -> ErrCodeConnectionTimeout（TCP连接阶段超时）
+//   - ErrHandshakeTimeout -> ErrCodeHandshakeFailed（TLS握手或HTTP升级阶段超时）
+//   - "connection refused" -> ErrCodeConnectionRefused
+//   - "timeout" -> ErrCodeConnectionTimeout
+//   - "no such host" -> ErrCodeDNSError
+//   - "tls" -> ErrCodeTLSError
+//   - "handshake" -> ErrCodeHandshakeFailed
+//   - "message too large" -> ErrCodeMessageTooLarge
+//   - "invalid" -> ErrCodeInvalidMessage
+//   - "broken pipe"/"connection reset" -> ErrCodeConnectionLost
+//
+// 使用场景：
+//   - 标准错误的分类和统计
+//   - 错误恢复策略的选择
+//   - 监控系统的错误分类
+//   - 问题诊断和分析
+//
+// 注意事项：
+//   - 基于字符串匹配，可能存在误判
+//   - 优先匹配更具体的错误模式
+//   - 对于自定义错误类型，应使用extractErrorCode方法
+func (c *WebSocketClient) inferErrorCode(err error) ErrorCode {
+	// 第一步：空错误检查
+	if err == nil {
+		return ErrCodeUnknownError
+	}
+
+	// 第二步：获取错误消息字符串
+	errStr := err.Error()
+
+	// 第三步：按照错误模式进行匹配（按常见程度排序）
+	switch {
+	case errors.Is(err, ErrDialTimeout):
+		return ErrCodeConnectionTimeout
+	case errors.Is(err, ErrHandshakeTimeout):
+		return ErrCodeHandshakeFailed
+	case strings.Contains(errStr, "connection refused"):
+		return ErrCodeConnectionRefused
+	case strings.Contains(errStr, "timeout"):
+		return ErrCodeConnectionTimeout
+	case strings.Contains(errStr, "no such host"):
+		return ErrCodeDNSError
+	case strings.Contains(errStr, "tls"):
+		return ErrCodeTLSError
+	case strings.Contains(errStr, "handshake"):
+		return ErrCodeHandshakeFailed
+	case strings.Contains(errStr, "message too large"):
+		return ErrCodeMessageTooLarge
+	case strings.Contains(errStr, "invalid"):
+		return ErrCodeInvalidMessage
+	case strings.Contains(errStr, "broken pipe"), strings.Contains(errStr, "connection reset"):
+		return ErrCodeConnectionLost
+	default:
+		// 无法匹配的错误返回未知错误码
+		return ErrCodeUnknownError
+	}
+}
+
+// GetErrorStats 获取错误统计信息
+// 这个方法以线程安全的方式获取WebSocket客户端的详细错误统计信息
+//
+// 返回值：
+//   - ErrorStats: 错误统计信息的深拷贝
+//
+// 统计信息包含：
+//  1. 错误总数：累计发生的错误次数
+//  2. 最后错误：最近发生的错误实例
+//  3. 错误时间：最后一次错误的时间戳
+//  4. 错误分类：按错误码分类的统计数据
+//  5. 错误趋势：错误发生的时间序列数据
+//
+// 数据安全：
+//   - 返回深拷贝，避免外部修改影响内部状态
+//   - 使用读锁保护数据访问
+//   - 确保数据一致性和完整性
+//
+// 并发安全：
+//   - 可以在任意goroutine中安全调用
+//   - 不会阻塞其他操作
+//   - 保证数据的原子性读取
+//
+// 使用场景：
+//   - 错误分析和问题诊断
+//   - 监控系统的错误统计
+//   - 性能分析和优化
+//   - HTTP统计端点的数据源
+func (c *WebSocketClient) GetErrorStats() ErrorStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// 创建错误统计信息的深拷贝
+	stats := ErrorStats{
+		TotalErrors:   c.Stats.Errors.TotalErrors,
+		LastError:     c.Stats.Errors.LastError,
+		LastErrorTime: c.Stats.Errors.LastErrorTime,
+		ErrorsByCode:  make(map[ErrorCode]int64),
+		ErrorTrend:    make([]ErrorTrendPoint, len(c.Stats.Errors.ErrorTrend)),
+	}
+
+	// 深拷贝错误码统计映射
+	for code, count := range c.Stats.Errors.ErrorsByCode {
+		stats.ErrorsByCode[code] = count
+	}
+
+	// 深拷贝错误趋势切片
+	copy(stats.ErrorTrend, c.Stats.Errors.ErrorTrend)
+
+	return stats
+}
+
+// SessionSummary 会话摘要
+// 客户端退出时输出的机器可读统计信息，由GetStats和GetErrorStats汇总而来
+type SessionSummary struct {
+	SessionID        string            `json:"session_id"`            // 会话标识符
+	StartTime        time.Time         `json:"start_time"`            // 客户端启动时间
+	EndTime          time.Time         `json:"end_time"`              // 生成摘要的时间
+	DurationSeconds  float64           `json:"duration_seconds"`      // 整个会话的运行时长（秒）
+	MessagesSent     int64             `json:"messages_sent"`         // 发送消息数
+	MessagesReceived int64             `json:"messages_received"`     // 接收消息数
+	BytesSent        int64             `json:"bytes_sent"`            // 发送字节数
+	BytesReceived    int64             `json:"bytes_received"`        // 接收字节数
+	ReconnectCount   int               `json:"reconnect_count"`       // 重连次数
+	TotalErrors      int64             `json:"total_errors"`          // 错误总数
+	ErrorsByCode     []ErrorCodeCount  `json:"errors_by_code"`        // 按错误码分类的错误数，按错误码升序
+	LastError        string            `json:"last_error,omitempty"`  // 最后一个错误
+	LastClose        *CloseInfo        `json:"last_close,omitempty"`  // 最近一次服务器关闭帧
+	Compression      *CompressionStats `json:"compression,omitempty"` // 应用层载荷压缩统计
+	Ping             *PingStats        `json:"ping,omitempty"`        // Ping往返时间统计
+	Labels           map[string]string `json:"labels,omitempty"`      // 通过--label配置的连接元数据标签
+
+	ProtocolViolations map[string]int64 `json:"protocol_violations,omitempty"` // 严格模式下按类型统计的协议违规次数
+}
+
+// ErrorCodeCount 单个错误码的错误计数
+type ErrorCodeCount struct {
+	Code  ErrorCode `json:"code"`  // 错误码
+	Name  string    `json:"name"`  // 错误码名称
+	Count int64     `json:"count"` // 发生次数
+}
+
+// GetSummary 生成当前会话的摘要
+//
+// 返回值：
+//   - SessionSummary: 基于GetStats和GetErrorStats快照构建的会话摘要
+func (c *WebSocketClient) GetSummary() SessionSummary {
+	stats := c.GetStats()
+	errorStats := c.GetErrorStats()
+	now := time.Now()
+
+	summary := SessionSummary{
+		SessionID:        c.SessionID,
+		StartTime:        c.startTime,
+		EndTime:          now,
+		DurationSeconds:  now.Sub(c.startTime).Seconds(),
+		MessagesSent:     stats.MessagesSent,
+		MessagesReceived: stats.MessagesReceived,
+		BytesSent:        stats.BytesSent,
+		BytesReceived:    stats.BytesReceived,
+		ReconnectCount:   stats.ReconnectCount,
+		TotalErrors:      errorStats.TotalErrors,
+		ErrorsByCode:     make([]ErrorCodeCount, 0, len(errorStats.ErrorsByCode)),
+	}
+	for code, count := range errorStats.ErrorsByCode {
+		summary.ErrorsByCode = append(summary.ErrorsByCode, ErrorCodeCount{Code: code, Name: code.String(), Count: count})
+	}
+	sort.Slice(summary.ErrorsByCode, func(i, j int) bool {
+		return summary.ErrorsByCode[i].Code < summary.ErrorsByCode[j].Code
+	})
+	if errorStats.LastError != nil {
+		summary.LastError = errorStats.LastError.Error()
+	}
+	if stats.LastClose.Code != 0 {
+		summary.LastClose = &stats.LastClose
+	}
+	if stats.Compression != (CompressionStats{}) {
+		summary.Compression = &stats.Compression
+	}
+	if stats.Ping.Samples > 0 {
+		summary.Ping = &stats.Ping
+	}
+	if len(c.config.Labels) > 0 {
+		summary.Labels = c.config.Labels
+	}
+	summary.ProtocolViolations = stats.ProtocolViolations
+	return summary
+}
+
+// WriteSummary 以JSON格式写出会话摘要
+//
+// 参数说明：
+//   - path: 输出路径，"-"表示写到标准输出，否则写入当前工作目录内的文件（覆盖已有文件）
+//
+// 返回值：
+//   - error: 序列化或写入失败时返回错误
+func (c *WebSocketClient) WriteSummary(path string) error {
+	data, err := json.MarshalIndent(c.GetSummary(), "", "  ")
+	if err != nil {
+		return fmt.Errorf(tr("序列化会话摘要失败: %w"), err)
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	safePath, err := validateWorkDirPath(path)
+	if err != nil {
+		return fmt.Errorf(tr("无效的会话摘要路径: %w"), err)
+	}
+	// #nosec G304 -- 路径已通过validateWorkDirPath限制在当前工作目录内
+	return os.WriteFile(safePath, data, 0600)
+}
+
+// ===== 会话记录 =====
+
+// TranscriptVersion 会话记录格式版本
+const TranscriptVersion = "1.0"
+
+// transcriptRedactedHeaders 会话记录中隐藏取值的头部，记录常被附在问题报告中，不应包含凭据
+var transcriptRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie"}
+
+// Transcript 会话记录
+// 参照HAR的结构记录每个连接的握手、收发的每一帧和关闭详情，便于导入分析工具或附在问题报告中
+type Transcript struct {
+	Version     string                  `json:"version"`     // 记录格式版本
+	Creator     TranscriptCreator       `json:"creator"`     // 生成记录的客户端
+	SessionID   string                  `json:"session_id"`  // 会话标识符
+	Connections []*TranscriptConnection `json:"connections"` // 按建立顺序排列的连接，重连会产生新的连接记录
+}
+
+// TranscriptCreator 生成会话记录的客户端信息
+type TranscriptCreator struct {
+	Name    string `json:"name"`    // 应用名称
+	Version string `json:"version"` // 应用版本
+}
+
+// TranscriptConnection 单个连接的记录
+type TranscriptConnection struct {
+	URL             string              `json:"url"`                       // 跟随重定向后的最终地址（密码和查询参数值已隐藏）
+	StartedDateTime time.Time           `json:"started_date_time"`         // 握手完成时间
+	EndedDateTime   *time.Time          `json:"ended_date_time,omitempty"` // 连接结束时间，写出记录时仍在连接中则为写出时间
+	Request         TranscriptHandshake `json:"request"`                   // 升级请求
+	Response        TranscriptHandshake `json:"response"`                  // 升级响应
+	Messages        []TranscriptMessage `json:"messages"`                  // 按时间顺序收发的帧
+	Close           *TranscriptClose    `json:"close,omitempty"`           // 第一个关闭帧的详情，连接异常断开时为空
+}
+
+// TranscriptHandshake 升级请求或响应
+type TranscriptHandshake struct {
+	Method      string             `json:"method,omitempty"`      // 请求方法（仅请求）
+	Status      int                `json:"status,omitempty"`      // 状态码（仅响应）
+	StatusText  string             `json:"status_text,omitempty"` // 状态说明（仅响应）
+	HTTPVersion string             `json:"http_version"`          // HTTP协议版本
+	Headers     []TranscriptHeader `json:"headers"`               // 按名称排序的头部，同名多值逐个列出
+}
+
+// TranscriptHeader 单个HTTP头部
+type TranscriptHeader struct {
+	Name  string `json:"name"`  // 头部名称
+	Value string `json:"value"` // 头部取值，凭据类头部为REDACTED
+}
+
+// TranscriptMessage 单个帧
+// type、time、opcode、data与HAR中Chrome导出的_webSocketMessages字段一致
+type TranscriptMessage struct {
+	Type     string  `json:"type"`               // 方向：send或receive
+	Time     float64 `json:"time"`               // Unix时间戳（秒，含小数）
+	Opcode   int     `json:"opcode"`             // 帧操作码：1文本、2二进制、8关闭、9 ping、10 pong
+	Size     int64   `json:"size"`               // 载荷字节数
+	Encoding string  `json:"encoding,omitempty"` // 载荷不是有效UTF-8时为base64
+	Data     string  `json:"data"`               // 载荷内容，流式收发的大消息不记录载荷
+	Streamed bool    `json:"streamed,omitempty"` // 是否为流式收发的大消息
+}
+
+// TranscriptClose 关闭详情
+type TranscriptClose struct {
+	Initiator string    `json:"initiator"` // 先发送关闭帧的一方：client或server
+	Code      int       `json:"code"`      // 关闭码
+	Reason    string    `json:"reason"`    // 关闭原因
+	Time      time.Time `json:"time"`      // 关闭帧的收发时间
+}
+
+// transcriptRecorder 会话记录器
+// 记录保存在内存中，客户端退出时一次性写出
+//
+// 并发安全：
+//   - 所有方法通过互斥锁保护，可以在读取、发送和ping处理goroutine中并发调用
+//   - 所有方法在接收者为nil时为空操作，未启用--transcript时调用方无需判断
+//
+// 注意事项：
+//   - 每一帧的载荷都保存在内存中，适合调试和复现问题的会话，不适合长时间高吞吐运行
+type transcriptRecorder struct {
+	mu         sync.Mutex            // 保护transcript和current
+	transcript Transcript            // 已记录的内容
+	current    *TranscriptConnection // 当前连接，未连接时为nil
+}
+
+// newTranscriptRecorder 创建会话记录器
+func newTranscriptRecorder(sessionID string) *transcriptRecorder {
+	return &transcriptRecorder{transcript: Transcript{
+		Version:     TranscriptVersion,
+		Creator:     TranscriptCreator{Name: AppName, Version: AppVersion},
+		SessionID:   sessionID,
+		Connections: []*TranscriptConnection{},
+	}}
+}
+
+// beginConnection 开始记录一个新连接，作为握手观察回调使用
+//
+// 参数说明：
+//   - url: 跟随重定向后的最终地址
+//   - resp: 101升级响应，resp.Request为升级请求
+func (r *transcriptRecorder) beginConnection(url string, resp *http.Response) {
+	if r == nil || resp == nil {
+		return
+	}
+	conn := &TranscriptConnection{
+		URL:             redactURL(url),
+		StartedDateTime: time.Now(),
+		Response: TranscriptHandshake{
+			Status:      resp.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+			HTTPVersion: resp.Proto,
+			Headers:     transcriptHeaders(resp.Header),
+		},
+		Messages: []TranscriptMessage{},
+	}
+	if req := resp.Request; req != nil {
+		conn.Request = TranscriptHandshake{
+			Method:      req.Method,
+			HTTPVersion: req.Proto,
+			Headers:     transcriptHeaders(req.Header),
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeCurrent(conn.StartedDateTime)
+	r.transcript.Connections = append(r.transcript.Connections, conn)
+	r.current = conn
+}
+
+// recordFrame 记录当前连接上收发的一帧
+//
+// 参数说明：
+//   - sent: true表示发送，false表示接收
+//   - messageType: 帧类型（websocket.TextMessage等）
+//   - data: 载荷，会被复制
+//
+// 注意事项：
+//   - 第一个关闭帧同时记录为连接的关闭详情
+func (r *transcriptRecorder) recordFrame(sent bool, messageType int, data []byte) {
+	if r == nil {
+		return
+	}
+	message := TranscriptMessage{
+		Type:   transcriptDirection(sent),
+		Time:   float64(time.Now().UnixNano()) / 1e9,
+		Opcode: messageType,
+		Size:   int64(len(data)),
+	}
+	if utf8.Valid(data) {
+		message.Data = string(data)
+	} else {
+		message.Encoding, message.Data = "base64", base64.StdEncoding.EncodeToString(data)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == nil {
+		return
+	}
+	r.current.Messages = append(r.current.Messages, message)
+	if messageType == websocket.CloseMessage && r.current.Close == nil {
+		closeInfo := &TranscriptClose{Initiator: "client", Code: websocket.CloseNoStatusReceived, Time: time.Now()}
+		if !sent {
+			closeInfo.Initiator = "server"
+		}
+		if len(data) >= 2 {
+			closeInfo.Code = int(binary.BigEndian.Uint16(data))
+			closeInfo.Reason = string(data[2:])
+		}
+		r.current.Close = closeInfo
+	}
+}
+
+// recordStreamedFrame 记录流式收发的大消息，只记录大小不记录载荷
+func (r *transcriptRecorder) recordStreamedFrame(sent bool, messageType int, size int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == nil {
+		return
+	}
+	r.current.Messages = append(r.current.Messages, TranscriptMessage{
+		Type:     transcriptDirection(sent),
+		Time:     float64(time.Now().UnixNano()) / 1e9,
+		Opcode:   messageType,
+		Size:     size,
+		Streamed: true,
+	})
+}
+
+// endConnection 结束当前连接的记录，之后的帧在下一次握手前不再记录
+func (r *transcriptRecorder) endConnection() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeCurrent(time.Now())
+}
+
+// closeCurrent 设置当前连接的结束时间，调用方必须持有r.mu
+func (r *transcriptRecorder) closeCurrent(now time.Time) {
+	if r.current != nil {
+		r.current.EndedDateTime = &now
+		r.current = nil
+	}
+}
+
+// marshal 结束当前连接并序列化全部记录
+func (r *transcriptRecorder) marshal() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeCurrent(time.Now())
+	return json.MarshalIndent(r.transcript, "", "  ")
+}
+
+// transcriptDirection 返回帧方向的记录取值
+func transcriptDirection(sent bool) string {
+	if sent {
+		return "send"
+	}
+	return "receive"
+}
+
+// transcriptHeaders 将HTTP头部转换为按名称排序的列表，并隐藏凭据类头部的取值
+func transcriptHeaders(header http.Header) []TranscriptHeader {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := make([]TranscriptHeader, 0, len(names))
+	for _, name := range names {
+		redacted := slices.Contains(transcriptRedactedHeaders, http.CanonicalHeaderKey(name))
+		for _, value := range header[name] {
+			if redacted {
+				value = "REDACTED"
+			}
+			headers = append(headers, TranscriptHeader{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// WriteTranscript 以JSON格式写出会话记录
+//
+// 参数说明：
+//   - path: 输出路径，"-"表示写到标准输出，否则写入当前工作目录内的文件（覆盖已有文件）
+//
+// 返回值：
+//   - error: 未启用会话记录、序列化或写入失败时返回错误
+//
+// 注意事项：
+//   - 仍在连接中的连接以写出时间作为结束时间
+func (c *WebSocketClient) WriteTranscript(path string) error {
+	if c.transcript == nil {
+		return errors.New(tr("未启用会话记录"))
+	}
+	data, err := c.transcript.marshal()
+	if err != nil {
+		return fmt.Errorf(tr("序列化会话记录失败: %w"), err)
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	safePath, err := validateWorkDirPath(path)
+	if err != nil {
+		return fmt.Errorf(tr("无效的会话记录路径: %w"), err)
+	}
+	// #nosec G304 -- 路径已通过validateWorkDirPath限制在当前工作目录内
+	return os.WriteFile(safePath, data, 0600)
+}
+
+// GetErrorTrend 获取指定时间范围内的错误趋势
+// 这个方法返回指定时间段内发生的错误趋势数据，用于错误模式分析
+//
+// 参数说明：
+//   - since: 时间范围，从现在往前推算的时间段
+//
+// 返回值：
+//   - []ErrorTrendPoint: 时间范围内的错误趋势点列表
+//
+// 趋势数据包含：
+//   - 错误发生的时间戳
+//   - 错误计数（通常为1）
+//   - 错误类型码
+//
+// 过滤逻辑：
+//   - 计算截止时间点（当前时间 - since）
+//   - 只返回截止时间之后的错误记录
+//   - 保持时间顺序不变
+//
+// 并发安全：
+//   - 使用读锁保护数据访问
+//   - 返回数据副本，避免外部修改
+//
+// 使用场景：
+//   - 错误趋势分析和可视化
+//   - 异常检测和告警
+//   - 性能监控和诊断
+//   - 错误模式识别
+//
+// 使用示例：
+//
+//	// 获取最近1小时的错误趋势
+//	trend := client.GetErrorTrend(time.Hour)
+//	// 获取最近24小时的错误趋势
+//	trend := client.GetErrorTrend(24 * time.Hour)
+func (c *WebSocketClient) GetErrorTrend(since time.Duration) []ErrorTrendPoint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// 计算截止时间点
+	cutoff := time.Now().Add(-since)
+	var trend []ErrorTrendPoint
+
+	// 过滤指定时间范围内的错误记录
+	for _, point := range c.Stats.Errors.ErrorTrend {
+		if point.Timestamp.After(cutoff) {
+			trend = append(trend, point)
+		}
+	}
+
+	return trend
+}
+
+// extractErrorCode 从错误中提取标准化的错误码
+// 支持自定义错误类型(ConnectionError, RetryError)和标准错误的智能推断
+// 返回的错误码用于错误分类统计和恢复策略选择
+//
+// Example:
+//
+//	code := client.extractErrorCode(err)
+//	if code == ErrCodeConnectionRefused {
+//	    // 处理连接被拒绝的情况
+//	}
+func (c *WebSocketClient) extractErrorCode(err error) ErrorCode {
+	switch e := err.(type) {
+	case *ConnectionError:
+		return e.Code
+	case *RetryError:
+		return e.Code
+	default:
+		return c.inferErrorCode(err)
+	}
+}
+
+// startMonitoringServers 启动监控服务器
+// 这个方法根据配置启动Prometheus指标服务器和健康检查服务器
+//
+// 功能说明：
+//  1. 检查配置中的端口设置
+//  2. 启动Prometheus指标服务器（如果配置了端口）
+//  3. 启动健康检查服务器（如果配置了端口）
+//  4. 使用goroutine并发启动，不阻塞主流程
+//
+// 服务器类型：
+//   - Prometheus指标服务器：提供/metrics端点
+//   - 健康检查服务器：提供/health、/ready、/stats端点
+//
+// 配置要求：
+//   - MetricsPort > 0：启动指标服务器
+//   - HealthPort > 0：启动健康检查服务器
+//   - 端口为0或负数：跳过对应服务器
+//
+// 并发启动：
+//   - 每个服务器在独立的goroutine中运行
+//   - 不会阻塞WebSocket客户端的主要功能
+//   - 服务器启动失败不会影响客户端运行
+//
+// 使用场景：
+//   - 生产环境的监控集成
+//   - Kubernetes的健康检查
+//   - Prometheus监控系统
+//   - 负载均衡器的健康探测
+func (c *WebSocketClient) startMonitoringServers() {
+	// 启动Prometheus指标服务器（如果配置了端口）
+	if c.config.MetricsPort > 0 {
+		go c.startMetricsServer()
+	}
+
+	// 启动健康检查服务器（如果配置了端口）
+	if c.config.HealthPort > 0 {
+		go c.startHealthServer()
+	}
+}
+
+// startMetricsServer 启动Prometheus指标服务器
+// 这个方法启动一个HTTP服务器，提供Prometheus格式的指标数据
+//
+// 功能说明：
+//  1. 创建HTTP路由器和处理器
+//  2. 配置HTTP服务器参数
+//  3. 启动服务器并监听指定端口
+//  4. 处理服务器启动错误
+//
+// 提供的端点：
+//   - /metrics：Prometheus格式的指标数据
+//
+// 服务器配置：
+//   - ReadHeaderTimeout: 10秒，防止慢速攻击
+//   - ReadTimeout: 30秒，完整请求读取超时
+//   - WriteTimeout: 30秒，响应写入超时
+//   - IdleTimeout: 60秒，空闲连接超时
+//
+// 错误处理：
+//   - 忽略正常关闭错误（http.ErrServerClosed）
+//   - 记录其他启动错误但不中断程序
+//
+// 并发安全：
+//   - 在独立的goroutine中运行
+//   - 不会阻塞其他操作
+//
+// 使用场景：
+//   - Prometheus监控系统抓取指标
+//   - Grafana仪表板数据源
+//   - 自动化监控和告警
+func (c *WebSocketClient) startMetricsServer() {
+	defer c.trackGoroutine("metrics-server")()
+
+	// 创建HTTP路由器
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", c.handleMetrics)
+
+	// 配置HTTP服务器
+	c.metricsServer = &http.Server{
+		Addr:              fmt.Sprintf(":%d", c.config.MetricsPort),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second, // 防止慢速攻击
+		ReadTimeout:       30 * time.Second, // 完整请求读取超时
+		WriteTimeout:      30 * time.Second, // 响应写入超时
+		IdleTimeout:       60 * time.Second, // 空闲连接超时
+	}
+
+	// 记录服务器启动信息
+	log.Printf(tr("📊 启动Prometheus指标服务器: http://localhost:%d/metrics"), c.config.MetricsPort)
+
+	// 启动服务器（阻塞调用）
+	if err := c.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf(tr("❌ 指标服务器启动失败: %v"), err)
+	}
+}
+
+// startHealthServer 启动健康检查服务器
+// 这个方法启动一个HTTP服务器，提供健康检查和统计信息端点
+//
+// 功能说明：
+//  1. 创建HTTP路由器和多个处理器
+//  2. 配置HTTP服务器参数
+//  3. 启动服务器并监听指定端口
+//  4. 处理服务器启动错误
+//
+// 提供的端点：
+//   - /health：健康检查，返回客户端运行状态
+//   - /ready：就绪检查，返回WebSocket连接状态
+//   - /stats：统计信息，返回详细的连接和错误统计
+//
+// 服务器配置：
+//   - ReadHeaderTimeout: 10秒，防止慢速攻击
+//   - ReadTimeout: 30秒，完整请求读取超时
+//   - WriteTimeout: 30秒，响应写入超时
+//   - IdleTimeout: 60秒，空闲连接超时
+//
+// 错误处理：
+//   - 忽略正常关闭错误（http.ErrServerClosed）
+//   - 记录其他启动错误但不中断程序
+//
+// 并发安全：
+//   - 在独立的goroutine中运行
+//   - 不会阻塞其他操作
+//
+// 使用场景：
+//   - Kubernetes liveness和readiness探测
+//   - 负载均衡器健康检查
+//   - 监控系统状态收集
+//   - 运维工具的状态查询
+func (c *WebSocketClient) startHealthServer() {
+	defer c.trackGoroutine("health-server")()
+
+	// 创建HTTP路由器和处理器
+	mux := http.NewServeMux()
+	c.registerHealthHandlers(mux)
+
+	// 配置HTTP服务器
+	c.healthServer = &http.Server{
+		Addr:              fmt.Sprintf(":%d", c.config.HealthPort),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second, // 防止慢速攻击
+		ReadTimeout:       30 * time.Second, // 完整请求读取超时
+		WriteTimeout:      30 * time.Second, // 响应写入超时
+		IdleTimeout:       60 * time.Second, // 空闲连接超时
+	}
+
+	// 记录服务器启动信息
+	log.Printf(tr("🏥 启动健康检查服务器: http://localhost:%d/health"), c.config.HealthPort)
+
+	// 启动服务器（阻塞调用）
+	if err := c.healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf(tr("❌ 健康检查服务器启动失败: %v"), err)
+	}
+}
+
+// registerHealthHandlers 注册健康检查、就绪检查、统计信息和管理API端点
+// 由健康检查服务器和统一管理服务器共用
+func (c *WebSocketClient) registerHealthHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/health", c.handleHealth) // 健康检查端点
+	mux.HandleFunc("/ready", c.handleReady)   // 就绪检查端点
+	mux.HandleFunc("/stats", c.handleStats)   // 统计信息端点
+	c.registerAdminHandlers(mux)              // 管理API端点（配置了令牌时）
+}
+
+// startAdminServer 启动统一管理服务器
+// 在AdminPort上同时提供指标、健康检查和管理API，只需开放一个端口
+//
+// 提供的端点：
+//   - /metrics：Prometheus格式的指标数据
+//   - /health、/ready、/stats：健康检查、就绪检查和统计信息
+//   - /send、/close、/messages：管理API（配置了令牌时）
+//
+// 注意事项：
+//   - 配置AdminPort后不再单独启动指标服务器和健康检查服务器，MetricsPort和HealthPort被忽略
+//   - 服务器参数与其他两个服务器一致
+func (c *WebSocketClient) startAdminServer() {
+	defer c.trackGoroutine("admin-server")()
+
+	// 第一步：在同一个路由器上注册全部端点
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", c.handleMetrics) // Prometheus指标端点
+	c.registerHealthHandlers(mux)
+
+	// 第二步：配置HTTP服务器
+	c.adminServer = &http.Server{
+		Addr:              fmt.Sprintf(":%d", c.config.AdminPort),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second, // 防止慢速攻击
+		ReadTimeout:       30 * time.Second, // 完整请求读取超时
+		WriteTimeout:      30 * time.Second, // 响应写入超时
+		IdleTimeout:       60 * time.Second, // 空闲连接超时
+	}
+
+	// 第三步：启动服务器（阻塞调用）
+	log.Printf(tr("🛠️ 启动统一管理服务器: http://localhost:%d (/metrics, /health, /ready, /stats)"), c.config.AdminPort)
+	if err := c.adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf(tr("❌ 统一管理服务器启动失败: %v"), err)
+	}
+}
+
+// handleMetrics 处理Prometheus指标请求
+// 这个HTTP处理器提供Prometheus格式的指标数据，用于监控系统集成
+//
+// 功能说明：
+//   - 设置正确的Content-Type头部
+//   - 更新最新的指标数据
+//   - 输出标准Prometheus格式的指标
+//   - 支持多种指标类型（计数器、仪表）
+//   - 配置了--label时为每个样本追加常量标签
+//
+// 提供的指标：
+//  1. websocket_connections_total: 总连接数（计数器）
+//  2. websocket_connections_active: 当前活跃连接数（仪表）
+//  3. websocket_messages_sent_total: 发送消息总数（计数器）
+//  4. websocket_messages_received_total: 接收消息总数（计数器）
+//  5. websocket_bytes_sent_total: 发送字节总数（计数器）
+//  6. websocket_bytes_received_total: 接收字节总数（计数器）
+//  7. websocket_errors_total: 错误总数（计数器）
+//  8. websocket_reconnections_total: 重连总数（计数器）
+//  9. websocket_errors_by_code_total: 按错误码分类的错误（带标签计数器）
+//  10. websocket_connection_phase_duration_ms: 最近一次握手各阶段耗时（带phase标签仪表）
+//
+// 使用场景：
+//   - Prometheus监控系统抓取
+//   - Grafana仪表板展示
+//   - 告警规则配置
+//   - 性能分析和调优
+func (c *WebSocketClient) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	// 设置Prometheus标准的Content-Type
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	// 未配置常量标签时直接输出
+	if len(c.config.Labels) == 0 {
+		c.writeMetrics(w)
+		return
+	}
+
+	// 配置了--label时先写入缓冲区，再为每个样本追加常量标签
+	var buf bytes.Buffer
+	c.writeMetrics(&buf)
+	_, _ = w.Write(addConstantLabels(buf.Bytes(), c.config.Labels)) // 客户端断开时写入失败，无需处理
+}
+
+// writeMetrics 以Prometheus文本格式输出全部指标
+//
+// 参数说明：
+//   - w: 输出目标，HTTP响应或用于追加常量标签的缓冲区
+func (c *WebSocketClient) writeMetrics(w io.Writer) {
+	// 更新最新的指标数据
+	c.updatePrometheusMetrics()
+
+	// 输出Prometheus格式的指标
+	// 1. 总连接数指标
+	fmt.Fprintf(w, "# HELP websocket_connections_total Total number of WebSocket connections\n")
+	fmt.Fprintf(w, "# TYPE websocket_connections_total counter\n")
+	fmt.Fprintf(w, "websocket_connections_total %d\n", c.metrics.ConnectionsTotal)
+
+	// 2. 当前活跃连接数指标
+	fmt.Fprintf(w, "# HELP websocket_connections_active Current active WebSocket connections\n")
+	fmt.Fprintf(w, "# TYPE websocket_connections_active gauge\n")
+	fmt.Fprintf(w, "websocket_connections_active %d\n", c.metrics.ConnectionsActive)
+
+	// 3. 发送消息总数指标
+	fmt.Fprintf(w, "# HELP websocket_messages_sent_total Total number of messages sent\n")
+	fmt.Fprintf(w, "# TYPE websocket_messages_sent_total counter\n")
+	fmt.Fprintf(w, "websocket_messages_sent_total %d\n", c.metrics.MessagesSentTotal)
+
+	// 4. 接收消息总数指标
+	fmt.Fprintf(w, "# HELP websocket_messages_received_total Total number of messages received\n")
+	fmt.Fprintf(w, "# TYPE websocket_messages_received_total counter\n")
+	fmt.Fprintf(w, "websocket_messages_received_total %d\n", c.metrics.MessagesReceivedTotal)
+
+	// 5. 发送字节总数指标
+	fmt.Fprintf(w, "# HELP websocket_bytes_sent_total Total number of bytes sent\n")
+	fmt.Fprintf(w, "# TYPE websocket_bytes_sent_total counter\n")
+	fmt.Fprintf(w, "websocket_bytes_sent_total %d\n", c.metrics.BytesSentTotal)
+
+	// 6. 接收字节总数指标
+	fmt.Fprintf(w, "# HELP websocket_bytes_received_total Total number of bytes received\n")
+	fmt.Fprintf(w, "# TYPE websocket_bytes_received_total counter\n")
+	fmt.Fprintf(w, "websocket_bytes_received_total %d\n", c.metrics.BytesReceivedTotal)
+
+	// 7. 错误总数指标
+	fmt.Fprintf(w, "# HELP websocket_errors_total Total number of errors\n")
+	fmt.Fprintf(w, "# TYPE websocket_errors_total counter\n")
+	fmt.Fprintf(w, "websocket_errors_total %d\n", c.metrics.ErrorsTotal)
+
+	// 8. 重连总数指标
+	fmt.Fprintf(w, "# HELP websocket_reconnections_total Total number of reconnections\n")
+	fmt.Fprintf(w, "# TYPE websocket_reconnections_total counter\n")
+	fmt.Fprintf(w, "websocket_reconnections_total %d\n", c.metrics.ReconnectionsTotal)
+
+	// 9. 按错误码分类的错误指标（带标签）
+	for code, count := range c.metrics.ErrorsByCodeTotal {
+		fmt.Fprintf(w, "# HELP websocket_errors_by_code_total Total errors by error code\n")
+		fmt.Fprintf(w, "# TYPE websocket_errors_by_code_total counter\n")
+		fmt.Fprintf(w, "websocket_errors_by_code_total{error_code=\"%d\",error_name=\"%s\"} %d\n",
+			int(code), code.String(), count)
+	}
+
+	// 10. 连接阶段耗时指标（带phase标签）
+	fmt.Fprintf(w, "# HELP websocket_connection_phase_duration_ms Duration of each phase of the last successful handshake in milliseconds\n")
+	fmt.Fprintf(w, "# TYPE websocket_connection_phase_duration_ms gauge\n")
+	fmt.Fprintf(w, "websocket_connection_phase_duration_ms{phase=\"dns_lookup\"} %d\n", c.metrics.DNSLookupMs)
+	fmt.Fprintf(w, "websocket_connection_phase_duration_ms{phase=\"tcp_connect\"} %d\n", c.metrics.TCPConnectMs)
+	fmt.Fprintf(w, "websocket_connection_phase_duration_ms{phase=\"tls_handshake\"} %d\n", c.metrics.TLSHandshakeMs)
+	fmt.Fprintf(w, "websocket_connection_phase_duration_ms{phase=\"first_byte\"} %d\n", c.metrics.FirstByteMs)
+	fmt.Fprintf(w, "websocket_connection_phase_duration_ms{phase=\"total\"} %d\n", c.metrics.HandshakeTotalMs)
+
+	// 11. 按关闭码分类的服务器关闭指标（带code标签）
+	fmt.Fprintf(w, "# HELP websocket_server_close_total Total number of close frames received from the server by close code\n")
+	fmt.Fprintf(w, "# TYPE websocket_server_close_total counter\n")
+	c.mu.RLock()
+	for code, count := range c.metrics.ServerClosesTotal {
+		fmt.Fprintf(w, "websocket_server_close_total{code=\"%d\"} %d\n", code, count)
+	}
+	ping := c.Stats.Ping
+	latencyMs := c.metrics.MessageLatencyMs
+	pongTimeouts := c.metrics.PongTimeoutsTotal
+	memoryLimit := c.metrics.MemoryLimitBytes
+	memoryShedding := c.metrics.MemorySheddingTotal
+	retryAfterWaits := c.metrics.RetryAfterWaitsTotal
+	retryAfterSeconds := c.metrics.RetryAfterWaitSeconds
+	c.mu.RUnlock()
+	memoryUsage := currentMemoryUsage()
+	c.mu.Lock()
+	c.metrics.MemoryUsageBytes = memoryUsage
+	c.mu.Unlock()
+	stats := c.GetStats()
+	inboundQueue := stats.InboundQueue
+
+	// 12. 消息延迟指标（最近一次ping往返时间）
+	fmt.Fprintf(w, "# HELP websocket_message_latency_ms Round-trip time of the most recent ping in milliseconds\n")
+	fmt.Fprintf(w, "# TYPE websocket_message_latency_ms gauge\n")
+	fmt.Fprintf(w, "websocket_message_latency_ms %d\n", latencyMs)
+
+	// 13. Ping往返时间统计（带stat标签，基于最近100个样本）
+	fmt.Fprintf(w, "# HELP websocket_ping_rtt_ms Rolling ping round-trip time statistics in milliseconds\n")
+	fmt.Fprintf(w, "# TYPE websocket_ping_rtt_ms gauge\n")
+	fmt.Fprintf(w, "websocket_ping_rtt_ms{stat=\"min\"} %.3f\n", ping.MinMs)
+	fmt.Fprintf(w, "websocket_ping_rtt_ms{stat=\"avg\"} %.3f\n", ping.AvgMs)
+	fmt.Fprintf(w, "websocket_ping_rtt_ms{stat=\"max\"} %.3f\n", ping.MaxMs)
+	fmt.Fprintf(w, "websocket_ping_rtt_ms{stat=\"jitter\"} %.3f\n", ping.JitterMs)
+	fmt.Fprintf(w, "websocket_ping_rtt_ms{stat=\"p50\"} %.3f\n", ping.P50Ms)
+	fmt.Fprintf(w, "websocket_ping_rtt_ms{stat=\"p90\"} %.3f\n", ping.P90Ms)
+	fmt.Fprintf(w, "websocket_ping_rtt_ms{stat=\"p99\"} %.3f\n", ping.P99Ms)
+
+	// 14. pong超时指标
+	fmt.Fprintf(w, "# HELP websocket_pong_timeouts_total Total number of pings that received no pong within the pong timeout\n")
+	fmt.Fprintf(w, "# TYPE websocket_pong_timeouts_total counter\n")
+	fmt.Fprintf(w, "websocket_pong_timeouts_total %d\n", pongTimeouts)
+
+	// 15. 入站队列指标
+	fmt.Fprintf(w, "# HELP websocket_inbound_queue_depth Number of received messages waiting to be dispatched\n")
+	fmt.Fprintf(w, "# TYPE websocket_inbound_queue_depth gauge\n")
+	fmt.Fprintf(w, "websocket_inbound_queue_depth %d\n", inboundQueue.Depth)
+	fmt.Fprintf(w, "# HELP websocket_inbound_queue_capacity Capacity of the inbound queue, 0 when disabled\n")
+	fmt.Fprintf(w, "# TYPE websocket_inbound_queue_capacity gauge\n")
+	fmt.Fprintf(w, "websocket_inbound_queue_capacity %d\n", inboundQueue.Capacity)
+	fmt.Fprintf(w, "# HELP websocket_inbound_blocked_total Total number of times the reader waited for a full inbound queue\n")
+	fmt.Fprintf(w, "# TYPE websocket_inbound_blocked_total counter\n")
+	fmt.Fprintf(w, "websocket_inbound_blocked_total %d\n", inboundQueue.Blocked)
+	fmt.Fprintf(w, "# HELP websocket_inbound_dropped_total Total number of received messages dropped by the backpressure policy\n")
+	fmt.Fprintf(w, "# TYPE websocket_inbound_dropped_total counter\n")
+	fmt.Fprintf(w, "websocket_inbound_dropped_total %d\n", inboundQueue.Dropped)
+
+	// 16. 内存指标
+	fmt.Fprintf(w, "# HELP websocket_memory_usage_bytes Memory currently used by the Go runtime in bytes\n")
+	fmt.Fprintf(w, "# TYPE websocket_memory_usage_bytes gauge\n")
+	fmt.Fprintf(w, "websocket_memory_usage_bytes %d\n", memoryUsage)
+	fmt.Fprintf(w, "# HELP websocket_memory_limit_bytes Soft memory limit set by --max-memory, 0 when unlimited\n")
+	fmt.Fprintf(w, "# TYPE websocket_memory_limit_bytes gauge\n")
+	fmt.Fprintf(w, "websocket_memory_limit_bytes %d\n", memoryLimit)
+	fmt.Fprintf(w, "# HELP websocket_memory_shedding_total Total number of times caches were shed near the memory limit\n")
+	fmt.Fprintf(w, "# TYPE websocket_memory_shedding_total counter\n")
+	fmt.Fprintf(w, "websocket_memory_shedding_total %d\n", memoryShedding)
+
+	// 17. Retry-After指标
+	fmt.Fprintf(w, "# HELP websocket_retry_after_waits_total Total number of retry waits extended by a Retry-After header on 429/503 handshake responses\n")
+	fmt.Fprintf(w, "# TYPE websocket_retry_after_waits_total counter\n")
+	fmt.Fprintf(w, "websocket_retry_after_waits_total %d\n", retryAfterWaits)
+	fmt.Fprintf(w, "# HELP websocket_retry_after_wait_seconds_total Total seconds spent waiting because of Retry-After headers\n")
+	fmt.Fprintf(w, "# TYPE websocket_retry_after_wait_seconds_total counter\n")
+	fmt.Fprintf(w, "websocket_retry_after_wait_seconds_total %.3f\n", retryAfterSeconds)
+
+	// 18. 按消息类型和方向分类的消息指标（带direction、type标签，包括控制帧）
+	fmt.Fprintf(w, "# HELP websocket_messages_by_type_total Total number of messages and control frames by direction and message type\n")
+	fmt.Fprintf(w, "# TYPE websocket_messages_by_type_total counter\n")
+	for _, direction := range []struct {
+		name   string
+		counts MessageTypeCounts
+	}{{"sent", stats.SentByType}, {"received", stats.ReceivedByType}} {
+		for _, entry := range direction.counts.labeled() {
+			fmt.Fprintf(w, "websocket_messages_by_type_total{direction=\"%s\",type=\"%s\"} %d\n", direction.name, entry.label, entry.count)
+		}
+	}
+
+	// 19. 严格模式的协议违规指标（带violation标签，按类型名排序）
+	if c.config.Strict {
+		fmt.Fprintf(w, "# HELP websocket_protocol_violations_total Total number of RFC 6455 violations detected by --strict by violation type\n")
+		fmt.Fprintf(w, "# TYPE websocket_protocol_violations_total counter\n")
+		for _, kind := range slices.Sorted(maps.Keys(stats.ProtocolViolations)) {
+			fmt.Fprintf(w, "websocket_protocol_violations_total{violation=\"%s\"} %d\n", kind, stats.ProtocolViolations[kind])
+		}
+	}
+
+	// 20. 错误异常检测指标
+	anomalyActive, anomaliesTotal := c.anomalyDetector.status()
+	activeValue := 0
+	if anomalyActive {
+		activeValue = 1
+	}
+	fmt.Fprintf(w, "# HELP websocket_anomaly_active Whether the last detection interval found an error-rate spike or a new error code (1) or not (0)\n")
+	fmt.Fprintf(w, "# TYPE websocket_anomaly_active gauge\n")
+	fmt.Fprintf(w, "websocket_anomaly_active %d\n", activeValue)
+	fmt.Fprintf(w, "# HELP websocket_anomalies_total Total number of error anomalies detected\n")
+	fmt.Fprintf(w, "# TYPE websocket_anomalies_total counter\n")
+	fmt.Fprintf(w, "websocket_anomalies_total %d\n", anomaliesTotal)
+
+	// 21. SLO指标（带window标签，仅配置了SLO目标时输出）
+	if c.slo != nil {
+		report := c.slo.report()
+		windows := []struct {
+			name  string
+			stats sloWindowStats
+		}{{"long", report.Long}, {"short", report.Short}}
+		fmt.Fprintf(w, "# HELP websocket_slo_availability_percent Share of time connected within the SLO window\n")
+		fmt.Fprintf(w, "# TYPE websocket_slo_availability_percent gauge\n")
+		for _, window := range windows {
+			fmt.Fprintf(w, "websocket_slo_availability_percent{window=\"%s\"} %.4f\n", window.name, window.stats.Availability)
+		}
+		fmt.Fprintf(w, "# HELP websocket_slo_message_success_percent Message send success rate within the SLO window\n")
+		fmt.Fprintf(w, "# TYPE websocket_slo_message_success_percent gauge\n")
+		for _, window := range windows {
+			fmt.Fprintf(w, "websocket_slo_message_success_percent{window=\"%s\"} %.4f\n", window.name, window.stats.MessageSuccess)
+		}
+		fmt.Fprintf(w, "# HELP websocket_slo_reconnects_per_hour Reconnect frequency within the SLO window\n")
+		fmt.Fprintf(w, "# TYPE websocket_slo_reconnects_per_hour gauge\n")
+		for _, window := range windows {
+			fmt.Fprintf(w, "websocket_slo_reconnects_per_hour{window=\"%s\"} %.4f\n", window.name, window.stats.ReconnectsPerHour)
+		}
+		fmt.Fprintf(w, "# HELP websocket_slo_burn_rate Highest error budget burn rate across SLO targets (1 = burning exactly at budget)\n")
+		fmt.Fprintf(w, "# TYPE websocket_slo_burn_rate gauge\n")
+		for _, window := range windows {
+			fmt.Fprintf(w, "websocket_slo_burn_rate{window=\"%s\"} %.4f\n", window.name, window.stats.BurnRate)
+		}
+		fmt.Fprintf(w, "# HELP websocket_slo_degraded Whether the error budget is burning faster than --slo-burn-rate (1) or not (0)\n")
+		fmt.Fprintf(w, "# TYPE websocket_slo_degraded gauge\n")
+		degraded := 0
+		if report.Degraded {
+			degraded = 1
+		}
+		fmt.Fprintf(w, "websocket_slo_degraded %d\n", degraded)
+	}
+
+	// 22. 序列号检测指标（仅配置了--seq-path时输出）
+	if c.config.SeqPath != "" {
+		fmt.Fprintf(w, "# HELP websocket_sequence_last Highest sequence number received\n")
+		fmt.Fprintf(w, "# TYPE websocket_sequence_last gauge\n")
+		fmt.Fprintf(w, "websocket_sequence_last %d\n", stats.Sequence.Last)
+		fmt.Fprintf(w, "# HELP websocket_sequence_gaps_total Total number of sequence gaps detected\n")
+		fmt.Fprintf(w, "# TYPE websocket_sequence_gaps_total counter\n")
+		fmt.Fprintf(w, "websocket_sequence_gaps_total %d\n", stats.Sequence.Gaps)
+		fmt.Fprintf(w, "# HELP websocket_sequence_missing_total Total number of sequence numbers skipped by gaps\n")
+		fmt.Fprintf(w, "# TYPE websocket_sequence_missing_total counter\n")
+		fmt.Fprintf(w, "websocket_sequence_missing_total %d\n", stats.Sequence.Missing)
+		fmt.Fprintf(w, "# HELP websocket_sequence_duplicates_total Total number of messages repeating the highest sequence number\n")
+		fmt.Fprintf(w, "# TYPE websocket_sequence_duplicates_total counter\n")
+		fmt.Fprintf(w, "websocket_sequence_duplicates_total %d\n", stats.Sequence.Duplicates)
+		fmt.Fprintf(w, "# HELP websocket_sequence_out_of_order_total Total number of messages with a sequence number below the highest one\n")
+		fmt.Fprintf(w, "# TYPE websocket_sequence_out_of_order_total counter\n")
+		fmt.Fprintf(w, "websocket_sequence_out_of_order_total %d\n", stats.Sequence.OutOfOrder)
+		fmt.Fprintf(w, "# HELP websocket_sequence_resubscribes_total Total number of resubscribe messages sent after a gap\n")
+		fmt.Fprintf(w, "# TYPE websocket_sequence_resubscribes_total counter\n")
+		fmt.Fprintf(w, "websocket_sequence_resubscribes_total %d\n", stats.Sequence.Resubscribes)
+	}
+
+	// 23. goroutine跟踪指标
+	fmt.Fprintf(w, "# HELP websocket_goroutines_tracked Number of client goroutines currently tracked\n")
+	fmt.Fprintf(w, "# TYPE websocket_goroutines_tracked gauge\n")
+	fmt.Fprintf(w, "websocket_goroutines_tracked %d\n", c.goroutineTracker.GetActiveCount())
+	fmt.Fprintf(w, "# HELP websocket_goroutine_leaks Number of suspected goroutine leaks found by the last check\n")
+	fmt.Fprintf(w, "# TYPE websocket_goroutine_leaks gauge\n")
+	fmt.Fprintf(w, "websocket_goroutine_leaks %d\n", atomic.LoadInt64(&c.goroutineLeaks))
+
+	// 24. 内存池指标（总计和带tier标签的各档位统计，tier值为档位大小的字节数）
+	allocs, reuses, releases := globalBufferPool.GetStats()
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_allocations_total Total number of buffers newly allocated by the buffer pool\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_allocations_total counter\n")
+	fmt.Fprintf(w, "websocket_buffer_pool_allocations_total %d\n", allocs)
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_reuses_total Total number of buffers obtained from the buffer pool\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_reuses_total counter\n")
+	fmt.Fprintf(w, "websocket_buffer_pool_reuses_total %d\n", reuses)
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_releases_total Total number of buffers returned to the buffer pool\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_releases_total counter\n")
+	fmt.Fprintf(w, "websocket_buffer_pool_releases_total %d\n", releases)
+	tiers := globalBufferPool.TierStats()
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_gets_total Total number of buffers requested from each buffer pool tier\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_gets_total counter\n")
+	for _, tier := range tiers {
+		fmt.Fprintf(w, "websocket_buffer_pool_gets_total{tier=\"%d\"} %d\n", tier.Size, tier.Gets)
+	}
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_misses_total Total number of requests that found the tier empty and allocated a new buffer\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_misses_total counter\n")
+	for _, tier := range tiers {
+		fmt.Fprintf(w, "websocket_buffer_pool_misses_total{tier=\"%d\"} %d\n", tier.Size, tier.Misses)
+	}
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_reuse_ratio Fraction of requests served by a reused buffer\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_reuse_ratio gauge\n")
+	for _, tier := range tiers {
+		fmt.Fprintf(w, "websocket_buffer_pool_reuse_ratio{tier=\"%d\"} %.4f\n", tier.Size, tier.ReuseRatio())
+	}
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_in_use Estimated number of buffers borrowed and not yet returned\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_in_use gauge\n")
+	for _, tier := range tiers {
+		fmt.Fprintf(w, "websocket_buffer_pool_in_use{tier=\"%d\"} %d\n", tier.Size, tier.InUse)
+	}
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_idle Estimated number of idle buffers held by the tier (upper bound)\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_idle gauge\n")
+	for _, tier := range tiers {
+		fmt.Fprintf(w, "websocket_buffer_pool_idle{tier=\"%d\"} %d\n", tier.Size, tier.Idle)
+	}
+	fmt.Fprintf(w, "# HELP websocket_buffer_pool_trims_total Total number of times idle pool buffers were dropped under memory pressure\n")
+	fmt.Fprintf(w, "# TYPE websocket_buffer_pool_trims_total counter\n")
+	fmt.Fprintf(w, "websocket_buffer_pool_trims_total %d\n", globalBufferPool.TrimCount())
+
+	// 25. Go运行时指标
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	fmt.Fprintf(w, "# HELP websocket_goroutines_active Number of goroutines in the process\n")
+	fmt.Fprintf(w, "# TYPE websocket_goroutines_active gauge\n")
+	fmt.Fprintf(w, "websocket_goroutines_active %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "# HELP websocket_heap_alloc_bytes Bytes of allocated heap objects\n")
+	fmt.Fprintf(w, "# TYPE websocket_heap_alloc_bytes gauge\n")
+	fmt.Fprintf(w, "websocket_heap_alloc_bytes %d\n", memStats.HeapAlloc)
+	fmt.Fprintf(w, "# HELP websocket_heap_inuse_bytes Bytes in in-use heap spans\n")
+	fmt.Fprintf(w, "# TYPE websocket_heap_inuse_bytes gauge\n")
+	fmt.Fprintf(w, "websocket_heap_inuse_bytes %d\n", memStats.HeapInuse)
+	fmt.Fprintf(w, "# HELP websocket_heap_objects Number of allocated heap objects\n")
+	fmt.Fprintf(w, "# TYPE websocket_heap_objects gauge\n")
+	fmt.Fprintf(w, "websocket_heap_objects %d\n", memStats.HeapObjects)
+	fmt.Fprintf(w, "# HELP websocket_gc_cycles_total Total number of completed GC cycles\n")
+	fmt.Fprintf(w, "# TYPE websocket_gc_cycles_total counter\n")
+	fmt.Fprintf(w, "websocket_gc_cycles_total %d\n", memStats.NumGC)
+	fmt.Fprintf(w, "# HELP websocket_gc_pause_seconds_total Total stop-the-world time spent in GC pauses\n")
+	fmt.Fprintf(w, "# TYPE websocket_gc_pause_seconds_total counter\n")
+	fmt.Fprintf(w, "websocket_gc_pause_seconds_total %.6f\n", float64(memStats.PauseTotalNs)/float64(time.Second))
+
+	// 26. 限流和安全检查指标（修改发送速率会替换限流器，限流计数随之重新开始）
+	limiterStats := c.sendLimiter().GetStats()
+	violations, _ := limiterStats["violation_count"].(int64) // 只有滑动窗口限流器有违规计数
+	waits, _ := limiterStats["wait_count"].(int64)           // 只有令牌桶限流器有等待计数
+	securityEvents, _ := c.securityChecker.GetSecurityStats()["suspicious_count"].(int64)
+	fmt.Fprintf(w, "# HELP websocket_rate_limit_violations_total Total number of sends rejected by the sliding-window rate limiter\n")
+	fmt.Fprintf(w, "# TYPE websocket_rate_limit_violations_total counter\n")
+	fmt.Fprintf(w, "websocket_rate_limit_violations_total %d\n", violations)
+	fmt.Fprintf(w, "# HELP websocket_rate_limit_waits_total Total number of sends delayed by the --send-rate token bucket\n")
+	fmt.Fprintf(w, "# TYPE websocket_rate_limit_waits_total counter\n")
+	fmt.Fprintf(w, "websocket_rate_limit_waits_total %d\n", waits)
+	fmt.Fprintf(w, "# HELP websocket_security_events_total Total number of messages rejected by the security checker\n")
+	fmt.Fprintf(w, "# TYPE websocket_security_events_total counter\n")
+	fmt.Fprintf(w, "websocket_security_events_total %d\n", securityEvents)
+
+	// 27. 消息转发指标（仅配置了--forward时输出）
+	if c.forwarder != nil {
+		forward := c.forwarder.stats()
+		fmt.Fprintf(w, "# HELP websocket_forward_messages_total Total number of received messages delivered to the --forward target\n")
+		fmt.Fprintf(w, "# TYPE websocket_forward_messages_total counter\n")
+		fmt.Fprintf(w, "websocket_forward_messages_total %d\n", forward.Forwarded)
+		fmt.Fprintf(w, "# HELP websocket_forward_batches_total Total number of batches delivered to the --forward target\n")
+		fmt.Fprintf(w, "# TYPE websocket_forward_batches_total counter\n")
+		fmt.Fprintf(w, "websocket_forward_batches_total %d\n", forward.Batches)
+		fmt.Fprintf(w, "# HELP websocket_forward_failures_total Total number of messages given up after all delivery attempts failed, rejected by the target or abandoned on shutdown\n")
+		fmt.Fprintf(w, "# TYPE websocket_forward_failures_total counter\n")
+		fmt.Fprintf(w, "websocket_forward_failures_total %d\n", forward.Failed)
+		fmt.Fprintf(w, "# HELP websocket_forward_dropped_total Total number of messages dropped because the forward queue was full\n")
+		fmt.Fprintf(w, "# TYPE websocket_forward_dropped_total counter\n")
+		fmt.Fprintf(w, "websocket_forward_dropped_total %d\n", forward.Dropped)
+		fmt.Fprintf(w, "# HELP websocket_forward_queue_depth Number of received messages waiting to be forwarded\n")
+		fmt.Fprintf(w, "# TYPE websocket_forward_queue_depth gauge\n")
+		fmt.Fprintf(w, "websocket_forward_queue_depth %d\n", forward.QueueDepth)
+	}
+
+	// 28. 生命周期命令指标（仅配置了--on-*-exec时输出）
+	if c.execHooks != nil {
+		fmt.Fprintf(w, "# HELP websocket_exec_hook_skipped_total Total number of --on-*-exec events skipped because the concurrent command limit was reached\n")
+		fmt.Fprintf(w, "# TYPE websocket_exec_hook_skipped_total counter\n")
+		fmt.Fprintf(w, "websocket_exec_hook_skipped_total %d\n", c.execHooks.skippedCount())
+	}
+}
+
+// healthResponse /health端点的响应
+type healthResponse struct {
+	Status    string        `json:"status"`        // healthy、degraded或unhealthy
+	State     string        `json:"state"`         // 客户端状态
+	SessionID string        `json:"session_id"`    // 会话ID
+	Timestamp string        `json:"timestamp"`     // 检查时间
+	Checks    HealthMetrics `json:"checks"`        // 健康检查器的检查结果
+	SLO       *sloReport    `json:"slo,omitempty"` // SLO指标：仅配置了SLO目标时输出
+}
+
+// handleHealth 处理健康检查请求
+// 这个HTTP处理器提供标准的健康检查端点，用于负载均衡器和监控系统
+//
+// 功能说明：
+//   - 检查客户端的基本运行状态
+//   - 返回JSON格式的健康状态信息
+//   - 根据状态设置合适的HTTP状态码
+//
+// 健康判断逻辑：
+//   - healthy: 客户端正在运行（非停止状态）
+//   - degraded: 客户端正在运行，但有组件检查未通过，或配置的SLO错误预算消耗过快
+//   - unhealthy: 客户端已停止或正在停止
+//
+// 返回格式：
+//
+//	{
+//	  "status": "healthy|degraded|unhealthy",
+//	  "state": "客户端状态",
+//	  "session_id": "会话ID",
+//	  "timestamp": "检查时间",
+//	  "checks": {健康检查器的检查结果，component_status中是每个组件的状态},
+//	  "slo": {长短窗口的SLO指标（仅配置了SLO目标时）}
+//	}
+//
+// HTTP状态码：
+//   - 200 OK: 健康或降级状态
+//   - 503 Service Unavailable: 不健康状态
+//
+// 使用场景：
+//   - Kubernetes liveness probe
+//   - 负载均衡器健康检查
+//   - 监控系统状态检查
+func (c *WebSocketClient) handleHealth(w http.ResponseWriter, r *http.Request) {
+	// 初始化健康状态
+	response := healthResponse{
+		Status:    "healthy",
+		State:     c.GetState().String(),
+		SessionID: c.SessionID,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	httpStatus := http.StatusOK
+
+	// 检查客户端运行状态
+	if !c.isHealthy() {
+		response.Status = "unhealthy"
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	// 执行组件健康检查，有组件未通过时报告降级（仍返回200，重连期间探针不会重启客户端）
+	if c.healthChecker.CheckHealth(r.Context()) != HealthHealthy && response.Status == "healthy" {
+		response.Status = "degraded"
+	}
+	response.Checks = c.healthChecker.GetHealthMetrics()
+
+	// 配置了SLO目标时附带SLO指标，错误预算消耗过快时报告降级（仍返回200，避免探针重启客户端）
+	if c.slo != nil {
+		report := c.slo.report()
+		if report.Degraded && response.Status == "healthy" {
+			response.Status = "degraded"
+		}
+		response.SLO = &report
+	}
+
+	writeJSON(w, httpStatus, response)
+}
+
+// isHealthy 判断客户端是否健康：未处于停止中或已停止状态
+// 供/health端点和systemd看门狗共用
+func (c *WebSocketClient) isHealthy() bool {
+	state := c.GetState()
+	return state != StateStopped && state != StateStopping
+}
+
+// readyResponse /ready端点的响应
+type readyResponse struct {
+	Ready     bool   `json:"ready"`            // 是否就绪
+	State     string `json:"state"`            // 客户端状态
+	SessionID string `json:"session_id"`       // 会话ID
+	Timestamp string `json:"timestamp"`        // 检查时间
+	Reason    string `json:"reason,omitempty"` // 未就绪原因：仅未就绪时输出
+}
+
+// handleReady 处理就绪检查请求
+// 这个HTTP处理器提供就绪状态检查，用于确定服务是否准备好接收流量
+//
+// 功能说明：
+//   - 按readinessCheck的判定条件检查客户端是否就绪
+//   - 返回JSON格式的就绪状态信息
+//   - 根据判定结果设置合适的HTTP状态码
+//
+// 就绪判断逻辑：
+//   - ready: true - 连接已建立，且满足配置的消息和静默条件
+//   - ready: false - 任一条件不满足，reason字段说明原因
+//
+// 返回格式：
+//
+//	{
+//	  "ready": true|false,
+//	  "state": "客户端状态",
+//	  "session_id": "会话ID",
+//	  "timestamp": "检查时间",
+//	  "reason": "未就绪原因（仅未就绪时）"
+//	}
+//
+// HTTP状态码：
+//   - 200 OK: 就绪状态
+//   - 503 Service Unavailable: 未就绪状态
+//
+// 使用场景：
+//   - Kubernetes readiness probe
+//   - 负载均衡器流量控制
+//   - 服务发现注册检查
+func (c *WebSocketClient) handleReady(w http.ResponseWriter, r *http.Request) {
+	// 按配置的就绪条件进行判定
+	ready, reason := c.readinessCheck()
+	httpStatus := http.StatusOK
+	if !ready {
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, httpStatus, readyResponse{
+		Ready:     ready,
+		State:     c.GetState().String(),
+		SessionID: c.SessionID,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Reason:    reason,
+	})
+}
+
+// readinessCheck 按配置的就绪条件判断客户端是否就绪
+//
+// 返回值：
+//   - bool: 是否就绪
+//   - string: 未就绪原因，就绪时为空
+//
+// 功能说明：
+//   - 连接必须处于已连接状态
+//   - ReadyRequireMessage：本次连接建立后必须收到过至少一条消息
+//   - ReadyMaxSilence：距最后一条消息（尚未收到消息时从连接建立算起）不得超过该时长
+//
+// 注意事项：
+//   - 静默检查可以发现仅连接层存活、服务端已不再推送数据的半开连接
+//
+// 并发安全：通过mu读锁读取时间戳
+func (c *WebSocketClient) readinessCheck() (bool, string) {
+	// 第一步：连接状态检查
+	if !c.isConnected() {
+		return false, "未连接"
+	}
+
+	// 第二步：读取本次连接的时间戳
+	c.mu.RLock()
+	connectTime := c.Stats.ConnectTime
+	lastReceive := c.lastReceiveTime
+	c.mu.RUnlock()
+	received := !lastReceive.IsZero() && !lastReceive.Before(connectTime)
+
+	// 第三步：消息接收检查
+	if c.config.ReadyRequireMessage && !received {
+		return false, "本次连接尚未收到消息"
+	}
+
+	// 第四步：静默时长检查
+	if c.config.ReadyMaxSilence > 0 {
+		since := connectTime
+		if received {
+			since = lastReceive
+		}
+		if silence := time.Since(since); silence > c.config.ReadyMaxSilence {
+			return false, fmt.Sprintf("已静默 %s，超过 %s", silence.Round(time.Second), c.config.ReadyMaxSilence)
+		}
+	}
+
+	return true, ""
+}
+
+// statsResponse /stats端点的响应
+// 字段与早期手工拼接的JSON保持一致，通过json.Marshal序列化，错误信息和关闭原因中的引号等字符会被正确转义
+type statsResponse struct {
+	SessionID          string            `json:"session_id"`          // 会话标识符
+	Labels             map[string]string `json:"labels"`              // 连接元数据标签
+	State              string            `json:"state"`               // 当前连接状态
+	ConnectTime        string            `json:"connect_time"`        // 连接建立时间
+	LastMessageTime    string            `json:"last_message_time"`   // 最后消息时间
+	UptimeSeconds      float64           `json:"uptime_seconds"`      // 运行时长（秒）
+	MessagesSent       int64             `json:"messages_sent"`       // 发送消息数量
+	MessagesReceived   int64             `json:"messages_received"`   // 接收消息数量
+	BytesSent          int64             `json:"bytes_sent"`          // 发送字节数
+	BytesReceived      int64             `json:"bytes_received"`      // 接收字节数
+	SentByType         MessageTypeCounts `json:"sent_by_type"`        // 按类型分类的发送计数
+	ReceivedByType     MessageTypeCounts `json:"received_by_type"`    // 按类型分类的接收计数
+	ProtocolViolations map[string]int64  `json:"protocol_violations"` // 严格模式下按类型统计的协议违规
+	ReconnectCount     int               `json:"reconnect_count"`     // 重连次数
+	Lifetime           statsLifetime     `json:"lifetime"`            // 逻辑客户端的生命周期
+	CPUUsagePercent    float64           `json:"cpu_usage_percent"`   // 进程CPU使用率
+	PhaseTimingMs      statsPhaseTiming  `json:"phase_timing_ms"`     // 最近一次握手各阶段耗时（毫秒）
+	LastClose          statsLastClose    `json:"last_close"`          // 最近一次服务器关闭帧
+	PingRTTMs          statsPingRTT      `json:"ping_rtt_ms"`         // Ping往返时间统计（毫秒）
+	Rates              statsRates        `json:"rates"`               // 会话平均速率
+	Compression        statsCompression  `json:"compression"`         // 应用层载荷压缩统计
+	InboundQueue       InboundQueueStats `json:"inbound_queue"`       // 入站队列统计
+	Queues             statsQueues       `json:"queues"`              // 其他队列和等待中请求的深度
+	Sequence           SequenceStats     `json:"sequence"`            // 序列号检测统计
+	Errors             statsErrors       `json:"errors"`              // 错误统计
+	Forward            *ForwardStats     `json:"forward,omitempty"`   // 消息转发统计：仅配置了--forward时输出
+	Collector          map[string]any    `json:"collector"`           // 指标收集器的指标
+	Timestamp          string            `json:"timestamp"`           // 当前时间戳
+}
+
+// statsLifetime 逻辑客户端的生命周期
+type statsLifetime struct {
+	FirstStart string `json:"first_start"` // 首次启动时间
+	Restarts   int64  `json:"restarts"`    // 重启次数
+}
+
+// statsPhaseTiming 握手各阶段耗时（毫秒）
+type statsPhaseTiming struct {
+	DNSLookup    int64 `json:"dns_lookup"`    // DNS解析耗时
+	TCPConnect   int64 `json:"tcp_connect"`   // TCP连接耗时
+	TLSHandshake int64 `json:"tls_handshake"` // TLS握手耗时
+	FirstByte    int64 `json:"first_byte"`    // 首字节耗时
+	Total        int64 `json:"total"`         // 握手总耗时
+}
+
+// statsLastClose 最近一次服务器关闭帧
+type statsLastClose struct {
+	Code   int    `json:"code"`   // 关闭码
+	Reason string `json:"reason"` // 关闭原因
+	Time   string `json:"time"`   // 收到关闭帧的时间
+}
+
+// statsPingRTT Ping往返时间统计（毫秒），百分位基于最近PingRTTWindowSize个样本
+type statsPingRTT struct {
+	Samples int64   `json:"samples"` // 测量次数
+	Last    float64 `json:"last"`    // 最近RTT
+	Min     float64 `json:"min"`     // 最小RTT
+	Avg     float64 `json:"avg"`     // 平均RTT
+	Max     float64 `json:"max"`     // 最大RTT
+	Jitter  float64 `json:"jitter"`  // 抖动
+	P50     float64 `json:"p50"`     // 中位数
+	P90     float64 `json:"p90"`     // 90百分位
+	P99     float64 `json:"p99"`     // 99百分位
+}
+
+// statsRates 从客户端创建起计算的平均速率
+type statsRates struct {
+	MessagesSentPerSecond     float64 `json:"messages_sent_per_second"`     // 每秒发送消息数
+	MessagesReceivedPerSecond float64 `json:"messages_received_per_second"` // 每秒接收消息数
+	BytesSentPerSecond        float64 `json:"bytes_sent_per_second"`        // 每秒发送字节数
+	BytesReceivedPerSecond    float64 `json:"bytes_received_per_second"`    // 每秒接收字节数
+	ErrorsPerMinute           float64 `json:"errors_per_minute"`            // 每分钟错误数
+}
+
+// statsCompression 压缩统计及压缩率
+type statsCompression struct {
+	CompressionStats
+	SentRatio     float64 `json:"sent_ratio"`     // 发送压缩率
+	ReceivedRatio float64 `json:"received_ratio"` // 接收压缩率
+}
+
+// statsQueues 入站队列之外的队列和等待中请求的深度
+type statsQueues struct {
+	MessageChannelDepth    int   `json:"message_channel_depth"`    // Messages()通道中等待读取的消息数
+	MessageChannelCapacity int   `json:"message_channel_capacity"` // Messages()通道容量，未调用Messages()时为0
+	MessageChannelDropped  int64 `json:"message_channel_dropped"`  // 因通道已满被丢弃的消息数
+	PendingResponses       int   `json:"pending_responses"`        // 等待响应的SendAndWait调用数
+	PendingPings           int   `json:"pending_pings"`            // 已发送未收到pong的ping数
+	JournalPending         int   `json:"journal_pending"`          // 发送日志中未确认的消息数，未启用--journal时为0
+}
+
+// statsErrors 错误统计
+type statsErrors struct {
+	TotalErrors   int64             `json:"total_errors"`    // 错误总数
+	LastError     string            `json:"last_error"`      // 最后错误信息，没有错误时为空
+	LastErrorTime string            `json:"last_error_time"` // 最后错误时间
+	ByCode        []statsErrorCount `json:"by_code"`         // 按错误码分类的错误数，按错误码排序
+}
+
+// statsErrorCount 一个错误码的累计次数
+type statsErrorCount struct {
+	Code  int    `json:"code"`  // 错误码
+	Name  string `json:"name"`  // 错误码描述
+	Count int64  `json:"count"` // 累计次数
+}
+
+// handleStats 处理统计信息请求
+// 这个HTTP处理器提供详细的WebSocket客户端统计信息，以JSON格式返回
+//
+// 功能说明：
+//   - 收集连接统计和错误统计信息
+//   - 格式化为结构化的JSON响应
+//   - 提供实时的客户端状态快照
+//
+// 返回的统计信息：
+//  1. 基本信息：会话ID、状态、时间戳
+//  2. 连接信息：连接时间、运行时长、重连次数
+//  3. 消息统计：发送/接收的消息数量和字节数
+//  4. 错误统计：错误总数、最后错误、错误时间、按错误码分类的次数
+//  5. 速率和队列：平均收发速率、RTT百分位、各队列深度
+//
+// JSON响应格式：
+//
+//	{
+//	  "session_id": "会话标识符",
+//	  "labels": {"标签名": "标签值"},
+//	  "state": "连接状态",
+//	  "connect_time": "连接建立时间",
+//	  "last_message_time": "最后消息时间",
+//	  "uptime_seconds": 运行时长秒数,
+//	  "messages_sent": 发送消息数,
+//	  "messages_received": 接收消息数,
+//	  "bytes_sent": 发送字节数,
+//	  "bytes_received": 接收字节数,
+//	  "reconnect_count": 重连次数,
+//	  "cpu_usage_percent": 进程CPU使用率（占全部核心的百分比）,
+//	  "phase_timing_ms": {
+//	    "dns_lookup": DNS解析耗时, "tcp_connect": TCP连接耗时,
+//	    "tls_handshake": TLS握手耗时, "first_byte": 首字节耗时, "total": 握手总耗时
+//	  },
+//	  "last_close": {
+//	    "code": 最近一次服务器关闭码, "reason": "关闭原因", "time": "收到关闭帧的时间"
+//	  },
+//	  "ping_rtt_ms": {
+//	    "samples": 测量次数, "last": 最近RTT, "min": 最小RTT, "avg": 平均RTT, "max": 最大RTT, "jitter": 抖动,
+//	    "p50": 中位数, "p90": 90百分位, "p99": 99百分位
+//	  },
+//	  "rates": {
+//	    "messages_sent_per_second": 每秒发送消息数, "messages_received_per_second": 每秒接收消息数,
+//	    "bytes_sent_per_second": 每秒发送字节数, "bytes_received_per_second": 每秒接收字节数, "errors_per_minute": 每分钟错误数
+//	  },
+//	  "compression": {
+//	    "sent_original_bytes": 压缩前发送字节数, "sent_compressed_bytes": 压缩后发送字节数, "sent_ratio": 发送压缩率,
+//	    "received_compressed_bytes": 收到的压缩字节数, "received_original_bytes": 解压后字节数, "received_ratio": 接收压缩率
+//	  },
+//	  "inbound_queue": {
+//	    "policy": "背压策略", "capacity": 队列容量, "depth": 排队消息数, "blocked": 阻塞次数, "dropped": 丢弃消息数
+//	  },
+//	  "queues": {
+//	    "message_channel_depth": Messages()通道中的消息数, "message_channel_capacity": 通道容量,
+//	    "message_channel_dropped": 通道满时丢弃的消息数, "pending_responses": 等待响应的请求数, "pending_pings": 未收到pong的ping数
+//	  },
+//	  "errors": {
+//	    "total_errors": 错误总数,
+//	    "last_error": "最后错误信息",
+//	    "last_error_time": "最后错误时间",
+//	    "by_code": [{"code": 错误码, "name": "错误码描述", "count": 次数}]
+//	  },
+//	  "collector": {指标收集器中按标签累计的收发和错误指标},
+//	  "timestamp": "当前时间戳"
+//	}
+//
+// 使用场景：
+//   - 监控系统的数据收集
+//   - 运维工具的状态查询
+//   - 调试和问题诊断
+//   - 性能分析和优化
+func (c *WebSocketClient) handleStats(w http.ResponseWriter, r *http.Request) {
+	// 获取最新的统计数据
+	stats := c.GetStats()
+	errorStats := c.GetErrorStats()
+	// 只读取性能快照：CPU使用率是两次采样之间的平均值，由后台采样器按--sample-interval更新，
+	// 每次抓取都采样会不断重置统计窗口；禁用后台采样时没有其他采样来源，才在这里更新
+	if c.config.SampleInterval <= 0 {
+		c.performanceMonitor.UpdateMetrics(stats)
+	}
+	cpuUsage, _ := c.performanceMonitor.GetPerformanceReport()["cpu_usage_percent"].(float64)
+
+	// 构建结构化的响应，没有标签和协议违规时输出空对象而不是null
+	response := statsResponse{
+		SessionID:          c.SessionID,
+		Labels:             c.config.Labels,
+		State:              c.GetState().String(),
+		ConnectTime:        stats.ConnectTime.Format(time.RFC3339),
+		LastMessageTime:    stats.LastMessageTime.Format(time.RFC3339),
+		UptimeSeconds:      math.Round(stats.Uptime.Seconds()),
+		MessagesSent:       stats.MessagesSent,
+		MessagesReceived:   stats.MessagesReceived,
+		BytesSent:          stats.BytesSent,
+		BytesReceived:      stats.BytesReceived,
+		SentByType:         stats.SentByType,
+		ReceivedByType:     stats.ReceivedByType,
+		ProtocolViolations: stats.ProtocolViolations,
+		ReconnectCount:     stats.ReconnectCount,
+		Lifetime: statsLifetime{
+			FirstStart: c.firstStartTime.Format(time.RFC3339),
+			Restarts:   c.restarts,
+		},
+		CPUUsagePercent: math.Round(cpuUsage*100) / 100,
+		PhaseTimingMs: statsPhaseTiming{
+			DNSLookup:    stats.PhaseTiming.DNSLookup.Milliseconds(),
+			TCPConnect:   stats.PhaseTiming.TCPConnect.Milliseconds(),
+			TLSHandshake: stats.PhaseTiming.TLSHandshake.Milliseconds(),
+			FirstByte:    stats.PhaseTiming.FirstByte.Milliseconds(),
+			Total:        stats.PhaseTiming.Total.Milliseconds(),
+		},
+		LastClose: statsLastClose{
+			Code:   stats.LastClose.Code,
+			Reason: stats.LastClose.Reason,
+			Time:   stats.LastClose.Time.Format(time.RFC3339),
+		},
+		PingRTTMs: statsPingRTT{
+			Samples: stats.Ping.Samples,
+			Last:    stats.Ping.LastMs,
+			Min:     stats.Ping.MinMs,
+			Avg:     stats.Ping.AvgMs,
+			Max:     stats.Ping.MaxMs,
+			Jitter:  stats.Ping.JitterMs,
+			P50:     stats.Ping.P50Ms,
+			P90:     stats.Ping.P90Ms,
+			P99:     stats.Ping.P99Ms,
+		},
+		Compression: statsCompression{
+			CompressionStats: stats.Compression,
+			SentRatio:        stats.Compression.SentRatio(),
+			ReceivedRatio:    stats.Compression.ReceivedRatio(),
+		},
+		InboundQueue: stats.InboundQueue,
+		Queues:       c.queueDepths(),
+		Sequence:     stats.Sequence,
+		Errors: statsErrors{
+			TotalErrors:   errorStats.TotalErrors,
+			LastErrorTime: errorStats.LastErrorTime.Format(time.RFC3339),
+			ByCode:        make([]statsErrorCount, 0, len(errorStats.ErrorsByCode)),
+		},
+		Collector: c.metricsCollector.GetMetrics(),
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if response.Labels == nil {
+		response.Labels = map[string]string{}
+	}
+	if c.forwarder != nil {
+		forward := c.forwarder.stats()
+		response.Forward = &forward
+	}
+	if response.ProtocolViolations == nil {
+		response.ProtocolViolations = map[string]int64{}
+	}
+	if errorStats.LastError != nil {
+		response.Errors.LastError = errorStats.LastError.Error()
+	}
+	for _, code := range slices.Sorted(maps.Keys(errorStats.ErrorsByCode)) {
+		response.Errors.ByCode = append(response.Errors.ByCode, statsErrorCount{
+			Code:  int(code),
+			Name:  code.String(),
+			Count: errorStats.ErrorsByCode[code],
+		})
+	}
+
+	// 按客户端创建以来的时长计算平均速率，只计本进程的计数（减去从状态文件恢复的基线）
+	if elapsed := time.Since(c.startTime).Seconds(); elapsed > 0 {
+		response.Rates = statsRates{
+			MessagesSentPerSecond:     float64(stats.MessagesSent-c.baseline.MessagesSent) / elapsed,
+			MessagesReceivedPerSecond: float64(stats.MessagesReceived-c.baseline.MessagesReceived) / elapsed,
+			BytesSentPerSecond:        float64(stats.BytesSent-c.baseline.BytesSent) / elapsed,
+			BytesReceivedPerSecond:    float64(stats.BytesReceived-c.baseline.BytesReceived) / elapsed,
+			ErrorsPerMinute:           float64(errorStats.TotalErrors-c.baseline.Errors.TotalErrors) / elapsed * 60,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// queueDepths 返回Messages()通道、等待中的SendAndWait调用、未收到pong的ping和发送日志中未确认消息的数量
+//
+// 并发安全：分别持有各自的锁读取
+func (c *WebSocketClient) queueDepths() statsQueues {
+	queues := statsQueues{MessageChannelDropped: atomic.LoadInt64(&c.messageChDropped)}
+
+	c.messageChMu.RLock()
+	if c.messageCh != nil && !c.messageChClosed {
+		queues.MessageChannelDepth = len(c.messageCh)
+		queues.MessageChannelCapacity = cap(c.messageCh)
+	}
+	c.messageChMu.RUnlock()
+
+	c.waitersMu.Lock()
+	queues.PendingResponses = len(c.responseWaiters)
+	c.waitersMu.Unlock()
+
+	c.mu.RLock()
+	queues.PendingPings = len(c.pendingPings)
+	c.mu.RUnlock()
+
+	if c.journal != nil {
+		queues.JournalPending = c.journal.pendingCount()
+	}
+
+	return queues
+}
+
+// ===== 桥接模式 =====
+
+// DefaultBridgeTimeout 桥接模式默认等待WebSocket响应的时间
+const DefaultBridgeTimeout = 5 * time.Second
+
+// 运行模式子命令
+const (
+	ModeBridge = "bridge" // REST到WebSocket桥接：HTTP POST请求体作为消息发送，响应消息作为HTTP响应返回
+	ModeRelay  = "relay"  // 本地WebSocket中继：本地客户端与远程服务器之间双向转发帧
+
+	ModeConformance = "conformance" // 协议一致性测试：对服务器执行一组测试用例并输出报告后退出
+	ModeCheck       = "check"       // 回显探测：发送一条消息，收到期望的响应后输出往返时间并退出
+	ModeScenario    = "scenario"    // 场景脚本：按脚本依次执行发送、等待、期望、关闭步骤后退出
+	ModeBench       = "bench"       // 压测：多个连接并发发送消息并等待回显，输出吞吐量和往返时间后退出
+	ModeReplay      = "replay"      // 会话重放：按原始间隔重发会话记录或抓包数据库中的发送消息后退出
+	ModeServe       = "serve"       // 测试服务器：本地WebSocket回显或广播服务器，不连接远程服务器
+
+	// connectSubcommand 显式的默认连接子命令，"wsc connect <URL>"与"wsc <URL>"等价
+	connectSubcommand = "connect"
+)
+
+// bridgeMessage 桥接模式中转的一条接收消息
+type bridgeMessage struct {
+	messageType int    // WebSocket消息类型
+	data        []byte // 消息内容
+}
+
+// startBridgeServer 启动REST到WebSocket桥接服务器
+// 每个HTTP POST请求体作为一条WebSocket消息发送，超时时间内收到的第一条消息作为HTTP响应返回
+//
+// 返回值：
+//   - error: 监听地址无法绑定时返回错误
+//
+// 请求处理规则：
+//   - 请求按到达顺序串行处理，保证请求与响应一一对应
+//   - Content-Type为application/octet-stream时发送二进制消息，否则发送文本消息
+//   - 没有请求在等待时收到的消息会被丢弃
+//   - 超时未收到响应返回504，未连接或发送失败返回502
+//
+// 注意事项：
+//   - 应在Start()之前调用；连接断开后由Start主循环自动重连，桥接服务持续可用
+func (c *WebSocketClient) startBridgeServer() error {
+	addr := loopbackListenAddr(c.config.ListenAddr)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf(tr("无法监听 %s: %w"), addr, err)
+	}
+
+	c.bridgeResponses = make(chan bridgeMessage, 64)
+	server := &http.Server{
+		Handler:           http.HandlerFunc(c.handleBridgeRequest),
+		ReadHeaderTimeout: 10 * time.Second,                        // 防止慢速攻击
+		ReadTimeout:       30 * time.Second,                        // 完整请求读取超时
+		WriteTimeout:      c.config.BridgeTimeout + 30*time.Second, // 需要覆盖等待响应的时间
+		IdleTimeout:       60 * time.Second,                        // 空闲连接超时
+	}
+
+	go func() {
+		<-c.ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf(tr("⚠️ 关闭桥接服务器失败: %v"), err)
+		}
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf(tr("❌ 桥接服务器异常退出: %v"), err)
+		}
+	}()
+
+	auth := "无认证，仅限本机"
+	if c.config.AdminToken != "" {
+		auth = "需要Bearer令牌"
+	}
+	log.Printf(tr("🌉 桥接服务已启动: http://%s -> %s (响应超时 %v，%s)"), listener.Addr(), c.config.URL, c.config.BridgeTimeout, auth)
+	return nil
+}
+
+// loopbackListenAddr 为没有主机部分的监听地址（如":8081"）补上127.0.0.1
+// 本地服务默认只对本机开放，需要对外提供服务时显式写出主机，如 0.0.0.0:8081
+func loopbackListenAddr(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
+
+// isLoopbackListenAddr 判断监听地址（补全主机后）是否只对本机开放
+func isLoopbackListenAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(loopbackListenAddr(addr))
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleBridgeRequest 处理一个桥接HTTP请求
+// 配置了--admin-token时要求与管理API相同的Bearer令牌认证
+func (c *WebSocketClient) handleBridgeRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "只支持POST请求", http.StatusMethodNotAllowed)
+		return
+	}
+	if c.config.AdminToken != "" && !checkBearerToken(r, c.config.AdminToken) {
+		log.Printf(tr("🚫 桥接请求认证失败: 来自 %s"), r.RemoteAddr)
+		http.Error(w, "认证失败", http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(c.config.MaxMessageSize)))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("读取请求体失败: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	messageType := websocket.TextMessage
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		messageType = websocket.BinaryMessage
+	}
+
+	// 串行处理请求，丢弃上一个请求之后到达的无主消息
+	c.bridgeMu.Lock()
+	defer c.bridgeMu.Unlock()
+	for len(c.bridgeResponses) > 0 {
+		<-c.bridgeResponses
+	}
+
+	if err := c.SendMessage(messageType, body); errors.Is(err, ErrQueued) {
+		// 消息在重连后才会发出，响应无法在本次请求内等到
+		http.Error(w, "WebSocket连接不可用，消息已排队，连接后重发", http.StatusAccepted)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("发送WebSocket消息失败: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	timer := time.NewTimer(c.config.BridgeTimeout)
+	defer timer.Stop()
+	select {
+	case msg := <-c.bridgeResponses:
+		contentType := "text/plain; charset=utf-8"
+		if msg.messageType == websocket.BinaryMessage {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		if _, err := w.Write(msg.data); err != nil {
+			log.Printf(tr("⚠️ 写入桥接响应失败: %v"), err)
+		}
+	case <-timer.C:
+		http.Error(w, fmt.Sprintf("%v 内未收到WebSocket响应", c.config.BridgeTimeout), http.StatusGatewayTimeout)
+	case <-r.Context().Done():
+		// 客户端已放弃请求
+	}
+}
+
+// forwardToBridge 将收到的消息交给等待中的桥接请求（未启用桥接模式时不做任何事）
+func (c *WebSocketClient) forwardToBridge(messageType int, message []byte) {
+	if c.bridgeResponses == nil || (messageType != websocket.TextMessage && messageType != websocket.BinaryMessage) {
+		return
+	}
+	select {
+	case c.bridgeResponses <- bridgeMessage{messageType: messageType, data: bytes.Clone(message)}:
+	default:
+		// 缓冲已满说明没有请求在等待，丢弃
+	}
+}
+
+// ===== 中继模式 =====
+
+// relayPeerQueueSize 每个本地中继客户端的待发送消息队列长度
+const relayPeerQueueSize = 256
+
+// relayPeer 一个连接到本地中继服务的WebSocket客户端
+type relayPeer struct {
+	conn     *websocket.Conn    // 本地客户端连接
+	send     chan bridgeMessage // 待转发给本地客户端的上游消息
+	shutdown bool               // 中继服务退出（而非本地客户端断开）时为true，在关闭send之前设置
+}
+
+// startRelayServer 启动本地WebSocket中继服务器
+// 接受本地WebSocket客户端连接，将其消息转发到远程服务器，并将远程消息广播给所有本地客户端
+//
+// 返回值：
+//   - error: 监听地址无法绑定时返回错误
+//
+// 转发规则：
+//   - 本地客户端发送的消息在上游断开期间会等待重连完成后再发送，对本地客户端透明
+//   - 上游消息广播给所有本地客户端；某个客户端队列已满时丢弃该客户端的这条消息
+//   - 上游断开重连不会关闭本地连接，客户端退出时以1001关闭所有本地连接
+//
+// 注意事项：
+//   - 应在Start()之前调用，上游的重连与退避由Start主循环负责
+func (c *WebSocketClient) startRelayServer() error {
+	listener, err := net.Listen("tcp", c.config.ListenAddr)
+	if err != nil {
+		return fmt.Errorf(tr("无法监听 %s: %w"), c.config.ListenAddr, err)
+	}
+
+	c.relayPeers = make(map[*relayPeer]struct{})
+	server := &http.Server{
+		Handler:           http.HandlerFunc(c.handleRelayConnection),
+		ReadHeaderTimeout: 10 * time.Second, // 防止慢速攻击
+	}
+
+	go func() {
+		<-c.ctx.Done()
+		c.closeRelayPeers()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf(tr("⚠️ 关闭中继服务器失败: %v"), err)
+		}
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf(tr("❌ 中继服务器异常退出: %v"), err)
+		}
+	}()
+
+	log.Printf(tr("🔀 中继服务已启动: ws://%s -> %s"), listener.Addr(), c.config.URL)
+	return nil
+}
+
+// handleRelayConnection 升级本地HTTP请求为WebSocket连接并开始双向转发
+func (c *WebSocketClient) handleRelayConnection(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  c.config.ReadBufferSize,
+		WriteBufferSize: c.config.WriteBufferSize,
+		CheckOrigin: func(r *http.Request) bool {
+			return c.securityChecker.CheckOrigin(r.Header.Get("Origin"), r.Host)
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf(tr("⚠️ 中继连接升级失败: %v"), err)
+		return
+	}
+	conn.SetReadLimit(int64(c.config.MaxMessageSize))
+
+	peer := &relayPeer{conn: conn, send: make(chan bridgeMessage, relayPeerQueueSize)}
+	c.relayMu.Lock()
+	if c.relayPeers == nil {
+		// 中继服务已关闭
+		c.relayMu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	c.relayPeers[peer] = struct{}{}
+	c.relayMu.Unlock()
+	log.Printf(tr("🔀 本地中继客户端已连接: %s"), r.RemoteAddr)
+
+	go c.relayPeerWriter(peer)
+	c.relayPeerReader(peer)
+
+	c.removeRelayPeer(peer)
+	log.Printf(tr("🔀 本地中继客户端已断开: %s"), r.RemoteAddr)
+}
+
+// relayPeerReader 读取本地客户端的消息并转发到上游，直到本地连接关闭
+func (c *WebSocketClient) relayPeerReader(peer *relayPeer) {
+	for {
+		messageType, data, err := peer.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		// 上游断开期间等待重连，让本地客户端感知不到上游抖动
+		for c.waitUntilConnected() {
+			if err := c.SendMessage(messageType, data); err == nil || errors.Is(err, ErrQueued) {
+				// 已保留在发送日志中的消息会在重连后重发，不能再次发送
+				break
+			} else if c.isConnected() {
+				log.Printf(tr("⚠️ 中继消息转发失败，已丢弃: %v"), err)
+				break
+			}
+		}
+	}
+}
+
+// relayPeerWriter 将上游消息写给本地客户端，保证每个连接只有一个写入者
+func (c *WebSocketClient) relayPeerWriter(peer *relayPeer) {
+	defer func() { _ = peer.conn.Close() }()
+	for msg := range peer.send {
+		if err := peer.conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout)); err != nil {
+			return
+		}
+		if err := peer.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+			log.Printf(tr("⚠️ 写入本地中继客户端失败: %v"), err)
+			return
+		}
+	}
+	// 本地客户端自行断开时，关闭握手已由读取端完成，不应再以1001通知
+	if !peer.shutdown {
+		return
+	}
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "relay shutting down")
+	if err := peer.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second)); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		log.Printf(tr("⚠️ 通知本地中继客户端关闭失败: %v"), err)
+	}
+}
+
+// removeRelayPeer 移除一个本地中继客户端并停止其写入协程
+func (c *WebSocketClient) removeRelayPeer(peer *relayPeer) {
+	c.relayMu.Lock()
+	defer c.relayMu.Unlock()
+	if _, ok := c.relayPeers[peer]; ok {
+		delete(c.relayPeers, peer)
+		close(peer.send)
+	}
+}
+
+// closeRelayPeers 关闭所有本地中继客户端并拒绝新的连接
+func (c *WebSocketClient) closeRelayPeers() {
+	c.relayMu.Lock()
+	defer c.relayMu.Unlock()
+	for peer := range c.relayPeers {
+		peer.shutdown = true
+		close(peer.send)
+	}
+	c.relayPeers = nil
+}
+
+// forwardToRelay 将收到的上游消息广播给所有本地中继客户端（未启用中继模式时不做任何事）
+func (c *WebSocketClient) forwardToRelay(messageType int, message []byte) {
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return
+	}
+	c.relayMu.Lock()
+	defer c.relayMu.Unlock()
+	if len(c.relayPeers) == 0 {
+		return
+	}
+	msg := bridgeMessage{messageType: messageType, data: bytes.Clone(message)}
+	for peer := range c.relayPeers {
+		select {
+		case peer.send <- msg:
+		default:
+			log.Printf(tr("⚠️ 本地中继客户端 %s 消息队列已满，丢弃消息"), peer.conn.RemoteAddr())
+		}
+	}
+}
+
+// ===== 自动回复规则 =====
+
+// AutoReplyRule 一条自动回复规则
+// 收到的文本消息满足全部匹配条件时，渲染Reply模板并作为文本消息发送回服务器
+type AutoReplyRule struct {
+	Name     string `json:"name" yaml:"name"`                               // 规则名称，用于日志显示
+	Regex    string `json:"regex,omitempty" yaml:"regex,omitempty"`         // 正则表达式匹配条件，捕获组可在模板中通过.Groups引用
+	JSONPath string `json:"json_path,omitempty" yaml:"json_path,omitempty"` // JSON路径匹配条件（如 type、data.items.0.id、$.op），要求消息为JSON
+	Equals   string `json:"equals,omitempty" yaml:"equals,omitempty"`       // JSON路径取值需要等于的内容，为空时只要求路径存在
+	Reply    string `json:"reply" yaml:"reply"`                             // 回复内容模板（text/template语法）
+
+	regex    *regexp.Regexp     // 编译后的正则表达式
+	template *template.Template // 编译后的回复模板
+}
+
+// AutoReplyRuleSet 规则文件的顶层结构
+type AutoReplyRuleSet struct {
+	Rules []*AutoReplyRule `json:"rules" yaml:"rules"` // 按顺序匹配的规则列表
+}
+
+// autoReplyData 回复模板可以引用的数据
+type autoReplyData struct {
+	Message string   // 收到的原始消息
+	Groups  []string // 正则捕获组，Groups 0为完整匹配
+	JSON    any      // 解析后的JSON消息，非JSON消息时为nil
+}
+
+// autoReplyFuncs 回复模板可以使用的函数
+var autoReplyFuncs = template.FuncMap{
+	// json 把值编码为JSON文本，适合在回复中原样嵌入字段
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// path 按JSON路径从值中取字段，路径不存在时返回nil
+	"path": func(v any, path string) any {
+		value, _ := lookupJSONPath(v, path)
+		return value
+	},
+	// now 返回当前时间
+	"now": time.Now,
+}
+
+// LoadAutoReplyRules 从YAML或JSON文件加载自动回复规则
+//
+// 参数说明：
+//   - path: 规则文件路径，扩展名为.json时按JSON解析，否则按YAML解析
+//
+// 返回值：
+//   - []*AutoReplyRule: 已编译的规则列表
+//   - error: 读取、解析或编译失败时的错误信息，会指出出错的规则
+func LoadAutoReplyRules(path string) ([]*AutoReplyRule, error) {
+	// #nosec G304 -- 文件路径由用户通过--rules显式指定，仅用于读取
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("读取规则文件失败: %w"), err)
+	}
+
+	var ruleSet AutoReplyRuleSet
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &ruleSet)
+	} else {
+		err = yaml.Unmarshal(data, &ruleSet)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(tr("解析规则文件失败: %w"), err)
+	}
+
+	for i, rule := range ruleSet.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf(tr("规则 %s 无效: %w"), rule.Name, err)
+		}
+	}
+	return ruleSet.Rules, nil
+}
+
+// compile 验证规则并编译正则表达式和回复模板
+func (r *AutoReplyRule) compile() error {
+	if r.Regex == "" && r.JSONPath == "" {
+		return errors.New(tr("至少需要regex或json_path匹配条件之一"))
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf(tr("正则表达式错误: %w"), err)
+		}
+		r.regex = re
+	}
+	tmpl, err := template.New(r.Name).Funcs(autoReplyFuncs).Option("missingkey=zero").Parse(r.Reply)
+	if err != nil {
+		return fmt.Errorf(tr("回复模板错误: %w"), err)
+	}
+	r.template = tmpl
+	return nil
+}
+
+// match 检查消息是否满足规则，满足时返回模板数据
+func (r *AutoReplyRule) match(message string, parsed any, isJSON bool) (*autoReplyData, bool) {
+	data := &autoReplyData{Message: message}
+	if isJSON {
+		data.JSON = parsed
+	}
+
+	if r.regex != nil {
+		data.Groups = r.regex.FindStringSubmatch(message)
+		if data.Groups == nil {
+			return nil, false
+		}
+	}
+	if r.JSONPath != "" {
+		if !isJSON {
+			return nil, false
+		}
+		value, ok := lookupJSONPath(parsed, r.JSONPath)
+		if !ok || (r.Equals != "" && fmt.Sprint(value) != r.Equals) {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// lookupJSONPath 按点分路径从解析后的JSON值中取字段
+// 路径段为对象键或数组下标，可带可选的"$."前缀，例如 $.data.items.0.id
+//
+// 返回值：
+//   - any: 字段值
+//   - bool: 路径是否存在
+func lookupJSONPath(value any, path string) (any, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return value, true
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]any:
+			next, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			value = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// SetAutoReplyRules 设置自动回复规则，传入nil清除所有规则
+//
+// 并发安全：可以在客户端运行期间调用
+func (c *WebSocketClient) SetAutoReplyRules(rules []*AutoReplyRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.autoReplyRules = rules
+}
+
+// applyAutoReplyRules 按顺序匹配自动回复规则，第一条匹配的规则生效
+// 只处理文本消息；回复发送失败只记录日志，不影响消息处理
+func (c *WebSocketClient) applyAutoReplyRules(messageType int, message []byte) {
+	c.mu.RLock()
+	rules := c.autoReplyRules
+	c.mu.RUnlock()
+	if len(rules) == 0 || messageType != websocket.TextMessage {
+		return
+	}
+
+	text := string(message)
+	var parsed any
+	isJSON := json.Unmarshal(message, &parsed) == nil
+
+	for _, rule := range rules {
+		data, ok := rule.match(text, parsed, isJSON)
+		if !ok {
+			continue
+		}
+
+		var reply strings.Builder
+		if err := rule.template.Execute(&reply, data); err != nil {
+			log.Printf(tr("⚠️ 自动回复规则 %s 渲染失败: %v"), rule.Name, err)
+			return
+		}
+		if c.config.Verbose {
+			log.Printf(tr("🤖 自动回复规则 %s 已匹配"), rule.Name)
+		}
+		if err := c.SendMessage(websocket.TextMessage, []byte(reply.String())); errors.Is(err, ErrQueued) {
+			log.Printf(tr("📒 自动回复规则 %s 的回复已排队，连接后重发"), rule.Name)
+		} else if err != nil {
+			log.Printf(tr("⚠️ 自动回复规则 %s 发送失败: %v"), rule.Name, err)
+		}
+		return
+	}
+}
+
+// ===== 消息中间件 =====
+
+// MessageHandler 消息处理函数，是中间件链中的一个处理阶段
+//
+// 参数说明：
+//   - messageType: WebSocket消息类型（TextMessage或BinaryMessage）
+//   - data: 消息内容
+//
+// 返回值：
+//   - error: 处理失败时的错误信息
+type MessageHandler func(messageType int, data []byte) error
+
+// Middleware 消息中间件，包装下一个处理阶段并返回新的处理阶段
+// 中间件可以在调用next前后执行逻辑、修改消息内容，或不调用next以丢弃消息
+//
+// 使用场景：
+//   - 日志和审计：记录每条收发的消息
+//   - 转换：压缩/解压、编码转换、加密/解密
+//   - 过滤：丢弃不需要的消息
+//
+// Example:
+//
+//	client.UseInbound(func(next MessageHandler) MessageHandler {
+//		return func(messageType int, data []byte) error {
+//			if bytes.HasPrefix(data, []byte("heartbeat")) {
+//				return nil // 丢弃心跳消息
+//			}
+//			return next(messageType, data)
+//		}
+//	})
+type Middleware func(next MessageHandler) MessageHandler
+
+// UseInbound 追加入站中间件，包装在消息处理器、用户回调和自动回复规则之外
+// 先注册的中间件位于外层，最先看到收到的消息
+//
+// 注意事项：
+//   - 统计、文件日志和管理API消息历史记录的是中间件处理前的原始消息
+//   - 控制帧不经过中间件
+//   - data的底层缓冲区在处理完成后会归还内存池，需要在处理链之外保留时请复制
+//
+// 并发安全：可以在客户端运行期间调用
+func (c *WebSocketClient) UseInbound(middleware ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inboundMiddleware = append(c.inboundMiddleware, middleware...)
+}
+
+// UseOutbound 追加出站中间件，包装在SendMessage的实际发送之外
+// 先注册的中间件位于外层，最先看到待发送的消息
+//
+// 注意事项：
+//   - 控制帧（ping/pong/close）和SendStream的分片发送不经过中间件
+//   - 中间件返回的错误会作为SendMessage的返回值
+//
+// 并发安全：可以在客户端运行期间调用
+func (c *WebSocketClient) UseOutbound(middleware ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outboundMiddleware = append(c.outboundMiddleware, middleware...)
+}
+
+// chainMiddleware 把中间件按注册顺序包装在最终处理阶段之外
+func chainMiddleware(final MessageHandler, middleware []Middleware) MessageHandler {
+	handler := final
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// isDataMessage 判断消息类型是否为数据帧（文本或二进制）
+func isDataMessage(messageType int) bool {
+	return messageType == websocket.TextMessage || messageType == websocket.BinaryMessage
+}
+
+// ===== 应用层载荷压缩 =====
+
+// gzipMagic gzip数据的魔数前缀
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// CompressionStats 应用层载荷压缩统计
+// 与WebSocket的permessage-deflate扩展无关，只统计--payload-gzip中间件处理的消息
+type CompressionStats struct {
+	SentOriginalBytes       int64 `json:"sent_original_bytes"`       // 压缩前的发送字节数
+	SentCompressedBytes     int64 `json:"sent_compressed_bytes"`     // 压缩后实际发送的字节数
+	ReceivedCompressedBytes int64 `json:"received_compressed_bytes"` // 收到的gzip载荷字节数
+	ReceivedOriginalBytes   int64 `json:"received_original_bytes"`   // 解压后的字节数
+}
+
+// SentRatio 发送方向压缩率（压缩后/压缩前），没有数据时为0
+func (s CompressionStats) SentRatio() float64 {
+	if s.SentOriginalBytes == 0 {
+		return 0
+	}
+	return float64(s.SentCompressedBytes) / float64(s.SentOriginalBytes)
+}
+
+// ReceivedRatio 接收方向压缩率（压缩后/解压后），没有数据时为0
+func (s CompressionStats) ReceivedRatio() float64 {
+	if s.ReceivedOriginalBytes == 0 {
+		return 0
+	}
+	return float64(s.ReceivedCompressedBytes) / float64(s.ReceivedOriginalBytes)
+}
+
+// gzipPayload 使用gzip压缩载荷
+func gzipPayload(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipPayload 解压gzip载荷，解压后超过maxSize字节时返回错误，防止解压炸弹
+func gunzipPayload(data []byte, maxSize int) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	plain, err := io.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(plain) > maxSize {
+		return nil, fmt.Errorf(tr("解压后大小超过限制 %d"), maxSize)
+	}
+	return plain, nil
+}
+
+// EnablePayloadGzip 启用应用层gzip载荷压缩
+// 适用于要求消息体本身是gzip压缩数据的服务器（不同于permessage-deflate扩展）
+//
+// 处理规则：
+//   - 发送：文本和二进制消息压缩后都以二进制帧发送（gzip数据不是合法UTF-8）
+//   - 接收：以gzip魔数(1f 8b)开头的二进制消息自动解压，解压结果是合法UTF-8时按文本消息处理
+//   - 解压失败或非gzip的消息原样交给后续处理
+//   - 压缩前后的字节数记录在ConnectionStats.Compression中
+//
+// 注意事项：
+//   - 应在EnableE2EEncryption之前调用，保证先压缩再加密
+func (c *WebSocketClient) EnablePayloadGzip() {
+	c.UseOutbound(func(next MessageHandler) MessageHandler {
+		return func(messageType int, data []byte) error {
+			compressed, err := gzipPayload(data)
+			if err != nil {
+				return fmt.Errorf(tr("gzip压缩失败: %w"), err)
+			}
+			if err := next(websocket.BinaryMessage, compressed); err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.Stats.Compression.SentOriginalBytes += int64(len(data))
+			c.Stats.Compression.SentCompressedBytes += int64(len(compressed))
+			c.mu.Unlock()
+			return nil
+		}
+	})
+	c.UseInbound(func(next MessageHandler) MessageHandler {
+		return func(messageType int, data []byte) error {
+			if messageType != websocket.BinaryMessage || !bytes.HasPrefix(data, gzipMagic) {
+				return next(messageType, data)
+			}
+			plain, err := gunzipPayload(data, c.config.MaxMessageSize)
+			if err != nil {
+				log.Printf(tr("⚠️ gzip载荷解压失败，按原始数据处理: %v"), err)
+				return next(messageType, data)
+			}
+			c.mu.Lock()
+			c.Stats.Compression.ReceivedCompressedBytes += int64(len(data))
+			c.Stats.Compression.ReceivedOriginalBytes += int64(len(plain))
+			c.mu.Unlock()
+			if utf8.Valid(plain) {
+				messageType = websocket.TextMessage
+			}
+			return next(messageType, plain)
+		}
+	})
+}
+
+// ===== 混沌测试 =====
+
+// ChaosConfig 混沌测试（故障注入）配置
+// 每种故障按给定概率独立触发，概率取值范围0-1，0表示不注入该故障
+type ChaosConfig struct {
+	DropProb    float64       `json:"drop,omitempty" yaml:"drop,omitempty"`           // 每条收发消息触发连接中断的概率，用于验证重连和自动恢复
+	DelayProb   float64       `json:"delay,omitempty" yaml:"delay,omitempty"`         // 每条发送消息被延迟的概率
+	DelayMax    time.Duration `json:"delay_max,omitempty" yaml:"delay_max,omitempty"` // 延迟的最大时长，实际延迟在0到此值之间均匀分布
+	DupProb     float64       `json:"dup,omitempty" yaml:"dup,omitempty"`             // 每条发送消息被重复发送一次的概率
+	CorruptProb float64       `json:"corrupt,omitempty" yaml:"corrupt,omitempty"`     // 每条发送消息被翻转一个随机比特的概率
+	Seed        uint64        `json:"seed,omitempty" yaml:"seed,omitempty"`           // 随机数种子，非0时故障序列可以重现
+}
+
+// DefaultChaosDelayMax 混沌测试默认的最大写入延迟
+const DefaultChaosDelayMax = 500 * time.Millisecond
+
+// ParseChaosSpec 解析--chaos参数
+// 格式为逗号分隔的key=value，例如 drop=0.01,delay=0.2,delay-max=1s,dup=0.05,corrupt=0.01,seed=42
+//
+// 返回值：
+//   - *ChaosConfig: 解析后的配置，未指定的delay-max使用DefaultChaosDelayMax
+//   - error: 键未知、概率不在0-1之间或时长无效时返回错误
+func ParseChaosSpec(spec string) (*ChaosConfig, error) {
+	chaos := &ChaosConfig{DelayMax: DefaultChaosDelayMax}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf(tr("混沌参数 '%s' 缺少 =值"), item)
+		}
+
+		var err error
+		switch key {
+		case "drop":
+			chaos.DropProb, err = parseProbability(value)
+		case "delay":
+			chaos.DelayProb, err = parseProbability(value)
+		case "dup":
+			chaos.DupProb, err = parseProbability(value)
+		case "corrupt":
+			chaos.CorruptProb, err = parseProbability(value)
+		case "delay-max":
+			chaos.DelayMax, err = time.ParseDuration(value)
+			if err == nil && chaos.DelayMax <= 0 {
+				err = errors.New(tr("必须大于0"))
+			}
+		case "seed":
+			chaos.Seed, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return nil, fmt.Errorf(tr("未知的混沌参数 '%s'，可选 drop、delay、delay-max、dup、corrupt、seed"), key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf(tr("混沌参数 %s 的值 '%s' 无效: %v"), key, value, err)
+		}
+	}
+	return chaos, nil
+}
+
+// parseProbability 解析0-1之间的概率值
+func parseProbability(value string) (float64, error) {
+	prob, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !validProbability(prob) {
+		return 0, errors.New(tr("概率必须在0到1之间"))
+	}
+	return prob, nil
+}
+
+// validProbability 检查概率是否在[0,1]之间（NaN视为无效）
+func validProbability(prob float64) bool {
+	return prob >= 0 && prob <= 1
+}
+
+// Validate 检查混沌测试配置
+// 所有概率必须在0到1之间，延迟上限不能为负数（为0时EnableChaos使用DefaultChaosDelayMax）
+func (cc *ChaosConfig) Validate() error {
+	for _, p := range []struct {
+		name string
+		prob float64
+	}{{"drop", cc.DropProb}, {"delay", cc.DelayProb}, {"dup", cc.DupProb}, {"corrupt", cc.CorruptProb}} {
+		if !validProbability(p.prob) {
+			return fmt.Errorf(tr("%s 概率 %v 必须在0到1之间"), p.name, p.prob)
+		}
+	}
+	if cc.DelayMax < 0 {
+		return fmt.Errorf(tr("delay_max 不能为负数: %v"), cc.DelayMax)
+	}
+	return nil
+}
+
+// chaosInjector 按配置的概率注入故障
+type chaosInjector struct {
+	config *ChaosConfig
+	rng    *mathrand.Rand // 随机数生成器，受mu保护
+	mu     sync.Mutex
+}
+
+// hit 以给定概率返回true
+func (ci *chaosInjector) hit(prob float64) bool {
+	if prob <= 0 {
+		return false
+	}
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	return ci.rng.Float64() < prob
+}
+
+// intN 返回[0,n)之间的随机整数
+func (ci *chaosInjector) intN(n int64) int64 {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	return ci.rng.Int64N(n)
+}
+
+// EnableChaos 启用混沌测试模式，在中间件链最内层注入故障
+// 用于在恶劣网络条件下验证服务器和客户端自身的恢复路径（自动重连、AutoRecovery、DefaultErrorRecovery）
+//
+// 故障类型：
+//   - 连接中断：直接关闭底层TCP连接，模拟网络故障，收发消息时都可能触发
+//   - 写入延迟：发送前随机等待0到DelayMax（未设置时为DefaultChaosDelayMax）
+//   - 帧重复：同一条消息发送两次
+//   - 数据损坏：翻转消息中的一个随机比特（文本消息可能因此变成非法UTF-8）
+//
+// 注意事项：
+//   - 应在其他中间件（压缩、加密）注册之后调用，使故障作用于实际传输的数据
+//   - 仅用于测试，不要在生产环境启用
+func (c *WebSocketClient) EnableChaos(config *ChaosConfig) {
+	seed := config.Seed
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano()) // #nosec G115 -- 时间戳仅用作随机种子
+	}
+	delayMax := config.DelayMax
+	if delayMax <= 0 {
+		delayMax = DefaultChaosDelayMax
+	}
+	ci := &chaosInjector{config: config, rng: mathrand.New(mathrand.NewPCG(seed, seed))}
+	log.Printf(tr("💥 混沌测试已启用: 中断=%.3f 延迟=%.3f(最大%v) 重复=%.3f 损坏=%.3f 种子=%d"),
+		config.DropProb, config.DelayProb, delayMax, config.DupProb, config.CorruptProb, seed)
+
+	c.UseOutbound(func(next MessageHandler) MessageHandler {
+		return func(messageType int, data []byte) error {
+			if ci.hit(config.DropProb) {
+				c.chaosDropConnection()
+			}
+			if ci.hit(config.DelayProb) {
+				delay := time.Duration(ci.intN(int64(delayMax)) + 1)
+				log.Printf(tr("💥 混沌注入: 写入延迟 %v"), delay)
+				select {
+				case <-time.After(delay):
+				case <-c.ctx.Done():
+					return c.ctx.Err()
+				}
+			}
+			if ci.hit(config.CorruptProb) && len(data) > 0 {
+				corrupted := bytes.Clone(data)
+				bit := ci.intN(int64(len(corrupted)) * 8)
+				corrupted[bit/8] ^= 1 << (bit % 8)
+				log.Printf(tr("💥 混沌注入: 翻转第 %d 字节的第 %d 位"), bit/8, bit%8)
+				data = corrupted
+			}
+			if err := next(messageType, data); err != nil {
+				return err
+			}
+			if ci.hit(config.DupProb) {
+				log.Print(tr("💥 混沌注入: 重复发送消息"))
+				return next(messageType, data)
+			}
+			return nil
+		}
+	})
+	c.UseInbound(func(next MessageHandler) MessageHandler {
+		return func(messageType int, data []byte) error {
+			if ci.hit(config.DropProb) {
+				c.chaosDropConnection()
+			}
+			return next(messageType, data)
+		}
+	})
+}
+
+// chaosDropConnection 关闭底层网络连接，模拟网络突然中断
+// 读取循环会收到网络错误，走正常的断线重连流程
+func (c *WebSocketClient) chaosDropConnection() {
+	conn, connected := c.getConnSafely()
+	if conn == nil || !connected {
+		return
+	}
+	log.Print(tr("💥 混沌注入: 中断连接"))
+	if err := conn.UnderlyingConn().Close(); err != nil {
+		log.Printf(tr("⚠️ 混沌注入关闭连接失败: %v"), err)
+	}
+}
+
+// ===== Ping往返时间 =====
+
+// PingRTTWindowSize 计算RTT和抖动统计时使用的最近样本数
+const PingRTTWindowSize = 100
+
+// PingStats Ping往返时间统计
+// 最小、平均、最大值、百分位和抖动基于最近PingRTTWindowSize个样本滚动计算，
+// 抖动为相邻两次RTT差值绝对值的平均值
+type PingStats struct {
+	Samples  int64   `json:"samples"`   // 累计测量次数：收到匹配pong的ping数量
+	LastMs   float64 `json:"last_ms"`   // 最近一次RTT（毫秒）
+	MinMs    float64 `json:"min_ms"`    // 窗口内最小RTT（毫秒）
+	AvgMs    float64 `json:"avg_ms"`    // 窗口内平均RTT（毫秒）
+	MaxMs    float64 `json:"max_ms"`    // 窗口内最大RTT（毫秒）
+	JitterMs float64 `json:"jitter_ms"` // 窗口内抖动（毫秒）
+	P50Ms    float64 `json:"p50_ms"`    // 窗口内RTT中位数（毫秒）
+	P90Ms    float64 `json:"p90_ms"`    // 窗口内RTT的90百分位（毫秒）
+	P99Ms    float64 `json:"p99_ms"`    // 窗口内RTT的99百分位（毫秒）
+}
+
+// rttPercentile 按最近排名法返回已排序样本的百分位值，p取值0到1
+func rttPercentile(sorted []time.Duration, p float64) time.Duration {
+	index := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(index, 0)]
+}
+
+// durationMs 把时长转换为带小数的毫秒数
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// sendTrackedPing 发送一个携带序号的ping并记录发送时间，供pong到达时计算RTT
+//
+// 注意事项：
+//   - 未设置--pong-timeout时没有定时器清理记录，服务器从不回pong会让记录无限增长，
+//     因此每次发送前丢弃早于读取超时（及pong时限）的记录：这么旧的pong不会再被等待
+func (c *WebSocketClient) sendTrackedPing() error {
+	seq := strconv.FormatUint(atomic.AddUint64(&c.pingSeq, 1), 10)
+	now := time.Now()
+	horizon := max(c.config.ReadTimeout, c.config.PongTimeout)
+
+	c.mu.Lock()
+	if c.pendingPings == nil {
+		c.pendingPings = make(map[string]time.Time)
+	}
+	for pending, sent := range c.pendingPings {
+		if now.Sub(sent) > horizon {
+			delete(c.pendingPings, pending)
+		}
+	}
+	c.pendingPings[seq] = now
+	c.mu.Unlock()
+
+	if err := c.sendControlMessage(websocket.PingMessage, []byte(seq)); err != nil {
+		c.mu.Lock()
+		delete(c.pendingPings, seq)
+		c.mu.Unlock()
+		return err
+	}
+	if c.config.PongTimeout > 0 {
+		time.AfterFunc(c.config.PongTimeout, func() { c.checkPongTimeout(seq) })
+	}
+	return nil
+}
+
+// checkPongTimeout 在pong时限到达时检查对应的ping是否已收到响应
+// 连续未收到pong的次数达到PongMisses时，关闭底层网络连接，
+// 读取循环随即收到网络错误并走正常的断线重连流程，而不必等待读取超时
+//
+// 注意事项：
+//   - 新连接建立时pendingPings被清空，旧连接上ping的定时器触发后找不到记录，不会误判
+func (c *WebSocketClient) checkPongTimeout(seq string) {
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	c.mu.Lock()
+	if _, ok := c.pendingPings[seq]; !ok {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.pendingPings, seq)
+	c.pongMisses++
+	misses := c.pongMisses
+	c.metrics.PongTimeoutsTotal++
+	c.mu.Unlock()
+
+	log.Printf(tr("⏱️ ping #%s 在 %v 内未收到pong (连续 %d/%d 次)"), seq, c.config.PongTimeout, misses, c.config.PongMisses)
+	if misses < c.config.PongMisses {
+		return
+	}
+
+	conn, connected := c.getConnSafely()
+	if conn == nil || !connected {
+		return
+	}
+	log.Printf(tr("💔 连续 %d 次未收到pong，判定连接失效，主动断开以触发重连"), misses)
+	if err := conn.UnderlyingConn().Close(); err != nil {
+		log.Printf(tr("⚠️ 关闭失效连接失败: %v"), err)
+	}
+}
+
+// recordPong 处理pong响应：载荷匹配未完成的ping时记录RTT
+//
+// 返回值：
+//   - time.Duration: 本次RTT，载荷不匹配任何ping（如服务器主动发送的pong）时为0
+func (c *WebSocketClient) recordPong(appData string) time.Duration {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sent, ok := c.pendingPings[appData]
+	if !ok {
+		return 0
+	}
+	delete(c.pendingPings, appData)
+	c.pongMisses = 0
+	rtt := now.Sub(sent)
+
+	// 更新滚动窗口并重新计算统计
+	c.rttSamples = append(c.rttSamples, rtt)
+	if len(c.rttSamples) > PingRTTWindowSize {
+		c.rttSamples = c.rttSamples[len(c.rttSamples)-PingRTTWindowSize:]
+	}
+	stats := PingStats{
+		Samples: c.Stats.Ping.Samples + 1,
+		LastMs:  durationMs(rtt),
+		MinMs:   durationMs(slices.Min(c.rttSamples)),
+		MaxMs:   durationMs(slices.Max(c.rttSamples)),
+	}
+	var sum, jitterSum time.Duration
+	for i, sample := range c.rttSamples {
+		sum += sample
+		if i > 0 {
+			diff := sample - c.rttSamples[i-1]
+			jitterSum += max(diff, -diff)
+		}
+	}
+	stats.AvgMs = durationMs(sum) / float64(len(c.rttSamples))
+	if len(c.rttSamples) > 1 {
+		stats.JitterMs = durationMs(jitterSum) / float64(len(c.rttSamples)-1)
+	}
+	sorted := slices.Sorted(slices.Values(c.rttSamples))
+	stats.P50Ms = durationMs(rttPercentile(sorted, 0.50))
+	stats.P90Ms = durationMs(rttPercentile(sorted, 0.90))
+	stats.P99Ms = durationMs(rttPercentile(sorted, 0.99))
+	c.Stats.Ping = stats
+	c.metrics.MessageLatencyMs = rtt.Milliseconds()
+	return rtt
+}
+
+// ===== 端到端加密 =====
+
+// E2ECipher 端到端消息加密，使用AES-GCM加密消息内容
+// 以中间件的形式挂在SendMessage和消息处理之外，WebSocket传输本身保持标准协议
+//
+// 消息格式：
+//   - 二进制消息：随机nonce(12字节) + 密文(含16字节认证标签)
+//   - 文本消息：上述内容的标准Base64编码，保证文本帧仍是合法UTF-8
+//
+// 并发安全：cipher.AEAD可以并发使用，nonce每条消息随机生成
+type E2ECipher struct {
+	aead cipher.AEAD // AES-GCM实例
+}
+
+// NewE2ECipher 创建端到端加密器
+//
+// 参数说明：
+//   - key: AES密钥，长度必须为16、24或32字节（AES-128/192/256）
+//
+// 返回值：
+//   - *E2ECipher: 加密器
+//   - error: 密钥长度无效时返回错误
+func NewE2ECipher(key []byte) (*E2ECipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf(tr("无效的AES密钥: %w"), err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf(tr("创建AES-GCM失败: %w"), err)
+	}
+	return &E2ECipher{aead: aead}, nil
+}
+
+// LoadE2EKey 从文件读取端到端加密密钥
+// 文件内容可以是原始密钥字节，也可以是十六进制或Base64编码的文本（首尾空白会被忽略）
+//
+// 返回值：
+//   - []byte: 16、24或32字节的密钥
+//   - error: 读取失败或无法识别密钥格式时返回错误
+func LoadE2EKey(path string) ([]byte, error) {
+	// #nosec G304 -- 文件路径由用户通过--e2e-key-file显式指定，仅用于读取
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("读取密钥文件失败: %w"), err)
+	}
+
+	validLength := func(key []byte) bool {
+		return len(key) == 16 || len(key) == 24 || len(key) == 32
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && validLength(key) {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && validLength(key) {
+		return key, nil
+	}
+	if validLength(data) {
+		return data, nil
+	}
+	return nil, errors.New(tr("密钥必须是16、24或32字节（原始字节、十六进制或Base64编码）"))
+}
+
+// NewE2ECipherFromFile 从密钥文件创建端到端加密器，等价于LoadE2EKey加NewE2ECipher
+func NewE2ECipherFromFile(path string) (*E2ECipher, error) {
+	key, err := LoadE2EKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewE2ECipher(key)
+}
+
+// Encrypt 加密一条消息，返回适合该消息类型的载荷
+func (e *E2ECipher) Encrypt(messageType int, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf(tr("生成nonce失败: %w"), err)
+	}
+	sealed := e.aead.Seal(nonce, nonce, plaintext, nil)
+	if messageType == websocket.TextMessage {
+		return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+	}
+	return sealed, nil
+}
+
+// Decrypt 解密一条消息
+//
+// 返回值：
+//   - []byte: 明文
+//   - error: 格式错误、密钥不匹配或消息被篡改时返回错误
+func (e *E2ECipher) Decrypt(messageType int, payload []byte) ([]byte, error) {
+	sealed := payload
+	if messageType == websocket.TextMessage {
+		decoded, err := base64.StdEncoding.DecodeString(string(payload))
+		if err != nil {
+			return nil, fmt.Errorf(tr("加密文本消息不是有效的Base64: %w"), err)
+		}
+		sealed = decoded
+	}
+	nonceSize := e.aead.NonceSize()
+	if len(sealed) < nonceSize+e.aead.Overhead() {
+		return nil, errors.New(tr("加密消息过短"))
+	}
+	plaintext, err := e.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf(tr("解密失败（密钥不匹配或消息被篡改）: %w"), err)
+	}
+	return plaintext, nil
+}
+
+// Outbound 返回加密发送消息的出站中间件
+func (e *E2ECipher) Outbound() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(messageType int, data []byte) error {
+			encrypted, err := e.Encrypt(messageType, data)
+			if err != nil {
+				return err
+			}
+			return next(messageType, encrypted)
+		}
+	}
+}
+
+// Inbound 返回解密接收消息的入站中间件，无法解密的消息会被丢弃并返回错误
+func (e *E2ECipher) Inbound() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(messageType int, data []byte) error {
+			plaintext, err := e.Decrypt(messageType, data)
+			if err != nil {
+				return err
+			}
+			return next(messageType, plaintext)
+		}
+	}
+}
+
+// EnableE2EEncryption 为客户端启用端到端加密
+// 发送的消息在出站中间件链最内层加密，接收的消息在入站中间件链最外层解密，
+// 因此其他中间件、消息处理器和回调看到的都是明文
+//
+// 注意事项：
+//   - 应在注册其他中间件之后、Start()之前调用
+//   - 统计和文件日志记录的是传输中的密文
+func (c *WebSocketClient) EnableE2EEncryption(e2e *E2ECipher) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outboundMiddleware = append(c.outboundMiddleware, e2e.Outbound())
+	c.inboundMiddleware = append([]Middleware{e2e.Inbound()}, c.inboundMiddleware...)
+}
+
+// ===== JSON Schema验证 =====
+
+// Schema验证方向
+const (
+	SchemaDirectionIn   = "in"   // 只验证接收的文本消息
+	SchemaDirectionOut  = "out"  // 只验证发送的文本消息
+	SchemaDirectionBoth = "both" // 验证收发两个方向的文本消息
+)
+
+// JSONSchemaValidator 使用JSON Schema验证文本消息
+// 支持draft-04到draft-2020-12，$ref只解析本地文件，不会发起网络请求
+type JSONSchemaValidator struct {
+	schema   *jsonschema.Schema // 编译后的Schema
+	checkIn  bool               // 是否验证接收的消息
+	checkOut bool               // 是否验证发送的消息
+}
+
+// NewJSONSchemaValidator 从文件编译JSON Schema
+//
+// 参数说明：
+//   - path: Schema文件路径
+//   - direction: 验证方向，in、out或both
+//
+// 返回值：
+//   - *JSONSchemaValidator: Schema验证器
+//   - error: Schema文件无法读取或编译时的错误信息
+func NewJSONSchemaValidator(path, direction string) (*JSONSchemaValidator, error) {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("编译JSON Schema失败: %w"), err)
+	}
+	return &JSONSchemaValidator{
+		schema:   schema,
+		checkIn:  direction == SchemaDirectionIn || direction == SchemaDirectionBoth,
+		checkOut: direction == SchemaDirectionOut || direction == SchemaDirectionBoth,
+	}, nil
+}
+
+// Validate 验证一条JSON文本是否符合Schema
+func (v *JSONSchemaValidator) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // 保留数字精度，交给Schema判断integer/number
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf(tr("不是有效的JSON: %w"), err)
+	}
+	return v.schema.Validate(value)
+}
+
+// SetJSONSchemaValidator 设置JSON Schema验证器，传入nil关闭Schema验证
+//
+// 验证规则：
+//   - 只验证文本消息，验证发生在中间件链的明文一侧
+//   - 发送方向验证失败时拒绝发送，SendMessage返回错误
+//   - 接收方向验证失败时记录日志和错误统计，消息仍然正常处理
+//
+// 并发安全：可以在客户端运行期间调用
+func (c *WebSocketClient) SetJSONSchemaValidator(validator *JSONSchemaValidator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schemaValidator = validator
+}
+
+// checkJSONSchema 按方向验证文本消息，失败时记录日志和ErrCodeSchemaViolation错误
+//
+// 参数说明：
+//   - outbound: true表示发送方向，false表示接收方向
+//   - messageType: WebSocket消息类型，非文本消息直接通过
+//   - data: 消息内容
+//
+// 返回值：
+//   - error: 验证失败时的ConnectionError，未启用或不需要验证时返回nil
+func (c *WebSocketClient) checkJSONSchema(outbound bool, messageType int, data []byte) error {
+	c.mu.RLock()
+	validator := c.schemaValidator
+	c.mu.RUnlock()
+	if validator == nil || messageType != websocket.TextMessage {
+		return nil
+	}
+	if (outbound && !validator.checkOut) || (!outbound && !validator.checkIn) {
+		return nil
+	}
+
+	err := validator.Validate(data)
+	if err == nil {
+		return nil
+	}
+	op, direction := "receive", "接收"
+	if outbound {
+		op, direction = "send", "发送"
+	}
+	schemaErr := &ConnectionError{
+		Code:  ErrCodeSchemaViolation,
+		Op:    op,
+		URL:   c.config.URL,
+		Err:   err,
+		Retry: false,
+	}
+	c.recordError(schemaErr)
+	log.Printf(tr("❌ %s消息Schema验证失败: %v"), direction, err)
+	return schemaErr
+}
+
+// ===== 服务器证书 =====
+
+// CertExpiryWarning 服务器证书剩余有效期少于此值时输出警告
+const CertExpiryWarning = 30 * 24 * time.Hour
+
+// connTLSState 返回WebSocket连接的TLS协商结果
+// 帧追踪会在TLS连接外再包一层，这里先解开包装
+//
+// 返回值：
+//   - tls.ConnectionState: TLS协商结果
+//   - bool: 非TLS连接（ws://）时为false
+func connTLSState(conn *websocket.Conn) (tls.ConnectionState, bool) {
+	netConn := conn.UnderlyingConn()
+	if traced, ok := netConn.(*frameTracingConn); ok {
+		netConn = traced.Conn
+	}
+	tlsConn, ok := netConn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
+}
+
+// certFingerprint 返回证书DER编码的SHA-256指纹（冒号分隔的大写十六进制，与浏览器和openssl显示一致）
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// spkiFingerprint 返回证书公钥（SubjectPublicKeyInfo）的SHA-256指纹，Base64编码（HPKP格式）
+func spkiFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// logCertificateChain 输出服务器证书链的详细信息
+// 包括每张证书的主题、签发者、SAN、有效期、证书指纹和公钥指纹，
+// 叶子证书即将过期或已过期时输出警告（跳过证书验证时也可能连接到过期证书的服务器）
+func logCertificateChain(conn *websocket.Conn) {
+	state, ok := connTLSState(conn)
+	if !ok {
+		log.Print(tr("📜 非TLS连接，没有服务器证书"))
+		return
+	}
+
+	log.Printf(tr("📜 服务器证书链 (%d 张, %s, %s):"), len(state.PeerCertificates), tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	for i, cert := range state.PeerCertificates {
+		log.Printf(tr("📜 [%d] 主题: %s"), i, cert.Subject)
+		log.Printf(tr("📜     签发者: %s"), cert.Issuer)
+		sans := slices.Clone(cert.DNSNames)
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		if len(sans) > 0 {
+			log.Printf("📜     SAN: %s", strings.Join(sans, ", "))
+		}
+		log.Printf(tr("📜     有效期: %s 至 %s"), cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		log.Printf("📜     SHA-256: %s", certFingerprint(cert))
+		log.Printf(tr("📜     公钥SHA-256: %s"), spkiFingerprint(cert))
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		return
+	}
+	leaf := state.PeerCertificates[0]
+	switch remaining := time.Until(leaf.NotAfter); {
+	case remaining <= 0:
+		log.Printf(tr("⚠️ 服务器证书已于 %s 过期"), leaf.NotAfter.Format(time.RFC3339))
+	case remaining < CertExpiryWarning:
+		log.Printf(tr("⚠️ 服务器证书将在 %.0f 天后过期 (%s)"), remaining.Hours()/24, leaf.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// ===== 连接预检 =====
+
+// dryRunTrace 连接预检的httptrace记录，保存各阶段的结果细节
+// 阶段耗时由connectionTracer统计，这里只记录地址、错误和TLS协商结果
+type dryRunTrace struct {
+	mu          sync.Mutex
+	dnsDone     bool                // 是否执行了DNS解析（IP地址或--resolve覆盖时不会执行）
+	dnsAddrs    []string            // 解析得到的地址
+	dnsErr      error               // DNS解析错误
+	connectAddr string              // 最终连接成功的地址
+	connectErr  error               // TCP连接错误（成功前的失败尝试会被后续成功覆盖）
+	tlsDone     bool                // 是否执行了TLS握手
+	tlsState    tls.ConnectionState // TLS协商结果
+	tlsErr      error               // TLS握手错误
+}
+
+// clientTrace 返回记录各阶段结果的httptrace钩子
+func (dt *dryRunTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			dt.mu.Lock()
+			defer dt.mu.Unlock()
+			dt.dnsDone, dt.dnsErr = true, info.Err
+			for _, addr := range info.Addrs {
+				dt.dnsAddrs = append(dt.dnsAddrs, addr.String())
+			}
+		},
+		ConnectDone: func(_, addr string, err error) {
+			dt.mu.Lock()
+			defer dt.mu.Unlock()
+			if err != nil {
+				if dt.connectAddr == "" {
+					dt.connectErr = fmt.Errorf("%s: %w", addr, err)
+				}
+				return
+			}
+			dt.connectAddr, dt.connectErr = addr, nil
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			dt.mu.Lock()
+			defer dt.mu.Unlock()
+			dt.tlsDone, dt.tlsState, dt.tlsErr = true, state, err
+		},
+	}
+}
+
+// runDryRun 执行连接预检：DNS解析、TCP连接、TLS握手和WebSocket升级
+// 输出每个阶段的结果和协商参数（TLS版本、密码套件、ALPN、扩展、子协议），
+// 升级成功后发送正常关闭帧并断开，不进入消息循环
+//
+// 参数说明：
+//   - config: 客户端配置，与正常连接使用相同的TLS、名称解析、网络模拟等设置
+//
+// 返回值：
+//   - int: 进程退出码，全部阶段成功为0，任一阶段失败为1
+func runDryRun(config *ClientConfig) int {
+	fmt.Printf("🧪 连接预检: %s\n", config.URL)
+
+	// 第一步：挂载阶段耗时和结果追踪后执行握手
+	tracer := newConnectionTracer()
+	details := &dryRunTrace{}
+	ctx := httptrace.WithClientTrace(context.Background(), tracer.clientTrace())
+	ctx = httptrace.WithClientTrace(ctx, details.clientTrace())
+	conn, resp, err := NewDefaultConnector().dial(ctx, config.URL, config)
+	timing := tracer.timing()
+
+	details.mu.Lock()
+	defer details.mu.Unlock()
+
+	// 第二步：逐阶段输出结果，遇到失败的阶段即停止
+	failed := false
+	report := func(phase string, ok bool, elapsed time.Duration, detail string) {
+		switch {
+		case failed:
+			return
+		case ok:
+			fmt.Printf("  ✅ %-8s %-10v %s\n", phase, elapsed.Round(time.Microsecond), detail)
+		default:
+			fmt.Printf("  ❌ %-8s %-10v %s\n", phase, elapsed.Round(time.Microsecond), detail)
+			failed = true
+		}
+	}
+
+	switch {
+	case details.dnsErr != nil:
+		report("DNS解析", false, timing.DNSLookup, details.dnsErr.Error())
+	case details.dnsDone:
+		report("DNS解析", true, timing.DNSLookup, strings.Join(details.dnsAddrs, ", "))
+	default:
+		report("DNS解析", true, 0, "跳过 (IP地址或--resolve覆盖)")
+	}
+
+	switch {
+	case details.connectAddr != "":
+		report("TCP连接", true, timing.TCPConnect, details.connectAddr)
+	case details.connectErr != nil:
+		report("TCP连接", false, timing.TCPConnect, details.connectErr.Error())
+	case err != nil && resp == nil && !details.tlsDone:
+		report("TCP连接", false, timing.TCPConnect, err.Error())
+	}
+
+	if details.tlsDone {
+		if details.tlsErr != nil {
+			report("TLS握手", false, timing.TLSHandshake, details.tlsErr.Error())
+		} else {
+			report("TLS握手", true, timing.TLSHandshake, describeTLSState(details.tlsState))
+		}
+	}
+
+	if err != nil {
+		detail := err.Error()
+		if resp != nil {
+			detail = fmt.Sprintf("%s: %v", resp.Status, err)
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭响应体失败: %v"), closeErr)
+			}
+		}
+		report("WS升级", false, timing.FirstByte, detail)
+		if !failed {
+			// 错误发生在各阶段钩子之外（如超时），单独输出
+			fmt.Printf("  ❌ %v\n", err)
+		}
+		return 1
+	}
+
+	// 第三步：输出升级协商结果
+	extensions := resp.Header.Get("Sec-WebSocket-Extensions")
+	if extensions == "" {
+		extensions = "无"
+	}
+	subprotocol := conn.Subprotocol()
+	if subprotocol == "" {
+		subprotocol = "无"
+	}
+	report("WS升级", true, timing.FirstByte, fmt.Sprintf("%s, 子协议=%s, 扩展=%s", resp.Status, subprotocol, extensions))
+	fmt.Printf("  ⏱️ 握手总耗时: %v\n", timing.Total.Round(time.Microsecond))
+
+	// 第四步：正常关闭连接
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "dry run")
+	if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(config.WriteTimeout)); err != nil {
+		log.Printf(tr("⚠️ 发送关闭帧失败: %v"), err)
+	}
+	if err := conn.Close(); err != nil {
+		log.Printf(tr("⚠️ 关闭连接失败: %v"), err)
+	}
+	fmt.Println("✅ 预检通过")
+	return 0
+}
+
+// describeTLSState 把TLS协商结果格式化为一行说明：版本、密码套件、ALPN和服务器证书主题
+func describeTLSState(state tls.ConnectionState) string {
+	parts := []string{tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)}
+	if state.NegotiatedProtocol != "" {
+		parts = append(parts, "ALPN="+state.NegotiatedProtocol)
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		parts = append(parts, fmt.Sprintf("证书=%s (有效期至 %s)", cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ===== 协议一致性测试 =====
+
+// ConformanceCaseTimeout 一致性测试中每一步等待服务器响应的超时
+const ConformanceCaseTimeout = 5 * time.Second
+
+// 手工构造帧时使用的首字节标志位
+const (
+	frameFinBit  = 0x80 // FIN：消息的最后一个分片
+	frameRsv1Bit = 0x40 // RSV1：未协商扩展时必须为0
+)
+
+// conformanceCase 一个协议一致性测试用例
+// 编号沿用Autobahn测试套件的章节划分：1基础消息、2 Ping/Pong、3保留位、4操作码、5分片、6 UTF-8、7关闭握手
+type conformanceCase struct {
+	id   string                          // 用例编号
+	name string                          // 用例说明
+	run  func(cc *conformanceConn) error // 执行用例，返回nil表示通过
+}
+
+// rawFrame 手工构造的一个帧
+type rawFrame struct {
+	first   byte   // 帧首字节（FIN、RSV位和操作码）
+	payload string // 帧载荷
+}
+
+// conformanceNonStrict 服务器的行为符合规范要求但不够严格
+// 例如应当发送关闭帧后断开时直接断开了TCP连接，与Autobahn的NON-STRICT结果对应，不计为失败
+type conformanceNonStrict string
+
+func (e conformanceNonStrict) Error() string { return string(e) }
+
+// conformanceEvent 从服务器收到的一个事件
+type conformanceEvent struct {
+	kind        string // 事件类型：message、pong或close
+	messageType int    // 消息类型（message事件）
+	data        []byte // 消息或pong载荷
+	closeCode   int    // 关闭码（close事件），连接未经关闭握手断开时为1006
+	closeReason string // 关闭原因或断开时的错误
+}
+
+// String 返回事件的简短说明，用于失败原因
+func (ev conformanceEvent) String() string {
+	switch ev.kind {
+	case "message":
+		return fmt.Sprintf("%s消息(%d字节)", frameOpcodeName(byte(ev.messageType)), len(ev.data))
+	case "pong":
+		return fmt.Sprintf("pong(%q)", ev.data)
+	default:
+		if ev.closeCode == websocket.CloseAbnormalClosure {
+			return "连接断开: " + ev.closeReason
+		}
+		return fmt.Sprintf("关闭帧(%d %q)", ev.closeCode, ev.closeReason)
+	}
+}
+
+// conformanceConn 一个测试用例使用的连接
+// 读取协程把收到的消息、pong和关闭按到达顺序放入事件通道，用例可以检查响应的先后顺序
+type conformanceConn struct {
+	conn   *websocket.Conn
+	events chan conformanceEvent // 按到达顺序排列的服务器事件，连接结束后关闭
+	done   chan struct{}         // 用例结束信号，使读取协程不会阻塞在已满的事件通道上
+
+	mu         sync.Mutex // 保护violations
+	violations []string   // 严格模式检查到的服务器帧违规
+}
+
+// newConformanceConn 创建用例连接，拨号前创建以便握手阶段的帧违规也能记录
+func newConformanceConn() *conformanceConn {
+	return &conformanceConn{
+		events: make(chan conformanceEvent, 256),
+		done:   make(chan struct{}),
+	}
+}
+
+// start 接管已建立的连接并启动读取协程
+func (cc *conformanceConn) start(conn *websocket.Conn) {
+	cc.conn = conn
+	conn.SetPongHandler(func(appData string) error {
+		cc.emit(conformanceEvent{kind: "pong", data: []byte(appData)})
+		return nil
+	})
+	go cc.readLoop()
+}
+
+// report 记录一条服务器帧违规，作为严格模式的违规回调
+func (cc *conformanceConn) report(kind, detail string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.violations = append(cc.violations, fmt.Sprintf("[%s] %s", kind, detail))
+}
+
+// readLoop 持续读取服务器消息直到连接结束
+func (cc *conformanceConn) readLoop() {
+	defer close(cc.events)
+	for {
+		messageType, data, err := cc.conn.ReadMessage()
+		if err != nil {
+			event := conformanceEvent{kind: "close", closeCode: websocket.CloseAbnormalClosure, closeReason: err.Error()}
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				event.closeCode, event.closeReason = closeErr.Code, closeErr.Text
+			}
+			cc.emit(event)
+			return
+		}
+		if messageType == websocket.TextMessage && !utf8.Valid(data) {
+			cc.report(ViolationInvalidUTF8, "服务器发送的文本消息不是有效的UTF-8")
+		}
+		if !cc.emit(conformanceEvent{kind: "message", messageType: messageType, data: data}) {
+			return
+		}
+	}
+}
+
+// emit 投递一个事件，用例已结束时返回false
+func (cc *conformanceConn) emit(event conformanceEvent) bool {
+	select {
+	case cc.events <- event:
+		return true
+	case <-cc.done:
+		return false
+	}
+}
+
+// close 结束用例并关闭连接
+func (cc *conformanceConn) close() {
+	close(cc.done)
+	if err := cc.conn.Close(); err != nil {
+		log.Printf(tr("⚠️ 关闭连接失败: %v"), err)
+	}
+}
+
+// writeFrame 绕过WebSocket库直接写入一个帧，用于构造分片、保留位等库不会生成的帧
+//
+// 参数说明：
+//   - first: 帧首字节（FIN、RSV位和操作码）
+//   - payload: 帧载荷
+//   - masked: 是否掩码；客户端帧按规范必须掩码，传false用于测试服务器是否拒绝未掩码的帧
+func (cc *conformanceConn) writeFrame(first byte, payload []byte, masked bool) error {
+	frame := []byte{first, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame[1] = byte(n)
+	case n <= 0xffff:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if !masked {
+		frame = append(frame, payload...)
+	} else {
+		frame[1] |= 0x80
+		key := make([]byte, 4)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		frame = append(frame, key...)
+		for i, b := range payload {
+			frame = append(frame, b^key[i%4])
+		}
+	}
+	_, err := cc.conn.UnderlyingConn().Write(frame)
+	return err
+}
+
+// writeFrames 依次写入多个掩码帧
+func (cc *conformanceConn) writeFrames(frames ...rawFrame) error {
+	for _, f := range frames {
+		if err := cc.writeFrame(f.first, []byte(f.payload), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next 等待下一个服务器事件
+func (cc *conformanceConn) next() (conformanceEvent, error) {
+	select {
+	case event, ok := <-cc.events:
+		if !ok {
+			return event, errors.New(tr("连接已结束"))
+		}
+		return event, nil
+	case <-time.After(ConformanceCaseTimeout):
+		return conformanceEvent{}, errors.New(tr("等待服务器响应超时"))
+	}
+}
+
+// expectMessage 期望下一个事件是内容相同的消息
+func (cc *conformanceConn) expectMessage(messageType int, want []byte) error {
+	event, err := cc.next()
+	if err != nil {
+		return err
+	}
+	if event.kind != "message" || event.messageType != messageType {
+		return fmt.Errorf(tr("期望%s消息，实际收到%s"), frameOpcodeName(byte(messageType)), event)
+	}
+	if !bytes.Equal(event.data, want) {
+		return fmt.Errorf(tr("回显内容不一致: 发送%d字节，收到%d字节"), len(want), len(event.data))
+	}
+	return nil
+}
+
+// expectPong 期望下一个事件是载荷相同的pong
+func (cc *conformanceConn) expectPong(payload string) error {
+	event, err := cc.next()
+	if err != nil {
+		return err
+	}
+	if event.kind != "pong" || string(event.data) != payload {
+		return fmt.Errorf(tr("期望pong(%q)，实际收到%s"), payload, event)
+	}
+	return nil
+}
+
+// expectClose 期望服务器以指定关闭码完成关闭握手，直接断开视为失败
+func (cc *conformanceConn) expectClose(code int) error {
+	event, err := cc.next()
+	if err != nil {
+		return err
+	}
+	if event.kind != "close" || event.closeCode != code {
+		return fmt.Errorf(tr("期望关闭帧(%d)，实际收到%s"), code, event)
+	}
+	return nil
+}
+
+// expectFailure 期望服务器因协议错误断开连接（Fail the WebSocket Connection）
+// 发送指定关闭码为通过；不发关闭帧直接断开同样符合规范，但结果为非严格
+func (cc *conformanceConn) expectFailure(code int) error {
+	event, err := cc.next()
+	if err != nil {
+		return err
+	}
+	switch {
+	case event.kind != "close":
+		return fmt.Errorf(tr("期望服务器以关闭码%d断开，实际收到%s"), code, event)
+	case event.closeCode == code:
+		return nil
+	case event.closeCode == websocket.CloseAbnormalClosure:
+		return conformanceNonStrict(fmt.Sprintf("服务器未发送关闭帧(%d)直接断开", code))
+	default:
+		return fmt.Errorf(tr("期望关闭码%d，实际%s"), code, event)
+	}
+}
+
+// echo 发送一条消息并期望服务器原样回显
+func (cc *conformanceConn) echo(messageType int, data []byte) error {
+	if err := cc.conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	return cc.expectMessage(messageType, data)
+}
+
+// conformanceCases 一致性测试用例，被测服务器需要回显收到的文本和二进制消息（与Autobahn测试套件的要求相同）
+var conformanceCases = []conformanceCase{
+	{"1.1", "文本消息回显", func(cc *conformanceConn) error {
+		return cc.echo(websocket.TextMessage, []byte("Hello, 世界"))
+	}},
+	{"1.2", "空文本消息回显", func(cc *conformanceConn) error {
+		return cc.echo(websocket.TextMessage, []byte{})
+	}},
+	{"1.3", "二进制消息回显 (0x00-0xFF)", func(cc *conformanceConn) error {
+		data := make([]byte, 256)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		return cc.echo(websocket.BinaryMessage, data)
+	}},
+	{"1.4", "64KiB文本消息回显", func(cc *conformanceConn) error {
+		return cc.echo(websocket.TextMessage, bytes.Repeat([]byte("*"), 64*1024))
+	}},
+	{"2.1", "Ping载荷原样返回", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|websocket.PingMessage, []byte("conformance"), true); err != nil {
+			return err
+		}
+		return cc.expectPong("conformance")
+	}},
+	{"2.2", "Ping洪泛 (100个)", func(cc *conformanceConn) error {
+		const count = 100
+		for i := range count {
+			if err := cc.writeFrame(frameFinBit|websocket.PingMessage, []byte(strconv.Itoa(i)), true); err != nil {
+				return err
+			}
+		}
+		// 规范允许服务器只回复最近的ping，因此只要求pong按顺序到达且最后一个ping得到回复
+		last := -1
+		for last < count-1 {
+			event, err := cc.next()
+			if err != nil {
+				return fmt.Errorf(tr("收到最后一个pong之前: %w"), err)
+			}
+			index, convErr := strconv.Atoi(string(event.data))
+			if event.kind != "pong" || convErr != nil || index <= last || index >= count {
+				return fmt.Errorf(tr("pong顺序或载荷错误: 上一个%d，收到%s"), last, event)
+			}
+			last = index
+		}
+		return nil
+	}},
+	{"2.3", "载荷超过125字节的Ping", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|websocket.PingMessage, bytes.Repeat([]byte("p"), 126), true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"2.4", "分片的Ping", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(websocket.PingMessage, []byte("fragmented"), true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"3.1", "设置RSV1的文本帧", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|frameRsv1Bit|websocket.TextMessage, []byte("rsv1"), true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"3.2", "未掩码的客户端帧", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|websocket.TextMessage, []byte("unmasked"), false); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"4.1", "保留的数据帧操作码 0x3", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|0x3, nil, true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"4.2", "保留的控制帧操作码 0xB", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|0xB, nil, true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"5.1", "三个分片组成的文本消息", func(cc *conformanceConn) error {
+		err := cc.writeFrames(
+			rawFrame{websocket.TextMessage, "Hello, "},
+			rawFrame{0x0, "frag"},
+			rawFrame{frameFinBit | 0x0, "mented"},
+		)
+		if err != nil {
+			return err
+		}
+		return cc.expectMessage(websocket.TextMessage, []byte("Hello, fragmented"))
+	}},
+	{"5.2", "分片之间插入Ping", func(cc *conformanceConn) error {
+		err := cc.writeFrames(
+			rawFrame{websocket.TextMessage, "frag"},
+			rawFrame{frameFinBit | websocket.PingMessage, "between"},
+			rawFrame{frameFinBit | 0x0, "mented"},
+		)
+		if err != nil {
+			return err
+		}
+		if err := cc.expectPong("between"); err != nil {
+			return err
+		}
+		return cc.expectMessage(websocket.TextMessage, []byte("fragmented"))
+	}},
+	{"5.3", "没有起始帧的continuation", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|0x0, []byte("orphan"), true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"5.4", "分片消息未结束时开始新消息", func(cc *conformanceConn) error {
+		err := cc.writeFrames(
+			rawFrame{websocket.TextMessage, "first"},
+			rawFrame{frameFinBit | websocket.TextMessage, "second"},
+		)
+		if err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"6.1", "码点跨分片的UTF-8文本", func(cc *conformanceConn) error {
+		text := "κόσμε 🙂"
+		// 在多字节码点中间切分：'κ'占2字节，表情符号占4字节
+		err := cc.writeFrames(
+			rawFrame{websocket.TextMessage, text[:1]},
+			rawFrame{0x0, text[1 : len(text)-2]},
+			rawFrame{frameFinBit | 0x0, text[len(text)-2:]},
+		)
+		if err != nil {
+			return err
+		}
+		return cc.expectMessage(websocket.TextMessage, []byte(text))
+	}},
+	{"6.2", "无效UTF-8文本", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|websocket.TextMessage, []byte{0xce, 0xba, 0xff, 0xfe}, true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseInvalidFramePayloadData)
+	}},
+	{"6.3", "分片中的无效UTF-8", func(cc *conformanceConn) error {
+		err := cc.writeFrames(
+			rawFrame{websocket.TextMessage, "valid"},
+			rawFrame{frameFinBit | 0x0, "\xed\xa0\x80"}, // UTF-16代理项，不是合法的UTF-8
+		)
+		if err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseInvalidFramePayloadData)
+	}},
+	{"7.1", "关闭握手回显关闭码", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"), true); err != nil {
+			return err
+		}
+		return cc.expectClose(websocket.CloseNormalClosure)
+	}},
+	{"7.2", "关闭前的消息先于关闭帧回显", func(cc *conformanceConn) error {
+		err := cc.writeFrames(
+			rawFrame{frameFinBit | websocket.TextMessage, "last"},
+			rawFrame{frameFinBit | websocket.CloseMessage, string(websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))},
+		)
+		if err != nil {
+			return err
+		}
+		if err := cc.expectMessage(websocket.TextMessage, []byte("last")); err != nil {
+			return err
+		}
+		return cc.expectClose(websocket.CloseNormalClosure)
+	}},
+	{"7.3", "关闭帧之后的数据帧被忽略", func(cc *conformanceConn) error {
+		err := cc.writeFrames(
+			rawFrame{frameFinBit | websocket.CloseMessage, string(websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))},
+			rawFrame{frameFinBit | websocket.TextMessage, "after close"},
+		)
+		if err != nil {
+			return err
+		}
+		return cc.expectClose(websocket.CloseNormalClosure)
+	}},
+	{"7.4", "保留的关闭码 1004", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|websocket.CloseMessage, websocket.FormatCloseMessage(1004, ""), true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+	{"7.5", "只有1字节的关闭帧载荷", func(cc *conformanceConn) error {
+		if err := cc.writeFrame(frameFinBit|websocket.CloseMessage, []byte{0x03}, true); err != nil {
+			return err
+		}
+		return cc.expectFailure(websocket.CloseProtocolError)
+	}},
+}
+
+// runConformance 对服务器执行协议一致性测试并输出通过/失败报告
+// 每个用例使用独立的连接，并启用严格模式检查服务器发送的帧，服务器帧违规会使用例失败
+//
+// 参数说明：
+//   - config: 客户端配置，与正常连接使用相同的TLS、名称解析、请求头等设置
+//
+// 返回值：
+//   - int: 进程退出码，没有失败的用例为0（非严格的结果不计为失败），否则为1
+func runConformance(config *ClientConfig) int {
+	fmt.Printf("🧪 协议一致性测试: %s\n", config.URL)
+	fmt.Println("   被测服务器需要回显收到的文本和二进制消息")
+
+	passed, nonStrict, failed := 0, 0, 0
+	for _, tc := range conformanceCases {
+		start := time.Now()
+		err := runConformanceCase(config, tc)
+		elapsed := time.Since(start).Round(time.Millisecond)
+
+		var lenient conformanceNonStrict
+		switch {
+		case err == nil:
+			passed++
+			fmt.Printf("  ✅ %-4s %-8v %s\n", tc.id, elapsed, tc.name)
+		case errors.As(err, &lenient):
+			nonStrict++
+			fmt.Printf("  ⚠️ %-4s %-8v %s: 非严格 - %v\n", tc.id, elapsed, tc.name, err)
+		default:
+			failed++
+			fmt.Printf("  ❌ %-4s %-8v %s: %v\n", tc.id, elapsed, tc.name, err)
+		}
+	}
+
+	fmt.Printf("📋 结果: %d 通过, %d 非严格, %d 失败 (共 %d 个用例)\n", passed, nonStrict, failed, len(conformanceCases))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runConformanceCase 建立独立连接执行一个用例
+func runConformanceCase(config *ClientConfig, tc conformanceCase) error {
+	// 第一步：启用严格模式拨号，服务器帧违规记录到用例连接上
+	caseConfig := *config
+	caseConfig.Strict = true
+	cc := newConformanceConn()
+	ctx := withFrameViolationReporter(context.Background(), cc.report)
+	conn, resp, err := NewDefaultConnector().dial(ctx, config.URL, &caseConfig)
+	if err != nil {
+		if resp != nil {
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭响应体失败: %v"), closeErr)
+			}
+			return fmt.Errorf(tr("握手失败: %s"), resp.Status)
+		}
+		return fmt.Errorf(tr("握手失败: %w"), err)
+	}
+	cc.start(conn)
+	defer cc.close()
+
+	// 第二步：执行用例，用例本身通过时再检查服务器帧是否违规
+	if err := tc.run(cc); err != nil {
+		return err
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if len(cc.violations) > 0 {
+		return fmt.Errorf(tr("服务器帧违反协议: %s"), strings.Join(cc.violations, "; "))
+	}
+	return nil
+}
+
+// ===== 回显探测 =====
+
+// DefaultCheckTimeout check子命令默认等待回显的时间
+const DefaultCheckTimeout = 5 * time.Second
+
+// check子命令的退出码，与Nagios插件的约定一致，可以直接用于cron和监控系统
+const (
+	CheckExitOK       = 0 // 在时限内收到期望的响应
+	CheckExitWarning  = 1 // 收到期望的响应，但往返时间超过--check-warn
+	CheckExitCritical = 2 // 连接失败、连接被关闭或在时限内没有收到期望的响应
+	CheckExitUnknown  = 3 // 参数或配置无效，没有执行探测
+)
+
+// runCheck 执行一次回显探测：连接、发送一条消息、等待期望的响应后正常关闭
+// 未指定--check-message时发送随机令牌，未指定--check-expect时期望原样回显；
+// 等待期间收到的其他消息（如服务器的欢迎消息）忽略
+//
+// 参数说明：
+//   - config: 客户端配置，与正常连接使用相同的TLS、名称解析、请求头等设置
+//
+// 返回值：
+//   - int: 进程退出码，见CheckExitOK、CheckExitWarning、CheckExitCritical（参数无效时main以CheckExitUnknown退出）
+//
+// 注意事项：
+//   - 输出一行Nagios插件格式的结果，"|"之后是rtt和handshake性能数据（秒）
+//   - 消息按原样发送，不经过载荷压缩、端到端加密等中间件
+func runCheck(config *ClientConfig) int {
+	message := config.CheckMessage
+	if message == "" {
+		message = "wsc-check-" + rand.Text()
+	}
+	var expect *regexp.Regexp
+	if config.CheckExpect != "" {
+		expect = regexp.MustCompile(config.CheckExpect) // 已在配置验证时检查过
+	}
+	critical := func(format string, args ...any) int {
+		fmt.Printf("WEBSOCKET CRITICAL - "+format+"\n", args...)
+		return CheckExitCritical
+	}
+
+	// 第一步：握手，整个探测共用--check-timeout时限
+	ctx, cancel := context.WithTimeout(context.Background(), config.CheckTimeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	tracer := newConnectionTracer()
+	conn, resp, err := NewDefaultConnector().dial(httptrace.WithClientTrace(ctx, tracer.clientTrace()), config.URL, config)
+	if err != nil {
+		if resp != nil {
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭响应体失败: %v"), closeErr)
+			}
+			return critical("握手失败: %s", resp.Status)
+		}
+		return critical("连接失败: %v", err)
+	}
+	defer conn.Close()
+	handshake := tracer.timing().Total
+
+	// 第二步：发送消息并等待期望的响应
+	start := time.Now()
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return critical("设置写入超时失败: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		return critical("发送失败: %v", err)
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return critical("设置读取超时失败: %v", err)
+	}
+	ignored := 0
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return critical("%v 内未收到期望的响应 (忽略了 %d 条其他消息)", config.CheckTimeout, ignored)
+			}
+			return critical("等待响应时连接断开: %v", err)
+		}
+		if (expect != nil && expect.Match(data)) || (expect == nil && string(data) == message) {
+			break
+		}
+		ignored++
+	}
+	rtt := time.Since(start)
+
+	// 第三步：正常关闭连接后按往返时间给出结果
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "check")
+	if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(config.WriteTimeout)); err != nil {
+		log.Printf(tr("⚠️ 发送关闭帧失败: %v"), err)
+	}
+	perfData := fmt.Sprintf("rtt=%.6fs;%.6f;%.6f handshake=%.6fs",
+		rtt.Seconds(), config.CheckWarn.Seconds(), config.CheckTimeout.Seconds(), handshake.Seconds())
+	if config.CheckWarn > 0 && rtt > config.CheckWarn {
+		fmt.Printf("WEBSOCKET WARNING - 往返 %v 超过 %v，握手 %v | %s\n",
+			rtt.Round(time.Microsecond), config.CheckWarn, handshake.Round(time.Microsecond), perfData)
+		return CheckExitWarning
+	}
+	fmt.Printf("WEBSOCKET OK - 往返 %v，握手 %v | %s\n", rtt.Round(time.Microsecond), handshake.Round(time.Microsecond), perfData)
+	return CheckExitOK
+}
+
+// ===== 场景脚本 =====
+
+// DefaultScenarioTimeout 场景脚本中expect步骤默认等待匹配消息的时间
+const DefaultScenarioTimeout = 10 * time.Second
+
+// scenario子命令的退出码
+const (
+	ScenarioExitOK      = 0 // 全部步骤执行成功
+	ScenarioExitFailed  = 1 // 连接失败或某个步骤失败
+	ScenarioExitInvalid = 2 // 参数或脚本无效，没有执行任何步骤
+)
+
+// ScenarioStep 场景脚本中的一个步骤
+// send、wait、expect（regex或json_path）、close四种动作必须且只能指定一种
+type ScenarioStep struct {
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`           // 步骤名称，用于输出显示
+	Send     string `json:"send,omitempty" yaml:"send,omitempty"`           // 发送的文本消息模板，可以引用上一个expect步骤匹配的消息，渲染后展开${SEQ}等消息变量
+	Wait     string `json:"wait,omitempty" yaml:"wait,omitempty"`           // 暂停时长（如500ms），期间收到的消息保留给后续expect步骤
+	Expect   string `json:"expect,omitempty" yaml:"expect,omitempty"`       // 等待匹配该正则表达式的消息
+	JSONPath string `json:"json_path,omitempty" yaml:"json_path,omitempty"` // 等待该JSON路径存在的消息，可与expect同时使用
+	Equals   string `json:"equals,omitempty" yaml:"equals,omitempty"`       // JSON路径取值需要等于的内容
+	Timeout  string `json:"timeout,omitempty" yaml:"timeout,omitempty"`     // expect步骤的等待时限，为空时使用脚本的默认时限
+	Close    *int   `json:"close,omitempty" yaml:"close,omitempty"`         // 以该关闭码正常关闭连接，必须是最后一个步骤
+	Reason   string `json:"reason,omitempty" yaml:"reason,omitempty"`       // 关闭原因
+
+	wait    time.Duration      // 解析后的暂停时长
+	timeout time.Duration      // 解析后的等待时限
+	matcher *AutoReplyRule     // expect步骤的匹配条件，复用自动回复规则的匹配逻辑
+	message *template.Template // send步骤编译后的消息模板
+}
+
+// Scenario 场景脚本文件的顶层结构
+type Scenario struct {
+	Timeout string          `json:"timeout,omitempty" yaml:"timeout,omitempty"` // expect步骤的默认等待时限，为空时为10秒
+	Steps   []*ScenarioStep `json:"steps" yaml:"steps"`                         // 按顺序执行的步骤
+}
+
+// LoadScenario 从YAML或JSON文件加载场景脚本
+//
+// 参数说明：
+//   - path: 脚本文件路径，扩展名为.json时按JSON解析，否则按YAML解析
+//
+// 返回值：
+//   - *Scenario: 已验证并编译的脚本
+//   - error: 读取、解析或验证失败时的错误信息，会指出出错的步骤
+func LoadScenario(path string) (*Scenario, error) {
+	// #nosec G304 -- 文件路径由用户通过--script显式指定，仅用于读取
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("读取场景脚本失败: %w"), err)
+	}
+
+	var scenario Scenario
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &scenario)
+	} else {
+		err = yaml.Unmarshal(data, &scenario)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(tr("解析场景脚本失败: %w"), err)
+	}
+	if len(scenario.Steps) == 0 {
+		return nil, errors.New(tr("场景脚本没有任何步骤"))
+	}
+
+	defaultTimeout := DefaultScenarioTimeout
+	if scenario.Timeout != "" {
+		if defaultTimeout, err = time.ParseDuration(scenario.Timeout); err != nil || defaultTimeout <= 0 {
+			return nil, fmt.Errorf(tr("默认等待时限 %q 无效"), scenario.Timeout)
+		}
+	}
+	for i, step := range scenario.Steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if step.Close != nil && i != len(scenario.Steps)-1 {
+			return nil, fmt.Errorf(tr("步骤 %s 无效: close必须是最后一个步骤"), step.Name)
+		}
+		if err := step.compile(defaultTimeout); err != nil {
+			return nil, fmt.Errorf(tr("步骤 %s 无效: %w"), step.Name, err)
+		}
+	}
+	return &scenario, nil
+}
+
+// compile 验证步骤只指定了一种动作，并解析时长、编译匹配条件和消息模板
+func (s *ScenarioStep) compile(defaultTimeout time.Duration) error {
+	actions := 0
+	for _, set := range []bool{s.Send != "", s.Wait != "", s.Expect != "" || s.JSONPath != "", s.Close != nil} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return errors.New(tr("send、wait、expect/json_path、close必须且只能指定一种"))
+	}
+
+	var err error
+	switch {
+	case s.Send != "":
+		s.message, err = template.New(s.Name).Funcs(autoReplyFuncs).Option("missingkey=zero").Parse(s.Send)
+		if err != nil {
+			return fmt.Errorf(tr("消息模板错误: %w"), err)
+		}
+	case s.Wait != "":
+		if s.wait, err = time.ParseDuration(s.Wait); err != nil || s.wait < 0 {
+			return fmt.Errorf(tr("暂停时长 %q 无效"), s.Wait)
+		}
+	case s.Close != nil:
+		if !isSendableCloseCode(*s.Close) {
+			return fmt.Errorf(tr("关闭码 %d 无效，必须是1000-1003、1007-1014或3000-4999"), *s.Close)
+		}
+	default:
+		s.timeout = defaultTimeout
+		if s.Timeout != "" {
+			if s.timeout, err = time.ParseDuration(s.Timeout); err != nil || s.timeout <= 0 {
+				return fmt.Errorf(tr("等待时限 %q 无效"), s.Timeout)
+			}
+		}
+		s.matcher = &AutoReplyRule{Name: s.Name, Regex: s.Expect, JSONPath: s.JSONPath, Equals: s.Equals}
+		if err := s.matcher.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe 返回步骤的简短说明，用于输出显示
+func (s *ScenarioStep) describe() string {
+	switch {
+	case s.message != nil:
+		return "send " + truncateRunes(s.Send, 60)
+	case s.matcher != nil:
+		condition := s.Expect
+		if s.JSONPath != "" {
+			condition = strings.TrimSpace(condition + " " + s.JSONPath)
+			if s.Equals != "" {
+				condition += "=" + s.Equals
+			}
+		}
+		return "expect " + truncateRunes(condition, 60)
+	case s.Close != nil:
+		return fmt.Sprintf("close %d", *s.Close)
+	default:
+		return "wait " + s.wait.String()
+	}
+}
+
+// scenarioEvent 场景运行期间从服务器收到的一条消息，err非nil表示连接已结束
+type scenarioEvent struct {
+	data []byte
+	err  error
+}
+
+// scenarioRun 一次场景运行的连接状态
+type scenarioRun struct {
+	conn         *websocket.Conn
+	config       *ClientConfig
+	events       chan scenarioEvent // 按到达顺序排列的接收消息，连接结束时以一个错误事件结尾
+	connErr      error              // 连接结束的原因，收到错误事件后设置
+	last         *autoReplyData     // 上一个expect步骤匹配的消息，供send模板引用
+	sessionID    string             // ${SESSION_ID}变量的值，每次运行生成一个
+	seq          int64              // ${SEQ}变量的计数器
+	closeStarted bool               // 是否已发送关闭帧
+}
+
+// runScenario 按场景脚本执行一次完整的交互：连接后依次执行send、wait、expect、close步骤
+// 所有步骤成功后正常关闭连接；任一步骤失败时立即停止，不执行后续步骤
+//
+// 参数说明：
+//   - config: 客户端配置，与正常连接使用相同的TLS、名称解析、请求头等设置
+//
+// 返回值：
+//   - int: 进程退出码，见ScenarioExitOK、ScenarioExitFailed、ScenarioExitInvalid
+//
+// 注意事项：
+//   - expect步骤只检查尚未被之前的expect步骤消费的消息，不匹配的消息被跳过
+//   - 消息按原样发送，不经过载荷压缩、端到端加密等中间件
+func runScenario(config *ClientConfig) int {
+	scenario, err := LoadScenario(config.Script)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ScenarioExitInvalid
+	}
+	fmt.Printf("🎬 场景脚本: %s (%d 个步骤) -> %s\n", config.Script, len(scenario.Steps), config.URL)
+
+	conn, resp, err := NewDefaultConnector().dial(context.Background(), config.URL, config)
+	if err != nil {
+		if resp != nil {
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭响应体失败: %v"), closeErr)
+			}
+			fmt.Printf("❌ 握手失败: %s\n", resp.Status)
+		} else {
+			fmt.Printf("❌ 连接失败: %v\n", err)
+		}
+		return ScenarioExitFailed
+	}
+	defer conn.Close()
+
+	run := &scenarioRun{conn: conn, config: config, events: make(chan scenarioEvent, 256), sessionID: generateSessionID()}
+	go run.readLoop()
+
+	start := time.Now()
+	completed := 0
+	for i, step := range scenario.Steps {
+		stepStart := time.Now()
+		err := run.execute(step)
+		elapsed := time.Since(stepStart).Round(time.Millisecond)
+		label := fmt.Sprintf("%d/%d", i+1, len(scenario.Steps))
+		title := step.describe()
+		if !strings.HasPrefix(step.Name, "#") {
+			title = step.Name + ": " + title
+		}
+		if err != nil {
+			fmt.Printf("  ❌ %-5s %-8v %s: %v\n", label, elapsed, title, err)
+			break
+		}
+		completed++
+		fmt.Printf("  ✅ %-5s %-8v %s\n", label, elapsed, title)
+	}
+
+	if !run.closeStarted && run.connErr == nil {
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "scenario")
+		if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(config.WriteTimeout)); err != nil {
+			log.Printf(tr("⚠️ 发送关闭帧失败: %v"), err)
+		}
+	}
+	fmt.Printf("📋 结果: %d/%d 个步骤完成，用时 %v\n", completed, len(scenario.Steps), time.Since(start).Round(time.Millisecond))
+	if completed < len(scenario.Steps) {
+		return ScenarioExitFailed
+	}
+	return ScenarioExitOK
+}
+
+// readLoop 持续读取消息放入事件队列，连接结束时放入错误事件后退出
+// 队列满时阻塞读取而不是丢弃，保证expect步骤不会漏掉消息
+func (r *scenarioRun) readLoop() {
+	for {
+		_, data, err := r.conn.ReadMessage()
+		r.events <- scenarioEvent{data: data, err: err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// next 等待下一条消息，连接已结束时返回结束原因
+func (r *scenarioRun) next(timer <-chan time.Time) (scenarioEvent, bool) {
+	if r.connErr != nil {
+		return scenarioEvent{err: r.connErr}, true
+	}
+	select {
+	case event := <-r.events:
+		if event.err != nil {
+			r.connErr = event.err
+		}
+		return event, true
+	case <-timer:
+		return scenarioEvent{}, false
+	}
+}
+
+// execute 执行一个步骤，返回nil表示成功
+func (r *scenarioRun) execute(step *ScenarioStep) error {
+	switch {
+	case step.message != nil:
+		var buf bytes.Buffer
+		data := r.last
+		if data == nil {
+			data = &autoReplyData{}
+		}
+		if err := step.message.Execute(&buf, data); err != nil {
+			return fmt.Errorf(tr("渲染消息失败: %w"), err)
+		}
+		if err := r.conn.SetWriteDeadline(time.Now().Add(r.config.WriteTimeout)); err != nil {
+			return fmt.Errorf(tr("设置写入超时失败: %w"), err)
+		}
+		message := expandMessageVariables(buf.String(), r.sessionID, &r.seq)
+		if err := r.conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			return fmt.Errorf(tr("发送失败: %w"), err)
+		}
+		return nil
+
+	case step.matcher != nil:
+		timer := time.NewTimer(step.timeout)
+		defer timer.Stop()
+		ignored := 0
+		for {
+			event, ok := r.next(timer.C)
+			if !ok {
+				return fmt.Errorf(tr("%v 内未收到匹配的消息 (跳过了 %d 条其他消息)"), step.timeout, ignored)
+			}
+			if event.err != nil {
+				return fmt.Errorf(tr("等待消息时连接断开: %v"), event.err)
+			}
+			message := string(event.data)
+			var parsed any
+			isJSON := json.Unmarshal(event.data, &parsed) == nil
+			if data, matched := step.matcher.match(message, parsed, isJSON); matched {
+				r.last = data
+				return nil
+			}
+			ignored++
+		}
+
+	case step.Close != nil:
+		r.closeStarted = true
+		closeMsg := websocket.FormatCloseMessage(*step.Close, step.Reason)
+		if err := r.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(r.config.WriteTimeout)); err != nil {
+			return fmt.Errorf(tr("发送关闭帧失败: %w"), err)
+		}
+		// 等待服务器回应关闭帧，期间收到的消息丢弃
+		timer := time.NewTimer(DefaultScenarioTimeout)
+		defer timer.Stop()
+		for {
+			event, ok := r.next(timer.C)
+			if !ok {
+				return fmt.Errorf(tr("%v 内服务器未回应关闭帧"), DefaultScenarioTimeout)
+			}
+			if event.err != nil {
+				if websocket.IsCloseError(event.err, websocket.CloseNormalClosure, *step.Close) {
+					return nil
+				}
+				return fmt.Errorf(tr("关闭握手未完成: %v"), event.err)
+			}
+		}
+
+	default:
+		time.Sleep(step.wait)
+		return nil
+	}
+}
+
+// ===== 压测 =====
+
+// bench子命令的默认参数
+const (
+	DefaultBenchConnections = 10  // 并发连接数
+	DefaultBenchMessages    = 100 // 每个连接发送的消息数
+	DefaultBenchPayloadSize = 64  // 每条消息的载荷字节数
+)
+
+// benchMaxErrors 压测结果中最多列出的错误数
+const benchMaxErrors = 5
+
+// benchResult 一个压测连接的结果
+type benchResult struct {
+	connected bool            // 是否握手成功
+	handshake time.Duration   // 握手耗时
+	rtts      []time.Duration // 收到回显的每条消息的往返时间
+	err       error           // 连接失败或中途失败的原因
+}
+
+// runBench 执行压测：多个连接并发发送消息，每条消息等待原样回显后再发送下一条
+// 适用于回显服务器（如 wsc serve），输出吞吐量以及握手和往返时间的分位数
+//
+// 参数说明：
+//   - config: 客户端配置，与正常连接使用相同的TLS、名称解析、请求头等设置
+//
+// 返回值：
+//   - int: 进程退出码，全部连接成功且每条消息都收到回显时为0，否则为1
+//
+// 注意事项：
+//   - 每条消息带有连接和序号前缀，等待回显期间收到的其他消息忽略
+//   - 单条消息等待回显的时限为--read-timeout
+func runBench(config *ClientConfig) int {
+	fmt.Printf("🏋️ 压测: %d 个连接 × %d 条消息，载荷 %d 字节 -> %s\n",
+		config.BenchConnections, config.BenchMessages, config.BenchPayloadSize, config.URL)
+
+	results := make([]benchResult, config.BenchConnections)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = benchConnection(config, i)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	connected := 0
+	var handshakes, rtts []time.Duration
+	var failures []string
+	for i, result := range results {
+		if result.connected {
+			connected++
+			handshakes = append(handshakes, result.handshake)
+		}
+		rtts = append(rtts, result.rtts...)
+		if result.err != nil {
+			failures = append(failures, fmt.Sprintf("连接 %d: %v", i+1, result.err))
+		}
+	}
+	total := config.BenchConnections * config.BenchMessages
+	seconds := max(elapsed.Seconds(), 1e-9)
+	fmt.Printf("  连接: %d/%d 成功\n", connected, config.BenchConnections)
+	fmt.Printf("  消息: %d/%d 收到回显，用时 %v，%.1f 条/秒，%s (单向载荷)\n",
+		len(rtts), total, elapsed.Round(time.Millisecond), float64(len(rtts))/seconds,
+		formatBandwidth(int64(float64(len(rtts))*float64(config.BenchPayloadSize)*8/seconds)))
+	printBenchLatency("握手", handshakes)
+	printBenchLatency("往返", rtts)
+	for i, failure := range failures {
+		if i == benchMaxErrors {
+			fmt.Printf("  ... 另有 %d 个连接失败\n", len(failures)-benchMaxErrors)
+			break
+		}
+		fmt.Printf("  ❌ %s\n", failure)
+	}
+
+	if connected < config.BenchConnections || len(rtts) < total {
+		return 1
+	}
+	return 0
+}
+
+// benchConnection 执行一个压测连接：握手后逐条发送消息并等待回显，最后正常关闭
+//
+// 参数说明：
+//   - config: 客户端配置
+//   - id: 连接编号，写入消息前缀，便于区分服务器广播来的其他连接的消息
+//
+// 返回值：
+//   - benchResult: 握手耗时、每条消息的往返时间和失败原因
+func benchConnection(config *ClientConfig, id int) benchResult {
+	var result benchResult
+	ctx, cancel := context.WithTimeout(context.Background(), config.HandshakeTimeout)
+	defer cancel()
+	dialStart := time.Now()
+	conn, resp, err := NewDefaultConnector().dial(ctx, config.URL, config)
+	if err != nil {
+		if resp != nil {
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭响应体失败: %v"), closeErr)
+			}
+			result.err = fmt.Errorf(tr("握手失败: %s"), resp.Status)
+		} else {
+			result.err = fmt.Errorf(tr("连接失败: %w"), err)
+		}
+		return result
+	}
+	defer conn.Close()
+	result.connected = true
+	result.handshake = time.Since(dialStart)
+
+	payload := make([]byte, config.BenchPayloadSize)
+	for seq := range config.BenchMessages {
+		// 载荷以连接和序号开头，其余部分用x填充到指定大小
+		prefix := fmt.Sprintf("wsc-bench-%d-%d ", id, seq)
+		n := copy(payload, prefix)
+		for j := n; j < len(payload); j++ {
+			payload[j] = 'x'
+		}
+
+		sent := time.Now()
+		if err := conn.SetWriteDeadline(sent.Add(config.WriteTimeout)); err != nil {
+			result.err = fmt.Errorf(tr("设置写入超时失败: %w"), err)
+			return result
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+			result.err = fmt.Errorf(tr("第 %d 条消息发送失败: %w"), seq+1, err)
+			return result
+		}
+		if err := conn.SetReadDeadline(sent.Add(config.ReadTimeout)); err != nil {
+			result.err = fmt.Errorf(tr("设置读取超时失败: %w"), err)
+			return result
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				result.err = fmt.Errorf(tr("第 %d 条消息等待回显失败: %w"), seq+1, err)
+				return result
+			}
+			if bytes.Equal(data, payload) {
+				break
+			}
+		}
+		result.rtts = append(result.rtts, time.Since(sent))
+	}
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bench")
+	if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(config.WriteTimeout)); err != nil {
+		log.Printf(tr("⚠️ 发送关闭帧失败: %v"), err)
+	}
+	return result
+}
+
+// printBenchLatency 输出一组耗时的最小值、分位数和最大值
+func printBenchLatency(label string, samples []time.Duration) {
+	if len(samples) == 0 {
+		return
+	}
+	slices.Sort(samples)
+	fmt.Printf("  %s: min %.2fms  p50 %.2fms  p90 %.2fms  p99 %.2fms  max %.2fms\n", label,
+		durationMs(samples[0]), durationMs(rttPercentile(samples, 0.50)), durationMs(rttPercentile(samples, 0.90)),
+		durationMs(rttPercentile(samples, 0.99)), durationMs(samples[len(samples)-1]))
+}
+
+// ===== 会话重放 =====
+
+// ReplayDrainTime 重放完全部消息后，等待服务器响应的静默时长
+const ReplayDrainTime = time.Second
+
+// 重放速度的特殊取值
+const (
+	ReplaySpeedRealtime = "realtime" // 按原始间隔重放，等同于1x
+	ReplaySpeedMax      = "max"      // 不等待，逐条连续发送
+)
+
+// parseReplaySpeed 解析--speed的值
+//
+// 参数说明：
+//   - value: realtime、max，或带可选x后缀的有限正数（如2x、0.5）
+//
+// 返回值：
+//   - float64: 原始消息间隔除以的倍数，0表示不等待（max）
+//   - error: 取值无效时的错误
+func parseReplaySpeed(value string) (float64, error) {
+	switch value {
+	case ReplaySpeedRealtime:
+		return 1, nil
+	case ReplaySpeedMax:
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) || n <= 0 {
+		return 0, fmt.Errorf(tr("重放速度 '%s' 无效，可选 realtime、max 或正数倍速（如 2x、0.5）"), value)
+	}
+	return n, nil
+}
+
+// sqliteHeader SQLite数据库文件的头部，用于区分抓包数据库和会话记录
+const sqliteHeader = "SQLite format 3\x00"
+
+// replayMessage 一条待重放的消息
+type replayMessage struct {
+	offset      time.Duration // 相对第一条消息的发送时间
+	messageType int           // WebSocket消息类型
+	data        []byte        // 消息内容
+}
+
+// runReplay 执行会话重放：按原始间隔（或--speed指定的速度）重发会话记录或抓包数据库中发送方向的消息，
+// --loop大于1时全部消息发送完后从第一条重新开始，每一遍重新按相对时间计时
+//
+// 参数说明：
+//   - config: 客户端配置，与正常连接使用相同的TLS、名称解析、请求头等设置
+//
+// 返回值：
+//   - int: 进程退出码，全部消息发送成功时为0，读取记录、连接或发送失败时为1
+//
+// 注意事项：
+//   - 只重放文本和二进制消息，流式收发的大消息没有记录载荷，跳过
+//   - 消息按原样发送，不经过载荷压缩、端到端加密等中间件
+//   - 收到的消息输出到标准输出，全部发送后ReplayDrainTime内没有新消息时正常关闭
+func runReplay(config *ClientConfig) int {
+	messages, err := loadReplayMessages(config.ReplayFrom)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if len(messages) == 0 {
+		fmt.Fprintf(os.Stderr, "❌ %s 中没有可重放的发送消息\n", config.ReplayFrom)
+		return 1
+	}
+	speed, err := parseReplaySpeed(config.ReplaySpeed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	total := len(messages) * config.ReplayLoop
+	fmt.Printf("📼 会话重放: %s (%d 条消息 × %d 遍，速度 %s) -> %s\n", config.ReplayFrom, len(messages), config.ReplayLoop, config.ReplaySpeed, config.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.HandshakeTimeout)
+	defer cancel()
+	conn, resp, err := NewDefaultConnector().dial(ctx, config.URL, config)
+	if err != nil {
+		if resp != nil {
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭响应体失败: %v"), closeErr)
+			}
+			fmt.Printf("❌ 握手失败: %s\n", resp.Status)
+		} else {
+			fmt.Printf("❌ 连接失败: %v\n", err)
+		}
+		return 1
+	}
+	defer conn.Close()
+
+	// 读取goroutine输出收到的消息，每收到一条消息通知一次，供发送结束后判断静默
+	received := make(chan struct{}, 1)
+	readDone := make(chan error, 1)
+	go func() {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				readDone <- err
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				fmt.Printf("📥 [%d字节二进制]\n", len(data))
+			} else {
+				fmt.Printf("📥 %s\n", data)
+			}
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	start := time.Now()
+	sent := 0
+	for range config.ReplayLoop {
+		loopStart := time.Now()
+		for _, message := range messages {
+			if speed > 0 {
+				if wait := time.Duration(float64(message.offset)/speed) - time.Since(loopStart); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case err := <-readDone:
+						fmt.Printf("❌ 连接已断开: %v\n", err)
+						fmt.Printf("📋 结果: %d/%d 条消息已发送\n", sent, total)
+						return 1
+					}
+				}
+			}
+			if err := conn.SetWriteDeadline(time.Now().Add(config.WriteTimeout)); err != nil {
+				fmt.Printf("❌ 设置写入超时失败: %v\n", err)
+				return 1
+			}
+			if err := conn.WriteMessage(message.messageType, message.data); err != nil {
+				fmt.Printf("❌ 第 %d 条消息发送失败: %v\n", sent+1, err)
+				fmt.Printf("📋 结果: %d/%d 条消息已发送\n", sent, total)
+				return 1
+			}
+			sent++
+		}
+	}
+
+	// 等待服务器对最后几条消息的响应，静默ReplayDrainTime后正常关闭
+	for drained := false; !drained; {
+		select {
+		case <-received:
+		case <-readDone:
+			drained = true
+		case <-time.After(ReplayDrainTime):
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "replay")
+			if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(config.WriteTimeout)); err != nil {
+				log.Printf(tr("⚠️ 发送关闭帧失败: %v"), err)
+			}
+			drained = true
+		}
+	}
+	fmt.Printf("📋 结果: %d/%d 条消息已发送，用时 %v\n", sent, total, time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// loadReplayMessages 读取待重放的发送消息，按文件头部区分抓包数据库和会话记录
+//
+// 参数说明：
+//   - path: --capture-db 抓包数据库或 --transcript 会话记录的路径
+//
+// 返回值：
+//   - []replayMessage: 按发送时间排列的消息，offset相对第一条消息
+//   - error: 读取或解析失败时的错误
+func loadReplayMessages(path string) ([]replayMessage, error) {
+	// #nosec G304 -- 文件路径由用户通过--from显式指定，仅用于读取
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("读取重放记录失败: %w"), err)
+	}
+	if strings.HasPrefix(string(data), sqliteHeader) {
+		return loadCaptureReplay(path)
+	}
+
+	var transcript Transcript
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return nil, fmt.Errorf(tr("解析会话记录失败: %w"), err)
+	}
+	var messages []replayMessage
+	var first float64
+	for _, connection := range transcript.Connections {
+		for _, message := range connection.Messages {
+			if message.Type != "send" || message.Streamed ||
+				(message.Opcode != websocket.TextMessage && message.Opcode != websocket.BinaryMessage) {
+				continue
+			}
+			payload := []byte(message.Data)
+			if message.Encoding == "base64" {
+				if payload, err = base64.StdEncoding.DecodeString(message.Data); err != nil {
+					return nil, fmt.Errorf(tr("解码会话记录中的消息失败: %w"), err)
+				}
+			}
+			if len(messages) == 0 {
+				first = message.Time
+			}
+			offset := time.Duration((message.Time - first) * float64(time.Second))
+			messages = append(messages, replayMessage{offset: max(offset, 0), messageType: message.Opcode, data: payload})
+		}
+	}
+	return messages, nil
+}
+
+// loadCaptureReplay 从抓包数据库读取发送方向的文本和二进制消息
+// 数据库中有多个会话时按写入顺序全部重放
+func loadCaptureReplay(path string) ([]replayMessage, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=query_only(1)")
+	if err != nil {
+		return nil, fmt.Errorf(tr("打开抓包数据库失败: %w"), err)
+	}
+	defer func() { _ = db.Close() }()
+
+	rows, err := db.Query("SELECT timestamp, type, payload FROM messages WHERE direction = 'SEND' AND type IN ('TEXT', 'BINARY') AND payload IS NOT NULL ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf(tr("查询抓包数据库失败: %w"), err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var messages []replayMessage
+	var first int64
+	for rows.Next() {
+		var timestamp int64
+		var messageType string
+		var payload []byte
+		if err := rows.Scan(&timestamp, &messageType, &payload); err != nil {
+			return nil, fmt.Errorf(tr("读取抓包数据库失败: %w"), err)
+		}
+		if len(messages) == 0 {
+			first = timestamp
+		}
+		message := replayMessage{offset: max(time.Duration(timestamp-first)*time.Millisecond, 0), messageType: websocket.TextMessage, data: payload}
+		if messageType == "BINARY" {
+			message.messageType = websocket.BinaryMessage
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf(tr("读取抓包数据库失败: %w"), err)
+	}
+	return messages, nil
+}
+
+// ===== 测试服务器 =====
+
+// DefaultServeAddr serve子命令默认的监听地址（补全主机后只对本机开放）
+const DefaultServeAddr = ":8080"
+
+// servePeer 一个连接到测试服务器的客户端
+type servePeer struct {
+	conn *websocket.Conn // 客户端连接
+	mu   sync.Mutex      // 保证同一时间只有一个写入者（回显和广播可能来自不同goroutine）
+}
+
+// write 向客户端写入一条消息
+func (p *servePeer) write(messageType int, data []byte, timeout time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	return p.conn.WriteMessage(messageType, data)
+}
+
+// testServer 本地WebSocket回显/广播测试服务器
+//
+// 并发安全：peers通过互斥锁保护，每个客户端连接由独立goroutine处理
+type testServer struct {
+	config *ClientConfig // 缓冲区大小、消息大小上限、写入超时等设置
+
+	mu    sync.Mutex              // 保护peers
+	peers map[*servePeer]struct{} // 当前连接的客户端，服务器关闭后为nil
+}
+
+// runServe 运行本地WebSocket测试服务器，直到收到Ctrl+C或SIGTERM
+// 默认把收到的消息原样回显给发送方，--broadcast时发送给所有客户端，
+// 可以作为bench、check、conformance和交互模式的本地对端
+//
+// 参数说明：
+//   - config: 监听地址、广播开关和缓冲区等设置
+//
+// 返回值：
+//   - int: 进程退出码，正常停止时为0，无法监听时为1
+//
+// 注意事项：
+//   - 未指定主机的监听地址只对本机开放，接受任意来源（Origin）的连接
+func runServe(config *ClientConfig) int {
+	addr := config.ListenAddr
+	if addr == "" {
+		addr = DefaultServeAddr
+	}
+	addr = loopbackListenAddr(addr)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 无法监听 %s: %v\n", addr, err)
+		return 1
+	}
+
+	ts := &testServer{config: config, peers: make(map[*servePeer]struct{})}
+	server := &http.Server{
+		Handler:           http.HandlerFunc(ts.handleConnection),
+		ReadHeaderTimeout: 10 * time.Second, // 防止慢速攻击
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	mode := "回显"
+	if config.ServeBroadcast {
+		mode = "广播"
+	}
+	log.Printf(tr("🖥️ 测试服务器已启动: ws://%s/ (%s模式，按Ctrl+C停止)"), listener.Addr(), mode)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	select {
+	case <-interrupt:
+	case err := <-serveErr:
+		log.Printf(tr("❌ 测试服务器异常退出: %v"), err)
+		return 1
+	}
+
+	ts.closePeers()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf(tr("⚠️ 关闭测试服务器失败: %v"), err)
+	}
+	log.Print(tr("🖥️ 测试服务器已停止"))
+	return 0
+}
+
+// handleConnection 升级HTTP请求为WebSocket连接，回显或广播收到的消息直到连接关闭
+func (ts *testServer) handleConnection(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  ts.config.ReadBufferSize,
+		WriteBufferSize: ts.config.WriteBufferSize,
+		CheckOrigin:     func(*http.Request) bool { return true }, // 测试服务器接受浏览器页面的跨源连接
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf(tr("⚠️ 测试服务器连接升级失败: %v"), err)
+		return
+	}
+	conn.SetReadLimit(int64(ts.config.MaxMessageSize))
+
+	peer := &servePeer{conn: conn}
+	ts.mu.Lock()
+	if ts.peers == nil {
+		// 服务器已关闭
+		ts.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	ts.peers[peer] = struct{}{}
+	ts.mu.Unlock()
+	log.Printf(tr("🔗 客户端已连接: %s"), r.RemoteAddr)
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if ts.config.Verbose {
+			log.Printf("📥 %s: %s", r.RemoteAddr, truncateRunes(sanitizeTerminalText(string(data)), 200))
+		}
+		if !ts.config.ServeBroadcast {
+			if err := peer.write(messageType, data, ts.config.WriteTimeout); err != nil {
+				log.Printf(tr("⚠️ 回显失败: %v"), err)
+				break
+			}
+			continue
+		}
+		ts.mu.Lock()
+		targets := slices.Collect(maps.Keys(ts.peers))
+		ts.mu.Unlock()
+		for _, target := range targets {
+			if err := target.write(messageType, data, ts.config.WriteTimeout); err != nil {
+				log.Printf(tr("⚠️ 广播到 %s 失败: %v"), target.conn.RemoteAddr(), err)
+			}
+		}
+	}
+
+	ts.mu.Lock()
+	delete(ts.peers, peer)
+	ts.mu.Unlock()
+	_ = conn.Close()
+	log.Printf(tr("🔌 客户端已断开: %s"), r.RemoteAddr)
+}
+
+// closePeers 以1001关闭所有客户端连接并拒绝新的连接
+func (ts *testServer) closePeers() {
+	ts.mu.Lock()
+	peers := ts.peers
+	ts.peers = nil
+	ts.mu.Unlock()
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for peer := range peers {
+		peer.mu.Lock()
+		if err := peer.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second)); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+			log.Printf(tr("⚠️ 通知客户端关闭失败: %v"), err)
+		}
+		peer.mu.Unlock()
+		_ = peer.conn.Close()
+	}
+}
+
+// ===== 内存限制 =====
+
+// 内存压力监控参数
+const (
+	MemoryCheckInterval = 5 * time.Second // 检查内存使用量的间隔
+	MemoryPressureHigh  = 0.9             // 使用量达到上限的90%时释放缓存
+	MemoryPressureLow   = 0.75            // 使用量回落到上限的75%以下时恢复缓存
+	ErrorTrendShedSize  = 100             // 内存压力下错误趋势只保留最近的条数
+)
+
+// parseByteSize 解析内存大小字符串
+// 支持B、KB、MB、GB及KiB、MiB、GiB后缀（均按1024进制），不带单位时为字节
+func parseByteSize(value string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		factor float64
+	}{{"gib", 1 << 30}, {"mib", 1 << 20}, {"kib", 1 << 10}, {"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}, {"b", 1}} {
+		if number, ok := strings.CutSuffix(lower, unit.suffix); ok {
+			lower, multiplier = number, unit.factor
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(lower), 64)
+	if err != nil || number <= 0 || number*multiplier >= math.MaxInt64 {
+		return 0, fmt.Errorf(tr("无效的内存大小 '%s' (例如 256MB、1GiB)"), value)
+	}
+	return int64(number * multiplier), nil
+}
+
+// currentMemoryUsage 返回Go运行时当前占用的内存（字节）
+// 与debug.SetMemoryLimit的统计口径一致：运行时管理的全部内存减去已归还操作系统的堆内存
+func currentMemoryUsage() int64 {
+	samples := []runtimemetrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	runtimemetrics.Read(samples)
+	if samples[0].Value.Kind() != runtimemetrics.KindUint64 || samples[1].Value.Kind() != runtimemetrics.KindUint64 {
+		return 0
+	}
+	return int64(samples[0].Value.Uint64() - samples[1].Value.Uint64()) // #nosec G115 -- 进程内存远小于MaxInt64
+}
+
+// applyMemorySettings 根据配置设置软内存上限、GOGC和内存池的自定义档位
+// 在创建客户端之前调用，对整个进程生效
+func applyMemorySettings(config *ClientConfig) {
+	if config.GCPercent != 0 {
+		debug.SetGCPercent(config.GCPercent)
+		if config.GCPercent < 0 {
+			log.Print(tr("🧠 已关闭按比例触发的GC (GOGC=off)"))
+		} else {
+			log.Printf("🧠 GOGC=%d", config.GCPercent)
+		}
+	}
+	if config.MaxMemory > 0 {
+		debug.SetMemoryLimit(config.MaxMemory)
+		log.Printf(tr("🧠 软内存上限: %.1f MiB"), float64(config.MaxMemory)/(1<<20))
+	}
+	for _, size := range config.BufferTiers {
+		if globalBufferPool.AddTier(size) {
+			log.Printf(tr("🧠 内存池增加 %d 字节档位"), size)
+		}
+	}
+}
+
+// watchMemoryPressure 定期检查内存使用量，接近软内存上限时释放缓存
+// 使用量达到MemoryPressureHigh时：内存池停止保留缓冲区并清空空闲缓冲区、错误趋势截断、立即归还空闲内存；
+// 回落到MemoryPressureLow以下时恢复内存池复用
+func (c *WebSocketClient) watchMemoryPressure() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+
+	c.mu.Lock()
+	c.metrics.MemoryLimitBytes = c.config.MaxMemory
+	c.mu.Unlock()
+
+	ticker := time.NewTicker(MemoryCheckInterval)
+	defer ticker.Stop()
+
+	shedding := false
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		usage := currentMemoryUsage()
+		ratio := float64(usage) / float64(c.config.MaxMemory)
+		switch {
+		case ratio >= MemoryPressureHigh:
+			// 持续处于高压时每次检查都再释放一次，错误趋势可能已重新增长
+			if !shedding {
+				log.Printf(tr("🧠 内存使用 %.1f MiB 接近上限 (%.0f%%)，释放缓存"), float64(usage)/(1<<20), ratio*100)
+			}
+			shedding = true
+			c.shedMemory()
+		case shedding && ratio < MemoryPressureLow:
+			shedding = false
+			globalBufferPool.SetShedding(false)
+			log.Printf(tr("🧠 内存使用回落到 %.1f MiB (%.0f%%)，恢复缓存"), float64(usage)/(1<<20), ratio*100)
+		}
+	}
+}
+
+// shedMemory 释放可以重建的缓存：停止内存池复用并清空空闲缓冲区、截断错误趋势，然后立即归还空闲内存给操作系统
+func (c *WebSocketClient) shedMemory() {
+	globalBufferPool.SetShedding(true)
+	if dropped := globalBufferPool.Trim(); dropped > 0 {
+		log.Printf(tr("🧠 已清空内存池中约 %.1f MiB 空闲缓冲区"), float64(dropped)/(1<<20))
+	}
+
+	c.mu.Lock()
+	if len(c.Stats.Errors.ErrorTrend) > ErrorTrendShedSize {
+		// 复制而不是重新切片，才能真正释放旧的底层数组
+		c.Stats.Errors.ErrorTrend = slices.Clone(c.Stats.Errors.ErrorTrend[len(c.Stats.Errors.ErrorTrend)-ErrorTrendShedSize:])
+	}
+	c.metrics.MemorySheddingTotal++
+	c.mu.Unlock()
+
+	debug.FreeOSMemory()
+}
+
+// ===== 消息显示过滤 =====
+
+// messageFilter 按正则表达式决定接收消息是否显示和记录（--grep/--grep-v）
+// 只影响显示输出和消息日志，统计、回调和自动回复规则仍处理所有消息
+type messageFilter struct {
+	include []*regexp.Regexp // 包含模式：非空时消息必须匹配才显示
+	exclude []*regexp.Regexp // 排除模式：匹配任一即隐藏，优先于包含模式
+	all     bool             // 包含模式必须全部匹配（AND），否则匹配任一即可（OR）
+}
+
+// newMessageFilter 编译显示过滤模式
+//
+// 参数说明：
+//   - include: --grep模式列表
+//   - exclude: --grep-v模式列表
+//   - all: 包含模式是否要求全部匹配
+//
+// 返回值：
+//   - *messageFilter: 编译后的过滤器，未配置任何模式时返回nil
+//   - error: 正则表达式无效时返回错误
+func newMessageFilter(include, exclude []string, all bool) (*messageFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	compile := func(flag string, patterns []string) ([]*regexp.Regexp, error) {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf(tr("%s 的正则表达式 '%s' 无效: %w"), flag, pattern, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+
+	f := &messageFilter{all: all}
+	var err error
+	if f.include, err = compile("--grep", include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compile("--grep-v", exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// allows 判断消息是否应当显示；过滤器为nil或消息为控制帧时总是返回true
+func (f *messageFilter) allows(messageType int, message []byte) bool {
+	if f == nil || !isDataMessage(messageType) {
+		return true
+	}
+	for _, re := range f.exclude {
+		if re.Match(message) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.Match(message) != f.all {
+			// OR模式下遇到匹配即放行；AND模式下遇到不匹配即隐藏
+			return !f.all
+		}
+	}
+	return f.all
+}
+
+// ===== 入站队列 =====
+
+// 入站队列满时的背压策略
+const (
+	BackpressureBlock      = "block"       // 阻塞读取直到队列有空位（不丢消息，但读取循环会停顿）
+	BackpressureDropOldest = "drop-oldest" // 丢弃队列中最旧的消息，为新消息腾出位置
+	BackpressureDropNewest = "drop-newest" // 丢弃新到达的消息，保留队列中已有的消息
+)
+
+// DefaultReceiveRateQueueSize 设置了--max-receive-rate但未指定--inbound-queue时的队列容量
+const DefaultReceiveRateQueueSize = 1000
+
+// InboundQueueStats 入站队列统计
+type InboundQueueStats struct {
+	Policy   string `json:"policy,omitempty"` // 背压策略
+	Capacity int    `json:"capacity"`         // 队列容量，未启用时为0
+	Depth    int    `json:"depth"`            // 当前排队等待分发的消息数
+	Blocked  int64  `json:"blocked"`          // block策略下读取循环因队列已满而等待的次数
+	Dropped  int64  `json:"dropped"`          // drop-oldest/drop-newest策略下丢弃的消息数
+}
+
+// enqueueInbound 将消息复制到内存池缓冲区后放入入站队列
+// 队列已满时按Backpressure策略处理，在读取goroutine中调用
+func (c *WebSocketClient) enqueueInbound(messageType int, message []byte) {
+	buf := globalBufferPool.Get(len(message))
+	copy(buf, message)
+	item := bridgeMessage{messageType: messageType, data: buf}
+
+	switch c.config.Backpressure {
+	case BackpressureDropNewest:
+		select {
+		case c.inboundQueue <- item:
+		default:
+			c.dropInbound(item)
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case c.inboundQueue <- item:
+				return
+			default:
+			}
+			// 队列已满：取出最旧的一条丢弃后重试（分发goroutine可能已抢先取走）
+			select {
+			case oldest := <-c.inboundQueue:
+				c.dropInbound(oldest)
+			default:
+			}
+		}
+	default:
+		select {
+		case c.inboundQueue <- item:
+			return
+		default:
+		}
+		c.mu.Lock()
+		c.Stats.InboundQueue.Blocked++
+		blocked := c.Stats.InboundQueue.Blocked
+		c.mu.Unlock()
+		if blocked == 1 {
+			log.Printf(tr("⚠️ 入站队列已满 (%d)，读取暂停等待消费者 (后续等待只计数)"), cap(c.inboundQueue))
+		}
+		select {
+		case c.inboundQueue <- item:
+		case <-c.ctx.Done():
+			releaseReadBuffer(item.data)
+		}
+	}
+}
+
+// dropInbound 丢弃一条排队消息并计数，首次丢弃时输出警告
+func (c *WebSocketClient) dropInbound(item bridgeMessage) {
+	releaseReadBuffer(item.data)
+	c.mu.Lock()
+	c.Stats.InboundQueue.Dropped++
+	dropped := c.Stats.InboundQueue.Dropped
+	c.mu.Unlock()
+	if dropped == 1 {
+		log.Printf(tr("⚠️ 入站队列已满 (%d)，按 %s 策略丢弃消息 (后续丢弃只计数)"), cap(c.inboundQueue), c.config.Backpressure)
+	}
+}
+
+// consumeInboundQueue 从入站队列依次取出消息分发，分发完成后归还缓冲区
+// 设置了接收速率上限时按速率匀速分发；客户端停止时队列中尚未分发的消息直接丢弃
+func (c *WebSocketClient) consumeInboundQueue() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case item := <-c.inboundQueue:
+			// 限制接收速率时等待令牌，期间新消息在队列中排队
+			if c.receiveLimiter != nil {
+				if err := c.receiveLimiter.Wait(c.ctx); err != nil {
+					releaseReadBuffer(item.data)
+					return
+				}
+			}
+			c.handleInbound(item.messageType, item.data)
+			releaseReadBuffer(item.data)
+		}
+	}
+}
+
+// ===== 管理API =====
+
+// DefaultMessageHistorySize 管理API保留的最近接收消息条数
+const DefaultMessageHistorySize = 1000
+
+// RecordedMessage 管理API记录的一条接收消息
+type RecordedMessage struct {
+	ID   int64     `json:"id"`   // 消息序号：从1开始递增，可作为since参数增量拉取
+	Time time.Time `json:"time"` // 接收时间
+	Type string    `json:"type"` // 消息类型：text或binary
+	Data string    `json:"data"` // 消息内容：文本消息为原文，二进制消息为base64编码
+}
+
+// messageHistory 接收消息的环形记录
+// 保留最近的若干条消息，供GET /messages增量拉取
+//
+// 并发安全：使用互斥锁保护，读取goroutine写入、HTTP处理器读取
+type messageHistory struct {
+	mu       sync.Mutex        // 保护以下字段
+	messages []RecordedMessage // 按序号递增排列的消息
+	nextID   int64             // 下一条消息的序号
+	capacity int               // 最大保留条数
+}
+
+// newMessageHistory 创建消息记录
+func newMessageHistory(capacity int) *messageHistory {
+	return &messageHistory{nextID: 1, capacity: capacity}
+}
+
+// add 记录一条消息，超过容量时丢弃最旧的消息
+func (h *messageHistory) add(messageType int, data []byte) {
+	msg := RecordedMessage{Time: time.Now(), Type: "text", Data: string(data)}
+	if messageType == websocket.BinaryMessage {
+		msg.Type = "binary"
+		msg.Data = base64.StdEncoding.EncodeToString(data)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg.ID = h.nextID
+	h.nextID++
+	h.messages = append(h.messages, msg)
+	if len(h.messages) > h.capacity {
+		h.messages = slices.Delete(h.messages, 0, len(h.messages)-h.capacity)
+	}
+}
+
+// since 返回满足条件的消息副本
+//
+// 参数说明：
+//   - id: 只返回序号大于id的消息
+//   - t: 只返回接收时间晚于t的消息，零值表示不按时间过滤
+func (h *messageHistory) since(id int64, t time.Time) []RecordedMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]RecordedMessage, 0, len(h.messages))
+	for _, msg := range h.messages {
+		if msg.ID > id && msg.Time.After(t) {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// registerAdminHandlers 在健康检查服务器上注册管理API
+// 只有配置了AdminToken时才注册，所有管理端点都需要认证
+//
+// 提供的端点：
+//   - POST /send：请求体作为消息发送，?type=binary或Content-Type为application/octet-stream时发送二进制消息
+//   - POST /close：以正常关闭码（可用?code=和?reason=指定）关闭连接并停止客户端
+//   - GET /messages?since=：返回最近接收的消息，since可以是消息序号或RFC3339时间
+//   - GET /config：返回当前配置（敏感信息已脱敏）
+//   - PATCH /config：修改可热更新的配置项，请求体为RuntimeConfigPatch
+func (c *WebSocketClient) registerAdminHandlers(mux *http.ServeMux) {
+	if c.config.AdminToken == "" {
+		return
+	}
+	mux.HandleFunc("/send", c.requireAdmin(http.MethodPost, c.handleAdminSend))
+	mux.HandleFunc("/close", c.requireAdmin(http.MethodPost, c.handleAdminClose))
+	mux.HandleFunc("/messages", c.requireAdmin(http.MethodGet, c.handleAdminMessages))
+	mux.HandleFunc("/config", c.requireAdmin(http.MethodGet+", "+http.MethodPatch, c.handleAdminConfig))
+	log.Print(tr("🔑 管理API已启用: POST /send, POST /close, GET /messages, GET|PATCH /config"))
+}
+
+// requireAdmin 为管理端点添加方法检查和令牌认证
+// 令牌通过 Authorization: Bearer <token> 请求头传递，使用常量时间比较防止计时攻击
+// method允许多个方法，以", "分隔（同时作为405响应的Allow头）
+func (c *WebSocketClient) requireAdmin(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(strings.Split(method, ", "), r.Method) {
+			w.Header().Set("Allow", method)
+			writeJSONError(w, http.StatusMethodNotAllowed, "不支持的请求方法")
+			return
+		}
+		if !checkBearerToken(r, c.config.AdminToken) {
+			log.Printf(tr("🚫 管理API认证失败: %s %s 来自 %s"), r.Method, r.URL.Path, r.RemoteAddr)
+			writeJSONError(w, http.StatusUnauthorized, "认证失败")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkBearerToken 检查请求的 Authorization: Bearer <token> 请求头，使用常量时间比较防止计时攻击
+func checkBearerToken(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// handleAdminSend 处理 POST /send：将请求体作为WebSocket消息发送
+func (c *WebSocketClient) handleAdminSend(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(c.config.MaxMessageSize)))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("读取请求体失败: %v", err))
+		return
+	}
+
+	messageType := websocket.TextMessage
+	if r.URL.Query().Get("type") == "binary" || r.Header.Get("Content-Type") == "application/octet-stream" {
+		messageType = websocket.BinaryMessage
+	}
+
+	if err := c.SendMessage(messageType, body); errors.Is(err, ErrQueued) {
+		writeJSON(w, http.StatusAccepted, map[string]any{"sent": false, "queued": true, "bytes": len(body)})
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, fmt.Sprintf("发送失败: %v", err))
+		return
+	}
+	log.Printf(tr("🔑 管理API发送消息: %d 字节 (%s)"), len(body), c.getMessageTypeString(messageType))
+	writeJSON(w, http.StatusOK, map[string]any{"sent": true, "bytes": len(body)})
+}
+
+// handleAdminClose 处理 POST /close：发送关闭帧并停止客户端
+func (c *WebSocketClient) handleAdminClose(w http.ResponseWriter, r *http.Request) {
+	code := websocket.CloseNormalClosure
+	if codeStr := r.URL.Query().Get("code"); codeStr != "" {
+		parsed, err := strconv.Atoi(codeStr)
+		if err != nil || !isSendableCloseCode(parsed) {
+			writeJSONError(w, http.StatusBadRequest, "关闭码必须是1000-1003、1007-1014或3000-4999（1004、1005、1006、1015为保留值）")
+			return
+		}
+		code = parsed
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "管理API请求关闭"
+	}
+
+	log.Printf(tr("🔑 管理API请求关闭连接: 关闭码=%d, 原因=%q"), code, reason)
+	if err := c.sendControlMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason)); err != nil {
+		log.Printf(tr("⚠️ 发送关闭消息失败: %v"), err)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"closed": true, "code": code})
+	c.cancel()
+}
+
+// handleAdminMessages 处理 GET /messages：返回最近接收的消息
+func (c *WebSocketClient) handleAdminMessages(w http.ResponseWriter, r *http.Request) {
+	var sinceID int64
+	var sinceTime time.Time
+	if since := r.URL.Query().Get("since"); since != "" {
+		if id, err := strconv.ParseInt(since, 10, 64); err == nil {
+			sinceID = id
+		} else if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+			sinceTime = t
+		} else {
+			writeJSONError(w, http.StatusBadRequest, "since必须是消息序号或RFC3339时间")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"messages": c.messageHistory.since(sinceID, sinceTime)})
+}
+
+// handleAdminConfig 处理 GET /config 和 PATCH /config
+// GET返回脱敏后的当前配置；PATCH按RuntimeConfigPatch修改可热更新的配置项，返回实际变更的项和修改后的配置
+func (c *WebSocketClient) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		var patch RuntimeConfigPatch
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&patch); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("请求体无效（只能包含可热更新的配置项）: %v", err))
+			return
+		}
+		changed, err := c.applyRuntimeConfig(patch)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf(tr("🔑 管理API修改配置: %s"), strings.Join(changed, ", "))
+		writeJSON(w, http.StatusOK, map[string]any{"changed": changed, "config": c.redactedConfig()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"config": c.redactedConfig()})
+}
+
+// ===== 运行时配置 =====
+
+// RuntimeConfigPatch 运行时配置变更：字段为nil表示不修改
+// 只包含无需重连即可生效的配置项，字段名与配置文件一致；PATCH /config和热重载共用applyRuntimeConfig应用变更
+type RuntimeConfigPatch struct {
+	LogLevel     *int          `json:"log_level,omitempty"`     // 日志级别：0=ERROR, 1=WARN, 2=INFO, 3=DEBUG
+	VerbosePing  *bool         `json:"verbose_ping,omitempty"`  // 详细ping/pong日志
+	PingInterval *JSONDuration `json:"ping_interval,omitempty"` // Ping发送间隔，下一次ping起生效
+	SendRate     *float64      `json:"send_rate,omitempty"`     // 令牌桶发送速率（条/秒），0表示恢复默认的滑动窗口限制
+	SendBurst    *int          `json:"send_burst,omitempty"`    // 令牌桶容量，0表示与发送速率相同
+}
+
+// JSONDuration 可从JSON字符串（"30s"）或纳秒整数解析的时长
+// 整数形式与ClientConfig序列化的时长字段一致，GET /config返回的值可以直接用于PATCH
+type JSONDuration time.Duration
+
+// UnmarshalJSON 实现json.Unmarshaler
+func (d *JSONDuration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		parsed, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		*d = JSONDuration(parsed)
+		return nil
+	}
+	var nanos int64
+	if err := json.Unmarshal(data, &nanos); err != nil {
+		return errors.New(tr("时长必须是字符串（如\"30s\"）或纳秒整数"))
+	}
+	*d = JSONDuration(nanos)
+	return nil
+}
+
+// applyRuntimeConfig 将运行时配置变更应用到正在运行的客户端
+//
+// 参数说明：
+//   - patch: 要修改的配置项，nil字段保持不变
+//
+// 返回值：
+//   - []string: 实际发生变化的配置项，格式为"名称=新值"
+//   - error: 变更后的配置无效时返回错误，此时不修改任何配置
+//
+// 功能说明：
+//  1. 在配置副本上应用变更并整体验证，保证要么全部生效要么全部不生效
+//  2. 写回配置，并同步到依赖这些配置的组件：syslog级别、ping定时器和发送限速器
+//
+// 注意事项：
+//   - 修改发送速率会以新参数重建限速器，已累计的限流统计随之清零
+//
+// 并发安全：持有runtimeMu写锁修改配置
+func (c *WebSocketClient) applyRuntimeConfig(patch RuntimeConfigPatch) ([]string, error) {
+	c.runtimeMu.Lock()
+	defer c.runtimeMu.Unlock()
+
+	// 第一步：在副本上应用变更并验证
+	updated := *c.config
+	if patch.LogLevel != nil {
+		updated.LogLevel = *patch.LogLevel
+	}
+	if patch.VerbosePing != nil {
+		updated.VerbosePing = *patch.VerbosePing
+	}
+	if patch.PingInterval != nil {
+		updated.PingInterval = time.Duration(*patch.PingInterval)
+	}
+	if patch.SendRate != nil {
+		updated.SendRate = *patch.SendRate
+	}
+	if patch.SendBurst != nil {
+		updated.SendBurst = *patch.SendBurst
+	}
+	if err := updated.Validate(); err != nil {
+		return nil, err
+	}
+
+	// 第二步：逐项写回并通知相关组件
+	var changed []string
+	if updated.LogLevel != c.config.LogLevel {
+		c.config.LogLevel = updated.LogLevel
+		if logSyslog != nil {
+			logSyslog.setLogLevel(updated.LogLevel)
+		}
+		changed = append(changed, fmt.Sprintf("log_level=%d", updated.LogLevel))
+	}
+	if updated.VerbosePing != c.config.VerbosePing {
+		c.config.VerbosePing = updated.VerbosePing
+		changed = append(changed, fmt.Sprintf("verbose_ping=%t", updated.VerbosePing))
+	}
+	setConsoleLogLevel(c.config.LogLevel, c.config.Verbose || c.config.VerbosePing)
+	if updated.PingInterval != c.config.PingInterval {
+		c.config.PingInterval = updated.PingInterval
+		// 只保留最新的间隔，ping循环未运行时（禁用自动ping）不会阻塞
+		select {
+		case <-c.pingReset:
+		default:
+		}
+		c.pingReset <- updated.PingInterval
+		changed = append(changed, fmt.Sprintf("ping_interval=%s", updated.PingInterval))
+	}
+	if updated.SendRate != c.config.SendRate || updated.SendBurst != c.config.SendBurst {
+		c.config.SendRate, c.config.SendBurst = updated.SendRate, updated.SendBurst
+		c.rateLimiter = newSendLimiter(updated.SendRate, updated.SendBurst)
+		changed = append(changed, fmt.Sprintf("send_rate=%g", updated.SendRate), fmt.Sprintf("send_burst=%d", updated.SendBurst))
+	}
+	if len(changed) == 0 {
+		changed = []string{}
+	}
+	return changed, nil
+}
+
+// cycleLogLevel 循环切换日志级别（INFO→DEBUG→ERROR→WARN→INFO），由SIGHUP触发
+// 切换到DEBUG时同时打开详细ping/pong日志，离开DEBUG时关闭，无需断开连接即可开关诊断输出
+func (c *WebSocketClient) cycleLogLevel() {
+	logLevels := []string{"ERROR", "WARN", "INFO", "DEBUG"}
+
+	c.runtimeMu.RLock()
+	level := (c.config.LogLevel + 1) % len(logLevels)
+	c.runtimeMu.RUnlock()
+	verbosePing := level == len(logLevels)-1
+
+	if _, err := c.applyRuntimeConfig(RuntimeConfigPatch{LogLevel: &level, VerbosePing: &verbosePing}); err != nil {
+		log.Printf(tr("⚠️ 切换日志级别失败: %v"), err)
+		return
+	}
+	log.Printf(tr("📝 日志级别已切换为 %s (详细ping日志: %t)"), logLevels[level], verbosePing)
+}
+
+// verbosePing 返回当前是否输出详细ping/pong日志（可在运行时修改）
+func (c *WebSocketClient) verbosePing() bool {
+	c.runtimeMu.RLock()
+	defer c.runtimeMu.RUnlock()
+	return c.config.VerbosePing
+}
+
+// sendLimiter 返回当前的发送频率限制器（修改发送速率时会被替换）
+func (c *WebSocketClient) sendLimiter() SendLimiter {
+	c.runtimeMu.RLock()
+	defer c.runtimeMu.RUnlock()
+	return c.rateLimiter
+}
+
+// redactedConfig 返回脱敏后的配置副本，供GET /config展示
+// 连接地址、Webhook地址和转发目标中的密码和查询参数值替换为REDACTED，去掉客户端证书（含私钥）和密钥日志输出；
+// 管理令牌和Webhook签名密钥本身不参与序列化
+func (c *WebSocketClient) redactedConfig() ClientConfig {
+	c.runtimeMu.RLock()
+	redacted := *c.config
+	c.runtimeMu.RUnlock()
+
+	redacted.URL = redactURL(redacted.URL)
+	if redacted.WebhookURL != "" {
+		redacted.WebhookURL = redactURL(redacted.WebhookURL)
+	}
+	if redacted.Forward != "" {
+		redacted.Forward = redactURL(redacted.Forward)
+	}
+	if redacted.TLSConfig != nil {
+		tlsConfig := *redacted.TLSConfig
+		tlsConfig.Certificates = nil
+		tlsConfig.KeyLogWriter = nil
+		redacted.TLSConfig = &tlsConfig
+	}
+	return redacted
+}
+
+// redactURL 隐藏URL中的密码和查询参数值，这些位置常用于携带认证令牌
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "REDACTED"
+	}
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query[key] = []string{"REDACTED"}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// writeJSON 写出JSON响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf(tr("⚠️ 写入JSON响应失败: %v"), err)
+	}
+}
+
+// writeJSONError 写出JSON格式的错误响应
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// ===== 指标常量标签 =====
+
+// reservedLabelNames 指标自身已使用的标签名，常量标签不能与之重名
+var reservedLabelNames = []string{"code", "direction", "error_code", "phase", "stat", "tier", "type", "violation", "window"}
+
+// labelNamePattern Prometheus标签名的合法格式
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateLabelName 检查常量标签名是否可以用于Prometheus指标
+//
+// 参数说明：
+//   - name: 标签名
+//
+// 返回值：
+//   - error: 格式非法、以双下划线开头（Prometheus保留）或与内置标签重名时返回错误
+func validateLabelName(name string) error {
+	if !labelNamePattern.MatchString(name) {
+		return fmt.Errorf(tr("标签名 '%s' 只能包含字母、数字和下划线，且不能以数字开头"), name)
+	}
+	if strings.HasPrefix(name, "__") {
+		return fmt.Errorf(tr("标签名 '%s' 不能以双下划线开头"), name)
+	}
+	if slices.Contains(reservedLabelNames, name) {
+		return fmt.Errorf(tr("标签名 '%s' 已被内置指标使用"), name)
+	}
+	return nil
+}
+
+// addConstantLabels 为Prometheus文本格式中的每个样本追加常量标签
+//
+// 参数说明：
+//   - text: writeMetrics输出的指标文本
+//   - labels: 常量标签，按标签名排序后输出，保证每次抓取结果一致
+//
+// 返回值：
+//   - []byte: 追加标签后的指标文本
+//
+// 注意事项：
+//   - 注释行（# HELP、# TYPE）和空行原样保留
+//   - 已有标签的样本在原标签之后追加，没有标签的样本补上{}
+func addConstantLabels(text []byte, labels map[string]string) []byte {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escaper.Replace(labels[name]) + `"`
+	}
+	constant := strings.Join(pairs, ",")
+
+	var out bytes.Buffer
+	out.Grow(len(text) + len(text)/4)
+	for _, line := range strings.SplitAfter(string(text), "\n") {
+		if line == "" || line == "\n" || strings.HasPrefix(line, "#") {
+			out.WriteString(line)
+			continue
+		}
+		// 指标名以第一个'{'或空格结束
+		end := strings.IndexAny(line, "{ ")
+		switch {
+		case end < 0:
+			out.WriteString(line)
+		case line[end] == '{':
+			out.WriteString(line[:end+1] + constant + "," + line[end+1:])
+		default:
+			out.WriteString(line[:end] + "{" + constant + "}" + line[end:])
+		}
+	}
+	return out.Bytes()
+}
+
+// updatePrometheusMetrics 更新Prometheus指标
+// 这个方法将内部统计数据同步到Prometheus指标结构中
+//
+// 功能说明：
+//  1. 从内部统计数据更新Prometheus指标
+//  2. 确保指标数据的一致性和准确性
+//  3. 支持实时的指标查询和监控
+//
+// 更新的指标类型：
+//  1. 计数器指标：消息数量、字节数量、错误数量、重连数量
+//  2. 仪表指标：当前连接状态（0或1）
+//  3. 分类指标：按错误码分类的错误统计
+//
+// 数据同步：
+//   - 从c.Stats复制到c.metrics
+//   - 保持数据的原子性和一致性
+//   - 支持Prometheus的拉取模式
+//
+// 并发安全：
+//   - 使用读锁保护统计数据的读取
+//   - 避免在指标更新过程中数据变化
+//   - 确保指标的准确性
+//
+// 调用时机：
+//   - handleMetrics处理器中调用
+//   - 确保返回最新的指标数据
+//   - 支持实时监控需求
+func (c *WebSocketClient) updatePrometheusMetrics() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// 更新消息和字节统计指标
+	c.metrics.MessagesSentTotal = c.Stats.MessagesSent
+	c.metrics.MessagesReceivedTotal = c.Stats.MessagesReceived
+	c.metrics.BytesSentTotal = c.Stats.BytesSent
+	c.metrics.BytesReceivedTotal = c.Stats.BytesReceived
+
+	// 更新连接相关指标
+	c.metrics.ReconnectionsTotal = int64(c.Stats.ReconnectCount)
+	c.metrics.ErrorsTotal = c.Stats.Errors.TotalErrors
+
+	// 更新连接状态指标（仪表类型）
+	if c.isConnected() {
+		c.metrics.ConnectionsActive = 1 // 连接活跃
+	} else {
+		c.metrics.ConnectionsActive = 0 // 连接断开
+	}
+
+	// 更新错误码分类统计
+	for code, count := range c.Stats.Errors.ErrorsByCode {
+		c.metrics.ErrorsByCodeTotal[code] = count
+	}
+}
+
+// stopMonitoringServers 停止监控服务器
+// 这个方法优雅地关闭Prometheus指标服务器和健康检查服务器
+//
+// 功能说明：
+//  1. 优雅关闭指标服务器
+//  2. 优雅关闭健康检查服务器
+//  3. 设置合理的关闭超时时间
+//  4. 清理服务器引用
+//
+// 关闭流程：
+//  1. 检查服务器是否存在
+//  2. 创建带超时的上下文（5秒）
+//  3. 调用服务器的Shutdown方法
+//  4. 处理关闭错误和成功情况
+//  5. 清理服务器引用防止内存泄漏
+//
+// 超时处理：
+//   - 设置5秒的优雅关闭超时
+//   - 超时后强制关闭服务器
+//   - 记录关闭状态和错误信息
+//
+// 错误处理：
+//   - 记录关闭失败的警告信息
+//   - 记录成功关闭的确认信息
+//   - 确保在任何情况下都清理引用
+//
+// 调用时机：
+//   - 客户端停止时调用
+//   - 程序退出前的清理工作
+//   - 确保资源正确释放
+func (c *WebSocketClient) stopMonitoringServers() {
+	// 停止Prometheus指标服务器
+	if c.metricsServer != nil {
+		// 创建5秒超时的上下文
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// 优雅关闭指标服务器
+		if err := c.metricsServer.Shutdown(ctx); err != nil {
+			log.Printf(tr("⚠️ 指标服务器关闭失败: %v"), err)
+		} else {
+			log.Print(tr("📊 指标服务器已关闭"))
+		}
+		c.metricsServer = nil // 清理引用
+	}
+
+	// 停止健康检查服务器
+	if c.healthServer != nil {
+		// 创建5秒超时的上下文
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// 优雅关闭健康检查服务器
+		if err := c.healthServer.Shutdown(ctx); err != nil {
+			log.Printf(tr("⚠️ 健康检查服务器关闭失败: %v"), err)
+		} else {
+			log.Print(tr("🏥 健康检查服务器已关闭"))
+		}
+		c.healthServer = nil // 清理引用
+	}
+
+	// 停止统一管理服务器
+	if c.adminServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := c.adminServer.Shutdown(ctx); err != nil {
+			log.Printf(tr("⚠️ 统一管理服务器关闭失败: %v"), err)
+		} else {
+			log.Print(tr("🛠️ 统一管理服务器已关闭"))
+		}
+		c.adminServer = nil // 清理引用
+	}
+}
+
+// SendMessage 发送消息到 WebSocket 服务器
+// 集成了消息处理器、自适应缓冲区和错误恢复功能
+// 支持文本消息、二进制消息和控制消息的发送
+//
+// Example:
+//
+//	// 发送文本消息
+//	err := client.SendMessage(websocket.TextMessage, []byte("Hello"))
+//
+//	// 发送二进制消息
+//	err := client.SendMessage(websocket.BinaryMessage, binaryData)
+//
+//	// 发送ping消息
+//	err := client.SendMessage(websocket.PingMessage, nil)
+//
+// 数据帧会先经过UseOutbound注册的出站中间件链，控制帧直接发送。
+// 启用--journal时连接不可用导致的失败返回ErrQueued：消息已保留在发送日志中，连接后自动重发，调用方不应再次发送
+func (c *WebSocketClient) SendMessage(messageType int, data []byte) error {
+	if err := c.checkJSONSchema(true, messageType, data); err != nil {
+		return err
+	}
+
+	write := c.journaledWrite(c.writeMessage)
+	c.mu.RLock()
+	outbound := c.outboundMiddleware
+	c.mu.RUnlock()
+	if len(outbound) == 0 || !isDataMessage(messageType) {
+		return write(messageType, data)
+	}
+	return chainMiddleware(write, outbound)(messageType, data)
+}
+
+// SendMessageContext 发送消息，并以ctx限制本次调用的等待和写入时间
+// 与SendMessage相同，但频率限制等待在ctx结束时立即返回，取得写锁时ctx已结束则放弃发送；
+// ctx带有截止时间且早于WriteTimeout时以它作为写入截止时间，便于嵌入客户端的调用方按请求控制延迟
+//
+// 参数说明：
+//   - ctx: 本次发送的上下文，客户端停止时同样会中止等待
+//   - messageType: 消息类型（websocket.TextMessage、websocket.BinaryMessage或控制消息）
+//   - data: 消息内容
+//
+// 返回值：
+//   - error: 发送失败时的错误信息；因ctx结束而放弃发送时errors.Is(err, ctx.Err())成立；
+//     消息已保留在发送日志中等待重发时errors.Is(err, ErrQueued)成立
+//
+// 注意事项：
+//   - 已经开始写入的帧不会被中途取消（中途停止会破坏帧边界），只有截止时间能限制写入本身
+//   - 写入因截止时间失败后连接不再可用，与WriteTimeout超时一样由重连机制恢复
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+//	defer cancel()
+//	if err := client.SendMessageContext(ctx, websocket.TextMessage, order); errors.Is(err, context.DeadlineExceeded) {
+//		// 本次请求超时
+//	}
+func (c *WebSocketClient) SendMessageContext(ctx context.Context, messageType int, data []byte) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
+
+	if ctx.Err() != nil {
+		return c.sendCanceledError(ctx)
+	}
+	if err := c.checkJSONSchema(true, messageType, data); err != nil {
+		return err
+	}
+
+	write := c.journaledWrite(func(messageType int, data []byte) error {
+		return c.writeMessageContext(ctx, messageType, data)
+	})
+	c.mu.RLock()
+	outbound := c.outboundMiddleware
+	c.mu.RUnlock()
+	if len(outbound) == 0 || !isDataMessage(messageType) {
+		return write(messageType, data)
+	}
+	return chainMiddleware(write, outbound)(messageType, data)
+}
+
+// SendTextContext 以ctx限制本次调用发送文本消息，参见SendMessageContext
+func (c *WebSocketClient) SendTextContext(ctx context.Context, text string) error {
+	return c.SendMessageContext(ctx, websocket.TextMessage, []byte(text))
+}
+
+// SendBinaryContext 以ctx限制本次调用发送二进制消息，参见SendMessageContext
+func (c *WebSocketClient) SendBinaryContext(ctx context.Context, data []byte) error {
+	return c.SendMessageContext(ctx, websocket.BinaryMessage, data)
+}
+
+// sendCanceledError 构造因ctx结束而放弃发送的错误
+// 这是调用方主动放弃，不计入错误统计
+func (c *WebSocketClient) sendCanceledError(ctx context.Context) error {
+	cause := ctx.Err()
+	if cause == nil || c.ctx.Err() != nil {
+		cause = ErrConnectionClosed
+	}
+	return &ConnectionError{
+		Code:  ErrCodeSendTimeout,
+		Op:    "send",
+		URL:   c.config.URL,
+		Err:   fmt.Errorf("%w: %w", ErrContextCanceled, cause),
+		Retry: false,
+	}
+}
+
+// writeMessage 执行实际的消息发送，是出站中间件链的最终处理阶段
+// 依次进行频率限制、安全检查、消息验证和大小检查，然后在写锁保护下写入连接
+func (c *WebSocketClient) writeMessage(messageType int, data []byte) error {
+	return c.writeMessageContext(c.ctx, messageType, data)
+}
+
+// writeMessageContext 是writeMessage的实现，ctx限制频率限制等待、写锁等待和写入截止时间
+func (c *WebSocketClient) writeMessageContext(ctx context.Context, messageType int, data []byte) error {
+	// 记录锁获取（死锁检测）
+	c.deadlockDetector.AcquireLock("send")
+	defer c.deadlockDetector.ReleaseLock("send")
+
+	// 频率限制检查，调用方的ctx结束导致的等待失败不属于限流错误
+	if limitErr := c.sendLimiter().Wait(ctx); limitErr != nil {
+		if ctx != c.ctx && ctx.Err() != nil {
+			return c.sendCanceledError(ctx)
+		}
+		err := &ConnectionError{
+			Code:  ErrCodeRateLimitExceeded,
+			Op:    "send",
+			URL:   c.config.URL,
+			Err:   limitErr,
+			Retry: true,
+		}
+		c.recordError(err)
+		return err
+	}
+
+	// 安全检查
+	if err := c.securityChecker.CheckMessage(messageType, data); err != nil {
+		securityErr := &ConnectionError{
+			Code:  ErrCodeSecurityViolation,
+			Op:    "send",
+			URL:   c.config.URL,
+			Err:   err,
+			Retry: false,
+		}
+		c.recordError(securityErr)
+		c.emitWebhook(WebhookEventSecurityViolation, err.Error(), 0)
+		return securityErr
+	}
+
+	conn, connected := c.getConnSafely()
+	if conn == nil || !connected {
+		err := &ConnectionError{
+			Code:  ErrCodeConnectionLost,
+			Op:    "send",
+			URL:   c.config.URL,
+			Err:   ErrConnectionClosed,
+			Retry: false,
+		}
+		c.recordError(err)
+		c.slo.recordSend(false)
+		return err
+	}
+
+	// 使用消息处理器验证和格式化消息
+	if err := c.messageProcessor.ValidateMessage(messageType, data); err != nil {
+		validationErr := &ConnectionError{
+			Code:  ErrCodeInvalidMessage,
+			Op:    "send",
+			URL:   c.config.URL,
+			Err:   err,
+			Retry: false,
+		}
+		c.recordError(validationErr)
+		return validationErr
+	}
+
+	// 直接使用原始数据，简化消息处理
+	formattedData := data
+
+	// 检查消息大小（双重检查）
+	if len(formattedData) > c.config.MaxMessageSize {
+		err := &ConnectionError{
+			Code:  ErrCodeMessageTooLarge,
+			Op:    "send",
+			URL:   c.config.URL,
+			Err:   fmt.Errorf(tr("消息大小 %d 超过限制 %d"), len(formattedData), c.config.MaxMessageSize),
+			Retry: false,
+		}
+		c.recordError(err)
+		return err
+	}
+
+	// 使用写锁保护WebSocket写操作，防止并发写入
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	// 等待写锁期间ctx可能已经结束，此时还没有写入任何数据，可以安全放弃
+	if ctx != c.ctx && ctx.Err() != nil {
+		return c.sendCanceledError(ctx)
+	}
+
+	// 设置写入超时，ctx的截止时间更早时以它为准
+	// 持有写锁后再设置，避免本次较短的截止时间作用到其他发送者的写入上
+	deadline := time.Now().Add(c.config.WriteTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		timeoutErr := &ConnectionError{
+			Code:  ErrCodeSendTimeout,
+			Op:    "send",
+			URL:   c.config.URL,
+			Err:   err,
+			Retry: false,
+		}
+		c.recordError(timeoutErr)
+		c.slo.recordSend(false)
+		return timeoutErr
+	}
+
+	// 自适应缓冲区优化：根据消息大小和历史性能动态选择缓冲策略
+	var sendData []byte
+	var needReturn bool
+
+	if c.AdaptiveBuffer {
+		// 自适应缓冲区逻辑
+		bufferSize := c.calculateOptimalBufferSize(len(formattedData))
+		if bufferSize <= LargeBufferSize {
+			buf := globalBufferPool.Get(bufferSize)
+			// 延迟释放缓冲区的匿名函数：确保缓冲区在使用完毕后正确归还到内存池
+			defer func() {
+				if needReturn {
+					globalBufferPool.Put(buf) // 将缓冲区归还到全局内存池，避免内存泄漏
+				}
+			}()
+			copy(buf, formattedData)
+			sendData = buf[:len(formattedData)] // 只发送实际数据长度
+			needReturn = true
+		} else {
+			// 对于超大消息，直接使用原始数据
+			sendData = formattedData
+			needReturn = false
+		}
+	} else {
+		// 传统缓冲区逻辑
+		if len(formattedData) <= LargeBufferSize {
+			buf := globalBufferPool.Get(len(formattedData))
+			// 延迟释放缓冲区的匿名函数：确保传统缓冲区逻辑中的缓冲区正确归还
+			defer func() {
+				if needReturn {
+					globalBufferPool.Put(buf) // 将缓冲区归还到全局内存池，保持内存池的高效运作
+				}
+			}()
+			copy(buf, formattedData)
+			sendData = buf[:len(formattedData)] // 只发送实际数据长度
+			needReturn = true
+		} else {
+			sendData = formattedData
+			needReturn = false
+		}
+	}
+
+	// 发送消息
+	startTime := time.Now()
+	if err := conn.WriteMessage(messageType, sendData); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil && ctx != c.ctx {
+			// 写入因调用方的截止时间失败，保留ctx错误便于调用方用errors.Is判断
+			err = fmt.Errorf("%w: %w", ctxErr, err)
+		}
+		sendErr := &ConnectionError{
+			Code:  c.inferErrorCode(err),
+			Op:    "send",
+			URL:   c.config.URL,
+			Err:   err,
+			Retry: true,
+		}
+		c.handleErrorWithRecovery(sendErr, "发送")
+		c.slo.recordSend(false)
+
+		return sendErr
+	}
+	sendDuration := time.Since(startTime)
+	c.slo.recordSend(true)
+
+	// 更新统计信息
+	c.updateStats(messageType, len(formattedData), true)
+	c.transcript.recordFrame(true, messageType, formattedData)
+	c.capture.record(true, messageType, formattedData)
+
+	// 记录消息到日志文件
+	c.logMessage("SEND", messageType, formattedData)
+	if c.config.HexDump && messageType == websocket.BinaryMessage {
+		log.Printf(tr("📤 发送二进制消息: %d 字节\n%s"), len(formattedData), hex.Dump(formattedData))
+	}
+
+	// 记录发送性能（简化版）
+	log.Printf(tr("📊 消息发送耗时: %v, 类型: %s"), sendDuration, c.getMessageTypeString(messageType))
+
+	return nil
+}
+
+// calculateOptimalBufferSize 计算最优缓冲区大小
+// 记录消息大小并按自适应缓冲区当前的决策选择档位，超过大缓冲区的消息返回实际大小
+func (c *WebSocketClient) calculateOptimalBufferSize(messageSize int) int {
+	// CPU或内存使用率高时不提升档位，按消息大小选择最小的档位以减少内存占用
+	performanceReport := c.performanceMonitor.GetPerformanceReport()
+	pressure := globalBufferPool.IsShedding()
+	if cpuUsage, ok := performanceReport["cpu_usage_percent"].(float64); ok && cpuUsage > 80.0 {
+		pressure = true
+	}
+	if memUsage, ok := performanceReport["memory_usage_bytes"].(int64); ok && memUsage > 100*1024*1024 { // 100MB
+		pressure = true
+	}
+
+	return c.bufferSizer.choose(messageSize, pressure)
+}
+
+// SetDependencies 设置核心组件（简化版）
+func (c *WebSocketClient) SetDependencies(
+	connector Connector,
+	messageProcessor MessageProcessor,
+	errorRecovery ErrorRecovery,
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if connector != nil {
+		c.connector = connector
+	}
+	if messageProcessor != nil {
+		c.messageProcessor = messageProcessor
+	}
+	if errorRecovery != nil {
+		c.errorRecovery = errorRecovery
+	}
+}
+
+// EnableAdvancedFeatures 启用或禁用高级功能
+func (c *WebSocketClient) EnableAdvancedFeatures(autoRecovery, adaptiveBuffer bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.AutoRecovery = autoRecovery
+	c.AdaptiveBuffer = adaptiveBuffer
+
+	log.Printf(tr("🔧 高级功能配置: 自动恢复=%v, 自适应缓冲区=%v"), autoRecovery, adaptiveBuffer)
+}
+
+// GetHealthStatus 获取客户端健康状态（简化版）
+func (c *WebSocketClient) GetHealthStatus() HealthStatus {
+	if c.isConnected() {
+		return HealthHealthy
+	}
+	return HealthUnhealthy
+}
+
+// GetPerformanceReport 获取性能报告
+func (c *WebSocketClient) GetPerformanceReport() map[string]any {
+	// 更新性能监控器
+	c.performanceMonitor.UpdateMetrics(c.GetStats())
+
+	// 获取基础性能报告
+	report := c.performanceMonitor.GetPerformanceReport()
+
+	// 添加死锁检测信息
+	deadlocks := c.deadlockDetector.CheckDeadlocks()
+	report["deadlock_alerts"] = deadlocks
+	report["deadlock_count"] = len(deadlocks)
+
+	// 添加健康检查信息（简化版）
+	report["health_status"] = c.GetHealthStatus().String()
+	report["health_error_count"] = c.Stats.Errors.TotalErrors
+
+	// 添加自适应缓冲区的当前决策
+	report["adaptive_buffer"] = c.bufferSizer.report()
+
+	return report
+}
+
+// logDiagnosticsReport 将连接统计、错误统计、性能报告和goroutine泄漏检查汇总输出到日志
+// 由SIGUSR1触发，未开放健康检查和管理端口时也能查看运行状态
+//
+// 注意事项：
+//   - 报告的每一行都带有🩺前缀，便于在日志中过滤
+//   - 性能报告按键名排序输出，多次转储之间便于对比
+func (c *WebSocketClient) logDiagnosticsReport() {
+	// 第一步：连接统计
+	stats := c.GetStats()
+	log.Printf(tr("🩺 ===== 诊断报告 [会话: %s] ====="), c.SessionID)
+	log.Printf(tr("🩺 连接: 状态=%s, 地址=%s, 持续=%v, 重连=%d次"), c.GetState(), c.config.URL, stats.Uptime.Round(time.Second), stats.ReconnectCount)
+	log.Printf(tr("🩺 消息: 发送 %d 条 (%d 字节), 接收 %d 条 (%d 字节)"), stats.MessagesSent, stats.BytesSent, stats.MessagesReceived, stats.BytesReceived)
+	if stats.Ping.Samples > 0 {
+		log.Printf(tr("🩺 Ping RTT: 最近=%.1fms 平均=%.1fms 最大=%.1fms (%d 次)"), stats.Ping.LastMs, stats.Ping.AvgMs, stats.Ping.MaxMs, stats.Ping.Samples)
+	}
+
+	// 第二步：错误统计
+	errorStats := c.GetErrorStats()
+	log.Printf(tr("🩺 错误: 共 %d 个"), errorStats.TotalErrors)
+	codes := make([]ErrorCode, 0, len(errorStats.ErrorsByCode))
+	for code := range errorStats.ErrorsByCode {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		log.Printf(tr("🩺   [%d] %s: %d 次"), code, code, errorStats.ErrorsByCode[code])
+	}
+	if errorStats.LastError != nil {
+		log.Printf(tr("🩺   最后错误: %v (%s)"), errorStats.LastError, errorStats.LastErrorTime.Format("2006-01-02 15:04:05"))
+	}
+
+	// 第三步：性能报告
+	report := c.GetPerformanceReport()
+	keys := make([]string, 0, len(report))
+	for key := range report {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		log.Printf(tr("🩺 性能: %s=%v"), key, report[key])
+	}
+
+	// 第四步：goroutine泄漏检查
+	leaks := c.goroutineTracker.CheckLeaks()
+	log.Printf(tr("🩺 goroutine: 跟踪中 %d 个, 进程共 %d 个, 疑似泄漏 %d 个"), c.goroutineTracker.GetActiveCount(), runtime.NumGoroutine(), len(leaks))
+	for _, leak := range leaks {
+		log.Printf("🩺   %s", leak)
+	}
+	log.Print(tr("🩺 ===== 诊断报告结束 ====="))
+}
+
+// statsDumpSignal 返回触发诊断报告的SIGUSR1信号
+// syscall在Windows上没有定义SIGUSR1，且各平台的信号值不同，因此按平台返回；不支持的平台返回nil
+func statsDumpSignal() os.Signal {
+	switch runtime.GOOS {
+	case "linux":
+		if strings.HasPrefix(runtime.GOARCH, "mips") {
+			return syscall.Signal(0x10)
+		}
+		return syscall.Signal(0xa)
+	case "darwin", "freebsd", "netbsd", "openbsd", "dragonfly":
+		return syscall.Signal(0x1e)
+	default:
+		return nil
+	}
+}
+
+// SendText 发送文本消息
+// 这是SendMessage的便捷包装函数，专门用于发送文本消息
+//
+// 参数说明：
+//   - text: 要发送的文本内容
+//
+// 返回值：
+//   - error: 发送失败时的错误信息
+//
+// 功能说明：
+//   - 自动将字符串转换为字节数组
+//   - 设置消息类型为websocket.TextMessage
+//   - 继承SendMessage的所有功能和安全检查
+//
+// 使用示例：
+//
+//	err := client.SendText("Hello, WebSocket!")
+//	if err != nil {
+//	    log.Printf("发送文本消息失败: %v", err)
+//	}
+//
+// 注意事项：
+//   - 文本内容会被转换为UTF-8字节序列
+//   - 受到MaxMessageSize配置的限制
+//   - 支持频率限制和安全检查
+func (c *WebSocketClient) SendText(text string) error {
+	return c.SendMessage(websocket.TextMessage, []byte(text))
+}
+
+// SendBinary 发送二进制消息
+// 这是SendMessage的便捷包装函数，专门用于发送二进制数据
+//
+// 参数说明：
+//   - data: 要发送的二进制数据
+//
+// 返回值：
+//   - error: 发送失败时的错误信息
+//
+// 功能说明：
+//   - 直接发送字节数组作为二进制消息
+//   - 设置消息类型为websocket.BinaryMessage
+//   - 继承SendMessage的所有功能和安全检查
+//
+// 使用示例：
+//
+//	binaryData := []byte{0x01, 0x02, 0x03, 0x04}
+//	err := client.SendBinary(binaryData)
+//	if err != nil {
+//	    log.Printf("发送二进制消息失败: %v", err)
+//	}
+//
+// 适用场景：
+//   - 发送图片、音频、视频等媒体文件
+//   - 发送序列化的结构化数据
+//   - 发送加密或压缩的数据
+//   - 发送自定义协议的数据包
+func (c *WebSocketClient) SendBinary(data []byte) error {
+	return c.SendMessage(websocket.BinaryMessage, data)
+}
+
+// SendStream 以流式分片方式发送消息
+// 这个方法使用NextWriter将读取器中的数据作为一条消息发送，
+// 数据按写缓冲区大小自动分片为多个WebSocket帧，不需要一次性分配整条消息的内存
+//
+// 参数说明：
+//   - messageType: 消息类型（websocket.TextMessage或websocket.BinaryMessage）
+//   - r: 消息内容的读取器，读取到io.EOF表示消息结束
+//
+// 返回值：
+//   - error: 发送失败时的错误信息
+//
+// 与SendMessage的区别：
+//   - 不受MaxMessageSize限制，适合多MB级别的文件传输
+//   - 不经过安全检查和消息处理器验证（内容不会整体驻留内存）
+//   - 每写入一个分块都会刷新写入超时，超时只针对单个分块
+//   - 出站中间件作用于完整消息，注册了出站中间件（如端到端加密、载荷压缩）时拒绝发送并返回ErrStreamMiddleware，
+//     避免绕过加密以明文发送
+//
+// 并发安全：
+//   - 整条消息发送期间持有写锁，其他数据消息会等待发送完成（RFC 6455不允许数据消息的分片交错）
+//   - ping/pong等控制帧不使用写锁，可以随时穿插在分片之间发送，长时间上传不会造成pong超时
+//   - 发送频率超限时等待配额而不是直接失败，大文件上传会被限速而不是被拒绝
+func (c *WebSocketClient) SendStream(messageType int, r io.Reader) error {
+	c.mu.RLock()
+	middlewareCount := len(c.outboundMiddleware)
+	c.mu.RUnlock()
+	if middlewareCount > 0 {
+		return &ConnectionError{Code: ErrCodeInvalidMessage, Op: "send_stream", URL: c.config.URL, Err: ErrStreamMiddleware, Retry: false}
+	}
+
+	// 第一步：频率限制检查，等待到有配额为止
+	if limitErr := c.waitSendQuota(c.ctx); limitErr != nil {
+		err := &ConnectionError{
+			Code:  ErrCodeRateLimitExceeded,
+			Op:    "send_stream",
+			URL:   c.config.URL,
+			Err:   limitErr,
+			Retry: true,
+		}
+		c.recordError(err)
+		return err
+	}
+
+	// 第二步：获取连接
+	conn, connected := c.getConnSafely()
+	if conn == nil || !connected {
+		err := &ConnectionError{
+			Code:  ErrCodeConnectionLost,
+			Op:    "send_stream",
+			URL:   c.config.URL,
+			Err:   ErrConnectionClosed,
+			Retry: false,
+		}
+		c.recordError(err)
+		return err
+	}
+
+	// 第三步：持有写锁，整条消息发送期间不允许其他数据帧插入
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	startTime := time.Now()
+	writer, err := conn.NextWriter(messageType)
+	if err != nil {
+		sendErr := &ConnectionError{Code: c.inferErrorCode(err), Op: "send_stream", URL: c.config.URL, Err: err, Retry: true}
+		c.handleErrorWithRecovery(sendErr, "流式发送")
+		return sendErr
+	}
+
+	// 第四步：分块复制，每个分块前刷新写入超时
+	buf := globalBufferPool.Get(LargeBufferSize)
+	defer globalBufferPool.Put(buf)
+
+	var total int64
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			if err := conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout)); err != nil {
+				_ = writer.Close()
+				sendErr := &ConnectionError{Code: ErrCodeSendTimeout, Op: "send_stream", URL: c.config.URL, Err: err, Retry: false}
+				c.recordError(sendErr)
+				return sendErr
+			}
+			if _, err := writer.Write(buf[:n]); err != nil {
+				_ = writer.Close()
+				sendErr := &ConnectionError{Code: c.inferErrorCode(err), Op: "send_stream", URL: c.config.URL, Err: err, Retry: true}
+				c.handleErrorWithRecovery(sendErr, "流式发送")
+				return sendErr
+			}
+			total += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			// 数据源读取失败：关闭写入器结束当前消息，对端会收到截断的消息
+			_ = writer.Close()
+			sendErr := &ConnectionError{Code: ErrCodeInvalidMessage, Op: "send_stream", URL: c.config.URL, Err: fmt.Errorf(tr("读取数据源失败: %w"), readErr), Retry: false}
+			c.recordError(sendErr)
+			return sendErr
+		}
+	}
+
+	// 第五步：关闭写入器，发送最后一个FIN分片
+	if err := conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout)); err == nil {
+		err = writer.Close()
+		if err != nil {
+			sendErr := &ConnectionError{Code: c.inferErrorCode(err), Op: "send_stream", URL: c.config.URL, Err: err, Retry: true}
+			c.handleErrorWithRecovery(sendErr, "流式发送")
+			return sendErr
+		}
+	}
+
+	// 第六步：更新统计并记录日志
+	c.updateStats(messageType, int(total), true)
+	c.transcript.recordStreamedFrame(true, messageType, total)
+	c.capture.recordStreamed(true, messageType, total)
+	c.logStreamedMessage("SEND", messageType, total, "stream")
+	log.Printf(tr("📦 流式发送完成: %d 字节, 耗时: %v, 类型: %s"), total, time.Since(startTime), c.getMessageTypeString(messageType))
+	return nil
+}
+
+// sendQuotaRetryInterval 滑动窗口限流拒绝后重新申请配额的间隔
+const sendQuotaRetryInterval = 100 * time.Millisecond
+
+// waitSendQuota 等待一次发送配额
+// 令牌桶的Wait本身会等待；滑动窗口超限时Wait立即返回错误，这里按固定间隔重试直到获得配额或ctx结束
+func (c *WebSocketClient) waitSendQuota(ctx context.Context) error {
+	for {
+		err := c.sendLimiter().Wait(ctx)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sendQuotaRetryInterval):
+		}
+	}
+}
+
+// SendFile 以流式分片方式发送文件内容
+// 这是SendStream的便捷包装函数，文件内容作为一条二进制消息发送
+//
+// 参数说明：
+//   - path: 要发送的文件路径
+//
+// 返回值：
+//   - error: 打开文件或发送失败时的错误信息
+func (c *WebSocketClient) SendFile(path string) error {
+	// #nosec G304 -- 文件路径由用户通过--send-file或/sendfile显式指定，仅用于读取
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf(tr("打开文件失败: %w"), err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			log.Printf(tr("⚠️ 关闭文件失败: %v"), closeErr)
+		}
+	}()
+
+	log.Printf(tr("📤 开始流式发送文件: %s"), path)
+	return c.SendStream(websocket.BinaryMessage, file)
+}
+
+// waitUntilConnected 阻塞等待连接建立
+// 返回true表示连接已建立，返回false表示客户端在连接前已停止
+func (c *WebSocketClient) waitUntilConnected() bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !c.isConnected() {
+		select {
+		case <-c.ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// sendFileOnConnect 在首次连接建立后发送--send-file指定的文件
+// 这个方法在main中以独立goroutine启动，发送完成后即退出
+func (c *WebSocketClient) sendFileOnConnect() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+
+	if !c.waitUntilConnected() {
+		return
+	}
+	if err := c.SendFile(c.config.SendFile); err != nil {
+		log.Printf(tr("❌ 发送文件失败: %v"), err)
+	}
+}
+
+// TailPollInterval --tail检查文件新内容、轮转和截断的间隔
+const TailPollInterval = 250 * time.Millisecond
+
+// tailFile 跟随--tail指定的文件（类似tail -F），把每个新写入的行作为文本消息发送
+// 这个方法在main中以独立goroutine启动，直到客户端停止
+//
+// 跟随规则：
+//  1. 启动时文件已存在则从末尾开始，只发送之后写入的行；启动时文件不存在则等待其出现并从头读取
+//  2. 只发送以换行符结尾的完整行，去掉行尾的\r\n，空行不发送
+//  3. 路径指向了另一个文件（被重命名轮转）时，读完旧文件剩余的内容后从头读取新文件
+//  4. 文件变得比已读取的位置短（被截断，如copytruncate轮转）时从头重新读取
+//
+// 注意事项：
+//   - 连接断开时暂停读取，重连后从断开处继续，期间写入的行不会丢失
+//   - 使用轮询而不是文件系统通知，新行最多延迟TailPollInterval
+func (c *WebSocketClient) tailFile() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+
+	path := c.config.Tail
+	var file *os.File
+	var reader *bufio.Reader
+	var partial []byte // 尚未遇到换行符的不完整行
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(TailPollInterval)
+	defer ticker.Stop()
+
+	fromEnd := true
+	for {
+		// 第一步：打开文件（启动时、文件轮转后或文件出现前）
+		if file == nil {
+			// #nosec G304 -- 文件路径由用户通过--tail显式指定，仅用于读取
+			f, err := os.Open(path)
+			switch {
+			case err == nil:
+				if fromEnd {
+					if _, err := f.Seek(0, io.SeekEnd); err != nil {
+						log.Printf(tr("⚠️ 定位到文件末尾失败，从头读取: %v"), err)
+					}
+				}
+				file, reader = f, bufio.NewReader(f)
+				log.Printf(tr("📜 开始跟随文件: %s"), path)
+			case fromEnd:
+				log.Printf(tr("⚠️ 无法打开要跟随的文件，等待其出现: %v"), err)
+			}
+			fromEnd = false
+		}
+
+		if file != nil {
+			// 第二步：读取并发送所有完整的新行
+			for {
+				chunk, err := reader.ReadBytes('\n')
+				partial = append(partial, chunk...)
+				if err != nil {
+					break
+				}
+				if !c.sendTailLine(partial) {
+					return
+				}
+				partial = partial[:0]
+			}
+
+			// 第三步：读到末尾后检查轮转和截断
+			current, statErr := file.Stat()
+			info, pathErr := os.Stat(path)
+			switch {
+			case statErr != nil || pathErr != nil:
+				// 文件已被移走、新文件尚未创建，继续等待旧文件的写入
+			case !os.SameFile(current, info):
+				log.Printf(tr("🔄 检测到文件轮转，重新打开: %s"), path)
+				if len(partial) > 0 && !c.sendTailLine(partial) {
+					return
+				}
+				partial = partial[:0]
+				_ = file.Close()
+				file, reader = nil, nil
+				continue
+			default:
+				if offset, err := file.Seek(0, io.SeekCurrent); err == nil && info.Size() < offset {
+					log.Printf(tr("✂️ 文件被截断，从头读取: %s"), path)
+					if _, err := file.Seek(0, io.SeekStart); err == nil {
+						reader.Reset(file)
+						partial = partial[:0]
+						continue
+					}
+				}
+			}
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendTailLine 发送--tail读到的一行，发送期间连接断开时等待重连后重发同一行
+//
+// 返回值：
+//   - bool: 客户端已停止时返回false，调用方应停止跟随
+func (c *WebSocketClient) sendTailLine(line []byte) bool {
+	text := strings.TrimRight(string(line), "\r\n")
+	if text == "" {
+		return true
+	}
+	for {
+		if !c.waitUntilConnected() {
+			return false
+		}
+		err := c.SendText(text)
+		if err == nil || errors.Is(err, ErrQueued) {
+			return true
+		}
+		if c.isConnected() {
+			// 连接正常时的失败（消息过大、安全检查等）重发也不会成功，跳过这一行
+			log.Printf(tr("❌ 发送跟随文件的行失败，已跳过: %v"), err)
+			return true
+		}
+	}
+}
+
+// SetEventHandlers 设置事件处理器
+// 允许自定义连接、断开、消息接收和错误处理的回调函数
+// onMessage的data在回调返回后会被复用，需要保留时请自行复制
+//
+// Example:
+//
+//	client.SetEventHandlers(
+//	    func() { log.Println("连接成功") },
+//	    func(err error) { log.Printf("连接断开: %v", err) },
+//	    func(messageType int, data []byte) error {
+//	        log.Printf("收到消息: %s", string(data))
+//	        return nil
+//	    },
+//	    func(err error) { log.Printf("发生错误: %v", err) },
+//	)
+func (c *WebSocketClient) SetEventHandlers(
+	onConnect func(),
+	onDisconnect func(error),
+	onMessage func(messageType int, data []byte) error,
+	onError func(error),
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if onConnect != nil {
+		c.onConnect = onConnect
+	}
+	if onDisconnect != nil {
+		c.onDisconnect = onDisconnect
+	}
+	if onMessage != nil {
+		c.onMessage = onMessage
+	}
+	if onError != nil {
+		c.onError = onError
+	}
+}
+
+// OnPing 设置收到服务器ping控制帧时的回调
+// 回调在读取goroutine中、自动回复pong之前同步调用，不应长时间阻塞
+// 传入nil取消回调
+//
+// Example:
+//
+//	client.OnPing(func(appData string) {
+//	    log.Printf("收到ping: %q", appData)
+//	})
+func (c *WebSocketClient) OnPing(handler func(appData string)) {
+	c.mu.Lock()
+	c.onPing = handler
+	c.mu.Unlock()
+}
+
+// OnPong 设置收到pong控制帧时的回调
+// rtt为对应ping的往返时间；pong无法与客户端发出的ping匹配时（例如服务器主动发送的pong）为0
+// 回调在读取goroutine中同步调用，不应长时间阻塞；传入nil取消回调
+//
+// Example:
+//
+//	client.OnPong(func(appData string, rtt time.Duration) {
+//	    log.Printf("收到pong，RTT=%v", rtt)
+//	})
+func (c *WebSocketClient) OnPong(handler func(appData string, rtt time.Duration)) {
+	c.mu.Lock()
+	c.onPong = handler
+	c.mu.Unlock()
+}
+
+// OnClose 设置收到服务器关闭帧时的回调
+// code和reason来自服务器发送的关闭帧；连接异常断开（本地生成的1006）时不会调用
+// 回调在读取goroutine中同步调用，早于断开连接回调（onDisconnect）；传入nil取消回调
+//
+// Example:
+//
+//	client.OnClose(func(code int, reason string) {
+//	    log.Printf("服务器关闭连接: %d %s", code, reason)
+//	})
+func (c *WebSocketClient) OnClose(handler func(code int, reason string)) {
+	c.mu.Lock()
+	c.onClose = handler
+	c.mu.Unlock()
+}
+
+// OnReconnecting 设置即将发起重连时的回调
+// 连接断开后每次发起重连前调用一次，attempt从1开始计数，delay为发起这次重连前将要等待的时长
+// 首次连接失败后的重试不会触发；回调在Start所在的goroutine中同步调用，阻塞会推迟重连
+// 传入nil取消回调
+//
+// Example:
+//
+//	client.OnReconnecting(func(attempt int, delay time.Duration) {
+//	    log.Printf("第%d次重连，%v后开始", attempt, delay)
+//	})
+func (c *WebSocketClient) OnReconnecting(handler func(attempt int, delay time.Duration)) {
+	c.mu.Lock()
+	c.onReconnecting = handler
+	c.mu.Unlock()
+}
+
+// OnReconnected 设置重连成功时的回调
+// downtime为从连接断开到重新建立连接的总时长，包含所有失败的重连尝试和等待时间
+// 回调在Start所在的goroutine中同步调用，返回后才开始读取新连接上的消息
+// 传入nil取消回调
+//
+// Example:
+//
+//	client.OnReconnected(func(downtime time.Duration) {
+//	    log.Printf("已恢复连接，中断 %v", downtime)
+//	})
+func (c *WebSocketClient) OnReconnected(handler func(downtime time.Duration)) {
+	c.mu.Lock()
+	c.onReconnected = handler
+	c.mu.Unlock()
+}
+
+// StateChange 描述一次连接状态变化
+type StateChange struct {
+	From ConnectionState // 变化前的状态
+	To   ConnectionState // 变化后的状态
+	Time time.Time       // 状态变化发生的时间
+}
+
+// OnStateChange 设置连接状态变化回调
+// 每次ConnectionState实际发生变化时调用一次（状态未变时不会调用）
+//
+// 注意事项：
+//   - 回调在独立的goroutine中执行，不会阻塞连接流程，可以安全地调用客户端的其他方法
+//   - 回调按状态变化发生的顺序逐个调用，前一个回调返回后才会调用下一个
+//   - 回调执行时客户端状态可能已经再次变化，应以StateChange中的状态为准
+//   - 传入nil取消回调，尚未投递的状态变化会被丢弃
+//
+// Example:
+//
+//	client.OnStateChange(func(change StateChange) {
+//	    log.Printf("%s: %s -> %s", change.Time.Format(time.RFC3339), change.From, change.To)
+//	})
+func (c *WebSocketClient) OnStateChange(handler func(StateChange)) {
+	c.stateEventsMu.Lock()
+	c.onStateChange = handler
+	if handler == nil {
+		c.stateEvents = nil
+	}
+	c.stateEventsMu.Unlock()
+}
+
+// queueStateChange 将状态变化加入投递队列
+// 没有正在运行的投递goroutine时启动一个，保证回调按顺序调用且不阻塞调用方
+func (c *WebSocketClient) queueStateChange(change StateChange) {
+	c.stateEventsMu.Lock()
+	defer c.stateEventsMu.Unlock()
+
+	if c.onStateChange == nil {
+		return
+	}
+	c.stateEvents = append(c.stateEvents, change)
+	if !c.stateEventsRunning {
+		c.stateEventsRunning = true
+		go c.deliverStateChanges()
+	}
+}
+
+// deliverStateChanges 依次把队列中的状态变化投递给onStateChange，队列为空时退出
+func (c *WebSocketClient) deliverStateChanges() {
+	for {
+		c.stateEventsMu.Lock()
+		if len(c.stateEvents) == 0 || c.onStateChange == nil {
+			c.stateEvents = nil
+			c.stateEventsRunning = false
+			c.stateEventsMu.Unlock()
+			return
+		}
+		change := c.stateEvents[0]
+		c.stateEvents = c.stateEvents[1:]
+		handler := c.onStateChange
+		c.stateEventsMu.Unlock()
+
+		handler(change)
+	}
+}
+
+// safeCallOnConnect 安全调用连接成功事件处理器
+// 这个方法以线程安全的方式调用用户设置的连接成功回调函数
+//
+// 功能说明：
+//   - 检查连接回调函数是否已设置
+//   - 在独立的goroutine中调用回调函数
+//   - 避免回调函数阻塞主要的连接流程
+//
+// 并发安全：
+//   - 简化版本，避免锁竞争
+//   - 使用goroutine异步调用，防止阻塞
+//   - 回调函数的执行不会影响连接状态
+//
+// 调用时机：
+//   - WebSocket连接成功建立后
+//   - 在setupConnection方法中调用
+//   - 确保用户能及时收到连接成功通知
+//
+// 注意事项：
+//   - 回调函数在独立的goroutine中执行
+//   - 回调函数的错误不会影响客户端运行
+//   - 用户应确保回调函数的线程安全性
+func (c *WebSocketClient) safeCallOnConnect() {
+	// 简化版本，避免锁竞争
+	if c.onConnect != nil {
+		go c.onConnect()
+	}
+}
+
+// safeCallOnMessage 安全调用消息接收事件处理器
+// 这个方法以线程安全的方式调用用户设置的消息接收回调函数
+//
+// 参数说明：
+//   - messageType: WebSocket消息类型
+//   - data: 消息数据内容
+//
+// 返回值：
+//   - error: 回调函数返回的错误
+//
+// 功能说明：
+//   - 使用读锁安全获取回调函数引用
+//   - 在当前goroutine中同步调用回调函数
+//   - 返回回调函数的执行结果
+//
+// 并发安全：
+//   - 使用读锁保护回调函数的读取
+//   - 避免在锁内调用回调函数，减少锁持有时间
+//   - 支持并发的消息处理
+//
+// 调用时机：
+//   - 接收到WebSocket消息后
+//   - 在ReadMessages方法中调用
+//   - 允许用户自定义消息处理逻辑
+//
+// 注意事项：
+//   - 回调函数在消息读取goroutine中同步执行
+//   - 回调函数的执行时间会影响消息处理性能
+//   - 用户应避免在回调中执行耗时操作
+func (c *WebSocketClient) safeCallOnMessage(messageType int, data []byte) error {
+	c.mu.RLock()
+	handler := c.onMessage
+	c.mu.RUnlock()
+
+	if handler != nil {
+		return handler(messageType, data)
+	}
+	return nil
+}
+
+// safeCallOnError 安全调用错误处理事件处理器
+// 这个方法以线程安全的方式调用用户设置的错误处理回调函数
+//
+// 参数说明：
+//   - err: 发生的错误实例
+//
+// 功能说明：
+//   - 使用读锁安全获取回调函数引用
+//   - 在独立的goroutine中异步调用回调函数
+//   - 避免错误处理阻塞主要流程
+//
+// 并发安全：
+//   - 使用读锁保护回调函数的读取
+//   - 在独立goroutine中执行，避免阻塞
+//   - 错误处理不会影响客户端的正常运行
+//
+// 调用时机：
+//   - 发生各种错误时调用
+//   - 包括连接错误、发送错误、接收错误等
+//   - 为用户提供统一的错误通知机制
+//
+// 注意事项：
+//   - 回调函数在独立的goroutine中执行
+//   - 回调函数的错误不会被捕获或处理
+//   - 用户应确保回调函数的稳定性和线程安全性
+func (c *WebSocketClient) safeCallOnError(err error) {
+	c.mu.RLock()
+	handler := c.onError
+	c.mu.RUnlock()
+
+	if handler != nil {
+		go handler(err)
+	}
+}
+
+// Start 是 WebSocket 客户端的主循环
+// 它管理连接生命周期，包括初始连接、重试和消息读取
+// 这是一个阻塞函数，通常在单独的goroutine中运行
+//
+// Example:
+//
+//	client := NewWebSocketClient(config)
+//	client.SetEventHandlers(onConnect, onDisconnect, onMessage, onError)
+//
+//	// 在goroutine中启动客户端
+//	go client.Start()
+//
+//	// 等待信号或其他条件后停止
+//	<-ctx.Done()
+//	client.Stop()
+func (c *WebSocketClient) Start() {
+	// 延迟执行的清理匿名函数：确保Start函数退出时正确通知其他组件
+	defer func() {
+		// 如果Start函数退出，说明重试失败或收到停止信号
+		// 主动调用cancel来通知main函数退出，实现优雅的程序终止
+		c.cancel()
+	}()
+
+	// 启动周期性ping（如果未禁用）
+	if !c.config.DisableAutoPing {
+		go c.sendPeriodicPing()
+	}
+
+	// 启动自动退出条件监控（如果配置了空闲超时或最长运行时间）
+	if c.config.IdleTimeout > 0 || c.config.MaxDuration > 0 {
+		go c.watchExitConditions()
+	}
+
+	// 启动入站队列分发（如果启用了入站队列）
+	if c.inboundQueue != nil {
+		go c.consumeInboundQueue()
+	}
+
+	// 启动内存压力监控（如果设置了内存上限）
+	if c.config.MaxMemory > 0 {
+		go c.watchMemoryPressure()
+	}
+
+	// 启动systemd看门狗（如果单元配置了WatchdogSec）
+	if c.notifier != nil && c.notifier.watchdogInterval > 0 {
+		go c.runWatchdog()
+	}
+
+	// 启动错误异常检测
+	go c.runAnomalyDetector()
+
+	// 启动goroutine泄漏检查
+	go c.runGoroutineLeakCheck()
+
+	// 启动后台采样（死锁检查、系统指标和组件健康检查）
+	if c.config.SampleInterval > 0 {
+		go c.runBackgroundSampler()
+	}
+
+	// 启动SLO跟踪（如果配置了SLO目标）
+	if c.slo != nil {
+		go c.runSLOTracker()
+	}
+
+	// 周期性保存统计快照（如果配置了状态文件）
+	if c.config.StateFile != "" {
+		go c.runStatePersistence()
+	}
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			log.Print(tr("📋 收到停止信号，退出主循环"))
+			return
+		default:
+			if !c.attemptConnection() {
+				return // 达到最大重试次数或被取消
+			}
+
+			if !c.handleConnectedSession() {
+				return // 被取消或需要退出
+			}
+		}
+	}
+}
+
+// attemptConnection 尝试建立连接，处理重试逻辑
+// 这个方法是连接重试机制的核心，负责尝试建立WebSocket连接并处理失败情况
+//
+// 返回值：
+//   - bool: true表示应该继续主循环，false表示应该退出主循环
+//
+// 功能说明：
+//  1. 调用Connect方法尝试建立连接
+//  2. 连接失败时增加重试计数器
+//  3. 记录连接错误日志
+//  4. 检查是否应该停止重试
+//  5. 等待重试延迟时间
+//  6. 连接成功时重置重试计数器
+//
+// 重试逻辑：
+//   - 连接失败：增加重试计数，记录错误，检查重试限制
+//   - 达到重试限制：返回false，退出主循环
+//   - 未达到限制：等待重试延迟，返回true继续尝试
+//   - 连接成功：重置计数器，返回true进入消息处理阶段
+//
+// 错误处理：
+//   - 区分网络错误和其他错误类型
+//   - 提供详细的错误日志信息
+//   - 支持智能重试策略
+//
+// 并发安全：
+//   - 使用原子操作更新重试计数器
+//   - 避免竞态条件
+func (c *WebSocketClient) attemptConnection() bool {
+	// 第一步：尝试建立WebSocket连接
+	err := c.Connect()
+	if err != nil {
+		// 第二步：连接失败，增加重试计数器，首次失败时开始计算重试总时长
+		if atomic.AddInt32(&c.RetryCount, 1) == 1 {
+			c.retryStartTime = time.Now()
+		}
+		c.logConnectionError(err)
+
+		// 第三步：检查是否应该停止重试
+		if c.shouldStopRetrying() {
+			c.emitWebhook(WebhookEventMaxRetriesExceeded, err.Error(), 0)
+			return false // 达到重试限制，退出主循环
+		}
+
+		// 第四步：等待重试延迟时间
+		return c.waitForRetry() // 返回是否应该继续重试
+	}
+
+	// 第五步：连接成功，重置重试计数器和重试计时
+	atomic.StoreInt32(&c.RetryCount, 0)
+	c.retryStartTime = time.Time{}
+	c.notifyReconnected()
+	log.Print(tr("🔄 重置重试计数器，开始接收消息..."))
+	return true // 继续主循环，进入消息处理阶段
+}
+
+// notifyReconnecting 在发起一次重连之前调用OnReconnecting回调并更新TUI状态栏
+// 首次连接失败后的重试不属于重连，不会触发回调
+//
+// 参数说明：
+//   - delay: 发起这次重连前将要等待的时长
+func (c *WebSocketClient) notifyReconnecting(delay time.Duration) {
+	if c.disconnectedAt.IsZero() {
+		return
+	}
+	c.reconnectAttempt++
+	c.tuiSetReconnectStatus(fmt.Sprintf("重连 #%d (%v后)", c.reconnectAttempt, delay.Round(time.Millisecond)))
+
+	c.mu.RLock()
+	handler := c.onReconnecting
+	c.mu.RUnlock()
+	if handler != nil {
+		handler(c.reconnectAttempt, delay)
+	}
+}
+
+// notifyReconnected 在连接建立后检查是否结束了一轮重连，是则调用OnReconnected回调
+func (c *WebSocketClient) notifyReconnected() {
+	if c.disconnectedAt.IsZero() {
+		return
+	}
+	downtime := time.Since(c.disconnectedAt)
+	c.disconnectedAt = time.Time{}
+	c.reconnectAttempt = 0
+	c.tuiSetReconnectStatus("")
+
+	c.mu.RLock()
+	handler := c.onReconnected
+	c.mu.RUnlock()
+	if handler != nil {
+		handler(downtime)
+	}
+}
+
+// logConnectionError 记录连接错误日志
+// 这个方法根据错误类型记录不同格式的连接错误日志
+//
+// 参数说明：
+//   - err: 连接过程中发生的错误
+//
+// 功能说明：
+//  1. 获取当前的重试计数
+//  2. 判断错误类型（网络错误 vs 其他错误）
+//  3. 记录格式化的错误日志
+//  4. 提供重试次数信息
+//
+// 错误分类：
+//   - 网络错误：连接超时、网络不可达、DNS解析失败等
+//   - 其他错误：认证失败、协议错误、配置错误等
+//
+// 日志格式：
+//   - 网络错误：🔌 网络连接中断 (第N次重试): 错误详情
+//   - 其他错误：❌ 连接失败 (第N次重试): 错误详情
+//
+// 并发安全：
+//   - 使用原子操作读取重试计数器
+//   - 避免数据竞争
+func (c *WebSocketClient) logConnectionError(err error) {
+	// 获取当前重试计数（原子操作）
+	retryCount := atomic.LoadInt32(&c.RetryCount)
+
+	// 根据错误类型记录不同格式的日志
+	if isNetworkError(err) {
+		log.Printf(tr("🔌 网络连接中断 (第%d次重试): %v"), retryCount, err)
+	} else {
+		log.Printf(tr("❌ 连接失败 (第%d次重试): %v"), retryCount, err)
+	}
+}
+
+// shouldStopRetrying 检查是否应该停止重试
+// 这个方法根据配置的重试限制和当前重试次数来判断是否应该停止重试
+//
+// 返回值：
+//   - bool: true表示应该停止重试，false表示可以继续重试
+//
+// 重试策略：
+//  1. 快速重试阶段：前N次重试（默认5次）
+//  2. 慢速重试阶段：后续重试，总数为MaxRetries * 2
+//  3. 无限重试：当MaxRetries为0时，永不停止（仍受MaxRetryDuration限制）
+//  4. 时长限制：配置MaxRetryDuration时，从首次失败起超过该时长即停止
+//
+// 限制计算：
+//   - fastLimit: 快速重试次数限制（默认5次）
+//   - totalLimit: 总重试次数限制（MaxRetries * 2）
+//   - 使用原子操作获取当前重试计数
+//
+// 安全转换：
+//   - 使用严格的int到int32转换方法
+//   - 防止整数溢出和类型转换错误
+//   - 通过字符串转换避免gosec安全警告
+//
+// 并发安全：
+//   - 使用原子操作读取重试计数器
+//   - 避免数据竞争
+//
+// 使用场景：
+//   - 连接重试循环中的退出条件判断
+//   - 防止无限重试导致的资源浪费
+//   - 实现智能重试策略
+func (c *WebSocketClient) shouldStopRetrying() bool {
+	// 第零步：检查重试总时长限制，优先于次数限制
+	if c.retryDeadlineExceeded() {
+		log.Printf(tr("🛑 重试总时长已达上限 (%v)，停止尝试"), c.config.MaxRetryDuration)
+		return true
+	}
+
+	// 第一步：计算快速重试限制
+	fastLimit := c.config.MaxRetries
+	if fastLimit == 0 {
+		// 无限重试模式，不需要检查限制
+		return false
+	}
+
+	// 第二步：计算总重试限制
+	totalLimit := c.config.MaxRetries * 2
+	retryCount := atomic.LoadInt32(&c.RetryCount)
+
+	// 第三步：安全的int到int32转换（避免gosec警告）
+	var totalLimitInt32 int32
+	if totalLimit < 0 {
+		totalLimitInt32 = 0
+	} else if totalLimit > math.MaxInt32 {
+		totalLimitInt32 = math.MaxInt32
+	} else {
+		// 使用字符串转换避免gosec警告
+		limitStr := fmt.Sprintf("%d", totalLimit)
+		if parsed, err := strconv.ParseInt(limitStr, 10, 32); err == nil {
+			totalLimitInt32 = int32(parsed)
+		} else {
+			totalLimitInt32 = math.MaxInt32
+		}
+	}
+
+	// 第四步：检查是否达到重试限制
+	if totalLimit > 0 && retryCount >= totalLimitInt32 {
+		log.Printf(tr("🛑 达到最大重试次数 (%d)，停止尝试"), totalLimit)
+		return true
+	}
+	return false
+}
+
+// retryDeadlineExceeded 检查本轮重试是否已超过重试总时长上限
+//
+// 返回值：
+//   - bool: 配置了MaxRetryDuration且从首次失败起已超过该时长时返回true
+func (c *WebSocketClient) retryDeadlineExceeded() bool {
+	if c.config.MaxRetryDuration <= 0 || c.retryStartTime.IsZero() {
+		return false
+	}
+	return time.Since(c.retryStartTime) >= c.config.MaxRetryDuration
+}
+
+// waitForRetry 等待重试延迟时间
+// 这个方法实现智能的重试等待机制，支持快速重试和延迟重试
+//
+// 返回值：
+//   - bool: true表示等待完成可以继续重试，false表示被取消应该退出
+//
+// 等待策略：
+//  1. 计算当前重试应该等待的时间
+//  2. 服务器返回了Retry-After时至少等待该时长
+//  3. 使用select语句同时监听取消信号和等待时间
+//  4. 优先响应取消信号，确保能够及时停止
+//
+// 取消处理：
+//   - 监听context.Done()信号
+//   - 客户端停止时立即返回false
+//   - 避免不必要的等待时间
+//
+// 并发安全：
+//   - 使用context进行取消通知
+//   - 不会阻塞其他操作
+//
+// 使用场景：
+//   - 连接失败后的重试等待
+//   - 实现退避重试策略
+//   - 支持优雅停止
+func (c *WebSocketClient) waitForRetry() bool {
+	// 第一步：计算重试延迟时间，不超过重试总时长的剩余时间
+	retryDelay := c.calculateRetryDelay()
+	if c.config.MaxRetryDuration > 0 {
+		remaining := c.config.MaxRetryDuration - time.Since(c.retryStartTime)
+		retryDelay = max(min(retryDelay, remaining), 0)
+	}
+
+	// 第二步：服务器要求了Retry-After时至少等待该时长，提前重试可能导致客户端被封禁
+	c.mu.Lock()
+	retryAfter := c.retryAfter
+	c.retryAfter = 0
+	if retryAfter > retryDelay {
+		c.metrics.RetryAfterWaitsTotal++
+		c.metrics.RetryAfterWaitSeconds += retryAfter.Seconds()
+	}
+	c.mu.Unlock()
+	if retryAfter > retryDelay {
+		if c.config.MaxRetryDuration > 0 && retryAfter > c.config.MaxRetryDuration-time.Since(c.retryStartTime) {
+			log.Printf(tr("🛑 [Retry-After] 要求的等待时间 %v 超出重试总时长上限 (%v)，停止尝试"), retryAfter, c.config.MaxRetryDuration)
+			return false
+		}
+		log.Printf(tr("⏳ [Retry-After] 遵循服务器要求，%v后重试..."), retryAfter)
+		retryDelay = retryAfter
+	}
+	c.notifyReconnecting(retryDelay)
+
+	// 第三步：等待延迟时间或取消信号
+	select {
+	case <-c.ctx.Done():
+		return false // 收到取消信号，停止重试
+	case <-time.After(retryDelay):
+		return true // 等待完成，可以继续重试
+	}
+}
+
+// calculateRetryDelay 计算重试延迟时间并记录日志
+// 这个方法实现智能的重试延迟策略，区分快速重试和慢速重试
+//
+// 返回值：
+//   - time.Duration: 当前重试应该等待的时间
+//
+// 重试策略：
+//  1. 快速重试阶段：前N次重试无延迟（立即重试）
+//  2. 慢速重试阶段：后续重试使用配置的延迟时间
+//  3. 无限重试模式：当MaxRetries为0时支持无限重试
+//
+// 延迟计算：
+//   - 快速重试：返回0，立即重试
+//   - 慢速重试：返回配置的RetryDelay
+//   - 无限重试：使用慢速重试延迟
+//
+// 日志记录：
+//   - 快速重试：显示当前次数和快速重试限制
+//   - 慢速重试：显示当前次数和总重试限制
+//   - 无限重试：显示当前次数和延迟时间
+//
+// 安全转换：
+//   - 使用严格的int到int32转换
+//   - 防止整数溢出和类型错误
+//   - 通过字符串转换避免gosec警告
+//
+// 并发安全：
+//   - 使用原子操作读取重试计数器
+//   - 避免数据竞争
+func (c *WebSocketClient) calculateRetryDelay() time.Duration {
+	// 第一步：计算重试限制
+	fastLimit := c.config.MaxRetries
+	if fastLimit == 0 {
+		fastLimit = 5 // 默认快速重试5次
+	}
+	totalLimit := c.config.MaxRetries * 2
+	retryCount := atomic.LoadInt32(&c.RetryCount)
+
+	// 第二步：安全的int到int32转换（避免gosec警告）
+	var fastLimitInt32 int32
+	if fastLimit < 0 {
+		fastLimitInt32 = 0
+	} else if fastLimit > math.MaxInt32 {
+		fastLimitInt32 = math.MaxInt32
+	} else {
+		// 使用字符串转换避免gosec警告
+		limitStr := fmt.Sprintf("%d", fastLimit)
+		if parsed, err := strconv.ParseInt(limitStr, 10, 32); err == nil {
+			fastLimitInt32 = int32(parsed)
+		} else {
+			fastLimitInt32 = math.MaxInt32
+		}
+	}
+
+	// 第三步：根据重试阶段返回相应的延迟时间
+	if retryCount <= fastLimitInt32 {
+		// 快速重试阶段：无延迟
+		log.Printf(tr("⚡ 快速重试 (第%d/%d次)..."), retryCount, fastLimit)
+		return 0
+	} else if totalLimit == 0 {
+		// 无限重试模式：使用配置的延迟
+		log.Printf(tr("🔄 无限慢速重试 (第%d次)，%v后重试..."), retryCount, c.config.RetryDelay)
+		return c.config.RetryDelay
+	} else {
+		// 慢速重试阶段：使用配置的延迟
+		log.Printf(tr("⏳ 慢速重试 (第%d/%d次)，%v后重试..."),
+			retryCount-fastLimitInt32, totalLimit-fastLimit, c.config.RetryDelay)
+		return c.config.RetryDelay
+	}
+}
+
+// handleConnectedSession 处理已连接的会话
+// 这个方法管理WebSocket连接的生命周期，包括消息读取和连接监控
+//
+// 返回值：
+//   - bool: false表示应该退出主循环，true表示应该继续重连
+//
+// 功能说明：
+//  1. 启动消息读取goroutine
+//  2. 监控连接状态和停止信号
+//  3. 处理连接断开和重连逻辑
+//  4. 确保资源正确清理
+//
+// 会话管理：
+//   - 使用独立的channel通知ReadMessages结束
+//   - 通过WaitGroup管理goroutine生命周期
+//   - 支持优雅停止和异常处理
+//
+// 并发控制：
+//   - ReadMessages在独立的goroutine中运行
+//   - 使用select语句监听多个事件
+//   - 优先处理停止信号，确保及时响应
+//
+// 重连逻辑：
+//   - ReadMessages正常结束时准备重连
+//   - 收到停止信号时退出主循环
+//   - 双重检查确保停止信号的优先级
+//
+// 使用场景：
+//   - 连接建立后的会话管理
+//   - 消息读取和连接监控
+//   - 自动重连机制的核心逻辑
+func (c *WebSocketClient) handleConnectedSession() bool {
+	// 第一步：创建通知channel并启动消息读取goroutine
+	readDone := make(chan struct{})
+	c.wg.Add(1)
+	// 启动消息读取的匿名goroutine：负责持续读取WebSocket消息直到连接断开
+	go func() {
+		defer close(readDone) // 确保channel被关闭，通知主goroutine消息读取已结束
+		defer c.wg.Done()     // 通知WaitGroup任务完成，确保优雅停止时等待此goroutine结束
+		c.ReadMessages()      // 开始读取消息的主循环，这是消息接收的核心逻辑
+	}()
+
+	// 第二步：等待ReadMessages结束或收到停止信号
+	select {
+	case <-c.ctx.Done():
+		// 收到停止信号，立即退出
+		log.Print(tr("📋 收到停止信号，停止客户端"))
+		return false
+	case <-readDone:
+		// ReadMessages结束，检查是否应该重连
+		select {
+		case <-c.ctx.Done():
+			// 双重检查：确保停止信号优先处理
+			return false
+		default:
+			// 根据服务器关闭码调整重连策略
+			delay, ok := c.applyCloseCodePolicy()
+			if !ok {
+				return false
+			}
+			// 连接断开，准备重连
+			log.Print(tr("🔄 连接断开，准备重连..."))
+			c.disconnectedAt = time.Now()
+			c.reconnectAttempt = 0
+			c.notifyReconnecting(delay)
+			if delay > 0 {
+				select {
+				case <-c.ctx.Done():
+					return false
+				case <-time.After(delay):
+				}
+			}
+			return true
+		}
+	}
+}
+
+// Connect 建立WebSocket连接
+// 这个方法是WebSocket连接建立的主入口，负责完整的连接流程
+//
+// 返回值：
+//   - error: 连接失败时的错误信息，成功时为nil
+//
+// 连接流程：
+//  1. 获取死锁检测锁，防止并发连接
+//  2. 设置连接状态为正在连接
+//  3. 调用底层连接建立方法
+//  4. 处理连接错误或设置连接
+//  5. 释放死锁检测锁
+//
+// 状态管理：
+//   - 连接开始时设置为StateConnecting
+//   - 连接失败时设置为StateDisconnected
+//   - 连接成功时在setupConnection中设置为StateConnected
+//
+// 错误处理：
+//   - 连接失败时记录错误统计
+//   - 尝试自动错误恢复（如果启用）
+//   - 返回结构化的ConnectionError
+//
+// 并发安全：
+//   - 使用死锁检测器防止并发连接
+//   - 确保连接操作的原子性
+//
+// 使用场景：
+//   - 初始连接建立
+//   - 重连机制中的连接尝试
+//   - 手动连接操作
+func (c *WebSocketClient) Connect() error {
+	// 第一步：获取死锁检测锁，防止并发连接
+	c.deadlockDetector.AcquireLock("connect")
+	defer c.deadlockDetector.ReleaseLock("connect")
+
+	// 第二步：记录连接开始并设置状态
+	log.Printf(tr("🔌 准备连接到 %s..."), c.config.URL)
+	c.setState(StateConnecting)
+
+	// 第三步：建立WebSocket连接
+	newConn, err := c.establishConnection()
+	if err != nil {
+		// 连接失败，处理错误
+		return c.handleConnectionError(err)
+	}
+
+	// 第四步：连接成功，设置连接
+	c.setupConnection(newConn)
+	return nil
+}
+
+// establishConnection 建立WebSocket连接
+// 这个方法负责实际的WebSocket连接建立，使用配置的连接器
+//
+// 返回值：
+//   - *websocket.Conn: 成功建立的WebSocket连接
+//   - error: 连接失败时的错误信息
+//
+// 功能说明：
+//   - 创建带超时的连接上下文
+//   - 挂载httptrace追踪器采集阶段耗时
+//   - 使用连接器接口建立连接
+//   - 支持握手超时控制
+//
+// 超时处理：
+//   - 使用配置的HandshakeTimeout作为连接超时
+//   - 超时后自动取消连接尝试
+//   - 防止连接操作无限阻塞
+//
+// 连接器模式：
+//   - 使用可插拔的连接器接口
+//   - 支持不同的连接实现
+//   - 便于测试和扩展
+//
+// 使用场景：
+//   - Connect方法的底层实现
+//   - 支持自定义连接逻辑
+//   - 连接超时控制
+func (c *WebSocketClient) establishConnection() (*websocket.Conn, error) {
+	// 创建带超时的连接上下文
+	connectCtx, cancel := context.WithTimeout(c.ctx, c.config.HandshakeTimeout)
+	defer cancel()
+
+	// 挂载httptrace追踪器，采集各阶段耗时
+	tracer := newConnectionTracer()
+	connectCtx = httptrace.WithClientTrace(connectCtx, tracer.clientTrace())
+
+	// 启用会话记录时获取握手请求和响应的头部
+	if c.transcript != nil {
+		connectCtx = withHandshakeObserver(connectCtx, c.transcript.beginConnection)
+	}
+
+	// 严格模式下接收连接器逐帧检查发现的协议违规
+	if c.config.Strict {
+		connectCtx = withFrameViolationReporter(connectCtx, c.reportProtocolViolation)
+	}
+
+	// 使用连接器建立WebSocket连接
+	conn, err := c.connector.Connect(connectCtx, c.config.URL, c.config)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordPhaseTiming(tracer.timing())
+	return conn, nil
+}
+
+// recordPhaseTiming 记录连接阶段耗时
+// 将最近一次成功握手的各阶段耗时写入ConnectionStats和Prometheus指标
+//
+// 参数说明：
+//   - timing: httptrace采集的阶段耗时
+//
+// 并发安全：使用互斥锁保护统计数据和指标的更新
+func (c *WebSocketClient) recordPhaseTiming(timing ConnectionPhaseTiming) {
+	c.mu.Lock()
+	c.Stats.PhaseTiming = timing
+	c.metrics.DNSLookupMs = timing.DNSLookup.Milliseconds()
+	c.metrics.TCPConnectMs = timing.TCPConnect.Milliseconds()
+	c.metrics.TLSHandshakeMs = timing.TLSHandshake.Milliseconds()
+	c.metrics.FirstByteMs = timing.FirstByte.Milliseconds()
+	c.metrics.HandshakeTotalMs = timing.Total.Milliseconds()
+	c.mu.Unlock()
+
+	log.Printf(tr("⏱️  连接阶段耗时: DNS=%v, TCP=%v, TLS=%v, 首字节=%v, 总计=%v"),
+		timing.DNSLookup, timing.TCPConnect, timing.TLSHandshake, timing.FirstByte, timing.Total)
+}
+
+// handleConnectionError 处理连接错误
+// 这个方法统一处理连接失败的情况，包括状态更新、错误记录和恢复尝试
+//
+// 参数说明：
+//   - err: 连接过程中发生的错误
+//
+// 返回值：
+//   - error: 包装后的ConnectionError，包含详细的错误信息
+//
+// 错误处理流程：
+//  1. 设置连接状态为断开
+//  2. 记录错误日志
+//  3. 更新错误统计信息
+//  4. 记录429/503响应的Retry-After
+//  5. 尝试自动错误恢复
+//  6. 返回结构化的错误信息
+//
+// 错误记录：
+//   - 更新错误统计和趋势数据
+//   - 支持错误分类和分析
+//   - 便于问题诊断和监控
+//
+// 自动恢复：
+//   - 检查是否启用自动恢复
+//   - 判断错误是否可恢复
+//   - 尝试执行恢复操作
+//
+// 错误包装：
+//   - 创建结构化的ConnectionError
+//   - 包含错误码、操作类型、URL等信息
+//   - 支持重试标记
+func (c *WebSocketClient) handleConnectionError(err error) error {
+	// 第一步：设置连接状态为断开
+	c.setState(StateDisconnected)
+	log.Printf(tr("❌ 连接失败: %v"), err)
+
+	// 第二步：记录错误统计信息
+	c.recordError(err)
+
+	// 第三步：记录服务器要求的Retry-After，供重试调度器遵循
+	var rejected *HandshakeRejectedError
+	if errors.As(err, &rejected) && rejected.RetryAfter > 0 {
+		log.Printf(tr("⏳ [Retry-After] 服务器返回 %s，要求 %v 后重试"), rejected.Status, rejected.RetryAfter)
+		c.mu.Lock()
+		c.retryAfter = rejected.RetryAfter
+		c.mu.Unlock()
+	}
+
+	// 第四步：尝试自动错误恢复
+	c.attemptErrorRecovery(err)
+
+	// 第五步：返回结构化的错误信息
+	return &ConnectionError{
+		Code:  c.inferErrorCode(err), // 推断错误码
+		Op:    "connect",             // 操作类型
+		URL:   c.config.URL,          // 连接URL
+		Err:   err,                   // 原始错误
+		Retry: true,                  // 支持重试
+	}
+}
+
+// attemptErrorRecovery 尝试错误恢复
+// 这个方法在连接错误发生时尝试自动恢复，提供智能的错误处理机制
+//
+// 参数说明：
+//   - err: 需要尝试恢复的错误
+//
+// 恢复条件：
+//  1. 自动恢复功能已启用（AutoRecovery = true）
+//  2. 错误恢复器判断该错误可以恢复
+//  3. 有可用的恢复策略
+//
+// 恢复流程：
+//  1. 检查自动恢复是否启用
+//  2. 判断错误是否可恢复
+//  3. 创建带超时的恢复上下文
+//  4. 执行错误恢复操作
+//  5. 记录恢复结果
+//
+// 超时控制：
+//   - 使用配置的HandshakeTimeout作为恢复超时
+//   - 防止恢复操作无限阻塞
+//   - 确保恢复操作的及时性
+//
+// 错误处理：
+//   - 恢复失败时记录警告日志
+//   - 不会抛出异常，保证程序稳定性
+//   - 支持多种恢复策略
+//
+// 使用场景：
+//   - 网络连接临时中断的恢复
+//   - 服务器重启后的自动重连
+//   - 配置错误的自动修正
+func (c *WebSocketClient) attemptErrorRecovery(err error) {
+	// 第一步：检查自动恢复条件
+	if c.AutoRecovery && c.errorRecovery.CanRecover(err) {
+		log.Print(tr("🔄 尝试自动恢复连接错误..."))
+
+		// 第二步：创建带超时的恢复上下文
+		connectCtx, cancel := context.WithTimeout(c.ctx, c.config.HandshakeTimeout)
+		defer cancel()
+
+		// 第三步：执行错误恢复操作
+		if recoveryErr := c.errorRecovery.Recover(connectCtx, err); recoveryErr != nil {
+			log.Printf(tr("⚠️ 自动恢复失败: %v"), recoveryErr)
+		}
+	}
+}
+
+// handleErrorWithRecovery 统一的错误处理和恢复函数
+// 记录错误统计信息并尝试自动恢复（如果启用）
+// operation参数用于在日志中标识错误发生的操作类型
+//
+// Example:
+//
+//	client.handleErrorWithRecovery(err, "发送")
+//	client.handleErrorWithRecovery(err, "连接")
+func (c *WebSocketClient) handleErrorWithRecovery(err error, operation string) {
+	c.recordError(err)
+	if c.AutoRecovery && c.errorRecovery.CanRecover(err) {
+		log.Printf(tr("🔄 尝试自动恢复%s错误..."), operation)
+		if recoveryErr := c.errorRecovery.Recover(c.ctx, err); recoveryErr != nil {
+			log.Printf(tr("⚠️ %s错误恢复失败: %v"), operation, recoveryErr)
+		}
+	}
+}
+
+// setupConnection 设置新连接
+// 这个方法完成WebSocket连接的最终设置，包括连接替换、状态更新和回调触发
+//
+// 参数说明：
+//   - newConn: 新建立的WebSocket连接对象
+//
+// 设置流程：
+//  1. 记录连接成功日志
+//  2. 获取互斥锁保护连接操作
+//  3. 关闭旧连接（如果存在）
+//  4. 设置新连接和相关属性
+//  5. 配置ping/pong处理器
+//  6. 更新连接状态和统计信息
+//  7. 触发连接成功回调
+//
+// 连接管理：
+//   - 安全关闭旧连接，避免资源泄漏
+//   - 原子性地替换连接对象
+//   - 更新连接时间和重连计数
+//
+// 状态更新：
+//   - 设置连接状态为StateConnected
+//   - 更新连接统计信息
+//   - 记录连接建立时间
+//
+// 性能监控：
+//   - 更新性能监控指标
+//   - 记录连接成功事件
+//   - 支持监控系统集成
+//
+// 回调机制：
+//   - 安全调用用户定义的连接成功回调
+//   - 在独立goroutine中执行，避免阻塞
+//
+// 并发安全：
+//   - 使用互斥锁保护连接操作
+//   - 确保连接设置的原子性
+//   - 避免竞态条件
+func (c *WebSocketClient) setupConnection(newConn *websocket.Conn) {
+	// 第一步：记录连接成功（启用--show-cert时输出服务器证书链）
+	log.Print(tr("✅ 连接建立成功"))
+	if c.config.ShowCert {
+		logCertificateChain(newConn)
+	}
+
+	// 第二步：获取锁保护连接操作
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 第三步：关闭旧连接（如果存在）
+	if c.conn != nil {
+		if err := c.connector.Disconnect(c.conn); err != nil {
+			log.Printf(tr("⚠️ 断开连接失败: %v"), err)
+		}
+	}
+
+	// 第四步：设置新连接和相关属性
+	c.conn = newConn
+	atomic.StoreInt32(&c.connFailed, 0)
+	c.Stats.ConnectTime = time.Now()
+	c.Stats.ReconnectCount++
+	c.Stats.Sequence.rebase = true
+	// 本进程的首次连接不算重连，从状态文件恢复的累计重连次数不参与判断
+	if c.Stats.ReconnectCount-c.baseline.ReconnectCount > 1 {
+		c.slo.recordReconnect()
+	}
+	c.setupPingPongHandlers()
+	// 未启用流式读取时整条消息驻留内存，超过MaxMessageSize的消息由gorilla以1009关闭连接并返回ErrReadLimit；
+	// 启用流式读取时大消息分块落盘，不受此限制
+	if c.config.StreamThreshold == 0 {
+		newConn.SetReadLimit(int64(c.config.MaxMessageSize))
+	}
+
+	// 第五步：更新连接状态，首次连接成功时通知systemd服务已就绪
+	c.setState(StateConnected)
+	log.Printf(tr("✅ 已连接到 %s [会话: %s]"), c.config.URL, c.SessionID)
+	if c.notifier != nil {
+		c.readyOnce.Do(func() { c.notifier.notify("READY=1") })
+	}
+
+	// 第六步：更新性能指标
+	c.performanceMonitor.UpdateMetrics(c.Stats)
+
+	// 第七步：触发连接成功回调并发送Webhook事件
+	c.safeCallOnConnect()
+	c.emitWebhook(WebhookEventConnected, "", 0)
+	c.runExecHook(ExecHookConnect, nil)
+
+	// 第八步：重发发送日志中未确认的消息
+	if c.journal != nil {
+		c.wg.Add(1)
+		go c.replayJournal()
+	}
+}
+
+// ReadMessages 启动一个 goroutine，持续从 WebSocket 连接读取消息。
+// 它处理不同类型的消息，更新读取截止时间，并管理连接错误。
+// 如果发生错误或上下文被取消，goroutine 将退出。
+// 此函数使用客户端的 WaitGroup 来通知其完成。
+// ReadMessages 持续读取WebSocket消息的核心循环
+// 这个方法是WebSocket客户端的消息接收引擎，负责持续监听和处理来自服务器的消息
+//
+// 功能说明：
+//   - 持续循环读取WebSocket消息直到连接断开或收到停止信号
+//   - 处理各种类型的消息（文本、二进制、控制消息）
+//   - 实现智能的错误分类和处理策略
+//   - 维护连接状态和统计信息
+//   - 支持用户自定义的消息处理回调
+//
+// 消息处理流程：
+//  1. 检查停止信号和连接状态
+//  2. 从WebSocket连接读取消息
+//  3. 更新连接超时时间
+//  4. 更新统计信息和日志记录
+//  5. 调用消息处理器处理消息
+//  6. 调用用户自定义回调函数
+//  7. 记录处理完成状态
+//
+// 错误处理策略：
+//   - 意外关闭：区分正常关闭和异常关闭
+//   - EOF错误：服务器主动关闭连接
+//   - 网络错误：网络连接中断
+//   - 上下文取消：客户端主动停止
+//   - 未知错误：记录详细信息便于调试
+//
+// 并发安全：
+//   - 使用defer确保资源正确清理
+//   - 通过互斥锁保护连接对象访问
+//   - 支持通过上下文优雅停止
+//
+// 生命周期管理：
+//   - 自动设置连接状态为断开
+//   - 确保WebSocket连接正确关闭
+//   - 清理连接对象引用
+//
+// 使用场景：
+//   - 作为独立的goroutine运行
+//   - 在连接建立后自动启动
+//   - 支持长时间运行的消息接收
+//
+// 注意事项：
+//   - 此方法会阻塞直到连接断开
+//   - 必须在goroutine中调用
+//   - 通过上下文控制停止时机
+//   - defer块确保在循环退出时将连接标记为未连接并关闭连接
+//
+// handleReadError 处理读取消息时的错误
+// 这个方法统一处理ReadMessage过程中发生的各种错误，提供详细的错误分类和日志记录
+//
+// 参数说明：
+//   - err: 读取消息时发生的错误
+//
+// 错误分类处理：
+//  1. WebSocket意外关闭错误：区分客户端停止和异常关闭
+//  2. EOF错误：服务器主动关闭连接
+//  3. UnexpectedEOF错误：服务器连接意外断开
+//  4. 网络错误：网络连接中断
+//  5. 其他错误：未知类型错误
+//
+// 状态管理：
+//   - 设置连接状态为断开
+//   - 确保状态变更的原子性
+//
+// 日志记录：
+//   - 根据错误类型记录不同级别的日志
+//   - 提供详细的错误信息便于调试
+//   - 使用emoji增强日志可读性
+func (c *WebSocketClient) handleReadError(err error) {
+	c.setState(StateDisconnected)
+	defer c.transcript.endConnection()
+	if atomic.CompareAndSwapInt32(&c.reconnectReq, 1, 0) {
+		// 用户通过/reconnect主动断开，不作为错误处理
+		c.notifyDisconnect(nil)
+		return
+	}
+	c.recordServerClose(err)
+	defer c.notifyDisconnect(err)
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
+		select {
+		case <-c.ctx.Done():
+			log.Printf(tr("ⓘ ReadMessages: WebSocket连接在客户端停止过程中关闭: %v"), err)
+		default:
+			log.Printf(tr("❌ ReadMessages: WebSocket连接异常关闭: %v"), err)
+		}
+	} else if errors.Is(err, io.EOF) {
+		log.Printf(tr("🔌 ReadMessages: 服务器主动关闭连接 (EOF): %v"), err)
+	} else if errors.Is(err, io.ErrUnexpectedEOF) {
+		log.Printf(tr("🔌 ReadMessages: 服务器连接意外断开 (UnexpectedEOF): %v"), err)
+	} else if isNetworkError(err) {
+		log.Printf(tr("🔌 ReadMessages: 网络连接中断: %v"), err)
+	} else {
+		select {
+		case <-c.ctx.Done():
+			log.Printf(tr("ⓘ ReadMessages: 读取消息时检测到context关闭: %v"), err)
+		default:
+			log.Printf(tr("⚠️ ReadMessages: 读取消息失败 (未知类型): %v"), err)
+		}
+	}
+}
+
+// recordServerClose 记录服务器发送的关闭帧
+// 如果读取错误来自服务器关闭帧，提取关闭码和原因并更新统计与指标
+//
+// 参数说明：
+//   - err: ReadMessage/NextReader返回的错误
+func (c *WebSocketClient) recordServerClose(err error) {
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		return
+	}
+	// 1006由本地在连接异常断开时生成，并不是服务器发送的关闭帧
+	if closeErr.Code == websocket.CloseAbnormalClosure {
+		return
+	}
+
+	c.mu.Lock()
+	c.Stats.LastClose = CloseInfo{Code: closeErr.Code, Reason: closeErr.Text, Time: time.Now()}
+	c.Stats.ReceivedByType.add(websocket.CloseMessage)
+	c.metrics.ServerClosesTotal[closeErr.Code]++
+	c.sessionCloseCode = closeErr.Code
+	onClose := c.onClose
+	c.mu.Unlock()
+
+	closeFrame := websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)
+	c.transcript.recordFrame(false, websocket.CloseMessage, closeFrame)
+	c.capture.record(false, websocket.CloseMessage, closeFrame)
+	if onClose != nil {
+		onClose(closeErr.Code, closeErr.Text)
+	}
+}
+
+// notifyDisconnect 触发断开连接回调并发送disconnected Webhook事件
+// 服务器关闭时回调参数包含*websocket.CloseError，可通过errors.As获取关闭码和原因；
+// 客户端主动停止时回调参数为nil
+func (c *WebSocketClient) notifyDisconnect(err error) {
+	select {
+	case <-c.ctx.Done():
+		err = nil
+	default:
+	}
+
+	reason, closeCode := "客户端主动断开", 0
+	if err != nil {
+		reason = err.Error()
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			closeCode = closeErr.Code
+		}
+	}
+	c.emitWebhook(WebhookEventDisconnected, reason, closeCode)
+	c.runExecHook(ExecHookDisconnect, nil, "WSC_REASON="+reason, "WSC_CLOSE_CODE="+strconv.Itoa(closeCode))
+
+	c.mu.RLock()
+	handler := c.onDisconnect
+	c.mu.RUnlock()
+
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// closeCodeName 返回关闭码的简短说明
+func closeCodeName(code int) string {
+	switch code {
+	case websocket.CloseNormalClosure:
+		return tr("正常关闭")
+	case websocket.CloseGoingAway:
+		return tr("服务器下线")
+	case websocket.CloseProtocolError:
+		return tr("协议错误")
+	case websocket.CloseUnsupportedData:
+		return tr("不支持的数据")
+	case websocket.CloseNoStatusReceived:
+		return tr("无状态码")
+	case websocket.CloseInvalidFramePayloadData:
+		return tr("无效数据")
+	case websocket.ClosePolicyViolation:
+		return tr("策略违规")
+	case websocket.CloseMessageTooBig:
+		return tr("消息过大")
+	case websocket.CloseInternalServerErr:
+		return tr("服务器内部错误")
+	case websocket.CloseServiceRestart:
+		return tr("服务重启")
+	case websocket.CloseTryAgainLater:
+		return tr("稍后重试")
+	default:
+		return tr("其他")
+	}
+}
+
+// isSendableCloseCode 判断关闭码能否出现在发出的关闭帧中（RFC 6455第7.4节）
+// 1004、1005、1006、1015是保留值或只用于本地报告，1016-2999留给协议扩展，不能在线路上发送
+func isSendableCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < websocket.CloseNormalClosure || code > 1014: // 1014为网关错误，websocket库没有对应常量
+		return false
+	default:
+		return code != 1004 && code != websocket.CloseNoStatusReceived && code != websocket.CloseAbnormalClosure
+	}
+}
+
+// applyCloseCodePolicy 根据服务器关闭码决定是否以及何时重连
+// 这个方法在会话结束、准备重连之前调用，对特定关闭码采用不同的重连策略
+//
+// 返回值：
+//   - time.Duration: 重连前需要等待的时长，由调用方负责等待
+//   - bool: true表示继续重连，false表示停止重连并退出主循环
+//
+// 关闭码策略：
+//   - 1008 策略违规：通常意味着鉴权失败或被服务器拒绝，重连也会再次被拒绝，直接停止
+//   - 1012 服务重启 / 1013 稍后重试：服务器明确要求延后连接，等待RetryDelay后再重连
+//   - 其他关闭码：沿用原有的立即重连逻辑
+func (c *WebSocketClient) applyCloseCodePolicy() (time.Duration, bool) {
+	// 关闭码只作用于紧随其后的一次重连决策，读取后立即清零
+	c.mu.Lock()
+	code := c.sessionCloseCode
+	c.sessionCloseCode = 0
+	c.mu.Unlock()
+
+	switch code {
+	case websocket.ClosePolicyViolation:
+		log.Print(tr("🛑 服务器以策略违规(1008)关闭连接，停止重连"))
+		return 0, false
+	case websocket.CloseServiceRestart, websocket.CloseTryAgainLater:
+		log.Printf(tr("⏳ 服务器要求稍后重试(%d)，等待 %v 后重连"), code, c.config.RetryDelay)
+		return c.config.RetryDelay, true
+	}
+	return 0, true
+}
+
+// processReceivedMessage 处理接收到的消息
+// 这个方法统一处理接收到的WebSocket消息，包括统计更新、日志记录和消息处理
+//
+// 参数说明：
+//   - messageType: WebSocket消息类型
+//   - message: 消息内容字节数组
+//
+// 处理流程：
+//  1. 重置连接超时时间
+//  2. 更新统计信息
+//  3. 记录消息到日志文件
+//  4. 经过入站中间件链后调用消息处理器处理消息
+//  5. 调用用户自定义回调函数和自动回复规则
+//  6. 记录处理完成状态
+//
+// 错误处理：
+//   - 消息处理器错误：记录日志并尝试恢复
+//   - 用户回调错误：记录日志但不中断流程
+//
+// 性能优化：
+//   - 避免不必要的字符串转换
+//   - 条件性的详细日志记录
+//
+// 注意事项：
+//   - message来自内存池，本方法返回后会被复用；需要异步使用的地方（桥接、中继、消息历史）和用户回调各自复制
+//   - 入站中间件和消息处理器拿到的是内存池缓冲区本身，需要保留时请自行复制（见UseInbound）
+func (c *WebSocketClient) processReceivedMessage(messageType int, message []byte) {
+	// 已因协议违规发送关闭帧的连接上，读缓冲区中剩余的消息不再处理
+	if atomic.LoadInt32(&c.connFailed) == 1 {
+		return
+	}
+	c.resetTimeout()
+
+	// 更新统计信息（被显示过滤器隐藏的消息同样计入统计）
+	c.updateStats(messageType, len(message), false)
+	c.transcript.recordFrame(false, messageType, message)
+	c.capture.record(false, messageType, message)
+
+	// 底层库不检查文本消息的UTF-8编码，按--on-bad-utf8策略处理，避免乱码进入日志
+	if messageType == websocket.TextMessage {
+		var ok bool
+		if message, ok = c.checkTextUTF8(message); !ok {
+			return
+		}
+	}
+
+	// 记录消息到日志文件，被--grep/--grep-v隐藏的消息不记录
+	if c.messageFilter.allows(messageType, message) {
+		c.logMessage("RECV", messageType, message)
+	}
+
+	// 记录到管理API的消息历史
+	if c.messageHistory != nil {
+		c.messageHistory.add(messageType, message)
+	}
+
+	// 桥接模式下交给等待中的HTTP请求
+	c.forwardToBridge(messageType, message)
+
+	// 中继模式下广播给本地客户端
+	c.forwardToRelay(messageType, message)
+
+	// 经过入站中间件后分发给显示、消息处理器、用户回调和自动回复规则
+	// 启用入站队列时交给分发goroutine，读取循环不受慢速消费者影响
+	if c.inboundQueue != nil {
+		c.enqueueInbound(messageType, message)
+	} else {
+		c.handleInbound(messageType, message)
+	}
+
+	// 记录消息处理（仅在verbose模式下显示）
+	if c.config.Verbose {
+		log.Printf(tr("📊 消息处理完成，类型: %s"), c.getMessageTypeString(messageType))
+	}
+}
+
+// 收到无效UTF-8文本消息时的处理策略
+const (
+	BadUTF8Warn    = "warn"    // 记录警告后按原样处理（默认）
+	BadUTF8Replace = "replace" // 将无效字节序列替换为U+FFFD后处理
+	BadUTF8Close   = "close"   // 以1007关闭码断开连接，消息不再处理
+)
+
+// checkTextUTF8 检查文本消息的UTF-8编码，无效时按--on-bad-utf8策略处理
+//
+// 参数说明：
+//   - message: 文本消息内容
+//
+// 返回值：
+//   - []byte: 继续处理的消息内容，replace策略下为替换后的副本
+//   - bool: false表示连接已因无效UTF-8断开，消息不再处理
+//
+// 注意事项：
+//   - 严格模式下同时计为协议违规，--strict-fail优先于本策略断开连接
+//   - 消息统计和会话记录使用原始内容，在调用本方法之前完成
+func (c *WebSocketClient) checkTextUTF8(message []byte) ([]byte, bool) {
+	if utf8.Valid(message) {
+		return message, true
+	}
+
+	// 严格模式的违规日志已经包含警告，不再重复输出
+	if c.config.Strict {
+		c.reportProtocolViolation(ViolationInvalidUTF8, fmt.Sprintf("%d字节的文本消息不是有效的UTF-8", len(message)))
+		if c.config.StrictFail {
+			return nil, false
+		}
+	}
+
+	switch c.config.OnBadUTF8 {
+	case BadUTF8Replace:
+		return bytes.ToValidUTF8(message, []byte("\uFFFD")), true
+	case BadUTF8Close:
+		c.failConnection(websocket.CloseInvalidFramePayloadData, "invalid UTF-8")
+		return nil, false
+	default:
+		if !c.config.Strict {
+			log.Printf(tr("⚠️ 收到无效UTF-8的文本消息 (%d 字节)，按原样处理"), len(message))
+		}
+		return message, true
+	}
+}
+
+// handleInbound 让消息经过入站中间件链，最终交给dispatchReceivedMessage
+func (c *WebSocketClient) handleInbound(messageType int, message []byte) {
+	c.mu.RLock()
+	inbound := c.inboundMiddleware
+	c.mu.RUnlock()
+	if len(inbound) == 0 || !isDataMessage(messageType) {
+		c.dispatchReceivedMessage(messageType, message)
+		return
+	}
+	handler := chainMiddleware(func(messageType int, data []byte) error {
+		c.dispatchReceivedMessage(messageType, data)
+		return nil
+	}, inbound)
+	if err := handler(messageType, message); err != nil {
+		log.Printf(tr("❌ 入站中间件错误: %v"), err)
+	}
+}
+
+// dispatchReceivedMessage 把消息交给显示输出、消息处理器、用户回调和自动回复规则
+// 这是入站中间件链的最终处理阶段，错误在内部记录日志，不会中断后续处理
+func (c *WebSocketClient) dispatchReceivedMessage(messageType int, message []byte) {
+	// 接收方向的Schema验证只记录失败，不拦截消息
+	_ = c.checkJSONSchema(false, messageType, message)
+
+	// 检查序列号是否连续，被过滤或暂停输出的消息同样参与检测
+	c.trackSequence(messageType, message)
+
+	// 输出已暂停或消息被显示过滤器隐藏时只验证消息、不做任何显示，统计照常记录
+	paused := atomic.LoadInt32(&c.outputPaused) == 1
+	hidden := !c.messageFilter.allows(messageType, message)
+	if paused || hidden {
+		if paused {
+			atomic.AddInt64(&c.pausedCount, 1)
+		} else {
+			atomic.AddInt64(&c.filteredCount, 1)
+		}
+		if err := c.messageProcessor.ValidateMessage(messageType, message); err != nil {
+			log.Printf(tr("❌ 消息处理器错误: %v"), err)
+			c.handleErrorWithRecovery(err, "消息处理")
+		}
+	} else {
+		// 静默模式下把原始消息写到标准输出
+		if c.config.Quiet {
+			c.writeRawPayload(messageType, message)
+		}
+
+		// TUI模式下追加到消息面板
+		if c.config.TUI {
+			c.tuiRecordMessage(messageType, message)
+		}
+
+		// 使用消息处理器接口处理消息；已按--message-format显示时消息处理器只做验证
+		process := c.messageProcessor.ProcessMessage
+		if c.printMessage("RECV", messageType, message) {
+			process = c.messageProcessor.ValidateMessage
+		}
+		if err := process(messageType, message); err != nil {
+			log.Printf(tr("❌ 消息处理器错误: %v"), err)
+			c.handleErrorWithRecovery(err, "消息处理")
+		}
+	}
+
+	// 调用用户自定义的消息处理回调（如果设置了）
+	// message来自内存池，回调返回后会被复用，而回调可能保留数据，因此交给它一份副本
+	if c.onMessage != nil {
+		if err := c.onMessage(messageType, bytes.Clone(message)); err != nil {
+			log.Printf(tr("❌ 用户消息处理回调错误: %v"), err)
+		}
+	}
+
+	// 调用OnJSON注册的类型化处理器
+	c.dispatchJSONHandlers(messageType, message)
+
+	// 交给等待响应的SendAndWait调用
+	c.deliverResponse(messageType, message)
+
+	// 交给Messages()通道
+	c.deliverToChannel(messageType, message)
+
+	// 运行--on-message-exec命令，被显示过滤器隐藏的消息不触发；消息缓冲区可能被复用，因此复制一份
+	if c.config.OnMessageExec != "" && !hidden && isDataMessage(messageType) {
+		c.runExecHook(ExecHookMessage, bytes.Clone(message),
+			"WSC_MESSAGE_TYPE="+c.getMessageTypeString(messageType), "WSC_MESSAGE_SIZE="+strconv.Itoa(len(message)))
+	}
+
+	// 转发到--forward目标，与--on-message-exec一样只转发通过显示过滤器的消息
+	if !hidden {
+		c.forwardMessage(messageType, message)
+	}
+
+	// 匹配自动回复规则
+	c.applyAutoReplyRules(messageType, message)
+}
+
+// writeRawPayload 在静默模式下将收到的消息原样写到标准输出
+// 文本消息每条一行；二进制消息先写4字节大端长度前缀，再写原始数据，便于下游按长度切分
+//
+// 参数说明：
+//   - messageType: WebSocket消息类型，控制消息不输出
+//   - message: 消息内容
+//
+// 错误处理：
+//   - 标准输出不可写（例如管道下游已关闭）时自动退出客户端
+func (c *WebSocketClient) writeRawPayload(messageType int, message []byte) {
+	var err error
+	switch messageType {
+	case websocket.TextMessage:
+		_, err = fmt.Fprintf(os.Stdout, "%s\n", message)
+	case websocket.BinaryMessage:
+		var header [4]byte
+		binary.BigEndian.PutUint32(header[:], uint32(len(message))) // #nosec G115 -- 消息大小受MaxMessageSize限制
+		if _, err = os.Stdout.Write(header[:]); err == nil {
+			_, err = os.Stdout.Write(message)
+		}
+	default:
+		return
+	}
+	if err != nil {
+		c.autoExit(fmt.Sprintf("写入标准输出失败: %v", err))
+	}
+}
+
+// showPrompt 显示交互模式输入提示符
+// 静默模式下标准输出只用于输出消息内容，不显示提示符；
+// 标准输出被重定向到文件或管道时也不显示，保证捕获的输出中没有提示符
+func (c *WebSocketClient) showPrompt() {
+	if !c.config.Quiet && term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Print(c.config.prompt(DefaultPrompt))
+	}
+}
+
+// shouldContinueReading 检查是否应该继续读取消息
+// 这个方法检查停止信号和连接状态，决定是否应该继续消息读取循环
+//
+// 返回值：
+//   - bool: true表示应该继续读取，false表示应该停止
+//
+// 检查项目：
+//  1. 上下文取消信号：客户端主动停止
+//  2. 连接状态：连接是否仍然有效
+//  3. 连接对象：连接对象是否存在
+//
+// 日志记录：
+//   - 记录停止原因便于调试
+//   - 区分不同的停止场景
+func (c *WebSocketClient) shouldContinueReading() bool {
+	select {
+	case <-c.ctx.Done():
+		log.Print(tr("📋 ReadMessages: 收到停止信号，退出消息读取循环"))
+		return false
+	default:
+		conn, connected := c.getConnSafely()
+		if conn == nil || !connected {
+			if c.isConnected() {
+				log.Print(tr("⚠️ ReadMessages: 连接状态不一致或连接对象为空，退出消息读取循环"))
+			}
+			return false
+		}
+		return true
+	}
+}
+
+func (c *WebSocketClient) ReadMessages() {
+	defer c.trackGoroutine("read-messages")()
+	// 延迟执行的清理匿名函数：确保ReadMessages退出时正确清理连接资源
+	defer func() {
+		c.setState(StateDisconnected) // 设置连接状态为断开，通知其他组件连接已结束
+		c.mu.Lock()                   // 获取互斥锁，保护连接对象的并发访问
+		if c.conn != nil {
+			// 尝试关闭WebSocket连接，释放网络资源
+			if closeErr := c.conn.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭WebSocket连接失败: %v"), closeErr)
+			}
+			c.conn = nil // 清空连接对象引用，防止后续误用
+		}
+		c.mu.Unlock() // 释放互斥锁
+	}()
+
+	for {
+		// 检查是否应该继续读取消息
+		if !c.shouldContinueReading() {
+			return
+		}
+
+		// 达到最大接收消息数时不再读取，保证恰好处理N条消息
+		if c.maxMessagesReached() {
+			c.autoExit(fmt.Sprintf("已收到 %d 条消息", c.config.MaxMessages))
+			return
+		}
+
+		// 获取连接对象
+		conn, _ := c.getConnSafely()
+
+		// 启用流式读取时，大消息分块处理而不是整条缓冲
+		if c.config.StreamThreshold > 0 {
+			if err := c.readStreamingMessage(conn); err != nil {
+				c.handleReadError(err)
+				return
+			}
+			continue
+		}
+
+		// 读取消息到内存池缓冲区
+		messageType, message, err := readPooledMessage(conn)
+		if err != nil {
+			c.handleReadError(err)
+			return
+		}
+
+		// 处理接收到的消息，处理完成后归还缓冲区
+		c.processReceivedMessage(messageType, message)
+		releaseReadBuffer(message)
+	}
+}
+
+// readPooledMessage 读取一条完整消息到从globalBufferPool借用的缓冲区
+// 与conn.ReadMessage相比，高频收取小消息时缓冲区可以循环复用，不必每条消息分配新切片
+//
+// 参数说明：
+//   - conn: WebSocket连接
+//
+// 返回值：
+//   - int: 消息类型
+//   - []byte: 消息内容，使用完毕后必须调用releaseReadBuffer归还
+//   - error: 读取失败时的错误（包括超过MaxMessageSize的ErrReadLimit），此时缓冲区已归还
+//
+// 缓冲区增长策略：
+//   - 从1KB开始，写满后按两倍扩容，依次使用4KB、16KB池
+//   - 超过16KB的消息直接分配，归还时由BufferPool丢弃
+func readPooledMessage(conn *websocket.Conn) (int, []byte, error) {
+	messageType, reader, err := conn.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+
+	buf := globalBufferPool.Get(SmallBufferSize)[:0]
+	for {
+		if len(buf) == cap(buf) {
+			grown := globalBufferPool.Get(cap(buf) * 2)
+			n := copy(grown, buf)
+			releaseReadBuffer(buf)
+			buf = grown[:n]
+		}
+		n, err := reader.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return messageType, buf, nil
+		}
+		if err != nil {
+			releaseReadBuffer(buf)
+			return messageType, nil, err
+		}
+	}
+}
+
+// releaseReadBuffer 将readPooledMessage返回的缓冲区归还到内存池
+// 按容量归还，空消息的缓冲区同样可以复用
+func releaseReadBuffer(buf []byte) {
+	globalBufferPool.Put(buf[:cap(buf)])
+}
+
+// StreamChunkHandler 流式分块回调函数类型
+// 大消息按StreamChunkSize分块依次回调，offset为该分块在整条消息中的偏移量
+// 最后一次回调的final为true，此时chunk可能为空
+// chunk在回调返回后会被复用，需要保留数据时请自行复制
+type StreamChunkHandler func(messageType int, chunk []byte, offset int64, final bool) error
+
+// SetStreamHandler 设置流式分块回调
+// 设置后超过StreamThreshold的消息不再落盘，而是分块交给回调处理
+//
+// 参数说明：
+//   - handler: 分块回调函数，传入nil恢复默认的落盘行为
+//
+// 注意事项：
+//   - 应在调用Start()之前设置
+//   - 回调在读取goroutine中同步执行，耗时操作会阻塞消息读取
+func (c *WebSocketClient) SetStreamHandler(handler StreamChunkHandler) {
+	c.onStreamChunk = handler
+}
+
+// readStreamingMessage 以流式方式读取一条消息
+// 这个方法使用NextReader逐条读取消息，只缓冲不超过阈值的部分
+//
+// 参数说明：
+//   - conn: 当前WebSocket连接
+//
+// 返回值：
+//   - error: 连接级别的读取错误，需要由调用方按读取错误处理
+//
+// 处理逻辑：
+//  1. 读取至多StreamThreshold+1字节判断消息大小
+//  2. 未超过阈值：按普通消息走processReceivedMessage流程
+//  3. 超过阈值：将已读部分和剩余数据分块交给spoolMessage
+func (c *WebSocketClient) readStreamingMessage(conn *websocket.Conn) error {
+	messageType, reader, err := conn.NextReader()
+	if err != nil {
+		return err
+	}
+
+	// 第一步：读取不超过阈值+1字节的数据
+	head, err := io.ReadAll(io.LimitReader(reader, int64(c.config.StreamThreshold)+1))
+	if err != nil {
+		return err
+	}
+
+	// 第二步：消息未超过阈值，按普通消息处理
+	if len(head) <= c.config.StreamThreshold {
+		c.processReceivedMessage(messageType, head)
+		return nil
+	}
+
+	// 第三步：超过阈值，转入流式处理
+	return c.spoolMessage(messageType, head, reader)
+}
+
+// spoolMessage 将超大消息分块写入磁盘或交给回调
+// 这个方法按StreamChunkSize分块处理消息，内存占用与消息总大小无关
+//
+// 参数说明：
+//   - messageType: WebSocket消息类型
+//   - head: 判断大小时已经读取的消息开头部分
+//   - rest: 消息剩余部分的读取器
+//
+// 返回值：
+//   - error: 连接级别的读取错误；落盘或回调失败只记录日志，不中断连接
+//
+// 错误处理：
+//   - 落盘或回调失败后停止写入，剩余数据由下一次NextReader自动丢弃
+//   - 连接读取失败时返回错误，由ReadMessages按断线处理
+func (c *WebSocketClient) spoolMessage(messageType int, head []byte, rest io.Reader) error {
+	seq := atomic.AddInt64(&c.streamSeq, 1)
+	target := "回调"
+
+	// 第一步：准备输出目标（回调优先，否则落盘）
+	var file *os.File
+	if c.onStreamChunk == nil {
+		var err error
+		file, target, err = c.createStreamFile(messageType, seq)
+		if err != nil {
+			log.Printf(tr("❌ 创建流式落盘文件失败: %v"), err)
+			c.recordError(err)
+			return nil
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil {
+				log.Printf(tr("⚠️ 关闭流式落盘文件失败: %v"), closeErr)
+			}
+		}()
+	}
+
+	emit := func(chunk []byte, offset int64, final bool) error {
+		if c.onStreamChunk != nil {
+			return c.onStreamChunk(messageType, chunk, offset, final)
+		}
+		_, err := file.Write(chunk)
+		return err
+	}
+
+	// 第二步：分块读取并输出
+	chunk := make([]byte, c.config.StreamChunkSize)
+	src := io.MultiReader(bytes.NewReader(head), rest)
+	var total int64
+	for {
+		n, err := io.ReadFull(src, chunk)
+		final := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !final {
+			return err
+		}
+
+		if emitErr := emit(chunk[:n], total, final); emitErr != nil {
+			log.Printf(tr("❌ 流式消息处理失败 [#%d, 已处理 %d 字节]: %v"), seq, total, emitErr)
+			c.recordError(emitErr)
+			return nil
+		}
+		total += int64(n)
+
+		if final {
+			break
+		}
+	}
+
+	// 第三步：更新统计并记录日志
+	c.resetTimeout()
+	c.updateStats(messageType, int(total), false)
+	c.transcript.recordStreamedFrame(false, messageType, total)
+	c.capture.recordStreamed(false, messageType, total)
+	c.logStreamedMessage("RECV", messageType, total, target)
+	log.Printf(tr("📦 已流式接收%s [#%d]: %d 字节 -> %s"), c.getMessageTypeString(messageType), seq, total, target)
+	return nil
+}
+
+// createStreamFile 创建流式消息的落盘文件
+// 文件名格式：stream_<会话ID>_<序号>.txt|.bin，权限0600
+//
+// 返回值：
+//   - *os.File: 已打开的文件句柄
+//   - string: 文件路径
+//   - error: 目录不合法或创建失败时返回错误
+func (c *WebSocketClient) createStreamFile(messageType int, seq int64) (*os.File, string, error) {
+	dir := c.config.StreamDir
+	if dir == "" {
+		dir = "."
+	}
+	safeDir, err := validateWorkDirPath(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.MkdirAll(safeDir, 0750); err != nil {
+		return nil, "", fmt.Errorf(tr("创建落盘目录失败: %w"), err)
+	}
+
+	ext := ".bin"
+	if messageType == websocket.TextMessage {
+		ext = ".txt"
+	}
+	name := fmt.Sprintf("stream_%s_%d%s", c.SessionID, seq, ext)
+	path := filepath.Join(safeDir, name)
+
+	// #nosec G304 -- 目录已通过validateWorkDirPath验证，文件名由会话ID和序号生成
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, "", fmt.Errorf(tr("创建落盘文件失败: %w"), err)
+	}
+	return file, path, nil
+}
+
+// sendPeriodicPing 启动一个 goroutine，该 goroutine 定期向服务器发送 ping 消息
+// 这个函数实现了WebSocket连接的心跳保活机制，防止连接因空闲而被中间设备断开
+//
+// 功能说明：
+//   - 根据配置的PingInterval间隔发送ping消息
+//   - 监听上下文取消信号，支持优雅停止
+//   - 使用WaitGroup确保goroutine正确结束
+//   - 处理发送失败的情况，记录错误但不中断
+//
+// 心跳机制：
+//   - 定时发送：按配置的间隔定期发送ping消息
+//   - 错误处理：发送失败时记录日志，下次继续尝试
+//   - 优雅停止：响应上下文取消，立即停止发送
+//
+// 并发安全：
+//   - 使用WaitGroup管理goroutine生命周期
+//   - 通过上下文控制停止时机
+//   - 发送操作使用线程安全的sendControlMessage
+//
+// 使用场景：
+//   - 保持WebSocket连接活跃
+//   - 检测连接状态
+//   - 防止NAT/防火墙超时断开连接
+//
+// 注意事项：
+//   - 只有在DisableAutoPing为false时才会调用此函数
+//   - 使用配置中的PingInterval而不是硬编码值
+//   - 支持详细日志模式下的ping消息记录
+func (c *WebSocketClient) sendPeriodicPing() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+	defer c.trackGoroutine("periodic-ping")()
+
+	// 使用配置中的ping间隔，而不是硬编码的默认值
+	c.runtimeMu.RLock()
+	c.pingTicker = time.NewTicker(c.config.PingInterval)
+	c.runtimeMu.RUnlock()
+	defer c.pingTicker.Stop()
+
+	for {
+		select {
+		case interval := <-c.pingReset:
+			// 运行时修改了ping间隔
+			c.pingTicker.Reset(interval)
+		case <-c.ctx.Done():
+			if c.verbosePing() {
+				log.Print(tr("📋 sendPeriodicPing: 停止周期性ping (context done)"))
+			}
+			return
+		case <-c.pingTicker.C:
+			select {
+			case <-c.ctx.Done():
+				if c.verbosePing() {
+					log.Print(tr("📡 sendPeriodicPing: 停止周期性ping (context done before ping send)"))
+				}
+				return
+			default:
+			}
+			if err := c.sendTrackedPing(); err != nil {
+				log.Printf(tr("❌ sendPeriodicPing: 发送ping失败: %v. 将在下次tick尝试。"), err)
+			} else if c.verbosePing() {
+				log.Print(tr("📡 sendPeriodicPing: 发送ping到服务器"))
+			}
+		}
+	}
+}
+
+// watchExitConditions 监控空闲超时和最长运行时间
+// 任一条件满足时调用autoExit结束客户端，供脚本化抓取等需要自行终止的场景使用
+//
+// 判断规则：
+//   - 空闲超时：从最后一次收到消息起计时，尚未收到消息时从监控启动起计时，断线期间同样计入
+//   - 最长运行时间：从监控启动（即Start调用）起计时
+func (c *WebSocketClient) watchExitConditions() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+
+	startTime := time.Now()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if c.config.MaxDuration > 0 && now.Sub(startTime) >= c.config.MaxDuration {
+				c.autoExit(fmt.Sprintf("已达到最长运行时间 %v", c.config.MaxDuration))
+				return
+			}
+			if c.config.IdleTimeout > 0 {
+				c.mu.RLock()
+				lastReceive := c.lastReceiveTime
+				c.mu.RUnlock()
+				if lastReceive.Before(startTime) {
+					lastReceive = startTime
+				}
+				if now.Sub(lastReceive) >= c.config.IdleTimeout {
+					c.autoExit(fmt.Sprintf("已有 %v 未收到消息", c.config.IdleTimeout))
+					return
+				}
+			}
+		}
+	}
+}
+
+// maxMessagesReached 检查本进程接收的消息数是否达到MaxMessages
+// 从--state-file恢复的累计接收数不计入，否则重启后会立即退出
+func (c *WebSocketClient) maxMessagesReached() bool {
+	if c.config.MaxMessages <= 0 {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Stats.MessagesReceived-c.baseline.MessagesReceived >= int64(c.config.MaxMessages)
+}
+
+// autoExit 因满足自动退出条件而结束客户端
+// 先向服务器发送正常关闭帧，再取消上下文让Start主循环和main函数退出
+//
+// 参数说明：
+//   - reason: 退出原因，记录到日志并作为关闭帧的原因文本
+//
+// 并发安全：
+//   - 使用sync.Once保证多个条件同时满足时只执行一次
+func (c *WebSocketClient) autoExit(reason string) {
+	c.exitOnce.Do(func() {
+		log.Printf(tr("🏁 满足自动退出条件: %s，正在退出..."), reason)
+		if err := c.sendControlMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)); err != nil {
+			log.Printf(tr("⚠️ 发送关闭消息失败: %v"), err)
+		}
+		c.cancel()
+	})
+}
+
+// Stop 优雅地停止WebSocket客户端
+// 这个方法实现了客户端的优雅关闭流程，确保所有资源正确释放和清理
+//
+// 功能说明：
+//   - 取消客户端的上下文，通知所有goroutine停止
+//   - 发送WebSocket关闭消息，通知服务器连接即将关闭
+//   - 关闭底层的WebSocket连接
+//   - 等待所有客户端管理的goroutine完成
+//   - 清理相关资源（日志文件、监控服务器等）
+//
+// 停止流程：
+//  1. 取消上下文：通知所有goroutine停止工作
+//  2. 设置状态：将连接状态设置为断开
+//  3. 发送关闭消息：向服务器发送正常关闭消息
+//  4. 关闭连接：关闭底层的WebSocket连接
+//  5. 等待完成：等待所有goroutine优雅退出
+//  6. 清理资源：关闭日志文件和监控服务器
+//
+// 优雅关闭特点：
+//   - 协议兼容：按照WebSocket协议发送关闭帧
+//   - 资源清理：确保所有资源正确释放
+//   - 并发安全：使用锁保护关键操作
+//   - 超时控制：避免无限等待
+//
+// 错误处理：
+//   - 发送关闭消息失败：记录警告但继续关闭流程
+//   - 连接关闭失败：记录警告但继续清理
+//   - 确保即使出现错误也能完成清理
+//
+// 并发安全：
+//   - 使用互斥锁保护连接对象访问
+//   - 通过WaitGroup等待所有goroutine完成
+//   - 支持多次调用（幂等操作）
+//
+// 使用场景：
+//   - 程序正常退出时调用
+//   - 接收到停止信号时调用
+//   - 发生不可恢复错误时调用
+//   - 用户主动断开连接时调用
+//
+// 注意事项：
+//   - 此方法会阻塞直到所有goroutine停止
+//   - 应该在主goroutine中调用
+//   - 支持多次调用，不会产生副作用
+//   - 确保在程序退出前调用此方法
+func (c *WebSocketClient) Stop() {
+	log.Print(tr("🛑 Stop: 开始停止客户端..."))
+	if c.notifier != nil {
+		c.notifier.notify("STOPPING=1")
+	}
+	c.cancel()
+	c.setState(StateDisconnected)
+	c.mu.Lock()
+	if c.conn != nil {
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "客户端主动关闭")
+		// 自动退出时已经发送过关闭帧（如客户端池在成员自动退出后统一调用Stop），不再报告ErrCloseSent
+		if err := c.conn.WriteMessage(websocket.CloseMessage, closeMessage); err != nil {
+			if !errors.Is(err, websocket.ErrCloseSent) {
+				log.Printf(tr("⚠️ 发送关闭消息失败: %v"), err)
+			}
+		} else {
+			c.Stats.SentByType.add(websocket.CloseMessage)
+			c.transcript.recordFrame(true, websocket.CloseMessage, closeMessage)
+			c.capture.record(true, websocket.CloseMessage, closeMessage)
+		}
+		if closeErr := c.conn.Close(); closeErr != nil {
+			log.Printf(tr("⚠️ 关闭WebSocket连接失败: %v"), closeErr)
+		}
+		c.conn = nil
+	}
+	c.mu.Unlock()
+	log.Print(tr("⏳ Stop: 等待所有内部goroutine停止..."))
+	c.wg.Wait()
+
+	// 关闭消息日志文件
+	c.closeMessageLog()
+
+	// 关闭发送日志，未确认的消息留待下次启动重发
+	if c.journal != nil {
+		if err := c.journal.close(); err != nil {
+			log.Printf(tr("⚠️ 关闭发送日志失败: %v"), err)
+		}
+	}
+
+	// 所有goroutine已停止，保存最终的统计快照
+	c.persistState()
+
+	// 停止监控服务器
+	c.stopMonitoringServers()
+
+	// 等待剩余的Webhook事件和转发消息投递完成，以及运行中的生命周期命令结束
+	c.webhook.close(WebhookFlushTimeout)
+	c.forwarder.close(ForwardFlushTimeout)
+	c.capture.close(CaptureFlushTimeout)
+	c.execHooks.wait(ExecHookFlushTimeout)
+
+	log.Print(tr("🛑 Stop: 客户端已优雅停止"))
+}
+
+// getConnSafely 提供一种线程安全的方式来获取当前的 WebSocket 连接
+// 对象及其连接状态。
+func (c *WebSocketClient) getConnSafely() (*websocket.Conn, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	// 直接检查状态，避免调用isConnected()导致的死锁
+	connected := atomic.LoadInt32(&c.State) == int32(StateConnected)
+	return c.conn, connected
+}
+
+// sendControlMessage 发送 WebSocket 控制消息（例如 Ping、Pong、Close）。
+// 它确保在尝试发送消息之前客户端已连接。
+// 此函数是线程安全的。
+//
+// 注意事项：
+//   - 不获取writeMu：WriteControl可以与其他写方法并发调用，由websocket库在帧之间串行化，
+//     这样SendStream长时间持有写锁时ping/pong仍能及时发出
+func (c *WebSocketClient) sendControlMessage(messageType int, data []byte) error {
+	conn, connected := c.getConnSafely()
+	if conn == nil || !connected {
+		return errors.New(tr("连接已关闭"))
+	}
+
+	if err := conn.WriteControl(messageType, data, time.Now().Add(c.config.WriteTimeout)); err != nil {
+		return err
+	}
+	c.countControlFrame(messageType, true)
+	c.transcript.recordFrame(true, messageType, data)
+	c.capture.record(true, messageType, data)
+	return nil
+}
+
+// reportProtocolViolation 记录严格模式发现的协议违规
+// 按类型计数并输出日志；启用--strict-fail时按RFC 6455第7.4节的关闭码断开连接
+//
+// 参数说明：
+//   - kind: 违规类型（Violation*常量）
+//   - detail: 违规详情
+//
+// 注意事项：
+//   - 帧级违规在读取goroutine的底层Read中回调，此时可能还没有完成握手后的连接设置
+func (c *WebSocketClient) reportProtocolViolation(kind, detail string) {
+	log.Printf(tr("🚨 协议违规 [%s]: %s"), kind, detail)
+	c.mu.Lock()
+	if c.Stats.ProtocolViolations == nil {
+		c.Stats.ProtocolViolations = make(map[string]int64)
+	}
+	c.Stats.ProtocolViolations[kind]++
+	c.mu.Unlock()
+
+	if !c.config.StrictFail {
+		return
+	}
+	code := websocket.CloseProtocolError
+	if kind == ViolationInvalidUTF8 {
+		code = websocket.CloseInvalidFramePayloadData
+	}
+	c.failConnection(code, kind)
+}
+
+// failConnection 因对端违反协议主动断开当前连接
+// 发送关闭帧后把读取截止时间设为当前时间，使读取循环立即以错误退出，交由重连逻辑处理；
+// 读缓冲区中已经到达的后续消息被丢弃
+//
+// 参数说明：
+//   - code: 关闭码（1002协议错误、1007无效载荷等）
+//   - reason: 关闭原因，同时写入关闭帧
+//
+// 注意事项：
+//   - 同一连接上只有第一次调用生效，之后关闭帧已发送，直接返回
+func (c *WebSocketClient) failConnection(code int, reason string) {
+	conn, connected := c.getConnSafely()
+	if conn == nil || !connected {
+		return
+	}
+	atomic.StoreInt32(&c.connFailed, 1)
+	err := c.sendControlMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+	if errors.Is(err, websocket.ErrCloseSent) {
+		return
+	}
+	log.Printf(tr("🚨 因协议违规断开连接: 关闭码=%d, 原因=%s"), code, reason)
+	if err != nil {
+		log.Printf(tr("⚠️ 发送关闭消息失败: %v"), err)
+	}
+	if err := conn.SetReadDeadline(time.Now()); err != nil {
+		log.Printf(tr("⚠️ 中止读取失败: %v"), err)
+	}
+}
+
+// countControlFrame 记录一个收发的控制帧（ping/pong/close），只计入按类型分类的统计
+func (c *WebSocketClient) countControlFrame(messageType int, sent bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sent {
+		c.Stats.SentByType.add(messageType)
+	} else {
+		c.Stats.ReceivedByType.add(messageType)
+	}
+}
+
+// setupPingPongHandlers 为当前的 WebSocket 连接配置 ping 和 pong 处理器。
+// pong 处理器更新读取截止时间。ping 处理器以 pong 消息响应，
+// 并且也会更新读取截止时间。还会设置一个初始的读取截止时间。
+// 此方法只应在 c.conn 不为 nil 时调用，并且通常在锁的保护下调用。
+func (c *WebSocketClient) setupPingPongHandlers() {
+	if c.conn == nil {
+		return
+	}
+	// 新连接上不会再收到旧连接ping的pong
+	c.pendingPings = nil
+	c.pongMisses = 0
+	c.conn.SetPongHandler(func(appData string) error {
+		c.countControlFrame(websocket.PongMessage, false)
+		c.transcript.recordFrame(false, websocket.PongMessage, []byte(appData))
+		c.capture.record(false, websocket.PongMessage, []byte(appData))
+		rtt := c.recordPong(appData)
+		c.mu.RLock()
+		onPong := c.onPong
+		c.mu.RUnlock()
+		if onPong != nil {
+			onPong(appData, rtt)
+		}
+		if c.verbosePing() {
+			if rtt > 0 {
+				log.Printf(tr("📡 PongHandler: 收到服务器pong响应 (RTT=%v)"), rtt.Round(time.Microsecond))
+			} else {
+				log.Print(tr("📡 PongHandler: 收到服务器pong响应"))
+			}
+		}
+		c.resetTimeout()
+		return nil
+	})
+	c.conn.SetPingHandler(func(appData string) error {
+		c.countControlFrame(websocket.PingMessage, false)
+		c.transcript.recordFrame(false, websocket.PingMessage, []byte(appData))
+		c.capture.record(false, websocket.PingMessage, []byte(appData))
+		c.mu.RLock()
+		onPing := c.onPing
+		c.mu.RUnlock()
+		if onPing != nil {
+			onPing(appData)
+		}
+		if c.verbosePing() {
+			log.Print(tr("📡 PingHandler: 收到服务器ping，发送pong响应"))
+		}
+		err := c.sendControlMessage(websocket.PongMessage, []byte(appData))
+		if err != nil {
+			log.Printf(tr("❌ PingHandler: 发送pong失败: %v"), err)
+		}
+		c.resetTimeout()
+		return err
+	})
+	if c.conn != nil {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.config.ReadTimeout)); err != nil {
+			log.Printf(tr("⚠️ 设置读取超时失败: %v"), err)
+		}
+	}
+}
+
+// resetTimeout 重置 WebSocket 连接上的读取截止时间。
+// 通常在成功发送或接收数据后调用此方法，以保持连接活动状态。
+// 如果连接为nil，则不执行任何操作。
+func (c *WebSocketClient) resetTimeout() {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn != nil {
+		if err := conn.SetReadDeadline(time.Now().Add(c.config.ReadTimeout)); err != nil {
+			log.Printf(tr("⚠️ 设置连接读取超时失败: %v"), err)
+		}
+	}
+}
+
+// logReceivedMessage 记录接收到的消息（优化字符串转换）
+// 这个方法根据消息类型记录不同格式的接收日志，优化了字符串转换性能
+//
+// 参数说明：
+//   - messageType: WebSocket消息类型常量
+//   - message: 消息内容的字节数组
+//
+// 消息类型处理：
+//  1. 文本消息：显示完整的文本内容
+//  2. 二进制消息：只显示字节数，避免乱码
+//  3. Ping消息：仅在详细模式下显示
+//  4. Pong消息：仅在详细模式下显示
+//  5. 其他类型：显示消息类型编号
+//
+// 性能优化：
+//   - 避免不必要的字符串转换
+//   - 二进制消息只显示长度，不转换内容
+//   - 控制消息的日志输出频率
+//
+// 日志控制：
+//   - Ping/Pong消息受VerbosePing配置控制
+//   - 使用emoji增强日志可读性
+//   - 提供结构化的日志格式
+//
+// 使用场景：
+//   - 调试消息接收问题
+//   - 监控消息流量
+//   - 分析消息类型分布
+//   - 开发阶段的消息跟踪
+func (c *WebSocketClient) logReceivedMessage(messageType int, message []byte) {
+	switch messageType {
+	case websocket.TextMessage:
+		// 文本消息：显示完整内容
+		log.Printf(tr("📥 收到文本消息: %s"), string(message))
+	case websocket.BinaryMessage:
+		// 二进制消息：默认只显示字节数，避免乱码；--hexdump时附带完整转储
+		if c.config.HexDump {
+			log.Printf(tr("📥 收到二进制消息: %d 字节\n%s"), len(message), hex.Dump(message))
+		} else {
+			log.Printf(tr("📥 收到二进制消息: %d 字节"), len(message))
+		}
+	case websocket.PingMessage:
+		// Ping消息：仅在详细模式下显示
+		if c.verbosePing() {
+			log.Print(tr("📡 收到ping消息"))
+		}
+	case websocket.PongMessage:
+		// Pong消息：仅在详细模式下显示
+		if c.verbosePing() {
+			log.Print(tr("📡 收到pong消息"))
+		}
+	default:
+		// 其他类型消息：显示类型编号
+		log.Printf(tr("📥 收到其他类型消息: %d"), messageType)
+	}
+}
+
+// isNetworkError 检查给定的错误是否可能是常见的网络相关错误
+// 极致优化版本：使用高效的错误检查策略，避免字符串操作
+//
+// 参数说明：
+//   - err: 需要检查的错误对象
+//
+// 返回值：
+//   - bool: true表示是网络错误，false表示不是
+//
+// 检查策略（按性能优先级排序）：
+//  1. 快速路径：直接比较系统调用错误常量（最高效）
+//  2. 中等路径：类型断言检查网络操作错误
+//  3. DNS错误：检查DNS相关的错误类型
+//  4. 字符串匹配：最后的兜底检查（性能最低）
+//
+// 支持的网络错误类型：
+//   - 系统调用错误：ECONNREFUSED、ECONNRESET、ETIMEDOUT等
+//   - 网络操作错误：超时、网络不可达等
+//   - DNS错误：域名解析失败、DNS超时
+//   - 字符串模式：常见的网络错误消息
+//
+// 性能优化：
+//   - 优先使用类型检查，避免字符串操作
+//   - 递归检查嵌套错误的内部错误
+//   - 使用预编译的错误模式数组
+//
+// 使用场景：
+//   - 区分网络错误和其他类型错误
+//   - 实现智能重试策略
+//   - 错误分类和统计
+//   - 日志记录和问题诊断
+func isNetworkError(err error) bool {
+	// 第一步：空值检查
+	if err == nil {
+		return false
+	}
 
-	// ===== 延迟性能指标 =====
-	latencyP95 time.Duration // P95延迟：95%的请求在此时间内完成
-	latencyP99 time.Duration // P99延迟：99%的请求在此时间内完成
+	// 第二步：快速路径 - 检查常见的系统调用错误（最高效）
+	switch err {
+	case syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ETIMEDOUT,
+		syscall.ENETUNREACH, syscall.EHOSTUNREACH, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+
+	// 第三步：中等路径 - 检查网络操作错误
+	if netErr, ok := err.(*net.OpError); ok {
+		if netErr.Timeout() {
+			return true
+		}
+		// 递归检查内部错误
+		return isNetworkError(netErr.Err)
+	}
+
+	// 第四步：检查DNS错误
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		return dnsErr.IsNotFound || dnsErr.IsTimeout
+	}
+
+	// 第五步：最后的字符串检查（性能最低，但覆盖面广）
+	// 使用预编译的错误模式避免重复的字符串操作
+	errStr := err.Error()
+	return containsNetworkErrorPattern(errStr)
+}
+
+// containsNetworkErrorPattern 检查错误字符串是否包含网络错误模式
+// 使用高效的字符串匹配，避免多次调用strings.Contains
+//
+// 参数说明：
+//   - errStr: 错误消息字符串
+//
+// 返回值：
+//   - bool: true表示包含网络错误模式，false表示不包含
+//
+// 错误模式：
+//   - 按出现频率排序，提高匹配效率
+//   - 涵盖常见的网络错误消息
+//   - 支持多种语言和库的错误格式
+//
+// 性能优化：
+//   - 使用数组而不是切片，避免堆分配
+//   - 单次遍历检查所有模式
+//   - 按频率排序，提高早期匹配概率
+//
+// 支持的错误模式：
+//   - "connection refused": 连接被拒绝
+//   - "i/o timeout": I/O操作超时
+//   - "broken pipe": 管道断开
+//   - "network is unreachable": 网络不可达
+//   - "no such host": 主机不存在
+//   - "unexpected EOF": 意外的文件结束
+//   - "connection reset": 连接被重置
+//   - "host is down": 主机宕机
+//   - "network down": 网络断开
+//   - "protocol error": 协议错误
+//
+// 使用场景：
+//   - isNetworkError的字符串匹配后备方案
+//   - 处理第三方库的自定义错误消息
+//   - 支持多种错误格式的兼容性
+func containsNetworkErrorPattern(errStr string) bool {
+	// 预定义的网络错误模式（按出现频率排序）
+	patterns := [...]string{
+		"connection refused",     // 最常见：连接被拒绝
+		"i/o timeout",            // 常见：I/O超时
+		"broken pipe",            // 常见：管道断开
+		"network is unreachable", // 网络不可达
+		"no such host",           // DNS解析失败
+		"unexpected EOF",         // 意外的文件结束
+		"connection reset",       // 连接被重置
+		"host is down",           // 主机宕机
+		"network down",           // 网络断开
+		"protocol error",         // 协议错误
+	}
+
+	// 使用单次遍历检查所有模式
+	for _, pattern := range patterns {
+		if strings.Contains(errStr, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseArgs 解析命令行参数以创建 ClientConfig
+// 这是命令行参数解析的主入口函数，负责完整的参数处理流程
+//
+// 返回值：
+//   - *ClientConfig: 解析后的客户端配置对象
+//   - bool: 是否跳过证书警告（-n参数）
+//   - error: 解析过程中的错误信息
+//
+// 解析流程：
+//  1. 检查参数数量的基本要求
+//  2. 识别子命令，第一个参数不是子命令时按connect处理，兼容 wsc [选项] <URL> 的写法
+//  3. 按子命令的选项集合解析所有命令行选项
+//  4. 处理WebSocket URL参数
+//  5. 验证最终配置的有效性
+//
+// 错误处理：
+//   - 参数不足：显示使用说明
+//   - 选项解析失败：返回具体错误
+//   - URL处理失败：返回URL相关错误
+//   - 配置验证失败：返回验证错误
+//
+// 使用示例：
+//
+//	config, skipWarning, err := parseArgs()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func parseArgs() (*ClientConfig, bool, error) {
+	// 第一步：检查基本参数要求
+	if len(os.Args) < 2 {
+		showUsage()
+		return nil, false, errors.New(tr("参数不足，请提供WebSocket URL"))
+	}
+
+	// 尽早确定输出语言，使--help和参数错误信息也使用所选语言
+	outputLang = detectOutputLang(os.Args[1:])
+
+	// 第二步：识别子命令
+	cmd, args, explicit := lookupCommand(os.Args[1:])
+	if cmd.name == completionSubcommand {
+		// 补全脚本生成：与信息类选项一样输出后直接退出
+		os.Exit(runCompletion(args))
+	}
+	help := showUsage
+	if explicit {
+		help = func() { writeCommandUsage(os.Stdout, cmd) }
+	}
+
+	// 第三步：创建默认配置，按子命令的选项集合解析命令行
+	config := NewDefaultConfig("")
+	config.Mode = cmd.mode
+	var skipCertWarning bool
+	positional, err := parseOptions(cmd.flagSet(config, &skipCertWarning, help), args)
+	if err != nil {
+		return nil, false, err
+	}
+	if config.AdminToken == "" {
+		// 管理令牌也可以通过环境变量提供，避免出现在进程列表中
+		config.AdminToken = os.Getenv("WSC_ADMIN_TOKEN")
+	}
+	if config.WebhookSecret == "" && config.WebhookURL != "" {
+		// 签名密钥同样可以通过环境变量提供
+		config.WebhookSecret = os.Getenv("WSC_WEBHOOK_SECRET")
+	}
+	if config.TLSKeyLog == "" {
+		// 与浏览器和curl一致，支持SSLKEYLOGFILE环境变量
+		config.TLSKeyLog = os.Getenv("SSLKEYLOGFILE")
+	}
+	if config.LogFile == "" && (config.LogSplit || (config.LogFormat != "" && config.LogFormat != LogFormatText)) {
+		// 指定日志分离或格式即表示需要消息日志，未指定路径时自动生成文件名
+		config.LogFile = "auto"
+	}
+
+	// 第四步：处理URL参数，不连接远程服务器的子命令不接受URL
+	if cmd.connects {
+		if err := processURLArg(config, positional); err != nil {
+			return nil, false, err
+		}
+	} else if len(positional) > 0 {
+		return nil, false, fmt.Errorf(tr("⚠️ %s 子命令不接受参数: '%s'"), cmd.name, strings.Join(positional, " "))
+	}
+
+	// 第五步：验证配置
+	if err := config.Validate(); err != nil {
+		return nil, false, fmt.Errorf(tr("配置验证失败: %w"), err)
+	}
+	if config.Lang != "" {
+		outputLang = config.Lang
+	}
+
+	return config, skipCertWarning, nil
+}
+
+// ===== 命令行子命令与选项 =====
+
+// cliCommand 一个子命令
+type cliCommand struct {
+	name     string // 子命令名
+	mode     string // 对应的ClientConfig.Mode
+	usage    string // 用法中子命令之后的部分（中文原文）
+	summary  string // 一行说明（中文原文）
+	connects bool   // 是否连接远程服务器：需要URL参数，并接受通用的连接选项
+}
+
+// cliCommands 全部子命令，第一项connect是未指定子命令时的默认子命令
+var cliCommands = []cliCommand{
+	{connectSubcommand, "", "[选项] <WebSocket_URL>", "连接到WebSocket服务器（默认）", true},
+	{ModeBridge, ModeBridge, "--listen <地址> [选项] <WebSocket_URL>", "REST到WebSocket桥接", true},
+	{ModeRelay, ModeRelay, "--listen <地址> [选项] <WebSocket_URL>", "本地WebSocket中继", true},
+	{ModeConformance, ModeConformance, "[选项] <WebSocket_URL>", "协议一致性测试", true},
+	{ModeCheck, ModeCheck, "[选项] <WebSocket_URL>", "回显探测", true},
+	{ModeScenario, ModeScenario, "--script <文件> [选项] <WebSocket_URL>", "执行场景脚本", true},
+	{ModeBench, ModeBench, "[选项] <WebSocket_URL>", "并发压测回显服务器的吞吐和往返时间", true},
+	{ModeReplay, ModeReplay, "--from <文件> [选项] <WebSocket_URL>", "按原始间隔重放记录的发送消息", true},
+	{ModeServe, ModeServe, "[选项]", "本地WebSocket回显/广播测试服务器", false},
+	{completionSubcommand, "", "bash|zsh|fish|powershell", "生成shell补全脚本", false},
+}
+
+// sessionCommands 运行客户端会话的子命令，只有它们接受消息处理、自动退出和监控等会话选项
+// 其余连接远程服务器的子命令自行管理连接，只接受连接相关的通用选项
+var sessionCommands = []string{connectSubcommand, ModeBridge, ModeRelay}
+
+// lookupCommand 按第一个参数查找子命令
+//
+// 参数说明：
+//   - args: 命令行参数（不含程序名），至少有一个
+//
+// 返回值：
+//   - *cliCommand: 子命令，第一个参数不是子命令时为connect
+//   - []string: 子命令之后的参数
+//   - bool: 是否显式指定了子命令
+func lookupCommand(args []string) (*cliCommand, []string, bool) {
+	for i := range cliCommands {
+		if cliCommands[i].name == args[0] {
+			return &cliCommands[i], args[1:], true
+		}
+	}
+	return &cliCommands[0], args, false
+}
+
+// accepts 判断子命令是否接受一组选项
+func (cmd *cliCommand) accepts(group cliOptionGroup) bool {
+	switch {
+	case group.global:
+		return cmd.name != completionSubcommand
+	case len(group.commands) == 0:
+		return cmd.connects
+	default:
+		return slices.Contains(group.commands, cmd.name)
+	}
+}
+
+// optionGroups 返回子命令接受的选项分组，子命令专用的分组排在其他分组之前
+func (cmd *cliCommand) optionGroups(config *ClientConfig, skipCertWarning *bool, help func()) []cliOptionGroup {
+	var own, shared []cliOptionGroup
+	for _, group := range optionGroups(config, skipCertWarning, help) {
+		switch {
+		case !cmd.accepts(group):
+		case len(group.commands) == 1:
+			own = append(own, group)
+		default:
+			shared = append(shared, group)
+		}
+	}
+	return append(own, shared...)
+}
+
+// flagSet 创建子命令的选项集合，解析出的选项值直接写入config
+//
+// 参数说明：
+//   - config: 接收选项值的配置
+//   - skipCertWarning: 接收-n选项
+//   - help: -h、--help执行的帮助输出
+//
+// 返回值：
+//   - *flag.FlagSet: 注册了子命令全部选项（含别名）的集合，由parseOptions使用
+func (cmd *cliCommand) flagSet(config *ClientConfig, skipCertWarning *bool, help func()) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	for _, group := range cmd.optionGroups(config, skipCertWarning, help) {
+		for _, option := range group.options {
+			for _, name := range strings.Split(option.names, ",") {
+				fs.Var(option.value, name, option.usage)
+			}
+		}
+	}
+	return fs
+}
+
+// cliOption 一个命令行选项
+// 帮助、补全脚本和参数解析都由选项定义生成，新增选项只需在optionGroups中增加一项
+type cliOption struct {
+	names string     // 逗号分隔的选项名（不含前缀），单字母为短选项（-x），其余为长选项（--name）
+	arg   string     // 值的占位符（中文原文），如"<时长>"；"[...]"表示值可以省略，开关选项为空
+	usage string     // 说明（中文原文）
+	value flag.Value // 解析选项值并写入配置
+}
+
+// cliOptionGroup 帮助中的一组选项
+type cliOptionGroup struct {
+	title    string      // 分组标题（中文原文）
+	commands []string    // 接受这组选项的子命令，为空时为所有连接远程服务器的子命令
+	global   bool        // 所有子命令都接受（信息类选项）
+	options  []cliOption // 组内选项
+	notes    []string    // 选项之后的补充说明行（中文原文）
+}
+
+// optionFunc 解析选项值的函数，实现flag.Value
+// 返回的错误说明值的问题，选项名由parseOptions补充
+type optionFunc func(value string) error
+
+func (f optionFunc) String() string { return "" }
+
+// Set 解析并写入选项值
+func (f optionFunc) Set(value string) error { return f(value) }
+
+// switchOption 不带值的开关选项，出现时执行，实现flag.Value
+type switchOption func()
+
+func (f switchOption) String() string { return "" }
+
+// Set 写入开关选项，--name=false可以显式关闭（不执行）
+func (f switchOption) Set(value string) error {
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf(tr("参数值 '%s' 必须是true或false"), value)
+	}
+	if on {
+		f()
+	}
+	return nil
+}
+
+// IsBoolFlag 与flag包的约定一致，表示选项不带值
+func (switchOption) IsBoolFlag() bool { return true }
+
+// optionalOption 值可以省略的选项，实现flag.Value
+type optionalOption struct {
+	target   *string // 写入位置
+	fallback string  // 省略值时写入的内容
+}
 
-	// ===== 系统监控状态 =====
-	lastCPUTime    time.Time        // 上次CPU统计时间：用于计算CPU使用率的时间差
-	lastCPUUsage   time.Duration    // 上次CPU使用时间：基于GC暂停时间的累计值
-	memStats       runtime.MemStats // 内存统计：Go运行时的详细内存统计信息
-	updateInterval time.Duration    // 更新间隔：系统指标的更新频率（默认5秒）
-	lastUpdateTime time.Time        // 上次更新时间：用于控制更新频率
+func (o *optionalOption) String() string { return "" }
 
-	// ===== 并发控制 =====
-	mu sync.RWMutex // 读写锁：保护所有性能指标字段的并发访问安全
+// Set 写入选项值，空字符串表示省略了值
+func (o *optionalOption) Set(value string) error {
+	if value == "" {
+		value = o.fallback
+	}
+	*o.target = value
+	return nil
 }
 
-// NewPerformanceMonitor 创建性能监控器
-func NewPerformanceMonitor() *PerformanceMonitor {
-	pm := &PerformanceMonitor{
-		startTime:      time.Now(),
-		updateInterval: 5 * time.Second, // 每5秒更新一次系统指标
-		lastUpdateTime: time.Now(),
+// enable 开关选项：把目标全部设为true
+func enable(targets ...*bool) switchOption {
+	return func() {
+		for _, target := range targets {
+			*target = true
+		}
 	}
+}
 
-	// 初始化系统监控
-	pm.updateSystemMetrics()
+// exitAfter 信息类开关选项：执行后退出程序
+func exitAfter(show func()) switchOption {
+	return func() {
+		show()
+		os.Exit(0)
+	}
+}
 
-	return pm
+// stringOption 字符串选项
+func stringOption(target *string) optionFunc {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
 }
 
-// updateSystemMetrics 更新真实的系统性能指标
-func (pm *PerformanceMonitor) updateSystemMetrics() {
-	now := time.Now()
+// stringListOption 可重复的字符串选项，每次出现追加一个值
+func stringListOption(target *[]string) optionFunc {
+	return func(value string) error {
+		*target = append(*target, value)
+		return nil
+	}
+}
 
-	// 更新内存统计
-	runtime.ReadMemStats(&pm.memStats)
-	// 使用更安全的转换方法，完全避免直接转换
-	allocBytes := pm.memStats.Alloc
-	if allocBytes > math.MaxInt64 {
-		pm.memoryUsage = math.MaxInt64
-	} else {
-		// 使用字符串转换避免gosec警告
-		allocStr := fmt.Sprintf("%d", allocBytes)
-		if parsed, err := strconv.ParseInt(allocStr, 10, 64); err == nil {
-			pm.memoryUsage = parsed
-		} else {
-			pm.memoryUsage = math.MaxInt64
+// positiveIntOption 正整数选项
+func positiveIntOption(target *int) optionFunc {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf(tr("参数值 '%s' 必须是正整数"), value)
 		}
+		*target = n
+		return nil
 	}
+}
 
-	// 更新goroutine数量
-	pm.goroutineCount = runtime.NumGoroutine()
+// positiveFloatOption 有限正数选项（NaN、Inf无效）
+//
+// 参数说明：
+//   - target: 写入位置
+//   - suffix: 值允许带的单位后缀（如"%"、"/s"），为空表示不允许
+func positiveFloatOption(target *float64, suffix string) optionFunc {
+	return func(value string) error {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(value, suffix), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) || n <= 0 {
+			return fmt.Errorf(tr("参数值 '%s' 必须是有限的正数"), value)
+		}
+		*target = n
+		return nil
+	}
+}
 
-	// 更新CPU使用率（简化实现，基于GC时间）
-	if !pm.lastCPUTime.IsZero() {
-		timeDiff := now.Sub(pm.lastCPUTime)
-		// 使用更安全的时间转换方法
-		pauseNs := pm.memStats.PauseTotalNs
-		var currentPauseNs time.Duration
-		if pauseNs > math.MaxInt64 {
-			currentPauseNs = time.Duration(math.MaxInt64)
-		} else {
-			// 使用字符串转换避免gosec警告
-			pauseStr := fmt.Sprintf("%d", pauseNs)
-			if parsed, err := strconv.ParseInt(pauseStr, 10, 64); err == nil {
-				currentPauseNs = time.Duration(parsed)
-			} else {
-				currentPauseNs = time.Duration(math.MaxInt64)
-			}
+// portOption 端口号选项（1-65535）
+func portOption(target *int) optionFunc {
+	return func(value string) error {
+		port, err := strconv.Atoi(value)
+		if err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf(tr("参数值 '%s' 必须是有效端口号 (1-65535)"), value)
 		}
-		gcTimeDiff := currentPauseNs - pm.lastCPUUsage
-		if timeDiff > 0 {
-			// 基于GC暂停时间估算CPU使用率（简化方法）
-			pm.cpuUsage = float64(gcTimeDiff) / float64(timeDiff) * 100
-			if pm.cpuUsage > 100 {
-				pm.cpuUsage = 100
-			}
-			if pm.cpuUsage < 0 {
-				pm.cpuUsage = 0
+		*target = port
+		return nil
+	}
+}
+
+// durationOption 正时长选项
+// 支持Go时长格式（如30s、10m、1h30m），纯数字按秒处理
+func durationOption(target *time.Duration) optionFunc {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			// 兼容纯数字写法，按秒处理
+			secs, convErr := strconv.Atoi(value)
+			if convErr != nil {
+				return fmt.Errorf(tr("参数值 '%s' 不是有效的时长 (例如 30s、10m)"), value)
 			}
+			d = time.Duration(secs) * time.Second
 		}
+		if d <= 0 {
+			return fmt.Errorf(tr("参数值 '%s' 必须大于0"), value)
+		}
+		*target = d
+		return nil
 	}
+}
 
-	pm.lastCPUTime = now
-	// 使用更安全的时间转换方法
-	pauseNs := pm.memStats.PauseTotalNs
-	if pauseNs > math.MaxInt64 {
-		pm.lastCPUUsage = time.Duration(math.MaxInt64)
-	} else {
-		// 使用字符串转换避免gosec警告
-		pauseStr := fmt.Sprintf("%d", pauseNs)
-		if parsed, err := strconv.ParseInt(pauseStr, 10, 64); err == nil {
-			pm.lastCPUUsage = time.Duration(parsed)
-		} else {
-			pm.lastCPUUsage = time.Duration(math.MaxInt64)
+// byteSizeOption 带单位的字节大小选项（如 64k、1MiB，不带单位时为字节），最大2GiB
+func byteSizeOption(target *int) optionFunc {
+	return func(value string) error {
+		size, err := parseByteSize(value)
+		if err != nil {
+			return err
 		}
+		if size > math.MaxInt32 {
+			return fmt.Errorf(tr("参数值 '%s' 超出范围 (最大2GiB)"), value)
+		}
+		*target = int(size)
+		return nil
 	}
-	pm.lastUpdateTime = now
 }
 
-// UpdateMetrics 更新性能指标
-func (pm *PerformanceMonitor) UpdateMetrics(stats ConnectionStats) {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
-
-	// 检查是否需要更新系统指标
-	if time.Since(pm.lastUpdateTime) >= pm.updateInterval {
-		pm.updateSystemMetrics()
+// retryCountOption -r 选项：非负整数
+// 0表示5次快速重试加无限慢速重试，N表示N次快速重试加N次慢速重试
+func retryCountOption(config *ClientConfig) optionFunc {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf(tr("参数值 '%s' 必须是非负整数"), value)
+		}
+		config.MaxRetries = n
+		return nil
 	}
+}
 
-	// 更新基本指标
-	pm.connectionCount = 1 // 单连接客户端
-
-	// 计算消息速率
-	uptime := time.Since(pm.startTime).Seconds()
-	if uptime > 0 {
-		pm.messageRate = float64(stats.MessagesSent+stats.MessagesReceived) / uptime
-		pm.errorRate = float64(stats.Errors.TotalErrors) / uptime
+// retryDelayOption -t 选项：慢速重试间隔，以秒为单位的正整数
+func retryDelayOption(config *ClientConfig) optionFunc {
+	return func(value string) error {
+		secs, err := strconv.Atoi(value)
+		if err != nil || secs <= 0 {
+			return fmt.Errorf(tr("参数值 '%s' 必须是正整数"), value)
+		}
+		config.RetryDelay = time.Duration(secs) * time.Second
+		return nil
 	}
 }
 
-// GetPerformanceReport 获取性能报告
-func (pm *PerformanceMonitor) GetPerformanceReport() map[string]any {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
+// metricsPortOption --metrics-port 选项：指定端口同时启用指标
+func metricsPortOption(config *ClientConfig) optionFunc {
+	port := portOption(&config.MetricsPort)
+	return func(value string) error {
+		if err := port(value); err != nil {
+			return err
+		}
+		config.MetricsEnabled = true
+		return nil
+	}
+}
 
-	return map[string]any{
-		"uptime_seconds":     time.Since(pm.startTime).Seconds(),
-		"cpu_usage_percent":  pm.cpuUsage,
-		"memory_usage_bytes": pm.memoryUsage,
-		"goroutine_count":    pm.goroutineCount,
-		"connection_count":   pm.connectionCount,
-		"message_rate":       pm.messageRate,
-		"error_rate":         pm.errorRate,
-		"latency_p95_ms":     pm.latencyP95.Milliseconds(),
-		"latency_p99_ms":     pm.latencyP99.Milliseconds(),
+// gogcOption --gogc 选项：正整数百分比或off
+func gogcOption(config *ClientConfig) optionFunc {
+	return func(value string) error {
+		if strings.EqualFold(value, "off") {
+			config.GCPercent = -1
+			return nil
+		}
+		percent, err := strconv.Atoi(value)
+		if err != nil || percent <= 0 {
+			return fmt.Errorf(tr("参数值 '%s' 必须是正整数或off"), value)
+		}
+		config.GCPercent = percent
+		return nil
 	}
 }
 
-// SecurityChecker 安全检查器
-// 这个结构体用于检查WebSocket消息的安全性，防止恶意内容和攻击
-//
-// 安全检查项目：
-//  1. 消息大小检查：防止过大消息导致的DoS攻击
-//  2. 内容模式检查：检测XSS、脚本注入等恶意模式
-//  3. 来源验证：验证消息来源的合法性
-//  4. 频率监控：记录可疑活动的频率和模式
-//
-// 检测模式：
-//   - XSS攻击：<script、javascript:、eval(等
-//   - 信息泄露：document.cookie、window.location等
-//   - 代码注入：各种脚本执行模式
-//
-// 使用场景：
-//   - 生产环境的安全防护
-//   - 恶意内容过滤
-//   - 安全事件监控和告警
-//   - 合规性检查和审计
-//
-// 并发安全：使用读写锁保护所有字段的并发访问
-type SecurityChecker struct {
-	maxMessageSize    int          // 最大消息大小：超过此大小的消息被拒绝，防止DoS攻击
-	allowedOrigins    []string     // 允许的来源列表：白名单机制，只允许特定来源的消息
-	blockedPatterns   []string     // 阻止的模式列表：包含恶意代码模式的黑名单
-	suspiciousCount   int64        // 可疑活动计数：累计检测到的可疑活动次数
-	lastSecurityEvent time.Time    // 最后安全事件时间：记录最近一次安全事件的时间戳
-	mu                sync.RWMutex // 读写锁：保护所有安全检查器字段的并发访问安全
+// resolveOption --resolve 选项：curl风格的host:port:addr，可重复指定以覆盖多个主机
+//
+// 格式说明：
+//   - example.com:443:10.0.0.5    将example.com:443拨号到10.0.0.5
+//   - example.com:443:[::1]       IPv6地址需要使用方括号
+func resolveOption(config *ClientConfig) optionFunc {
+	return func(value string) error {
+		// 按前两个冒号拆分，剩余部分作为地址（兼容IPv6）
+		parts := strings.SplitN(value, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return fmt.Errorf(tr("参数值 '%s' 格式必须为 host:port:addr"), value)
+		}
+		if p, err := strconv.Atoi(parts[1]); err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf(tr("参数值 '%s' 中的端口无效"), value)
+		}
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf(tr("参数值 '%s' 中的地址必须是IP"), value)
+		}
+		if config.ResolveOverrides == nil {
+			config.ResolveOverrides = make(map[string]string)
+		}
+		config.ResolveOverrides[net.JoinHostPort(parts[0], parts[1])] = addr
+		return nil
+	}
 }
 
-// NewSecurityChecker 创建安全检查器
-func NewSecurityChecker(maxMessageSize int) *SecurityChecker {
-	return &SecurityChecker{
-		maxMessageSize: maxMessageSize,
-		allowedOrigins: []string{"*"}, // 默认允许所有来源
-		blockedPatterns: []string{
-			"<script",
-			"javascript:",
-			"eval(",
-			"document.cookie",
-			"window.location",
-		},
+// dnsServerOption --dns 选项：自定义DNS服务器，未指定端口时默认使用53端口
+func dnsServerOption(config *ClientConfig) optionFunc {
+	return func(value string) error {
+		server := value
+		if _, _, err := net.SplitHostPort(value); err != nil {
+			// 未带端口（或裸IPv6地址），补充默认DNS端口
+			server = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"), "53")
+		}
+		if host, _, err := net.SplitHostPort(server); err != nil || host == "" {
+			return fmt.Errorf(tr("参数值 '%s' 格式必须为 server:port"), value)
+		}
+		config.DNSServer = server
+		return nil
 	}
 }
 
-// CheckMessage 检查消息安全性
-func (sc *SecurityChecker) CheckMessage(messageType int, data []byte) error {
-	sc.mu.Lock()
-	defer sc.mu.Unlock()
+// labelOption --label 选项：指标常量标签key=value，可重复指定，同名标签以最后一次为准
+func labelOption(config *ClientConfig) optionFunc {
+	return func(value string) error {
+		name, labelValue, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return fmt.Errorf(tr("参数值 '%s' 格式必须为 key=value"), value)
+		}
+		if err := validateLabelName(name); err != nil {
+			return err
+		}
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[name] = labelValue
+		return nil
+	}
+}
 
-	// 检查消息大小
-	if len(data) > sc.maxMessageSize {
-		sc.recordSecurityEvent()
-		return fmt.Errorf("消息大小超过安全限制: %d > %d", len(data), sc.maxMessageSize)
+// optionGroups 返回全部选项分组，顺序即帮助中的顺序
+//
+// 参数说明：
+//   - config: 接收选项值的配置
+//   - skipCertWarning: 接收-n选项
+//   - help: -h、--help执行的帮助输出
+//
+// 注意事项：
+//   - 同一个选项名可以出现在不同子命令的分组中（如--listen），但同一子命令接受的分组中不能重复
+func optionGroups(config *ClientConfig, skipCertWarning *bool, help func()) []cliOptionGroup {
+	return []cliOptionGroup{
+		{title: "⚙️  可选参数:", options: []cliOption{
+			{"n", "", "跳过 TLS 证书验证警告", enable(skipCertWarning)},
+			{"f", "", "强制启用 TLS 证书验证 (覆盖默认跳过行为)", enable(&config.ForceTLSVerify)},
+			{"query", "<key=value>", "追加URL查询参数 (自动URL编码，可重复，覆盖URL中的同名参数)", stringListOption(&config.QueryParams)},
+			{"user-agent", "<UA>", "握手请求的User-Agent (默认 WebSocket-Client/<版本>)", stringOption(&config.UserAgent)},
+			{"origin", "<来源|auto>", "握手请求的Origin头，auto按目标地址推导 (ws→http、wss→https)，默认不发送", stringOption(&config.Origin)},
+			{"d", "", "禁用自动ping功能 (仍会响应服务器ping)", enable(&config.DisableAutoPing)},
+			{"pong-timeout", "<时长>", "每个ping等待pong的时限，连续超时后主动断开重连 (默认0=禁用)", durationOption(&config.PongTimeout)},
+			{"pong-misses", "<次数>", "判定连接失效的连续pong超时次数 (默认3)", positiveIntOption(&config.PongMisses)},
+			{"v", "", "启用详细日志模式 (包括消息处理和ping/pong)", enable(&config.Verbose, &config.VerbosePing)},
+			{"i,interactive", "", "启用交互式消息发送模式", enable(&config.Interactive)},
+			{"history-file", "<路径>", "保存交互模式的发送历史，下次启动时可用 /history、/!N 和方向键调出", stringOption(&config.HistoryFile)},
+			{"prompt", "<文本>", "交互模式输入提示符 (默认 \">>> \")", stringOption(&config.Prompt)},
+			{"message-format", "<模板>", "收发消息的显示模板，字段: .Time .Direction .Type .Size .Payload，或预设 terse、verbose", stringOption(&config.MessageFormat)},
+			{"l", "[文件路径]", "记录消息到日志文件 (可选路径)", &optionalOption{&config.LogFile, "auto"}},
+			{"log-file", "<路径>", "指定消息日志文件路径", stringOption(&config.LogFile)},
+			{"log-split", "", "发送和接收消息分别记录到 <名称>.send.log 和 <名称>.recv.log", enable(&config.LogSplit)},
+			{"log-format", "<格式>", "消息日志格式: text (默认)、json (每行一个对象)、raw (14字节头部+原始载荷)", stringOption(&config.LogFormat)},
+			{"q,quiet", "", "静默模式：屏蔽日志，只把收到的消息写到标准输出", enable(&config.Quiet)},
+			{"tui", "", "全屏终端界面：分栏显示消息、日志、统计和发送输入框", enable(&config.TUI)},
+			{"color", "<模式>", "控制台颜色: auto (默认)、always、never", stringOption(&config.Color)},
+			{"ascii", "", "纯ASCII日志：emoji前缀替换为[SEND]、[RECV]、[ERROR]等标签", enable(&config.ASCII)},
+			{"lang", "<zh|en>", "输出语言: 使用说明、错误码和主要运行日志 (默认按LANG环境变量)", stringOption(&config.Lang)},
+			{"timestamp", "<格式>", "控制台和消息日志的时间戳: rfc3339、unix、unixms、none", stringOption(&config.Timestamp)},
+			{"log-syslog", "[地址]", "运行日志同时发送到syslog (省略地址为本机，或 udp://、tcp://host:port)", &optionalOption{&config.LogSyslog, "local"}},
+			{"syslog-messages", "", "收发的消息记录也发送到syslog", enable(&config.SyslogMessages)},
+			{"summary-json", "<路径>", "退出时输出JSON会话摘要 (- 表示标准输出)", stringOption(&config.SummaryJSON)},
+			{"transcript", "<路径>", "退出时输出会话记录：握手头部、每一帧和关闭详情 (类HAR格式)", stringOption(&config.Transcript)},
+			{"capture-db", "<路径>", "收发的每一帧写入SQLite数据库，便于用SQL分析长时间抓包", stringOption(&config.CaptureDB)},
+			{"state-file", "<路径>", "保存累计统计和错误历史，重启后继续累加 (每30秒及退出时保存)", stringOption(&config.StateFile)},
+			{"journal", "<目录>", "出站消息预写日志，未发送成功的消息在重连或重启后重发", stringOption(&config.Journal)},
+			{"r", "<次数>", "重试次数 (默认5，0=无限)", retryCountOption(config)},
+			{"t", "<秒数>", "重试间隔 (默认3秒)", retryDelayOption(config)},
+			{"max-retry-duration", "<时长>", "重试总时长上限，超时后停止重试 (如10m)", durationOption(&config.MaxRetryDuration)},
+		}},
+		{title: "⏱️ 超时与帧大小:", options: []cliOption{
+			{"handshake-timeout", "<时长>", "建连总超时，包含TCP连接、TLS握手和HTTP升级 (默认15s)", durationOption(&config.HandshakeTimeout)},
+			{"dial-timeout", "<时长>", "单个地址的TCP连接超时，与握手超时分开报告 (默认10s)", durationOption(&config.DialTimeout)},
+			{"read-timeout", "<时长>", "读取截止时间，期间未收到任何数据或pong即断开重连 (默认60s，须大于ping间隔)", durationOption(&config.ReadTimeout)},
+			{"write-timeout", "<时长>", "单次消息和控制帧写入的截止时间 (默认5s)", durationOption(&config.WriteTimeout)},
+			{"ping-interval", "<时长>", "自动ping间隔 (默认30s)", durationOption(&config.PingInterval)},
+			{"max-message-size", "<大小>", "最大消息大小，支持k/m单位 (默认32k)", byteSizeOption(&config.MaxMessageSize)},
+			{"read-buffer", "<大小>", "读缓冲区大小 (默认4k)", byteSizeOption(&config.ReadBufferSize)},
+			{"write-buffer", "<大小>", "写缓冲区大小 (默认4k)", byteSizeOption(&config.WriteBufferSize)},
+		}},
+		{title: "🌐 名称解析:", options: []cliOption{
+			{"resolve", "<host:port:addr>", "将指定主机端口解析到固定IP (可重复)", resolveOption(config)},
+			{"dns", "<server:port>", "使用指定DNS服务器解析主机名", dnsServerOption(config)},
+			{"dns-cache-ttl", "<时长>", "在该时长内重连复用上次的解析结果 (默认0: 每次重连都重新解析)", durationOption(&config.DNSCacheTTL)},
+			{"follow-redirects", "", "握手返回301/302/307/308时跟随Location重新握手", enable(&config.FollowRedirects)},
+			{"max-redirects", "<次数>", "最多跟随的重定向次数 (默认5)", positiveIntOption(&config.MaxRedirects)},
+			{"allow-insecure-redirect", "", "允许从wss://重定向到明文ws://或http://地址 (默认拒绝)", enable(&config.AllowInsecureRedirect)},
+		}},
+		{title: "📦 大消息流式读取:", commands: sessionCommands, options: []cliOption{
+			{"stream-threshold", "<字节>", "超过此大小的消息分块落盘 (默认0=禁用)", positiveIntOption(&config.StreamThreshold)},
+			{"stream-chunk", "<字节>", "流式读取分块大小 (默认65536)", positiveIntOption(&config.StreamChunkSize)},
+			{"stream-dir", "<目录>", "大消息落盘目录 (默认当前目录)", stringOption(&config.StreamDir)},
+			{"send-file", "<文件>", "连接后以分片方式发送文件 (二进制消息，不受最大消息限制)", stringOption(&config.SendFile)},
+			{"tail", "<文件>", "类似tail -F跟随文件，每个新写入的行作为文本消息发送 (处理轮转)", stringOption(&config.Tail)},
+			{"rules", "<文件>", "自动回复规则文件 (YAML/JSON，按正则或JSON路径匹配收到的消息并回复)", stringOption(&config.Rules)},
+			{"seq-path", "<JSON路径>", "检查收到消息中的序列号，统计跳跃、重复和乱序 (如 seq、data.sequence)", stringOption(&config.SeqPath)},
+			{"seq-resubscribe", "<模板>", "序列号跳跃时发送的消息 (可引用 {{.Expected}} 和 {{.Received}})", stringOption(&config.SeqResubscribe)},
+			{"send-rate", "<条/秒>", "令牌桶平滑限速，超出时等待而不是拒绝 (默认每分钟最多100条)", positiveFloatOption(&config.SendRate, "")},
+			{"send-burst", "<数量>", "令牌桶突发容量 (默认与发送速率相同)", positiveIntOption(&config.SendBurst)},
+		}},
+		{title: "🚦 背压控制:", commands: sessionCommands, options: []cliOption{
+			{"inbound-queue", "<数量>", "入站队列容量，消息由独立goroutine分发，慢速回调不再阻塞读取 (默认0=同步处理)", positiveIntOption(&config.InboundQueueSize)},
+			{"backpressure", "<策略>", "队列满时的策略: block (默认)、drop-oldest、drop-newest", stringOption(&config.Backpressure)},
+			{"on-bad-utf8", "<策略>", "无效UTF-8文本消息: warn (默认，警告后照常处理)、replace (替换为U+FFFD)、close (以1007断开)", stringOption(&config.OnBadUTF8)},
+			{"max-receive-rate", "<N/s>", "每秒最多向显示和回调分发N条消息，突发由入站队列吸收 (未指定队列时容量1000)", positiveFloatOption(&config.MaxReceiveRate, "/s")},
+		}},
+		{title: "🧠 内存控制:", options: []cliOption{
+			{"max-memory", "<大小>", "软内存上限 (如 256MB)，接近上限时释放缓存并更积极地GC", optionFunc(func(value string) error {
+				size, err := parseByteSize(value)
+				config.MaxMemory = size
+				return err
+			})},
+			{"gogc", "<百分比|off>", "设置GOGC (默认沿用GOGC环境变量)", gogcOption(config)},
+			{"buffer-tier", "<大小>", "增加内存池档位 (如 64KB，可重复)，调大--max-message-size时让大消息也能复用缓冲区", optionFunc(func(value string) error {
+				var size int
+				if err := byteSizeOption(&size)(value); err != nil {
+					return err
+				}
+				config.BufferTiers = append(config.BufferTiers, size)
+				return nil
+			})},
+		}},
+		{title: "🛡️ 安全检查:", commands: sessionCommands, options: []cliOption{
+			{"block-pattern", "<模式>", "阻止发送包含该模式的文本消息，可重复，替换默认模式 (re:前缀为正则)", stringListOption(&config.BlockedPatterns)},
+			{"allow-pattern", "<模式>", "白名单模式：文本消息必须匹配其中之一，可重复 (re:前缀为正则)", stringListOption(&config.AllowPatterns)},
+			{"allowed-origin", "<来源>", "中继模式允许的跨源连接来源 (Origin头)，可重复，默认只允许同源", stringListOption(&config.AllowedOrigins)},
+			{"no-security-check", "", "关闭消息内容检查 (适用于会误触发子串检查的协议)", enable(&config.NoSecurityCheck)},
+			{"e2e-key-file", "<文件>", "端到端加密密钥 (AES-GCM，16/24/32字节，原始/十六进制/Base64)", stringOption(&config.E2EKeyFile)},
+			{"payload-gzip", "", "发送前gzip压缩载荷 (以二进制帧发送)，自动解压收到的gzip载荷", enable(&config.PayloadGzip)},
+		}},
+		{title: "🧪 连接预检:", options: []cliOption{
+			{"dry-run", "", "依次执行DNS解析、TCP连接、TLS握手和WebSocket升级，输出各阶段结果后退出", enable(&config.DryRun)},
+		}},
+		{title: "📜 证书信息:", options: []cliOption{
+			{"show-cert", "", "连接后输出服务器证书链 (主题、签发者、SAN、有效期、指纹)，即将过期时警告", enable(&config.ShowCert)},
+			{"pin-sha256", "<指纹>", "固定服务器公钥SHA-256指纹 (Base64，可重复)，-n 跳过验证时同样生效", optionFunc(func(value string) error {
+				pin, err := normalizeCertPin(value)
+				if err != nil {
+					return err
+				}
+				config.TLSConfig.PinnedSHA256 = append(config.TLSConfig.PinnedSHA256, pin)
+				return nil
+			})},
+			{"tls-keylog", "<文件>", "写入TLS会话密钥供Wireshark解密 (也支持SSLKEYLOGFILE环境变量)", stringOption(&config.TLSKeyLog)},
+		}},
+		{title: "🔬 帧级调试:", options: []cliOption{
+			{"trace-frames", "", "记录收发的每个帧 (操作码、FIN、长度、掩码、载荷前16字节十六进制)", enable(&config.TraceFrames)},
+			{"strict", "", "按RFC 6455检查服务器发来的帧 (保留位、掩码、控制帧、分片、文本UTF-8)，按类型记录违规", enable(&config.Strict)},
+			{"strict-fail", "", "同 --strict，发现违规时发送关闭帧 (1002/1007) 并断开连接", enable(&config.Strict, &config.StrictFail)},
+			{"hexdump", "", "以xxd风格 (偏移/十六进制/ASCII) 完整输出收发的二进制消息，同时作用于控制台和消息日志", enable(&config.HexDump)},
+			{"dump-handshake", "", "输出升级请求和服务器响应的完整HTTP头部 (含Sec-WebSocket-Accept和扩展/子协议协商结果)", enable(&config.DumpHandshake)},
+		}},
+		{title: "💥 混沌测试:", options: []cliOption{
+			{"chaos", "<配置>", "按概率注入故障，例如 drop=0.01,delay=0.2,delay-max=1s,dup=0.05,corrupt=0.01,seed=42", optionFunc(func(value string) error {
+				chaos, err := ParseChaosSpec(value)
+				config.Chaos = chaos
+				return err
+			})},
+			{"simulate-latency", "<时长>", "模拟附加往返延迟 (如 200ms)，无需netem", durationOption(&config.SimulateLatency)},
+			{"simulate-bandwidth", "<带宽>", "模拟带宽上限 (如 512kbps、1mbps)，收发方向分别限制", optionFunc(func(value string) error {
+				bps, err := parseBandwidth(value)
+				config.SimulateBandwidth = bps
+				return err
+			})},
+		}, notes: []string{
+			"    --chaos 字段: drop=中断连接 delay=写入延迟 dup=重复发送 corrupt=翻转一个比特 seed=可重现的随机种子",
+		}},
+		{title: "📐 消息验证:", commands: sessionCommands, options: []cliOption{
+			{"validate-json", "", "要求收发的文本消息都是有效JSON", enable(&config.ValidateJSON)},
+			{"schema", "<文件>", "使用JSON Schema验证文本消息，失败时记录日志并按错误码计数", stringOption(&config.SchemaFile)},
+			{"schema-direction", "<方向>", "Schema验证方向: in|out|both (默认in；发送方向验证失败会拒绝发送)", stringOption(&config.SchemaDirection)},
+		}},
+		{title: "🔍 消息过滤:", commands: sessionCommands, options: []cliOption{
+			{"grep", "<正则>", "只显示和记录匹配的接收消息 (可重复，默认匹配任一即可)", stringListOption(&config.GrepPatterns)},
+			{"grep-v", "<正则>", "隐藏匹配的接收消息 (可重复，优先于 --grep)", stringListOption(&config.GrepExclude)},
+			{"grep-all", "", "多个 --grep 必须全部匹配", enable(&config.GrepAll)},
+			{"highlight", "<正则[:颜色]>", "高亮接收消息中匹配的子串 (可重复，颜色: red|green|yellow|blue|magenta|cyan|white，默认red，需要启用颜色)", stringListOption(&config.Highlight)},
+		}, notes: []string{
+			"    被隐藏的消息仍计入统计，并照常触发回调和自动回复规则",
+		}},
+		{title: "🏁 自动退出条件:", commands: sessionCommands, options: []cliOption{
+			{"idle-timeout", "<时长>", "超过此时长未收到消息时退出 (如30s)", durationOption(&config.IdleTimeout)},
+			{"max-messages", "<数量>", "收到指定数量的消息后退出", positiveIntOption(&config.MaxMessages)},
+			{"max-duration", "<时长>", "运行指定时长后退出 (如5m)", durationOption(&config.MaxDuration)},
+		}},
+		{title: "🧩 分片连接 (connect):", commands: []string{connectSubcommand}, options: []cliOption{
+			{"shard", "<值>", "增加一条分片连接 (可重复)：未指定--shard-param时是另一个ws://或wss://地址，否则是查询参数的取值", stringListOption(&config.Shards)},
+			{"shard-param", "<名称>", "分片查询参数名，每条连接在URL上附加 名称=分片取值 (如 partition)", stringOption(&config.ShardParam)},
+		}, notes: []string{
+			"    消息前标出分片名称；交互输入由第一条连接发送，/broadcast 发送给所有分片；--metrics 的 /metrics 和 /stats 汇总所有分片，退出时输出每个分片的消息数和接收延迟",
+		}},
+		{title: "🌉 桥接模式 (bridge):", commands: []string{ModeBridge}, options: []cliOption{
+			{"listen", "<地址>", "本地HTTP监听地址 (如 :8081)", stringOption(&config.ListenAddr)},
+			{"bridge-timeout", "<时长>", "等待WebSocket响应的超时 (默认5s)", durationOption(&config.BridgeTimeout)},
+		}, notes: []string{
+			"    curl -d '{\"op\":\"ping\"}' http://localhost:8081/  请求体作为消息发送，响应消息作为HTTP响应返回",
+			"    未指定主机时仅监听127.0.0.1；设置 --admin-token 后请求需携带 Authorization: Bearer <令牌>",
+		}},
+		{title: "🔀 中继模式 (relay):", commands: []string{ModeRelay}, options: []cliOption{
+			{"listen", "<地址>", "本地WebSocket监听地址 (如 :9001)", stringOption(&config.ListenAddr)},
+		}, notes: []string{
+			"    本地客户端连接 ws://localhost:9001/ 即可与远程服务器双向通信，上游断线重连对本地客户端透明",
+		}},
+		{title: "🧪 协议一致性测试 (conformance):", commands: []string{ModeConformance}, notes: []string{
+			"    wsc conformance <URL>  对回显服务器执行分片、Ping/Pong、UTF-8、关闭握手等用例，全部通过时退出码为0",
+		}},
+		{title: "🩺 回显探测 (check):", commands: []string{ModeCheck}, options: []cliOption{
+			{"check-message", "<文本>", "发送的消息 (默认随机令牌)", stringOption(&config.CheckMessage)},
+			{"check-expect", "<正则>", "期望的响应 (默认原样回显)", stringOption(&config.CheckExpect)},
+			{"check-timeout", "<时长>", "握手加等待响应的总时限 (默认5s)", durationOption(&config.CheckTimeout)},
+			{"check-warn", "<时长>", "往返时间超过此值时以WARNING退出", durationOption(&config.CheckWarn)},
+		}, notes: []string{
+			"    退出码: 0=OK 1=WARNING 2=CRITICAL 3=参数无效，输出一行Nagios格式结果和性能数据",
+		}},
+		{title: "🎬 场景脚本 (scenario):", commands: []string{ModeScenario}, options: []cliOption{
+			{"script", "<文件>", "YAML/JSON场景脚本，按顺序执行send、wait、expect、close步骤", stringOption(&config.Script)},
+		}, notes: []string{
+			"    退出码: 0=全部步骤成功 1=连接失败或步骤失败 2=参数或脚本无效",
+		}},
+		{title: "🏋️ 压测 (bench):", commands: []string{ModeBench}, options: []cliOption{
+			{"connections", "<数量>", "并发连接数 (默认10)", positiveIntOption(&config.BenchConnections)},
+			{"messages", "<数量>", "每个连接发送的消息数，逐条等待回显 (默认100)", positiveIntOption(&config.BenchMessages)},
+			{"payload-size", "<大小>", "每条消息的载荷大小 (默认64字节)", byteSizeOption(&config.BenchPayloadSize)},
+		}, notes: []string{
+			"    输出吞吐量和握手、往返时间的分位数；有连接失败或消息未收到回显时退出码为1",
+		}},
+		{title: "📼 会话重放 (replay):", commands: []string{ModeReplay}, options: []cliOption{
+			{"from", "<文件>", "--transcript 会话记录或 --capture-db 抓包数据库，重发其中发送方向的文本和二进制消息", stringOption(&config.ReplayFrom)},
+			{"speed", "<速度>", "重放速度: realtime (默认，原始间隔)、max (不等待) 或倍数如 2x (原始间隔除以倍数)", stringOption(&config.ReplaySpeed)},
+			{"loop", "<次数>", "重复重放全部消息的次数 (默认1)", positiveIntOption(&config.ReplayLoop)},
+		}, notes: []string{
+			"    收到的消息输出到标准输出；全部发送后继续接收，1秒内没有新消息时正常关闭",
+		}},
+		{title: "🖥️ 测试服务器 (serve):", commands: []string{ModeServe}, options: []cliOption{
+			{"listen", "<地址>", "WebSocket监听地址 (默认 :8080，未指定主机时仅监听127.0.0.1)", stringOption(&config.ListenAddr)},
+			{"broadcast", "", "把收到的消息广播给所有客户端 (默认原样回显给发送方)", enable(&config.ServeBroadcast)},
+			{"v", "", "输出收到的每条消息", enable(&config.Verbose)},
+		}, notes: []string{
+			"    wsc serve & wsc bench ws://localhost:8080/  在本机压测，按Ctrl+C停止服务器",
+		}},
+		{title: "📋 信息查看:", global: true, options: []cliOption{
+			{"h,help", "", "显示此帮助信息", exitAfter(help)},
+			{"version", "", "显示版本号", exitAfter(showVersion)},
+			{"build-info", "", "显示详细构建信息", exitAfter(showBuildInfo)},
+			{"health-check", "", "执行自检并返回状态码", exitAfter(performHealthCheck)},
+		}},
+		{title: "📊 监控和指标:", commands: sessionCommands, options: []cliOption{
+			{"metrics", "", "启用Prometheus指标导出", enable(&config.MetricsEnabled)},
+			{"metrics-port", "<端口>", "指标服务端口 (默认9090)", metricsPortOption(config)},
+			{"health-port", "<端口>", "健康检查端口 (默认8080)", portOption(&config.HealthPort)},
+			{"admin-port", "<端口>", "在同一端口提供指标、健康检查和管理API (取代上面两个端口)", portOption(&config.AdminPort)},
+			{"ready-require-message", "", "/ready 要求本次连接已收到消息", enable(&config.ReadyRequireMessage)},
+			{"ready-max-silence", "<时长>", "/ready 允许的最长消息静默时长 (如 30s)", durationOption(&config.ReadyMaxSilence)},
+			{"slo-availability", "<百分比>", "可用性目标：已连接时间占比 (如 99.9)", positiveFloatOption(&config.SLOAvailability, "%")},
+			{"slo-success", "<百分比>", "消息发送成功率目标 (如 99.5)", positiveFloatOption(&config.SLOMessageSuccess, "%")},
+			{"slo-max-reconnects", "<次数>", "每小时允许的最多重连次数", positiveFloatOption(&config.SLOMaxReconnects, "")},
+			{"slo-window", "<时长>", "SLO滚动窗口 (默认1h，短窗口为其1/12)", durationOption(&config.SLOWindow)},
+			{"slo-burn-rate", "<倍数>", "长短窗口的错误预算消耗速率都达到该倍数时 /health 报告 degraded (默认2)", positiveFloatOption(&config.SLOBurnRate, "")},
+			{"sample-interval", "<时长>", "后台死锁检查、系统指标采样和健康检查的间隔 (默认10s)", durationOption(&config.SampleInterval)},
+			{"admin-token", "<令牌>", "在健康检查端口启用管理API (也可用环境变量 WSC_ADMIN_TOKEN)", stringOption(&config.AdminToken)},
+			{"label", "<key=value>", "附加到所有指标和JSON统计的常量标签 (可重复，如 region=eu)", labelOption(config)},
+			{"webhook-url", "<URL>", "连接、断开、重试耗尽和安全违规时POST JSON事件到该地址 (失败自动重试)", stringOption(&config.WebhookURL)},
+			{"webhook-secret", "<密钥>", "以HMAC-SHA256签名Webhook请求体 (X-WSC-Signature头，也可用环境变量 WSC_WEBHOOK_SECRET)", stringOption(&config.WebhookSecret)},
+			{"on-connect-exec", "<命令>", "连接建立时通过shell运行命令 (事件数据在WSC_*环境变量中)", stringOption(&config.OnConnectExec)},
+			{"on-disconnect-exec", "<命令>", "连接断开时运行命令 (WSC_REASON、WSC_CLOSE_CODE)", stringOption(&config.OnDisconnectExec)},
+			{"on-message-exec", "<命令>", "收到消息时运行命令，消息内容写入标准输入 (受--grep过滤)", stringOption(&config.OnMessageExec)},
+			{"forward", "<URL>", "收到的消息批量转发到 kafka://broker/topic 或 nats://server/subject (受--grep过滤)", stringOption(&config.Forward)},
+		}},
 	}
+}
 
-	// 检查文本消息中的可疑模式（优化字符串转换）
-	if messageType == websocket.TextMessage {
-		// 只转换一次字符串，避免重复转换
-		messageContent := string(data)
-		contentLower := strings.ToLower(messageContent)
-		for _, pattern := range sc.blockedPatterns {
-			if strings.Contains(contentLower, pattern) {
-				sc.recordSecurityEvent()
-				return fmt.Errorf("检测到可疑内容模式: %s", pattern)
+// parseOptions 按FlagSet中注册的选项解析参数，返回非选项参数
+// flag.FlagSet.Parse遇到第一个非选项参数就停止，这里逐个处理参数再交给FlagSet写入，
+// 使URL前后都可以写选项（如 wsc ws://host -v），并输出本地化的错误信息
+//
+// 参数说明：
+//   - fs: 子命令的选项集合，见cliCommand.flagSet
+//   - args: 子命令之后的参数
+//
+// 返回值：
+//   - []string: 按出现顺序排列的非选项参数
+//   - error: 未知选项、缺少值或值无效时的错误
+//
+// 选项写法：
+//   - 长选项可以写作--name或-name，值可以写作 --name value 或 --name=value
+//   - "--"之后的参数全部作为非选项参数
+//   - 值可以省略的选项（如 -l [文件路径]）只在下一个参数不是选项也不是WebSocket URL时把它作为值
+func parseOptions(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(positional, args[i+1:]...), nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg[1:], "-"), "=")
+		option := fs.Lookup(name)
+		if option == nil {
+			return nil, fmt.Errorf(tr("⚠️ 未知参数或标志: '%s'"), arg)
+		}
+		if !hasValue {
+			switch option.Value.(type) {
+			case switchOption:
+				value = "true"
+			case *optionalOption:
+				if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") && !isValidWebSocketURL(args[i+1]) {
+					i++
+					value = args[i]
+				}
+			default:
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf(tr("⚠️ %s 参数需要指定值"), optionDisplayName(name))
+				}
+				i++
+				value = args[i]
 			}
 		}
+		if err := fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("⚠️ %s %v", optionDisplayName(name), err)
+		}
 	}
-
-	return nil
+	return positional, nil
 }
 
-// recordSecurityEvent 记录安全事件
-func (sc *SecurityChecker) recordSecurityEvent() {
-	sc.suspiciousCount++
-	sc.lastSecurityEvent = time.Now()
-	log.Printf("🚨 安全事件记录: 总计 %d 次可疑活动", sc.suspiciousCount)
+// flagNames 返回选项带前缀的全部写法，如 "-i, --interactive"
+func (o cliOption) flagNames() string {
+	names := strings.Split(o.names, ",")
+	for i, name := range names {
+		names[i] = optionDisplayName(name)
+	}
+	return strings.Join(names, ", ")
 }
 
-// GetSecurityStats 获取安全统计
-func (sc *SecurityChecker) GetSecurityStats() map[string]any {
-	sc.mu.RLock()
-	defer sc.mu.RUnlock()
-
-	return map[string]any{
-		"suspicious_count":       sc.suspiciousCount,
-		"last_security_event":    sc.lastSecurityEvent,
-		"blocked_patterns_count": len(sc.blockedPatterns),
-		"allowed_origins_count":  len(sc.allowedOrigins),
+// optionDisplayName 返回选项带前缀的写法：单字母为-x，其余为--name
+func optionDisplayName(name string) string {
+	if len(name) == 1 {
+		return "-" + name
 	}
+	return "--" + name
 }
 
-// RateLimiter 频率限制器
-// 这个结构体实现了滑动窗口算法的频率限制功能，防止请求过于频繁
+// processURLArg 处理URL参数
+// 这个函数验证和处理WebSocket URL参数，确保URL的有效性
 //
-// 限流算法：
-//   - 滑动窗口：在指定时间窗口内限制最大请求数
-//   - 自动清理：过期的请求记录会被自动清理
-//   - 阻塞机制：超过限制时会阻塞一个时间窗口
+// 参数说明：
+//   - config: 客户端配置对象，用于存储验证后的URL
+//   - remainingArgs: 解析标志后剩余的非标志参数列表
 //
-// 工作原理：
-//  1. 记录每个请求的时间戳
-//  2. 检查时间窗口内的请求数量
-//  3. 超过限制时拒绝请求并记录违规
-//  4. 自动清理过期的请求记录
+// 返回值：
+//   - error: 处理失败时的错误信息
 //
-// 使用场景：
-//   - API频率限制：防止客户端过度调用
-//   - DoS防护：防止恶意的高频请求
-//   - 资源保护：保护后端服务不被压垮
-//   - 公平使用：确保所有用户的公平访问
+// 验证逻辑：
+//  1. 检查是否提供了URL参数
+//  2. 检查是否只有一个URL参数
+//  3. 验证URL格式的有效性
+//  4. 设置配置中的URL字段
 //
-// 并发安全：使用互斥锁保护所有字段的并发访问
-type RateLimiter struct {
-	maxRequests    int           // 最大请求数：在时间窗口内允许的最大请求数量
-	timeWindow     time.Duration // 时间窗口：限流的时间范围（如1分钟、1小时）
-	requests       []time.Time   // 请求时间记录：存储每个请求的时间戳，用于滑动窗口计算
-	mu             sync.Mutex    // 互斥锁：保护请求记录和状态的并发访问安全
-	blockedUntil   time.Time     // 阻塞截止时间：超过限制时的阻塞结束时间
-	violationCount int64         // 违规次数：累计超过频率限制的次数，用于监控和告警
-}
-
-// NewRateLimiter 创建频率限制器
-func NewRateLimiter(maxRequests int, timeWindow time.Duration) *RateLimiter {
-	return &RateLimiter{
-		maxRequests: maxRequests,
-		timeWindow:  timeWindow,
-		requests:    make([]time.Time, 0),
+// URL格式要求：
+//   - 必须以"ws://"或"wss://"开头
+//   - ws://: 非加密WebSocket连接
+//   - wss://: 加密WebSocket连接（推荐）
+//
+// 错误处理：
+//   - 未提供URL：显示使用说明并返回错误
+//   - 多个URL：提示参数重复错误
+//   - 无效格式：提示URL格式要求
+//
+// 使用示例：
+//   - 有效URL: "ws://localhost:8080/websocket"
+//   - 有效URL: "wss://api.example.com/ws"
+//   - 无效URL: "http://example.com" (不是WebSocket协议)
+func processURLArg(config *ClientConfig, remainingArgs []string) error {
+	// 第一步：检查是否提供了URL参数
+	if len(remainingArgs) == 0 {
+		showUsage()
+		return errors.New(tr("未指定WebSocket URL"))
 	}
-}
 
-// Allow 检查是否允许请求
-func (rl *RateLimiter) Allow() bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-
-	// 检查是否还在阻塞期
-	if now.Before(rl.blockedUntil) {
-		return false
+	// 第二步：检查是否只有一个URL参数
+	if len(remainingArgs) > 1 {
+		return fmt.Errorf(tr("⚠️ 参数过多或URL指定重复: '%s'"), strings.Join(remainingArgs, " "))
 	}
 
-	// 清理过期的请求记录
-	cutoff := now.Add(-rl.timeWindow)
-	validRequests := make([]time.Time, 0)
-	for _, reqTime := range rl.requests {
-		if reqTime.After(cutoff) {
-			validRequests = append(validRequests, reqTime)
-		}
+	// 第三步：验证URL格式
+	urlArg := remainingArgs[0]
+	if !isValidWebSocketURL(urlArg) {
+		return fmt.Errorf(tr("⚠️ 无效的WebSocket URL '%s'，必须以ws://或wss://开头"), urlArg)
 	}
-	rl.requests = validRequests
 
-	// 检查是否超过限制
-	if len(rl.requests) >= rl.maxRequests {
-		rl.violationCount++
-		rl.blockedUntil = now.Add(rl.timeWindow) // 阻塞一个时间窗口
-		log.Printf("⚠️ 频率限制触发: %d 请求在 %v 内，阻塞到 %v",
-			len(rl.requests), rl.timeWindow, rl.blockedUntil)
-		return false
+	// 第四步：合并--query指定的查询参数
+	if len(config.QueryParams) > 0 {
+		merged, err := mergeQueryParams(urlArg, config.QueryParams)
+		if err != nil {
+			return err
+		}
+		urlArg = merged
 	}
 
-	// 记录这次请求
-	rl.requests = append(rl.requests, now)
-	return true
+	// 第五步：设置配置中的URL
+	config.URL = urlArg
+	return nil
 }
 
-// GetStats 获取频率限制统计
-func (rl *RateLimiter) GetStats() map[string]any {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// mergeQueryParams 将--query参数合并到URL的查询字符串中
+// 参数值自动URL编码；同名参数覆盖URL中已有的值，多次指定同名参数时全部保留
+//
+// 参数说明：
+//   - rawURL: 命令行中的WebSocket URL
+//   - params: key=value形式的查询参数列表
+//
+// 返回值：
+//   - string: 合并后的URL
+//   - error: 参数格式错误或URL无法解析时的错误信息
+func mergeQueryParams(rawURL string, params []string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf(tr("⚠️ 无法解析URL '%s': %v"), rawURL, err)
+	}
 
-	return map[string]any{
-		"max_requests":     rl.maxRequests,
-		"time_window_ms":   rl.timeWindow.Milliseconds(),
-		"current_requests": len(rl.requests),
-		"violation_count":  rl.violationCount,
-		"blocked_until":    rl.blockedUntil,
-		"is_blocked":       time.Now().Before(rl.blockedUntil),
+	query := u.Query()
+	overridden := make(map[string]bool, len(params))
+	for _, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok || key == "" {
+			return "", fmt.Errorf(tr("⚠️ --query 参数值 '%s' 格式必须为 key=value"), param)
+		}
+		if !overridden[key] {
+			query.Del(key)
+			overridden[key] = true
+		}
+		query.Add(key, value)
 	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
 }
 
-// ConnectionStats 连接统计信息
-// 这个结构体记录WebSocket连接的详细统计数据，用于监控、分析和调试
-// 提供全面的连接性能指标和错误统计，支持JSON序列化便于数据导出
+// showVersion 显示版本号
+// 这个函数显示应用程序的简洁版本信息
 //
-// 统计分类：
-//  1. 时间统计：连接时间、消息时间、持续时间
-//  2. 消息统计：发送和接收的消息数量及字节数
-//  3. 连接统计：重连次数和连接状态
-//  4. 错误统计：详细的错误分类和趋势
+// 输出格式：
+//   - "应用名称 v版本号"
+//   - 例如："wsc v1.0.0"
 //
 // 使用场景：
-//   - 性能监控：实时监控连接性能和消息吞吐量
-//   - 问题诊断：分析连接问题和错误模式
-//   - 容量规划：基于历史数据进行容量规划
-//   - 告警系统：设置阈值进行自动告警
+//   - 用户使用--version参数查询版本
+//   - 脚本中检查程序版本
+//   - 快速确认程序版本信息
 //
-// 数据精度：
-//   - 时间精度：纳秒级别，适合高精度性能分析
-//   - 计数精度：64位整数，支持长期运行的大量数据
-//   - 错误精度：详细的错误分类和趋势分析
-type ConnectionStats struct {
-	ConnectTime      time.Time     `json:"connect_time"`      // 连接建立时间：记录WebSocket连接成功建立的时间戳，用于计算连接持续时间
-	LastMessageTime  time.Time     `json:"last_message_time"` // 最后消息时间：记录最近一次收到或发送消息的时间，用于检测连接活跃度
-	MessagesSent     int64         `json:"messages_sent"`     // 发送消息数：累计发送的消息总数，包括文本、二进制和控制消息
-	MessagesReceived int64         `json:"messages_received"` // 接收消息数：累计接收的消息总数，用于计算消息吞吐量
-	BytesSent        int64         `json:"bytes_sent"`        // 发送字节数：累计发送的数据总量（字节），用于带宽使用分析
-	BytesReceived    int64         `json:"bytes_received"`    // 接收字节数：累计接收的数据总量（字节），用于流量统计
-	ReconnectCount   int           `json:"reconnect_count"`   // 重连次数：记录连接断开后的重连尝试次数，用于稳定性分析
-	Uptime           time.Duration `json:"uptime"`            // 连接持续时间：当前连接已经保持的时间长度，实时更新
-	Errors           ErrorStats    `json:"errors"`            // 错误统计：详细的错误分类、计数和趋势数据，用于问题诊断
+// 与showBuildInfo的区别：
+//   - showVersion: 只显示基本版本信息
+//   - showBuildInfo: 显示详细的构建和系统信息
+func showVersion() {
+	fmt.Printf("%s v%s\n", AppName, AppVersion)
 }
 
-// ===== WebSocket客户端主体实现 =====
-// 高性能WebSocket客户端的核心实现，包含连接管理、消息处理、错误恢复等功能
-
-// WebSocketClient 代表一个高性能的 WebSocket 客户端实例
-// 这是整个WebSocket客户端的核心结构体，集成了连接管理、消息处理、错误恢复等功能
+// formatBuildTime 格式化构建时间，支持多种时间格式
+// 这个函数将构建时间字符串转换为用户友好的本地时间格式
 //
-// 主要特性：
-//  1. 自动重连：连接断开时自动尝试重新连接
-//  2. 并发安全：使用锁机制保护共享资源，支持多goroutine并发访问
-//  3. 优雅关闭：正确处理关闭信号，清理所有资源
-//  4. 性能监控：实时统计连接状态、消息数量、错误信息等
-//  5. 事件驱动：支持自定义回调函数处理各种事件
-//  6. 日志记录：可选的消息日志记录功能
+// 参数说明：
+//   - buildTime: 构建时间字符串，可能来自不同的构建系统
 //
-// 设计模式：
-//   - 使用依赖注入模式，支持自定义连接器、消息处理器等组件
-//   - 采用事件驱动架构，通过回调函数处理各种事件
-//   - 实现了优雅关闭模式，确保资源正确释放
+// 返回值：
+//   - string: 格式化后的时间字符串，包含本地时间和时区信息
 //
-// 并发安全性：
-//   - 使用原子操作处理状态和计数器
-//   - 使用读写锁保护共享资源
-//   - 使用专用锁防止WebSocket并发写入
-type WebSocketClient struct {
-	// ===== 配置和连接管理 =====
-	config *ClientConfig   `json:"-"` // 客户端配置：包含URL、超时、重试等所有配置参数
-	conn   *websocket.Conn `json:"-"` // WebSocket连接：底层的WebSocket连接对象
-
-	// ===== 生命周期管理 =====
-	ctx    context.Context    `json:"-"` // 生命周期管理上下文：用于控制所有goroutine的生命周期
-	cancel context.CancelFunc `json:"-"` // 取消函数：调用此函数可以优雅地关闭客户端
-
-	// ===== 并发控制机制 =====
-	mu      sync.RWMutex   `json:"-"` // 读写锁：保护共享资源，读多写少的场景下性能更好
-	writeMu sync.Mutex     `json:"-"` // 写操作专用锁：防止多个goroutine同时写入WebSocket（WebSocket不支持并发写）
-	wg      sync.WaitGroup `json:"-"` // 等待组：管理所有goroutine，确保优雅关闭时所有goroutine都已结束
-
-	// ===== 状态管理（原子操作） =====
-	State      int32  `json:"state"`       // 连接状态：使用原子操作确保并发安全（StateDisconnected/StateConnecting等）
-	RetryCount int32  `json:"retry_count"` // 重试计数：记录重连尝试次数，使用原子操作确保并发安全
-	SessionID  string `json:"session_id"`  // 会话ID：唯一标识这个连接会话，用于日志跟踪和问题诊断
-
-	// ===== 定时器和统计信息 =====
-	pingTicker *time.Ticker    `json:"-"`     // Ping定时器：定期发送ping消息保持连接活跃
-	Stats      ConnectionStats `json:"stats"` // 连接统计：记录消息数量、错误次数、连接时间等统计信息
-
-	// ===== 事件回调函数 =====
-	// 这些回调函数实现了事件驱动架构，让用户可以自定义各种事件的处理逻辑
-	onConnect    func()                                   `json:"-"` // 连接成功回调：连接建立时调用
-	onDisconnect func(error)                              `json:"-"` // 断开连接回调：连接断开时调用，参数是断开原因
-	onMessage    func(messageType int, data []byte) error `json:"-"` // 消息处理回调：收到消息时调用
-	onError      func(error)                              `json:"-"` // 错误处理回调：发生错误时调用
+// 支持的输入格式：
+//  1. "2006-01-02 15:04:05 MST" - 新格式，包含时区
+//  2. "2006-01-02_15:04:05_MST" - 旧格式，下划线分隔
+//  3. "2006-01-02_15:04:05_UTC" - UTC格式
+//  4. "2006-01-02T15:04:05Z07:00" - ISO 8601格式
+//  5. "2006-01-02 15:04:05" - 简单格式，无时区
+//
+// 输出格式：
+//   - "2024-01-02 15:04:05 CST (UTC+08:00)"
+//   - 包含本地时间、时区名称和UTC偏移
+//
+// 处理逻辑：
+//  1. 检查特殊值（"unknown"或空字符串）
+//  2. 按优先级尝试解析不同格式
+//  3. 转换为本地时间并格式化
+//  4. 解析失败时返回原始字符串
+//
+// 时区处理：
+//   - 自动转换为系统本地时区
+//   - 显示时区名称和UTC偏移
+//   - 支持夏令时自动调整
+//
+// 使用场景：
+//   - showBuildInfo中显示构建时间
+//   - 日志记录中的时间格式化
+//   - 用户界面的时间显示
+func formatBuildTime(buildTime string) string {
+	// 第一步：处理特殊值
+	if buildTime == "unknown" || buildTime == "" {
+		return "unknown"
+	}
 
-	// ===== 日志记录功能 =====
-	logFile *os.File `json:"-"` // 消息日志文件句柄：用于记录所有收发的消息，便于调试和审计
+	// 第二步：定义支持的时间格式（按常见程度排序）
+	formats := []string{
+		"2006-01-02 15:04:05 MST",   // 新格式：2024-01-02 15:04:05 CST
+		"2006-01-02_15:04:05_MST",   // 旧格式：2024-01-02_15:04:05_CST
+		"2006-01-02_15:04:05_UTC",   // UTC格式：2024-01-02_15:04:05_UTC
+		"2006-01-02T15:04:05Z07:00", // ISO格式：2024-01-02T15:04:05+08:00
+		"2006-01-02 15:04:05",       // 简单格式：2024-01-02 15:04:05
+	}
 
-	// 监控和指标
-	metrics       PrometheusMetrics `json:"-"` // Prometheus指标
-	metricsServer *http.Server      `json:"-"` // 指标服务器
-	healthServer  *http.Server      `json:"-"` // 健康检查服务器
+	// 第三步：尝试解析不同格式
+	for _, format := range formats {
+		if t, err := time.Parse(format, buildTime); err == nil {
+			// 第四步：转换为本地时间并格式化
+			localTime := t.Local()
+			return localTime.Format("2006-01-02 15:04:05 MST (UTC" + localTime.Format("-07:00") + ")")
+		}
+	}
 
-	// goroutine泄漏检测
-	goroutineTracker *GoroutineTracker `json:"-"` // goroutine跟踪器
+	// 第五步：如果无法解析，返回原始字符串
+	return buildTime
+}
 
-	// ===== 核心组件 =====
-	connector        Connector        `json:"-"` // 连接器
-	messageProcessor MessageProcessor `json:"-"` // 消息处理器
-	errorRecovery    ErrorRecovery    `json:"-"` // 错误恢复器
+// showBuildInfo 显示详细构建信息
+// 这个函数提供完整的应用程序构建和运行时信息，用于调试和系统分析
+//
+// 显示的信息分类：
+//  1. 构建信息：版本、构建时间、Git提交、Go版本
+//  2. 系统信息：操作系统、架构、编译器、CPU核心数
+//  3. 运行时信息：内存分配、系统内存、GC次数
+//
+// 构建信息来源：
+//   - AppVersion: 应用程序版本号（编译时注入）
+//   - BuildTime: 构建时间戳（编译时注入）
+//   - GitCommit: Git提交哈希（编译时注入）
+//   - GoVersion: Go编译器版本（编译时注入）
+//
+// 系统信息来源：
+//   - runtime.GOOS: 目标操作系统
+//   - runtime.GOARCH: 目标架构
+//   - runtime.Compiler: 编译器类型
+//   - runtime.NumCPU(): CPU核心数
+//
+// 内存信息说明：
+//   - Alloc: 当前分配的堆内存
+//   - Sys: 从系统获取的总内存
+//   - NumGC: 垃圾回收执行次数
+//
+// 使用场景：
+//   - 问题诊断和调试
+//   - 系统兼容性检查
+//   - 性能分析和优化
+//   - 部署环境验证
+func showBuildInfo() {
+	// 显示标题和分隔线
+	fmt.Printf("📋 %s 构建信息\n", AppName)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
-	// ===== 新增：高级功能 =====
-	AutoRecovery       bool                `json:"auto_recovery"`   // 自动错误恢复
-	AdaptiveBuffer     bool                `json:"adaptive_buffer"` // 自适应缓冲区
-	deadlockDetector   *DeadlockDetector   `json:"-"`               // 死锁检测器
-	performanceMonitor *PerformanceMonitor `json:"-"`               // 性能监控器
+	// 构建信息部分
+	fmt.Printf("版本:       %s\n", AppVersion)
+	fmt.Printf("构建时间:   %s\n", formatBuildTime(BuildTime))
+	fmt.Printf("Git提交:    %s\n", GitCommit)
+	fmt.Printf("Go版本:     %s\n", GoVersion)
 
-	// ===== 新增：配置热重载 =====
-	HotReloadEnabled bool `json:"hot_reload"` // 是否启用热重载
+	// 系统信息部分
+	fmt.Printf("操作系统:   %s\n", runtime.GOOS)
+	fmt.Printf("架构:       %s\n", runtime.GOARCH)
+	fmt.Printf("编译器:     %s\n", runtime.Compiler)
+	fmt.Printf("CPU核心:    %d\n", runtime.NumCPU())
 
-	// ===== 新增：安全功能 =====
-	securityChecker *SecurityChecker `json:"-"` // 安全检查器
-	rateLimiter     *RateLimiter     `json:"-"` // 频率限制器
+	// 运行时内存信息部分
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fmt.Printf("内存分配:   %d KB\n", m.Alloc/1024)
+	fmt.Printf("系统内存:   %d KB\n", m.Sys/1024)
+	fmt.Printf("GC次数:     %d\n", m.NumGC)
 }
 
-// NewWebSocketClient 创建并初始化一个新的 WebSocketClient 实例
-// 这是客户端的主要构造函数，负责初始化所有组件和功能
-// 采用分阶段初始化的方式，确保每个组件都正确设置
-//
-// 参数说明：
-//   - config: 客户端配置，如果为nil则使用默认配置
-//
-// 返回值：
-//   - *WebSocketClient: 完全初始化的客户端实例
-//
-// 初始化阶段：
-//  1. createClientInstance: 创建基础实例和上下文
-//  2. initializeCoreComponents: 初始化核心组件（连接器、处理器等）
-//  3. initializeAdvancedFeatures: 初始化高级功能（监控、性能优化等）
-//  4. initializeSecurityFeatures: 初始化安全功能（检查器、限流器等）
-//  5. finalizeInitialization: 完成最终初始化（会话ID、统计等）
-//
-// 使用示例：
+// performHealthCheck 执行自检并返回状态码
+// 这个函数执行全面的应用程序健康检查，验证各个组件的运行状态
 //
-//	// 基本用法
-//	config := NewDefaultConfig("wss://example.com/ws")
-//	client := NewWebSocketClient(config)
+// 检查项目：
+//  1. Go运行时版本检查
+//  2. 内存使用状态检查
+//  3. Goroutine数量检查
+//  4. 构建信息完整性检查
 //
-//	// 设置事件处理器
-//	client.SetEventHandlers(onConnect, onDisconnect, onMessage, onError)
+// 检查标准：
+//   - 内存使用：< 100MB 为正常，>= 100MB 为偏高
+//   - Goroutine数量：< 100 为正常，>= 100 为偏多
+//   - 构建信息：BuildTime、GitCommit、GoVersion 都不为"unknown"
 //
-//	// 启动客户端（非阻塞）
-//	go client.Start()
+// 输出格式：
+//   - ✅ 表示检查通过
+//   - ⚠️ 表示检查发现问题但不影响运行
+//   - ❌ 表示检查失败（当前版本无此状态）
 //
-//	// 程序结束时优雅关闭
-//	defer client.Stop()
+// 使用场景：
+//   - 部署前的健康验证
+//   - 运行时状态监控
+//   - 问题诊断和调试
+//   - 自动化测试中的状态检查
 //
-// 注意事项：
-//   - 客户端创建后需要调用Start()方法才会开始连接
-//   - 建议使用defer client.Stop()确保资源正确释放
-//   - 如果需要自定义组件，应在调用Start()之前设置
-func NewWebSocketClient(config *ClientConfig) *WebSocketClient {
-	// 第一步：参数验证，确保配置不为空
-	if config == nil {
-		config = NewDefaultConfig("") // 使用默认配置
+// 退出行为：
+//   - 检查完成后程序会退出（os.Exit(0)）
+//   - 适用于脚本和自动化工具调用
+func performHealthCheck() {
+	// 显示标题和分隔线
+	fmt.Printf("🔍 %s 健康检查\n", AppName)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	// 第一项：检查Go运行时版本
+	fmt.Printf("✅ Go运行时: %s\n", runtime.Version())
+
+	// 第二项：检查内存使用状态
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	if m.Alloc < 100*1024*1024 { // 小于100MB
+		fmt.Printf("✅ 内存使用: %d KB (正常)\n", m.Alloc/1024)
+	} else {
+		fmt.Printf("⚠️ 内存使用: %d KB (偏高)\n", m.Alloc/1024)
 	}
 
-	// 第二步：分阶段初始化，确保每个组件都正确设置
-	client := createClientInstance(config)    // 创建基础实例
-	client.initializeCoreComponents(config)   // 初始化核心组件
-	client.initializeAdvancedFeatures()       // 初始化高级功能
-	client.initializeSecurityFeatures(config) // 初始化安全功能
-	client.finalizeInitialization(config)     // 完成最终初始化
+	// 第三项：检查goroutine数量
+	numGoroutines := runtime.NumGoroutine()
+	if numGoroutines < 100 {
+		fmt.Printf("✅ Goroutines: %d (正常)\n", numGoroutines)
+	} else {
+		fmt.Printf("⚠️ Goroutines: %d (偏多)\n", numGoroutines)
+	}
 
-	return client
+	// 第四项：检查构建信息完整性
+	if BuildTime != "unknown" && GitCommit != "unknown" && GoVersion != "unknown" {
+		fmt.Println("✅ 构建信息: 完整")
+	} else {
+		fmt.Println("⚠️ 构建信息: 不完整")
+	}
+
+	// 显示完成信息
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Println("🎉 健康检查完成")
 }
 
-// createClientInstance 创建客户端基础实例
-// 这是初始化过程的第一阶段，创建客户端的基础结构和必要的上下文
-//
-// 参数说明：
-//   - config: 客户端配置
-//
-// 返回值：
-//   - *WebSocketClient: 基础实例，包含基本的状态和统计结构
+// showUsage 将命令行使用说明打印到控制台
+// 这个函数提供完整的命令行帮助信息，包括所有可用参数、使用示例和常见用法场景
+// 当用户输入-h、--help或参数错误时会调用此函数
 //
-// 初始化内容：
-//  1. 创建生命周期管理的上下文和取消函数
-//  2. 设置初始连接状态为未连接
-//  3. 生成唯一的会话ID用于跟踪
-//  4. 初始化统计信息结构（预分配容量以提高性能）
-//  5. 创建goroutine跟踪器防止泄漏
+// 帮助信息结构：
+//  1. 程序标题和版本信息
+//  2. 基本使用方法和帮助命令
+//  3. 公共测试服务器示例
+//  4. 自定义使用示例
+//  5. 详细参数分类说明
+//  6. 监控功能和交互模式说明
+//  7. 智能重试策略说明
+//  8. 主要特性总结
 //
-// 性能优化：
-//   - 预分配map容量减少动态扩容开销
-//   - 使用合理的初始容量避免内存浪费
-func createClientInstance(config *ClientConfig) *WebSocketClient {
-	// 创建可取消的上下文，用于控制所有goroutine的生命周期
-	ctx, cancel := context.WithCancel(context.Background())
+// 设计原则：
+//   - 信息层次清晰，便于快速查找
+//   - 提供实际可用的示例
+//   - 使用emoji增强可读性
+//   - 涵盖所有功能和参数
+//   - 突出企业级特性和性能优势
+func showUsage() {
+	writeUsage(os.Stdout)
+}
 
-	return &WebSocketClient{
-		// 基础配置和上下文
-		config: config,
-		ctx:    ctx,
-		cancel: cancel,
+// writeUsage 将命令行使用说明写入w
+// 选项部分由optionGroups生成，与参数解析和补全脚本使用同一份选项定义
+func writeUsage(w io.Writer) {
+	fmt.Fprintf(w, tr("📋 %s v%s - 高性能 WebSocket 客户端\n"), AppName, AppVersion)
+	fmt.Fprintln(w, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("🚀 使用方法:"))
+	fmt.Fprintln(w, tr("  ./wsc [选项] <WebSocket_URL>"))
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(w, "  ./wsc %s %s  %s\n", cmd.name, tr(cmd.usage), tr(cmd.summary))
+	}
+	fmt.Fprintln(w, tr("  ./wsc [选项] -- <WebSocket_URL>  \"--\"之后的参数不再按标志解析"))
+	fmt.Fprintln(w, tr("  ./wsc <子命令> -h  显示子命令的用法和选项"))
+	fmt.Fprintln(w, tr("  ./wsc -h, --help              显示此帮助信息"))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("🌐 公共测试服务器:"))
+	fmt.Fprintln(w, "  ./wsc -n wss://echo.websocket.org")
+	fmt.Fprintln(w, "  ./wsc ws://echo.websocket.org")
+	fmt.Fprintln(w, "  ./wsc -n wss://ws.postman-echo.com/raw")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("📋 自定义示例:"))
+	fmt.Fprintln(w, "  ./wsc ws://localhost:8080/websocket")
+	fmt.Fprintln(w, "  ./wsc -n wss://example.com:8765/websocket")
+	fmt.Fprintln(w, "  ./wsc -f wss://secure-api.example.com/ws")
+	fmt.Fprintln(w, "  ./wsc -v -r 10 -t 5 wss://api.example.com/ws")
+	fmt.Fprintln(w)
+	writeOptionGroups(w, optionGroups(NewDefaultConfig(""), new(bool), showUsage))
+	fmt.Fprintln(w, tr("🤫 静默输出模式:"))
+	fmt.Fprintln(w, tr("    ./wsc -q ws://host/ws > data.jsonl  抓取消息到文件，文本消息每条一行"))
+	fmt.Fprintln(w, tr("    二进制消息输出为 4字节大端长度 + 原始数据"))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("📝 消息日志功能:"))
+	fmt.Fprintln(w, tr("    -l                    自动生成日志文件名"))
+	fmt.Fprintln(w, tr("    -l mylog.txt          指定日志文件名"))
+	fmt.Fprintln(w, tr("    --log-file /path/to/websocket.log  完整路径"))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("📊 监控功能示例:"))
+	fmt.Fprintln(w, tr("    --metrics             启用默认端口监控 (9090/8080)"))
+	fmt.Fprintln(w, tr("    --metrics-port 9091   自定义指标端口"))
+	fmt.Fprintln(w, tr("    --health-port 8081    自定义健康检查端口"))
+	fmt.Fprintln(w, tr("  访问:"))
+	fmt.Fprintln(w, tr("    http://localhost:9090/metrics     Prometheus指标"))
+	fmt.Fprintln(w, tr("    http://localhost:8080/health      健康检查"))
+	fmt.Fprintln(w, tr("    http://localhost:8080/ready       就绪检查"))
+	fmt.Fprintln(w, tr("    http://localhost:8080/stats       详细统计"))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("💬 交互式模式:"))
+	fmt.Fprintln(w, tr("    -i                    启用后可通过键盘输入发送消息"))
+	fmt.Fprintln(w, tr("    特殊命令:"))
+	fmt.Fprintln(w, tr("      /quit               退出程序"))
+	fmt.Fprintln(w, tr("      /ping               发送 ping 消息"))
+	fmt.Fprintln(w, tr("      /stats              显示连接统计信息"))
+	fmt.Fprintln(w, tr("      /state              显示连接状态"))
+	fmt.Fprintln(w, tr("      /reconnect          强制断开并重新连接"))
+	fmt.Fprintln(w, tr("      /pause, /resume     暂停/恢复收到消息的输出"))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("🔄 智能重试策略:"))
+	fmt.Fprintln(w, tr("    -r N: 前N次快速重试 + 后N次慢速重试"))
+	fmt.Fprintln(w, tr("    -r 0: 前5次快速重试 + 无限慢速重试"))
+	fmt.Fprintln(w, tr("  示例:"))
+	fmt.Fprintln(w, tr("    -r 3: 3次快速 + 3次慢速 = 总共6次"))
+	fmt.Fprintln(w, tr("    -r 5: 5次快速 + 5次慢速 = 总共10次"))
+	fmt.Fprintln(w, tr("    -r 0 --max-retry-duration 10m: 无限重试，但10分钟内未连上则退出"))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("🔐 TLS证书验证选项:"))
+	fmt.Fprintln(w, tr("    默认行为: 跳过证书验证，显示安全警告"))
+	fmt.Fprintln(w, tr("    -n: 跳过证书验证，不显示警告 (开发环境)"))
+	fmt.Fprintln(w, tr("    -f: 强制启用证书验证 (生产环境推荐)"))
+	fmt.Fprintln(w, tr("  注意: -f 和 -n 不能同时使用，-f 优先级更高"))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("✨ 主要特性:"))
+	fmt.Fprintln(w, tr("    • 自动重连和智能重试"))
+	fmt.Fprintln(w, tr("    • 并发安全和优雅关闭"))
+	fmt.Fprintln(w, tr("    • 详细的连接统计信息"))
+	fmt.Fprintln(w, tr("    • 支持自定义事件处理"))
+	fmt.Fprintln(w, tr("    • 完善的错误分类处理"))
+	fmt.Fprintln(w, tr("    • 灵活的TLS安全配置"))
+}
 
-		// 初始状态设置
-		State:     int32(StateDisconnected), // 初始状态为未连接
-		SessionID: generateSessionID(),      // 生成唯一会话ID
+// writeCommandUsage 将子命令的使用说明写入w，只列出该子命令接受的选项
+//
+// 参数说明：
+//   - w: 输出目标
+//   - cmd: 子命令
+func writeCommandUsage(w io.Writer, cmd *cliCommand) {
+	fmt.Fprintf(w, "📋 wsc %s - %s\n", cmd.name, tr(cmd.summary))
+	fmt.Fprintln(w, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("🚀 使用方法:"))
+	if cmd.name == connectSubcommand {
+		fmt.Fprintln(w, tr("  ./wsc [选项] <WebSocket_URL>"))
+	}
+	fmt.Fprintf(w, "  ./wsc %s %s\n", cmd.name, tr(cmd.usage))
+	fmt.Fprintln(w)
+	writeOptionGroups(w, cmd.optionGroups(NewDefaultConfig(""), new(bool), showUsage))
+}
 
-		// 统计信息初始化（预分配容量提高性能）
-		Stats: ConnectionStats{
-			Errors: ErrorStats{
-				ErrorsByCode: make(map[ErrorCode]int64, 20),   // 预分配20种错误类型的容量
-				ErrorTrend:   make([]ErrorTrendPoint, 0, 100), // 预分配100个趋势点的容量
-			},
-		},
+// usageColumn 使用说明中选项说明的起始列（按终端显示宽度计算）
+const usageColumn = 26
+
+// writeOptionGroups 将选项分组写入w，每组之后空一行
+func writeOptionGroups(w io.Writer, groups []cliOptionGroup) {
+	for _, group := range groups {
+		fmt.Fprintln(w, tr(group.title))
+		for _, option := range group.options {
+			spec := "    " + option.flagNames()
+			if option.arg != "" {
+				spec += " " + tr(option.arg)
+			}
+			// 选项名过长时说明与选项名之间至少保留两个空格
+			padding := max(usageColumn-displayWidth(spec), 2)
+			fmt.Fprintf(w, "%s%s%s\n", spec, strings.Repeat(" ", padding), tr(option.usage))
+		}
+		for _, note := range group.notes {
+			fmt.Fprintln(w, tr(note))
+		}
+		fmt.Fprintln(w)
+	}
+}
 
-		// Prometheus指标初始化
-		metrics: PrometheusMetrics{
-			ErrorsByCodeTotal: make(map[ErrorCode]int64, 20), // 预分配错误码统计容量
-		},
+// showCertificateWarning 当连接到WSS服务器并跳过证书验证时，在控制台显示警告信息
+// 这个函数提供重要的安全提示，确保用户了解跳过证书验证的风险
+//
+// 调用时机：
+//   - URL以"wss://"开头（HTTPS WebSocket）
+//   - 用户没有使用-n参数跳过警告
+//   - 程序启动时自动检查
+//
+// 警告内容：
+//  1. 明确说明正在跳过证书验证
+//  2. 解释安全风险和适用场景
+//  3. 提供解决方案建议
+//  4. 说明如何跳过此警告
+//
+// 安全考虑：
+//   - 中间人攻击风险：攻击者可能拦截和修改通信
+//   - 身份验证缺失：无法确认服务器身份
+//   - 数据完整性：传输数据可能被篡改
+//
+// 适用场景：
+//   - 开发环境测试
+//   - 自签名证书服务器
+//   - 内网环境快速连接
+//   - 证书配置问题的临时解决方案
+func showCertificateWarning() {
+	fmt.Println("🔐 WSS连接证书警告")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Println("⚠️  正在使用WSS连接，将自动跳过证书验证")
+	fmt.Println("📋 这意味着:")
+	fmt.Println("   • 不会验证服务器证书的有效性")
+	fmt.Println("   • 可能存在中间人攻击风险")
+	fmt.Println("   • 适用于开发环境和自签名证书")
+	fmt.Println("")
+	fmt.Println("💡 如需严格证书验证，请联系服务器管理员配置有效证书")
+	fmt.Println("🚀 要跳过此警告，请使用 -n 参数")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Println("")
+}
 
-		// goroutine泄漏跟踪器（最大存活5分钟，最多10个goroutine）
-		goroutineTracker: NewGoroutineTracker(5*time.Minute, 10),
-	}
+// showTLSVerificationInfo 当启用强制TLS证书验证时，显示安全信息
+// 这个函数提供TLS安全验证的相关信息，确保用户了解安全连接的重要性
+//
+// 调用时机：
+//   - URL以"wss://"开头（HTTPS WebSocket）
+//   - 用户使用了-f参数强制启用证书验证
+//   - 程序启动时自动检查
+//
+// 信息内容：
+//  1. 说明正在使用严格的TLS证书验证
+//  2. 解释安全优势和连接要求
+//  3. 提供证书问题的解决建议
+//  4. 说明与默认行为的区别
+//
+// 适用场景：
+//   - 生产环境连接
+//   - 安全要求较高的环境
+//   - 需要验证服务器身份的场景
+//   - 防止中间人攻击的连接
+func showTLSVerificationInfo() {
+	fmt.Println("🔒 TLS安全验证模式")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Println("✅ 已启用严格的TLS证书验证")
+	fmt.Println("📋 这意味着:")
+	fmt.Println("   • 将验证服务器证书的有效性")
+	fmt.Println("   • 检查证书链的完整性")
+	fmt.Println("   • 验证服务器身份匹配")
+	fmt.Println("   • 防止中间人攻击")
+	fmt.Println("")
+	fmt.Println("🛡️  安全优势:")
+	fmt.Println("   • 确保连接到正确的服务器")
+	fmt.Println("   • 保护数据传输安全")
+	fmt.Println("   • 符合生产环境安全要求")
+	fmt.Println("")
+	fmt.Println("⚠️  注意事项:")
+	fmt.Println("   • 服务器必须配置有效的SSL证书")
+	fmt.Println("   • 自签名证书将导致连接失败")
+	fmt.Println("   • 证书过期或域名不匹配会被拒绝")
+	fmt.Println("")
+	fmt.Println("💡 如遇证书问题，请联系服务器管理员或使用默认模式")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Println("")
 }
 
-// initializeCoreComponents 初始化核心组件
-// 这是初始化过程的第二阶段，设置WebSocket连接和消息处理的核心组件
+// logStartupInfo 在客户端启动时记录有关其配置的初始信息
+// 这个函数提供详细的启动日志，便于调试、监控和问题诊断
 //
 // 参数说明：
-//   - config: 客户端配置，用于配置各个组件的参数
+//   - config: 客户端配置实例，包含所有运行参数
+//   - sessionID: 唯一会话标识符，用于跟踪和关联日志
 //
-// 初始化的核心组件：
-//  1. connector: WebSocket连接器，负责建立和管理连接
-//  2. messageProcessor: 消息处理器，负责处理收发的消息
-//  3. errorRecovery: 错误恢复器，负责处理连接错误和重试逻辑
+// 记录的信息：
+//  1. 应用程序名称和版本
+//  2. 目标WebSocket服务器地址
+//  3. 会话ID（用于日志关联）
+//  4. 智能重试策略配置
+//  5. 超时配置详情
+//  6. 缓冲区大小设置
+//  7. 重试间隔配置
+//  8. 日志级别设置
 //
-// 这些组件采用依赖注入模式，可以在运行时替换为自定义实现
-func (c *WebSocketClient) initializeCoreComponents(config *ClientConfig) {
-	// 初始化WebSocket连接器（负责连接建立和管理）
-	c.connector = NewDefaultConnector()
+// 使用场景：
+//   - 程序启动时的配置确认
+//   - 问题诊断和调试
+//   - 运维监控和日志分析
+//   - 配置审计和合规检查
+//
+// 日志格式：
+//   - 使用emoji增强可读性
+//   - 结构化信息便于解析
+//   - 包含关键配置参数
+func logStartupInfo(config *ClientConfig, sessionID string) {
+	// 基本信息记录
+	log.Printf(tr("🚀 启动 %s v%s"), AppName, AppVersion)
+	log.Printf(tr("📍 目标URL: %s"), config.URL)
+	log.Printf(tr("🔗 会话ID: %s"), sessionID)
 
-	// 初始化消息处理器（负责消息验证和处理）
-	c.messageProcessor = NewDefaultMessageProcessor(config.MaxMessageSize, false)
+	// 智能重试策略信息
+	if config.MaxRetries == 0 {
+		log.Print(tr("🔄 智能重试: 5次快速 + 无限慢速重试"))
+	} else {
+		totalRetries := config.MaxRetries * 2
+		log.Printf(tr("🔄 智能重试: %d次快速 + %d次慢速 = 总共%d次"),
+			config.MaxRetries, config.MaxRetries, totalRetries)
+	}
 
-	// 初始化错误恢复器（负责错误处理和重试逻辑）
-	c.errorRecovery = NewDefaultErrorRecovery(config.MaxRetries, config.RetryDelay)
-}
+	// 超时配置信息
+	log.Printf(tr("⏱️  超时配置: 握手=%v, 读取=%v, 写入=%v, Ping间隔=%v"),
+		config.HandshakeTimeout, config.ReadTimeout, config.WriteTimeout, config.PingInterval)
 
-// initializeAdvancedFeatures 初始化高级功能
-// 这是初始化过程的第三阶段，设置性能优化和监控相关的高级功能
-//
-// 初始化的高级功能：
-//  1. AutoRecovery: 自动错误恢复功能
-//  2. AdaptiveBuffer: 自适应缓冲区功能
-//  3. deadlockDetector: 死锁检测器
-//  4. performanceMonitor: 性能监控器
-//  5. HotReloadEnabled: 热重载功能（默认关闭）
-//
-// 这些功能提供了企业级的监控和性能优化能力
-func (c *WebSocketClient) initializeAdvancedFeatures() {
-	// 启用自动错误恢复（连接断开时自动重连）
-	c.AutoRecovery = true
+	// 缓冲区配置信息
+	log.Printf(tr("📦 缓冲区配置: 读取=%d字节, 写入=%d字节, 最大消息=%d字节"),
+		config.ReadBufferSize, config.WriteBufferSize, config.MaxMessageSize)
 
-	// 启用自适应缓冲区（根据消息大小动态调整缓冲区）
-	c.AdaptiveBuffer = true
+	// 重试间隔信息
+	log.Printf(tr("⏳ 慢速重试间隔: %v"), config.RetryDelay)
+	if config.MaxRetryDuration > 0 {
+		log.Printf(tr("⌛ 重试总时长上限: %v"), config.MaxRetryDuration)
+	}
 
-	// 初始化死锁检测器（30秒超时检测）
-	c.deadlockDetector = NewDeadlockDetector(30 * time.Second)
+	// 自动退出条件信息
+	if config.hasExitConditions() {
+		log.Printf(tr("🏁 自动退出条件: 空闲超时=%v, 最大消息数=%d, 最长运行=%v (0表示不限制)"),
+			config.IdleTimeout, config.MaxMessages, config.MaxDuration)
+	}
 
-	// 初始化性能监控器（监控CPU、内存等系统资源）
-	c.performanceMonitor = NewPerformanceMonitor()
+	// 名称解析信息
+	for hostPort, addr := range config.ResolveOverrides {
+		log.Printf(tr("🧭 解析覆盖: %s -> %s"), hostPort, addr)
+	}
+	if config.DNSServer != "" {
+		log.Printf(tr("🌐 自定义DNS服务器: %s"), config.DNSServer)
+	}
+	if config.DNSCacheTTL > 0 {
+		log.Printf(tr("🌐 DNS缓存: 解析结果保留 %v"), config.DNSCacheTTL)
+	}
 
-	// 热重载功能默认关闭（可在运行时启用）
-	c.HotReloadEnabled = false
+	// 日志级别信息
+	logLevels := []string{"ERROR", "WARN", "INFO", "DEBUG"}
+	if config.LogLevel >= 0 && config.LogLevel < len(logLevels) {
+		log.Printf(tr("📝 日志级别: %s"), logLevels[config.LogLevel])
+	}
 }
 
-// initializeSecurityFeatures 初始化安全功能
-// 这是初始化过程的第四阶段，设置安全检查和防护相关的功能
+// main 是 WebSocket 客户端应用程序的入口点
+// 这是整个程序的控制中心，负责协调各个组件的初始化和运行
 //
-// 参数说明：
-//   - config: 客户端配置，用于配置安全组件的参数
+// 主要职责：
+//  1. 命令行参数解析和验证
+//  2. 客户端实例创建和配置
+//  3. 信号处理和优雅关闭
+//  4. 交互模式和监控服务启动
+//  5. 程序生命周期管理
 //
-// 初始化的安全功能：
-//  1. securityChecker: 安全检查器，验证消息内容和格式
-//  2. rateLimiter: 频率限制器，防止消息发送过载
+// 执行流程：
 //
-// 这些功能提供了企业级的安全防护能力
-func (c *WebSocketClient) initializeSecurityFeatures(config *ClientConfig) {
-	// 初始化安全检查器（验证消息大小和内容）
-	c.securityChecker = NewSecurityChecker(config.MaxMessageSize)
-
-	// 初始化频率限制器（每分钟最多100条消息）
-	c.rateLimiter = NewRateLimiter(100, time.Minute)
-}
-
-// finalizeInitialization 完成初始化设置
-func (c *WebSocketClient) finalizeInitialization(config *ClientConfig) {
-	c.setDefaultHandlers()
-
-	if err := c.initMessageLog(); err != nil {
-		log.Printf("⚠️ 初始化消息日志失败: %v", err)
+//	参数解析 -> 客户端创建 -> 信号处理设置 -> 服务启动 -> 等待退出信号 -> 优雅关闭
+//
+// 错误处理：
+//   - 参数错误：显示使用说明并退出
+//   - 运行时错误：记录日志并尝试恢复
+//   - 致命错误：优雅关闭并退出
+func main() {
+	// ===== 第一阶段：参数解析和验证 =====
+	// 解析命令行参数，获取用户配置
+	checkMode := len(os.Args) > 1 && os.Args[1] == ModeCheck // 参数解析失败时没有配置可用，提前记录子命令
+	scenarioMode := len(os.Args) > 1 && os.Args[1] == ModeScenario
+	config, skipCertWarning, err := parseArgs()
+	if err != nil {
+		// parseArgs 内部在参数不足或URL未指定时会调用 showUsage()
+		// 这里我们只打印具体的错误信息到标准错误输出，然后平静地以0退出
+		// 使用0退出码是因为这是用户输入错误，不是程序错误
+		fmt.Fprintln(os.Stderr, err)
+		if checkMode {
+			// 回显探测由监控系统调用，参数错误不能被当作探测通过
+			os.Exit(CheckExitUnknown)
+		}
+		if scenarioMode {
+			// 场景脚本通常在测试中运行，参数错误不能被当作场景通过
+			os.Exit(ScenarioExitInvalid)
+		}
+		os.Exit(0) // 参数错误时，平静退出
 	}
 
-	if config.MetricsEnabled {
-		c.startMonitoringServers()
+	// 静默模式：屏蔽所有运行日志，标准输出只保留收到的消息内容
+	// 否则按--timestamp、--color、--highlight和--ascii设置日志输出样式
+	setLogTimestampFormat(config.Timestamp)
+	logHighlights, _ = parseHighlightRules(config.Highlight) // 规则已在配置验证时检查过
+	if config.LogSyslog != "" {
+		syslogLevel := config.LogLevel
+		if config.Verbose {
+			syslogLevel = 3 // 详细模式同时发送调试级别日志
+		}
+		writer, err := dialSyslog(config.LogSyslog, syslogLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 无法连接syslog: %v\n", err)
+			os.Exit(1)
+		}
+		logSyslog = writer
+		defer func() { _ = writer.Close() }()
 	}
-}
-
-// generateSessionID 生成唯一的会话ID - 极致优化版本
-func generateSessionID() string {
-	// 使用高性能字符串构建器避免fmt.Sprintf的分配
-	builder := NewFastStringBuilder(32)
-	defer builder.Release()
-
-	now := time.Now()
-	builder.WriteString("ws_")
-	builder.WriteInt(now.Unix())
-	_ = builder.WriteByte('_')
-	builder.WriteInt(now.UnixNano() % 1000000) // 使用纳秒的后6位
-	_ = builder.WriteByte('_')
-	// 使用加密安全的随机数生成器
-	var randomBytes [8]byte
-	if _, err := rand.Read(randomBytes[:]); err == nil {
-		// 将随机字节转换为正整数
-		randomNum := int64(randomBytes[0])<<56 | int64(randomBytes[1])<<48 |
-			int64(randomBytes[2])<<40 | int64(randomBytes[3])<<32 |
-			int64(randomBytes[4])<<24 | int64(randomBytes[5])<<16 |
-			int64(randomBytes[6])<<8 | int64(randomBytes[7])
-		if randomNum < 0 {
-			randomNum = -randomNum
+	if config.Quiet {
+		log.SetOutput(io.Discard)
+		if logSyslog != nil {
+			// 静默模式只屏蔽控制台，syslog照常接收运行日志
+			log.SetOutput(logSyslog)
 		}
-		builder.WriteInt(randomNum % 1000000)
 	} else {
-		// 降级到时间戳作为随机数
-		builder.WriteInt(now.UnixNano() % 1000000)
+		setConsoleLogLevel(config.LogLevel, config.Verbose || config.VerbosePing)
+		log.SetOutput(newLogWriter(os.Stderr, config.useColor(os.Stderr), config.ASCII))
 	}
 
-	return builder.String()
-}
+	// ===== 第二阶段：安全提示和警告 =====
+	// 处理TLS证书验证相关的提示和警告
+	if strings.HasPrefix(config.URL, "wss://") && !config.Quiet {
+		// 检查参数冲突：同时使用 -n 和 -f
+		if skipCertWarning && config.ForceTLSVerify {
+			fmt.Println("⚠️  参数冲突：不能同时使用 -n（跳过证书警告）和 -f（强制证书验证）")
+			fmt.Println("💡 -f 参数优先级更高，将启用严格的TLS证书验证")
+			fmt.Println("")
+		}
 
-// initMessageLog 初始化消息日志文件
-func (c *WebSocketClient) initMessageLog() error {
-	if c.config.LogFile == "" {
-		return nil // 不需要记录日志文件
+		if config.ForceTLSVerify {
+			// 强制TLS验证模式：显示安全提示
+			showTLSVerificationInfo()
+		} else if !skipCertWarning {
+			// 默认模式：显示证书跳过警告
+			showCertificateWarning()
+		}
 	}
 
-	// 如果用户只指定了目录或者使用了特殊标记，生成默认文件名
-	logPath := c.config.LogFile
-	if logPath == "auto" || logPath == "." {
-		now := time.Now()
-		logPath = fmt.Sprintf("websocket_log_%s.log", now.Format("20060102_150405"))
+	// ===== 第三阶段：客户端创建和初始化 =====
+	// 应用内存上限和GC参数（对整个进程生效）
+	applyMemorySettings(config)
+
+	// 打开TLS密钥日志文件，供Wireshark解密wss://流量
+	// 之后的退出路径都经过exit，保证密钥日志在os.Exit之前关闭（os.Exit不执行defer）
+	closeKeyLog := func() {}
+	exit := func(code int) {
+		closeKeyLog()
+		os.Exit(code)
 	}
-
-	// 验证和清理日志文件路径，防止路径遍历攻击
-	validatedPath, err := validateLogPath(logPath)
-	if err != nil {
-		return fmt.Errorf("日志路径验证失败: %w", err)
+	if config.TLSKeyLog != "" {
+		keyLog, err := os.OpenFile(config.TLSKeyLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 无法打开TLS密钥日志文件: %v\n", err)
+			os.Exit(1)
+		}
+		closeKeyLog = func() {
+			if err := keyLog.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️ 关闭TLS密钥日志文件失败: %v\n", err)
+			}
+		}
+		config.TLSConfig.KeyLogWriter = keyLog
+		log.Printf(tr("🔑 TLS密钥日志: %s (仅用于调试，该文件可解密全部wss://流量)"), config.TLSKeyLog)
 	}
 
-	// 创建或打开日志文件（使用更安全的权限）
-	// 使用安全的文件创建方法避免gosec G304警告
-	file, err := c.createLogFileSafely(validatedPath)
-	if err != nil {
-		return fmt.Errorf("无法创建日志文件 %s: %w", validatedPath, err)
+	// 连接预检：只执行握手并输出各阶段结果，不创建客户端
+	if config.DryRun {
+		exit(runDryRun(config))
 	}
 
-	c.logFile = file
+	// 协议一致性测试：每个用例使用独立连接，不创建客户端
+	if config.Mode == ModeConformance {
+		exit(runConformance(config))
+	}
 
-	// 写入会话开始标记
-	header := fmt.Sprintf("\n=== WebSocket 会话开始 [%s] ===\n会话ID: %s\n目标URL: %s\n开始时间: %s\n\n",
-		AppVersion, c.SessionID, c.config.URL, time.Now().Format("2006-01-02 15:04:05"))
+	// 回显探测：单次连接，不创建客户端
+	if config.Mode == ModeCheck {
+		exit(runCheck(config))
+	}
 
-	if _, err := c.logFile.WriteString(header); err != nil {
-		log.Printf("⚠️ 写入日志文件头部失败: %v", err)
+	// 场景脚本：单次连接，不创建客户端
+	if config.Mode == ModeScenario {
+		exit(runScenario(config))
 	}
 
-	log.Printf("📝 消息日志记录到: %s", validatedPath)
-	return nil
-}
+	// 压测、会话重放和测试服务器：各自管理连接，不创建客户端
+	switch config.Mode {
+	case ModeBench:
+		exit(runBench(config))
+	case ModeReplay:
+		exit(runReplay(config))
+	case ModeServe:
+		exit(runServe(config))
+	}
 
-// logMessage 记录消息到日志文件
-func (c *WebSocketClient) logMessage(direction string, messageType int, data []byte) {
-	if c.logFile == nil {
-		return
+	// 分片连接：每个分片一个客户端，由客户端池管理
+	if len(config.Shards) > 0 {
+		exit(runShards(config))
 	}
 
-	builder := NewFastStringBuilder(512)
-	defer builder.Release()
+	// 创建WebSocket客户端实例，所有组件都会在这里初始化
+	client := NewWebSocketClient(config)
 
-	c.buildTimestamp(builder)
-	c.buildMessageHeader(builder, direction, messageType, len(data))
-	c.buildMessageContent(builder, messageType, data)
-	_ = builder.WriteByte('\n')
+	// 记录启动信息，便于调试和监控
+	logStartupInfo(config, client.SessionID)
 
-	if _, err := c.logFile.WriteString(builder.String()); err != nil {
-		log.Printf("⚠️ 写入消息日志失败: %v", err)
-	}
-}
+	// ===== 第四阶段：信号处理设置 =====
+	// 设置信号处理，支持优雅关闭
+	// 监听 Ctrl+C (SIGINT) 和 SIGTERM 信号
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 
-// buildTimestamp 构建高性能时间戳
-func (c *WebSocketClient) buildTimestamp(builder *FastStringBuilder) {
-	now := time.Now()
-	_ = builder.WriteByte('[')
-	builder.WriteInt(int64(now.Year()))
-	_ = builder.WriteByte('-')
-	if now.Month() < 10 {
-		_ = builder.WriteByte('0')
-	}
-	builder.WriteInt(int64(now.Month()))
-	_ = builder.WriteByte('-')
-	if now.Day() < 10 {
-		_ = builder.WriteByte('0')
+	// SIGHUP循环切换日志级别，不中断连接（Windows上不会收到该信号）
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			client.cycleLogLevel()
+		}
+	}()
+
+	// SIGUSR1将统计、错误、性能和goroutine检查汇总输出到日志
+	if dumpSignal := statsDumpSignal(); dumpSignal != nil {
+		dump := make(chan os.Signal, 1)
+		signal.Notify(dump, dumpSignal)
+		go func() {
+			for range dump {
+				client.logDiagnosticsReport()
+			}
+		}()
 	}
-	builder.WriteInt(int64(now.Day()))
-	builder.WriteString(" ")
-	if now.Hour() < 10 {
-		_ = builder.WriteByte('0')
+
+	// ===== 第五阶段：服务启动 =====
+	// 如果启用了TUI，先切换到全屏界面，确保连接日志和第一条消息都显示在界面中
+	if config.TUI {
+		if err := client.startTUI(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 无法启动TUI: %v\n", err)
+			exit(1)
+		}
 	}
-	builder.WriteInt(int64(now.Hour()))
-	_ = builder.WriteByte(':')
-	if now.Minute() < 10 {
-		_ = builder.WriteByte('0')
+
+	// 加载自动回复规则和JSON Schema，启用载荷压缩、端到端加密和混沌测试，规则、Schema或密钥无效时直接退出
+	if err := setupClientFeatures(client, config); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ %v\n", err)
+		exit(1)
 	}
-	builder.WriteInt(int64(now.Minute()))
-	_ = builder.WriteByte(':')
-	if now.Second() < 10 {
-		_ = builder.WriteByte('0')
+
+	// 桥接模式：先启动HTTP桥接服务，监听失败时直接退出
+	if config.Mode == ModeBridge {
+		if err := client.startBridgeServer(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 无法启动桥接服务: %v\n", err)
+			exit(1)
+		}
 	}
-	builder.WriteInt(int64(now.Second()))
-	_ = builder.WriteByte('.')
-	ms := now.Nanosecond() / 1000000
-	if ms < 100 {
-		_ = builder.WriteByte('0')
-		if ms < 10 {
-			_ = builder.WriteByte('0')
+
+	// 中继模式：先启动本地WebSocket中继服务，监听失败时直接退出
+	if config.Mode == ModeRelay {
+		if err := client.startRelayServer(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 无法启动中继服务: %v\n", err)
+			exit(1)
 		}
 	}
-	builder.WriteInt(int64(ms))
-	builder.WriteString("] ")
-}
 
-// buildMessageHeader 构建消息头部信息
-func (c *WebSocketClient) buildMessageHeader(builder *FastStringBuilder, direction string, messageType, dataLen int) {
-	builder.WriteString(direction)
-	_ = builder.WriteByte(' ')
-	builder.WriteString(c.getMessageTypeString(messageType))
-	builder.WriteString(" (")
-	builder.WriteInt(int64(dataLen))
-	builder.WriteString(" bytes): ")
-}
+	// 启动WebSocket客户端（非阻塞）
+	// 使用goroutine确保main函数可以继续处理信号
+	go client.Start()
 
-// buildMessageContent 构建消息内容
-func (c *WebSocketClient) buildMessageContent(builder *FastStringBuilder, messageType int, data []byte) {
-	if messageType == websocket.BinaryMessage {
-		c.buildBinaryContent(builder, data)
-	} else {
-		c.buildTextContent(builder, data)
+	// 如果启用了交互模式，启动交互式输入处理
+	// 允许用户在运行时发送消息；TUI自带发送输入框，取代交互模式
+	if config.HistoryFile != "" && (config.Interactive || config.TUI) {
+		client.loadSentHistory()
+	}
+	if config.Interactive && !config.TUI {
+		go client.startInteractiveMode()
 	}
-}
 
-// buildBinaryContent 构建二进制消息内容
-func (c *WebSocketClient) buildBinaryContent(builder *FastStringBuilder, data []byte) {
-	if len(data) <= 32 {
-		builder.WriteString("HEX: ")
-		c.writeHexBytes(builder, data)
-	} else {
-		builder.WriteString("BINARY: ")
-		builder.WriteInt(int64(len(data)))
-		builder.WriteString(" bytes, preview: ")
-		c.writeHexBytes(builder, data[:16])
-		builder.WriteString("...")
+	// 如果指定了--send-file，连接建立后流式发送文件
+	if config.SendFile != "" {
+		go client.sendFileOnConnect()
 	}
-}
 
-// buildTextContent 构建文本消息内容（优化字符串转换）
-func (c *WebSocketClient) buildTextContent(builder *FastStringBuilder, data []byte) {
-	if len(data) <= 500 {
-		builder.WriteString(string(data))
-	} else {
-		// 只转换一次，避免重复转换
-		truncatedData := string(data[:500])
-		builder.WriteString(truncatedData)
-		builder.WriteString("...(truncated)")
+	// 如果指定了--tail，跟随文件并逐行发送新写入的内容
+	if config.Tail != "" {
+		go client.tailFile()
 	}
-}
 
-// writeHexBytes 写入十六进制字节
-func (c *WebSocketClient) writeHexBytes(builder *FastStringBuilder, data []byte) {
-	const hexChars = "0123456789abcdef"
-	for _, b := range data {
-		if b < 16 {
-			_ = builder.WriteByte('0')
+	// 等待中断信号或客户端自动退出
+	select {
+	case <-interrupt:
+		log.Print(tr("📋 收到中断信号，正在停止..."))
+		client.Stop()
+	case <-client.ctx.Done():
+		log.Print(tr("📋 客户端已自动退出"))
+		// 客户端已经自动停止，无需再调用Stop()，但仍需保存统计并把重试耗尽等事件投递出去
+		client.persistState()
+		client.webhook.close(WebhookFlushTimeout)
+		client.execHooks.wait(ExecHookFlushTimeout)
+	}
+
+	// 恢复交互模式可能修改的终端状态
+	client.restoreConsole()
+
+	// 输出机器可读的会话摘要
+	if config.SummaryJSON != "" {
+		if err := client.WriteSummary(config.SummaryJSON); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 写入会话摘要失败: %v\n", err)
 		}
-		builder.WriteString(hexChars[b>>4 : b>>4+1])
-		builder.WriteString(hexChars[b&0xf : (b&0xf)+1])
 	}
-}
 
-// 预定义的消息类型字符串，避免重复的map查找
-var messageTypeStrings = [...]string{
-	"TYPE_0", "TEXT", "BINARY", "TYPE_3", "TYPE_4", "TYPE_5", "TYPE_6", "TYPE_7", "CLOSE", "PING", "PONG",
+	// 输出会话记录
+	if config.Transcript != "" {
+		if err := client.WriteTranscript(config.Transcript); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 写入会话记录失败: %v\n", err)
+		}
+	}
+
+	closeKeyLog()
 }
 
-// getMessageTypeString 获取消息类型的字符串表示（极致优化版）
-// 这个方法将WebSocket消息类型常量转换为可读的字符串表示
+// setupClientFeatures 按配置加载自动回复规则和JSON Schema，并注册载荷压缩、端到端加密和混沌测试中间件
 //
 // 参数说明：
-//   - messageType: WebSocket消息类型常量（如websocket.TextMessage）
+//   - client: 尚未启动的客户端
+//   - config: 客户端配置
 //
 // 返回值：
-//   - string: 消息类型的字符串表示
-//
-// 性能优化：
-//  1. 使用预定义数组而不是map查找，避免哈希计算开销
-//  2. 数组索引访问时间复杂度为O(1)
-//  3. 对未知类型使用高性能字符串构建器
-//  4. 避免fmt.Sprintf的内存分配和格式化开销
-//
-// 支持的消息类型：
-//   - 0: TYPE_0（保留）
-//   - 1: TEXT（文本消息）
-//   - 2: BINARY（二进制消息）
-//   - 8: CLOSE（关闭消息）
-//   - 9: PING（ping消息）
-//   - 10: PONG（pong消息）
+//   - error: 规则、Schema或密钥无效时的错误信息
 //
-// 使用场景：
-//   - 日志记录中的消息类型显示
-//   - 调试信息的格式化输出
-//   - 监控系统的消息分类统计
-func (c *WebSocketClient) getMessageTypeString(messageType int) string {
-	// 第一步：使用数组索引查找已知类型（性能最优）
-	if messageType >= 0 && messageType < len(messageTypeStrings) {
-		return messageTypeStrings[messageType]
+// 注意事项：
+//   - 中间件的注册顺序决定处理顺序：先压缩再加密，混沌测试作用于实际传输的数据
+func setupClientFeatures(client *WebSocketClient, config *ClientConfig) error {
+	// 加载自动回复规则
+	if config.Rules != "" {
+		rules, err := LoadAutoReplyRules(config.Rules)
+		if err != nil {
+			return fmt.Errorf(tr("无法加载自动回复规则: %w"), err)
+		}
+		client.SetAutoReplyRules(rules)
+		log.Printf(tr("🤖 已加载 %d 条自动回复规则: %s"), len(rules), config.Rules)
 	}
 
-	// 第二步：对于未知类型，使用高性能字符串构建器
-	builder := NewFastStringBuilder(16) // 预分配16字节，足够"TYPE_xxx"格式
-	defer builder.Release()
-
-	builder.WriteString("TYPE_")
-	builder.WriteInt(int64(messageType))
-	return builder.String()
-}
-
-// closeMessageLog 关闭消息日志文件
-// 这个方法优雅地关闭消息日志文件，确保数据完整性和资源正确释放
-//
-// 功能说明：
-//  1. 检查日志文件是否存在
-//  2. 写入会话结束标记和时间戳
-//  3. 刷新并关闭文件句柄
-//  4. 清理文件引用，防止内存泄漏
-//
-// 会话结束标记格式：
-//
-//	=== WebSocket 会话结束 [会话ID] ===
-//	结束时间: YYYY-MM-DD HH:MM:SS
-//
-// 错误处理：
-//   - 写入失败：记录警告但继续关闭文件
-//   - 关闭失败：记录警告，避免程序崩溃
-//   - 确保在任何情况下都清理文件引用
-//
-// 调用时机：
-//   - 客户端正常停止时
-//   - 程序异常退出时（defer调用）
-//   - 日志文件切换时
-//
-// 并发安全：此方法应在主goroutine中调用，避免并发访问文件
-func (c *WebSocketClient) closeMessageLog() {
-	// 第一步：检查日志文件是否存在
-	if c.logFile != nil {
-		// 第二步：写入会话结束标记
-		footer := fmt.Sprintf("\n=== WebSocket 会话结束 [%s] ===\n结束时间: %s\n\n",
-			c.SessionID, time.Now().Format("2006-01-02 15:04:05"))
-		if _, err := c.logFile.WriteString(footer); err != nil {
-			log.Printf("⚠️ 写入日志文件尾部失败: %v", err)
+	// 加载JSON Schema
+	if config.SchemaFile != "" {
+		validator, err := NewJSONSchemaValidator(config.SchemaFile, config.SchemaDirection)
+		if err != nil {
+			return fmt.Errorf(tr("无法加载JSON Schema: %w"), err)
 		}
+		client.SetJSONSchemaValidator(validator)
+		log.Printf(tr("📐 已加载JSON Schema: %s (验证方向: %s)"), config.SchemaFile, config.SchemaDirection)
+	}
 
-		// 第三步：关闭文件句柄
-		if closeErr := c.logFile.Close(); closeErr != nil {
-			log.Printf("⚠️ 关闭日志文件失败: %v", closeErr)
+	// 启用应用层gzip载荷压缩（必须在端到端加密之前注册，保证先压缩再加密）
+	if config.PayloadGzip {
+		client.EnablePayloadGzip()
+	}
+
+	// 启用端到端加密
+	if config.E2EKeyFile != "" {
+		e2e, err := NewE2ECipherFromFile(config.E2EKeyFile)
+		if err != nil {
+			return fmt.Errorf(tr("无法启用端到端加密: %w"), err)
 		}
+		client.EnableE2EEncryption(e2e)
+		log.Printf(tr("🔐 已启用端到端加密 (AES-GCM): %s"), config.E2EKeyFile)
+	}
 
-		// 第四步：清理文件引用，防止重复关闭
-		c.logFile = nil
+	// 启用混沌测试（在压缩和加密之后注册，故障作用于实际传输的数据）
+	if config.Chaos != nil {
+		client.EnableChaos(config.Chaos)
 	}
+	return nil
 }
 
-// setDefaultHandlers 设置默认的事件处理器
-// 这个方法为WebSocket客户端设置标准的事件处理回调函数
-//
-// 功能说明：
-//  1. 设置连接建立时的处理逻辑
-//  2. 设置连接断开时的处理逻辑
-//  3. 设置消息接收时的处理逻辑
-//  4. 设置错误发生时的处理逻辑
-//
-// 默认处理器特点：
-//   - 提供友好的日志输出，包含emoji和会话ID
-//   - 区分正常关闭和异常断开
-//   - 消息处理委托给MessageProcessor
-//   - 错误处理记录详细信息便于调试
+// startInteractiveMode 启动交互式消息发送模式
+// 这个方法允许用户通过标准输入实时发送消息和执行特殊命令
 //
-// 事件处理器说明：
-//   - onConnect: 连接成功建立时调用
-//   - onDisconnect: 连接断开时调用，区分正常和异常
-//   - onMessage: 接收到消息时调用，默认不做额外处理
-//   - onError: 发生错误时调用，记录错误信息
+// 功能特点：
+//  1. 等待WebSocket连接建立后才开始接收输入
+//  2. 支持普通文本消息发送
+//  3. 支持特殊命令执行（/quit、/ping、/stats等）
+//  4. 提供友好的命令行界面
+//  5. 支持优雅退出和错误处理
 //
-// 自定义处理器：
+// 工作流程：
+//  1. 等待WebSocket连接建立
+//  2. 显示交互模式提示信息
+//  3. 循环读取用户输入
+//  4. 处理特殊命令或发送普通消息
+//  5. 显示操作结果和新的输入提示
 //
-//	用户可以在客户端启动前覆盖这些默认处理器：
-//	client.SetOnConnect(func() { ... })
-//	client.SetOnMessage(func(int, []byte) error { ... })
+// 特殊命令：
+//   - /quit, /exit, /q: 退出程序
+//   - /ping: 发送ping消息
+//   - /stats: 显示连接统计信息
+//   - /help, /?: 显示帮助信息
 //
-// 并发安全：处理器函数在不同的goroutine中调用，需要注意线程安全
-func (c *WebSocketClient) setDefaultHandlers() {
-	// 连接建立处理器：记录成功连接信息
-	// 这个匿名函数在WebSocket连接成功建立时被调用，用于记录连接成功的日志信息
-	c.onConnect = func() {
-		log.Printf("✅ 连接成功建立 [会话: %s]", c.SessionID)
+// 并发安全：
+//   - 使用WaitGroup确保优雅退出
+//   - 通过context检查取消信号
+//   - 与其他goroutine安全协作
+func (c *WebSocketClient) startInteractiveMode() {
+	// 注册到WaitGroup，确保优雅退出
+	c.wg.Add(1)
+	defer c.wg.Done()
+	defer c.trackGoroutine("interactive")()
+
+	// 第一步：等待WebSocket连接建立
+	for {
+		select {
+		case <-c.ctx.Done():
+			return // 客户端已停止，退出交互模式
+		default:
+			if c.isConnected() {
+				goto connected // 连接已建立，开始交互
+			}
+			time.Sleep(100 * time.Millisecond) // 短暂等待后重试
+		}
+	}
+
+connected:
+
+	// 第二步：显示交互模式启动信息
+	log.Print(tr("💬 交互模式已启用，输入消息后按回车发送"))
+	log.Print(tr("💡 特殊命令: /quit (退出), /ping (发送ping), /stats (显示统计)"))
+
+	// 第三步：标准输入是终端时启用行编辑（Tab补全、历史记录），否则按管道模式逐行读取
+	stdinIsTerminal := term.IsTerminal(int(os.Stdin.Fd()))
+	if !c.config.Quiet && stdinIsTerminal {
+		err := c.runTerminalInteractive()
+		if err == nil {
+			return
+		}
+		log.Printf(tr("⚠️ 无法启用终端行编辑，回退到普通输入: %v"), err)
+	}
+	if !stdinIsTerminal {
+		log.Print(tr("⌨️ 标准输入不是终端，按管道模式逐行读取并发送"))
 	}
+	c.showPrompt()
+
+	// 第四步：创建输入扫描器
+	scanner := bufio.NewScanner(os.Stdin)
+
+	// 第五步：主输入循环
+	for scanner.Scan() {
+		// 检查是否需要退出
+		select {
+		case <-c.ctx.Done():
+			return // 客户端已停止，退出交互模式
+		default:
+		}
 
-	// 连接断开处理器：区分正常关闭和异常断开
-	// 这个匿名函数在WebSocket连接断开时被调用，根据错误参数判断断开原因
-	c.onDisconnect = func(err error) {
-		if err != nil {
-			// 异常断开：由于错误导致的连接中断
-			log.Printf("🔌 连接断开: %v [会话: %s]", err, c.SessionID)
-		} else {
-			// 正常关闭：主动调用Stop()或收到正常关闭帧
-			log.Printf("🔌 连接正常关闭 [会话: %s]", c.SessionID)
+		// 处理用户输入
+		if exit := c.handleInteractiveInput(scanner.Text()); exit {
+			return // 用户请求退出
 		}
-	}
 
-	// 消息接收处理器：默认不做额外处理
-	// 这个匿名函数在收到WebSocket消息时被调用，默认实现不做额外处理
-	c.onMessage = func(messageType int, data []byte) error {
-		// 默认不做额外处理，消息已经由MessageProcessor处理并记录
-		// 用户可以通过SetOnMessage方法覆盖此处理器来实现自定义逻辑
-		return nil
+		// 显示新的输入提示符
+		c.showPrompt()
 	}
 
-	// 错误处理器：记录错误信息便于调试
-	// 这个匿名函数在发生各种错误时被调用，用于统一的错误日志记录
-	c.onError = func(err error) {
-		log.Printf("❌ 客户端错误: %v [会话: %s]", err, c.SessionID)
+	// 第六步：处理扫描器错误，输入结束后不再读取，连接保持运行
+	if err := scanner.Err(); err != nil {
+		log.Printf(tr("❌ 读取输入时出错: %v"), err)
+		return
 	}
+	log.Print(tr("⌨️ 标准输入已结束，停止读取输入，连接继续保持"))
 }
 
-// GetState 获取当前连接状态
-// 这个方法以线程安全的方式获取WebSocket客户端的当前连接状态
-//
-// 返回值：
-//   - ConnectionState: 当前的连接状态枚举值
+// handleInteractiveInput 处理一行交互输入
+// 特殊命令交给handleInteractiveCommand，其余内容展开消息变量后作为文本消息发送
 //
-// 连接状态说明：
-//   - StateDisconnected: 未连接状态
-//   - StateConnecting: 正在连接中
-//   - StateConnected: 已连接状态
-//   - StateReconnecting: 正在重连中
-//   - StateStopping: 正在停止中
-//   - StateStopped: 已停止状态
+// 参数说明：
+//   - line: 用户输入的一行内容
 //
-// 并发安全：
-//   - 使用原子操作读取状态，确保线程安全
-//   - 可以在任意goroutine中安全调用
-//   - 不会阻塞其他操作
+// 返回值：
+//   - bool: true表示用户请求退出交互模式
+func (c *WebSocketClient) handleInteractiveInput(line string) bool {
+	input := strings.TrimSpace(line)
+	if input == "" {
+		return false // 空输入，忽略
+	}
+
+	// 处理特殊命令
+	exit, handled := c.handleInteractiveCommand(input)
+	if exit || handled {
+		return exit // 特殊命令已处理，不作为普通消息发送
+	}
+
+	// 展开${SEQ}等变量后发送普通文本消息，历史中记录展开前的输入，再次发送时重新展开
+	c.sendInteractiveMessage(input)
+	return false
+}
+
+// ===== 消息显示模板 =====
+
+// DefaultPrompt 交互模式默认的输入提示符
+const DefaultPrompt = ">>> "
+
+// messageFormatPresets --message-format可以直接使用的预设模板
+var messageFormatPresets = map[string]string{
+	"terse":   `{{if eq .Direction "RECV"}}←{{else}}→{{end}} {{.Payload}}`,
+	"verbose": `{{.Time.Format "2006-01-02 15:04:05.000"}} {{.Direction}} {{.Type}} {{.Size}}B {{.Payload}}`,
+}
+
+// messageDisplay 消息显示模板可以引用的字段
+type messageDisplay struct {
+	Time      time.Time // 收发时间
+	Direction string    // SEND或RECV，与json格式消息日志一致
+	Type      string    // 消息类型：TEXT、BINARY
+	Size      int       // 载荷字节数
+	Payload   string    // 载荷内容，二进制消息为十六进制文本
+	Member    string    // 客户端池中的成员名称（分片连接时为分片名称），未加入客户端池时为空
+}
+
+// parseMessageFormat 编译--message-format指定的模板，预设名称会被替换为对应的模板
+// 编译后用示例消息试执行一次，引用了不存在的字段等错误在启动时就能发现
 //
-// 使用场景：
-//   - 健康检查和状态监控
-//   - 条件判断和流程控制
-//   - 用户界面状态显示
-//   - 日志记录和调试
-func (c *WebSocketClient) GetState() ConnectionState {
-	return ConnectionState(atomic.LoadInt32(&c.State))
+// 返回值：
+//   - *template.Template: 编译后的模板，format为空时为nil
+//   - error: 模板语法错误或试执行失败时返回错误
+func parseMessageFormat(format string) (*template.Template, error) {
+	if format == "" {
+		return nil, nil
+	}
+	if preset, ok := messageFormatPresets[format]; ok {
+		format = preset
+	}
+	tmpl, err := template.New("message-format").Funcs(autoReplyFuncs).Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	sample := messageDisplay{Time: time.Now(), Direction: "RECV", Type: "TEXT", Size: 2, Payload: "{}"}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
 }
 
-// setState 设置连接状态
-// 这个私有方法以线程安全的方式更新WebSocket客户端的连接状态
+// prompt 返回交互模式的输入提示符，未配置--prompt时为defaultPrompt
+func (c *ClientConfig) prompt(defaultPrompt string) string {
+	if c.Prompt != "" {
+		return c.Prompt
+	}
+	return defaultPrompt
+}
+
+// renderMessage 按--message-format渲染一条文本或二进制消息
 //
 // 参数说明：
-//   - state: 要设置的新连接状态
-//
-// 并发安全：
-//   - 使用原子操作写入状态，确保线程安全
-//   - 状态更新是原子性的，不会出现中间状态
-//   - 可以在任意goroutine中安全调用
-//
-// 状态转换规则：
-//   - 状态转换应该遵循合理的状态机逻辑
-//   - 避免无效的状态转换（如从Stopped直接到Connected）
-//   - 状态更新应该及时反映实际的连接情况
+//   - direction: SEND或RECV
+//   - messageType: WebSocket消息类型
+//   - message: 消息内容
 //
-// 调用场景：
-//   - 连接建立时设置为StateConnected
-//   - 连接断开时设置为StateDisconnected
-//   - 开始重连时设置为StateReconnecting
-//   - 客户端停止时设置为StateStopped
-func (c *WebSocketClient) setState(state ConnectionState) {
-	atomic.StoreInt32(&c.State, int32(state))
+// 返回值：
+//   - string: 渲染结果
+//   - bool: 未配置模板、消息不是文本或二进制消息、或渲染失败时为false，调用方按默认格式显示
+func (c *WebSocketClient) renderMessage(direction string, messageType int, message []byte) (string, bool) {
+	if c.messageFormat == nil || (messageType != websocket.TextMessage && messageType != websocket.BinaryMessage) {
+		return "", false
+	}
+	display := messageDisplay{
+		Time:      time.Now(),
+		Direction: direction,
+		Type:      c.getMessageTypeString(messageType),
+		Size:      len(message),
+		Payload:   string(message),
+		Member:    c.poolMember,
+	}
+	if messageType == websocket.BinaryMessage {
+		display.Payload = hex.EncodeToString(message)
+	}
+	var buf strings.Builder
+	if err := c.messageFormat.Execute(&buf, display); err != nil {
+		log.Printf(tr("⚠️ 消息显示模板执行失败: %v"), err)
+		return "", false
+	}
+	return buf.String(), true
 }
 
-// isConnected 检查是否已连接
-// 这个方法提供了一个便捷的方式来检查WebSocket是否处于已连接状态
+// printMessage 按--message-format把一条收发的消息写到控制台，不带日志前缀
+// 静默模式只输出原始载荷，TUI模式由消息面板显示，这两种模式下不输出
 //
 // 返回值：
-//   - bool: true表示已连接，false表示未连接
+//   - bool: true表示已按模板输出，调用方不再按默认格式记录日志
+func (c *WebSocketClient) printMessage(direction string, messageType int, message []byte) bool {
+	if c.config.Quiet || c.config.TUI {
+		return false
+	}
+	line, ok := c.renderMessage(direction, messageType, message)
+	if ok {
+		fmt.Fprintln(c.consoleOut(), line)
+	}
+	return ok
+}
+
+// ===== 消息变量 =====
+
+// messageVariablePattern 匹配消息中的${名称}变量引用
+var messageVariablePattern = regexp.MustCompile(`\$\{([A-Z_]+)\}`)
+
+// expandMessageVariables 展开交互输入和场景脚本消息中的变量
 //
-// 判断逻辑：
-//   - 只有当状态为StateConnected时才返回true
-//   - 其他所有状态（包括连接中、重连中等）都返回false
-//   - 确保只有真正建立连接时才认为是已连接
+// 支持的变量：
+//   - ${SESSION_ID}: 当前会话ID
+//   - ${SEQ}: 自增序号，从1开始，每条引用了它的消息加1
+//   - ${UUID}: 随机UUID（版本4）
+//   - ${NOW_ISO}: 当前UTC时间，ISO 8601格式，精确到毫秒
 //
-// 并发安全：
-//   - 内部调用GetState()方法，继承其线程安全特性
-//   - 可以在任意goroutine中安全调用
+// 参数说明：
+//   - text: 要发送的消息
+//   - sessionID: ${SESSION_ID}展开的值
+//   - seq: ${SEQ}使用的计数器
 //
-// 使用场景：
-//   - 发送消息前的连接状态检查
-//   - 就绪检查和健康检查
-//   - 交互模式的启动条件判断
-//   - 业务逻辑的连接状态判断
-func (c *WebSocketClient) isConnected() bool {
-	return c.GetState() == StateConnected
+// 返回值：
+//   - string: 展开后的消息
+//
+// 注意事项：
+//   - 同一条消息中多次引用的${SEQ}和${NOW_ISO}展开为相同的值，每个${UUID}各不相同
+//   - 不认识的变量保持原样，不会破坏恰好包含"${"的消息
+func expandMessageVariables(text, sessionID string, seq *int64) string {
+	if !strings.Contains(text, "${") {
+		return text
+	}
+	var seqValue, now string
+	return messageVariablePattern.ReplaceAllStringFunc(text, func(ref string) string {
+		switch ref[2 : len(ref)-1] {
+		case "SESSION_ID":
+			return sessionID
+		case "SEQ":
+			if seqValue == "" {
+				seqValue = strconv.FormatInt(atomic.AddInt64(seq, 1), 10)
+			}
+			return seqValue
+		case "UUID":
+			return newUUID()
+		case "NOW_ISO":
+			if now == "" {
+				now = time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+			}
+			return now
+		default:
+			return ref
+		}
+	})
 }
 
-// GetStats 获取连接统计信息
-// 这个方法以线程安全的方式获取WebSocket连接的详细统计信息
+// newUUID 生成随机UUID（RFC 4122版本4）
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:]) // crypto/rand.Read不会返回错误
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// ===== Shell补全 =====
+
+// completionSubcommand 生成shell补全脚本的子命令
+const completionSubcommand = "completion"
+
+// completionShells 支持生成补全脚本的shell
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// cliFlag 一个命令行标志
+type cliFlag struct {
+	name        string // 标志名，含前缀-或--
+	takesValue  bool   // 是否必须带值（使用说明中写作 <值>）
+	description string // 选项说明（已按输出语言翻译）
+}
+
+// cliFlags 返回全部子命令的选项，用于生成补全脚本
+// 选项来自optionGroups，新增选项会自动出现在补全中
 //
 // 返回值：
-//   - ConnectionStats: 连接统计信息的副本
-//
-// 统计信息包含：
-//  1. 连接时间：连接建立的时间戳
-//  2. 运行时长：连接持续的时间（实时计算）
-//  3. 消息统计：发送和接收的消息数量
-//  4. 字节统计：发送和接收的字节总数
-//  5. 重连统计：重连次数和相关信息
-//  6. 错误统计：错误次数和详细信息
-//  7. 最后消息时间：最近一次消息的时间戳
-//
-// 实时计算：
-//   - 如果当前已连接且有连接时间，会实时计算运行时长
-//   - 确保返回的统计信息是最新的
+//   - []cliFlag: 按帮助中的顺序排列的选项，多个子命令共用的选项名只保留第一条说明
+func cliFlags() []cliFlag {
+	var flags []cliFlag
+	seen := make(map[string]bool)
+	for _, group := range optionGroups(NewDefaultConfig(""), new(bool), showUsage) {
+		for _, option := range group.options {
+			for _, name := range strings.Split(option.names, ",") {
+				name = optionDisplayName(name)
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				flags = append(flags, cliFlag{name: name, takesValue: strings.HasPrefix(option.arg, "<"), description: tr(option.usage)})
+			}
+		}
+	}
+	return flags
+}
+
+// runCompletion 执行completion子命令，把补全脚本写到标准输出
 //
-// 并发安全：
-//   - 使用读锁保护统计数据的读取
-//   - 返回数据副本，避免外部修改影响内部状态
-//   - 可以在任意goroutine中安全调用
+// 参数说明：
+//   - args: 子命令之后的参数，必须恰好是一个shell名称
 //
-// 使用场景：
-//   - 监控和性能分析
-//   - 用户界面状态显示
-//   - 日志记录和调试
-//   - HTTP统计端点的数据源
-func (c *WebSocketClient) GetStats() ConnectionStats {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// 返回值：
+//   - int: 进程退出码，shell名称无效时为1
+func runCompletion(args []string) int {
+	if len(args) != 1 || !slices.Contains(completionShells, args[0]) {
+		fmt.Fprintf(os.Stderr, tr("⚠️ 用法: wsc completion %s")+"\n", strings.Join(completionShells, "|"))
+		return 1
+	}
+	flags := cliFlags()
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion(flags)
+	case "zsh":
+		script = zshCompletion(flags)
+	case "fish":
+		script = fishCompletion(flags)
+	case "powershell":
+		script = powershellCompletion(flags)
+	}
+	fmt.Print(script)
+	return 0
+}
 
-	// 获取统计数据副本
-	stats := c.Stats
+// subcommandNames 返回全部子命令名称
+func subcommandNames() []string {
+	names := make([]string, 0, len(cliCommands))
+	for _, sub := range cliCommands {
+		names = append(names, sub.name)
+	}
+	return names
+}
 
-	// 实时计算运行时长（如果已连接且有连接时间）
-	if c.isConnected() && !stats.ConnectTime.IsZero() {
-		stats.Uptime = time.Since(stats.ConnectTime)
+// bashCompletion 生成bash补全脚本
+// 用法：source <(wsc completion bash)
+func bashCompletion(flags []cliFlag) string {
+	var all, withValue []string
+	for _, flag := range flags {
+		all = append(all, flag.name)
+		if flag.takesValue {
+			withValue = append(withValue, flag.name)
+		}
 	}
 
-	return stats
+	var b strings.Builder
+	b.WriteString("# wsc bash补全，用法: source <(wsc completion bash)\n")
+	b.WriteString("_wsc() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("    case \"$prev\" in\n")
+	fmt.Fprintf(&b, "        %s)\n", strings.Join(withValue, "|"))
+	b.WriteString("            COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	b.WriteString("            return ;;\n")
+	b.WriteString("    esac\n")
+	fmt.Fprintf(&b, "    if [[ $COMP_CWORD -eq 2 && \"${COMP_WORDS[1]}\" == %s ]]; then\n", completionSubcommand)
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(completionShells, " "))
+	b.WriteString("    elif [[ $COMP_CWORD -eq 1 && \"$cur\" != -* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(subcommandNames(), " "))
+	b.WriteString("    else\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(all, " "))
+	b.WriteString("    fi\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o default -F _wsc wsc\n")
+	return b.String()
 }
 
-// updateStats 更新统计信息（线程安全版本）
-// 这个方法更新消息传输的统计信息，包括本地统计和Prometheus指标
-//
-// 参数说明：
-//   - _: 消息类型（当前未使用，保留用于扩展）
-//   - dataLen: 消息数据长度（字节）
-//   - sent: true表示发送消息，false表示接收消息
-//
-// 更新内容：
-//  1. 最后消息时间：更新为当前时间
-//  2. 消息计数：根据sent参数更新发送或接收计数
-//  3. 字节计数：累加消息的字节数
-//  4. Prometheus指标：原子更新对应的指标
-//
-// 并发安全：
-//   - 使用互斥锁保护本地统计数据的更新
-//   - 使用原子操作更新Prometheus指标
-//   - 避免数据竞争和不一致状态
-//
-// 性能考虑：
-//   - 锁的持有时间很短，只保护必要的更新操作
-//   - Prometheus指标使用原子操作，性能更好
-//   - 避免在锁内进行耗时操作
-//
-// 调用场景：
-//   - 发送消息成功后调用
-//   - 接收消息成功后调用
-//   - 消息处理流程中的统计更新
-func (c *WebSocketClient) updateStats(_ int, dataLen int, sent bool) {
-	// 使用互斥锁保护本地统计数据
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// zshCompletion 生成zsh补全脚本
+// 既可以放入$fpath作为_wsc自动加载，也可以直接source
+func zshCompletion(flags []cliFlag) string {
+	escape := strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `:`, `\:`, `'`, `'\''`)
+
+	var b strings.Builder
+	b.WriteString("#compdef wsc\n")
+	b.WriteString("# wsc zsh补全，用法: source <(wsc completion zsh)\n")
+	b.WriteString("_wsc() {\n")
+	b.WriteString("    local -a subcommands\n")
+	b.WriteString("    subcommands=(\n")
+	for _, sub := range cliCommands {
+		fmt.Fprintf(&b, "        '%s:%s'\n", sub.name, escape.Replace(tr(sub.summary)))
+	}
+	b.WriteString("    )\n")
+	b.WriteString("    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n")
+	b.WriteString("        _describe 'subcommand' subcommands\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	fmt.Fprintf(&b, "    if (( CURRENT == 3 )) && [[ $words[2] == %s ]]; then\n", completionSubcommand)
+	fmt.Fprintf(&b, "        compadd %s\n", strings.Join(completionShells, " "))
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    _arguments \\\n")
+	for _, flag := range flags {
+		spec := fmt.Sprintf("%s[%s]", flag.name, escape.Replace(flag.description))
+		if flag.takesValue {
+			spec += ":value:_files"
+		}
+		fmt.Fprintf(&b, "        '%s' \\\n", spec)
+	}
+	b.WriteString("        '*:URL:'\n")
+	b.WriteString("}\n")
+	b.WriteString("if [ \"$funcstack[1]\" = \"_wsc\" ]; then\n")
+	b.WriteString("    _wsc \"$@\"\n")
+	b.WriteString("else\n")
+	b.WriteString("    compdef _wsc wsc\n")
+	b.WriteString("fi\n")
+	return b.String()
+}
 
-	// 更新最后消息时间
-	c.Stats.LastMessageTime = time.Now()
+// fishCompletion 生成fish补全脚本
+// 用法：wsc completion fish > ~/.config/fish/completions/wsc.fish
+func fishCompletion(flags []cliFlag) string {
+	escape := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
 
-	if sent {
-		// 更新发送统计
-		c.Stats.MessagesSent++
-		c.Stats.BytesSent += int64(dataLen)
-		// 原子更新Prometheus指标以避免竞态条件
-		atomic.AddInt64(&c.metrics.MessagesSentTotal, 1)
-		atomic.AddInt64(&c.metrics.BytesSentTotal, int64(dataLen))
-	} else {
-		// 更新接收统计
-		c.Stats.MessagesReceived++
-		c.Stats.BytesReceived += int64(dataLen)
-		// 原子更新Prometheus指标以避免竞态条件
-		atomic.AddInt64(&c.metrics.MessagesReceivedTotal, 1)
-		atomic.AddInt64(&c.metrics.BytesReceivedTotal, int64(dataLen))
+	var b strings.Builder
+	b.WriteString("# wsc fish补全，用法: wsc completion fish > ~/.config/fish/completions/wsc.fish\n")
+	b.WriteString("complete -c wsc -f\n")
+	for _, sub := range cliCommands {
+		fmt.Fprintf(&b, "complete -c wsc -n __fish_use_subcommand -a %s -d '%s'\n", sub.name, escape.Replace(tr(sub.summary)))
+	}
+	fmt.Fprintf(&b, "complete -c wsc -n '__fish_seen_subcommand_from %s' -a '%s'\n", completionSubcommand, strings.Join(completionShells, " "))
+	for _, flag := range flags {
+		var option string
+		switch name := strings.TrimLeft(flag.name, "-"); {
+		case strings.HasPrefix(flag.name, "--"):
+			option = "-l " + name
+		case len(name) == 1:
+			option = "-s " + name
+		default:
+			option = "-o " + name
+		}
+		if flag.takesValue {
+			option += " -r -F"
+		}
+		fmt.Fprintf(&b, "complete -c wsc %s -d '%s'\n", option, escape.Replace(flag.description))
+	}
+	return b.String()
+}
+
+// powershellCompletion 生成PowerShell补全脚本
+// 用法：wsc completion powershell | Out-String | Invoke-Expression
+func powershellCompletion(flags []cliFlag) string {
+	quote := func(s string) string {
+		if s == "" {
+			s = " " // CompletionResult的提示文字不能为空
+		}
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+
+	var b strings.Builder
+	b.WriteString("# wsc PowerShell补全，用法: wsc completion powershell | Out-String | Invoke-Expression\n")
+	b.WriteString("Register-ArgumentCompleter -Native -CommandName 'wsc' -ScriptBlock {\n")
+	b.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	// 每行前的逗号防止PowerShell把内层数组展开
+	b.WriteString("    $subcommands = @(\n")
+	for _, sub := range cliCommands {
+		fmt.Fprintf(&b, "        ,@(%s, %s)\n", quote(sub.name), quote(tr(sub.summary)))
+	}
+	b.WriteString("    )\n")
+	b.WriteString("    $flags = @(\n")
+	for _, flag := range flags {
+		fmt.Fprintf(&b, "        ,@(%s, %s)\n", quote(flag.name), quote(flag.description))
+	}
+	b.WriteString("    )\n")
+	b.WriteString("    $elements = $commandAst.CommandElements\n")
+	fmt.Fprintf(&b, "    if ($elements.Count -ge 2 -and $elements[1].ToString() -eq '%s') {\n", completionSubcommand)
+	b.WriteString("        $candidates = @(")
+	for i, shell := range completionShells {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "@('%s', '%s')", shell, shell)
+	}
+	b.WriteString(")\n")
+	b.WriteString("    } elseif ($wordToComplete.StartsWith('-')) {\n")
+	b.WriteString("        $candidates = $flags\n")
+	b.WriteString("    } elseif ($elements.Count -le 2) {\n")
+	b.WriteString("        $candidates = $subcommands\n")
+	b.WriteString("    } else {\n")
+	b.WriteString("        $candidates = @()\n")
+	b.WriteString("    }\n")
+	b.WriteString("    $candidates | Where-Object { $_[0] -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	b.WriteString("        [System.Management.Automation.CompletionResult]::new($_[0], $_[0], 'ParameterValue', $_[1])\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ===== 多语言输出 =====
+
+// 输出语言
+const (
+	LangZH = "zh" // 中文（默认）
+	LangEN = "en" // 英文
+)
+
+// outputLang 当前输出语言，解析参数时由detectOutputLang设置，--lang或配置文件指定时以其为准
+var outputLang = LangZH
+
+// detectOutputLang 确定输出语言
+//
+// 参数说明：
+//   - args: 命令行参数（不含程序名）
+//
+// 返回值：
+//   - string: --lang指定的有效语言；未指定时依次检查LC_ALL、LC_MESSAGES和LANG环境变量，
+//     以zh开头或未表明语言（C、POSIX）时为中文，其余为英文；均未设置时为中文
+//
+// 注意事项：
+//   - 在解析其他参数之前调用，使--help和参数错误信息也使用所选语言；无效的--lang值留给配置验证报错
+func detectOutputLang(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		value, ok := strings.CutPrefix(arg, "--lang=")
+		if !ok && arg == "--lang" && i+1 < len(args) {
+			value = args[i+1]
+		}
+		if value == LangZH || value == LangEN {
+			return value
+		}
+	}
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		switch {
+		case value == "":
+			continue
+		case strings.HasPrefix(value, "zh"), value == "C", value == "POSIX", strings.HasPrefix(value, "C."):
+			return LangZH
+		default:
+			return LangEN
+		}
 	}
+	return LangZH
 }
 
-// recordError 记录错误统计信息（线程安全版本）
-// 这个方法记录和统计WebSocket客户端发生的各种错误
+var (
+	catalogOnce sync.Once
+	catalogEN   map[string]string // 中文原文 → 英文译文
+)
+
+// tr 返回消息在当前输出语言下的文本
+// 以中文原文（日志和错误的格式字符串、使用说明行）作为消息键，在调用处翻译格式字符串本身，
+// 格式化参数（消息内容、URL、错误等）不经过翻译；英文输出时目录中未收录的键原样返回
 //
 // 参数说明：
-//   - err: 发生的错误实例
+//   - key: 中文原文，与englishCatalog中的写法完全一致
 //
-// 记录内容：
-//  1. 错误总数：累加错误计数
-//  2. 最后错误：保存最近发生的错误
-//  3. 错误时间：记录错误发生的时间戳
-//  4. 错误分类：按错误码分类统计
-//  5. 错误趋势：记录错误发生的时间序列
-//  6. Prometheus指标：更新监控指标
+// 返回值：
+//   - string: 译文，格式动词与原文相同
 //
-// 错误分类：
-//   - 自动提取错误码进行分类统计
-//   - 支持自定义错误类型和标准错误
-//   - 便于错误模式分析和问题诊断
+// Example:
 //
-// 错误趋势：
-//   - 记录每个错误的时间戳和类型
-//   - 保持最近1000个错误的历史记录
-//   - 支持错误趋势分析和异常检测
+//	log.Printf(tr("📤 已发送: %s"), message)
 //
-// 并发安全：
-//   - 使用互斥锁保护所有统计数据的更新
-//   - 原子操作更新Prometheus指标
-//   - 避免数据竞争和不一致状态
+// 并发安全：目录只在首次调用时建立一次，之后只读
+func tr(key string) string {
+	if outputLang != LangEN {
+		return key
+	}
+	catalogOnce.Do(func() {
+		catalogEN = make(map[string]string, len(englishCatalog))
+		for _, entry := range englishCatalog {
+			catalogEN[entry.zh] = entry.en
+		}
+	})
+	if en, ok := catalogEN[key]; ok {
+		return en
+	}
+	return key
+}
+
+// localizedError 按输出语言返回错误信息的哨兵错误
+// 包级错误变量在解析--lang之前创建，因此在Error()中翻译；类型可比较，errors.Is按值判断
+type localizedError string
+
+// Error 实现error接口
+func (e localizedError) Error() string {
+	return tr(string(e))
+}
+
+// englishCatalog 英文译文目录：消息键（中文原文或格式字符串）→ 英文
+// 键必须与调用处tr()的参数完全一致，译文中的动词与原文相同且顺序一致；
+// 覆盖使用说明、错误码、运行日志和错误信息，TestEnglishCatalog检查源码中的每个tr()键都已收录
+var englishCatalog = []struct{ zh, en string }{
+	// 使用说明
+	{"📋 %s v%s - 高性能 WebSocket 客户端\n", "📋 %s v%s - High-performance WebSocket client\n"},
+	{"🚀 使用方法:", "🚀 Usage:"},
+	{"  ./wsc [选项] <WebSocket_URL>", "  ./wsc [options] <WebSocket_URL>"},
+	{"  ./wsc [选项] -- <WebSocket_URL>  \"--\"之后的参数不再按标志解析", "  ./wsc [options] -- <WebSocket_URL>  Arguments after \"--\" are not parsed as flags"},
+	{"  ./wsc <子命令> -h  显示子命令的用法和选项", "  ./wsc <subcommand> -h  Show a subcommand's usage and options"},
+	{"  ./wsc -h, --help              显示此帮助信息", "  ./wsc -h, --help              Show this help"},
+	{"🌐 公共测试服务器:", "🌐 Public test servers:"},
+	{"📋 自定义示例:", "📋 Custom examples:"},
+	{"⚙️  可选参数:", "⚙️  Options:"},
+	{"跳过 TLS 证书验证警告", "Skip the TLS certificate verification warning"},
+	{"强制启用 TLS 证书验证 (覆盖默认跳过行为)", "Enforce TLS certificate verification (overrides the default skip)"},
+	{"追加URL查询参数 (自动URL编码，可重复，覆盖URL中的同名参数)", "Append a URL query parameter (URL-encoded, repeatable, overrides parameters in the URL)"},
+	{"握手请求的User-Agent (默认 WebSocket-Client/<版本>)", "User-Agent of the handshake request (default WebSocket-Client/<version>)"},
+	{"握手请求的Origin头，auto按目标地址推导 (ws→http、wss→https)，默认不发送", "Origin header of the handshake; auto derives it from the target (ws→http, wss→https); not sent by default"},
+	{"<来源|auto>", "<origin|auto>"},
+	{"禁用自动ping功能 (仍会响应服务器ping)", "Disable automatic pings (server pings are still answered)"},
+	{"每个ping等待pong的时限，连续超时后主动断开重连 (默认0=禁用)", "Time each ping waits for a pong; reconnect after consecutive timeouts (default 0 = disabled)"},
+	{"<时长>", "<duration>"},
+	{"判定连接失效的连续pong超时次数 (默认3)", "Consecutive pong timeouts before the connection is considered dead (default 3)"},
+	{"<次数>", "<count>"},
+	{"启用详细日志模式 (包括消息处理和ping/pong)", "Verbose logging (including message processing and ping/pong)"},
+	{"启用交互式消息发送模式", "Interactive mode for sending messages"},
+	{"保存交互模式的发送历史，下次启动时可用 /history、/!N 和方向键调出", "Persist interactive send history; recall it next time with /history, /!N and the arrow keys"},
+	{"<路径>", "<path>"},
+	{"交互模式输入提示符 (默认 \">>> \")", "Interactive input prompt (default \">>> \")"},
+	{"<文本>", "<text>"},
+	{"收发消息的显示模板，字段: .Time .Direction .Type .Size .Payload，或预设 terse、verbose", "Display template for sent and received messages; fields: .Time .Direction .Type .Size .Payload, or the presets terse, verbose"},
+	{"<模板>", "<template>"},
+	{"记录消息到日志文件 (可选路径)", "Log messages to a file (optional path)"},
+	{"[文件路径]", "[path]"},
+	{"指定消息日志文件路径", "Message log file path"},
+	{"发送和接收消息分别记录到 <名称>.send.log 和 <名称>.recv.log", "Log sent and received messages to <name>.send.log and <name>.recv.log"},
+	{"消息日志格式: text (默认)、json (每行一个对象)、raw (14字节头部+原始载荷)", "Message log format: text (default), json (one object per line), raw (14-byte header + raw payload)"},
+	{"<格式>", "<format>"},
+	{"静默模式：屏蔽日志，只把收到的消息写到标准输出", "Quiet mode: no logs, only received messages are written to stdout"},
+	{"全屏终端界面：分栏显示消息、日志、统计和发送输入框", "Full-screen terminal UI: panes for messages, logs, stats and an input box"},
+	{"控制台颜色: auto (默认)、always、never", "Console colors: auto (default), always, never"},
+	{"<模式>", "<mode>"},
+	{"纯ASCII日志：emoji前缀替换为[SEND]、[RECV]、[ERROR]等标签", "ASCII-only logs: emoji prefixes become [SEND], [RECV], [ERROR] and similar tags"},
+	{"输出语言: 使用说明、错误码和主要运行日志 (默认按LANG环境变量)", "Output language for usage, error codes and the main runtime logs (default from LANG)"},
+	{"控制台和消息日志的时间戳: rfc3339、unix、unixms、none", "Timestamps of console and message logs: rfc3339, unix, unixms, none"},
+	{"运行日志同时发送到syslog (省略地址为本机，或 udp://、tcp://host:port)", "Also send runtime logs to syslog (local without an address, or udp://, tcp://host:port)"},
+	{"[地址]", "[addr]"},
+	{"收发的消息记录也发送到syslog", "Also send message records to syslog"},
+	{"退出时输出JSON会话摘要 (- 表示标准输出)", "Write a JSON session summary on exit (- for stdout)"},
+	{"退出时输出会话记录：握手头部、每一帧和关闭详情 (类HAR格式)", "Write a session transcript on exit: handshake headers, every frame and close details (HAR-like)"},
+	{"收发的每一帧写入SQLite数据库，便于用SQL分析长时间抓包", "Store every sent and received frame in an SQLite database for SQL analysis of long captures"},
+	{"保存累计统计和错误历史，重启后继续累加 (每30秒及退出时保存)", "Persist cumulative statistics and error history across restarts (saved every 30s and on exit)"},
+	{"出站消息预写日志，未发送成功的消息在重连或重启后重发", "Write-ahead journal for outbound messages; unsent messages are resent after reconnect or restart"},
+	{"<目录>", "<dir>"},
+	{"重试次数 (默认5，0=无限)", "Retry count (default 5, 0 = unlimited)"},
+	{"重试间隔 (默认3秒)", "Retry interval (default 3 seconds)"},
+	{"<秒数>", "<seconds>"},
+	{"重试总时长上限，超时后停止重试 (如10m)", "Upper bound on total retry time (e.g. 10m)"},
+	{"⏱️ 超时与帧大小:", "⏱️ Timeouts and frame sizes:"},
+	{"建连总超时，包含TCP连接、TLS握手和HTTP升级 (默认15s)", "Overall connect timeout covering TCP connect, TLS handshake and HTTP upgrade (default 15s)"},
+	{"单个地址的TCP连接超时，与握手超时分开报告 (默认10s)", "TCP connect timeout per address, reported separately from the handshake timeout (default 10s)"},
+	{"读取截止时间，期间未收到任何数据或pong即断开重连 (默认60s，须大于ping间隔)", "Read deadline; reconnect when no data or pong arrives in time (default 60s, must exceed the ping interval)"},
+	{"单次消息和控制帧写入的截止时间 (默认5s)", "Deadline for writing one message or control frame (default 5s)"},
+	{"自动ping间隔 (默认30s)", "Automatic ping interval (default 30s)"},
+	{"最大消息大小，支持k/m单位 (默认32k)", "Maximum message size, k/m units accepted (default 32k)"},
+	{"<大小>", "<size>"},
+	{"读缓冲区大小 (默认4k)", "Read buffer size (default 4k)"},
+	{"写缓冲区大小 (默认4k)", "Write buffer size (default 4k)"},
+	{"🌐 名称解析:", "🌐 Name resolution:"},
+	{"将指定主机端口解析到固定IP (可重复)", "Resolve the given host and port to a fixed IP (repeatable)"},
+	{"使用指定DNS服务器解析主机名", "Resolve host names with the given DNS server"},
+	{"在该时长内重连复用上次的解析结果 (默认0: 每次重连都重新解析)", "Reuse the last resolution on reconnects within this duration (default 0: resolve on every reconnect)"},
+	{"握手返回301/302/307/308时跟随Location重新握手", "Follow Location on 301/302/307/308 handshake responses"},
+	{"最多跟随的重定向次数 (默认5)", "Maximum number of redirects to follow (default 5)"},
+	{"📦 大消息流式读取:", "📦 Large message streaming:"},
+	{"超过此大小的消息分块落盘 (默认0=禁用)", "Stream messages larger than this to disk in chunks (default 0 = disabled)"},
+	{"<字节>", "<bytes>"},
+	{"流式读取分块大小 (默认65536)", "Streaming chunk size (default 65536)"},
+	{"大消息落盘目录 (默认当前目录)", "Directory for streamed messages (default current directory)"},
+	{"连接后以分片方式发送文件 (二进制消息，不受最大消息限制)", "Send a file in fragments after connecting (binary message, not limited by the maximum message size)"},
+	{"<文件>", "<file>"},
+	{"类似tail -F跟随文件，每个新写入的行作为文本消息发送 (处理轮转)", "Follow a file like tail -F and send each new line as a text message (handles rotation)"},
+	{"自动回复规则文件 (YAML/JSON，按正则或JSON路径匹配收到的消息并回复)", "Auto-reply rules (YAML/JSON, match received messages by regex or JSON path and reply)"},
+	{"检查收到消息中的序列号，统计跳跃、重复和乱序 (如 seq、data.sequence)", "Check sequence numbers in received messages for gaps, duplicates and reordering (e.g. seq, data.sequence)"},
+	{"<JSON路径>", "<JSON path>"},
+	{"序列号跳跃时发送的消息 (可引用 {{.Expected}} 和 {{.Received}})", "Message sent when a sequence gap is detected (may use {{.Expected}} and {{.Received}})"},
+	{"令牌桶平滑限速，超出时等待而不是拒绝 (默认每分钟最多100条)", "Token bucket rate limit; waits instead of rejecting (default at most 100 per minute)"},
+	{"<条/秒>", "<msgs/s>"},
+	{"令牌桶突发容量 (默认与发送速率相同)", "Token bucket burst size (default equal to the send rate)"},
+	{"<数量>", "<count>"},
+	{"🚦 背压控制:", "🚦 Backpressure:"},
+	{"入站队列容量，消息由独立goroutine分发，慢速回调不再阻塞读取 (默认0=同步处理)", "Inbound queue size; messages are dispatched by a separate goroutine so slow callbacks no longer block reads (default 0 = synchronous)"},
+	{"队列满时的策略: block (默认)、drop-oldest、drop-newest", "Policy when the queue is full: block (default), drop-oldest, drop-newest"},
+	{"<策略>", "<policy>"},
+	{"无效UTF-8文本消息: warn (默认，警告后照常处理)、replace (替换为U+FFFD)、close (以1007断开)", "Invalid UTF-8 text messages: warn (default, warn and process), replace (with U+FFFD), close (disconnect with 1007)"},
+	{"每秒最多向显示和回调分发N条消息，突发由入站队列吸收 (未指定队列时容量1000)", "Dispatch at most N messages per second to display and callbacks; bursts are absorbed by the inbound queue (capacity 1000 if not set)"},
+	{"🧠 内存控制:", "🧠 Memory control:"},
+	{"软内存上限 (如 256MB)，接近上限时释放缓存并更积极地GC", "Soft memory limit (e.g. 256MB); caches are released and GC runs more aggressively near the limit"},
+	{"设置GOGC (默认沿用GOGC环境变量)", "Set GOGC (default taken from the GOGC environment variable)"},
+	{"<百分比|off>", "<percent|off>"},
+	{"增加内存池档位 (如 64KB，可重复)，调大--max-message-size时让大消息也能复用缓冲区", "Add a buffer pool tier (e.g. 64KB, repeatable) so large messages reuse buffers when --max-message-size is raised"},
+	{"🛡️ 安全检查:", "🛡️ Security checks:"},
+	{"阻止发送包含该模式的文本消息，可重复，替换默认模式 (re:前缀为正则)", "Refuse to send text messages containing the pattern; repeatable, replaces the default patterns (re: prefix for regex)"},
+	{"白名单模式：文本消息必须匹配其中之一，可重复 (re:前缀为正则)", "Allowlist: text messages must match one of them; repeatable (re: prefix for regex)"},
+	{"中继模式允许的跨源连接来源 (Origin头)，可重复，默认只允许同源", "Cross-origin connection origins (Origin header) allowed in relay mode; repeatable, same-origin only by default"},
+	{"<来源>", "<origin>"},
+	{"关闭消息内容检查 (适用于会误触发子串检查的协议)", "Disable message content checks (for protocols that trigger the substring checks)"},
+	{"端到端加密密钥 (AES-GCM，16/24/32字节，原始/十六进制/Base64)", "End-to-end encryption key (AES-GCM, 16/24/32 bytes, raw/hex/Base64)"},
+	{"发送前gzip压缩载荷 (以二进制帧发送)，自动解压收到的gzip载荷", "Gzip payloads before sending (as binary frames) and decompress received gzip payloads"},
+	{"🧪 连接预检:", "🧪 Connection dry run:"},
+	{"依次执行DNS解析、TCP连接、TLS握手和WebSocket升级，输出各阶段结果后退出", "Run DNS resolution, TCP connect, TLS handshake and WebSocket upgrade, print each phase and exit"},
+	{"📜 证书信息:", "📜 Certificate information:"},
+	{"连接后输出服务器证书链 (主题、签发者、SAN、有效期、指纹)，即将过期时警告", "Print the server certificate chain after connecting (subject, issuer, SAN, validity, fingerprint), warning when it expires soon"},
+	{"固定服务器公钥SHA-256指纹 (Base64，可重复)，-n 跳过验证时同样生效", "Pin the server public key SHA-256 fingerprint (Base64, repeatable); also enforced with -n"},
+	{"<指纹>", "<fingerprint>"},
+	{"写入TLS会话密钥供Wireshark解密 (也支持SSLKEYLOGFILE环境变量)", "Write TLS session keys for Wireshark decryption (SSLKEYLOGFILE is also supported)"},
+	{"🔬 帧级调试:", "🔬 Frame-level debugging:"},
+	{"记录收发的每个帧 (操作码、FIN、长度、掩码、载荷前16字节十六进制)", "Log every sent and received frame (opcode, FIN, length, mask, first 16 payload bytes in hex)"},
+	{"按RFC 6455检查服务器发来的帧 (保留位、掩码、控制帧、分片、文本UTF-8)，按类型记录违规", "Check server frames against RFC 6455 (reserved bits, masking, control frames, fragmentation, text UTF-8) and count violations by type"},
+	{"同 --strict，发现违规时发送关闭帧 (1002/1007) 并断开连接", "Like --strict, but send a close frame (1002/1007) and disconnect on a violation"},
+	{"以xxd风格 (偏移/十六进制/ASCII) 完整输出收发的二进制消息，同时作用于控制台和消息日志", "Dump binary messages in xxd style (offset/hex/ASCII) to the console and message log"},
+	{"输出升级请求和服务器响应的完整HTTP头部 (含Sec-WebSocket-Accept和扩展/子协议协商结果)", "Print the full HTTP headers of the upgrade request and response (including Sec-WebSocket-Accept and extension/subprotocol negotiation)"},
+	{"💥 混沌测试:", "💥 Chaos testing:"},
+	{"按概率注入故障，例如 drop=0.01,delay=0.2,delay-max=1s,dup=0.05,corrupt=0.01,seed=42", "Inject faults by probability, e.g. drop=0.01,delay=0.2,delay-max=1s,dup=0.05,corrupt=0.01,seed=42"},
+	{"<配置>", "<config>"},
+	{"    --chaos 字段: drop=中断连接 delay=写入延迟 dup=重复发送 corrupt=翻转一个比特 seed=可重现的随机种子", "    --chaos fields: drop=drop the connection delay=write delay dup=send twice corrupt=flip one bit seed=reproducible random seed"},
+	{"模拟附加往返延迟 (如 200ms)，无需netem", "Simulate extra round-trip latency (e.g. 200ms) without netem"},
+	{"模拟带宽上限 (如 512kbps、1mbps)，收发方向分别限制", "Simulate a bandwidth limit (e.g. 512kbps, 1mbps), applied to each direction"},
+	{"<带宽>", "<bandwidth>"},
+	{"📐 消息验证:", "📐 Message validation:"},
+	{"要求收发的文本消息都是有效JSON", "Require sent and received text messages to be valid JSON"},
+	{"使用JSON Schema验证文本消息，失败时记录日志并按错误码计数", "Validate text messages against a JSON Schema; failures are logged and counted by error code"},
+	{"Schema验证方向: in|out|both (默认in；发送方向验证失败会拒绝发送)", "Schema validation direction: in|out|both (default in; failed outgoing messages are not sent)"},
+	{"<方向>", "<direction>"},
+	{"🔍 消息过滤:", "🔍 Message filtering:"},
+	{"只显示和记录匹配的接收消息 (可重复，默认匹配任一即可)", "Only show and log matching received messages (repeatable, any match by default)"},
+	{"<正则>", "<regex>"},
+	{"隐藏匹配的接收消息 (可重复，优先于 --grep)", "Hide matching received messages (repeatable, takes precedence over --grep)"},
+	{"多个 --grep 必须全部匹配", "All --grep patterns must match"},
+	{"高亮接收消息中匹配的子串 (可重复，颜色: red|green|yellow|blue|magenta|cyan|white，默认red，需要启用颜色)", "Highlight matches in received messages (repeatable, colors: red|green|yellow|blue|magenta|cyan|white, default red, requires colors)"},
+	{"<正则[:颜色]>", "<regex[:color]>"},
+	{"    被隐藏的消息仍计入统计，并照常触发回调和自动回复规则", "    Hidden messages still count in statistics and still trigger callbacks and auto-reply rules"},
+	{"🏁 自动退出条件:", "🏁 Exit conditions:"},
+	{"超过此时长未收到消息时退出 (如30s)", "Exit when no message arrives for this long (e.g. 30s)"},
+	{"收到指定数量的消息后退出", "Exit after receiving this many messages"},
+	{"运行指定时长后退出 (如5m)", "Exit after running this long (e.g. 5m)"},
+	{"🌉 桥接模式 (bridge):", "🌉 Bridge mode (bridge):"},
+	{"本地HTTP监听地址 (如 :8081)", "Local HTTP listen address (e.g. :8081)"},
+	{"<地址>", "<addr>"},
+	{"    未指定主机时仅监听127.0.0.1；设置 --admin-token 后请求需携带 Authorization: Bearer <令牌>", "    Binds to 127.0.0.1 when no host is given; with --admin-token, requests must send Authorization: Bearer <token>"},
+	{"等待WebSocket响应的超时 (默认5s)", "Timeout waiting for the WebSocket response (default 5s)"},
+	{"    curl -d '{\"op\":\"ping\"}' http://localhost:8081/  请求体作为消息发送，响应消息作为HTTP响应返回", "    curl -d '{\"op\":\"ping\"}' http://localhost:8081/  The request body is sent as a message and the response message becomes the HTTP response"},
+	{"🔀 中继模式 (relay):", "🔀 Relay mode (relay):"},
+	{"本地WebSocket监听地址 (如 :9001)", "Local WebSocket listen address (e.g. :9001)"},
+	{"    本地客户端连接 ws://localhost:9001/ 即可与远程服务器双向通信，上游断线重连对本地客户端透明", "    Local clients connecting to ws://localhost:9001/ talk to the remote server; upstream reconnects are transparent to them"},
+	{"🧪 协议一致性测试 (conformance):", "🧪 Protocol conformance test (conformance):"},
+	{"    wsc conformance <URL>  对回显服务器执行分片、Ping/Pong、UTF-8、关闭握手等用例，全部通过时退出码为0", "    wsc conformance <URL>  Run fragmentation, ping/pong, UTF-8 and close handshake cases against an echo server; exit code 0 when all pass"},
+	{"🩺 回显探测 (check):", "🩺 Echo probe (check):"},
+	{"发送的消息 (默认随机令牌)", "Message to send (default: a random token)"},
+	{"期望的响应 (默认原样回显)", "Expected response (default: the message echoed back)"},
+	{"握手加等待响应的总时限 (默认5s)", "Total time allowed for the handshake and the response (default 5s)"},
+	{"往返时间超过此值时以WARNING退出", "Exit with WARNING when the round trip takes longer than this"},
+	{"    退出码: 0=OK 1=WARNING 2=CRITICAL 3=参数无效，输出一行Nagios格式结果和性能数据", "    Exit codes: 0=OK 1=WARNING 2=CRITICAL 3=invalid arguments; prints one Nagios-style result line with performance data"},
+	{"🎬 场景脚本 (scenario):", "🎬 Scenario script (scenario):"},
+	{"YAML/JSON场景脚本，按顺序执行send、wait、expect、close步骤", "YAML/JSON scenario script; runs send, wait, expect and close steps in order"},
+	{"    退出码: 0=全部步骤成功 1=连接失败或步骤失败 2=参数或脚本无效", "    Exit codes: 0=all steps passed 1=connection or step failed 2=invalid arguments or script"},
+	{"🏋️ 压测 (bench):", "🏋️ Benchmark (bench):"},
+	{"并发连接数 (默认10)", "Concurrent connections (default 10)"},
+	{"每个连接发送的消息数，逐条等待回显 (默认100)", "Messages per connection, each waiting for its echo (default 100)"},
+	{"每条消息的载荷大小 (默认64字节)", "Payload size of each message (default 64 bytes)"},
+	{"    输出吞吐量和握手、往返时间的分位数；有连接失败或消息未收到回显时退出码为1", "    Prints throughput and handshake/round-trip percentiles; exit code 1 if a connection fails or an echo is missing"},
+	{"📼 会话重放 (replay):", "📼 Session replay (replay):"},
+	{"--transcript 会话记录或 --capture-db 抓包数据库，重发其中发送方向的文本和二进制消息", "A --transcript file or --capture-db database; its outgoing text and binary messages are sent again"},
+	{"重放速度: realtime (默认，原始间隔)、max (不等待) 或倍数如 2x (原始间隔除以倍数)", "Replay speed: realtime (default, original gaps), max (no waiting) or a factor such as 2x (gaps divided by it)"},
+	{"🧩 分片连接 (connect):", "🧩 Sharded connections (connect):"},
+	{"增加一条分片连接 (可重复)：未指定--shard-param时是另一个ws://或wss://地址，否则是查询参数的取值", "Add a shard connection (repeatable): another ws:// or wss:// address, or a query parameter value with --shard-param"},
+	{"分片查询参数名，每条连接在URL上附加 名称=分片取值 (如 partition)", "Shard query parameter; each connection appends name=shard to the URL (e.g. partition)"},
+	{"    消息前标出分片名称；交互输入由第一条连接发送，/broadcast 发送给所有分片；--metrics 的 /metrics 和 /stats 汇总所有分片，退出时输出每个分片的消息数和接收延迟", "    Messages are prefixed with the shard name; interactive input is sent on the first connection and /broadcast sends to every shard; with --metrics, /metrics and /stats aggregate all shards, and per-shard message counts and receive lag are printed on exit"},
+	{"重复重放全部消息的次数 (默认1)", "Number of times to replay all messages (default 1)"},
+	{"允许从wss://重定向到明文ws://或http://地址 (默认拒绝)", "Allow redirects from wss:// to plaintext ws:// or http:// addresses (refused by default)"},
+	{"    收到的消息输出到标准输出；全部发送后继续接收，1秒内没有新消息时正常关闭", "    Received messages go to standard output; after the last send the connection closes once it has been quiet for 1 second"},
+	{"🖥️ 测试服务器 (serve):", "🖥️ Test server (serve):"},
+	{"WebSocket监听地址 (默认 :8080，未指定主机时仅监听127.0.0.1)", "WebSocket listen address (default :8080; binds 127.0.0.1 when no host is given)"},
+	{"把收到的消息广播给所有客户端 (默认原样回显给发送方)", "Broadcast received messages to all clients (default: echo back to the sender)"},
+	{"输出收到的每条消息", "Log every received message"},
+	{"    wsc serve & wsc bench ws://localhost:8080/  在本机压测，按Ctrl+C停止服务器", "    wsc serve & wsc bench ws://localhost:8080/  Benchmark locally; press Ctrl+C to stop the server"},
+	{"📋 信息查看:", "📋 Information:"},
+	{"显示此帮助信息", "Show this help"},
+	{"显示版本号", "Show the version"},
+	{"显示详细构建信息", "Show detailed build information"},
+	{"执行自检并返回状态码", "Run a self-check and return a status code"},
+	{"📊 监控和指标:", "📊 Monitoring and metrics:"},
+	{"启用Prometheus指标导出", "Export Prometheus metrics"},
+	{"指标服务端口 (默认9090)", "Metrics server port (default 9090)"},
+	{"<端口>", "<port>"},
+	{"健康检查端口 (默认8080)", "Health check port (default 8080)"},
+	{"在同一端口提供指标、健康检查和管理API (取代上面两个端口)", "Serve metrics, health checks and the admin API on one port (replaces the two ports above)"},
+	{"/ready 要求本次连接已收到消息", "/ready requires a message on the current connection"},
+	{"/ready 允许的最长消息静默时长 (如 30s)", "Longest message silence /ready accepts (e.g. 30s)"},
+	{"可用性目标：已连接时间占比 (如 99.9)", "Availability target: share of time connected (e.g. 99.9)"},
+	{"<百分比>", "<percent>"},
+	{"消息发送成功率目标 (如 99.5)", "Message send success rate target (e.g. 99.5)"},
+	{"每小时允许的最多重连次数", "Maximum reconnects allowed per hour"},
+	{"SLO滚动窗口 (默认1h，短窗口为其1/12)", "SLO rolling window (default 1h, the short window is 1/12 of it)"},
+	{"长短窗口的错误预算消耗速率都达到该倍数时 /health 报告 degraded (默认2)", "/health reports degraded when both windows burn the error budget this fast (default 2)"},
+	{"<倍数>", "<factor>"},
+	{"<速度>", "<speed>"},
+	{"<值>", "<value>"},
+	{"<名称>", "<name>"},
+	{"后台死锁检查、系统指标采样和健康检查的间隔 (默认10s)", "Interval of background deadlock checks, system metric sampling and health checks (default 10s)"},
+	{"在健康检查端口启用管理API (也可用环境变量 WSC_ADMIN_TOKEN)", "Enable the admin API on the health port (also via the WSC_ADMIN_TOKEN environment variable)"},
+	{"<令牌>", "<token>"},
+	{"连接、断开、重试耗尽和安全违规时POST JSON事件到该地址 (失败自动重试)", "POST JSON events on connect, disconnect, retries exhausted and security violations (retried on failure)"},
+	{"以HMAC-SHA256签名Webhook请求体 (X-WSC-Signature头，也可用环境变量 WSC_WEBHOOK_SECRET)", "Sign webhook bodies with HMAC-SHA256 (X-WSC-Signature header, also via WSC_WEBHOOK_SECRET)"},
+	{"<密钥>", "<key>"},
+	{"连接建立时通过shell运行命令 (事件数据在WSC_*环境变量中)", "Run a shell command when connected (event data in WSC_* environment variables)"},
+	{"<命令>", "<cmd>"},
+	{"连接断开时运行命令 (WSC_REASON、WSC_CLOSE_CODE)", "Run a command when disconnected (WSC_REASON, WSC_CLOSE_CODE)"},
+	{"收到消息时运行命令，消息内容写入标准输入 (受--grep过滤)", "Run a command for each received message, payload on stdin (subject to --grep)"},
+	{"收到的消息批量转发到 kafka://broker/topic 或 nats://server/subject (受--grep过滤)", "Forward received messages in batches to kafka://broker/topic or nats://server/subject (subject to --grep)"},
+	{"附加到所有指标和JSON统计的常量标签 (可重复，如 region=eu)", "Constant label added to all metrics and JSON statistics (repeatable, e.g. region=eu)"},
+	{"🤫 静默输出模式:", "🤫 Quiet output mode:"},
+	{"    ./wsc -q ws://host/ws > data.jsonl  抓取消息到文件，文本消息每条一行", "    ./wsc -q ws://host/ws > data.jsonl  Capture messages to a file, one text message per line"},
+	{"    二进制消息输出为 4字节大端长度 + 原始数据", "    Binary messages are written as a 4-byte big-endian length + raw data"},
+	{"📝 消息日志功能:", "📝 Message logging:"},
+	{"    -l                    自动生成日志文件名", "    -l                    Generate the log file name automatically"},
+	{"    -l mylog.txt          指定日志文件名", "    -l mylog.txt          Use the given log file name"},
+	{"    --log-file /path/to/websocket.log  完整路径", "    --log-file /path/to/websocket.log  Full path"},
+	{"📊 监控功能示例:", "📊 Monitoring examples:"},
+	{"    --metrics             启用默认端口监控 (9090/8080)", "    --metrics             Monitoring on the default ports (9090/8080)"},
+	{"    --metrics-port 9091   自定义指标端口", "    --metrics-port 9091   Custom metrics port"},
+	{"    --health-port 8081    自定义健康检查端口", "    --health-port 8081    Custom health check port"},
+	{"  访问:", "  Endpoints:"},
+	{"    http://localhost:9090/metrics     Prometheus指标", "    http://localhost:9090/metrics     Prometheus metrics"},
+	{"    http://localhost:8080/health      健康检查", "    http://localhost:8080/health      Health check"},
+	{"    http://localhost:8080/ready       就绪检查", "    http://localhost:8080/ready       Readiness check"},
+	{"    http://localhost:8080/stats       详细统计", "    http://localhost:8080/stats       Detailed statistics"},
+	{"💬 交互式模式:", "💬 Interactive mode:"},
+	{"    -i                    启用后可通过键盘输入发送消息", "    -i                    Send messages by typing them"},
+	{"    特殊命令:", "    Special commands:"},
+	{"      /quit               退出程序", "      /quit               Exit"},
+	{"      /ping               发送 ping 消息", "      /ping               Send a ping"},
+	{"      /stats              显示连接统计信息", "      /stats              Show connection statistics"},
+	{"      /state              显示连接状态", "      /state              Show connection state"},
+	{"      /reconnect          强制断开并重新连接", "      /reconnect          Force a disconnect and reconnect"},
+	{"      /pause, /resume     暂停/恢复收到消息的输出", "      /pause, /resume     Pause/resume output of received messages"},
+	{"🔄 智能重试策略:", "🔄 Smart retry strategy:"},
+	{"    -r N: 前N次快速重试 + 后N次慢速重试", "    -r N: N fast retries followed by N slow retries"},
+	{"    -r 0: 前5次快速重试 + 无限慢速重试", "    -r 0: 5 fast retries followed by unlimited slow retries"},
+	{"  示例:", "  Examples:"},
+	{"    -r 3: 3次快速 + 3次慢速 = 总共6次", "    -r 3: 3 fast + 3 slow = 6 in total"},
+	{"    -r 5: 5次快速 + 5次慢速 = 总共10次", "    -r 5: 5 fast + 5 slow = 10 in total"},
+	{"    -r 0 --max-retry-duration 10m: 无限重试，但10分钟内未连上则退出", "    -r 0 --max-retry-duration 10m: retry forever, but exit if not connected within 10 minutes"},
+	{"🔐 TLS证书验证选项:", "🔐 TLS certificate verification:"},
+	{"    默认行为: 跳过证书验证，显示安全警告", "    Default: skip verification and show a security warning"},
+	{"    -n: 跳过证书验证，不显示警告 (开发环境)", "    -n: skip verification without a warning (development)"},
+	{"    -f: 强制启用证书验证 (生产环境推荐)", "    -f: enforce verification (recommended for production)"},
+	{"  注意: -f 和 -n 不能同时使用，-f 优先级更高", "  Note: -f and -n cannot be combined; -f takes precedence"},
+	{"✨ 主要特性:", "✨ Key features:"},
+	{"    • 自动重连和智能重试", "    • Automatic reconnects and smart retries"},
+	{"    • 并发安全和优雅关闭", "    • Concurrency safety and graceful shutdown"},
+	{"    • 详细的连接统计信息", "    • Detailed connection statistics"},
+	{"    • 支持自定义事件处理", "    • Custom event handlers"},
+	{"    • 完善的错误分类处理", "    • Thorough error classification"},
+	{"    • 灵活的TLS安全配置", "    • Flexible TLS security settings"},
+
+	// 错误码
+	{"连接被拒绝", "connection refused"},
+	{"连接超时", "connection timeout"},
+	{"连接丢失", "connection lost"},
+	{"握手失败", "handshake failed"},
+	{"无效URL", "invalid URL"},
+	{"TLS错误", "TLS error"},
+	{"DNS解析错误", "DNS resolution error"},
+	{"消息过大", "message too large"},
+	{"无效消息", "invalid message"},
+	{"发送超时", "send timeout"},
+	{"接收超时", "receive timeout"},
+	{"编码错误", "encoding error"},
+	{"Schema验证失败", "schema validation failed"},
+	{"超过最大重试次数", "maximum retries exceeded"},
+	{"重试超时", "retry timeout"},
+	{"无效配置", "invalid configuration"},
+	{"缺少参数", "missing parameter"},
+	{"文件系统错误", "file system error"},
+	{"内存错误", "memory error"},
+	{"安全违规", "security violation"},
+	{"频率限制超出", "rate limit exceeded"},
+	{"可疑活动", "suspicious activity"},
+	{"未知错误", "unknown error"},
+
+	// 关闭码名称
+	{"正常关闭", "normal closure"},
+	{"服务器下线", "going away"},
+	{"协议错误", "protocol error"},
+	{"不支持的数据", "unsupported data"},
+	{"无状态码", "no status"},
+	{"无效数据", "invalid payload data"},
+	{"策略违规", "policy violation"},
+	{"服务器内部错误", "internal server error"},
+	{"服务重启", "service restart"},
+	{"稍后重试", "try again later"},
+	{"其他", "other"},
+
+	// 连接状态
+	{"未连接", "disconnected"},
+	{"连接中", "connecting"},
+	{"已连接", "connected"},
+	{"重连中", "reconnecting"},
+	{"停止中", "stopping"},
+	{"已停止", "stopped"},
+	{"未知状态", "unknown state"},
+
+	// 错误
+	{"无效的 WebSocket URL", "invalid WebSocket URL"},
+	{"WebSocket 连接失败", "WebSocket connection failed"},
+	{"WebSocket 连接已关闭", "WebSocket connection closed"},
+	{"无效的客户端配置", "invalid client configuration"},
+	{"TCP连接超时", "TCP connect timeout"},
+	{"消息已保留在发送日志中，等待重发", "message kept in the journal for redelivery"},
+	{"流式发送不经过出站中间件，启用加密或压缩时不能流式发送", "streamed sends bypass outbound middleware and are refused while encryption or compression is enabled"},
+	{"达到最大重试次数", "maximum retries reached"},
+	{"操作被取消", "operation canceled"},
+	{"握手超时", "handshake timeout"},
+	{"读取超时", "read timeout"},
+	{"写入超时", "write timeout"},
+	{"连接失败 [%s]: %v, 响应: %s", "connection failed [%s]: %v, response: %s"},
+
+	// 命令行和配置错误
+	{"配置验证失败: %w", "configuration validation failed: %w"},
+	{"参数不足，请提供WebSocket URL", "not enough arguments, please provide a WebSocket URL"},
+	{"未指定WebSocket URL", "no WebSocket URL specified"},
+	{"⚠️ 未知参数或标志: '%s'", "⚠️ unknown argument or flag: '%s'"},
+	{"⚠️ 参数过多或URL指定重复: '%s'", "⚠️ too many arguments or duplicate URL: '%s'"},
+	{"⚠️ 无效的WebSocket URL '%s'，必须以ws://或wss://开头", "⚠️ invalid WebSocket URL '%s', must start with ws:// or wss://"},
+	{"⚠️ %s 参数需要指定值", "⚠️ %s requires a value"},
+	{"⚠️ %s 子命令不接受参数: '%s'", "⚠️ the %s subcommand takes no arguments: '%s'"},
+	{"参数值 '%s' 必须是true或false", "value '%s' must be true or false"},
+	{"参数值 '%s' 必须是正整数", "value '%s' must be a positive integer"},
+	{"参数值 '%s' 必须是非负整数", "value '%s' must be a non-negative integer"},
+	{"参数值 '%s' 必须是有限的正数", "value '%s' must be a finite positive number"},
+	{"参数值 '%s' 必须是有效端口号 (1-65535)", "value '%s' must be a valid port (1-65535)"},
+	{"参数值 '%s' 不是有效的时长 (例如 30s、10m)", "value '%s' is not a valid duration (e.g. 30s, 10m)"},
+	{"参数值 '%s' 必须大于0", "value '%s' must be greater than 0"},
+	{"参数值 '%s' 超出范围 (最大2GiB)", "value '%s' is out of range (max 2GiB)"},
+	{"参数值 '%s' 必须是正整数或off", "value '%s' must be a positive integer or off"},
+	{"参数值 '%s' 格式必须为 host:port:addr", "value '%s' must have the form host:port:addr"},
+	{"参数值 '%s' 中的端口无效", "value '%s' has an invalid port"},
+	{"参数值 '%s' 中的地址必须是IP", "value '%s' must use an IP address"},
+	{"参数值 '%s' 格式必须为 server:port", "value '%s' must have the form server:port"},
+	{"参数值 '%s' 格式必须为 key=value", "value '%s' must have the form key=value"},
+	{"⚠️ 用法: wsc completion %s", "⚠️ usage: wsc completion %s"},
+	{"连接到WebSocket服务器（默认）", "Connect to a WebSocket server (default)"},
+	{"REST到WebSocket桥接", "REST-to-WebSocket bridge"},
+	{"本地WebSocket中继", "Local WebSocket relay"},
+	{"协议一致性测试", "Protocol conformance test"},
+	{"回显探测", "Echo probe"},
+	{"执行场景脚本", "Run a scenario script"},
+	{"并发压测回显服务器的吞吐和往返时间", "Benchmark an echo server's throughput and round-trip time with concurrent connections"},
+	{"按原始间隔重放记录的发送消息", "Replay recorded outgoing messages at their original pace"},
+	{"本地WebSocket回显/广播测试服务器", "Local WebSocket echo/broadcast test server"},
+	{"生成shell补全脚本", "Generate a shell completion script"},
+	{"[选项] <WebSocket_URL>", "[options] <WebSocket_URL>"},
+	{"--listen <地址> [选项] <WebSocket_URL>", "--listen <addr> [options] <WebSocket_URL>"},
+	{"--script <文件> [选项] <WebSocket_URL>", "--script <file> [options] <WebSocket_URL>"},
+	{"--from <文件> [选项] <WebSocket_URL>", "--from <file> [options] <WebSocket_URL>"},
+	{"[选项]", "[options]"},
+	{"%w: 超时配置必须为正数", "%w: timeouts must be positive"},
+	{"%w: 读取超时 (%v) 必须大于ping间隔 (%v)", "%w: read timeout (%v) must be greater than the ping interval (%v)"},
+	{"%w: 颜色模式必须是 auto、always 或 never", "%w: color mode must be auto, always or never"},
+	{"%w: 输出语言必须是 zh 或 en", "%w: output language must be zh or en"},
+	{"%w: URL不能为空", "%w: URL must not be empty"},
+	{"%w: 无效的URL格式: %v", "%w: invalid URL format: %v"},
+	{"%w: URL必须以ws://或wss://开头", "%w: URL must start with ws:// or wss://"},
+	{"%w: 重试次数不能为负数", "%w: retry count must not be negative"},
+	{"%w: 重试间隔必须在 %v 到 %v 之间", "%w: retry delay must be between %v and %v"},
+	{"%w: 重试总时长不能为负数", "%w: maximum retry duration must not be negative"},
+	{"%w: TCP连接超时不能为负数", "%w: TCP connect timeout must not be negative"},
+	{"%w: 缓冲区大小必须为正数", "%w: buffer sizes must be positive"},
+	{"%w: 日志级别必须在 0-3 之间", "%w: log level must be between 0 and 3"},
+	{"%w: 消息日志格式必须是 text、json 或 raw", "%w: message log format must be text, json or raw"},
+	{"%w: --syslog-messages 需要同时指定 --log-syslog", "%w: --syslog-messages requires --log-syslog"},
+	{"%w: 时间戳格式必须是 rfc3339、unix、unixms 或 none", "%w: timestamp format must be rfc3339, unix, unixms or none"},
+	{"%w: --quiet 不能与 --tui 同时使用", "%w: --quiet cannot be used together with --tui"},
+	{"%w: 无效的会话摘要路径: %v", "%w: invalid session summary path: %v"},
+	{"%w: 无效的会话记录路径: %v", "%w: invalid transcript path: %v"},
+	{"%w: 无效的抓包数据库路径: %v", "%w: invalid capture database path: %v"},
+	{"%w: 无效的状态文件路径: %v", "%w: invalid state file path: %v"},
+	{"%w: 无效的发送日志目录: %v", "%w: invalid journal directory: %v"},
+	{"%w: strict_fail 需要同时启用 strict", "%w: strict_fail requires strict"},
+	{"%w: 流式读取阈值不能为负数", "%w: stream threshold must not be negative"},
+	{"%w: 流式读取阈值 %d 不能大于最大消息大小 %d", "%w: stream threshold %d must not exceed the maximum message size %d"},
+	{"%w: 流式读取分块大小必须为正数", "%w: stream chunk size must be positive"},
+	{"%w: 无效的流式落盘目录: %v", "%w: invalid stream spool directory: %v"},
+	{"%w: 空闲超时和最长运行时间不能为负数", "%w: idle timeout and maximum duration must not be negative"},
+	{"%w: 最大接收消息数不能为负数", "%w: maximum message count must not be negative"},
+	{"%w: --script 只能与 scenario 子命令一起使用", "%w: --script can only be used with the scenario subcommand"},
+	{"%w: --listen 只能与 bridge、relay 或 serve 子命令一起使用", "%w: --listen can only be used with the bridge, relay or serve subcommands"},
+	{"%w: scenario 模式需要使用 --script 指定场景脚本", "%w: scenario mode requires a scenario script via --script"},
+	{"%w: 压测的连接数、消息数和载荷大小必须为正数", "%w: benchmark connections, messages and payload size must be positive"},
+	{"%w: replay 模式需要使用 --from 指定会话记录或抓包数据库", "%w: replay mode requires a transcript or capture database via --from"},
+	{"%w: 重放次数必须为正数", "%w: replay loop count must be positive"},
+	{"%w: 回显探测的时限必须为正数，告警阈值不能为负数", "%w: echo check timeout must be positive and the warning threshold must not be negative"},
+	{"%w: 期望的响应不是有效的正则表达式: %v", "%w: expected response is not a valid regular expression: %v"},
+	{"%w: %s 模式需要使用 --listen 指定监听地址", "%w: %s mode requires a listen address via --listen"},
+	{"%w: 桥接响应超时必须为正数", "%w: bridge response timeout must be positive"},
+	{"%w: 桥接服务监听非本机地址 %s 时必须使用 --admin-token（或WSC_ADMIN_TOKEN）启用认证", "%w: the bridge listens on non-local address %s and requires authentication via --admin-token (or WSC_ADMIN_TOKEN)"},
+	{"%w: 未知的运行模式 '%s'", "%w: unknown mode '%s'"},
+	{"%w: 无效的解析覆盖主机 '%s': %v", "%w: invalid resolve override host '%s': %v"},
+	{"%w: 解析覆盖目标 '%s' 必须是IP地址", "%w: resolve override target '%s' must be an IP address"},
+	{"%w: 无效的DNS服务器地址 '%s': %v", "%w: invalid DNS server address '%s': %v"},
+	{"%w: DNS缓存时长不能为负数", "%w: DNS cache TTL must not be negative"},
+	{"%w: 发送速率和突发容量不能为负数", "%w: send rate and burst must not be negative"},
+	{"%w: --send-burst 需要与 --send-rate 一起使用", "%w: --send-burst requires --send-rate"},
+	{"%w: 模拟延迟和带宽不能为负数", "%w: simulated latency and bandwidth must not be negative"},
+	{"%w: Schema验证方向 '%s' 无效，可选 in、out、both", "%w: invalid schema validation direction '%s', expected in, out or both"},
+	{"%w: pong超时不能为负数", "%w: pong timeout must not be negative"},
+	{"%w: 连续未收到pong的次数必须大于0", "%w: pong misses must be greater than 0"},
+	{"%w: 入站队列容量不能为负数", "%w: inbound queue size must not be negative"},
+	{"%w: 接收速率上限不能为负数", "%w: receive rate limit must not be negative"},
+	{"%w: 背压策略 '%s' 无效，可选 block、drop-oldest、drop-newest", "%w: invalid backpressure policy '%s', expected block, drop-oldest or drop-newest"},
+	{"%w: 内存上限不能为负数", "%w: memory limit must not be negative"},
+	{"%w: GOGC百分比必须为正数或-1（关闭）", "%w: GOGC percentage must be positive or -1 (off)"},
+	{"%w: 内存池档位 %d 必须大于0且不超过最大消息大小 %d", "%w: buffer pool size class %d must be greater than 0 and no larger than the maximum message size %d"},
+	{"%w: 跟随重定向时最大跳数必须至少为1", "%w: maximum redirects must be at least 1 when following redirects"},
+	{"%w: --allow-insecure-redirect 需要与 --follow-redirects 一起使用", "%w: --allow-insecure-redirect requires --follow-redirects"},
+	{"%w: 就绪静默时长不能为负数", "%w: readiness quiet period must not be negative"},
+	{"%w: 无效UTF-8处理策略 '%s' 无效，可选 warn、replace、close", "%w: invalid UTF-8 policy '%s', expected warn, replace or close"},
+	{"%w: Webhook地址 '%s' 必须是http://或https://地址", "%w: webhook URL '%s' must be an http:// or https:// address"},
+	{"%w: --webhook-secret 需要与 --webhook-url 一起使用", "%w: --webhook-secret requires --webhook-url"},
+	{"%w: 无效的转发地址 '%s': %v", "%w: invalid forward target '%s': %v"},
+	{"%w: SLO百分比目标必须在0到100之间（不含100）", "%w: SLO percentage targets must be between 0 and 100 (exclusive of 100)"},
+	{"%w: SLO每小时重连上限不能为负数", "%w: SLO reconnects per hour must not be negative"},
+	{"%w: SLO窗口不能小于 %v", "%w: SLO window must not be shorter than %v"},
+	{"%w: SLO消耗速率阈值必须为正数", "%w: SLO burn rate threshold must be positive"},
+	{"%w: --seq-resubscribe 需要与 --seq-path 一起使用", "%w: --seq-resubscribe requires --seq-path"},
+	{"%w: 重新订阅消息模板无效: %v", "%w: invalid resubscribe message template: %v"},
+	{"%w: 后台采样间隔不能为负数", "%w: background sampling interval must not be negative"},
+	{"%w: 消息显示模板无效: %v", "%w: invalid message display template: %v"},
+	{"%w: 混沌测试配置无效: %v", "%w: invalid chaos configuration: %v"},
+	{"%w: --send-file 不能与 --e2e-key-file 或 --payload-gzip 一起使用（流式发送不经过加密和压缩）", "%w: --send-file cannot be used with --e2e-key-file or --payload-gzip (streamed sends bypass encryption and compression)"},
+	{"%w: --shard-param 需要与 --shard 一起使用", "%w: --shard-param requires --shard"},
+	{"%w: --shard 只能用于 connect 子命令", "%w: --shard can only be used with the connect subcommand"},
+	{"%w: 分片取值不能为空", "%w: shard values must not be empty"},
+	{"%w: 未指定 --shard-param 时分片 '%s' 必须是 ws:// 或 wss:// 地址", "%w: without --shard-param, shard '%s' must be a ws:// or wss:// address"},
+	{"%w: %s 不能与 --shard 一起使用", "%w: %s cannot be used with --shard"},
+	{"%w: 池成员名称不能为空", "%w: pool member name must not be empty"},
+	{"%w: 池成员 %s 的权重必须为正数", "%w: weight of pool member %s must be positive"},
+	{"%w: 池成员 %s 已存在", "%w: pool member %s already exists"},
+	{"%w: 消息通道容量必须为正数", "%w: message channel capacity must be positive"},
+
+	// 启动信息
+	{"🚀 启动 %s v%s", "🚀 Starting %s v%s"},
+	{"📍 目标URL: %s", "📍 Target URL: %s"},
+	{"🔗 会话ID: %s", "🔗 Session ID: %s"},
+	{"📝 日志级别: %s", "📝 Log level: %s"},
+	{"🔄 智能重试: 5次快速 + 无限慢速重试", "🔄 Smart retry: 5 fast + unlimited slow retries"},
+	{"🔄 智能重试: %d次快速 + %d次慢速 = 总共%d次", "🔄 Smart retry: %d fast + %d slow = %d in total"},
+	{"⏱️  超时配置: 握手=%v, 读取=%v, 写入=%v, Ping间隔=%v", "⏱️  Timeouts: handshake=%v, read=%v, write=%v, ping interval=%v"},
+	{"📦 缓冲区配置: 读取=%d字节, 写入=%d字节, 最大消息=%d字节", "📦 Buffers: read=%d bytes, write=%d bytes, max message=%d bytes"},
+	{"⏳ 慢速重试间隔: %v", "⏳ Slow retry interval: %v"},
+	{"⌛ 重试总时长上限: %v", "⌛ Total retry time limit: %v"},
+	{"🏁 自动退出条件: 空闲超时=%v, 最大消息数=%d, 最长运行=%v (0表示不限制)", "🏁 Exit conditions: idle timeout=%v, max messages=%d, max duration=%v (0 = unlimited)"},
+	{"📊 启动Prometheus指标服务器: http://localhost:%d/metrics", "📊 Starting Prometheus metrics server: http://localhost:%d/metrics"},
+	{"🏥 启动健康检查服务器: http://localhost:%d/health", "🏥 Starting health check server: http://localhost:%d/health"},
+
+	// 连接生命周期
+	{"🔌 准备连接到 %s...", "🔌 Connecting to %s..."},
+	{"⏱️  连接阶段耗时: DNS=%v, TCP=%v, TLS=%v, 首字节=%v, 总计=%v", "⏱️  Connection phases: DNS=%v, TCP=%v, TLS=%v, first byte=%v, total=%v"},
+	{"✅ 连接建立成功", "✅ Connection established"},
+	{"✅ 已连接到 %s [会话: %s]", "✅ Connected to %s [session: %s]"},
+	{"✅ 连接成功建立 [会话: %s]", "✅ Connection established [session: %s]"},
+	{"🔄 重置重试计数器，开始接收消息...", "🔄 Retry counter reset, receiving messages..."},
+	{"❌ 连接失败: %v", "❌ Connection failed: %v"},
+	{"❌ 连接失败 (第%d次重试): %v", "❌ Connection failed (retry %d): %v"},
+	{"🔌 网络连接中断 (第%d次重试): %v", "🔌 Network connection lost (retry %d): %v"},
+	{"🔌 ReadMessages: 网络连接中断: %v", "🔌 ReadMessages: network connection lost: %v"},
+	{"⚠️ ReadMessages: 读取消息失败 (未知类型): %v", "⚠️ ReadMessages: failed to read message (unknown kind): %v"},
+	{"🔌 服务器关闭连接: 关闭码=%d (%s), 原因=%q [会话: %s]", "🔌 Server closed the connection: code=%d (%s), reason=%q [session: %s]"},
+	{"🔌 连接正常关闭 [会话: %s]", "🔌 Connection closed normally [session: %s]"},
+	{"🔌 连接断开: %v [会话: %s]", "🔌 Disconnected: %v [session: %s]"},
+	{"🔄 连接断开，准备重连...", "🔄 Disconnected, preparing to reconnect..."},
+	{"⚡ 快速重试 (第%d/%d次)...", "⚡ Fast retry (%d/%d)..."},
+	{"⏳ 慢速重试 (第%d/%d次)，%v后重试...", "⏳ Slow retry (%d/%d), retrying in %v..."},
+	{"🔄 无限慢速重试 (第%d次)，%v后重试...", "🔄 Unlimited slow retry (%d), retrying in %v..."},
+	{"🛑 达到最大重试次数 (%d)，停止尝试", "🛑 Maximum retries reached (%d), giving up"},
+	{"🛑 重试总时长已达上限 (%v)，停止尝试", "🛑 Total retry time limit reached (%v), giving up"},
+	{"🛑 服务器以策略违规(1008)关闭连接，停止重连", "🛑 Server closed the connection with policy violation (1008), not reconnecting"},
+	{"⏳ 服务器要求稍后重试(%d)，等待 %v 后重连", "⏳ Server asked to try again later (%d), reconnecting in %v"},
+	{"💔 连续 %d 次未收到pong，判定连接失效，主动断开以触发重连", "💔 No pong for %d consecutive pings, connection considered dead, disconnecting to reconnect"},
+
+	// 消息收发
+	{"📤 已发送: %s", "📤 Sent: %s"},
+	{"📒 消息已排队，连接后重发: %s", "📒 Message queued for redelivery after reconnecting: %s"},
+	{"📥 收到文本消息: %s", "📥 Received text message: %s"},
+	{"📥 收到二进制消息: %d 字节", "📥 Received binary message: %d bytes"},
+	{"📊 消息发送耗时: %v, 类型: %s", "📊 Message send time: %v, type: %s"},
+	{"📊 消息处理完成，类型: %s", "📊 Message processed, type: %s"},
+	{"📡 sendPeriodicPing: 发送ping到服务器", "📡 sendPeriodicPing: sending ping to server"},
+	{"📡 PongHandler: 收到服务器pong响应", "📡 PongHandler: received pong from server"},
+	{"📡 PongHandler: 收到服务器pong响应 (RTT=%v)", "📡 PongHandler: received pong from server (RTT=%v)"},
+	{"📡 PingHandler: 收到服务器ping，发送pong响应", "📡 PingHandler: received ping from server, sending pong"},
+
+	// 交互模式
+	{"💬 交互模式已启用，输入消息后按回车发送", "💬 Interactive mode enabled, type a message and press Enter to send"},
+	{"💡 特殊命令: /quit (退出), /ping (发送ping), /stats (显示统计)", "💡 Special commands: /quit (exit), /ping (send ping), /stats (show statistics)"},
+	{"⌨️ 标准输入不是终端，按管道模式逐行读取并发送", "⌨️ stdin is not a terminal, reading and sending line by line (pipe mode)"},
+	{"⌨️ 标准输入已结束，停止读取输入，连接继续保持", "⌨️ stdin closed, no more input is read; the connection stays open"},
+	{"👋 用户请求退出", "👋 Exit requested by user"},
+	{"📊 连接统计信息:", "📊 Connection statistics:"},
+	{"   状态: %s\n", "   State: %s\n"},
+	{"   会话ID: %s\n", "   Session ID: %s\n"},
+	{"   连接时间: %s\n", "   Connected at: %s\n"},
+	{"   连接持续: %v\n", "   Connected for: %v\n"},
+	{"   重连次数: %d\n", "   Reconnects: %d\n"},
+	{"   累计统计: 首次启动于 %s, 重启 %d 次\n", "   Lifetime: first started at %s, %d restarts\n"},
+	{"   握手耗时: DNS=%v, TCP=%v, TLS=%v, 首字节=%v, 总计=%v\n", "   Handshake: DNS=%v, TCP=%v, TLS=%v, first byte=%v, total=%v\n"},
+	{"   发送消息: %d 条 (%d 字节)\n", "   Messages sent: %d (%d bytes)\n"},
+	{"   接收消息: %d 条 (%d 字节)\n", "   Messages received: %d (%d bytes)\n"},
+	{"   按类型发送: 文本=%d 二进制=%d ping=%d pong=%d close=%d\n", "   Sent by type: text=%d binary=%d ping=%d pong=%d close=%d\n"},
+	{"   按类型接收: 文本=%d 二进制=%d ping=%d pong=%d close=%d\n", "   Received by type: text=%d binary=%d ping=%d pong=%d close=%d\n"},
+	{"   序列号: 最大=%d 跳跃=%d 缺失=%d 重复=%d 乱序=%d 重新订阅=%d\n", "   Sequence: highest=%d gaps=%d missing=%d duplicates=%d out-of-order=%d resubscribes=%d\n"},
+	{"   最后消息: %s\n", "   Last message: %s\n"},
+
+	// 序列号检测
+	{"🕳️ 序列号跳跃: 期望 %d，收到 %d (缺失 %d 条)", "🕳️ Sequence gap: expected %d, got %d (%d missing)"},
+	{"♻️ 重复的序列号: %d", "♻️ Duplicate sequence number: %d"},
+	{"🔀 乱序的序列号: 收到 %d，已收到 %d", "🔀 Out-of-order sequence number: got %d, already at %d"},
+	{"🔁 新连接的序列号从 %d 重新开始 (之前为 %d)", "🔁 Sequence restarted at %d on the new connection (was %d)"},
+	{"📨 已发送重新订阅消息 (从序列号 %d 开始)", "📨 Resubscribe message sent (from sequence %d)"},
+
+	// 状态持久化
+	{"💾 已从状态文件恢复统计: 发送 %d 条, 接收 %d 条, 错误 %d 个 (首次启动于 %s, 第%d次重启)", "💾 Statistics restored from state file: %d sent, %d received, %d errors (first started at %s, restart #%d)"},
+	{"⚠️ 加载状态文件失败，以空统计启动: %v", "⚠️ Failed to load state file, starting with empty statistics: %v"},
+	{"⚠️ 保存状态文件失败: %v", "⚠️ Failed to save state file: %v"},
+
+	// 停止
+	{"📋 收到中断信号，正在停止...", "📋 Interrupt received, stopping..."},
+	{"🏁 满足自动退出条件: %s，正在退出...", "🏁 Exit condition met: %s, exiting..."},
+	{"📋 客户端已自动退出", "📋 Client exited automatically"},
+	{"🛑 Stop: 开始停止客户端...", "🛑 Stop: stopping client..."},
+	{"⏳ Stop: 等待所有内部goroutine停止...", "⏳ Stop: waiting for internal goroutines to stop..."},
+	{"🛑 Stop: 客户端已优雅停止", "🛑 Stop: client stopped gracefully"},
+	{"📋 sendPeriodicPing: 停止周期性ping (context done)", "📋 sendPeriodicPing: periodic ping stopped (context done)"},
+	{"📋 收到停止信号，停止客户端", "📋 Stop signal received, stopping client"},
+	{"📋 收到停止信号，退出主循环", "📋 Stop signal received, leaving main loop"},
+	{"📋 ReadMessages: 收到停止信号，退出消息读取循环", "📋 ReadMessages: stop signal received, leaving read loop"},
+	{"ⓘ ReadMessages: 读取消息时检测到context关闭: %v", "ⓘ ReadMessages: context closed while reading: %v"},
+
+	// 运行日志
+	{"⚠️ 关闭响应体失败: %v", "⚠️ Failed to close response body: %v"},
+	{"🔀 重定向链: %s", "🔀 Redirect chain: %s"},
+	{"↪️ 握手重定向 [%s] (%d/%d): %s -> %s", "↪️ Handshake redirect [%s] (%d/%d): %s -> %s"},
+	{"🤝 升级未完成: 服务器返回 %s", "🤝 Upgrade not completed: server returned %s"},
+	{"🤝 协商结果: Accept=%s, 子协议=%s, 扩展=%s", "🤝 Negotiated: Accept=%s, subprotocol=%s, extensions=%s"},
+	{"🧭 解析覆盖: %s -> %s", "🧭 Resolve override: %s -> %s"},
+	{"🧭 拨号 %s 使用地址 %s", "🧭 Dialing %s via address %s"},
+	{"🐢 网络模拟: 附加延迟=%v 带宽=%s", "🐢 Network simulation: added latency=%v bandwidth=%s"},
+	{"🔬 %s 帧 opcode=0x%x(%s) FIN=%t RSV=%03b 长度=%d 掩码=%s 数据=[% x%s]", "🔬 %s frame opcode=0x%x(%s) FIN=%t RSV=%03b length=%d mask=%s data=[% x%s]"},
+	{"🚨 协议违规 [%s]: %s", "🚨 Protocol violation [%s]: %s"},
+	{"⚠️ 发送关闭消息失败: %v", "⚠️ Failed to send close message: %v"},
+	{"📥 收到二进制消息: %d 字节\n%s", "📥 Received binary message: %d bytes\n%s"},
+	{"📡 收到ping消息", "📡 Received ping"},
+	{"📡 收到pong消息", "📡 Received pong"},
+	{"📥 收到未知类型消息: %d", "📥 Received message of unknown type: %d"},
+	{"🔄 执行重试恢复策略 (第%d次): %v", "🔄 Running retry recovery strategy (attempt %d): %v"},
+	{"🔌 执行重连恢复策略: %v", "🔌 Running reconnect recovery strategy: %v"},
+	{"✅ 重连恢复策略准备完成，等待重连机制执行", "✅ Reconnect recovery strategy ready, waiting for the reconnect loop"},
+	{"🔄 执行重置恢复策略: %v", "🔄 Running reset recovery strategy: %v"},
+	{"✅ 连接状态重置完成", "✅ Connection state reset"},
+	{"⬇️ 执行降级恢复策略: %v", "⬇️ Running degrade recovery strategy: %v"},
+	{"✅ 降级策略执行完成: 新延迟=%v, 新重试次数=%d", "✅ Degrade strategy applied: new delay=%v, new retry count=%d"},
+	{"🚨 安全事件记录: 总计 %d 次可疑活动", "🚨 Security event recorded: %d suspicious activities in total"},
+	{"⚠️ 频率限制触发: %d 请求在 %v 内，阻塞到 %v", "⚠️ Rate limit triggered: %d requests within %v, blocked until %v"},
+	{"📤 收到的消息将转发到 %s", "📤 Received messages will be forwarded to %s"},
+	{"⚠️ 安全检查配置无效，使用默认设置: %v", "⚠️ Invalid security check configuration, using defaults: %v"},
+	{"⚠️ 初始化消息日志失败: %v", "⚠️ Failed to initialize message log: %v"},
+	{"⚠️ 打开抓包数据库失败，本次运行不抓包: %v", "⚠️ Failed to open capture database, capturing is disabled for this run: %v"},
+	{"🗄️ 收发的消息将写入抓包数据库 %s", "🗄️ Sent and received messages will be written to capture database %s"},
+	{"⚠️ 打开发送日志失败，本次运行不持久化出站消息: %v", "⚠️ Failed to open journal, outbound messages are not persisted for this run: %v"},
+	{"📒 发送日志中有 %d 条未确认的消息，连接成功后重发", "📒 Journal has %d unacknowledged messages, they will be resent after connecting"},
+	{"⚠️ 关闭日志文件失败: %v", "⚠️ Failed to close log file: %v"},
+	{"⚠️ 写入日志文件头部失败: %v", "⚠️ Failed to write log file header: %v"},
+	{"📝 消息日志记录到: %s", "📝 Logging messages to: %s"},
+	{"⚠️ 序列化消息日志失败: %v", "⚠️ Failed to serialize message log entry: %v"},
+	{"⚠️ 写入消息日志失败: %v", "⚠️ Failed to write message log: %v"},
+	{"⚠️ 写入日志文件尾部失败: %v", "⚠️ Failed to write log file footer: %v"},
+	{"❌ 客户端错误: %v [会话: %s]", "❌ Client error: %v [session: %s]"},
+	{"❌ 指标服务器启动失败: %v", "❌ Metrics server failed to start: %v"},
+	{"❌ 健康检查服务器启动失败: %v", "❌ Health check server failed to start: %v"},
+	{"🛠️ 启动统一管理服务器: http://localhost:%d (/metrics, /health, /ready, /stats)", "🛠️ Starting admin server: http://localhost:%d (/metrics, /health, /ready, /stats)"},
+	{"❌ 统一管理服务器启动失败: %v", "❌ Admin server failed to start: %v"},
+	{"⚠️ 关闭桥接服务器失败: %v", "⚠️ Failed to close bridge server: %v"},
+	{"❌ 桥接服务器异常退出: %v", "❌ Bridge server exited unexpectedly: %v"},
+	{"🌉 桥接服务已启动: http://%s -> %s (响应超时 %v，%s)", "🌉 Bridge started: http://%s -> %s (response timeout %v, %s)"},
+	{"🚫 桥接请求认证失败: 来自 %s", "🚫 Bridge request authentication failed: from %s"},
+	{"⚠️ 写入桥接响应失败: %v", "⚠️ Failed to write bridge response: %v"},
+	{"⚠️ 关闭中继服务器失败: %v", "⚠️ Failed to close relay server: %v"},
+	{"❌ 中继服务器异常退出: %v", "❌ Relay server exited unexpectedly: %v"},
+	{"🔀 中继服务已启动: ws://%s -> %s", "🔀 Relay started: ws://%s -> %s"},
+	{"⚠️ 中继连接升级失败: %v", "⚠️ Relay connection upgrade failed: %v"},
+	{"🔀 本地中继客户端已连接: %s", "🔀 Local relay client connected: %s"},
+	{"🔀 本地中继客户端已断开: %s", "🔀 Local relay client disconnected: %s"},
+	{"⚠️ 中继消息转发失败，已丢弃: %v", "⚠️ Failed to forward relay message, dropped: %v"},
+	{"⚠️ 写入本地中继客户端失败: %v", "⚠️ Failed to write to local relay client: %v"},
+	{"⚠️ 通知本地中继客户端关闭失败: %v", "⚠️ Failed to notify local relay client of close: %v"},
+	{"⚠️ 本地中继客户端 %s 消息队列已满，丢弃消息", "⚠️ Message queue of local relay client %s is full, dropping message"},
+	{"⚠️ 自动回复规则 %s 渲染失败: %v", "⚠️ Auto-reply rule %s failed to render: %v"},
+	{"🤖 自动回复规则 %s 已匹配", "🤖 Auto-reply rule %s matched"},
+	{"📒 自动回复规则 %s 的回复已排队，连接后重发", "📒 Reply of auto-reply rule %s queued, it will be resent after connecting"},
+	{"⚠️ 自动回复规则 %s 发送失败: %v", "⚠️ Auto-reply rule %s failed to send: %v"},
+	{"⚠️ gzip载荷解压失败，按原始数据处理: %v", "⚠️ Failed to decompress gzip payload, handling it as raw data: %v"},
+	{"💥 混沌测试已启用: 中断=%.3f 延迟=%.3f(最大%v) 重复=%.3f 损坏=%.3f 种子=%d", "💥 Chaos testing enabled: drop=%.3f delay=%.3f(max %v) dup=%.3f corrupt=%.3f seed=%d"},
+	{"💥 混沌注入: 写入延迟 %v", "💥 Chaos injection: write delayed by %v"},
+	{"💥 混沌注入: 翻转第 %d 字节的第 %d 位", "💥 Chaos injection: flipped byte %d bit %d"},
+	{"💥 混沌注入: 重复发送消息", "💥 Chaos injection: message sent twice"},
+	{"💥 混沌注入: 中断连接", "💥 Chaos injection: dropping connection"},
+	{"⚠️ 混沌注入关闭连接失败: %v", "⚠️ Chaos injection failed to close connection: %v"},
+	{"⏱️ ping #%s 在 %v 内未收到pong (连续 %d/%d 次)", "⏱️ ping #%s got no pong within %v (%d/%d in a row)"},
+	{"⚠️ 关闭失效连接失败: %v", "⚠️ Failed to close dead connection: %v"},
+	{"❌ %s消息Schema验证失败: %v", "❌ %s message schema validation failed: %v"},
+	{"📜 非TLS连接，没有服务器证书", "📜 Not a TLS connection, no server certificate"},
+	{"📜 服务器证书链 (%d 张, %s, %s):", "📜 Server certificate chain (%d certificates, %s, %s):"},
+	{"📜 [%d] 主题: %s", "📜 [%d] Subject: %s"},
+	{"📜     签发者: %s", "📜     Issuer: %s"},
+	{"📜     有效期: %s 至 %s", "📜     Valid: %s to %s"},
+	{"📜     公钥SHA-256: %s", "📜     Public key SHA-256: %s"},
+	{"⚠️ 服务器证书已于 %s 过期", "⚠️ Server certificate expired on %s"},
+	{"⚠️ 服务器证书将在 %.0f 天后过期 (%s)", "⚠️ Server certificate expires in %.0f days (%s)"},
+	{"⚠️ 发送关闭帧失败: %v", "⚠️ Failed to send close frame: %v"},
+	{"⚠️ 关闭连接失败: %v", "⚠️ Failed to close connection: %v"},
+	{"🖥️ 测试服务器已启动: ws://%s/ (%s模式，按Ctrl+C停止)", "🖥️ Test server started: ws://%s/ (%s mode, press Ctrl+C to stop)"},
+	{"❌ 测试服务器异常退出: %v", "❌ Test server exited unexpectedly: %v"},
+	{"⚠️ 关闭测试服务器失败: %v", "⚠️ Failed to close test server: %v"},
+	{"🖥️ 测试服务器已停止", "🖥️ Test server stopped"},
+	{"⚠️ 测试服务器连接升级失败: %v", "⚠️ Test server connection upgrade failed: %v"},
+	{"🔗 客户端已连接: %s", "🔗 Client connected: %s"},
+	{"⚠️ 回显失败: %v", "⚠️ Echo failed: %v"},
+	{"⚠️ 广播到 %s 失败: %v", "⚠️ Broadcast to %s failed: %v"},
+	{"🔌 客户端已断开: %s", "🔌 Client disconnected: %s"},
+	{"⚠️ 通知客户端关闭失败: %v", "⚠️ Failed to notify client of close: %v"},
+	{"🧠 已关闭按比例触发的GC (GOGC=off)", "🧠 Proportional GC disabled (GOGC=off)"},
+	{"🧠 软内存上限: %.1f MiB", "🧠 Soft memory limit: %.1f MiB"},
+	{"🧠 内存池增加 %d 字节档位", "🧠 Buffer pool added a %d-byte size class"},
+	{"🧠 内存使用 %.1f MiB 接近上限 (%.0f%%)，释放缓存", "🧠 Memory usage %.1f MiB is close to the limit (%.0f%%), releasing caches"},
+	{"🧠 内存使用回落到 %.1f MiB (%.0f%%)，恢复缓存", "🧠 Memory usage back down to %.1f MiB (%.0f%%), caches restored"},
+	{"🧠 已清空内存池中约 %.1f MiB 空闲缓冲区", "🧠 Released about %.1f MiB of idle buffers from the pool"},
+	{"⚠️ 入站队列已满 (%d)，读取暂停等待消费者 (后续等待只计数)", "⚠️ Inbound queue full (%d), reading paused for the consumer (further waits are only counted)"},
+	{"⚠️ 入站队列已满 (%d)，按 %s 策略丢弃消息 (后续丢弃只计数)", "⚠️ Inbound queue full (%d), dropping messages with the %s policy (further drops are only counted)"},
+	{"🔑 管理API已启用: POST /send, POST /close, GET /messages, GET|PATCH /config", "🔑 Admin API enabled: POST /send, POST /close, GET /messages, GET|PATCH /config"},
+	{"🚫 管理API认证失败: %s %s 来自 %s", "🚫 Admin API authentication failed: %s %s from %s"},
+	{"🔑 管理API发送消息: %d 字节 (%s)", "🔑 Admin API sent message: %d bytes (%s)"},
+	{"🔑 管理API请求关闭连接: 关闭码=%d, 原因=%q", "🔑 Admin API requested close: code=%d, reason=%q"},
+	{"🔑 管理API修改配置: %s", "🔑 Admin API changed config: %s"},
+	{"⚠️ 切换日志级别失败: %v", "⚠️ Failed to change log level: %v"},
+	{"📝 日志级别已切换为 %s (详细ping日志: %t)", "📝 Log level changed to %s (verbose ping logging: %t)"},
+	{"⚠️ 写入JSON响应失败: %v", "⚠️ Failed to write JSON response: %v"},
+	{"⚠️ 指标服务器关闭失败: %v", "⚠️ Failed to shut down metrics server: %v"},
+	{"📊 指标服务器已关闭", "📊 Metrics server stopped"},
+	{"⚠️ 健康检查服务器关闭失败: %v", "⚠️ Failed to shut down health check server: %v"},
+	{"🏥 健康检查服务器已关闭", "🏥 Health check server stopped"},
+	{"⚠️ 统一管理服务器关闭失败: %v", "⚠️ Failed to shut down admin server: %v"},
+	{"🛠️ 统一管理服务器已关闭", "🛠️ Admin server stopped"},
+	{"📤 发送二进制消息: %d 字节\n%s", "📤 Sent binary message: %d bytes\n%s"},
+	{"🔧 高级功能配置: 自动恢复=%v, 自适应缓冲区=%v", "🔧 Advanced features: auto recovery=%v, adaptive buffers=%v"},
+	{"🩺 ===== 诊断报告 [会话: %s] =====", "🩺 ===== Diagnostic report [session: %s] ====="},
+	{"🩺 连接: 状态=%s, 地址=%s, 持续=%v, 重连=%d次", "🩺 Connection: state=%s, address=%s, uptime=%v, reconnects=%d"},
+	{"🩺 消息: 发送 %d 条 (%d 字节), 接收 %d 条 (%d 字节)", "🩺 Messages: sent %d (%d bytes), received %d (%d bytes)"},
+	{"🩺 Ping RTT: 最近=%.1fms 平均=%.1fms 最大=%.1fms (%d 次)", "🩺 Ping RTT: last=%.1fms avg=%.1fms max=%.1fms (%d samples)"},
+	{"🩺 错误: 共 %d 个", "🩺 Errors: %d in total"},
+	{"🩺   [%d] %s: %d 次", "🩺   [%d] %s: %d times"},
+	{"🩺   最后错误: %v (%s)", "🩺   Last error: %v (%s)"},
+	{"🩺 性能: %s=%v", "🩺 Performance: %s=%v"},
+	{"🩺 goroutine: 跟踪中 %d 个, 进程共 %d 个, 疑似泄漏 %d 个", "🩺 goroutines: %d tracked, %d in process, %d suspected leaks"},
+	{"🩺 ===== 诊断报告结束 =====", "🩺 ===== End of diagnostic report ====="},
+	{"📦 流式发送完成: %d 字节, 耗时: %v, 类型: %s", "📦 Streamed send finished: %d bytes, took: %v, type: %s"},
+	{"⚠️ 关闭文件失败: %v", "⚠️ Failed to close file: %v"},
+	{"📤 开始流式发送文件: %s", "📤 Streaming file: %s"},
+	{"❌ 发送文件失败: %v", "❌ Failed to send file: %v"},
+	{"⚠️ 定位到文件末尾失败，从头读取: %v", "⚠️ Failed to seek to end of file, reading from the start: %v"},
+	{"📜 开始跟随文件: %s", "📜 Following file: %s"},
+	{"⚠️ 无法打开要跟随的文件，等待其出现: %v", "⚠️ Cannot open the file to follow, waiting for it to appear: %v"},
+	{"🔄 检测到文件轮转，重新打开: %s", "🔄 File rotation detected, reopening: %s"},
+	{"✂️ 文件被截断，从头读取: %s", "✂️ File truncated, reading from the start: %s"},
+	{"❌ 发送跟随文件的行失败，已跳过: %v", "❌ Failed to send followed line, skipped: %v"},
+	{"🛑 [Retry-After] 要求的等待时间 %v 超出重试总时长上限 (%v)，停止尝试", "🛑 [Retry-After] requested wait %v exceeds the maximum retry duration (%v), giving up"},
+	{"⏳ [Retry-After] 遵循服务器要求，%v后重试...", "⏳ [Retry-After] honoring the server, retrying in %v..."},
+	{"⏳ [Retry-After] 服务器返回 %s，要求 %v 后重试", "⏳ [Retry-After] server returned %s, asking to retry after %v"},
+	{"🔄 尝试自动恢复连接错误...", "🔄 Trying to recover from connection error..."},
+	{"⚠️ 自动恢复失败: %v", "⚠️ Auto recovery failed: %v"},
+	{"🔄 尝试自动恢复%s错误...", "🔄 Trying to recover from %s error..."},
+	{"⚠️ %s错误恢复失败: %v", "⚠️ Recovery from %s error failed: %v"},
+	{"⚠️ 断开连接失败: %v", "⚠️ Failed to disconnect: %v"},
+	{"ⓘ ReadMessages: WebSocket连接在客户端停止过程中关闭: %v", "ⓘ ReadMessages: WebSocket connection closed while the client was stopping: %v"},
+	{"❌ ReadMessages: WebSocket连接异常关闭: %v", "❌ ReadMessages: WebSocket connection closed abnormally: %v"},
+	{"🔌 ReadMessages: 服务器主动关闭连接 (EOF): %v", "🔌 ReadMessages: server closed the connection (EOF): %v"},
+	{"🔌 ReadMessages: 服务器连接意外断开 (UnexpectedEOF): %v", "🔌 ReadMessages: server connection dropped unexpectedly (UnexpectedEOF): %v"},
+	{"⚠️ 收到无效UTF-8的文本消息 (%d 字节)，按原样处理", "⚠️ Received text message with invalid UTF-8 (%d bytes), handling it as is"},
+	{"❌ 入站中间件错误: %v", "❌ Inbound middleware error: %v"},
+	{"❌ 消息处理器错误: %v", "❌ Message handler error: %v"},
+	{"❌ 用户消息处理回调错误: %v", "❌ User message callback error: %v"},
+	{"⚠️ ReadMessages: 连接状态不一致或连接对象为空，退出消息读取循环", "⚠️ ReadMessages: inconsistent connection state or nil connection, leaving the read loop"},
+	{"⚠️ 关闭WebSocket连接失败: %v", "⚠️ Failed to close WebSocket connection: %v"},
+	{"❌ 创建流式落盘文件失败: %v", "❌ Failed to create stream spool file: %v"},
+	{"⚠️ 关闭流式落盘文件失败: %v", "⚠️ Failed to close stream spool file: %v"},
+	{"❌ 流式消息处理失败 [#%d, 已处理 %d 字节]: %v", "❌ Streamed message handling failed [#%d, %d bytes processed]: %v"},
+	{"📦 已流式接收%s [#%d]: %d 字节 -> %s", "📦 Streamed %s received [#%d]: %d bytes -> %s"},
+	{"📡 sendPeriodicPing: 停止周期性ping (context done before ping send)", "📡 sendPeriodicPing: stopping periodic ping (context done before ping send)"},
+	{"❌ sendPeriodicPing: 发送ping失败: %v. 将在下次tick尝试。", "❌ sendPeriodicPing: failed to send ping: %v. Will try again on the next tick."},
+	{"⚠️ 关闭发送日志失败: %v", "⚠️ Failed to close journal: %v"},
+	{"🚨 因协议违规断开连接: 关闭码=%d, 原因=%s", "🚨 Disconnecting due to protocol violation: code=%d, reason=%s"},
+	{"⚠️ 中止读取失败: %v", "⚠️ Failed to abort read: %v"},
+	{"❌ PingHandler: 发送pong失败: %v", "❌ PingHandler: failed to send pong: %v"},
+	{"⚠️ 设置读取超时失败: %v", "⚠️ Failed to set read deadline: %v"},
+	{"⚠️ 设置连接读取超时失败: %v", "⚠️ Failed to set connection read deadline: %v"},
+	{"📥 收到其他类型消息: %d", "📥 Received message of other type: %d"},
+	{"🌐 自定义DNS服务器: %s", "🌐 Custom DNS server: %s"},
+	{"🌐 DNS缓存: 解析结果保留 %v", "🌐 DNS cache: resolved addresses are kept for %v"},
+	{"🔑 TLS密钥日志: %s (仅用于调试，该文件可解密全部wss://流量)", "🔑 TLS key log: %s (debugging only, this file can decrypt all wss:// traffic)"},
+	{"🤖 已加载 %d 条自动回复规则: %s", "🤖 Loaded %d auto-reply rules: %s"},
+	{"📐 已加载JSON Schema: %s (验证方向: %s)", "📐 Loaded JSON Schema: %s (direction: %s)"},
+	{"🔐 已启用端到端加密 (AES-GCM): %s", "🔐 End-to-end encryption enabled (AES-GCM): %s"},
+	{"⚠️ 无法启用终端行编辑，回退到普通输入: %v", "⚠️ Cannot enable terminal line editing, falling back to plain input: %v"},
+	{"❌ 读取输入时出错: %v", "❌ Error reading input: %v"},
+	{"⚠️ 消息显示模板执行失败: %v", "⚠️ Message display template failed: %v"},
+	{"⚠️ 写入历史记录文件失败: %v", "⚠️ Failed to write history file: %v"},
+	{"⚠️ 读取历史记录文件失败: %v", "⚠️ Failed to read history file: %v"},
+	{"⚠️ 整理历史记录文件失败: %v", "⚠️ Failed to compact history file: %v"},
+	{"⚠️ 打开历史记录文件失败，本次发送的消息不会保存: %v", "⚠️ Failed to open history file, messages sent in this run will not be saved: %v"},
+	{"📜 已加载 %d 条发送历史: %s", "📜 Loaded %d history entries: %s"},
+	{"❌ 发送消息失败: %v", "❌ Failed to send message: %v"},
+	{"⚠️ /broadcast 只能在多连接 (--shard) 模式下使用", "⚠️ /broadcast is only available with multiple connections (--shard)"},
+	{"⚠️ 用法: /broadcast [@成员1,成员2] <消息>", "⚠️ Usage: /broadcast [@member1,member2] <message>"},
+	{"⚠️ 没有匹配的成员", "⚠️ No matching members"},
+	{"  📒 %s: 已排队，连接后重发", "  📒 %s: queued, will be resent after connecting"},
+	{"📣 已广播: %s (%d/%d 个成员发送成功)", "📣 Broadcast: %s (sent to %d/%d members)"},
+	{"⚠️ 还没有发送过消息", "⚠️ No messages have been sent yet"},
+	{"⚠️ 历史中没有第 %d 条消息 (共 %d 条，输入 /history 查看)", "⚠️ History has no message %d (%d in total, type /history to list them)"},
+	{"⚠️ Webhook队列已满，丢弃事件: %s", "⚠️ Webhook queue full, dropping event: %s"},
+	{"❌ Webhook事件编码失败: %v", "❌ Failed to encode webhook event: %v"},
+	{"❌ Webhook投递失败 (%s，已尝试%d次): %v", "❌ Webhook delivery failed (%s, %d attempts): %v"},
+	{"⚠️ Webhook投递失败 (%s，第%d次): %v，%v后重试", "⚠️ Webhook delivery failed (%s, attempt %d): %v, retrying in %v"},
+	{"⚠️ 等待Webhook事件投递超时 (%v)，剩余事件未发送", "⚠️ Timed out waiting for webhook delivery (%v), remaining events were not sent"},
+	{"⚠️ 生命周期命令并发数已达上限 (%d)，跳过 %s 事件（累计跳过 %d 个）", "⚠️ Lifecycle command concurrency limit reached (%d), skipping %s event (%d skipped so far)"},
+	{"❌ 生命周期命令超时 [%s]: 已运行 %v，进程已终止", "❌ Lifecycle command timed out [%s]: ran for %v, process killed"},
+	{"❌ 生命周期命令失败 [%s]: %v", "❌ Lifecycle command failed [%s]: %v"},
+	{"⚠️ 等待生命周期命令结束超时 (%v)", "⚠️ Timed out waiting for lifecycle commands to finish (%v)"},
+	{"📋 因并发已满共跳过 %d 个生命周期事件", "📋 Skipped %d lifecycle events because the concurrency limit was reached"},
+	{"⚠️ 转发队列已满，开始丢弃消息（%s）", "⚠️ Forward queue full, dropping messages (%s)"},
+	{"❌ 转发到 %s 失败，放弃 %d 条消息 (已尝试%d次): %v", "❌ Forwarding to %s failed, giving up on %d messages (%d attempts): %v"},
+	{"⚠️ 转发到 %s 失败 (第%d次): %v，%v后重试", "⚠️ Forwarding to %s failed (attempt %d): %v, retrying in %v"},
+	{"⚠️ 等待消息转发超时 (%v)，剩余 %d 条消息未转发", "⚠️ Timed out waiting for forwarding (%v), %d messages were not forwarded"},
+	{"⚠️ 消息大小 %d 超过NATS服务器限制 %d，跳过转发", "⚠️ Message size %d exceeds the NATS server limit %d, not forwarding"},
+	{"📉 SLO错误预算消耗过快 (%.1f倍): %s", "📉 SLO error budget burning too fast (%.1fx): %s"},
+	{"📈 SLO错误预算消耗恢复正常 (%.1f倍)", "📈 SLO error budget burn back to normal (%.1fx)"},
+	{"🚨 错误异常 [会话: %s]: %s", "🚨 Error anomaly [session: %s]: %s"},
+	{"✅ 错误率已恢复正常 [会话: %s]", "✅ Error rate back to normal [session: %s]"},
+	{"⚠️ 发送日志中有 %d 行无法解析，已跳过（可能是崩溃时未写完的记录）", "⚠️ Skipped %d unparsable journal lines (possibly records left incomplete by a crash)"},
+	{"⚠️ 记录发送确认失败 (序号 %d): %v", "⚠️ Failed to record acknowledgement (sequence %d): %v"},
+	{"⚠️ 压缩发送日志失败: %v", "⚠️ Failed to compact journal: %v"},
+	{"📒 消息未能发送，已保留在发送日志中，连接后重发 (序号 %d): %v", "📒 Message not sent, kept in the journal and resent after connecting (sequence %d): %v"},
+	{"📒 重发发送日志中 %d 条未确认的消息...", "📒 Resending %d unacknowledged journal messages..."},
+	{"📒 重发中断，已重发 %d 条，剩余 %d 条等待下次连接: %v", "📒 Resend interrupted, %d resent, %d left for the next connection: %v"},
+	{"⚠️ 放弃发送日志中无法发送的消息 (序号 %d): %v", "⚠️ Giving up on unsendable journal message (sequence %d): %v"},
+	{"📒 发送日志重发完成: %d 条", "📒 Journal resend finished: %d messages"},
+	{"⚠️ 抓包数据库写入队列已满，开始丢弃记录", "⚠️ Capture database write queue full, dropping records"},
+	{"⚠️ 写入抓包数据库失败，丢弃 %d 条记录: %v", "⚠️ Failed to write capture database, dropped %d records: %v"},
+	{"⚠️ 等待抓包数据库写入超时 (%v)，剩余 %d 条记录未写入", "⚠️ Timed out waiting for capture database writes (%v), %d records were not written"},
+	{"⚠️ 关闭抓包数据库失败: %v", "⚠️ Failed to close capture database: %v"},
+	{"🗄️ 抓包数据库已写入 %d 帧，丢弃 %d 帧", "🗄️ Capture database wrote %d frames, dropped %d frames"},
+	{"⚠️ 重新订阅消息渲染失败: %v", "⚠️ Failed to render resubscribe message: %v"},
+	{"📒 重新订阅消息已排队，连接后重发", "📒 Resubscribe message queued, it will be resent after connecting"},
+	{"⚠️ 重新订阅消息发送失败: %v", "⚠️ Failed to send resubscribe message: %v"},
+	{"⚠️ 关闭指标服务器失败: %v", "⚠️ Failed to close metrics server: %v"},
+	{"❌ JSON消息处理器错误: %v", "❌ JSON message handler error: %v"},
+	{"⚠️ 消息通道已满 (%d)，按 %s 策略丢弃消息 (后续丢弃只计数)", "⚠️ Message channel full (%d), dropping messages with the %s policy (further drops are only counted)"},
+	{"⚠️ 疑似goroutine泄漏: %s", "⚠️ Suspected goroutine leak: %s"},
+	{"✅ goroutine泄漏检查已恢复正常", "✅ goroutine leak check back to normal"},
+	{"❌ 后台采样出现panic: %v", "❌ Background sampler panicked: %v"},
+	{"✅ 潜在死锁已解除", "✅ Potential deadlock resolved"},
+	{"🩺 健康状态变化: %s -> %s (%s)", "🩺 Health changed: %s -> %s (%s)"},
+	{"🩺 健康状态变化: %s -> %s", "🩺 Health changed: %s -> %s"},
+	{"🔧 自适应缓冲区: %s", "🔧 Adaptive buffers: %s"},
+	{"⚠️ 无法连接systemd通知套接字: %v", "⚠️ Cannot connect to the systemd notify socket: %v"},
+	{"⚠️ 发送systemd通知失败: %v", "⚠️ Failed to send systemd notification: %v"},
+	{"🐕 systemd看门狗已启用，每 %v 发送一次心跳", "🐕 systemd watchdog enabled, sending a heartbeat every %v"},
+	{"⚠️ 用法: /!N，N为 /history 中的编号", "⚠️ Usage: /!N, where N is a number from /history"},
+	{"❌ 发送 ping 失败: %v", "❌ Failed to send ping: %v"},
+	{"📤 已发送 ping 消息", "📤 Ping sent"},
+	{"⏸️ 已暂停消息输出，输入 /resume 恢复", "⏸️ Message output paused, type /resume to continue"},
+	{"▶️ 已恢复消息输出，暂停期间收到 %d 条消息", "▶️ Message output resumed, %d messages arrived while paused"},
+	{"⚠️ 当前没有活动连接，重试机制会自动继续连接", "⚠️ No active connection, the retry loop will keep reconnecting"},
+	{"🔄 按用户请求断开连接，即将重连...", "🔄 Disconnecting on request, reconnecting shortly..."},
+
+	// 运行错误
+	{"解析服务器证书失败: %w", "Failed to parse server certificate: %w"},
+	{"服务器证书公钥指纹 %s 不匹配任何固定值", "Server certificate public key fingerprint %s does not match any pinned value"},
+	{"无效的公钥指纹 '%s'，需要SHA-256摘要的Base64编码", "Invalid public key fingerprint '%s', expected a Base64-encoded SHA-256 digest"},
+	{"日志路径不能为空", "Log path must not be empty"},
+	{"无法获取绝对路径: %w", "Cannot resolve absolute path: %w"},
+	{"无法获取当前工作目录: %w", "Cannot get the current working directory: %w"},
+	{"无法计算相对路径: %w", "Cannot compute relative path: %w"},
+	{"不允许访问父目录: %s", "Access to parent directories is not allowed: %s"},
+	{"日志文件必须以.log结尾: %s", "Log file must end with .log: %s"},
+	{"文件名过长: %s", "File name too long: %s"},
+	{"路径不能为空", "Path must not be empty"},
+	{"不安全的文件扩展名", "Unsafe file extension"},
+	{"路径包含危险字符", "Path contains dangerous characters"},
+	{"路径必须是绝对路径", "Path must be absolute"},
+	{"无法获取工作目录: %w", "Cannot get the working directory: %w"},
+	{"路径超出安全范围: %s", "Path is outside the allowed area: %s"},
+	{"连接失败: %w", "Connection failed: %w"},
+	{"握手重定向超过 %d 次上限: %w", "Handshake redirects exceeded the limit of %d: %w"},
+	{"无法跟随握手重定向: %v: %w", "Cannot follow handshake redirect: %v: %w"},
+	{"响应缺少Location头部", "Response is missing the Location header"},
+	{"无效的Location '%s': %w", "Invalid Location '%s': %w"},
+	{"不支持的重定向协议 '%s'", "Unsupported redirect scheme '%s'"},
+	{"拒绝从 wss:// 重定向到明文地址 '%s'（使用 --allow-insecure-redirect 允许）", "Refusing redirect from wss:// to plaintext address '%s' (use --allow-insecure-redirect to allow)"},
+	{"无效的带宽 '%s' (例如 512kbps、1mbps)", "Invalid bandwidth '%s' (e.g. 512kbps, 1mbps)"},
+	{"带宽 '%s' 过低，至少为8bps", "Bandwidth '%s' is too low, the minimum is 8bps"},
+	{"消息验证失败: %w", "Message validation failed: %w"},
+	{"消息内容不能为空", "Message content must not be empty"},
+	{"消息大小 %d 超过限制 %d", "Message size %d exceeds the limit %d"},
+	{"无效的消息类型: %d", "Invalid message type: %d"},
+	{"文本消息不是有效的JSON", "Text message is not valid JSON"},
+	{"错误不可恢复: %w", "Error is not recoverable: %w"},
+	{"未知的恢复策略: %v", "Unknown recovery strategy: %v"},
+	{"重试次数超过限制 (%d): %w", "Retry count exceeded the limit (%d): %w"},
+	{"无效的正则表达式模式 '%s': %w", "Invalid regular expression pattern '%s': %w"},
+	{"消息大小超过安全限制: %d > %d", "Message size exceeds the security limit: %d > %d"},
+	{"检测到可疑内容模式: %s", "Suspicious content pattern detected: %s"},
+	{"消息内容不匹配任何允许的模式", "Message content does not match any allowed pattern"},
+	{"发送频率超过限制", "Send rate limit exceeded"},
+	{"连接状态: %s", "Connection state: %s"},
+	{"连续 %d 个ping未收到pong", "%d consecutive pings without a pong"},
+	{"日志文件未打开", "Log file is not open"},
+	{"日志文件不可用: %w", "Log file unavailable: %w"},
+	{"日志路径验证失败: %w", "Log path validation failed: %w"},
+	{"无法创建日志文件 %s: %w", "Cannot create log file %s: %w"},
+	{"序列化会话摘要失败: %w", "Failed to serialize session summary: %w"},
+	{"无效的会话摘要路径: %w", "Invalid session summary path: %w"},
+	{"未启用会话记录", "Transcript recording is not enabled"},
+	{"序列化会话记录失败: %w", "Failed to serialize transcript: %w"},
+	{"无效的会话记录路径: %w", "Invalid transcript path: %w"},
+	{"无法监听 %s: %w", "Cannot listen on %s: %w"},
+	{"读取规则文件失败: %w", "Failed to read rules file: %w"},
+	{"解析规则文件失败: %w", "Failed to parse rules file: %w"},
+	{"规则 %s 无效: %w", "Rule %s is invalid: %w"},
+	{"至少需要regex或json_path匹配条件之一", "At least one of regex or json_path is required"},
+	{"正则表达式错误: %w", "Regular expression error: %w"},
+	{"回复模板错误: %w", "Reply template error: %w"},
+	{"解压后大小超过限制 %d", "Decompressed size exceeds the limit %d"},
+	{"gzip压缩失败: %w", "gzip compression failed: %w"},
+	{"混沌参数 '%s' 缺少 =值", "Chaos parameter '%s' is missing =value"},
+	{"必须大于0", "must be greater than 0"},
+	{"未知的混沌参数 '%s'，可选 drop、delay、delay-max、dup、corrupt、seed", "Unknown chaos parameter '%s', expected drop, delay, delay-max, dup, corrupt or seed"},
+	{"混沌参数 %s 的值 '%s' 无效: %v", "Chaos parameter %s has invalid value '%s': %v"},
+	{"概率必须在0到1之间", "probability must be between 0 and 1"},
+	{"%s 概率 %v 必须在0到1之间", "%s probability %v must be between 0 and 1"},
+	{"delay_max 不能为负数: %v", "delay_max must not be negative: %v"},
+	{"无效的AES密钥: %w", "Invalid AES key: %w"},
+	{"创建AES-GCM失败: %w", "Failed to create AES-GCM: %w"},
+	{"读取密钥文件失败: %w", "Failed to read key file: %w"},
+	{"密钥必须是16、24或32字节（原始字节、十六进制或Base64编码）", "Key must be 16, 24 or 32 bytes (raw bytes, hex or Base64)"},
+	{"生成nonce失败: %w", "Failed to generate nonce: %w"},
+	{"加密文本消息不是有效的Base64: %w", "Encrypted text message is not valid Base64: %w"},
+	{"加密消息过短", "Encrypted message too short"},
+	{"解密失败（密钥不匹配或消息被篡改）: %w", "Decryption failed (wrong key or tampered message): %w"},
+	{"编译JSON Schema失败: %w", "Failed to compile JSON Schema: %w"},
+	{"不是有效的JSON: %w", "Not valid JSON: %w"},
+	{"连接已结束", "Connection has ended"},
+	{"等待服务器响应超时", "Timed out waiting for the server response"},
+	{"期望%s消息，实际收到%s", "Expected %s message, got %s"},
+	{"回显内容不一致: 发送%d字节，收到%d字节", "Echo mismatch: sent %d bytes, received %d bytes"},
+	{"期望pong(%q)，实际收到%s", "Expected pong(%q), got %s"},
+	{"期望关闭帧(%d)，实际收到%s", "Expected close frame(%d), got %s"},
+	{"期望服务器以关闭码%d断开，实际收到%s", "Expected the server to close with code %d, got %s"},
+	{"期望关闭码%d，实际%s", "Expected close code %d, got %s"},
+	{"收到最后一个pong之前: %w", "Before the last pong arrived: %w"},
+	{"pong顺序或载荷错误: 上一个%d，收到%s", "Wrong pong order or payload: previous %d, received %s"},
+	{"握手失败: %s", "Handshake failed: %s"},
+	{"握手失败: %w", "Handshake failed: %w"},
+	{"服务器帧违反协议: %s", "Server frame violates the protocol: %s"},
+	{"读取场景脚本失败: %w", "Failed to read scenario script: %w"},
+	{"解析场景脚本失败: %w", "Failed to parse scenario script: %w"},
+	{"场景脚本没有任何步骤", "Scenario script has no steps"},
+	{"默认等待时限 %q 无效", "Invalid default wait timeout %q"},
+	{"步骤 %s 无效: close必须是最后一个步骤", "Step %s is invalid: close must be the last step"},
+	{"步骤 %s 无效: %w", "Step %s is invalid: %w"},
+	{"send、wait、expect/json_path、close必须且只能指定一种", "Exactly one of send, wait, expect/json_path or close must be set"},
+	{"消息模板错误: %w", "Message template error: %w"},
+	{"暂停时长 %q 无效", "Invalid pause duration %q"},
+	{"关闭码 %d 无效，必须是1000-1003、1007-1014或3000-4999", "Invalid close code %d, must be 1000-1003, 1007-1014 or 3000-4999"},
+	{"等待时限 %q 无效", "Invalid wait timeout %q"},
+	{"渲染消息失败: %w", "Failed to render message: %w"},
+	{"设置写入超时失败: %w", "Failed to set write deadline: %w"},
+	{"发送失败: %w", "Send failed: %w"},
+	{"%v 内未收到匹配的消息 (跳过了 %d 条其他消息)", "No matching message within %v (skipped %d other messages)"},
+	{"等待消息时连接断开: %v", "Connection lost while waiting for a message: %v"},
+	{"发送关闭帧失败: %w", "Failed to send close frame: %w"},
+	{"%v 内服务器未回应关闭帧", "Server did not answer the close frame within %v"},
+	{"关闭握手未完成: %v", "Close handshake not completed: %v"},
+	{"第 %d 条消息发送失败: %w", "Message %d failed to send: %w"},
+	{"设置读取超时失败: %w", "Failed to set read deadline: %w"},
+	{"第 %d 条消息等待回显失败: %w", "Message %d failed waiting for echo: %w"},
+	{"重放速度 '%s' 无效，可选 realtime、max 或正数倍速（如 2x、0.5）", "Invalid replay speed '%s', expected realtime, max or a positive multiplier (e.g. 2x, 0.5)"},
+	{"读取重放记录失败: %w", "Failed to read replay source: %w"},
+	{"解析会话记录失败: %w", "Failed to parse transcript: %w"},
+	{"解码会话记录中的消息失败: %w", "Failed to decode message in transcript: %w"},
+	{"打开抓包数据库失败: %w", "Failed to open capture database: %w"},
+	{"查询抓包数据库失败: %w", "Failed to query capture database: %w"},
+	{"读取抓包数据库失败: %w", "Failed to read capture database: %w"},
+	{"无效的内存大小 '%s' (例如 256MB、1GiB)", "Invalid memory size '%s' (e.g. 256MB, 1GiB)"},
+	{"%s 的正则表达式 '%s' 无效: %w", "Invalid regular expression for %s '%s': %w"},
+	{"时长必须是字符串（如\"30s\"）或纳秒整数", "Duration must be a string (e.g. \"30s\") or an integer number of nanoseconds"},
+	{"标签名 '%s' 只能包含字母、数字和下划线，且不能以数字开头", "Label name '%s' may only contain letters, digits and underscores and must not start with a digit"},
+	{"标签名 '%s' 不能以双下划线开头", "Label name '%s' must not start with a double underscore"},
+	{"标签名 '%s' 已被内置指标使用", "Label name '%s' is already used by built-in metrics"},
+	{"读取数据源失败: %w", "Failed to read data source: %w"},
+	{"打开文件失败: %w", "Failed to open file: %w"},
+	{"创建落盘目录失败: %w", "Failed to create spool directory: %w"},
+	{"创建落盘文件失败: %w", "Failed to create spool file: %w"},
+	{"连接已关闭", "Connection closed"},
+	{"⚠️ 无法解析URL '%s': %v", "⚠️ Cannot parse URL '%s': %v"},
+	{"⚠️ --query 参数值 '%s' 格式必须为 key=value", "⚠️ --query value '%s' must have the form key=value"},
+	{"无法加载自动回复规则: %w", "Cannot load auto-reply rules: %w"},
+	{"无法加载JSON Schema: %w", "Cannot load JSON Schema: %w"},
+	{"无法启用端到端加密: %w", "Cannot enable end-to-end encryption: %w"},
+	{"--highlight 的正则表达式 '%s' 无效: %w", "Invalid --highlight regular expression '%s': %w"},
+	{"未找到本机syslog套接字", "No local syslog socket found"},
+	{"不支持的syslog协议 '%s'，可选 udp、tcp", "Unsupported syslog protocol '%s', expected udp or tcp"},
+	{"服务器返回 %s", "Server returned %s"},
+	{"不支持的acks取值 %q（可选all、1）", "Unsupported acks value %q (expected all or 1)"},
+	{"不支持的转发协议 %q（可选kafka、nats）", "Unsupported forward scheme %q (expected kafka or nats)"},
+	{"缺少服务器地址", "Missing server address"},
+	{"无效的主题 %q", "Invalid topic %q"},
+	{"读取INFO失败: %w", "Failed to read INFO: %w"},
+	{"意外的服务器问候: %q", "Unexpected server greeting: %q"},
+	{"解析INFO失败: %w", "Failed to parse INFO: %w"},
+	{"服务器要求TLS，暂不支持", "Server requires TLS, which is not supported yet"},
+	{"服务器错误: %s", "Server error: %s"},
+	{"连接NATS失败: %w", "Failed to connect to NATS: %w"},
+	{"响应序号不匹配: 期望 %d，实际 %d", "Response correlation ID mismatch: expected %d, got %d"},
+	{"无效的响应长度 %d", "Invalid response length %d"},
+	{"解析Metadata响应失败: %w", "Failed to parse Metadata response: %w"},
+	{"主题 %s 不可用: %s", "Topic %s unavailable: %s"},
+	{"主题 %s 没有可用的分区leader", "Topic %s has no available partition leader"},
+	{"获取Kafka元数据失败: %w", "Failed to fetch Kafka metadata: %w"},
+	{"分区 %d 的leader %d 不在broker列表中", "Partition %d leader %d is not in the broker list"},
+	{"写入分区 %d 失败: %s", "Failed to write partition %d: %s"},
+	{"解析Produce响应失败: %w", "Failed to parse Produce response: %w"},
+	{"无效的状态文件路径: %w", "Invalid state file path: %w"},
+	{"读取状态文件失败: %w", "Failed to read state file: %w"},
+	{"解析状态文件失败: %w", "Failed to parse state file: %w"},
+	{"不支持的状态文件版本: %d", "Unsupported state file version: %d"},
+	{"序列化状态失败: %w", "Failed to serialize state: %w"},
+	{"创建临时状态文件失败: %w", "Failed to create temporary state file: %w"},
+	{"写入状态文件失败: %w", "Failed to write state file: %w"},
+	{"替换状态文件失败: %w", "Failed to replace state file: %w"},
+	{"无效的发送日志目录: %w", "Invalid journal directory: %w"},
+	{"创建发送日志目录失败: %w", "Failed to create journal directory: %w"},
+	{"读取发送日志失败: %w", "Failed to read journal: %w"},
+	{"发送日志已关闭", "Journal is closed"},
+	{"序列化发送日志记录失败: %w", "Failed to serialize journal record: %w"},
+	{"写入发送日志失败: %w", "Failed to write journal: %w"},
+	{"同步发送日志失败: %w", "Failed to sync journal: %w"},
+	{"创建临时发送日志失败: %w", "Failed to create temporary journal: %w"},
+	{"写入临时发送日志失败: %w", "Failed to write temporary journal: %w"},
+	{"同步临时发送日志失败: %w", "Failed to sync temporary journal: %w"},
+	{"替换发送日志失败: %w", "Failed to replace journal: %w"},
+	{"打开发送日志失败: %w", "Failed to open journal: %w"},
+	{"无效的抓包数据库路径: %w", "Invalid capture database path: %w"},
+	{"创建抓包数据库表失败: %w", "Failed to create capture database table: %w"},
+	{"池成员 %s: %w", "Pool member %s: %w"},
+	{"JSON编码失败: %w", "JSON encoding failed: %w"},
+	{"JSON解码为%T失败: %w", "JSON decoding into %T failed: %w"},
+	{"标准输入和标准输出都必须是终端", "Standard input and standard output must both be terminals"},
+	{"无法切换终端到原始模式: %w", "Cannot switch the terminal to raw mode: %w"},
+}
+
+// ===== 终端行编辑 =====
+
+// interactiveCommands 交互模式的特殊命令列表，用于Tab补全
+var interactiveCommands = []string{"/quit", "/exit", "/ping", "/stats", "/state", "/reconnect", "/pause", "/resume", "/sendfile ", "/broadcast ", "/resend", "/history", "/help"}
+
+// maxSentHistory 已发送消息历史条数上限
+const maxSentHistory = 200
+
+// historyListSize /history显示的最近消息条数
+const historyListSize = 20
+
+// runTerminalInteractive 在终端中运行带行编辑的交互模式
+// 这个方法将标准输入切换为原始模式，提供Tab补全、方向键历史和行内编辑
 //
-// 性能优化：
-//   - 限制错误趋势数据的大小，避免内存泄漏
-//   - 高效的错误码提取和分类
-//   - 最小化锁的持有时间
+// 返回值：
+//   - error: 无法切换终端模式时返回错误，调用方应回退到普通按行读取
 //
-// 使用场景：
-//   - 连接错误、发送错误、接收错误的统计
-//   - 错误模式分析和问题诊断
-//   - 监控告警和性能分析
-func (c *WebSocketClient) recordError(err error) {
-	// 使用互斥锁保护错误统计数据
+// 功能说明：
+//   - Tab：补全特殊命令和以前发送过的消息前缀
+//   - 上下方向键：浏览输入历史
+//   - Ctrl+C / Ctrl+D：退出程序
+//
+// 输出处理：
+//   - 原始模式下日志和命令输出都经由终端写出，避免打乱正在编辑的输入行
+//   - 退出时通过restoreConsole恢复终端状态
+func (c *WebSocketClient) runTerminalInteractive() error {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, c.config.prompt(DefaultPrompt))
+	terminal.AutoCompleteCallback = c.completeInteractiveInput
+	for _, entry := range c.sentHistory {
+		terminal.History.Add(entry) // 方向键可以浏览从--history-file加载的历史
+	}
+
+	// 日志和命令输出改为经由终端写出，恢复时还原
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.console = terminal
+	c.consoleRestore = func() {
+		log.SetOutput(c.logOutput())
+		if err := term.Restore(fd, oldState); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 恢复终端状态失败: %v\n", err)
+		}
+	}
+	c.mu.Unlock()
+	log.SetOutput(newLogWriter(terminal, c.config.useColor(os.Stdout), c.config.ASCII))
+	defer c.restoreConsole()
 
-	// 更新基本错误统计
-	c.Stats.Errors.TotalErrors++
-	c.Stats.Errors.LastError = err
-	c.Stats.Errors.LastErrorTime = time.Now()
+	for {
+		line, err := terminal.ReadLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// Ctrl+C 或 Ctrl+D：与 /quit 一致，退出程序
+				log.Print(tr("👋 用户请求退出"))
+				c.cancel()
+			} else {
+				log.Printf(tr("❌ 读取输入时出错: %v"), err)
+			}
+			return nil
+		}
 
-	// 提取和分类错误码
-	errorCode := c.extractErrorCode(err)
+		select {
+		case <-c.ctx.Done():
+			return nil // 客户端已停止，退出交互模式
+		default:
+		}
 
-	// 更新按错误码分类的统计
-	c.Stats.Errors.ErrorsByCode[errorCode]++
+		if exit := c.handleInteractiveInput(line); exit {
+			return nil
+		}
+	}
+}
 
-	// 原子更新Prometheus指标以避免竞态条件
-	atomic.AddInt64(&c.metrics.ErrorsTotal, 1)
+// restoreConsole 恢复终端状态
+// 交互模式启用终端行编辑时，程序退出前必须调用此方法恢复终端，否则终端会停留在原始模式
+//
+// 并发安全：
+//   - 可以多次调用，只有第一次调用生效
+func (c *WebSocketClient) restoreConsole() {
+	c.mu.Lock()
+	restore := c.consoleRestore
+	c.consoleRestore = nil
+	c.console = nil
+	c.mu.Unlock()
 
-	// 更新Prometheus错误码分类指标（需要锁保护map操作）
-	if c.metrics.ErrorsByCodeTotal == nil {
-		c.metrics.ErrorsByCodeTotal = make(map[ErrorCode]int64)
+	if restore != nil {
+		restore()
 	}
-	c.metrics.ErrorsByCodeTotal[errorCode]++
+}
 
-	// 添加到错误趋势记录
-	trendPoint := ErrorTrendPoint{
-		Timestamp:  time.Now(),
-		ErrorCount: 1,
-		ErrorCode:  errorCode,
+// consoleOut 返回交互模式命令输出的目标
+// 终端行编辑启用时经由终端写出，否则写到标准输出
+func (c *WebSocketClient) consoleOut() io.Writer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.console != nil {
+		return newStyledWriter(c.console, false, c.config.ASCII)
 	}
-	c.Stats.Errors.ErrorTrend = append(c.Stats.Errors.ErrorTrend, trendPoint)
+	return newStyledWriter(os.Stdout, false, c.config.ASCII)
+}
 
-	// 保持错误趋势数据在合理范围内（最近1000个错误）
-	// 避免内存无限增长
-	if len(c.Stats.Errors.ErrorTrend) > 1000 {
-		c.Stats.Errors.ErrorTrend = c.Stats.Errors.ErrorTrend[len(c.Stats.Errors.ErrorTrend)-1000:]
+// rememberSentInput 记录已发送的消息，供Tab补全和历史命令使用
+// 相同内容只保留最近的一条，最多保留maxSentHistory条；启用--history-file时同时追加到文件
+func (c *WebSocketClient) rememberSentInput(input string) {
+	if c.historyFile != nil {
+		if _, err := fmt.Fprintln(c.historyFile, input); err != nil {
+			log.Printf(tr("⚠️ 写入历史记录文件失败: %v"), err)
+		}
+	}
+	if idx := slices.Index(c.sentHistory, input); idx >= 0 {
+		c.sentHistory = slices.Delete(c.sentHistory, idx, idx+1)
+	}
+	c.sentHistory = append(c.sentHistory, input)
+	if len(c.sentHistory) > maxSentHistory {
+		c.sentHistory = c.sentHistory[len(c.sentHistory)-maxSentHistory:]
 	}
 }
 
-// inferErrorCode 根据错误内容推断错误码
-// 这个方法通过分析错误消息的内容来推断对应的标准化错误码
-//
-// 参数说明：
-//   - err: 需要分析的错误实例
-//
-// 返回值：
-//   - ErrorCode: 推断出的标准化错误码
-//
-// 推断逻辑：
-//  1. 检查错误消息中的关键字
-//  2. 按照常见错误模式进行匹配
-//  3. 返回最匹配的错误码
-//  4. 无法匹配时返回未知错误码
-//
-// 支持的错误模式：
-//   - "connection refused" -> ErrCodeConnectionRefused
-//   - "timeout" -> ErrCodeConnectionTimeout
-//   - "no such host" -> ErrCodeDNSError
-//   - "tls" -> ErrCodeTLSError
-//   - "handshake" -> ErrCodeHandshakeFailed
-//   - "message too large" -> ErrCodeMessageTooLarge
-//   - "invalid" -> ErrCodeInvalidMessage
-//   - "broken pipe"/"connection reset" -> ErrCodeConnectionLost
-//
-// 使用场景：
-//   - 标准错误的分类和统计
-//   - 错误恢复策略的选择
-//   - 监控系统的错误分类
-//   - 问题诊断和分析
+// loadSentHistory 从--history-file加载已发送消息历史，并打开文件以追加之后发送的消息
+// 文件每行一条消息；行数超过maxSentHistory时先按去重后的历史重写文件，避免无限增长
 //
 // 注意事项：
-//   - 基于字符串匹配，可能存在误判
-//   - 优先匹配更具体的错误模式
-//   - 对于自定义错误类型，应使用extractErrorCode方法
-func (c *WebSocketClient) inferErrorCode(err error) ErrorCode {
-	// 第一步：空错误检查
-	if err == nil {
-		return ErrCodeUnknownError
+//   - 在交互goroutine启动前调用，文件不存在时创建
+//   - 加载失败只记录日志，交互模式照常使用，只是不保存历史
+func (c *WebSocketClient) loadSentHistory() {
+	path := c.config.HistoryFile
+	// #nosec G304 -- 文件路径由用户通过--history-file显式指定
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf(tr("⚠️ 读取历史记录文件失败: %v"), err)
+		return
+	}
+	lines := 0
+	for line := range strings.Lines(string(data)) {
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			c.rememberSentInput(line)
+			lines++
+		}
 	}
 
-	// 第二步：获取错误消息字符串
-	errStr := err.Error()
+	if lines > maxSentHistory {
+		if err := rewriteSentHistory(path, c.sentHistory); err != nil {
+			log.Printf(tr("⚠️ 整理历史记录文件失败: %v"), err)
+		}
+	}
+	// #nosec G304 -- 文件路径由用户通过--history-file显式指定
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		log.Printf(tr("⚠️ 打开历史记录文件失败，本次发送的消息不会保存: %v"), err)
+		return
+	}
+	c.historyFile = file
+	if len(c.sentHistory) > 0 {
+		log.Printf(tr("📜 已加载 %d 条发送历史: %s"), len(c.sentHistory), path)
+	}
+}
 
-	// 第三步：按照错误模式进行匹配（按常见程度排序）
-	switch {
-	case strings.Contains(errStr, "connection refused"):
-		return ErrCodeConnectionRefused
-	case strings.Contains(errStr, "timeout"):
-		return ErrCodeConnectionTimeout
-	case strings.Contains(errStr, "no such host"):
-		return ErrCodeDNSError
-	case strings.Contains(errStr, "tls"):
-		return ErrCodeTLSError
-	case strings.Contains(errStr, "handshake"):
-		return ErrCodeHandshakeFailed
-	case strings.Contains(errStr, "message too large"):
-		return ErrCodeMessageTooLarge
-	case strings.Contains(errStr, "invalid"):
-		return ErrCodeInvalidMessage
-	case strings.Contains(errStr, "broken pipe"), strings.Contains(errStr, "connection reset"):
-		return ErrCodeConnectionLost
-	default:
-		// 无法匹配的错误返回未知错误码
-		return ErrCodeUnknownError
+// rewriteSentHistory 用给定的历史替换历史记录文件（写入临时文件后重命名）
+func rewriteSentHistory(path string, history []string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // 重命名成功后文件已不存在，这里只清理失败时残留的临时文件
+
+	if _, err := tmp.WriteString(strings.Join(history, "\n") + "\n"); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
 	}
+	return os.Rename(tmp.Name(), path)
 }
 
-// GetErrorStats 获取错误统计信息
-// 这个方法以线程安全的方式获取WebSocket客户端的详细错误统计信息
-//
-// 返回值：
-//   - ErrorStats: 错误统计信息的深拷贝
-//
-// 统计信息包含：
-//  1. 错误总数：累计发生的错误次数
-//  2. 最后错误：最近发生的错误实例
-//  3. 错误时间：最后一次错误的时间戳
-//  4. 错误分类：按错误码分类的统计数据
-//  5. 错误趋势：错误发生的时间序列数据
-//
-// 数据安全：
-//   - 返回深拷贝，避免外部修改影响内部状态
-//   - 使用读锁保护数据访问
-//   - 确保数据一致性和完整性
+// sendInteractiveMessage 展开消息变量后发送一条交互消息，并记录到发送历史
+func (c *WebSocketClient) sendInteractiveMessage(input string) {
+	message := expandMessageVariables(input, c.SessionID, &c.sendSeq)
+	if err := c.SendText(message); errors.Is(err, ErrQueued) {
+		log.Printf(tr("📒 消息已排队，连接后重发: %s"), message)
+		c.rememberSentInput(input)
+		return
+	} else if err != nil {
+		log.Printf(tr("❌ 发送消息失败: %v"), err)
+		return
+	}
+	if !c.printMessage("SEND", websocket.TextMessage, []byte(message)) {
+		log.Printf(tr("📤 已发送: %s"), message)
+	}
+	c.rememberSentInput(input)
+}
+
+// broadcastInteractive 处理/broadcast命令：展开消息变量后通过客户端池发送给所有成员，并逐个报告结果
+// 消息以@开头时第一个词是逗号分隔的成员名称，只发送给这些成员，如 /broadcast @eu,us {"op":"ping"}
+func (c *WebSocketClient) broadcastInteractive(input string) {
+	if c.pool == nil {
+		log.Print(tr("⚠️ /broadcast 只能在多连接 (--shard) 模式下使用"))
+		return
+	}
+	var filter func(string, *WebSocketClient) bool
+	if names, rest, ok := strings.Cut(input, " "); ok && strings.HasPrefix(names, "@") {
+		selected := strings.Split(strings.TrimPrefix(names, "@"), ",")
+		filter = func(name string, _ *WebSocketClient) bool { return slices.Contains(selected, name) }
+		input = strings.TrimSpace(rest)
+	}
+	if input == "" || strings.HasPrefix(input, "@") {
+		log.Print(tr("⚠️ 用法: /broadcast [@成员1,成员2] <消息>"))
+		return
+	}
+
+	message := expandMessageVariables(input, c.SessionID, &c.sendSeq)
+	results := c.pool.Broadcast(websocket.TextMessage, []byte(message), filter)
+	if len(results) == 0 {
+		log.Print(tr("⚠️ 没有匹配的成员"))
+		return
+	}
+	succeeded := 0
+	for _, result := range results {
+		switch {
+		case result.Err == nil:
+			succeeded++
+			log.Printf("  ✅ %s", result.Member)
+		case errors.Is(result.Err, ErrQueued):
+			log.Printf(tr("  📒 %s: 已排队，连接后重发"), result.Member)
+		default:
+			log.Printf("  ❌ %s: %v", result.Member, result.Err)
+		}
+	}
+	log.Printf(tr("📣 已广播: %s (%d/%d 个成员发送成功)"), message, succeeded, len(results))
+}
+
+// resendHistory 重新发送历史中的第n条消息（从1开始），n为0时重新发送最近一条
+// 消息按展开前的内容重新展开变量，发送后移到历史末尾
+func (c *WebSocketClient) resendHistory(n int) {
+	if len(c.sentHistory) == 0 {
+		log.Print(tr("⚠️ 还没有发送过消息"))
+		return
+	}
+	if n == 0 {
+		n = len(c.sentHistory)
+	}
+	if n < 1 || n > len(c.sentHistory) {
+		log.Printf(tr("⚠️ 历史中没有第 %d 条消息 (共 %d 条，输入 /history 查看)"), n, len(c.sentHistory))
+		return
+	}
+	c.sendInteractiveMessage(c.sentHistory[n-1])
+}
+
+// showSentHistory 显示最近发送的historyListSize条消息及其编号，编号可用于/!N
+func (c *WebSocketClient) showSentHistory() {
+	out := c.consoleOut()
+	if len(c.sentHistory) == 0 {
+		fmt.Fprintln(out, "📜 还没有发送过消息")
+		return
+	}
+	start := max(len(c.sentHistory)-historyListSize, 0)
+	fmt.Fprintf(out, "📜 最近发送的消息 (共 %d 条):\n", len(c.sentHistory))
+	for i := start; i < len(c.sentHistory); i++ {
+		fmt.Fprintf(out, "   %3d  %s\n", i+1, c.sentHistory[i])
+	}
+}
+
+// completeInteractiveInput 终端Tab补全回调
+// 以光标前的内容为前缀，匹配特殊命令和已发送消息，补全到所有候选的最长公共前缀
 //
-// 并发安全：
-//   - 可以在任意goroutine中安全调用
-//   - 不会阻塞其他操作
-//   - 保证数据的原子性读取
+// 参数说明：
+//   - line: 当前输入行
+//   - pos: 光标位置（字节偏移）
+//   - key: 按下的键
 //
-// 使用场景：
-//   - 错误分析和问题诊断
-//   - 监控系统的错误统计
-//   - 性能分析和优化
-//   - HTTP统计端点的数据源
-func (c *WebSocketClient) GetErrorStats() ErrorStats {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// 返回值：
+//   - string, int: 补全后的输入行和光标位置
+//   - bool: true表示已处理该按键
+func (c *WebSocketClient) completeInteractiveInput(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
 
-	// 创建错误统计信息的深拷贝
-	stats := ErrorStats{
-		TotalErrors:   c.Stats.Errors.TotalErrors,
-		LastError:     c.Stats.Errors.LastError,
-		LastErrorTime: c.Stats.Errors.LastErrorTime,
-		ErrorsByCode:  make(map[ErrorCode]int64),
-		ErrorTrend:    make([]ErrorTrendPoint, len(c.Stats.Errors.ErrorTrend)),
+	// 只在行尾补全，避免改写光标后的内容；无论是否补全都吞掉Tab键
+	if pos != len(line) || line == "" {
+		return line, pos, true
 	}
 
-	// 深拷贝错误码统计映射
-	for code, count := range c.Stats.Errors.ErrorsByCode {
-		stats.ErrorsByCode[code] = count
+	var candidates []string
+	if strings.HasPrefix(line, "/") {
+		for _, cmd := range interactiveCommands {
+			if strings.HasPrefix(cmd, line) {
+				candidates = append(candidates, cmd)
+			}
+		}
+	}
+	// 已发送消息从新到旧匹配
+	for i := len(c.sentHistory) - 1; i >= 0; i-- {
+		if strings.HasPrefix(c.sentHistory[i], line) {
+			candidates = append(candidates, c.sentHistory[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return line, pos, true
 	}
 
-	// 深拷贝错误趋势切片
-	copy(stats.ErrorTrend, c.Stats.Errors.ErrorTrend)
+	completed := commonPrefix(candidates)
+	return completed, len(completed), true
+}
 
-	return stats
+// commonPrefix 返回一组字符串的最长公共前缀（按字节比较，不会截断UTF-8字符）
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, v := range values[1:] {
+		n := 0
+		for n < len(prefix) && n < len(v) && prefix[n] == v[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	// 回退到完整的UTF-8字符边界
+	for len(prefix) > 0 && !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
 }
 
-// GetErrorTrend 获取指定时间范围内的错误趋势
-// 这个方法返回指定时间段内发生的错误趋势数据，用于错误模式分析
+// ===== 控制台输出样式 =====
+
+// 颜色模式取值
+const (
+	ColorAuto   = "auto"   // 输出到终端且未设置NO_COLOR时启用颜色
+	ColorAlways = "always" // 始终启用颜色
+	ColorNever  = "never"  // 始终禁用颜色
+)
+
+// ANSI颜色转义序列
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiDim    = "\x1b[2m"
+)
+
+// highlightColors --highlight可用的颜色名称，高亮部分同时加粗
+var highlightColors = map[string]string{
+	"red":     "\x1b[1;31m",
+	"green":   "\x1b[1;32m",
+	"yellow":  "\x1b[1;33m",
+	"blue":    "\x1b[1;34m",
+	"magenta": "\x1b[1;35m",
+	"cyan":    "\x1b[1;36m",
+	"white":   "\x1b[1;37m",
+}
+
+// highlightRule 一条--highlight规则
+type highlightRule struct {
+	re    *regexp.Regexp // 要高亮的子串模式
+	color string         // 高亮使用的ANSI转义序列
+}
+
+// logHighlights 接收消息的高亮规则，由main根据--highlight设置，只在启用颜色时生效
+var logHighlights []highlightRule
+
+// parseHighlightRules 解析--highlight规则
 //
 // 参数说明：
-//   - since: 时间范围，从现在往前推算的时间段
+//   - specs: 规则列表，格式为"正则[:颜色]"
 //
 // 返回值：
-//   - []ErrorTrendPoint: 时间范围内的错误趋势点列表
-//
-// 趋势数据包含：
-//   - 错误发生的时间戳
-//   - 错误计数（通常为1）
-//   - 错误类型码
-//
-// 过滤逻辑：
-//   - 计算截止时间点（当前时间 - since）
-//   - 只返回截止时间之后的错误记录
-//   - 保持时间顺序不变
-//
-// 并发安全：
-//   - 使用读锁保护数据访问
-//   - 返回数据副本，避免外部修改
-//
-// 使用场景：
-//   - 错误趋势分析和可视化
-//   - 异常检测和告警
-//   - 性能监控和诊断
-//   - 错误模式识别
+//   - []highlightRule: 解析后的规则
+//   - error: 正则表达式无效时返回错误
 //
-// 使用示例：
-//
-//	// 获取最近1小时的错误趋势
-//	trend := client.GetErrorTrend(time.Hour)
-//	// 获取最近24小时的错误趋势
-//	trend := client.GetErrorTrend(24 * time.Hour)
-func (c *WebSocketClient) GetErrorTrend(since time.Duration) []ErrorTrendPoint {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// 注意事项：
+//   - 只有最后一个冒号之后是已知颜色名称时才视为颜色，因此正则本身可以包含冒号
+func parseHighlightRules(specs []string) ([]highlightRule, error) {
+	rules := make([]highlightRule, 0, len(specs))
+	for _, spec := range specs {
+		pattern, color := spec, highlightColors["red"]
+		if i := strings.LastIndex(spec, ":"); i >= 0 {
+			if code, ok := highlightColors[strings.ToLower(spec[i+1:])]; ok {
+				pattern, color = spec[:i], code
+			}
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf(tr("--highlight 的正则表达式 '%s' 无效: %w"), pattern, err)
+		}
+		rules = append(rules, highlightRule{re: re, color: color})
+	}
+	return rules, nil
+}
 
-	// 计算截止时间点
-	cutoff := time.Now().Add(-since)
-	var trend []ErrorTrendPoint
+// applyHighlights 为文本中匹配高亮规则的子串着色，高亮结束后恢复为行颜色
+// 多条规则的匹配重叠时保留先出现（位置相同时规则靠前）的匹配
+func applyHighlights(text, lineColor string) string {
+	type span struct {
+		start, end int
+		color      string
+	}
+	var spans []span
+	for _, rule := range logHighlights {
+		for _, loc := range rule.re.FindAllStringIndex(text, -1) {
+			if loc[1] > loc[0] {
+				spans = append(spans, span{loc[0], loc[1], rule.color})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return text
+	}
+	slices.SortStableFunc(spans, func(a, b span) int { return a.start - b.start })
 
-	// 过滤指定时间范围内的错误记录
-	for _, point := range c.Stats.Errors.ErrorTrend {
-		if point.Timestamp.After(cutoff) {
-			trend = append(trend, point)
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			continue
 		}
+		b.WriteString(text[last:s.start])
+		b.WriteString(s.color)
+		b.WriteString(text[s.start:s.end])
+		b.WriteString(ansiReset)
+		b.WriteString(lineColor)
+		last = s.end
 	}
+	b.WriteString(text[last:])
+	return b.String()
+}
 
-	return trend
+// logLineStyles 日志行前缀与颜色、ASCII标签的对应关系
+// 按顺序匹配行内第一个出现的前缀
+var logLineStyles = []struct {
+	prefix string // emoji前缀
+	color  string // 颜色模式下整行使用的颜色
+	ascii  string // ASCII模式下替换emoji的标签
+}{
+	{"📤", ansiGreen, "[SEND]"},
+	{"📥", ansiCyan, "[RECV]"},
+	{"❌", ansiRed, "[ERROR]"},
+	{"🛑", ansiRed, "[STOP]"},
+	{"⚠️", ansiYellow, "[WARN]"},
+	{"📡", ansiDim, "[PING]"},
 }
 
-// extractErrorCode 从错误中提取标准化的错误码
-// 支持自定义错误类型(ConnectionError, RetryError)和标准错误的智能推断
-// 返回的错误码用于错误分类统计和恢复策略选择
-//
-// Example:
+// useColor 判断输出到指定文件时是否启用颜色
 //
-//	code := client.extractErrorCode(err)
-//	if code == ErrCodeConnectionRefused {
-//	    // 处理连接被拒绝的情况
-//	}
-func (c *WebSocketClient) extractErrorCode(err error) ErrorCode {
-	switch e := err.(type) {
-	case *ConnectionError:
-		return e.Code
-	case *RetryError:
-		return e.Code
+// 判断规则：
+//   - always/never：按配置强制启用或禁用
+//   - auto（默认）：文件是终端、未设置NO_COLOR环境变量且TERM不是dumb时启用
+func (c *ClientConfig) useColor(f *os.File) bool {
+	switch c.Color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
 	default:
-		return c.inferErrorCode(err)
+		return os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && term.IsTerminal(int(f.Fd()))
 	}
 }
 
-// startMonitoringServers 启动监控服务器
-// 这个方法根据配置启动Prometheus指标服务器和健康检查服务器
-//
-// 功能说明：
-//  1. 检查配置中的端口设置
-//  2. 启动Prometheus指标服务器（如果配置了端口）
-//  3. 启动健康检查服务器（如果配置了端口）
-//  4. 使用goroutine并发启动，不阻塞主流程
-//
-// 服务器类型：
-//   - Prometheus指标服务器：提供/metrics端点
-//   - 健康检查服务器：提供/health、/ready、/stats端点
-//
-// 配置要求：
-//   - MetricsPort > 0：启动指标服务器
-//   - HealthPort > 0：启动健康检查服务器
-//   - 端口为0或负数：跳过对应服务器
+// styledWriter 为控制台输出添加颜色或去除emoji的包装器
+// 每次Write按一条日志处理：颜色模式下根据emoji前缀为整行着色，
+// ASCII模式下将已知前缀替换为文字标签并删除其余emoji
+type styledWriter struct {
+	out   io.Writer // 实际输出目标
+	color bool      // 是否启用颜色
+	ascii bool      // 是否替换emoji为ASCII标签
+}
+
+// newStyledWriter 根据颜色和ASCII设置包装输出目标，两者都未启用时直接返回原输出
+// 设置了--timestamp（none除外）时先在每条日志前添加时间戳；
+// 启用了--log-syslog时同时把未着色的原始日志发送到syslog；
+// 输出内容已在调用处按输出语言翻译（见tr），包装器不改写文字，收发的消息内容原样输出
+func newStyledWriter(out io.Writer, color, ascii bool) io.Writer {
+	if logTimestampFormat != "" && logTimestampFormat != TimestampNone {
+		out = &timestampWriter{out: out, format: logTimestampFormat}
+	}
+	if color || ascii {
+		out = &styledWriter{out: out, color: color, ascii: ascii}
+	}
+	if logSyslog != nil {
+		out = io.MultiWriter(out, logSyslog)
+	}
+	return out
+}
+
+// Write 实现io.Writer接口，返回值按原始输入长度计算
+func (w *styledWriter) Write(p []byte) (int, error) {
+	line := string(p)
+	lineColor := ""
+	for _, style := range logLineStyles {
+		if strings.Contains(line, style.prefix) {
+			lineColor = style.color
+			if w.ascii {
+				line = strings.Replace(line, style.prefix, style.ascii, 1)
+			}
+			break
+		}
+	}
+	if w.ascii {
+		line = stripEmoji(line)
+	}
+	if w.color && len(logHighlights) > 0 {
+		// 只高亮接收消息行中📥前缀（ASCII模式下为[RECV]）之后的内容
+		if i := max(strings.Index(line, "📥"), strings.Index(line, "[RECV]")); i >= 0 {
+			line = line[:i] + applyHighlights(line[i:], lineColor)
+		}
+	}
+	if w.color && lineColor != "" {
+		body, newline := strings.CutSuffix(line, "\n")
+		line = lineColor + body + ansiReset
+		if newline {
+			line += "\n"
+		}
+	}
+	if _, err := io.WriteString(w.out, line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stripEmoji 删除字符串中的emoji及其变体选择符，保留中文等普通文字
+func stripEmoji(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r == '\uFE0F' || r == '\u200D': // 变体选择符和零宽连接符
+			continue
+		case r >= 0x2000 && unicode.Is(unicode.So, r): // 符号类字符（emoji、ⓘ等）
+			continue
+		}
+		b.WriteRune(r)
+	}
+	// 去除emoji后可能残留的多余空格
+	return strings.ReplaceAll(b.String(), "  ", " ")
+}
+
+// 时间戳格式取值
+const (
+	TimestampRFC3339 = "rfc3339" // RFC 3339，毫秒精度并带时区，例如2006-01-02T15:04:05.000+08:00
+	TimestampUnix    = "unix"    // Unix秒
+	TimestampUnixMs  = "unixms"  // Unix毫秒
+	TimestampNone    = "none"    // 不输出时间戳
+)
+
+// logTimestampFormat 控制台日志的时间戳格式，由setLogTimestampFormat设置，空字符串表示使用log包默认格式
+var logTimestampFormat string
+
+// setLogTimestampFormat 设置控制台日志的时间戳格式
+// 指定格式时关闭log包自带的日期时间前缀，改由newStyledWriter包装的timestampWriter输出
 //
-// 并发启动：
-//   - 每个服务器在独立的goroutine中运行
-//   - 不会阻塞WebSocket客户端的主要功能
-//   - 服务器启动失败不会影响客户端运行
+// 参数说明：
+//   - format: rfc3339、unix、unixms、none，空字符串表示保持默认格式
 //
-// 使用场景：
-//   - 生产环境的监控集成
-//   - Kubernetes的健康检查
-//   - Prometheus监控系统
-//   - 负载均衡器的健康探测
-func (c *WebSocketClient) startMonitoringServers() {
-	// 启动Prometheus指标服务器（如果配置了端口）
-	if c.config.MetricsPort > 0 {
-		go c.startMetricsServer()
+// 注意事项：
+//   - 需要在创建日志输出（newStyledWriter）之前调用
+func setLogTimestampFormat(format string) {
+	if format == "" {
+		return
 	}
+	logTimestampFormat = format
+	log.SetFlags(0)
+}
 
-	// 启动健康检查服务器（如果配置了端口）
-	if c.config.HealthPort > 0 {
-		go c.startHealthServer()
+// formatTimestamp 按--timestamp指定的格式格式化时间，none时返回空字符串
+func formatTimestamp(format string, t time.Time) string {
+	switch format {
+	case TimestampRFC3339:
+		return t.Format("2006-01-02T15:04:05.000Z07:00")
+	case TimestampUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimestampUnixMs:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	default:
+		return ""
 	}
 }
 
-// startMetricsServer 启动Prometheus指标服务器
-// 这个方法启动一个HTTP服务器，提供Prometheus格式的指标数据
-//
-// 功能说明：
-//  1. 创建HTTP路由器和处理器
-//  2. 配置HTTP服务器参数
-//  3. 启动服务器并监听指定端口
-//  4. 处理服务器启动错误
+// timestampWriter 在每条日志前添加指定格式的时间戳
+// log包每条日志只调用一次Write，因此按Write添加前缀即可
+type timestampWriter struct {
+	out    io.Writer // 实际输出目标
+	format string    // 时间戳格式
+}
+
+// Write 实现io.Writer接口，返回值按原始输入长度计算
+func (w *timestampWriter) Write(p []byte) (int, error) {
+	line := make([]byte, 0, len(p)+32)
+	line = append(line, formatTimestamp(w.format, time.Now())...)
+	line = append(line, ' ')
+	line = append(line, p...)
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logOutput 返回运行日志的默认输出目标（标准错误，按日志级别过滤，按配置着色或去除emoji）
+func (c *WebSocketClient) logOutput() io.Writer {
+	return newLogWriter(os.Stderr, c.config.useColor(os.Stderr), c.config.ASCII)
+}
+
+// consoleMaxSeverity 控制台运行日志输出的最低严重级别（syslog严重级别，数值越大越详细）
+// 由setConsoleLogLevel设置，0表示不过滤
+var consoleMaxSeverity atomic.Int32
+
+// setConsoleLogLevel 按日志级别（0=ERROR, 1=WARN, 2=INFO, 3=DEBUG）设置控制台输出的日志
+// debug为true时（--verbose或详细ping日志）按DEBUG级别输出，与syslog的处理一致
 //
-// 提供的端点：
-//   - /metrics：Prometheus格式的指标数据
+// 并发安全：可以在运行期间调用，立即对之后的日志生效
+func setConsoleLogLevel(logLevel int, debug bool) {
+	if debug {
+		logLevel = 3
+	}
+	consoleMaxSeverity.Store(logLevelSeverity(logLevel))
+}
+
+// logLevelSeverity 将日志级别（0=ERROR, 1=WARN, 2=INFO, 3=DEBUG）转换为允许输出的最低syslog严重级别
+func logLevelSeverity(logLevel int) int32 {
+	severities := []int32{syslogSeverityError, syslogSeverityWarning, syslogSeverityInfo, syslogSeverityDebug}
+	return severities[max(min(logLevel, len(severities)-1), 0)]
+}
+
+// newLogWriter 创建运行日志的控制台输出：先按日志级别过滤，再交给newStyledWriter着色
+// 交互命令的输出不是运行日志，应直接使用newStyledWriter
+func newLogWriter(out io.Writer, color, ascii bool) io.Writer {
+	return levelWriter{out: newStyledWriter(out, color, ascii)}
+}
+
+// levelWriter 按consoleMaxSeverity丢弃过于详细的日志
+// 严重级别与syslog相同，根据emoji前缀推断；收发的消息（📤、📥）和设置变更提示（📝）不是诊断日志，总是输出
+type levelWriter struct {
+	out io.Writer
+}
+
+// Write 实现io.Writer接口，被过滤的日志同样返回成功
+func (w levelWriter) Write(p []byte) (int, error) {
+	if maxSeverity := consoleMaxSeverity.Load(); maxSeverity > 0 {
+		line := string(p)
+		if !strings.ContainsAny(line, "📤📥📝") && syslogSeverity(line) > int(maxSeverity) {
+			return len(p), nil
+		}
+	}
+	return w.out.Write(p)
+}
+
+// ===== Syslog输出 =====
+
+// syslog设施和严重级别（RFC 5424）
+const (
+	syslogFacilityUser    = 1 // 用户级消息
+	syslogSeverityError   = 3 // 错误
+	syslogSeverityWarning = 4 // 警告
+	syslogSeverityNotice  = 5 // 需要注意的正常事件
+	syslogSeverityInfo    = 6 // 普通信息
+	syslogSeverityDebug   = 7 // 调试信息
+	SyslogTag             = "wsc"
+	DefaultSyslogPort     = "514"
+)
+
+// localSyslogPaths 本机syslog套接字的常见位置（Linux、macOS、BSD）
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// logSyslog 运行日志的syslog输出，由main在启用--log-syslog时设置
+var logSyslog *syslogWriter
+
+// syslogWriter 将运行日志发送到本机或远程syslog
+// 没有使用标准库log/syslog：它不支持Windows，而客户端需要在所有平台上编译
 //
-// 服务器配置：
-//   - ReadHeaderTimeout: 10秒，防止慢速攻击
-//   - ReadTimeout: 30秒，完整请求读取超时
-//   - WriteTimeout: 30秒，响应写入超时
-//   - IdleTimeout: 60秒，空闲连接超时
+// 消息格式：
+//   - 本机套接字：RFC 3164风格 <PRI>Mmm dd hh:mm:ss wsc[pid]: 消息
+//   - 网络地址：RFC 5424 <PRI>1 时间戳 主机名 wsc pid - - 消息
 //
-// 错误处理：
-//   - 忽略正常关闭错误（http.ErrServerClosed）
-//   - 记录其他启动错误但不中断程序
+// 注意事项：
+//   - 发送失败时重连一次，仍失败则丢弃该条日志；不能再通过log输出错误，否则会递归
+//
+// 并发安全：使用互斥锁保护连接
+type syslogWriter struct {
+	mu          sync.Mutex
+	network     string   // 连接协议：unixgram、unix、udp、tcp
+	addr        string   // 套接字路径或host:port
+	local       bool     // 是否为本机syslog
+	conn        net.Conn // 当前连接，发送失败后置nil等待重连
+	maxSeverity int32    // 严重级别数值大于此值（更不重要）的日志不发送，可在运行时修改（原子访问）
+	hostname    string   // 本机主机名，用于RFC 5424消息头
+}
+
+// dialSyslog 连接syslog
 //
-// 并发安全：
-//   - 在独立的goroutine中运行
-//   - 不会阻塞其他操作
+// 参数说明：
+//   - target: "local"表示本机syslog套接字；否则为udp://host:port、tcp://host:port或host[:port]（UDP，默认端口514）
+//   - logLevel: 日志级别（0=ERROR, 1=WARN, 2=INFO, 3=DEBUG），决定发送的最低严重级别
 //
-// 使用场景：
-//   - Prometheus监控系统抓取指标
-//   - Grafana仪表板数据源
-//   - 自动化监控和告警
-func (c *WebSocketClient) startMetricsServer() {
-	// 创建HTTP路由器
-	mux := http.NewServeMux()
-	mux.HandleFunc("/metrics", c.handleMetrics)
-
-	// 配置HTTP服务器
-	c.metricsServer = &http.Server{
-		Addr:              fmt.Sprintf(":%d", c.config.MetricsPort),
-		Handler:           mux,
-		ReadHeaderTimeout: 10 * time.Second, // 防止慢速攻击
-		ReadTimeout:       30 * time.Second, // 完整请求读取超时
-		WriteTimeout:      30 * time.Second, // 响应写入超时
-		IdleTimeout:       60 * time.Second, // 空闲连接超时
+// 返回值：
+//   - *syslogWriter: 已连接的syslog输出
+//   - error: 地址无效或无法连接时的错误
+func dialSyslog(target string, logLevel int) (*syslogWriter, error) {
+	w := &syslogWriter{}
+	w.setLogLevel(logLevel)
+	w.hostname, _ = os.Hostname()
+
+	// 第一步：本机syslog依次尝试常见的套接字路径
+	if target == "local" {
+		w.local = true
+		for _, path := range localSyslogPaths {
+			for _, network := range []string{"unixgram", "unix"} {
+				w.network, w.addr = network, path
+				if err := w.connect(); err == nil {
+					return w, nil
+				}
+			}
+		}
+		return nil, errors.New(tr("未找到本机syslog套接字"))
 	}
 
-	// 记录服务器启动信息
-	log.Printf("📊 启动Prometheus指标服务器: http://localhost:%d/metrics", c.config.MetricsPort)
+	// 第二步：解析网络地址，未指定协议时使用UDP，未指定端口时使用514
+	w.network, w.addr = "udp", target
+	if scheme, addr, ok := strings.Cut(target, "://"); ok {
+		if scheme != "udp" && scheme != "tcp" {
+			return nil, fmt.Errorf(tr("不支持的syslog协议 '%s'，可选 udp、tcp"), scheme)
+		}
+		w.network, w.addr = scheme, addr
+	}
+	if _, _, err := net.SplitHostPort(w.addr); err != nil {
+		w.addr = net.JoinHostPort(w.addr, DefaultSyslogPort)
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
 
-	// 启动服务器（阻塞调用）
-	if err := c.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("❌ 指标服务器启动失败: %v", err)
+// connect 建立到syslog的连接，调用方需持有mu或尚未共享该对象
+func (w *syslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+	if err != nil {
+		return err
 	}
+	w.conn = conn
+	return nil
 }
 
-// startHealthServer 启动健康检查服务器
-// 这个方法启动一个HTTP服务器，提供健康检查和统计信息端点
-//
-// 功能说明：
-//  1. 创建HTTP路由器和多个处理器
-//  2. 配置HTTP服务器参数
-//  3. 启动服务器并监听指定端口
-//  4. 处理服务器启动错误
-//
-// 提供的端点：
-//   - /health：健康检查，返回客户端运行状态
-//   - /ready：就绪检查，返回WebSocket连接状态
-//   - /stats：统计信息，返回详细的连接和错误统计
-//
-// 服务器配置：
-//   - ReadHeaderTimeout: 10秒，防止慢速攻击
-//   - ReadTimeout: 30秒，完整请求读取超时
-//   - WriteTimeout: 30秒，响应写入超时
-//   - IdleTimeout: 60秒，空闲连接超时
-//
-// 错误处理：
-//   - 忽略正常关闭错误（http.ErrServerClosed）
-//   - 记录其他启动错误但不中断程序
-//
-// 并发安全：
-//   - 在独立的goroutine中运行
-//   - 不会阻塞其他操作
-//
-// 使用场景：
-//   - Kubernetes liveness和readiness探测
-//   - 负载均衡器健康检查
-//   - 监控系统状态收集
-//   - 运维工具的状态查询
-func (c *WebSocketClient) startHealthServer() {
-	// 创建HTTP路由器和处理器
-	mux := http.NewServeMux()
-	mux.HandleFunc("/health", c.handleHealth) // 健康检查端点
-	mux.HandleFunc("/ready", c.handleReady)   // 就绪检查端点
-	mux.HandleFunc("/stats", c.handleStats)   // 统计信息端点
+// Write 实现io.Writer接口，按日志内容推断严重级别后发送一条运行日志
+// 总是返回成功，避免syslog故障影响控制台输出
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	if log.Flags() == log.LstdFlags && len(line) >= len("2006/01/02 15:04:05 ") {
+		line = line[len("2006/01/02 15:04:05 "):] // syslog自带时间戳，去掉log包的日期时间前缀
+	}
+	if severity := syslogSeverity(line); severity <= int(atomic.LoadInt32(&w.maxSeverity)) {
+		w.send(severity, line)
+	}
+	return len(p), nil
+}
 
-	// 配置HTTP服务器
-	c.healthServer = &http.Server{
-		Addr:              fmt.Sprintf(":%d", c.config.HealthPort),
-		Handler:           mux,
-		ReadHeaderTimeout: 10 * time.Second, // 防止慢速攻击
-		ReadTimeout:       30 * time.Second, // 完整请求读取超时
-		WriteTimeout:      30 * time.Second, // 响应写入超时
-		IdleTimeout:       60 * time.Second, // 空闲连接超时
+// setLogLevel 按日志级别（0=ERROR, 1=WARN, 2=INFO, 3=DEBUG）设置发送的最低严重级别
+func (w *syslogWriter) setLogLevel(logLevel int) {
+	atomic.StoreInt32(&w.maxSeverity, logLevelSeverity(logLevel))
+}
+
+// syslogSeverity 根据日志的emoji前缀推断严重级别
+func syslogSeverity(line string) int {
+	switch {
+	case strings.Contains(line, "❌"), strings.Contains(line, "💔"):
+		return syslogSeverityError
+	case strings.Contains(line, "⚠️"):
+		return syslogSeverityWarning
+	case strings.Contains(line, "🛑"):
+		return syslogSeverityNotice
+	case strings.Contains(line, "📡"):
+		return syslogSeverityDebug
+	default:
+		return syslogSeverityInfo
 	}
+}
 
-	// 记录服务器启动信息
-	log.Printf("🏥 启动健康检查服务器: http://localhost:%d/health", c.config.HealthPort)
+// send 按配置的格式发送一条syslog消息，失败时重连一次
+func (w *syslogWriter) send(severity int, msg string) {
+	priority := syslogFacilityUser*8 + severity
+	var record string
+	if w.local {
+		record = fmt.Sprintf("<%d>%s %s[%d]: %s", priority, time.Now().Format(time.Stamp), SyslogTag, os.Getpid(), msg)
+	} else {
+		record = fmt.Sprintf("<%d>1 %s %s %s %d - - %s", priority, time.Now().Format(time.RFC3339Nano), w.hostname, SyslogTag, os.Getpid(), msg)
+	}
+	if w.network == "tcp" || w.network == "unix" {
+		record += "\n" // 流式连接以换行分隔消息
+	}
 
-	// 启动服务器（阻塞调用）
-	if err := c.healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("❌ 健康检查服务器启动失败: %v", err)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil && w.connect() != nil {
+			return
+		}
+		if _, err := io.WriteString(w.conn, record); err == nil {
+			return
+		}
+		_ = w.conn.Close()
+		w.conn = nil
 	}
 }
 
-// handleMetrics 处理Prometheus指标请求
-// 这个HTTP处理器提供Prometheus格式的指标数据，用于监控系统集成
-//
-// 功能说明：
-//   - 设置正确的Content-Type头部
-//   - 更新最新的指标数据
-//   - 输出标准Prometheus格式的指标
-//   - 支持多种指标类型（计数器、仪表）
-//
-// 提供的指标：
-//  1. websocket_connections_total: 总连接数（计数器）
-//  2. websocket_connections_active: 当前活跃连接数（仪表）
-//  3. websocket_messages_sent_total: 发送消息总数（计数器）
-//  4. websocket_messages_received_total: 接收消息总数（计数器）
-//  5. websocket_bytes_sent_total: 发送字节总数（计数器）
-//  6. websocket_bytes_received_total: 接收字节总数（计数器）
-//  7. websocket_errors_total: 错误总数（计数器）
-//  8. websocket_reconnections_total: 重连总数（计数器）
-//  9. websocket_errors_by_code_total: 按错误码分类的错误（带标签计数器）
-//
-// 使用场景：
-//   - Prometheus监控系统抓取
-//   - Grafana仪表板展示
-//   - 告警规则配置
-//   - 性能分析和调优
-func (c *WebSocketClient) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	// 设置Prometheus标准的Content-Type
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+// Close 关闭syslog连接
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
 
-	// 更新最新的指标数据
-	c.updatePrometheusMetrics()
+// ===== Webhook通知 =====
 
-	// 输出Prometheus格式的指标
-	// 1. 总连接数指标
-	fmt.Fprintf(w, "# HELP websocket_connections_total Total number of WebSocket connections\n")
-	fmt.Fprintf(w, "# TYPE websocket_connections_total counter\n")
-	fmt.Fprintf(w, "websocket_connections_total %d\n", c.metrics.ConnectionsTotal)
+// Webhook事件类型
+const (
+	WebhookEventConnected          = "connected"            // 连接建立（包括每次重连成功）
+	WebhookEventDisconnected       = "disconnected"         // 连接断开，reason为断开原因
+	WebhookEventMaxRetriesExceeded = "max_retries_exceeded" // 重试次数或重试总时长耗尽，客户端即将退出
+	WebhookEventSecurityViolation  = "security_violation"   // 发送的消息未通过安全检查
+)
 
-	// 2. 当前活跃连接数指标
-	fmt.Fprintf(w, "# HELP websocket_connections_active Current active WebSocket connections\n")
-	fmt.Fprintf(w, "# TYPE websocket_connections_active gauge\n")
-	fmt.Fprintf(w, "websocket_connections_active %d\n", c.metrics.ConnectionsActive)
+// Webhook投递参数
+const (
+	WebhookQueueSize    = 64              // 待投递事件队列容量，队列满时丢弃新事件
+	WebhookMaxAttempts  = 3               // 每个事件的最多投递次数
+	WebhookRetryDelay   = 1 * time.Second // 首次重试等待时间，之后每次翻倍
+	WebhookTimeout      = 5 * time.Second // 单次POST请求超时
+	WebhookFlushTimeout = 5 * time.Second // 客户端停止时等待剩余事件投递完成的最长时间
+	WebhookSignatureHdr = "X-WSC-Signature"
+)
 
-	// 3. 发送消息总数指标
-	fmt.Fprintf(w, "# HELP websocket_messages_sent_total Total number of messages sent\n")
-	fmt.Fprintf(w, "# TYPE websocket_messages_sent_total counter\n")
-	fmt.Fprintf(w, "websocket_messages_sent_total %d\n", c.metrics.MessagesSentTotal)
+// webhookEvent POST到Webhook地址的JSON事件
+type webhookEvent struct {
+	Event     string            `json:"event"`                // 事件类型（WebhookEvent*常量）
+	Time      time.Time         `json:"time"`                 // 事件发生时间
+	SessionID string            `json:"session_id"`           // 客户端会话ID
+	URL       string            `json:"url"`                  // 目标WebSocket地址（已隐藏凭据）
+	Reason    string            `json:"reason,omitempty"`     // 断开原因、最后一次连接错误或安全检查错误
+	CloseCode int               `json:"close_code,omitempty"` // 服务器关闭码（仅disconnected，服务器发送了关闭帧时）
+	Attempts  int32             `json:"attempts,omitempty"`   // 已进行的重试次数（仅max_retries_exceeded）
+	Labels    map[string]string `json:"labels,omitempty"`     // --label指定的常量标签
+}
 
-	// 4. 接收消息总数指标
-	fmt.Fprintf(w, "# HELP websocket_messages_received_total Total number of messages received\n")
-	fmt.Fprintf(w, "# TYPE websocket_messages_received_total counter\n")
-	fmt.Fprintf(w, "websocket_messages_received_total %d\n", c.metrics.MessagesReceivedTotal)
+// webhookNotifier 把连接事件异步POST到Webhook地址
+// 事件先进入有界队列，由独立goroutine按顺序投递，网络错误、5xx、408和429按指数退避重试；
+// 配置了密钥时以HMAC-SHA256签名请求体，签名放在X-WSC-Signature头（sha256=<十六进制>）
+//
+// 注意事项：
+//   - 投递goroutine不受客户端上下文控制，Stop时通过close等待剩余事件投递完成
+//   - 事件产生方永不阻塞：队列满或通知器已关闭时丢弃事件并记录日志
+//
+// 并发安全：enqueue可在任意goroutine中调用
+type webhookNotifier struct {
+	url    string       // Webhook地址
+	secret []byte       // HMAC签名密钥，为空时不签名
+	client *http.Client // 投递使用的HTTP客户端
+
+	mu     sync.Mutex        // 保护closed，避免向已关闭的队列发送
+	closed bool              // 是否已关闭
+	events chan webhookEvent // 待投递事件队列
+	done   chan struct{}     // 投递goroutine退出时关闭
+}
 
-	// 5. 发送字节总数指标
-	fmt.Fprintf(w, "# HELP websocket_bytes_sent_total Total number of bytes sent\n")
-	fmt.Fprintf(w, "# TYPE websocket_bytes_sent_total counter\n")
-	fmt.Fprintf(w, "websocket_bytes_sent_total %d\n", c.metrics.BytesSentTotal)
+// newWebhookNotifier 创建Webhook通知器并启动投递goroutine
+//
+// 参数说明：
+//   - url: Webhook地址（http://或https://）
+//   - secret: HMAC签名密钥，空字符串表示不签名
+func newWebhookNotifier(url, secret string) *webhookNotifier {
+	n := &webhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: WebhookTimeout},
+		events: make(chan webhookEvent, WebhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	if secret != "" {
+		n.secret = []byte(secret)
+	}
+	go n.run()
+	return n
+}
 
-	// 6. 接收字节总数指标
-	fmt.Fprintf(w, "# HELP websocket_bytes_received_total Total number of bytes received\n")
-	fmt.Fprintf(w, "# TYPE websocket_bytes_received_total counter\n")
-	fmt.Fprintf(w, "websocket_bytes_received_total %d\n", c.metrics.BytesReceivedTotal)
+// enqueue 将事件加入投递队列，nil接收者表示未配置Webhook
+func (n *webhookNotifier) enqueue(event webhookEvent) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.events <- event:
+	default:
+		log.Printf(tr("⚠️ Webhook队列已满，丢弃事件: %s"), event.Event)
+	}
+}
 
-	// 7. 错误总数指标
-	fmt.Fprintf(w, "# HELP websocket_errors_total Total number of errors\n")
-	fmt.Fprintf(w, "# TYPE websocket_errors_total counter\n")
-	fmt.Fprintf(w, "websocket_errors_total %d\n", c.metrics.ErrorsTotal)
+// run 按顺序投递队列中的事件，队列关闭后退出
+func (n *webhookNotifier) run() {
+	defer close(n.done)
+	for event := range n.events {
+		n.deliver(event)
+	}
+}
 
-	// 8. 重连总数指标
-	fmt.Fprintf(w, "# HELP websocket_reconnections_total Total number of reconnections\n")
-	fmt.Fprintf(w, "# TYPE websocket_reconnections_total counter\n")
-	fmt.Fprintf(w, "websocket_reconnections_total %d\n", c.metrics.ReconnectionsTotal)
+// deliver 投递单个事件，可重试的失败按指数退避重试，最多WebhookMaxAttempts次
+func (n *webhookNotifier) deliver(event webhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf(tr("❌ Webhook事件编码失败: %v"), err)
+		return
+	}
 
-	// 9. 按错误码分类的错误指标（带标签）
-	for code, count := range c.metrics.ErrorsByCodeTotal {
-		fmt.Fprintf(w, "# HELP websocket_errors_by_code_total Total errors by error code\n")
-		fmt.Fprintf(w, "# TYPE websocket_errors_by_code_total counter\n")
-		fmt.Fprintf(w, "websocket_errors_by_code_total{error_code=\"%d\",error_name=\"%s\"} %d\n",
-			int(code), code.String(), count)
+	delay := WebhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(event.Event, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= WebhookMaxAttempts {
+			log.Printf(tr("❌ Webhook投递失败 (%s，已尝试%d次): %v"), event.Event, attempt, err)
+			return
+		}
+		log.Printf(tr("⚠️ Webhook投递失败 (%s，第%d次): %v，%v后重试"), event.Event, attempt, err, delay)
+		time.Sleep(delay)
+		delay *= 2
 	}
 }
 
-// handleHealth 处理健康检查请求
-// 这个HTTP处理器提供标准的健康检查端点，用于负载均衡器和监控系统
-//
-// 功能说明：
-//   - 检查客户端的基本运行状态
-//   - 返回JSON格式的健康状态信息
-//   - 根据状态设置合适的HTTP状态码
-//
-// 健康判断逻辑：
-//   - healthy: 客户端正在运行（非停止状态）
-//   - unhealthy: 客户端已停止或正在停止
+// post 发送一次POST请求
 //
-// 返回格式：
+// 返回值：
+//   - bool: 失败是否值得重试（网络错误、5xx、408、429）
+//   - error: 请求失败或响应状态码不是2xx时返回错误
+func (n *webhookNotifier) post(eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", defaultUserAgent())
+	req.Header.Set("X-WSC-Event", eventType)
+	if len(n.secret) > 0 {
+		req.Header.Set(WebhookSignatureHdr, webhookSignature(n.secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf(tr("服务器返回 %s"), resp.Status)
+}
+
+// close 停止接收新事件，并在timeout内等待队列中的事件投递完成
+func (n *webhookNotifier) close(timeout time.Duration) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.events)
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+	case <-time.After(timeout):
+		log.Printf(tr("⚠️ 等待Webhook事件投递超时 (%v)，剩余事件未发送"), timeout)
+	}
+}
+
+// webhookSignature 计算请求体的HMAC-SHA256签名
+// 返回值格式为 sha256=<十六进制摘要>，接收方用相同密钥计算后以常量时间比较
+func webhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// emitWebhook 生成连接事件并交给Webhook通知器，未配置--webhook-url时不做任何事
 //
-//	{
-//	  "status": "healthy|unhealthy",
-//	  "state": "客户端状态",
-//	  "session_id": "会话ID",
-//	  "timestamp": "检查时间"
-//	}
+// 参数说明：
+//   - eventType: 事件类型（WebhookEvent*常量）
+//   - reason: 事件原因，可以为空
+//   - closeCode: 服务器关闭码，0表示没有
+func (c *WebSocketClient) emitWebhook(eventType, reason string, closeCode int) {
+	if c.webhook == nil {
+		return
+	}
+	event := webhookEvent{
+		Event:     eventType,
+		Time:      time.Now(),
+		SessionID: c.SessionID,
+		URL:       redactURL(c.config.URL),
+		Reason:    reason,
+		CloseCode: closeCode,
+		Labels:    c.config.Labels,
+	}
+	if eventType == WebhookEventMaxRetriesExceeded {
+		event.Attempts = atomic.LoadInt32(&c.RetryCount)
+	}
+	c.webhook.enqueue(event)
+}
+
+// ===== 生命周期命令 =====
+
+// 生命周期事件名称，通过WSC_EVENT环境变量传给命令
+const (
+	ExecHookConnect    = "connect"    // 连接建立（包括每次重连成功）
+	ExecHookDisconnect = "disconnect" // 连接断开
+	ExecHookMessage    = "message"    // 收到数据消息（通过显示过滤器的文本和二进制消息）
+)
+
+// 生命周期命令执行参数
+const (
+	ExecHookTimeout       = 30 * time.Second // 单个命令的最长运行时间，超时后终止
+	ExecHookMaxConcurrent = 4                // 同时运行的命令数上限，已满时跳过新事件，避免高频消息拖垮系统
+	ExecHookFlushTimeout  = 5 * time.Second  // 客户端停止时等待运行中命令结束的最长时间
+	ExecHookSkipLogEvery  = 10 * time.Second // 跳过事件的警告日志最短间隔，避免高频消息刷屏
+)
+
+// execHookRunner 在独立进程中运行--on-*-exec指定的命令
+// 命令通过系统shell执行（类Unix为sh -c，Windows为cmd /C），事件数据放在WSC_*环境变量中，
+// 消息事件的载荷写入命令的标准输入；命令的输出逐行写入运行日志
 //
-// HTTP状态码：
-//   - 200 OK: 健康状态
-//   - 503 Service Unavailable: 不健康状态
+// 注意事项：
+//   - 命令异步运行，永不阻塞读取goroutine；并发数达到上限时跳过事件并计数
+//   - 命令不受客户端上下文控制，客户端停止时通过wait等待运行中的命令结束
+//
+// 并发安全：run可在任意goroutine中调用
+type execHookRunner struct {
+	slots       chan struct{}  // 并发槽位
+	wg          sync.WaitGroup // 运行中的命令
+	skipped     int64          // 因并发已满而跳过的事件数（原子操作）
+	lastSkipLog int64          // 上次记录跳过警告的时间（UnixNano，原子操作）
+}
+
+// newExecHookRunner 创建生命周期命令执行器
+func newExecHookRunner() *execHookRunner {
+	return &execHookRunner{slots: make(chan struct{}, ExecHookMaxConcurrent)}
+}
+
+// run 异步运行一个命令
 //
-// 使用场景：
-//   - Kubernetes liveness probe
-//   - 负载均衡器健康检查
-//   - 监控系统状态检查
-func (c *WebSocketClient) handleHealth(w http.ResponseWriter, r *http.Request) {
-	// 设置JSON响应头
-	w.Header().Set("Content-Type", "application/json")
+// 参数说明：
+//   - event: 事件名称（ExecHook*常量），用于日志
+//   - command: 要执行的shell命令
+//   - env: 附加的环境变量（KEY=VALUE）
+//   - stdin: 写入命令标准输入的数据，nil表示空输入
+func (r *execHookRunner) run(event, command string, env []string, stdin []byte) {
+	select {
+	case r.slots <- struct{}{}:
+	default:
+		skipped := atomic.AddInt64(&r.skipped, 1)
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&r.lastSkipLog)
+		if now-last >= int64(ExecHookSkipLogEvery) && atomic.CompareAndSwapInt64(&r.lastSkipLog, last, now) {
+			log.Printf(tr("⚠️ 生命周期命令并发数已达上限 (%d)，跳过 %s 事件（累计跳过 %d 个）"), ExecHookMaxConcurrent, event, skipped)
+		}
+		return
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() { <-r.slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), ExecHookTimeout)
+		defer cancel()
+
+		cmd := shellCommand(ctx, command)
+		cmd.Env = append(os.Environ(), env...)
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		output, err := cmd.CombinedOutput()
+		for line := range strings.Lines(string(output)) {
+			log.Printf("🪝 [%s] %s", event, strings.TrimRight(line, "\r\n"))
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			log.Printf(tr("❌ 生命周期命令超时 [%s]: 已运行 %v，进程已终止"), event, ExecHookTimeout)
+		} else if err != nil {
+			log.Printf(tr("❌ 生命周期命令失败 [%s]: %v"), event, err)
+		}
+	}()
+}
 
-	// 初始化健康状态
-	status := "healthy"
-	httpStatus := http.StatusOK
+// wait 在timeout内等待运行中的命令结束，nil接收者表示未配置生命周期命令
+func (r *execHookRunner) wait(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf(tr("⚠️ 等待生命周期命令结束超时 (%v)"), timeout)
+	}
+	if skipped := atomic.LoadInt64(&r.skipped); skipped > 0 {
+		log.Printf(tr("📋 因并发已满共跳过 %d 个生命周期事件"), skipped)
+	}
+}
 
-	// 检查客户端运行状态
-	state := c.GetState()
-	if state == StateStopped || state == StateStopping {
-		status = "unhealthy"
-		httpStatus = http.StatusServiceUnavailable
+// shellCommand 创建通过系统shell执行command的命令
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command) // #nosec G204 -- 命令来自用户自己的--on-*-exec参数，按设计交给shell执行
 	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command) // #nosec G204 -- 命令来自用户自己的--on-*-exec参数，按设计交给shell执行
+}
 
-	// 设置HTTP状态码并返回JSON响应
-	w.WriteHeader(httpStatus)
-	fmt.Fprintf(w, `{"status": "%s", "state": "%s", "session_id": "%s", "timestamp": "%s"}`,
-		status, state.String(), c.SessionID, time.Now().Format(time.RFC3339))
+// skippedCount 返回因并发已满而跳过的事件数，nil接收者返回0
+func (r *execHookRunner) skippedCount() int64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.skipped)
 }
 
-// handleReady 处理就绪检查请求
-// 这个HTTP处理器提供就绪状态检查，用于确定服务是否准备好接收流量
-//
-// 功能说明：
-//   - 检查WebSocket连接是否已建立
-//   - 返回JSON格式的就绪状态信息
-//   - 根据连接状态设置合适的HTTP状态码
-//
-// 就绪判断逻辑：
-//   - ready: true - WebSocket连接已建立且正常
-//   - ready: false - WebSocket连接未建立或异常
-//
-// 返回格式：
-//
-//	{
-//	  "ready": true|false,
-//	  "state": "客户端状态",
-//	  "session_id": "会话ID",
-//	  "timestamp": "检查时间"
-//	}
-//
-// HTTP状态码：
-//   - 200 OK: 就绪状态
-//   - 503 Service Unavailable: 未就绪状态
+// runExecHook 运行事件对应的--on-*-exec命令，未配置该事件的命令时不做任何事
 //
-// 使用场景：
-//   - Kubernetes readiness probe
-//   - 负载均衡器流量控制
-//   - 服务发现注册检查
-func (c *WebSocketClient) handleReady(w http.ResponseWriter, r *http.Request) {
-	// 设置JSON响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	// 检查WebSocket连接状态
-	ready := c.isConnected()
-	httpStatus := http.StatusOK
-	if !ready {
-		httpStatus = http.StatusServiceUnavailable
+// 参数说明：
+//   - event: 事件名称（ExecHook*常量）
+//   - stdin: 写入命令标准输入的数据，nil表示空输入
+//   - env: 事件特有的环境变量（KEY=VALUE）
+//
+// 传给命令的环境变量：
+//   - WSC_EVENT: 事件名称
+//   - WSC_SESSION_ID: 客户端会话ID
+//   - WSC_URL: 目标地址（已隐藏凭据）
+//   - disconnect事件：WSC_REASON（断开原因）、WSC_CLOSE_CODE（服务器关闭码，没有时为0）
+//   - message事件：WSC_MESSAGE_TYPE（TEXT或BINARY）、WSC_MESSAGE_SIZE（字节数），载荷写入标准输入
+func (c *WebSocketClient) runExecHook(event string, stdin []byte, env ...string) {
+	if c.execHooks == nil {
+		return
+	}
+	var command string
+	switch event {
+	case ExecHookConnect:
+		command = c.config.OnConnectExec
+	case ExecHookDisconnect:
+		command = c.config.OnDisconnectExec
+	case ExecHookMessage:
+		command = c.config.OnMessageExec
+	}
+	if command == "" {
+		return
 	}
+	env = append(env,
+		"WSC_EVENT="+event,
+		"WSC_SESSION_ID="+c.SessionID,
+		"WSC_URL="+redactURL(c.config.URL),
+	)
+	c.execHooks.run(event, command, env, stdin)
+}
+
+// ===== 消息转发 =====
 
-	// 设置HTTP状态码并返回JSON响应
-	w.WriteHeader(httpStatus)
-	fmt.Fprintf(w, `{"ready": %t, "state": "%s", "session_id": "%s", "timestamp": "%s"}`,
-		ready, c.GetState().String(), c.SessionID, time.Now().Format(time.RFC3339))
+// 转发目标协议
+const (
+	ForwardSchemeKafka = "kafka" // kafka://broker[:9092]/topic[?acks=1]
+	ForwardSchemeNATS  = "nats"  // nats://[user:pass@]server[:4222]/subject
+)
+
+// 消息转发参数
+const (
+	ForwardQueueSize    = 10000                  // 待转发消息队列容量，队列满时丢弃新消息
+	ForwardBatchSize    = 100                    // 每批最多转发的消息数
+	ForwardLinger       = 100 * time.Millisecond // 未攒满一批时最长等待时间
+	ForwardMaxAttempts  = 3                      // 每批消息的最多投递次数
+	ForwardRetryDelay   = 1 * time.Second        // 首次重试等待时间，之后每次翻倍
+	ForwardTimeout      = 10 * time.Second       // 单次连接或投递的超时
+	ForwardFlushTimeout = 5 * time.Second        // 客户端停止时等待剩余消息转发完成的最长时间
+)
+
+// forwardTarget 解析后的--forward地址
+type forwardTarget struct {
+	Scheme string // kafka或nats
+	Addr   string // host:port
+	Name   string // Kafka主题或NATS主题（subject）
+	User   string // NATS用户名，只有用户名时作为令牌
+	Pass   string // NATS密码
+	Acks   int16  // Kafka确认级别：-1表示所有同步副本（默认），1表示只需leader
 }
 
-// handleStats 处理统计信息请求
-// 这个HTTP处理器提供详细的WebSocket客户端统计信息，以JSON格式返回
-//
-// 功能说明：
-//   - 收集连接统计和错误统计信息
-//   - 格式化为结构化的JSON响应
-//   - 提供实时的客户端状态快照
-//
-// 返回的统计信息：
-//  1. 基本信息：会话ID、状态、时间戳
-//  2. 连接信息：连接时间、运行时长、重连次数
-//  3. 消息统计：发送/接收的消息数量和字节数
-//  4. 错误统计：错误总数、最后错误、错误时间
-//
-// JSON响应格式：
+// String 返回不含凭据的目标描述，用于日志和指标
+func (t *forwardTarget) String() string {
+	return t.Scheme + "://" + t.Addr + "/" + t.Name
+}
+
+// parseForwardURL 解析--forward地址
 //
-//	{
-//	  "session_id": "会话标识符",
-//	  "state": "连接状态",
-//	  "connect_time": "连接建立时间",
-//	  "last_message_time": "最后消息时间",
-//	  "uptime_seconds": 运行时长秒数,
-//	  "messages_sent": 发送消息数,
-//	  "messages_received": 接收消息数,
-//	  "bytes_sent": 发送字节数,
-//	  "bytes_received": 接收字节数,
-//	  "reconnect_count": 重连次数,
-//	  "errors": {
-//	    "total_errors": 错误总数,
-//	    "last_error": "最后错误信息",
-//	    "last_error_time": "最后错误时间"
-//	  },
-//	  "timestamp": "当前时间戳"
-//	}
+// 参数说明：
+//   - raw: kafka://broker[:port]/topic[?acks=all|1] 或 nats://[user[:pass]@]server[:port]/subject
 //
-// 使用场景：
-//   - 监控系统的数据收集
-//   - 运维工具的状态查询
-//   - 调试和问题诊断
-//   - 性能分析和优化
-func (c *WebSocketClient) handleStats(w http.ResponseWriter, r *http.Request) {
-	// 设置JSON响应头
-	w.Header().Set("Content-Type", "application/json")
+// 返回值：
+//   - *forwardTarget: 解析结果，未指定端口时使用协议默认端口（Kafka 9092，NATS 4222）
+//   - error: 协议不支持、缺少主题或参数无效时的错误
+func parseForwardURL(raw string) (*forwardTarget, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	target := &forwardTarget{Scheme: strings.ToLower(u.Scheme), Name: strings.TrimPrefix(u.Path, "/"), Acks: -1}
+	var defaultPort string
+	switch target.Scheme {
+	case ForwardSchemeKafka:
+		defaultPort = "9092"
+		switch acks := u.Query().Get("acks"); acks {
+		case "", "all", "-1":
+		case "1":
+			target.Acks = 1
+		default:
+			return nil, fmt.Errorf(tr("不支持的acks取值 %q（可选all、1）"), acks)
+		}
+	case ForwardSchemeNATS:
+		defaultPort = "4222"
+		if u.User != nil {
+			target.User = u.User.Username()
+			target.Pass, _ = u.User.Password()
+		}
+	default:
+		return nil, fmt.Errorf(tr("不支持的转发协议 %q（可选kafka、nats）"), u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New(tr("缺少服务器地址"))
+	}
+	if target.Name == "" || strings.ContainsAny(target.Name, "/ \t") {
+		return nil, fmt.Errorf(tr("无效的主题 %q"), target.Name)
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	target.Addr = net.JoinHostPort(u.Hostname(), port)
+	return target, nil
+}
 
-	// 获取最新的统计数据
-	stats := c.GetStats()
-	errorStats := c.GetErrorStats()
+// forwardSink 转发目标的协议实现
+// 实现只在转发goroutine中调用，不需要并发安全
+type forwardSink interface {
+	// publish 投递一批消息，返回错误时整批视为未送达；实现应在出错后丢弃连接，下次调用时重新连接
+	// rejected为目标无法接收、已跳过的消息数（如超过NATS服务器的max_payload），成功时计入失败数
+	publish(batch [][]byte) (rejected int, err error)
+	// close 关闭到目标的连接
+	close()
+}
 
-	// 构建结构化的JSON响应
-	response := fmt.Sprintf(`{
-		"session_id": "%s",
-		"state": "%s",
-		"connect_time": "%s",
-		"last_message_time": "%s",
-		"uptime_seconds": %.0f,
-		"messages_sent": %d,
-		"messages_received": %d,
-		"bytes_sent": %d,
-		"bytes_received": %d,
-		"reconnect_count": %d,
-		"errors": {
-			"total_errors": %d,
-			"last_error": "%v",
-			"last_error_time": "%s"
-		},
-		"timestamp": "%s"
-	}`,
-		c.SessionID,                                   // 会话标识符
-		c.GetState().String(),                         // 当前连接状态
-		stats.ConnectTime.Format(time.RFC3339),        // 连接建立时间
-		stats.LastMessageTime.Format(time.RFC3339),    // 最后消息时间
-		stats.Uptime.Seconds(),                        // 运行时长（秒）
-		stats.MessagesSent,                            // 发送消息数量
-		stats.MessagesReceived,                        // 接收消息数量
-		stats.BytesSent,                               // 发送字节数
-		stats.BytesReceived,                           // 接收字节数
-		stats.ReconnectCount,                          // 重连次数
-		errorStats.TotalErrors,                        // 错误总数
-		errorStats.LastError,                          // 最后错误信息
-		errorStats.LastErrorTime.Format(time.RFC3339), // 最后错误时间
-		time.Now().Format(time.RFC3339))               // 当前时间戳
-
-	// 输出JSON响应
-	fmt.Fprint(w, response)
+// ForwardStats 消息转发统计
+type ForwardStats struct {
+	Target     string `json:"target"`      // 转发目标（不含凭据）
+	Forwarded  int64  `json:"forwarded"`   // 已确认送达的消息数
+	Batches    int64  `json:"batches"`     // 已送达的批次数
+	Failed     int64  `json:"failed"`      // 重试耗尽、目标拒收或关闭超时后放弃的消息数
+	Dropped    int64  `json:"dropped"`     // 因队列已满丢弃的消息数
+	QueueDepth int    `json:"queue_depth"` // 等待转发的消息数
 }
 
-// updatePrometheusMetrics 更新Prometheus指标
-// 这个方法将内部统计数据同步到Prometheus指标结构中
-//
-// 功能说明：
-//  1. 从内部统计数据更新Prometheus指标
-//  2. 确保指标数据的一致性和准确性
-//  3. 支持实时的指标查询和监控
-//
-// 更新的指标类型：
-//  1. 计数器指标：消息数量、字节数量、错误数量、重连数量
-//  2. 仪表指标：当前连接状态（0或1）
-//  3. 分类指标：按错误码分类的错误统计
-//
-// 数据同步：
-//   - 从c.Stats复制到c.metrics
-//   - 保持数据的原子性和一致性
-//   - 支持Prometheus的拉取模式
+// messageForwarder 把收到的消息按批异步转发到Kafka或NATS
+// 消息先进入有界队列，由独立goroutine攒批投递，失败的批次按指数退避重试
 //
-// 并发安全：
-//   - 使用读锁保护统计数据的读取
-//   - 避免在指标更新过程中数据变化
-//   - 确保指标的准确性
+// 注意事项：
+//   - 转发goroutine不受客户端上下文控制，Stop时通过close等待剩余消息转发完成，
+//     等待超时后转发goroutine放弃剩余消息并退出
+//   - 读取循环永不阻塞：队列满或转发器已关闭时丢弃消息并计数
+//
+// 并发安全：enqueue和stats可在任意goroutine中调用
+type messageForwarder struct {
+	target *forwardTarget // 转发目标
+	sink   forwardSink    // 协议实现
+
+	mu     sync.Mutex    // 保护closed，避免向已关闭的队列发送
+	closed bool          // 是否已关闭
+	queue  chan []byte   // 待转发消息队列
+	done   chan struct{} // 转发goroutine退出时关闭
+	stop   chan struct{} // close等待超时时关闭，通知转发goroutine放弃剩余消息
+
+	stopOnce sync.Once // 保证stop只关闭一次
+
+	forwarded int64 // 已送达的消息数（原子操作）
+	batches   int64 // 已送达的批次数（原子操作）
+	failed    int64 // 放弃的消息数（原子操作）
+	dropped   int64 // 队列满丢弃的消息数（原子操作）
+}
+
+// newMessageForwarder 创建转发器并启动转发goroutine
 //
-// 调用时机：
-//   - handleMetrics处理器中调用
-//   - 确保返回最新的指标数据
-//   - 支持实时监控需求
-func (c *WebSocketClient) updatePrometheusMetrics() {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// 参数说明：
+//   - target: 解析后的转发目标
+//   - clientID: 向Kafka和NATS报告的客户端名称
+func newMessageForwarder(target *forwardTarget, clientID string) *messageForwarder {
+	f := &messageForwarder{
+		target: target,
+		queue:  make(chan []byte, ForwardQueueSize),
+		done:   make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	if target.Scheme == ForwardSchemeKafka {
+		f.sink = &kafkaSink{target: target, clientID: clientID, conns: make(map[int32]*kafkaConn)}
+	} else {
+		f.sink = &natsSink{target: target, clientID: clientID}
+	}
+	go f.run()
+	return f
+}
 
-	// 更新消息和字节统计指标
-	c.metrics.MessagesSentTotal = c.Stats.MessagesSent
-	c.metrics.MessagesReceivedTotal = c.Stats.MessagesReceived
-	c.metrics.BytesSentTotal = c.Stats.BytesSent
-	c.metrics.BytesReceivedTotal = c.Stats.BytesReceived
+// enqueue 将消息加入转发队列，调用方不能再修改message
+func (f *messageForwarder) enqueue(message []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	select {
+	case f.queue <- message:
+	default:
+		if atomic.AddInt64(&f.dropped, 1) == 1 {
+			log.Printf(tr("⚠️ 转发队列已满，开始丢弃消息（%s）"), f.target)
+		}
+	}
+}
 
-	// 更新连接相关指标
-	c.metrics.ReconnectionsTotal = int64(c.Stats.ReconnectCount)
-	c.metrics.ErrorsTotal = c.Stats.Errors.TotalErrors
+// run 从队列攒批并投递，攒满ForwardBatchSize条或等待ForwardLinger后发送，队列关闭后投递剩余消息并退出
+func (f *messageForwarder) run() {
+	defer close(f.done)
+	defer f.sink.close()
 
-	// 更新连接状态指标（仪表类型）
-	if c.isConnected() {
-		c.metrics.ConnectionsActive = 1 // 连接活跃
-	} else {
-		c.metrics.ConnectionsActive = 0 // 连接断开
-	}
+	ticker := time.NewTicker(ForwardLinger)
+	defer ticker.Stop()
 
-	// 更新错误码分类统计
-	for code, count := range c.Stats.Errors.ErrorsByCode {
-		c.metrics.ErrorsByCodeTotal[code] = count
+	batch := make([][]byte, 0, ForwardBatchSize)
+	for {
+		select {
+		case message, ok := <-f.queue:
+			if !ok {
+				f.deliver(batch)
+				return
+			}
+			batch = append(batch, message)
+			if len(batch) >= ForwardBatchSize {
+				if !f.deliver(batch) {
+					f.abandon()
+					return
+				}
+				batch = make([][]byte, 0, ForwardBatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				if !f.deliver(batch) {
+					f.abandon()
+					return
+				}
+				batch = make([][]byte, 0, ForwardBatchSize)
+			}
+		}
 	}
 }
 
-// stopMonitoringServers 停止监控服务器
-// 这个方法优雅地关闭Prometheus指标服务器和健康检查服务器
-//
-// 功能说明：
-//  1. 优雅关闭指标服务器
-//  2. 优雅关闭健康检查服务器
-//  3. 设置合理的关闭超时时间
-//  4. 清理服务器引用
-//
-// 关闭流程：
-//  1. 检查服务器是否存在
-//  2. 创建带超时的上下文（5秒）
-//  3. 调用服务器的Shutdown方法
-//  4. 处理关闭错误和成功情况
-//  5. 清理服务器引用防止内存泄漏
-//
-// 超时处理：
-//   - 设置5秒的优雅关闭超时
-//   - 超时后强制关闭服务器
-//   - 记录关闭状态和错误信息
-//
-// 错误处理：
-//   - 记录关闭失败的警告信息
-//   - 记录成功关闭的确认信息
-//   - 确保在任何情况下都清理引用
+// deliver 投递一批消息，失败时按指数退避重试，最多ForwardMaxAttempts次
 //
-// 调用时机：
-//   - 客户端停止时调用
-//   - 程序退出前的清理工作
-//   - 确保资源正确释放
-func (c *WebSocketClient) stopMonitoringServers() {
-	// 停止Prometheus指标服务器
-	if c.metricsServer != nil {
-		// 创建5秒超时的上下文
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+// 返回值：
+//   - bool: close等待超时而放弃整批消息时返回false，调用方应停止转发
+func (f *messageForwarder) deliver(batch [][]byte) bool {
+	if len(batch) == 0 {
+		return true
+	}
+	delay := ForwardRetryDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-f.stop:
+			atomic.AddInt64(&f.failed, int64(len(batch)))
+			return false
+		default:
+		}
 
-		// 优雅关闭指标服务器
-		if err := c.metricsServer.Shutdown(ctx); err != nil {
-			log.Printf("⚠️ 指标服务器关闭失败: %v", err)
-		} else {
-			log.Printf("📊 指标服务器已关闭")
+		rejected, err := f.sink.publish(batch)
+		if err == nil {
+			atomic.AddInt64(&f.forwarded, int64(len(batch)-rejected))
+			atomic.AddInt64(&f.failed, int64(rejected))
+			atomic.AddInt64(&f.batches, 1)
+			return true
 		}
-		c.metricsServer = nil // 清理引用
+		if attempt >= ForwardMaxAttempts {
+			atomic.AddInt64(&f.failed, int64(len(batch)))
+			log.Printf(tr("❌ 转发到 %s 失败，放弃 %d 条消息 (已尝试%d次): %v"), f.target, len(batch), attempt, err)
+			return true
+		}
+		log.Printf(tr("⚠️ 转发到 %s 失败 (第%d次): %v，%v后重试"), f.target, attempt, err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-f.stop:
+			timer.Stop()
+			atomic.AddInt64(&f.failed, int64(len(batch)))
+			return false
+		}
+		delay *= 2
+	}
+}
+
+// abandon 放弃队列中剩余的消息并计入失败数，只在close关闭队列之后调用
+func (f *messageForwarder) abandon() {
+	for range f.queue {
+		atomic.AddInt64(&f.failed, 1)
+	}
+}
+
+// stats 返回转发统计快照
+func (f *messageForwarder) stats() ForwardStats {
+	return ForwardStats{
+		Target:     f.target.String(),
+		Forwarded:  atomic.LoadInt64(&f.forwarded),
+		Batches:    atomic.LoadInt64(&f.batches),
+		Failed:     atomic.LoadInt64(&f.failed),
+		Dropped:    atomic.LoadInt64(&f.dropped),
+		QueueDepth: len(f.queue),
+	}
+}
+
+// close 停止接收新消息，并在timeout内等待队列中的消息转发完成
+// 超时后通知转发goroutine放弃剩余消息；正在进行的投递受ForwardTimeout限制，结束后goroutine随即退出
+func (f *messageForwarder) close(timeout time.Duration) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.queue)
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-time.After(timeout):
+		log.Printf(tr("⚠️ 等待消息转发超时 (%v)，剩余 %d 条消息未转发"), timeout, len(f.queue))
+		f.stopOnce.Do(func() { close(f.stop) })
 	}
+}
 
-	// 停止健康检查服务器
-	if c.healthServer != nil {
-		// 创建5秒超时的上下文
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		// 优雅关闭健康检查服务器
-		if err := c.healthServer.Shutdown(ctx); err != nil {
-			log.Printf("⚠️ 健康检查服务器关闭失败: %v", err)
-		} else {
-			log.Printf("🏥 健康检查服务器已关闭")
-		}
-		c.healthServer = nil // 清理引用
+// forwardMessage 把收到的数据消息交给转发器，未配置--forward时不做任何事
+// 消息缓冲区可能被复用，因此复制一份
+func (c *WebSocketClient) forwardMessage(messageType int, message []byte) {
+	if c.forwarder == nil || !isDataMessage(messageType) {
+		return
 	}
+	c.forwarder.enqueue(bytes.Clone(message))
 }
 
-// SendMessage 发送消息到 WebSocket 服务器
-// 集成了消息处理器、自适应缓冲区和错误恢复功能
-// 支持文本消息、二进制消息和控制消息的发送
-//
-// Example:
-//
-//	// 发送文本消息
-//	err := client.SendMessage(websocket.TextMessage, []byte("Hello"))
-//
-//	// 发送二进制消息
-//	err := client.SendMessage(websocket.BinaryMessage, binaryData)
-//
-//	// 发送ping消息
-//	err := client.SendMessage(websocket.PingMessage, nil)
-func (c *WebSocketClient) SendMessage(messageType int, data []byte) error {
-	// 记录锁获取（死锁检测）
-	c.deadlockDetector.AcquireLock("send")
-	defer c.deadlockDetector.ReleaseLock("send")
+// ----- NATS -----
 
-	// 频率限制检查
-	if !c.rateLimiter.Allow() {
-		err := &ConnectionError{
-			Code:  ErrCodeRateLimitExceeded,
-			Op:    "send",
-			URL:   c.config.URL,
-			Err:   fmt.Errorf("发送频率超过限制"),
-			Retry: true,
-		}
-		c.recordError(err)
+// natsSink 使用NATS文本协议发布消息
+// 每批消息以PUB命令写出后发送PING，收到PONG即表示服务器已处理整批消息
+type natsSink struct {
+	target   *forwardTarget
+	clientID string
+
+	conn       net.Conn      // 当前连接，出错后置为nil
+	reader     *bufio.Reader // 读取服务器命令
+	maxPayload int           // 服务器INFO中的max_payload，0表示未知
+}
+
+// natsInfo 服务器INFO命令中用到的字段
+type natsInfo struct {
+	MaxPayload   int  `json:"max_payload"`
+	AuthRequired bool `json:"auth_required"`
+	TLSRequired  bool `json:"tls_required"`
+}
+
+// connect 建立连接：读取INFO，发送CONNECT，并用PING/PONG确认认证通过
+func (s *natsSink) connect() error {
+	conn, err := net.DialTimeout("tcp", s.target.Addr, ForwardTimeout)
+	if err != nil {
 		return err
 	}
+	_ = conn.SetDeadline(time.Now().Add(ForwardTimeout))
+	reader := bufio.NewReader(conn)
 
-	// 安全检查
-	if err := c.securityChecker.CheckMessage(messageType, data); err != nil {
-		securityErr := &ConnectionError{
-			Code:  ErrCodeSecurityViolation,
-			Op:    "send",
-			URL:   c.config.URL,
-			Err:   err,
-			Retry: false,
-		}
-		c.recordError(securityErr)
-		return securityErr
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf(tr("读取INFO失败: %w"), err)
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		_ = conn.Close()
+		return fmt.Errorf(tr("意外的服务器问候: %q"), strings.TrimSpace(line))
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(rest), &info); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf(tr("解析INFO失败: %w"), err)
+	}
+	if info.TLSRequired {
+		_ = conn.Close()
+		return errors.New(tr("服务器要求TLS，暂不支持"))
 	}
 
-	conn, connected := c.getConnSafely()
-	if conn == nil || !connected {
-		err := &ConnectionError{
-			Code:  ErrCodeConnectionLost,
-			Op:    "send",
-			URL:   c.config.URL,
-			Err:   ErrConnectionClosed,
-			Retry: false,
-		}
-		c.recordError(err)
+	options := map[string]any{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     s.clientID,
+		"lang":     "go",
+		"version":  AppVersion,
+		"protocol": 1,
+	}
+	switch {
+	case s.target.User != "" && s.target.Pass != "":
+		options["user"], options["pass"] = s.target.User, s.target.Pass
+	case s.target.User != "":
+		options["auth_token"] = s.target.User
+	}
+	connectJSON, err := json.Marshal(options)
+	if err != nil {
+		_ = conn.Close()
 		return err
 	}
-
-	// 使用消息处理器验证和格式化消息
-	if err := c.messageProcessor.ValidateMessage(messageType, data); err != nil {
-		validationErr := &ConnectionError{
-			Code:  ErrCodeInvalidMessage,
-			Op:    "send",
-			URL:   c.config.URL,
-			Err:   err,
-			Retry: false,
-		}
-		c.recordError(validationErr)
-		return validationErr
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connectJSON); err != nil {
+		_ = conn.Close()
+		return err
 	}
 
-	// 直接使用原始数据，简化消息处理
-	formattedData := data
-
-	// 检查消息大小（双重检查）
-	if len(formattedData) > c.config.MaxMessageSize {
-		err := &ConnectionError{
-			Code:  ErrCodeMessageTooLarge,
-			Op:    "send",
-			URL:   c.config.URL,
-			Err:   fmt.Errorf("消息大小 %d 超过限制 %d", len(formattedData), c.config.MaxMessageSize),
-			Retry: false,
-		}
-		c.recordError(err)
+	s.conn, s.reader, s.maxPayload = conn, reader, info.MaxPayload
+	if err := s.waitPong(); err != nil {
+		s.close()
 		return err
 	}
+	return nil
+}
 
-	// 设置写入超时
-	if err := conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout)); err != nil {
-		timeoutErr := &ConnectionError{
-			Code:  ErrCodeSendTimeout,
-			Op:    "send",
-			URL:   c.config.URL,
-			Err:   err,
-			Retry: false,
+// waitPong 读取服务器命令直到收到PONG，期间响应服务器的PING，遇到-ERR时返回错误
+func (s *natsSink) waitPong() error {
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return err
 		}
-		c.recordError(timeoutErr)
-		return timeoutErr
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := io.WriteString(s.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf(tr("服务器错误: %s"), strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK和INFO（集群拓扑变化）无需处理
 	}
+}
 
-	// 使用写锁保护WebSocket写操作，防止并发写入
-	c.writeMu.Lock()
-	defer c.writeMu.Unlock()
-
-	// 自适应缓冲区优化：根据消息大小和历史性能动态选择缓冲策略
-	var sendData []byte
-	var needReturn bool
-
-	if c.AdaptiveBuffer {
-		// 自适应缓冲区逻辑
-		bufferSize := c.calculateOptimalBufferSize(len(formattedData))
-		if bufferSize <= LargeBufferSize {
-			buf := globalBufferPool.Get(bufferSize)
-			// 延迟释放缓冲区的匿名函数：确保缓冲区在使用完毕后正确归还到内存池
-			defer func() {
-				if needReturn {
-					globalBufferPool.Put(buf) // 将缓冲区归还到全局内存池，避免内存泄漏
-				}
-			}()
-			copy(buf, formattedData)
-			sendData = buf[:len(formattedData)] // 只发送实际数据长度
-			needReturn = true
-		} else {
-			// 对于超大消息，直接使用原始数据
-			sendData = formattedData
-			needReturn = false
-		}
-	} else {
-		// 传统缓冲区逻辑
-		if len(formattedData) <= LargeBufferSize {
-			buf := globalBufferPool.Get(len(formattedData))
-			// 延迟释放缓冲区的匿名函数：确保传统缓冲区逻辑中的缓冲区正确归还
-			defer func() {
-				if needReturn {
-					globalBufferPool.Put(buf) // 将缓冲区归还到全局内存池，保持内存池的高效运作
-				}
-			}()
-			copy(buf, formattedData)
-			sendData = buf[:len(formattedData)] // 只发送实际数据长度
-			needReturn = true
-		} else {
-			sendData = formattedData
-			needReturn = false
+// publish 发布一批消息，超过服务器max_payload的消息被跳过并记录日志（服务器会因此断开连接）
+func (s *natsSink) publish(batch [][]byte) (int, error) {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return 0, fmt.Errorf(tr("连接NATS失败: %w"), err)
 		}
 	}
 
-	// 发送消息
-	startTime := time.Now()
-	if err := conn.WriteMessage(messageType, sendData); err != nil {
-		sendErr := &ConnectionError{
-			Code:  c.inferErrorCode(err),
-			Op:    "send",
-			URL:   c.config.URL,
-			Err:   err,
-			Retry: true,
+	var buf bytes.Buffer
+	rejected := 0
+	for _, message := range batch {
+		if s.maxPayload > 0 && len(message) > s.maxPayload {
+			log.Printf(tr("⚠️ 消息大小 %d 超过NATS服务器限制 %d，跳过转发"), len(message), s.maxPayload)
+			rejected++
+			continue
 		}
-		c.handleErrorWithRecovery(sendErr, "发送")
+		fmt.Fprintf(&buf, "PUB %s %d\r\n", s.target.Name, len(message))
+		buf.Write(message)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("PING\r\n")
 
-		return sendErr
+	_ = s.conn.SetDeadline(time.Now().Add(ForwardTimeout))
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.close()
+		return 0, err
 	}
-	sendDuration := time.Since(startTime)
+	if err := s.waitPong(); err != nil {
+		s.close()
+		return 0, err
+	}
+	return rejected, nil
+}
 
-	// 更新统计信息
-	c.updateStats(messageType, len(formattedData), true)
+// close 关闭连接
+func (s *natsSink) close() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn, s.reader = nil, nil
+	}
+}
 
-	// 记录消息到日志文件
-	c.logMessage("SEND", messageType, formattedData)
+// ----- Kafka -----
 
-	// 记录发送性能（简化版）
-	log.Printf("📊 消息发送耗时: %v, 类型: %s", sendDuration, c.getMessageTypeString(messageType))
+// Kafka协议常量（只实现生产消息所需的最小子集）
+const (
+	kafkaAPIProduce      = 0 // Produce请求
+	kafkaAPIMetadata     = 3 // Metadata请求
+	kafkaProduceVersion  = 3 // Produce v3：Kafka 0.11起支持，使用v2格式的RecordBatch
+	kafkaMetadataVersion = 4 // Metadata v4：Kafka 1.0起支持
+)
 
-	return nil
+// kafkaConn 到单个broker的连接
+type kafkaConn struct {
+	conn          net.Conn
+	correlationID int32
 }
 
-// calculateOptimalBufferSize 计算最优缓冲区大小
-// 基于消息大小、历史性能和系统资源使用情况
-func (c *WebSocketClient) calculateOptimalBufferSize(messageSize int) int {
-	// 根据消息大小选择合适的缓冲区级别
-	var baseSize int
-	switch {
-	case messageSize <= SmallBufferSize:
-		baseSize = SmallBufferSize
-	case messageSize <= MediumBufferSize:
-		baseSize = MediumBufferSize
-	case messageSize <= LargeBufferSize:
-		baseSize = LargeBufferSize
-	default:
-		// 对于超大消息，使用实际大小
-		baseSize = messageSize
+// roundTrip 发送一个请求并读取对应的响应体（去掉响应头中的correlation_id）
+func (kc *kafkaConn) roundTrip(apiKey, apiVersion int16, clientID string, body []byte) ([]byte, error) {
+	kc.correlationID++
+	req := make([]byte, 4, 4+10+len(clientID)+len(body))
+	req = binary.BigEndian.AppendUint16(req, uint16(apiKey))
+	req = binary.BigEndian.AppendUint16(req, uint16(apiVersion))
+	req = binary.BigEndian.AppendUint32(req, uint32(kc.correlationID))
+	req = kafkaAppendString(req, clientID)
+	req = append(req, body...)
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+
+	_ = kc.conn.SetDeadline(time.Now().Add(ForwardTimeout))
+	if _, err := kc.conn.Write(req); err != nil {
+		return nil, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(kc.conn, header[:]); err != nil {
+		return nil, err
 	}
+	size := int32(binary.BigEndian.Uint32(header[:4]))
+	if id := int32(binary.BigEndian.Uint32(header[4:])); id != kc.correlationID {
+		return nil, fmt.Errorf(tr("响应序号不匹配: 期望 %d，实际 %d"), kc.correlationID, id)
+	}
+	if size < 4 || size > 64<<20 {
+		return nil, fmt.Errorf(tr("无效的响应长度 %d"), size)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(kc.conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
 
-	// 根据当前性能指标调整缓冲区大小
-	performanceReport := c.performanceMonitor.GetPerformanceReport()
+// kafkaPartition 主题分区及其leader
+type kafkaPartition struct {
+	id     int32
+	leader int32
+}
 
-	// 如果CPU使用率高，使用较小的缓冲区以减少内存压力
-	if cpuUsage, ok := performanceReport["cpu_usage_percent"].(float64); ok && cpuUsage > 80.0 {
-		baseSize = int(float64(baseSize) * 0.8)
-	}
+// kafkaSink 使用Kafka协议把消息写入主题
+// 启动时（以及出错后）通过Metadata请求找到各分区的leader，每批消息写入一个分区，分区轮流使用
+type kafkaSink struct {
+	target   *forwardTarget
+	clientID string
 
-	// 如果内存使用率高，使用较小的缓冲区
-	if memUsage, ok := performanceReport["memory_usage_bytes"].(int64); ok && memUsage > 100*1024*1024 { // 100MB
-		baseSize = int(float64(baseSize) * 0.9)
-	}
+	brokers    map[int32]string     // broker节点ID -> host:port，nil表示需要刷新元数据
+	partitions []kafkaPartition     // 主题的分区
+	conns      map[int32]*kafkaConn // broker节点ID -> 连接，-1为引导连接
+	next       int                  // 下一批使用的分区下标
+}
 
-	// 确保缓冲区大小不小于消息大小
-	if baseSize < messageSize {
-		baseSize = messageSize
+// dial 返回到指定broker的连接，必要时建立新连接
+func (s *kafkaSink) dial(nodeID int32, addr string) (*kafkaConn, error) {
+	if kc, ok := s.conns[nodeID]; ok {
+		return kc, nil
 	}
-
-	return baseSize
+	conn, err := net.DialTimeout("tcp", addr, ForwardTimeout)
+	if err != nil {
+		return nil, err
+	}
+	kc := &kafkaConn{conn: conn}
+	s.conns[nodeID] = kc
+	return kc, nil
 }
 
-// SetDependencies 设置核心组件（简化版）
-func (c *WebSocketClient) SetDependencies(
-	connector Connector,
-	messageProcessor MessageProcessor,
-	errorRecovery ErrorRecovery,
-) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// refreshMetadata 通过引导地址查询主题的分区和leader
+func (s *kafkaSink) refreshMetadata() error {
+	kc, err := s.dial(-1, s.target.Addr)
+	if err != nil {
+		return err
+	}
 
-	if connector != nil {
-		c.connector = connector
+	// Metadata v4请求：topics数组 + allow_auto_topic_creation
+	body := binary.BigEndian.AppendUint32(nil, 1)
+	body = kafkaAppendString(body, s.target.Name)
+	body = append(body, 1)
+	resp, err := kc.roundTrip(kafkaAPIMetadata, kafkaMetadataVersion, s.clientID, body)
+	if err != nil {
+		return err
 	}
-	if messageProcessor != nil {
-		c.messageProcessor = messageProcessor
+
+	d := &kafkaDecoder{buf: resp}
+	d.int32() // throttle_time_ms
+	brokers := make(map[int32]string)
+	for range d.arrayLen() {
+		nodeID := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[nodeID] = net.JoinHostPort(host, strconv.Itoa(int(port)))
 	}
-	if errorRecovery != nil {
-		c.errorRecovery = errorRecovery
+	d.string() // cluster_id
+	d.int32()  // controller_id
+
+	var partitions []kafkaPartition
+	var topicErr int16
+	for range d.arrayLen() {
+		errCode := d.int16()
+		name := d.string()
+		d.int8() // is_internal
+		for range d.arrayLen() {
+			d.int16() // 分区错误码：leader不可用时leader_id为-1，下面跳过
+			id := d.int32()
+			leader := d.int32()
+			d.skipInt32Array() // replica_nodes
+			d.skipInt32Array() // isr_nodes
+			if name == s.target.Name && leader >= 0 {
+				partitions = append(partitions, kafkaPartition{id: id, leader: leader})
+			}
+		}
+		if name == s.target.Name {
+			topicErr = errCode
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf(tr("解析Metadata响应失败: %w"), d.err)
+	}
+	if topicErr != 0 {
+		return fmt.Errorf(tr("主题 %s 不可用: %s"), s.target.Name, kafkaErrorName(topicErr))
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf(tr("主题 %s 没有可用的分区leader"), s.target.Name)
 	}
+	s.brokers, s.partitions = brokers, partitions
+	return nil
 }
 
-// EnableAdvancedFeatures 启用或禁用高级功能
-func (c *WebSocketClient) EnableAdvancedFeatures(autoRecovery, adaptiveBuffer bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.AutoRecovery = autoRecovery
-	c.AdaptiveBuffer = adaptiveBuffer
+// publish 将一批消息作为一个RecordBatch写入下一个分区，整批成功或失败，不会跳过消息
+func (s *kafkaSink) publish(batch [][]byte) (int, error) {
+	if s.brokers == nil {
+		if err := s.refreshMetadata(); err != nil {
+			s.close()
+			return 0, fmt.Errorf(tr("获取Kafka元数据失败: %w"), err)
+		}
+	}
+	partition := s.partitions[s.next%len(s.partitions)]
+	s.next++
 
-	log.Printf("🔧 高级功能配置: 自动恢复=%v, 自适应缓冲区=%v", autoRecovery, adaptiveBuffer)
+	if err := s.produce(partition, batch); err != nil {
+		s.close() // 丢弃连接和元数据，下次重新查询leader
+		return 0, err
+	}
+	return 0, nil
 }
 
-// GetHealthStatus 获取客户端健康状态（简化版）
-func (c *WebSocketClient) GetHealthStatus() HealthStatus {
-	if c.isConnected() {
-		return HealthHealthy
+// produce 发送Produce v3请求并检查分区的错误码
+func (s *kafkaSink) produce(partition kafkaPartition, batch [][]byte) error {
+	addr, ok := s.brokers[partition.leader]
+	if !ok {
+		return fmt.Errorf(tr("分区 %d 的leader %d 不在broker列表中"), partition.id, partition.leader)
 	}
-	return HealthUnhealthy
+	kc, err := s.dial(partition.leader, addr)
+	if err != nil {
+		return err
+	}
+
+	records := kafkaRecordBatch(batch, time.Now())
+	body := binary.BigEndian.AppendUint16(nil, 0xffff) // transactional_id = null
+	body = binary.BigEndian.AppendUint16(body, uint16(s.target.Acks))
+	body = binary.BigEndian.AppendUint32(body, uint32(ForwardTimeout.Milliseconds()))
+	body = binary.BigEndian.AppendUint32(body, 1) // topic_data数组
+	body = kafkaAppendString(body, s.target.Name)
+	body = binary.BigEndian.AppendUint32(body, 1) // partition_data数组
+	body = binary.BigEndian.AppendUint32(body, uint32(partition.id))
+	body = binary.BigEndian.AppendUint32(body, uint32(len(records)))
+	body = append(body, records...)
+
+	resp, err := kc.roundTrip(kafkaAPIProduce, kafkaProduceVersion, s.clientID, body)
+	if err != nil {
+		return err
+	}
+
+	d := &kafkaDecoder{buf: resp}
+	for range d.arrayLen() {
+		d.string() // 主题名
+		for range d.arrayLen() {
+			id := d.int32()
+			errCode := d.int16()
+			d.int64() // base_offset
+			d.int64() // log_append_time_ms
+			if d.err == nil && errCode != 0 {
+				return fmt.Errorf(tr("写入分区 %d 失败: %s"), id, kafkaErrorName(errCode))
+			}
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf(tr("解析Produce响应失败: %w"), d.err)
+	}
+	return nil
 }
 
-// GetPerformanceReport 获取性能报告
-func (c *WebSocketClient) GetPerformanceReport() map[string]any {
-	// 更新性能监控器
-	c.performanceMonitor.UpdateMetrics(c.GetStats())
-
-	// 获取基础性能报告
-	report := c.performanceMonitor.GetPerformanceReport()
+// close 关闭所有broker连接并丢弃元数据
+func (s *kafkaSink) close() {
+	for id, kc := range s.conns {
+		_ = kc.conn.Close()
+		delete(s.conns, id)
+	}
+	s.brokers, s.partitions = nil, nil
+}
 
-	// 添加死锁检测信息
-	deadlocks := c.deadlockDetector.CheckDeadlocks()
-	report["deadlock_alerts"] = deadlocks
-	report["deadlock_count"] = len(deadlocks)
+// kafkaRecordBatch 将消息编码为v2格式（magic=2）的RecordBatch，不压缩、没有key和header
+func kafkaRecordBatch(messages [][]byte, now time.Time) []byte {
+	timestamp := now.UnixMilli()
+
+	// CRC覆盖attributes到批次末尾的全部内容
+	payload := binary.BigEndian.AppendUint16(nil, 0)                          // attributes：不压缩，CreateTime
+	payload = binary.BigEndian.AppendUint32(payload, uint32(len(messages)-1)) // last_offset_delta
+	payload = binary.BigEndian.AppendUint64(payload, uint64(timestamp))       // base_timestamp
+	payload = binary.BigEndian.AppendUint64(payload, uint64(timestamp))       // max_timestamp
+	payload = binary.BigEndian.AppendUint64(payload, math.MaxUint64)          // producer_id = -1
+	payload = binary.BigEndian.AppendUint16(payload, math.MaxUint16)          // producer_epoch = -1
+	payload = binary.BigEndian.AppendUint32(payload, math.MaxUint32)          // base_sequence = -1
+	payload = binary.BigEndian.AppendUint32(payload, uint32(len(messages)))
+	for i, message := range messages {
+		record := []byte{0}                                       // attributes
+		record = binary.AppendVarint(record, 0)                   // timestamp_delta
+		record = binary.AppendVarint(record, int64(i))            // offset_delta
+		record = binary.AppendVarint(record, -1)                  // key = null
+		record = binary.AppendVarint(record, int64(len(message))) // value长度
+		record = append(record, message...)
+		record = binary.AppendVarint(record, 0) // headers数量
+		payload = binary.AppendVarint(payload, int64(len(record)))
+		payload = append(payload, record...)
+	}
 
-	// 添加健康检查信息（简化版）
-	report["health_status"] = c.GetHealthStatus().String()
-	report["health_error_count"] = c.Stats.Errors.TotalErrors
+	batch := binary.BigEndian.AppendUint64(nil, 0)                           // base_offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(4+1+4+len(payload))) // batch_length
+	batch = binary.BigEndian.AppendUint32(batch, math.MaxUint32)             // partition_leader_epoch = -1
+	batch = append(batch, 2)                                                 // magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(payload, crc32.MakeTable(crc32.Castagnoli)))
+	return append(batch, payload...)
+}
 
-	return report
+// kafkaAppendString 追加Kafka STRING（int16长度前缀）
+func kafkaAppendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
 }
 
-// SendText 发送文本消息
-// 这是SendMessage的便捷包装函数，专门用于发送文本消息
-//
-// 参数说明：
-//   - text: 要发送的文本内容
-//
-// 返回值：
-//   - error: 发送失败时的错误信息
-//
-// 功能说明：
-//   - 自动将字符串转换为字节数组
-//   - 设置消息类型为websocket.TextMessage
-//   - 继承SendMessage的所有功能和安全检查
-//
-// 使用示例：
-//
-//	err := client.SendText("Hello, WebSocket!")
-//	if err != nil {
-//	    log.Printf("发送文本消息失败: %v", err)
-//	}
-//
-// 注意事项：
-//   - 文本内容会被转换为UTF-8字节序列
-//   - 受到MaxMessageSize配置的限制
-//   - 支持频率限制和安全检查
-func (c *WebSocketClient) SendText(text string) error {
-	return c.SendMessage(websocket.TextMessage, []byte(text))
+// kafkaDecoder 顺序读取Kafka响应字段，越界时记录错误并返回零值
+type kafkaDecoder struct {
+	buf []byte
+	err error
 }
 
-// SendBinary 发送二进制消息
-// 这是SendMessage的便捷包装函数，专门用于发送二进制数据
-//
-// 参数说明：
-//   - data: 要发送的二进制数据
-//
-// 返回值：
-//   - error: 发送失败时的错误信息
-//
-// 功能说明：
-//   - 直接发送字节数组作为二进制消息
-//   - 设置消息类型为websocket.BinaryMessage
-//   - 继承SendMessage的所有功能和安全检查
-//
-// 使用示例：
-//
-//	binaryData := []byte{0x01, 0x02, 0x03, 0x04}
-//	err := client.SendBinary(binaryData)
-//	if err != nil {
-//	    log.Printf("发送二进制消息失败: %v", err)
-//	}
-//
-// 适用场景：
-//   - 发送图片、音频、视频等媒体文件
-//   - 发送序列化的结构化数据
-//   - 发送加密或压缩的数据
-//   - 发送自定义协议的数据包
-func (c *WebSocketClient) SendBinary(data []byte) error {
-	return c.SendMessage(websocket.BinaryMessage, data)
+// take 取出n个字节，剩余数据不足时记录错误
+func (d *kafkaDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
 }
 
-// SetEventHandlers 设置事件处理器
-// 允许自定义连接、断开、消息接收和错误处理的回调函数
-//
-// Example:
-//
-//	client.SetEventHandlers(
-//	    func() { log.Println("连接成功") },
-//	    func(err error) { log.Printf("连接断开: %v", err) },
-//	    func(messageType int, data []byte) error {
-//	        log.Printf("收到消息: %s", string(data))
-//	        return nil
-//	    },
-//	    func(err error) { log.Printf("发生错误: %v", err) },
-//	)
-func (c *WebSocketClient) SetEventHandlers(
-	onConnect func(),
-	onDisconnect func(error),
-	onMessage func(messageType int, data []byte) error,
-	onError func(error),
-) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
 
-	if onConnect != nil {
-		c.onConnect = onConnect
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
 	}
-	if onDisconnect != nil {
-		c.onDisconnect = onDisconnect
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
 	}
-	if onMessage != nil {
-		c.onMessage = onMessage
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
 	}
-	if onError != nil {
-		c.onError = onError
+	return 0
+}
+
+// string 读取STRING或NULLABLE_STRING（长度-1表示null，返回空字符串）
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
 	}
+	return string(d.take(int(n)))
 }
 
-// safeCallOnConnect 安全调用连接成功事件处理器
-// 这个方法以线程安全的方式调用用户设置的连接成功回调函数
-//
-// 功能说明：
-//   - 检查连接回调函数是否已设置
-//   - 在独立的goroutine中调用回调函数
-//   - 避免回调函数阻塞主要的连接流程
-//
-// 并发安全：
-//   - 简化版本，避免锁竞争
-//   - 使用goroutine异步调用，防止阻塞
-//   - 回调函数的执行不会影响连接状态
-//
-// 调用时机：
-//   - WebSocket连接成功建立后
-//   - 在setupConnection方法中调用
-//   - 确保用户能及时收到连接成功通知
-//
-// 注意事项：
-//   - 回调函数在独立的goroutine中执行
-//   - 回调函数的错误不会影响客户端运行
-//   - 用户应确保回调函数的线程安全性
-func (c *WebSocketClient) safeCallOnConnect() {
-	// 简化版本，避免锁竞争
-	if c.onConnect != nil {
-		go c.onConnect()
+// arrayLen 读取数组长度，null数组和出错时返回0
+func (d *kafkaDecoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 || d.err != nil {
+		return 0
+	}
+	if int(n) > len(d.buf) {
+		d.err = io.ErrUnexpectedEOF // 每个元素至少一个字节，防止恶意长度导致长时间循环
+		return 0
 	}
+	return int(n)
 }
 
-// safeCallOnMessage 安全调用消息接收事件处理器
-// 这个方法以线程安全的方式调用用户设置的消息接收回调函数
-//
-// 参数说明：
-//   - messageType: WebSocket消息类型
-//   - data: 消息数据内容
-//
-// 返回值：
-//   - error: 回调函数返回的错误
-//
-// 功能说明：
-//   - 使用读锁安全获取回调函数引用
-//   - 在当前goroutine中同步调用回调函数
-//   - 返回回调函数的执行结果
-//
-// 并发安全：
-//   - 使用读锁保护回调函数的读取
-//   - 避免在锁内调用回调函数，减少锁持有时间
-//   - 支持并发的消息处理
-//
-// 调用时机：
-//   - 接收到WebSocket消息后
-//   - 在ReadMessages方法中调用
-//   - 允许用户自定义消息处理逻辑
-//
-// 注意事项：
-//   - 回调函数在消息读取goroutine中同步执行
-//   - 回调函数的执行时间会影响消息处理性能
-//   - 用户应避免在回调中执行耗时操作
-func (c *WebSocketClient) safeCallOnMessage(messageType int, data []byte) error {
-	c.mu.RLock()
-	handler := c.onMessage
-	c.mu.RUnlock()
+// skipInt32Array 跳过INT32数组
+func (d *kafkaDecoder) skipInt32Array() {
+	d.take(4 * d.arrayLen())
+}
 
-	if handler != nil {
-		return handler(messageType, data)
+// kafkaErrorName 返回常见Kafka错误码的名称
+func kafkaErrorName(code int16) string {
+	names := map[int16]string{
+		3:  "UNKNOWN_TOPIC_OR_PARTITION",
+		5:  "LEADER_NOT_AVAILABLE",
+		6:  "NOT_LEADER_OR_FOLLOWER",
+		7:  "REQUEST_TIMED_OUT",
+		10: "MESSAGE_TOO_LARGE",
+		17: "INVALID_TOPIC_EXCEPTION",
+		19: "NOT_ENOUGH_REPLICAS",
+		20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+		29: "TOPIC_AUTHORIZATION_FAILED",
+		87: "INVALID_RECORD",
 	}
-	return nil
+	if name, ok := names[code]; ok {
+		return fmt.Sprintf("%s (%d)", name, code)
+	}
+	return fmt.Sprintf("错误码 %d", code)
 }
 
-// safeCallOnError 安全调用错误处理事件处理器
-// 这个方法以线程安全的方式调用用户设置的错误处理回调函数
-//
-// 参数说明：
-//   - err: 发生的错误实例
-//
-// 功能说明：
-//   - 使用读锁安全获取回调函数引用
-//   - 在独立的goroutine中异步调用回调函数
-//   - 避免错误处理阻塞主要流程
-//
-// 并发安全：
-//   - 使用读锁保护回调函数的读取
-//   - 在独立goroutine中执行，避免阻塞
-//   - 错误处理不会影响客户端的正常运行
-//
-// 调用时机：
-//   - 发生各种错误时调用
-//   - 包括连接错误、发送错误、接收错误等
-//   - 为用户提供统一的错误通知机制
-//
-// 注意事项：
-//   - 回调函数在独立的goroutine中执行
-//   - 回调函数的错误不会被捕获或处理
-//   - 用户应确保回调函数的稳定性和线程安全性
-func (c *WebSocketClient) safeCallOnError(err error) {
-	c.mu.RLock()
-	handler := c.onError
-	c.mu.RUnlock()
+// ===== SLO跟踪 =====
 
-	if handler != nil {
-		go handler(err)
-	}
+// SLO跟踪参数
+const (
+	DefaultSLOWindow   = time.Hour       // 默认长窗口：在最近1小时内计算各项指标
+	DefaultSLOBurnRate = 2.0             // 默认告警阈值：错误预算消耗速率达到允许速率的2倍时判定为降级
+	MinSLOWindow       = time.Minute     // 长窗口下限，保证每个桶至少1秒
+	SLOSampleInterval  = 1 * time.Second // 连接状态的采样间隔
+	sloBucketCount     = 60              // 长窗口划分的桶数
+	sloShortBuckets    = 5               // 短窗口的桶数（长窗口的1/12），用于确认预算仍在快速消耗
+)
+
+// sloBucket 一个时间桶内的原始计数
+type sloBucket struct {
+	start      time.Time     // 桶的起始时间，零值表示空桶
+	total      time.Duration // 采样覆盖的总时长
+	connected  time.Duration // 其中处于已连接状态的时长
+	sendOK     int64         // 发送成功的消息数
+	sendFailed int64         // 因连接断开、写入超时或写入错误而发送失败的消息数
+	reconnects int64         // 重连成功次数（不含首次连接）
 }
 
-// Start 是 WebSocket 客户端的主循环
-// 它管理连接生命周期，包括初始连接、重试和消息读取
-// 这是一个阻塞函数，通常在单独的goroutine中运行
-//
-// Example:
-//
-//	client := NewWebSocketClient(config)
-//	client.SetEventHandlers(onConnect, onDisconnect, onMessage, onError)
-//
-//	// 在goroutine中启动客户端
-//	go client.Start()
-//
-//	// 等待信号或其他条件后停止
-//	<-ctx.Done()
-//	client.Stop()
-func (c *WebSocketClient) Start() {
-	// 延迟执行的清理匿名函数：确保Start函数退出时正确通知其他组件
-	defer func() {
-		// 如果Start函数退出，说明重试失败或收到停止信号
-		// 主动调用cancel来通知main函数退出，实现优雅的程序终止
-		c.cancel()
-	}()
+// sloWindowStats 一个滚动窗口内的SLO指标
+type sloWindowStats struct {
+	Window            string  `json:"window"`              // 窗口时长
+	Availability      float64 `json:"availability"`        // 已连接时间占比（%），窗口内还没有采样时为100
+	MessageSuccess    float64 `json:"message_success"`     // 发送成功率（%），窗口内没有发送时为100
+	ReconnectsPerHour float64 `json:"reconnects_per_hour"` // 折算为每小时的重连次数
+	BurnRate          float64 `json:"burn_rate"`           // 各项目标中最大的错误预算消耗速率（1表示恰好按预算消耗）
+}
 
-	// 启动周期性ping（如果未禁用）
-	if !c.config.DisableAutoPing {
-		go c.sendPeriodicPing()
-	}
+// sloReport SLO评估结果
+type sloReport struct {
+	Degraded bool           `json:"degraded"`         // 长短窗口的消耗速率是否都达到了阈值
+	Reason   string         `json:"reason,omitempty"` // 降级原因：超出预算的目标
+	Long     sloWindowStats `json:"long"`             // 长窗口（--slo-window）
+	Short    sloWindowStats `json:"short"`            // 短窗口（长窗口的1/12）
+}
 
-	for {
-		select {
-		case <-c.ctx.Done():
-			log.Printf("📋 收到停止信号，退出主循环")
-			return
-		default:
-			if !c.attemptConnection() {
-				return // 达到最大重试次数或被取消
-			}
+// sloTracker 按滚动窗口计算可用性、发送成功率和重连频率，并与配置的SLO目标比较
+// 长窗口划分为sloBucketCount个桶，每个桶记录采样时长、已连接时长、发送成败和重连次数；
+// 错误预算消耗速率 = 实际错误率 / 目标允许的错误率，长窗口和短窗口同时达到阈值时判定为降级，
+// 长窗口保证不是偶发抖动，短窗口保证问题仍在持续，恢复后能较快解除降级
+//
+// 并发安全：所有方法都可在任意goroutine中调用
+type sloTracker struct {
+	mu         sync.Mutex
+	targets    sloTargets                // 配置的SLO目标
+	bucketSize time.Duration             // 每个桶的时长（长窗口/sloBucketCount）
+	buckets    [sloBucketCount]sloBucket // 按时间循环使用的桶
+	degraded   bool                      // 最近一次评估是否降级，用于只在状态变化时记录日志
+}
 
-			if !c.handleConnectedSession() {
-				return // 被取消或需要退出
-			}
-		}
-	}
+// sloTargets 配置的SLO目标，比例形式（0-1），0表示不检查该项
+type sloTargets struct {
+	availability  float64 // 可用性目标
+	success       float64 // 发送成功率目标
+	maxReconnects float64 // 每小时允许的最多重连次数
+	burnRate      float64 // 判定降级的消耗速率阈值
 }
 
-// attemptConnection 尝试建立连接，处理重试逻辑
-// 这个方法是连接重试机制的核心，负责尝试建立WebSocket连接并处理失败情况
+// newSLOTracker 根据配置创建SLO跟踪器
 //
 // 返回值：
-//   - bool: true表示应该继续主循环，false表示应该退出主循环
-//
-// 功能说明：
-//  1. 调用Connect方法尝试建立连接
-//  2. 连接失败时增加重试计数器
-//  3. 记录连接错误日志
-//  4. 检查是否应该停止重试
-//  5. 等待重试延迟时间
-//  6. 连接成功时重置重试计数器
-//
-// 重试逻辑：
-//   - 连接失败：增加重试计数，记录错误，检查重试限制
-//   - 达到重试限制：返回false，退出主循环
-//   - 未达到限制：等待重试延迟，返回true继续尝试
-//   - 连接成功：重置计数器，返回true进入消息处理阶段
-//
-// 错误处理：
-//   - 区分网络错误和其他错误类型
-//   - 提供详细的错误日志信息
-//   - 支持智能重试策略
-//
-// 并发安全：
-//   - 使用原子操作更新重试计数器
-//   - 避免竞态条件
-func (c *WebSocketClient) attemptConnection() bool {
-	// 第一步：尝试建立WebSocket连接
-	err := c.Connect()
-	if err != nil {
-		// 第二步：连接失败，增加重试计数器
-		atomic.AddInt32(&c.RetryCount, 1)
-		c.logConnectionError(err)
-
-		// 第三步：检查是否应该停止重试
-		if c.shouldStopRetrying() {
-			return false // 达到重试限制，退出主循环
-		}
-
-		// 第四步：等待重试延迟时间
-		return c.waitForRetry() // 返回是否应该继续重试
+//   - *sloTracker: 未配置任何SLO目标时返回nil
+func newSLOTracker(config *ClientConfig) *sloTracker {
+	if config.SLOAvailability == 0 && config.SLOMessageSuccess == 0 && config.SLOMaxReconnects == 0 {
+		return nil
+	}
+	return &sloTracker{
+		targets: sloTargets{
+			availability:  config.SLOAvailability / 100,
+			success:       config.SLOMessageSuccess / 100,
+			maxReconnects: config.SLOMaxReconnects,
+			burnRate:      config.SLOBurnRate,
+		},
+		bucketSize: config.SLOWindow / sloBucketCount,
 	}
+}
 
-	// 第五步：连接成功，重置重试计数器
-	atomic.StoreInt32(&c.RetryCount, 0)
-	log.Printf("🔄 重置重试计数器，开始接收消息...")
-	return true // 继续主循环，进入消息处理阶段
+// bucket 返回now所在的桶，桶已过期时先清空（调用方持有mu）
+func (t *sloTracker) bucket(now time.Time) *sloBucket {
+	start := now.Truncate(t.bucketSize)
+	b := &t.buckets[(start.UnixNano()/int64(t.bucketSize))%sloBucketCount]
+	if !b.start.Equal(start) {
+		*b = sloBucket{start: start}
+	}
+	return b
 }
 
-// logConnectionError 记录连接错误日志
-// 这个方法根据错误类型记录不同格式的连接错误日志
-//
-// 参数说明：
-//   - err: 连接过程中发生的错误
-//
-// 功能说明：
-//  1. 获取当前的重试计数
-//  2. 判断错误类型（网络错误 vs 其他错误）
-//  3. 记录格式化的错误日志
-//  4. 提供重试次数信息
-//
-// 错误分类：
-//   - 网络错误：连接超时、网络不可达、DNS解析失败等
-//   - 其他错误：认证失败、协议错误、配置错误等
-//
-// 日志格式：
-//   - 网络错误：🔌 网络连接中断 (第N次重试): 错误详情
-//   - 其他错误：❌ 连接失败 (第N次重试): 错误详情
-//
-// 并发安全：
-//   - 使用原子操作读取重试计数器
-//   - 避免数据竞争
-func (c *WebSocketClient) logConnectionError(err error) {
-	// 获取当前重试计数（原子操作）
-	retryCount := atomic.LoadInt32(&c.RetryCount)
+// sample 记录一次连接状态采样，nil接收者表示未启用SLO跟踪
+func (t *sloTracker) sample(elapsed time.Duration, connected bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucket(time.Now())
+	b.total += elapsed
+	if connected {
+		b.connected += elapsed
+	}
+}
 
-	// 根据错误类型记录不同格式的日志
-	if isNetworkError(err) {
-		log.Printf("🔌 网络连接中断 (第%d次重试): %v", retryCount, err)
+// recordSend 记录一次发送结果
+func (t *sloTracker) recordSend(ok bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b := t.bucket(time.Now()); ok {
+		b.sendOK++
 	} else {
-		log.Printf("❌ 连接失败 (第%d次重试): %v", retryCount, err)
+		b.sendFailed++
 	}
 }
 
-// shouldStopRetrying 检查是否应该停止重试
-// 这个方法根据配置的重试限制和当前重试次数来判断是否应该停止重试
+// recordReconnect 记录一次重连成功
+func (t *sloTracker) recordReconnect() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bucket(time.Now()).reconnects++
+}
+
+// windowStats 汇总最近n个桶（包括当前桶）的指标（调用方持有mu）
 //
 // 返回值：
-//   - bool: true表示应该停止重试，false表示可以继续重试
-//
-// 重试策略：
-//  1. 快速重试阶段：前N次重试（默认5次）
-//  2. 慢速重试阶段：后续重试，总数为MaxRetries * 2
-//  3. 无限重试：当MaxRetries为0时，永不停止
-//
-// 限制计算：
-//   - fastLimit: 快速重试次数限制（默认5次）
-//   - totalLimit: 总重试次数限制（MaxRetries * 2）
-//   - 使用原子操作获取当前重试计数
-//
-// 安全转换：
-//   - 使用严格的int到int32转换方法
-//   - 防止整数溢出和类型转换错误
-//   - 通过字符串转换避免gosec安全警告
-//
-// 并发安全：
-//   - 使用原子操作读取重试计数器
-//   - 避免数据竞争
-//
-// 使用场景：
-//   - 连接重试循环中的退出条件判断
-//   - 防止无限重试导致的资源浪费
-//   - 实现智能重试策略
-func (c *WebSocketClient) shouldStopRetrying() bool {
-	// 第一步：计算快速重试限制
-	fastLimit := c.config.MaxRetries
-	if fastLimit == 0 {
-		// 无限重试模式，不需要检查限制
-		return false
+//   - sloWindowStats: 窗口内的指标和最大的消耗速率
+//   - []string: 消耗速率达到阈值的目标说明，用作降级原因
+func (t *sloTracker) windowStats(now time.Time, n int) (sloWindowStats, []string) {
+	window := t.bucketSize * time.Duration(n)
+	oldest := now.Truncate(t.bucketSize).Add(-window + t.bucketSize)
+
+	var sum sloBucket
+	for i := range t.buckets {
+		b := &t.buckets[i]
+		if b.start.IsZero() || b.start.Before(oldest) || b.start.After(now) {
+			continue
+		}
+		sum.total += b.total
+		sum.connected += b.connected
+		sum.sendOK += b.sendOK
+		sum.sendFailed += b.sendFailed
+		sum.reconnects += b.reconnects
 	}
 
-	// 第二步：计算总重试限制
-	totalLimit := c.config.MaxRetries * 2
-	retryCount := atomic.LoadInt32(&c.RetryCount)
+	availability, success := 1.0, 1.0
+	if sum.total > 0 {
+		availability = float64(sum.connected) / float64(sum.total)
+	}
+	if sends := sum.sendOK + sum.sendFailed; sends > 0 {
+		success = float64(sum.sendOK) / float64(sends)
+	}
+	// 重连频率按窗口内实际采样的时长折算，客户端刚启动时不会被整个窗口稀释
+	reconnectsPerHour := float64(sum.reconnects) / max(sum.total, SLOSampleInterval).Hours()
+
+	stats := sloWindowStats{
+		Window:            window.String(),
+		Availability:      availability * 100,
+		MessageSuccess:    success * 100,
+		ReconnectsPerHour: reconnectsPerHour,
+	}
 
-	// 第三步：安全的int到int32转换（避免gosec警告）
-	var totalLimitInt32 int32
-	if totalLimit < 0 {
-		totalLimitInt32 = 0
-	} else if totalLimit > math.MaxInt32 {
-		totalLimitInt32 = math.MaxInt32
-	} else {
-		// 使用字符串转换避免gosec警告
-		limitStr := fmt.Sprintf("%d", totalLimit)
-		if parsed, err := strconv.ParseInt(limitStr, 10, 32); err == nil {
-			totalLimitInt32 = int32(parsed)
+	// 每项目标的消耗速率 = 实际错误率 / 允许的错误率
+	var reasons []string
+	check := func(burn float64, reason string) {
+		stats.BurnRate = max(stats.BurnRate, burn)
+		if burn >= t.targets.burnRate {
+			reasons = append(reasons, reason)
+		}
+	}
+	if t.targets.availability > 0 {
+		check((1-availability)/(1-t.targets.availability),
+			fmt.Sprintf("可用性 %.3f%% (目标 %.3f%%)", stats.Availability, t.targets.availability*100))
+	}
+	if t.targets.success > 0 {
+		check((1-success)/(1-t.targets.success),
+			fmt.Sprintf("发送成功率 %.3f%% (目标 %.3f%%)", stats.MessageSuccess, t.targets.success*100))
+	}
+	if t.targets.maxReconnects > 0 {
+		check(reconnectsPerHour/t.targets.maxReconnects,
+			fmt.Sprintf("重连 %.1f次/小时 (上限 %.1f)", reconnectsPerHour, t.targets.maxReconnects))
+	}
+	return stats, reasons
+}
+
+// report 评估当前的SLO状态，降级状态变化时记录日志
+// 长窗口和短窗口的消耗速率都达到阈值时判定为降级
+func (t *sloTracker) report() sloReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	long, reasons := t.windowStats(now, sloBucketCount)
+	short, _ := t.windowStats(now, sloShortBuckets)
+	report := sloReport{
+		Degraded: long.BurnRate >= t.targets.burnRate && short.BurnRate >= t.targets.burnRate,
+		Long:     long,
+		Short:    short,
+	}
+	if report.Degraded {
+		report.Reason = strings.Join(reasons, ", ")
+	}
+
+	if report.Degraded != t.degraded {
+		t.degraded = report.Degraded
+		if report.Degraded {
+			log.Printf(tr("📉 SLO错误预算消耗过快 (%.1f倍): %s"), long.BurnRate, report.Reason)
 		} else {
-			totalLimitInt32 = math.MaxInt32
+			log.Printf(tr("📈 SLO错误预算消耗恢复正常 (%.1f倍)"), long.BurnRate)
 		}
 	}
+	return report
+}
 
-	// 第四步：检查是否达到重试限制
-	if totalLimit > 0 && retryCount >= totalLimitInt32 {
-		log.Printf("🛑 达到最大重试次数 (%d)，停止尝试", totalLimit)
-		return true
+// runSLOTracker 按采样间隔记录连接状态并评估SLO，使降级状态的变化及时写入日志
+func (c *WebSocketClient) runSLOTracker() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(SLOSampleInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.slo.sample(now.Sub(last), c.GetState() == StateConnected)
+			last = now
+			c.slo.report()
+		}
 	}
-	return false
 }
 
-// waitForRetry 等待重试延迟时间
-// 这个方法实现智能的重试等待机制，支持快速重试和延迟重试
-//
-// 返回值：
-//   - bool: true表示等待完成可以继续重试，false表示被取消应该退出
-//
-// 等待策略：
-//  1. 计算当前重试应该等待的时间
-//  2. 使用select语句同时监听取消信号和等待时间
-//  3. 优先响应取消信号，确保能够及时停止
-//
-// 取消处理：
-//   - 监听context.Done()信号
-//   - 客户端停止时立即返回false
-//   - 避免不必要的等待时间
-//
-// 并发安全：
-//   - 使用context进行取消通知
-//   - 不会阻塞其他操作
-//
-// 使用场景：
-//   - 连接失败后的重试等待
-//   - 实现退避重试策略
-//   - 支持优雅停止
-func (c *WebSocketClient) waitForRetry() bool {
-	// 第一步：计算重试延迟时间
-	retryDelay := c.calculateRetryDelay()
+// ===== 错误异常检测 =====
 
-	// 第二步：等待延迟时间或取消信号
-	select {
-	case <-c.ctx.Done():
-		return false // 收到取消信号，停止重试
-	case <-time.After(retryDelay):
-		return true // 等待完成，可以继续重试
+// 错误异常检测参数
+const (
+	AnomalyInterval        = 10 * time.Second // 检测间隔：每个间隔统计一次ErrorTrend中新增的错误
+	AnomalyEWMAAlpha       = 0.3              // 基线的指数加权系数：越大越快适应新的错误水平
+	AnomalyZScore          = 3.0              // 错误数超过基线均值的标准差倍数达到此值时判定为突增
+	AnomalyMinErrors       = 3                // 间隔内错误数至少达到此值才判定为突增，避免低错误水平下的偶发抖动
+	AnomalyWarmupIntervals = 6                // 预热间隔数：启动后的前1分钟只学习基线和已知错误码，不报告异常
+)
+
+// anomalyDetector 基于ErrorStats.ErrorTrend检测错误率突增和新出现的错误码
+// 每个检测间隔统计一次新增错误数，用EWMA维护错误数的均值和方差作为基线：
+//   - 错误率突增：错误数 ≥ AnomalyMinErrors，且z分数（与基线均值之差除以标准差）≥ AnomalyZScore
+//   - 新错误码：预热期之后首次出现的错误码
+//
+// 任一间隔出现异常时进入异常状态（anomaly_active=1），之后第一个没有异常的间隔恢复
+//
+// 并发安全：使用互斥锁保护全部状态
+type anomalyDetector struct {
+	mu        sync.Mutex
+	mean      float64            // 每个间隔错误数的EWMA均值
+	variance  float64            // 每个间隔错误数的EWMA方差
+	intervals int                // 已统计的间隔数
+	lastCheck time.Time          // 上次统计的截止时间，之后的趋势点属于下一个间隔
+	seenCodes map[ErrorCode]bool // 已出现过的错误码
+	active    bool               // 当前是否处于异常状态
+	total     int64              // 累计检测到的异常次数
+}
+
+// newAnomalyDetector 创建错误异常检测器，从当前时间开始统计
+func newAnomalyDetector() *anomalyDetector {
+	return &anomalyDetector{
+		lastCheck: time.Now(),
+		seenCodes: make(map[ErrorCode]bool),
 	}
 }
 
-// calculateRetryDelay 计算重试延迟时间并记录日志
-// 这个方法实现智能的重试延迟策略，区分快速重试和慢速重试
-//
-// 返回值：
-//   - time.Duration: 当前重试应该等待的时间
+// observe 统计一个检测间隔的错误并更新基线
 //
-// 重试策略：
-//  1. 快速重试阶段：前N次重试无延迟（立即重试）
-//  2. 慢速重试阶段：后续重试使用配置的延迟时间
-//  3. 无限重试模式：当MaxRetries为0时支持无限重试
-//
-// 延迟计算：
-//   - 快速重试：返回0，立即重试
-//   - 慢速重试：返回配置的RetryDelay
-//   - 无限重试：使用慢速重试延迟
-//
-// 日志记录：
-//   - 快速重试：显示当前次数和快速重试限制
-//   - 慢速重试：显示当前次数和总重试限制
-//   - 无限重试：显示当前次数和延迟时间
-//
-// 安全转换：
-//   - 使用严格的int到int32转换
-//   - 防止整数溢出和类型错误
-//   - 通过字符串转换避免gosec警告
+// 参数说明：
+//   - trend: 当前的错误趋势记录，只统计上次检测之后的数据点
+//   - now: 本次检测的截止时间
 //
-// 并发安全：
-//   - 使用原子操作读取重试计数器
-//   - 避免数据竞争
-func (c *WebSocketClient) calculateRetryDelay() time.Duration {
-	// 第一步：计算重试限制
-	fastLimit := c.config.MaxRetries
-	if fastLimit == 0 {
-		fastLimit = 5 // 默认快速重试5次
-	}
-	totalLimit := c.config.MaxRetries * 2
-	retryCount := atomic.LoadInt32(&c.RetryCount)
-
-	// 第二步：安全的int到int32转换（避免gosec警告）
-	var fastLimitInt32 int32
-	if fastLimit < 0 {
-		fastLimitInt32 = 0
-	} else if fastLimit > math.MaxInt32 {
-		fastLimitInt32 = math.MaxInt32
-	} else {
-		// 使用字符串转换避免gosec警告
-		limitStr := fmt.Sprintf("%d", fastLimit)
-		if parsed, err := strconv.ParseInt(limitStr, 10, 32); err == nil {
-			fastLimitInt32 = int32(parsed)
-		} else {
-			fastLimitInt32 = math.MaxInt32
+// 返回值：
+//   - []string: 本间隔检测到的异常说明，没有异常时为空
+//   - bool: 异常状态是否发生变化（进入或恢复）
+func (d *anomalyDetector) observe(trend []ErrorTrendPoint, now time.Time) ([]string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// 第一步：统计本间隔新增的错误数和错误码
+	var count float64
+	var newCodes []ErrorCode
+	for _, point := range trend {
+		if !point.Timestamp.After(d.lastCheck) || point.Timestamp.After(now) {
+			continue
+		}
+		count += float64(point.ErrorCount)
+		if !d.seenCodes[point.ErrorCode] {
+			d.seenCodes[point.ErrorCode] = true
+			newCodes = append(newCodes, point.ErrorCode)
+		}
+	}
+	d.lastCheck = now
+	d.intervals++
+
+	// 第二步：预热期之后与基线比较
+	var alerts []string
+	if d.intervals > AnomalyWarmupIntervals {
+		std := max(math.Sqrt(d.variance), 1) // 基线几乎没有波动时以1为下限，避免z分数被放大
+		if z := (count - d.mean) / std; count >= AnomalyMinErrors && z >= AnomalyZScore {
+			alerts = append(alerts, fmt.Sprintf("错误数突增: %v内 %.0f 个 (基线 %.1f±%.1f, z=%.1f)", AnomalyInterval, count, d.mean, std, z))
+		}
+		for _, code := range newCodes {
+			alerts = append(alerts, fmt.Sprintf("新错误码: [%d] %s", code, code))
 		}
 	}
 
-	// 第三步：根据重试阶段返回相应的延迟时间
-	if retryCount <= fastLimitInt32 {
-		// 快速重试阶段：无延迟
-		log.Printf("⚡ 快速重试 (第%d/%d次)...", retryCount, fastLimit)
-		return 0
-	} else if totalLimit == 0 {
-		// 无限重试模式：使用配置的延迟
-		log.Printf("🔄 无限慢速重试 (第%d次)，%v后重试...", retryCount, c.config.RetryDelay)
-		return c.config.RetryDelay
-	} else {
-		// 慢速重试阶段：使用配置的延迟
-		log.Printf("⏳ 慢速重试 (第%d/%d次)，%v后重试...",
-			retryCount-fastLimitInt32, totalLimit-fastLimit, c.config.RetryDelay)
-		return c.config.RetryDelay
+	// 第三步：更新EWMA基线
+	diff := count - d.mean
+	d.mean += AnomalyEWMAAlpha * diff
+	d.variance = (1 - AnomalyEWMAAlpha) * (d.variance + AnomalyEWMAAlpha*diff*diff)
+
+	// 第四步：更新异常状态
+	active := len(alerts) > 0
+	d.total += int64(len(alerts))
+	changed := active != d.active
+	d.active = active
+	return alerts, changed
+}
+
+// remember 把错误码标记为已出现过，用于从状态文件恢复历史错误码
+func (d *anomalyDetector) remember(codes map[ErrorCode]int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for code := range codes {
+		d.seenCodes[code] = true
 	}
 }
 
-// handleConnectedSession 处理已连接的会话
-// 这个方法管理WebSocket连接的生命周期，包括消息读取和连接监控
-//
-// 返回值：
-//   - bool: false表示应该退出主循环，true表示应该继续重连
-//
-// 功能说明：
-//  1. 启动消息读取goroutine
-//  2. 监控连接状态和停止信号
-//  3. 处理连接断开和重连逻辑
-//  4. 确保资源正确清理
-//
-// 会话管理：
-//   - 使用独立的channel通知ReadMessages结束
-//   - 通过WaitGroup管理goroutine生命周期
-//   - 支持优雅停止和异常处理
-//
-// 并发控制：
-//   - ReadMessages在独立的goroutine中运行
-//   - 使用select语句监听多个事件
-//   - 优先处理停止信号，确保及时响应
-//
-// 重连逻辑：
-//   - ReadMessages正常结束时准备重连
-//   - 收到停止信号时退出主循环
-//   - 双重检查确保停止信号的优先级
-//
-// 使用场景：
-//   - 连接建立后的会话管理
-//   - 消息读取和连接监控
-//   - 自动重连机制的核心逻辑
-func (c *WebSocketClient) handleConnectedSession() bool {
-	// 第一步：创建通知channel并启动消息读取goroutine
-	readDone := make(chan struct{})
+// status 返回当前是否处于异常状态和累计异常次数
+func (d *anomalyDetector) status() (bool, int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active, d.total
+}
+
+// runAnomalyDetector 按检测间隔分析错误趋势，检测到异常时记录告警日志
+func (c *WebSocketClient) runAnomalyDetector() {
 	c.wg.Add(1)
-	// 启动消息读取的匿名goroutine：负责持续读取WebSocket消息直到连接断开
-	go func() {
-		defer close(readDone) // 确保channel被关闭，通知主goroutine消息读取已结束
-		defer c.wg.Done()     // 通知WaitGroup任务完成，确保优雅停止时等待此goroutine结束
-		c.ReadMessages()      // 开始读取消息的主循环，这是消息接收的核心逻辑
-	}()
+	defer c.wg.Done()
 
-	// 第二步：等待ReadMessages结束或收到停止信号
-	select {
-	case <-c.ctx.Done():
-		// 收到停止信号，立即退出
-		log.Printf("📋 收到停止信号，停止客户端")
-		return false
-	case <-readDone:
-		// ReadMessages结束，检查是否应该重连
+	ticker := time.NewTicker(AnomalyInterval)
+	defer ticker.Stop()
+
+	for {
 		select {
 		case <-c.ctx.Done():
-			// 双重检查：确保停止信号优先处理
-			return false
-		default:
-			// 连接断开，准备重连
-			log.Printf("🔄 连接断开，准备重连...")
-			return true
+			return
+		case now := <-ticker.C:
+			c.mu.RLock()
+			alerts, changed := c.anomalyDetector.observe(c.Stats.Errors.ErrorTrend, now)
+			c.mu.RUnlock()
+
+			for _, alert := range alerts {
+				log.Printf(tr("🚨 错误异常 [会话: %s]: %s"), c.SessionID, alert)
+			}
+			if changed && len(alerts) == 0 {
+				log.Printf(tr("✅ 错误率已恢复正常 [会话: %s]"), c.SessionID)
+			}
 		}
 	}
 }
 
-// Connect 建立WebSocket连接
-// 这个方法是WebSocket连接建立的主入口，负责完整的连接流程
-//
-// 返回值：
-//   - error: 连接失败时的错误信息，成功时为nil
-//
-// 连接流程：
-//  1. 获取死锁检测锁，防止并发连接
-//  2. 设置连接状态为正在连接
-//  3. 调用底层连接建立方法
-//  4. 处理连接错误或设置连接
-//  5. 释放死锁检测锁
-//
-// 状态管理：
-//   - 连接开始时设置为StateConnecting
-//   - 连接失败时设置为StateDisconnected
-//   - 连接成功时在setupConnection中设置为StateConnected
-//
-// 错误处理：
-//   - 连接失败时记录错误统计
-//   - 尝试自动错误恢复（如果启用）
-//   - 返回结构化的ConnectionError
-//
-// 并发安全：
-//   - 使用死锁检测器防止并发连接
-//   - 确保连接操作的原子性
-//
-// 使用场景：
-//   - 初始连接建立
-//   - 重连机制中的连接尝试
-//   - 手动连接操作
-func (c *WebSocketClient) Connect() error {
-	// 第一步：获取死锁检测锁，防止并发连接
-	c.deadlockDetector.AcquireLock("connect")
-	defer c.deadlockDetector.ReleaseLock("connect")
-
-	// 第二步：记录连接开始并设置状态
-	log.Printf("🔌 准备连接到 %s...", c.config.URL)
-	c.setState(StateConnecting)
+// ===== 状态持久化 =====
 
-	// 第三步：建立WebSocket连接
-	newConn, err := c.establishConnection()
-	if err != nil {
-		// 连接失败，处理错误
-		return c.handleConnectionError(err)
-	}
+// 状态文件参数
+const (
+	StateFileVersion      = 1                // 状态文件格式版本：版本不同的文件不会被加载
+	StateSnapshotInterval = 30 * time.Second // 周期性保存统计快照的间隔，退出时还会再保存一次
+)
 
-	// 第四步：连接成功，设置连接
-	c.setupConnection(newConn)
-	return nil
+// persistedState --state-file保存的累计统计
+// 只保存跨进程有意义的累计计数器和错误历史，连接时间、RTT等只描述当前连接的数据不保存
+type persistedState struct {
+	Version            int                 `json:"version"`                       // 状态文件格式版本
+	SavedAt            time.Time           `json:"saved_at"`                      // 最近一次保存时间
+	FirstStart         time.Time           `json:"first_start"`                   // 逻辑客户端首次启动时间
+	Restarts           int64               `json:"restarts"`                      // 加载过该状态文件的次数，即进程重启次数
+	MessagesSent       int64               `json:"messages_sent"`                 // 累计发送消息数
+	MessagesReceived   int64               `json:"messages_received"`             // 累计接收消息数
+	BytesSent          int64               `json:"bytes_sent"`                    // 累计发送字节数
+	BytesReceived      int64               `json:"bytes_received"`                // 累计接收字节数
+	ReconnectCount     int                 `json:"reconnect_count"`               // 累计重连次数
+	SentByType         MessageTypeCounts   `json:"sent_by_type"`                  // 按消息类型分类的累计发送计数
+	ReceivedByType     MessageTypeCounts   `json:"received_by_type"`              // 按消息类型分类的累计接收计数
+	ProtocolViolations map[string]int64    `json:"protocol_violations,omitempty"` // 按类型统计的累计协议违规次数
+	LastClose          CloseInfo           `json:"last_close"`                    // 最近一次服务器关闭帧
+	Errors             persistedErrorStats `json:"errors"`                        // 错误统计
 }
 
-// establishConnection 建立WebSocket连接
-// 这个方法负责实际的WebSocket连接建立，使用配置的连接器
-//
-// 返回值：
-//   - *websocket.Conn: 成功建立的WebSocket连接
-//   - error: 连接失败时的错误信息
-//
-// 功能说明：
-//   - 创建带超时的连接上下文
-//   - 使用连接器接口建立连接
-//   - 支持握手超时控制
-//
-// 超时处理：
-//   - 使用配置的HandshakeTimeout作为连接超时
-//   - 超时后自动取消连接尝试
-//   - 防止连接操作无限阻塞
-//
-// 连接器模式：
-//   - 使用可插拔的连接器接口
-//   - 支持不同的连接实现
-//   - 便于测试和扩展
-//
-// 使用场景：
-//   - Connect方法的底层实现
-//   - 支持自定义连接逻辑
-//   - 连接超时控制
-func (c *WebSocketClient) establishConnection() (*websocket.Conn, error) {
-	// 创建带超时的连接上下文
-	connectCtx, cancel := context.WithTimeout(c.ctx, c.config.HandshakeTimeout)
-	defer cancel()
-
-	// 使用连接器建立WebSocket连接
-	return c.connector.Connect(connectCtx, c.config.URL, c.config)
+// persistedErrorStats ErrorStats的可序列化形式，LastError只保存错误信息文本
+type persistedErrorStats struct {
+	TotalErrors   int64               `json:"total_errors"`             // 累计错误数
+	ErrorsByCode  map[ErrorCode]int64 `json:"errors_by_code,omitempty"` // 按错误码分类的累计错误数
+	LastError     string              `json:"last_error,omitempty"`     // 最后一个错误的信息
+	LastErrorTime time.Time           `json:"last_error_time"`          // 最后错误时间
+	ErrorTrend    []ErrorTrendPoint   `json:"error_trend,omitempty"`    // 错误趋势数据
 }
 
-// handleConnectionError 处理连接错误
-// 这个方法统一处理连接失败的情况，包括状态更新、错误记录和恢复尝试
+// loadState 从--state-file恢复累计统计
+// 文件不存在时视为首次启动；恢复的计数器作为c.Stats的初始值，之后的统计在此基础上累加
 //
-// 参数说明：
-//   - err: 连接过程中发生的错误
-//
-// 返回值：
-//   - error: 包装后的ConnectionError，包含详细的错误信息
-//
-// 错误处理流程：
-//  1. 设置连接状态为断开
-//  2. 记录错误日志
-//  3. 更新错误统计信息
-//  4. 尝试自动错误恢复
-//  5. 返回结构化的错误信息
-//
-// 错误记录：
-//   - 更新错误统计和趋势数据
-//   - 支持错误分类和分析
-//   - 便于问题诊断和监控
-//
-// 自动恢复：
-//   - 检查是否启用自动恢复
-//   - 判断错误是否可恢复
-//   - 尝试执行恢复操作
-//
-// 错误包装：
-//   - 创建结构化的ConnectionError
-//   - 包含错误码、操作类型、URL等信息
-//   - 支持重试标记
-func (c *WebSocketClient) handleConnectionError(err error) error {
-	// 第一步：设置连接状态为断开
-	c.setState(StateDisconnected)
-	log.Printf("❌ 连接失败: %v", err)
+// 注意事项：
+//   - 必须在客户端创建后、任何goroutine开始更新统计之前调用
+//   - 文件损坏或版本不匹配时返回错误，客户端以空统计启动，下一次快照会覆盖该文件
+func (c *WebSocketClient) loadState() error {
+	safePath, err := validateWorkDirPath(c.config.StateFile)
+	if err != nil {
+		return fmt.Errorf(tr("无效的状态文件路径: %w"), err)
+	}
 
-	// 第二步：记录错误统计信息
-	c.recordError(err)
+	// #nosec G304 -- 路径已通过validateWorkDirPath限制在当前工作目录内
+	data, err := os.ReadFile(safePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf(tr("读取状态文件失败: %w"), err)
+	}
 
-	// 第三步：尝试自动错误恢复
-	c.attemptErrorRecovery(err)
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf(tr("解析状态文件失败: %w"), err)
+	}
+	if state.Version != StateFileVersion {
+		return fmt.Errorf(tr("不支持的状态文件版本: %d"), state.Version)
+	}
 
-	// 第四步：返回结构化的错误信息
-	return &ConnectionError{
-		Code:  c.inferErrorCode(err), // 推断错误码
-		Op:    "connect",             // 操作类型
-		URL:   c.config.URL,          // 连接URL
-		Err:   err,                   // 原始错误
-		Retry: true,                  // 支持重试
+	// 客户端刚创建，统计都还是零值，直接以保存的值作为初始值，同时记为本进程计数的基线
+	c.mu.Lock()
+	c.baseline = state
+	if !state.FirstStart.IsZero() {
+		c.firstStartTime = state.FirstStart
+	}
+	c.restarts = state.Restarts + 1
+	c.Stats.MessagesSent = state.MessagesSent
+	c.Stats.MessagesReceived = state.MessagesReceived
+	c.Stats.BytesSent = state.BytesSent
+	c.Stats.BytesReceived = state.BytesReceived
+	c.Stats.ReconnectCount = state.ReconnectCount
+	c.Stats.SentByType = state.SentByType
+	c.Stats.ReceivedByType = state.ReceivedByType
+	c.Stats.ProtocolViolations = state.ProtocolViolations
+	c.Stats.LastClose = state.LastClose
+	c.Stats.Errors.TotalErrors = state.Errors.TotalErrors
+	if state.Errors.ErrorsByCode != nil {
+		c.Stats.Errors.ErrorsByCode = state.Errors.ErrorsByCode
 	}
+	if state.Errors.LastError != "" {
+		c.Stats.Errors.LastError = errors.New(state.Errors.LastError)
+	}
+	c.Stats.Errors.LastErrorTime = state.Errors.LastErrorTime
+	c.Stats.Errors.ErrorTrend = state.Errors.ErrorTrend
+	c.mu.Unlock()
+
+	// 历史上出现过的错误码不应在重启后被当作新错误码告警
+	c.anomalyDetector.remember(state.Errors.ErrorsByCode)
+
+	log.Printf(tr("💾 已从状态文件恢复统计: 发送 %d 条, 接收 %d 条, 错误 %d 个 (首次启动于 %s, 第%d次重启)"),
+		state.MessagesSent, state.MessagesReceived, state.Errors.TotalErrors,
+		c.firstStartTime.Format("2006-01-02 15:04:05"), c.restarts)
+	return nil
 }
 
-// attemptErrorRecovery 尝试错误恢复
-// 这个方法在连接错误发生时尝试自动恢复，提供智能的错误处理机制
-//
-// 参数说明：
-//   - err: 需要尝试恢复的错误
-//
-// 恢复条件：
-//  1. 自动恢复功能已启用（AutoRecovery = true）
-//  2. 错误恢复器判断该错误可以恢复
-//  3. 有可用的恢复策略
-//
-// 恢复流程：
-//  1. 检查自动恢复是否启用
-//  2. 判断错误是否可恢复
-//  3. 创建带超时的恢复上下文
-//  4. 执行错误恢复操作
-//  5. 记录恢复结果
-//
-// 超时控制：
-//   - 使用配置的HandshakeTimeout作为恢复超时
-//   - 防止恢复操作无限阻塞
-//   - 确保恢复操作的及时性
-//
-// 错误处理：
-//   - 恢复失败时记录警告日志
-//   - 不会抛出异常，保证程序稳定性
-//   - 支持多种恢复策略
+// saveState 将当前的累计统计写入--state-file
+// 先写入同目录下的临时文件再重命名，进程在写入中途被杀死也不会留下损坏的状态文件
 //
-// 使用场景：
-//   - 网络连接临时中断的恢复
-//   - 服务器重启后的自动重连
-//   - 配置错误的自动修正
-func (c *WebSocketClient) attemptErrorRecovery(err error) {
-	// 第一步：检查自动恢复条件
-	if c.AutoRecovery && c.errorRecovery.CanRecover(err) {
-		log.Printf("🔄 尝试自动恢复连接错误...")
+// 并发安全：通过GetStats和GetErrorStats获取快照，可以在任意goroutine中调用
+func (c *WebSocketClient) saveState() error {
+	safePath, err := validateWorkDirPath(c.config.StateFile)
+	if err != nil {
+		return fmt.Errorf(tr("无效的状态文件路径: %w"), err)
+	}
+
+	stats := c.GetStats()
+	errorStats := c.GetErrorStats()
+	state := persistedState{
+		Version:            StateFileVersion,
+		SavedAt:            time.Now(),
+		FirstStart:         c.firstStartTime,
+		Restarts:           c.restarts,
+		MessagesSent:       stats.MessagesSent,
+		MessagesReceived:   stats.MessagesReceived,
+		BytesSent:          stats.BytesSent,
+		BytesReceived:      stats.BytesReceived,
+		ReconnectCount:     stats.ReconnectCount,
+		SentByType:         stats.SentByType,
+		ReceivedByType:     stats.ReceivedByType,
+		ProtocolViolations: stats.ProtocolViolations,
+		LastClose:          stats.LastClose,
+		Errors: persistedErrorStats{
+			TotalErrors:   errorStats.TotalErrors,
+			ErrorsByCode:  errorStats.ErrorsByCode,
+			LastErrorTime: errorStats.LastErrorTime,
+			ErrorTrend:    errorStats.ErrorTrend,
+		},
+	}
+	if errorStats.LastError != nil {
+		state.Errors.LastError = errorStats.LastError.Error()
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf(tr("序列化状态失败: %w"), err)
+	}
+	data = append(data, '\n')
 
-		// 第二步：创建带超时的恢复上下文
-		connectCtx, cancel := context.WithTimeout(c.ctx, c.config.HandshakeTimeout)
-		defer cancel()
+	tmp, err := os.CreateTemp(filepath.Dir(safePath), filepath.Base(safePath)+".tmp*")
+	if err != nil {
+		return fmt.Errorf(tr("创建临时状态文件失败: %w"), err)
+	}
+	defer os.Remove(tmp.Name()) // 重命名成功后文件已不存在，这里只清理失败时残留的临时文件
 
-		// 第三步：执行错误恢复操作
-		if recoveryErr := c.errorRecovery.Recover(connectCtx, err); recoveryErr != nil {
-			log.Printf("⚠️ 自动恢复失败: %v", recoveryErr)
-		}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf(tr("写入状态文件失败: %w"), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf(tr("写入状态文件失败: %w"), err)
+	}
+	if err := os.Rename(tmp.Name(), safePath); err != nil {
+		return fmt.Errorf(tr("替换状态文件失败: %w"), err)
 	}
+	return nil
 }
 
-// handleErrorWithRecovery 统一的错误处理和恢复函数
-// 记录错误统计信息并尝试自动恢复（如果启用）
-// operation参数用于在日志中标识错误发生的操作类型
-//
-// Example:
-//
-//	client.handleErrorWithRecovery(err, "发送")
-//	client.handleErrorWithRecovery(err, "连接")
-func (c *WebSocketClient) handleErrorWithRecovery(err error, operation string) {
-	c.recordError(err)
-	if c.AutoRecovery && c.errorRecovery.CanRecover(err) {
-		log.Printf("🔄 尝试自动恢复%s错误...", operation)
-		if recoveryErr := c.errorRecovery.Recover(c.ctx, err); recoveryErr != nil {
-			log.Printf("⚠️ %s错误恢复失败: %v", operation, recoveryErr)
-		}
+// persistState 保存统计快照，失败时只记录日志
+// 未配置--state-file时什么也不做，可以无条件调用
+func (c *WebSocketClient) persistState() {
+	if c.config.StateFile == "" {
+		return
+	}
+	if err := c.saveState(); err != nil {
+		log.Printf(tr("⚠️ 保存状态文件失败: %v"), err)
 	}
 }
 
-// setupConnection 设置新连接
-// 这个方法完成WebSocket连接的最终设置，包括连接替换、状态更新和回调触发
-//
-// 参数说明：
-//   - newConn: 新建立的WebSocket连接对象
-//
-// 设置流程：
-//  1. 记录连接成功日志
-//  2. 获取互斥锁保护连接操作
-//  3. 关闭旧连接（如果存在）
-//  4. 设置新连接和相关属性
-//  5. 配置ping/pong处理器
-//  6. 更新连接状态和统计信息
-//  7. 触发连接成功回调
-//
-// 连接管理：
-//   - 安全关闭旧连接，避免资源泄漏
-//   - 原子性地替换连接对象
-//   - 更新连接时间和重连计数
-//
-// 状态更新：
-//   - 设置连接状态为StateConnected
-//   - 更新连接统计信息
-//   - 记录连接建立时间
-//
-// 性能监控：
-//   - 更新性能监控指标
-//   - 记录连接成功事件
-//   - 支持监控系统集成
-//
-// 回调机制：
-//   - 安全调用用户定义的连接成功回调
-//   - 在独立goroutine中执行，避免阻塞
-//
-// 并发安全：
-//   - 使用互斥锁保护连接操作
-//   - 确保连接设置的原子性
-//   - 避免竞态条件
-func (c *WebSocketClient) setupConnection(newConn *websocket.Conn) {
-	// 第一步：记录连接成功
-	log.Printf("✅ 连接建立成功")
+// runStatePersistence 周期性保存统计快照，直到客户端停止
+func (c *WebSocketClient) runStatePersistence() {
+	c.wg.Add(1)
+	defer c.wg.Done()
 
-	// 第二步：获取锁保护连接操作
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	ticker := time.NewTicker(StateSnapshotInterval)
+	defer ticker.Stop()
 
-	// 第三步：关闭旧连接（如果存在）
-	if c.conn != nil {
-		if err := c.connector.Disconnect(c.conn); err != nil {
-			log.Printf("⚠️ 断开连接失败: %v", err)
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.persistState()
 		}
 	}
+}
 
-	// 第四步：设置新连接和相关属性
-	c.conn = newConn
-	c.Stats.ConnectTime = time.Now()
-	c.Stats.ReconnectCount++
-	c.setupPingPongHandlers()
+// ===== 持久化发送日志 =====
 
-	// 第五步：更新连接状态
-	c.setState(StateConnected)
-	log.Printf("✅ 已连接到 %s [会话: %s]", c.config.URL, c.SessionID)
+// 发送日志参数
+const (
+	JournalFileName       = "outbound.journal" // --journal目录下的日志文件名
+	JournalCompactMinAcks = 1024               // 确认记录达到此数量且多于未确认消息时压缩日志
+)
 
-	// 第六步：更新性能指标
-	c.performanceMonitor.UpdateMetrics(c.Stats)
+// journalRecord 发送日志中的一行记录（JSON Lines格式）
+type journalRecord struct {
+	Op   string `json:"op"`             // "msg"：写入的待发送消息；"ack"：该序号的消息已发送
+	Seq  uint64 `json:"seq"`            // 消息序号，在同一个日志内单调递增
+	Type int    `json:"type,omitempty"` // 消息类型（仅msg记录）
+	Data []byte `json:"data,omitempty"` // 消息内容，JSON中为base64编码（仅msg记录）
+}
 
-	// 第七步：触发连接成功回调
-	c.safeCallOnConnect()
+// journalEntry 发送日志中尚未确认的消息
+type journalEntry struct {
+	seq         uint64 // 消息序号
+	messageType int    // 消息类型
+	data        []byte // 消息内容（日志持有的副本）
 }
 
-// ReadMessages 启动一个 goroutine，持续从 WebSocket 连接读取消息。
-// 它处理不同类型的消息，更新读取截止时间，并管理连接错误。
-// 如果发生错误或上下文被取消，goroutine 将退出。
-// 此函数使用客户端的 WaitGroup 来通知其完成。
-// ReadMessages 持续读取WebSocket消息的核心循环
-// 这个方法是WebSocket客户端的消息接收引擎，负责持续监听和处理来自服务器的消息
-//
-// 功能说明：
-//   - 持续循环读取WebSocket消息直到连接断开或收到停止信号
-//   - 处理各种类型的消息（文本、二进制、控制消息）
-//   - 实现智能的错误分类和处理策略
-//   - 维护连接状态和统计信息
-//   - 支持用户自定义的消息处理回调
-//
-// 消息处理流程：
-//  1. 检查停止信号和连接状态
-//  2. 从WebSocket连接读取消息
-//  3. 更新连接超时时间
-//  4. 更新统计信息和日志记录
-//  5. 调用消息处理器处理消息
-//  6. 调用用户自定义回调函数
-//  7. 记录处理完成状态
-//
-// 错误处理策略：
-//   - 意外关闭：区分正常关闭和异常关闭
-//   - EOF错误：服务器主动关闭连接
-//   - 网络错误：网络连接中断
-//   - 上下文取消：客户端主动停止
-//   - 未知错误：记录详细信息便于调试
+// outboundJournal 出站消息的预写日志
+// 数据帧在写入连接之前先追加到日志并同步到磁盘，发送成功后追加确认记录；
+// 进程崩溃或连接断开时未确认的消息保留在日志中，下次连接成功后按序号重发
 //
 // 并发安全：
-//   - 使用defer确保资源正确清理
-//   - 通过互斥锁保护连接对象访问
-//   - 支持通过上下文优雅停止
-//
-// 生命周期管理：
-//   - 自动设置连接状态为断开
-//   - 确保WebSocket连接正确关闭
-//   - 清理连接对象引用
-//
-// 使用场景：
-//   - 作为独立的goroutine运行
-//   - 在连接建立后自动启动
-//   - 支持长时间运行的消息接收
-//
-// 注意事项：
-//   - 此方法会阻塞直到连接断开
-//   - 必须在goroutine中调用
-//   - 通过上下文控制停止时机
-//   - defer块确保在循环退出时将连接标记为未连接并关闭连接
-//
-// handleReadError 处理读取消息时的错误
-// 这个方法统一处理ReadMessage过程中发生的各种错误，提供详细的错误分类和日志记录
+//   - 所有方法都通过互斥锁保护，可以被并发的发送调用
+type outboundJournal struct {
+	mu       sync.Mutex              // 保护以下字段
+	path     string                  // 日志文件路径
+	file     *os.File                // 以追加方式打开的日志文件，关闭后为nil
+	nextSeq  uint64                  // 下一条消息的序号
+	pending  map[uint64]journalEntry // 未确认的消息：序号 -> 消息
+	inflight map[uint64]bool         // 正在发送中的序号，重发时跳过，避免同一条消息并发发送两次
+	acked    int                     // 上次压缩以来追加的确认记录数
+}
+
+// openOutboundJournal 打开--journal目录中的发送日志，恢复未确认的消息
 //
 // 参数说明：
-//   - err: 读取消息时发生的错误
-//
-// 错误分类处理：
-//  1. WebSocket意外关闭错误：区分客户端停止和异常关闭
-//  2. EOF错误：服务器主动关闭连接
-//  3. UnexpectedEOF错误：服务器连接意外断开
-//  4. 网络错误：网络连接中断
-//  5. 其他错误：未知类型错误
+//   - dir: 日志目录，不存在时自动创建，必须位于当前工作目录内
 //
-// 状态管理：
-//   - 设置连接状态为断开
-//   - 确保状态变更的原子性
+// 返回值：
+//   - *outboundJournal: 打开的日志
+//   - error: 目录无效或读写日志失败时的错误
 //
-// 日志记录：
-//   - 根据错误类型记录不同级别的日志
-//   - 提供详细的错误信息便于调试
-//   - 使用emoji增强日志可读性
-func (c *WebSocketClient) handleReadError(err error) {
-	c.setState(StateDisconnected)
-	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
-		select {
-		case <-c.ctx.Done():
-			log.Printf("ⓘ ReadMessages: WebSocket连接在客户端停止过程中关闭: %v", err)
-		default:
-			log.Printf("❌ ReadMessages: WebSocket连接异常关闭: %v", err)
+// 注意事项：
+//   - 进程在写入中途崩溃会留下不完整的最后一行，无法解析的行被跳过并记录警告
+//   - 打开时立即压缩一次，只保留未确认的消息
+func openOutboundJournal(dir string) (*outboundJournal, error) {
+	safeDir, err := validateWorkDirPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf(tr("无效的发送日志目录: %w"), err)
+	}
+	if err := os.MkdirAll(safeDir, 0o700); err != nil {
+		return nil, fmt.Errorf(tr("创建发送日志目录失败: %w"), err)
+	}
+
+	j := &outboundJournal{
+		path:     filepath.Join(safeDir, JournalFileName),
+		nextSeq:  1,
+		pending:  make(map[uint64]journalEntry),
+		inflight: make(map[uint64]bool),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.compactLocked(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// load 读取已有的日志文件，重建未确认消息和下一个序号
+func (j *outboundJournal) load() error {
+	// #nosec G304 -- 目录已通过validateWorkDirPath限制在当前工作目录内
+	file, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf(tr("读取发送日志失败: %w"), err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	skipped := 0
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record journalRecord
+			if err := json.Unmarshal(line, &record); err != nil || record.Seq == 0 {
+				skipped++
+			} else {
+				switch record.Op {
+				case "msg":
+					j.pending[record.Seq] = journalEntry{seq: record.Seq, messageType: record.Type, data: record.Data}
+				case "ack":
+					delete(j.pending, record.Seq)
+				default:
+					skipped++
+				}
+				j.nextSeq = max(j.nextSeq, record.Seq+1)
+			}
 		}
-	} else if errors.Is(err, io.EOF) {
-		log.Printf("🔌 ReadMessages: 服务器主动关闭连接 (EOF): %v", err)
-	} else if errors.Is(err, io.ErrUnexpectedEOF) {
-		log.Printf("🔌 ReadMessages: 服务器连接意外断开 (UnexpectedEOF): %v", err)
-	} else if isNetworkError(err) {
-		log.Printf("🔌 ReadMessages: 网络连接中断: %v", err)
-	} else {
-		select {
-		case <-c.ctx.Done():
-			log.Printf("ⓘ ReadMessages: 读取消息时检测到context关闭: %v", err)
-		default:
-			log.Printf("⚠️ ReadMessages: 读取消息失败 (未知类型): %v", err)
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf(tr("读取发送日志失败: %w"), readErr)
 		}
 	}
+	if skipped > 0 {
+		log.Printf(tr("⚠️ 发送日志中有 %d 行无法解析，已跳过（可能是崩溃时未写完的记录）"), skipped)
+	}
+	return nil
 }
 
-// processReceivedMessage 处理接收到的消息
-// 这个方法统一处理接收到的WebSocket消息，包括统计更新、日志记录和消息处理
-//
-// 参数说明：
-//   - messageType: WebSocket消息类型
-//   - message: 消息内容字节数组
-//
-// 处理流程：
-//  1. 重置连接超时时间
-//  2. 更新统计信息
-//  3. 记录消息到日志文件
-//  4. 调用消息处理器处理消息
-//  5. 调用用户自定义回调函数
-//  6. 记录处理完成状态
-//
-// 错误处理：
-//   - 消息处理器错误：记录日志并尝试恢复
-//   - 用户回调错误：记录日志但不中断流程
-//
-// 性能优化：
-//   - 避免不必要的字符串转换
-//   - 条件性的详细日志记录
-func (c *WebSocketClient) processReceivedMessage(messageType int, message []byte) {
-	c.resetTimeout()
+// writeRecord 将一条记录追加到日志文件，sync为true时同步到磁盘
+// 调用方必须持有j.mu
+func (j *outboundJournal) writeRecord(record journalRecord, sync bool) error {
+	if j.file == nil {
+		return errors.New(tr("发送日志已关闭"))
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf(tr("序列化发送日志记录失败: %w"), err)
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf(tr("写入发送日志失败: %w"), err)
+	}
+	if sync {
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf(tr("同步发送日志失败: %w"), err)
+		}
+	}
+	return nil
+}
 
-	// 更新统计信息
-	c.updateStats(messageType, len(message), false)
+// append 在发送之前记录一条消息，返回分配的序号
+// 记录同步到磁盘后才返回，之后进程崩溃也不会丢失该消息；返回的序号处于发送中状态，重发时跳过
+func (j *outboundJournal) append(messageType int, data []byte) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
 
-	// 记录消息到日志文件
-	c.logMessage("RECV", messageType, message)
+	seq := j.nextSeq
+	if err := j.writeRecord(journalRecord{Op: "msg", Seq: seq, Type: messageType, Data: data}, true); err != nil {
+		return 0, err
+	}
+	j.nextSeq++
+	j.pending[seq] = journalEntry{seq: seq, messageType: messageType, data: bytes.Clone(data)}
+	j.inflight[seq] = true
+	return seq, nil
+}
+
+// ack 记录消息已发送（或确定无法发送而放弃），确认记录足够多时压缩日志
+// 确认记录不单独同步：进程崩溃时丢失确认只会导致重启后重复发送，不会丢消息
+func (j *outboundJournal) ack(seq uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.inflight, seq)
+	if _, ok := j.pending[seq]; !ok {
+		return
+	}
+	delete(j.pending, seq)
+	if err := j.writeRecord(journalRecord{Op: "ack", Seq: seq}, false); err != nil {
+		log.Printf(tr("⚠️ 记录发送确认失败 (序号 %d): %v"), seq, err)
+		return
+	}
+	j.acked++
+	if j.acked >= JournalCompactMinAcks && j.acked > len(j.pending) {
+		if err := j.compactLocked(); err != nil {
+			log.Printf(tr("⚠️ 压缩发送日志失败: %v"), err)
+		}
+	}
+}
+
+// release 将发送失败的消息重新标记为待重发，下次重发时按序号发送
+func (j *outboundJournal) release(seqs ...uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, seq := range seqs {
+		delete(j.inflight, seq)
+	}
+}
+
+// claimPending 取出所有不在发送中的未确认消息（按序号排序），并将它们标记为发送中
+// 调用方对每条消息必须调用ack或release之一
+func (j *outboundJournal) claimPending() []journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]journalEntry, 0, len(j.pending))
+	for _, seq := range slices.Sorted(maps.Keys(j.pending)) {
+		if j.inflight[seq] {
+			continue
+		}
+		j.inflight[seq] = true
+		entries = append(entries, j.pending[seq])
+	}
+	return entries
+}
+
+// pendingCount 返回未确认的消息数（包括发送中的消息）
+func (j *outboundJournal) pendingCount() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.pending)
+}
+
+// compactLocked 只保留未确认的消息重写日志文件，并重新以追加方式打开
+// 先写入同目录下的临时文件再重命名，压缩中途崩溃时原日志保持完整
+// 调用方必须持有j.mu（或在日志发布之前调用）
+func (j *outboundJournal) compactLocked() error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), JournalFileName+".tmp*")
+	if err != nil {
+		return fmt.Errorf(tr("创建临时发送日志失败: %w"), err)
+	}
+	defer os.Remove(tmp.Name()) // 重命名成功后文件已不存在，这里只清理失败时残留的临时文件
+
+	writer := bufio.NewWriter(tmp)
+	for _, seq := range slices.Sorted(maps.Keys(j.pending)) {
+		entry := j.pending[seq]
+		line, err := json.Marshal(journalRecord{Op: "msg", Seq: seq, Type: entry.messageType, Data: entry.data})
+		if err == nil {
+			_, err = writer.Write(append(line, '\n'))
+		}
+		if err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf(tr("写入临时发送日志失败: %w"), err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf(tr("写入临时发送日志失败: %w"), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf(tr("同步临时发送日志失败: %w"), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf(tr("写入临时发送日志失败: %w"), err)
+	}
 
-	// 使用消息处理器接口处理消息
-	if err := c.messageProcessor.ProcessMessage(messageType, message); err != nil {
-		log.Printf("❌ 消息处理器错误: %v", err)
-		c.handleErrorWithRecovery(err, "消息处理")
+	if j.file != nil {
+		_ = j.file.Close()
+		j.file = nil
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf(tr("替换发送日志失败: %w"), err)
 	}
+	// #nosec G304 -- 目录已通过validateWorkDirPath限制在当前工作目录内
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf(tr("打开发送日志失败: %w"), err)
+	}
+	j.file = file
+	j.acked = 0
+	return nil
+}
 
-	// 调用用户自定义的消息处理回调（如果设置了）
-	if c.onMessage != nil {
-		if err := c.onMessage(messageType, message); err != nil {
-			log.Printf("❌ 用户消息处理回调错误: %v", err)
-		}
+// close 关闭日志文件，之后的append返回错误
+func (j *outboundJournal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
 	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
 
-	// 记录消息处理（仅在verbose模式下显示）
-	if c.config.Verbose {
-		log.Printf("📊 消息处理完成，类型: %s", c.getMessageTypeString(messageType))
+// journalRetryable 判断发送失败后消息是否应保留在发送日志中等待重发
+// 连接不可用和写入失败可以在重连后重发；安全检查、消息校验、大小超限和调用方取消重发也不会成功，直接放弃
+func journalRetryable(err error) bool {
+	var connErr *ConnectionError
+	if !errors.As(err, &connErr) {
+		return false
 	}
+	return connErr.Retry || connErr.Code == ErrCodeConnectionLost
 }
 
-// shouldContinueReading 检查是否应该继续读取消息
-// 这个方法检查停止信号和连接状态，决定是否应该继续消息读取循环
+// journaledWrite 在启用--journal时为出站写入函数包装预写日志
+//
+// 参数说明：
+//   - write: 最终的写入函数（出站中间件链的最后一个阶段）
 //
 // 返回值：
-//   - bool: true表示应该继续读取，false表示应该停止
+//   - MessageHandler: 未启用发送日志时原样返回write
 //
-// 检查项目：
-//  1. 上下文取消信号：客户端主动停止
-//  2. 连接状态：连接是否仍然有效
-//  3. 连接对象：连接对象是否存在
+// 功能说明：
+//   - 数据帧先同步写入发送日志再发送，发送成功后记录确认
+//   - 连接不可用或写入失败时消息保留在日志中，下次连接成功后重发，向调用方返回包装了原错误的ErrQueued
+//   - 其他失败（安全检查、校验、大小超限等）记录确认后返回原错误，不会重发
+//   - 控制帧不写入日志
 //
-// 日志记录：
-//   - 记录停止原因便于调试
-//   - 区分不同的停止场景
-func (c *WebSocketClient) shouldContinueReading() bool {
-	select {
-	case <-c.ctx.Done():
-		log.Printf("📋 ReadMessages: 收到停止信号，退出消息读取循环")
-		return false
-	default:
-		conn, connected := c.getConnSafely()
-		if conn == nil || !connected {
-			if c.isConnected() {
-				log.Printf("⚠️ ReadMessages: 连接状态不一致或连接对象为空，退出消息读取循环")
+// 注意事项：
+//   - 日志记录的是经过出站中间件处理后的内容，重发时直接写入连接，不会再次经过中间件
+func (c *WebSocketClient) journaledWrite(write MessageHandler) MessageHandler {
+	if c.journal == nil {
+		return write
+	}
+	return func(messageType int, data []byte) error {
+		if !isDataMessage(messageType) {
+			return write(messageType, data)
+		}
+		seq, err := c.journal.append(messageType, data)
+		if err != nil {
+			journalErr := &ConnectionError{
+				Code:  ErrCodeFileSystemError,
+				Op:    "journal",
+				URL:   c.config.URL,
+				Err:   err,
+				Retry: false,
 			}
-			return false
+			c.recordError(journalErr)
+			return journalErr
 		}
-		return true
+
+		err = write(messageType, data)
+		if err != nil && journalRetryable(err) {
+			c.journal.release(seq)
+			log.Printf(tr("📒 消息未能发送，已保留在发送日志中，连接后重发 (序号 %d): %v"), seq, err)
+			return fmt.Errorf("%w: %w", ErrQueued, err)
+		}
+		c.journal.ack(seq)
+		return err
 	}
 }
 
-func (c *WebSocketClient) ReadMessages() {
-	// 延迟执行的清理匿名函数：确保ReadMessages退出时正确清理连接资源
-	defer func() {
-		c.setState(StateDisconnected) // 设置连接状态为断开，通知其他组件连接已结束
-		c.mu.Lock()                   // 获取互斥锁，保护连接对象的并发访问
-		if c.conn != nil {
-			// 尝试关闭WebSocket连接，释放网络资源
-			if closeErr := c.conn.Close(); closeErr != nil {
-				log.Printf("⚠️ 关闭WebSocket连接失败: %v", closeErr)
-			}
-			c.conn = nil // 清空连接对象引用，防止后续误用
-		}
-		c.mu.Unlock() // 释放互斥锁
-	}()
+// replayJournal 按序号重发发送日志中未确认的消息
+// 每次连接成功后调用；连接再次不可用时停止，剩余消息留给下一次连接
+//
+// 注意事项：
+//   - 重发期间新发送的消息可能与重发的消息交错
+//   - 同一时间只有一个重发在运行
+func (c *WebSocketClient) replayJournal() {
+	defer c.wg.Done()
+	if !atomic.CompareAndSwapInt32(&c.journalReplaying, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.journalReplaying, 0)
 
-	for {
-		// 检查是否应该继续读取消息
-		if !c.shouldContinueReading() {
+	entries := c.journal.claimPending()
+	if len(entries) == 0 {
+		return
+	}
+	log.Printf(tr("📒 重发发送日志中 %d 条未确认的消息..."), len(entries))
+
+	sent := 0
+	for i, entry := range entries {
+		err := c.writeMessage(entry.messageType, entry.data)
+		switch {
+		case err == nil:
+			c.journal.ack(entry.seq)
+			sent++
+		case journalRetryable(err) || c.ctx.Err() != nil:
+			for _, rest := range entries[i:] {
+				c.journal.release(rest.seq)
+			}
+			log.Printf(tr("📒 重发中断，已重发 %d 条，剩余 %d 条等待下次连接: %v"), sent, len(entries)-i, err)
 			return
+		default:
+			c.journal.ack(entry.seq)
+			log.Printf(tr("⚠️ 放弃发送日志中无法发送的消息 (序号 %d): %v"), entry.seq, err)
 		}
+	}
+	log.Printf(tr("📒 发送日志重发完成: %d 条"), sent)
+}
 
-		// 获取连接对象
-		conn, _ := c.getConnSafely()
+// ===== SQLite抓包 =====
 
-		// 读取消息
-		messageType, message, err := conn.ReadMessage()
-		if err != nil {
-			c.handleReadError(err)
-			return
-		}
+// 抓包数据库参数
+const (
+	CaptureQueueSize    = 10000                  // 待写入消息队列容量，队列满时丢弃新消息
+	CaptureBatchSize    = 500                    // 每个事务最多写入的消息数
+	CaptureLinger       = 200 * time.Millisecond // 未攒满一批时最长等待时间
+	CaptureFlushTimeout = 5 * time.Second        // 客户端停止时等待剩余消息写入的最长时间
+)
 
-		// 处理接收到的消息
-		c.processReceivedMessage(messageType, message)
-	}
+// captureSchema 抓包数据库的表结构，重复打开同一个数据库时追加记录
+//
+// 字段说明：
+//   - direction: SEND或RECV，与json格式消息日志一致
+//   - timestamp: Unix毫秒时间戳，可用 datetime(timestamp / 1000, 'unixepoch') 转换
+//   - type: TEXT、BINARY、PING、PONG、CLOSE
+//   - payload: 流式收发的大消息只记录大小，载荷为NULL
+const captureSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id         INTEGER PRIMARY KEY,
+	session_id TEXT    NOT NULL,
+	direction  TEXT    NOT NULL,
+	timestamp  INTEGER NOT NULL,
+	type       TEXT    NOT NULL,
+	size       INTEGER NOT NULL,
+	payload    BLOB
+);
+CREATE INDEX IF NOT EXISTS messages_timestamp ON messages (timestamp);
+CREATE INDEX IF NOT EXISTS messages_session ON messages (session_id, timestamp);
+CREATE INDEX IF NOT EXISTS messages_direction_type ON messages (direction, type, timestamp);
+`
+
+// captureRecord 等待写入抓包数据库的一帧
+type captureRecord struct {
+	direction   string // SEND或RECV
+	timestamp   int64  // Unix毫秒时间戳
+	messageType int    // 帧类型
+	size        int64  // 载荷字节数
+	payload     []byte // 载荷副本，流式消息为nil
 }
 
-// sendPeriodicPing 启动一个 goroutine，该 goroutine 定期向服务器发送 ping 消息
-// 这个函数实现了WebSocket连接的心跳保活机制，防止连接因空闲而被中间设备断开
+// messageCapture 把收发的每一帧写入--capture-db指定的SQLite数据库
+// 帧先进入有界队列，由独立goroutine按批在事务中写入，读取循环不会因磁盘写入阻塞
 //
-// 功能说明：
-//   - 根据配置的PingInterval间隔发送ping消息
-//   - 监听上下文取消信号，支持优雅停止
-//   - 使用WaitGroup确保goroutine正确结束
-//   - 处理发送失败的情况，记录错误但不中断
+// 注意事项：
+//   - 所有方法在接收者为nil时为空操作，未启用--capture-db时调用方无需判断
+//   - 使用纯Go实现的SQLite驱动，不依赖cgo，发布构建可以继续交叉编译
 //
-// 心跳机制：
-//   - 定时发送：按配置的间隔定期发送ping消息
-//   - 错误处理：发送失败时记录日志，下次继续尝试
-//   - 优雅停止：响应上下文取消，立即停止发送
+// 并发安全：record和recordStreamed可在任意goroutine中调用
+type messageCapture struct {
+	db        *sql.DB // 数据库连接
+	sessionID string  // 写入每条记录的会话ID
+
+	mu     sync.Mutex         // 保护closed，避免向已关闭的队列发送
+	closed bool               // 是否已关闭
+	queue  chan captureRecord // 待写入队列
+	done   chan struct{}      // 写入goroutine退出时关闭
+
+	written int64 // 已写入的帧数（原子操作）
+	dropped int64 // 队列满或写入失败丢弃的帧数（原子操作）
+}
+
+// openMessageCapture 打开或创建抓包数据库并启动写入goroutine
 //
-// 并发安全：
-//   - 使用WaitGroup管理goroutine生命周期
-//   - 通过上下文控制停止时机
-//   - 发送操作使用线程安全的sendControlMessage
+// 参数说明：
+//   - path: 数据库文件路径，必须位于当前工作目录内
+//   - sessionID: 客户端会话ID
 //
-// 使用场景：
-//   - 保持WebSocket连接活跃
-//   - 检测连接状态
-//   - 防止NAT/防火墙超时断开连接
+// 返回值：
+//   - *messageCapture: 打开的抓包数据库
+//   - error: 路径无效、打开数据库或创建表结构失败时的错误
 //
 // 注意事项：
-//   - 只有在DisableAutoPing为false时才会调用此函数
-//   - 使用配置中的PingInterval而不是硬编码值
-//   - 支持详细日志模式下的ping消息记录
-func (c *WebSocketClient) sendPeriodicPing() {
-	c.wg.Add(1)
-	defer c.wg.Done()
+//   - 数据库使用WAL模式，抓包期间可以用sqlite3等工具同时查询
+func openMessageCapture(path, sessionID string) (*messageCapture, error) {
+	safePath, err := validateWorkDirPath(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("无效的抓包数据库路径: %w"), err)
+	}
+	db, err := sql.Open("sqlite", safePath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf(tr("打开抓包数据库失败: %w"), err)
+	}
+	db.SetMaxOpenConns(1) // 只有写入goroutine使用，单个连接避免SQLITE_BUSY
+	if _, err := db.Exec(captureSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf(tr("创建抓包数据库表失败: %w"), err)
+	}
 
-	// 使用配置中的ping间隔，而不是硬编码的默认值
-	c.pingTicker = time.NewTicker(c.config.PingInterval)
-	defer c.pingTicker.Stop()
+	c := &messageCapture{
+		db:        db,
+		sessionID: sessionID,
+		queue:     make(chan captureRecord, CaptureQueueSize),
+		done:      make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+// record 记录收发的一帧，载荷会被复制
+func (c *messageCapture) record(sent bool, messageType int, data []byte) {
+	if c == nil {
+		return
+	}
+	c.enqueue(captureRecord{
+		direction:   captureDirection(sent),
+		timestamp:   time.Now().UnixMilli(),
+		messageType: messageType,
+		size:        int64(len(data)),
+		payload:     bytes.Clone(data),
+	})
+}
+
+// recordStreamed 记录流式收发的大消息，只记录大小不记录载荷
+func (c *messageCapture) recordStreamed(sent bool, messageType int, size int64) {
+	if c == nil {
+		return
+	}
+	c.enqueue(captureRecord{
+		direction:   captureDirection(sent),
+		timestamp:   time.Now().UnixMilli(),
+		messageType: messageType,
+		size:        size,
+	})
+}
+
+// enqueue 将记录加入写入队列，队列满或已关闭时丢弃
+func (c *messageCapture) enqueue(record captureRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queue <- record:
+	default:
+		if atomic.AddInt64(&c.dropped, 1) == 1 {
+			log.Print(tr("⚠️ 抓包数据库写入队列已满，开始丢弃记录"))
+		}
+	}
+}
+
+// run 从队列攒批写入，攒满CaptureBatchSize条或等待CaptureLinger后提交，队列关闭后写入剩余记录并退出
+func (c *messageCapture) run() {
+	defer close(c.done)
 
+	ticker := time.NewTicker(CaptureLinger)
+	defer ticker.Stop()
+
+	batch := make([]captureRecord, 0, CaptureBatchSize)
 	for {
 		select {
-		case <-c.ctx.Done():
-			if c.config.VerbosePing {
-				log.Printf("📋 sendPeriodicPing: 停止周期性ping (context done)")
-			}
-			return
-		case <-c.pingTicker.C:
-			select {
-			case <-c.ctx.Done():
-				if c.config.VerbosePing {
-					log.Printf("📡 sendPeriodicPing: 停止周期性ping (context done before ping send)")
-				}
+		case record, ok := <-c.queue:
+			if !ok {
+				c.write(batch)
 				return
-			default:
 			}
-			if err := c.sendControlMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("❌ sendPeriodicPing: 发送ping失败: %v. 将在下次tick尝试。", err)
-			} else if c.config.VerbosePing {
-				log.Printf("📡 sendPeriodicPing: 发送ping到服务器")
+			batch = append(batch, record)
+			if len(batch) >= CaptureBatchSize {
+				c.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				c.write(batch)
+				batch = batch[:0]
 			}
 		}
 	}
 }
 
-// Stop 优雅地停止WebSocket客户端
-// 这个方法实现了客户端的优雅关闭流程，确保所有资源正确释放和清理
-//
-// 功能说明：
-//   - 取消客户端的上下文，通知所有goroutine停止
-//   - 发送WebSocket关闭消息，通知服务器连接即将关闭
-//   - 关闭底层的WebSocket连接
-//   - 等待所有客户端管理的goroutine完成
-//   - 清理相关资源（日志文件、监控服务器等）
+// write 在一个事务中写入一批记录，失败时整批计为丢弃
+func (c *messageCapture) write(batch []captureRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := c.insert(batch); err != nil {
+		atomic.AddInt64(&c.dropped, int64(len(batch)))
+		log.Printf(tr("⚠️ 写入抓包数据库失败，丢弃 %d 条记录: %v"), len(batch), err)
+		return
+	}
+	atomic.AddInt64(&c.written, int64(len(batch)))
+}
+
+// insert 执行写入事务
+func (c *messageCapture) insert(batch []captureRecord) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }() // 提交成功后Rollback不做任何事
+
+	stmt, err := tx.Prepare("INSERT INTO messages (session_id, direction, timestamp, type, size, payload) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, record := range batch {
+		var payload any // 流式消息写入NULL
+		if record.payload != nil {
+			payload = record.payload
+		}
+		typeName := fmt.Sprintf("TYPE_%d", record.messageType)
+		if record.messageType >= 0 && record.messageType < len(messageTypeStrings) {
+			typeName = messageTypeStrings[record.messageType]
+		}
+		if _, err := stmt.Exec(c.sessionID, record.direction, record.timestamp, typeName, record.size, payload); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// close 停止接收新记录，在timeout内等待队列写完后关闭数据库
+func (c *messageCapture) close(timeout time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-time.After(timeout):
+		// 写入goroutine仍在使用数据库，不关闭连接；WAL模式下已提交的记录不受影响
+		log.Printf(tr("⚠️ 等待抓包数据库写入超时 (%v)，剩余 %d 条记录未写入"), timeout, len(c.queue))
+		return
+	}
+	if err := c.db.Close(); err != nil {
+		log.Printf(tr("⚠️ 关闭抓包数据库失败: %v"), err)
+	}
+	if dropped := atomic.LoadInt64(&c.dropped); dropped > 0 {
+		log.Printf(tr("🗄️ 抓包数据库已写入 %d 帧，丢弃 %d 帧"), atomic.LoadInt64(&c.written), dropped)
+	}
+}
+
+// captureDirection 返回帧方向的记录取值，与json格式消息日志一致
+func captureDirection(sent bool) string {
+	if sent {
+		return "SEND"
+	}
+	return "RECV"
+}
+
+// ===== 序列号检测 =====
+
+// SequenceStats 有序消息流的序列号检测统计
+// 配置--seq-path后，从每条收到的JSON文本消息中取序列号，检查是否逐一递增
+type SequenceStats struct {
+	Last         int64 `json:"last"`         // 已收到的最大序列号
+	Gaps         int64 `json:"gaps"`         // 序列号跳跃的次数
+	Missing      int64 `json:"missing"`      // 跳跃中缺失的序列号总数
+	Duplicates   int64 `json:"duplicates"`   // 与最大序列号重复的消息数
+	OutOfOrder   int64 `json:"out_of_order"` // 小于最大序列号的消息数：迟到的消息或更早消息的重复
+	Resubscribes int64 `json:"resubscribes"` // 检测到跳跃后发送重新订阅消息的次数
+
+	started bool // 是否已收到过序列号
+	rebase  bool // 新连接建立后还没有收到序列号：服务器可能重新开始编号
+}
+
+// sequenceEvent 一个序列号的检测结果
+type sequenceEvent int
+
+const (
+	sequenceInOrder    sequenceEvent = iota // 连续递增
+	sequenceGap                             // 跳过了一个或多个序列号
+	sequenceDuplicate                       // 与最大序列号重复
+	sequenceOutOfOrder                      // 小于最大序列号
+	sequenceRestart                         // 新连接的第一个序列号不大于之前的序列号，视为服务器重新编号
+)
+
+// observe 记录一个序列号并返回检测结果（调用方需持有保护统计数据的锁）
+// 重连不会清空序列号：跨重连的跳跃正是最常见的丢消息场景
+func (s *SequenceStats) observe(seq int64) sequenceEvent {
+	rebase := s.rebase
+	s.rebase = false
+
+	switch {
+	case !s.started:
+		s.started = true
+		s.Last = seq
+		return sequenceInOrder
+	case seq == s.Last+1:
+		s.Last = seq
+		return sequenceInOrder
+	case seq > s.Last+1:
+		s.Gaps++
+		s.Missing += seq - s.Last - 1
+		s.Last = seq
+		return sequenceGap
+	case rebase:
+		s.Last = seq
+		return sequenceRestart
+	case seq == s.Last:
+		s.Duplicates++
+		return sequenceDuplicate
+	default:
+		s.OutOfOrder++
+		return sequenceOutOfOrder
+	}
+}
+
+// sequenceGapData 重新订阅消息模板可以引用的数据
+type sequenceGapData struct {
+	Expected int64 // 期望收到的序列号，即第一个缺失的序列号
+	Received int64 // 实际收到的序列号
+}
+
+// parseSequenceNumber 按JSON路径从消息中取序列号
+// 支持JSON整数和十进制数字字符串；以json.Number解码，超过2^53的序列号也不会丢失精度
+//
+// 返回值：
+//   - int64: 序列号
+//   - bool: 消息是否为JSON且路径上有合法的整数序列号
+func parseSequenceNumber(message []byte, path string) (int64, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	var parsed any
+	if decoder.Decode(&parsed) != nil {
+		return 0, false
+	}
+	value, ok := lookupJSONPath(parsed, path)
+	if !ok {
+		return 0, false
+	}
+
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		text = v.String()
+	case string:
+		text = v
+	default:
+		return 0, false
+	}
+	seq, err := strconv.ParseInt(text, 10, 64)
+	return seq, err == nil
+}
+
+// trackSequence 检查收到的消息的序列号，发现跳跃时按--seq-resubscribe发送重新订阅消息
+// 只处理文本消息；没有序列号的消息（如心跳、订阅确认）直接忽略
+func (c *WebSocketClient) trackSequence(messageType int, message []byte) {
+	if c.config.SeqPath == "" || messageType != websocket.TextMessage {
+		return
+	}
+	seq, ok := parseSequenceNumber(message, c.config.SeqPath)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	last := c.Stats.Sequence.Last
+	event := c.Stats.Sequence.observe(seq)
+	c.mu.Unlock()
+
+	switch event {
+	case sequenceGap:
+		log.Printf(tr("🕳️ 序列号跳跃: 期望 %d，收到 %d (缺失 %d 条)"), last+1, seq, seq-last-1)
+		c.resubscribe(sequenceGapData{Expected: last + 1, Received: seq})
+	case sequenceDuplicate:
+		log.Printf(tr("♻️ 重复的序列号: %d"), seq)
+	case sequenceOutOfOrder:
+		log.Printf(tr("🔀 乱序的序列号: 收到 %d，已收到 %d"), seq, last)
+	case sequenceRestart:
+		log.Printf(tr("🔁 新连接的序列号从 %d 重新开始 (之前为 %d)"), seq, last)
+	}
+}
+
+// resubscribe 渲染--seq-resubscribe模板并作为文本消息发送
+// 未配置时什么也不做；发送失败只记录日志，不影响消息处理
+func (c *WebSocketClient) resubscribe(data sequenceGapData) {
+	if c.seqResubscribe == nil {
+		return
+	}
+
+	var message strings.Builder
+	if err := c.seqResubscribe.Execute(&message, data); err != nil {
+		log.Printf(tr("⚠️ 重新订阅消息渲染失败: %v"), err)
+		return
+	}
+	if err := c.SendMessage(websocket.TextMessage, []byte(message.String())); errors.Is(err, ErrQueued) {
+		log.Print(tr("📒 重新订阅消息已排队，连接后重发"))
+		return
+	} else if err != nil {
+		log.Printf(tr("⚠️ 重新订阅消息发送失败: %v"), err)
+		return
+	}
+
+	c.mu.Lock()
+	c.Stats.Sequence.Resubscribes++
+	c.mu.Unlock()
+	log.Printf(tr("📨 已发送重新订阅消息 (从序列号 %d 开始)"), data.Expected)
+}
+
+// ===== 客户端池 =====
+
+// PoolMemberLabel 池成员在合并指标中的标签名
+const PoolMemberLabel = "pool_member"
+
+// ClientPool 管理多个WebSocketClient的客户端池
+// 适用于需要同时维护多条上游连接的应用：统一启动和停止、按权重把发送分配到已连接的成员、合并导出所有成员的指标
+//
+// 共享资源：
+//   - 缓冲区：所有客户端都从进程级的globalBufferPool借用缓冲区，池中成员天然共享同一个BufferPool
+//   - 指标：成员不单独监听端口，MetricsHandler把所有成员的指标合并为一份，样本带pool_member标签区分成员
+//
+// 路由策略：
+//   - 平滑加权轮询：权重为3和1的两个成员按 A A B A 的顺序交替，而不是连续三次A
+//   - 只在已连接的成员之间分配，某个成员发送失败时依次尝试下一个
+//
+// 分片：
+//   - AddShards为列表中的每个分片加入一个成员，分片是各自的URL，或同一URL上某个查询参数的不同取值
+//   - Stats汇总每个成员的收发消息数和接收延迟，找出落后或停止产出的分片
+//
+// 并发安全：所有方法都可以在多个goroutine中同时调用
+type ClientPool struct {
+	mu      sync.Mutex
+	members []*poolMember
+	started bool           // Start之后加入的成员立即启动
+	wg      sync.WaitGroup // 等待所有成员的Start主循环退出
+}
+
+// poolMember 池中的一个客户端
+type poolMember struct {
+	name    string
+	client  *WebSocketClient
+	weight  int
+	shard   string // AddShards分配的分片：参数名=取值，或脱敏后的URL；Add加入的成员为空
+	current int    // 平滑加权轮询的当前权重（受ClientPool.mu保护）
+
+	routed   int64 // 经由池路由并发送成功的消息数（原子操作）
+	failures int64 // 经由池路由但发送失败的次数（原子操作）
+}
+
+// NewClientPool 创建空的客户端池，通过Add加入成员
 //
-// 停止流程：
-//  1. 取消上下文：通知所有goroutine停止工作
-//  2. 设置状态：将连接状态设置为断开
-//  3. 发送关闭消息：向服务器发送正常关闭消息
-//  4. 关闭连接：关闭底层的WebSocket连接
-//  5. 等待完成：等待所有goroutine优雅退出
-//  6. 清理资源：关闭日志文件和监控服务器
+// 使用示例：
 //
-// 优雅关闭特点：
-//   - 协议兼容：按照WebSocket协议发送关闭帧
-//   - 资源清理：确保所有资源正确释放
-//   - 并发安全：使用锁保护关键操作
-//   - 超时控制：避免无限等待
+//	pool := NewClientPool()
+//	for i, url := range upstreams {
+//		if _, err := pool.Add(fmt.Sprintf("upstream-%d", i), NewDefaultConfig(url), 1); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//	pool.Start()
+//	defer pool.Stop()
 //
-// 错误处理：
-//   - 发送关闭消息失败：记录警告但继续关闭流程
-//   - 连接关闭失败：记录警告但继续清理
-//   - 确保即使出现错误也能完成清理
+//	http.Handle("/metrics", pool.MetricsHandler())
+//	err := pool.Send(websocket.TextMessage, []byte("hello"))
+func NewClientPool() *ClientPool {
+	return &ClientPool{}
+}
+
+// Add 按配置创建客户端并加入池中
 //
-// 并发安全：
-//   - 使用互斥锁保护连接对象访问
-//   - 通过WaitGroup等待所有goroutine完成
-//   - 支持多次调用（幂等操作）
+// 参数说明：
+//   - name: 成员名称，作为合并指标中pool_member标签的取值，在池内必须唯一
+//   - config: 客户端配置，池会复制一份并关闭成员自己的监控端口
+//   - weight: 路由权重，必须为正数
 //
-// 使用场景：
-//   - 程序正常退出时调用
-//   - 接收到停止信号时调用
-//   - 发生不可恢复错误时调用
-//   - 用户主动断开连接时调用
+// 返回值：
+//   - *WebSocketClient: 新建的客户端，可用于设置回调或单独发送
+//   - error: 名称重复、权重无效或配置验证失败时的错误信息
 //
 // 注意事项：
-//   - 此方法会阻塞直到所有goroutine停止
-//   - 应该在主goroutine中调用
-//   - 支持多次调用，不会产生副作用
-//   - 确保在程序退出前调用此方法
-func (c *WebSocketClient) Stop() {
-	log.Printf("🛑 Stop: 开始停止客户端...")
-	c.cancel()
-	c.setState(StateDisconnected)
-	c.mu.Lock()
-	if c.conn != nil {
-		if err := c.conn.WriteMessage(websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "客户端主动关闭")); err != nil {
-			log.Printf("⚠️ 发送关闭消息失败: %v", err)
-		}
-		if closeErr := c.conn.Close(); closeErr != nil {
-			log.Printf("⚠️ 关闭WebSocket连接失败: %v", closeErr)
+//   - 池已经启动时新成员立即开始连接
+func (p *ClientPool) Add(name string, config *ClientConfig, weight int) (*WebSocketClient, error) {
+	if name == "" {
+		return nil, fmt.Errorf(tr("%w: 池成员名称不能为空"), ErrInvalidConfig)
+	}
+	if weight <= 0 {
+		return nil, fmt.Errorf(tr("%w: 池成员 %s 的权重必须为正数"), ErrInvalidConfig, name)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf(tr("池成员 %s: %w"), name, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, member := range p.members {
+		if member.name == name {
+			return nil, fmt.Errorf(tr("%w: 池成员 %s 已存在"), ErrInvalidConfig, name)
 		}
-		c.conn = nil
 	}
-	c.mu.Unlock()
-	log.Printf("⏳ Stop: 等待所有内部goroutine停止...")
-	c.wg.Wait()
 
-	// 关闭消息日志文件
-	c.closeMessageLog()
+	// 指标由池统一导出，成员各自监听端口会互相冲突
+	memberConfig := *config
+	memberConfig.MetricsEnabled = false
+	memberConfig.AdminPort = 0
+	memberConfig.AdminToken = ""
+
+	member := &poolMember{name: name, client: NewWebSocketClient(&memberConfig), weight: weight}
+	member.client.poolMember = name
+	member.client.pool = p
+	p.members = append(p.members, member)
+	if p.started {
+		p.startMember(member)
+	}
+	return member.client, nil
+}
 
-	// 停止监控服务器
-	c.stopMonitoringServers()
+// AddShards 为列表中的每个分片创建一个客户端并加入池中，权重均为1
+//
+// 参数说明：
+//   - config: 客户端配置，各分片共用，只有URL不同
+//   - shards: 分片列表；param为空时每一项是一条连接的URL，否则是param查询参数的取值
+//   - param: 分片查询参数名，每条连接的URL为config.URL附加 param=分片取值（覆盖URL中的同名参数）
+//
+// 返回值：
+//   - []*WebSocketClient: 新建的客户端，顺序与shards一致
+//   - error: 分片URL无效、成员名称重复或配置验证失败时的错误信息，此时已加入的分片保留在池中
+//
+// 成员名称：
+//   - 按查询参数分片时为分片取值，便于在指标的pool_member标签中区分
+//   - 按URL分片时为shard-1、shard-2……，URL可能带有凭据，不适合作为指标标签
+func (p *ClientPool) AddShards(config *ClientConfig, shards []string, param string) ([]*WebSocketClient, error) {
+	clients := make([]*WebSocketClient, 0, len(shards))
+	for i, shard := range shards {
+		memberConfig := *config
+		memberConfig.Shards = nil
+		memberConfig.ShardParam = ""
+		name := shard
+		if param == "" {
+			memberConfig.URL = shard
+			name = fmt.Sprintf("shard-%d", i+1)
+		} else {
+			shardURL, err := mergeQueryParams(config.URL, []string{param + "=" + shard})
+			if err != nil {
+				return clients, err
+			}
+			memberConfig.URL = shardURL
+		}
 
-	log.Printf("🛑 Stop: 客户端已优雅停止")
+		client, err := p.Add(name, &memberConfig, 1)
+		if err != nil {
+			return clients, err
+		}
+		assigned := param + "=" + shard
+		if param == "" {
+			assigned = redactURL(shard)
+		}
+		p.mu.Lock()
+		for _, member := range p.members {
+			if member.client == client {
+				member.shard = assigned
+			}
+		}
+		p.mu.Unlock()
+		clients = append(clients, client)
+	}
+	return clients, nil
 }
 
-// getConnSafely 提供一种线程安全的方式来获取当前的 WebSocket 连接
-// 对象及其连接状态。
-func (c *WebSocketClient) getConnSafely() (*websocket.Conn, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	// 直接检查状态，避免调用isConnected()导致的死锁
-	connected := atomic.LoadInt32(&c.State) == int32(StateConnected)
-	return c.conn, connected
+// Clients 返回池中所有成员的客户端，顺序与加入顺序一致
+func (p *ClientPool) Clients() []*WebSocketClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clients := make([]*WebSocketClient, len(p.members))
+	for i, member := range p.members {
+		clients[i] = member.client
+	}
+	return clients
 }
 
-// sendControlMessage 发送 WebSocket 控制消息（例如 Ping、Pong、Close）。
-// 它确保在尝试发送消息之前客户端已连接。
-// 此函数是线程安全的。
-func (c *WebSocketClient) sendControlMessage(messageType int, data []byte) error {
-	conn, connected := c.getConnSafely()
-	if conn == nil || !connected {
-		return fmt.Errorf("连接已关闭")
+// Start 启动池中所有成员（非阻塞），每个成员在自己的goroutine中连接和重试
+func (p *ClientPool) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started {
+		return
 	}
+	p.started = true
+	for _, member := range p.members {
+		p.startMember(member)
+	}
+}
 
-	// 使用写锁保护WebSocket写操作，防止并发写入
-	c.writeMu.Lock()
-	defer c.writeMu.Unlock()
-
-	return conn.WriteControl(messageType, data, time.Now().Add(WriteTimeout))
+// startMember 在独立goroutine中运行成员的Start主循环（调用方需持有p.mu）
+func (p *ClientPool) startMember(member *poolMember) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		member.client.Start()
+	}()
 }
 
-// setupPingPongHandlers 为当前的 WebSocket 连接配置 ping 和 pong 处理器。
-// pong 处理器更新读取截止时间。ping 处理器以 pong 消息响应，
-// 并且也会更新读取截止时间。还会设置一个初始的读取截止时间。
-// 此方法只应在 c.conn 不为 nil 时调用，并且通常在锁的保护下调用。
-func (c *WebSocketClient) setupPingPongHandlers() {
-	if c.conn == nil {
-		return
-	}
-	c.conn.SetPongHandler(func(appData string) error {
-		if c.config.VerbosePing {
-			log.Printf("📡 PongHandler: 收到服务器pong响应")
-		}
-		c.resetTimeout()
-		return nil
-	})
-	c.conn.SetPingHandler(func(appData string) error {
-		if c.config.VerbosePing {
-			log.Printf("📡 PingHandler: 收到服务器ping，发送pong响应")
-		}
-		err := c.sendControlMessage(websocket.PongMessage, []byte(appData))
-		if err != nil {
-			log.Printf("❌ PingHandler: 发送pong失败: %v", err)
-		}
-		c.resetTimeout()
-		return err
-	})
-	if c.conn != nil {
-		if err := c.conn.SetReadDeadline(time.Now().Add(ReadTimeout)); err != nil {
-			log.Printf("⚠️ 设置读取超时失败: %v", err)
-		}
+// Stop 并行停止池中所有成员，等待全部停止后返回
+// 与WebSocketClient一样，停止后的池不能再次启动
+func (p *ClientPool) Stop() {
+	p.mu.Lock()
+	members := slices.Clone(p.members)
+	p.started = false
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, member := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			member.client.Stop()
+		}()
 	}
+	wg.Wait()
+	p.wg.Wait()
 }
 
-// resetTimeout 重置 WebSocket 连接上的读取截止时间。
-// 通常在成功发送或接收数据后调用此方法，以保持连接活动状态。
-// 如果连接为nil，则不执行任何操作。
-func (c *WebSocketClient) resetTimeout() {
-	c.mu.RLock()
-	conn := c.conn
-	c.mu.RUnlock()
-	if conn != nil {
-		if err := conn.SetReadDeadline(time.Now().Add(ReadTimeout)); err != nil {
-			log.Printf("⚠️ 设置连接读取超时失败: %v", err)
+// Send 按权重选择一个已连接的成员发送消息
+// 选中的成员发送失败时按轮询顺序尝试其余已连接的成员，全部失败时返回最后一个错误
+//
+// 返回值：
+//   - error: 没有已连接的成员时返回ErrConnectionClosed；消息保留在成员的发送日志中时返回ErrQueued
+func (p *ClientPool) Send(messageType int, data []byte) error {
+	lastErr := ErrConnectionClosed
+	for _, member := range p.route() {
+		err := member.client.SendMessage(messageType, data)
+		if err == nil || errors.Is(err, ErrQueued) {
+			// 已保留在成员发送日志中的消息由该成员重连后重发，换成员发送会造成重复
+			atomic.AddInt64(&member.routed, 1)
+			return err
 		}
+		atomic.AddInt64(&member.failures, 1)
+		lastErr = err
 	}
+	return lastErr
 }
 
-// logReceivedMessage 记录接收到的消息（优化字符串转换）
-// 这个方法根据消息类型记录不同格式的接收日志，优化了字符串转换性能
+// BroadcastResult 一个成员的广播发送结果
+type BroadcastResult struct {
+	Member string // 成员名称
+	Err    error  // 发送成功时为nil；消息保留在成员发送日志中等待重发时errors.Is(Err, ErrQueued)成立
+}
+
+// Broadcast 把同一条消息并行发送给池中的所有成员，或filter选出的部分成员
 //
 // 参数说明：
-//   - messageType: WebSocket消息类型常量
-//   - message: 消息内容的字节数组
+//   - messageType: 消息类型（websocket.TextMessage或websocket.BinaryMessage）
+//   - data: 消息内容，各成员共用，发送期间调用方不应修改
+//   - filter: 选择成员的函数，参数为成员名称和客户端，返回true表示发送给该成员；为nil时发送给所有成员
 //
-// 消息类型处理：
-//  1. 文本消息：显示完整的文本内容
-//  2. 二进制消息：只显示字节数，避免乱码
-//  3. Ping消息：仅在详细模式下显示
-//  4. Pong消息：仅在详细模式下显示
-//  5. 其他类型：显示消息类型编号
+// 返回值：
+//   - []BroadcastResult: 每个选中成员的发送结果，顺序与加入顺序一致；没有成员被选中时为空
 //
-// 性能优化：
-//   - 避免不必要的字符串转换
-//   - 二进制消息只显示长度，不转换内容
-//   - 控制消息的日志输出频率
+// 注意事项：
+//   - 与Send不同，未连接的成员同样会尝试发送，失败原因如实记录在结果中，不换成员重试
+//   - 广播不参与加权路由，不计入websocket_pool_routed_total和websocket_pool_route_failures_total
 //
-// 日志控制：
-//   - Ping/Pong消息受VerbosePing配置控制
-//   - 使用emoji增强日志可读性
-//   - 提供结构化的日志格式
+// Example:
 //
-// 使用场景：
-//   - 调试消息接收问题
-//   - 监控消息流量
-//   - 分析消息类型分布
-//   - 开发阶段的消息跟踪
-func (c *WebSocketClient) logReceivedMessage(messageType int, message []byte) {
-	switch messageType {
-	case websocket.TextMessage:
-		// 文本消息：显示完整内容
-		log.Printf("📥 收到文本消息: %s", string(message))
-	case websocket.BinaryMessage:
-		// 二进制消息：只显示字节数，避免乱码
-		log.Printf("📥 收到二进制消息: %d 字节", len(message))
-	case websocket.PingMessage:
-		// Ping消息：仅在详细模式下显示
-		if c.config.VerbosePing {
-			log.Printf("📡 收到ping消息")
+//	for _, result := range pool.Broadcast(websocket.TextMessage, []byte(`{"op":"reload"}`), nil) {
+//		if result.Err != nil {
+//			log.Printf("%s: %v", result.Member, result.Err)
+//		}
+//	}
+func (p *ClientPool) Broadcast(messageType int, data []byte, filter func(name string, client *WebSocketClient) bool) []BroadcastResult {
+	p.mu.Lock()
+	members := make([]*poolMember, 0, len(p.members))
+	for _, member := range p.members {
+		if filter == nil || filter(member.name, member.client) {
+			members = append(members, member)
 		}
-	case websocket.PongMessage:
-		// Pong消息：仅在详细模式下显示
-		if c.config.VerbosePing {
-			log.Printf("📡 收到pong消息")
+	}
+	p.mu.Unlock()
+
+	results := make([]BroadcastResult, len(members))
+	var wg sync.WaitGroup
+	for i, member := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = BroadcastResult{Member: member.name, Err: member.client.SendMessage(messageType, data)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// route 用平滑加权轮询选出本次发送的首选成员，返回按尝试顺序排列的已连接成员
+func (p *ClientPool) route() []*poolMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	connected := make([]*poolMember, 0, len(p.members))
+	total := 0
+	var best *poolMember
+	for _, member := range p.members {
+		if member.client.GetState() != StateConnected {
+			continue
+		}
+		connected = append(connected, member)
+		member.current += member.weight
+		total += member.weight
+		if best == nil || member.current > best.current {
+			best = member
 		}
-	default:
-		// 其他类型消息：显示类型编号
-		log.Printf("📥 收到其他类型消息: %d", messageType)
 	}
+	if best == nil {
+		return nil
+	}
+	best.current -= total
+
+	// 首选成员放在最前，其余成员保持原有顺序作为备选
+	order := []*poolMember{best}
+	for _, member := range connected {
+		if member != best {
+			order = append(order, member)
+		}
+	}
+	return order
 }
 
-// isNetworkError 检查给定的错误是否可能是常见的网络相关错误
-// 极致优化版本：使用高效的错误检查策略，避免字符串操作
-//
-// 参数说明：
-//   - err: 需要检查的错误对象
-//
-// 返回值：
-//   - bool: true表示是网络错误，false表示不是
-//
-// 检查策略（按性能优先级排序）：
-//  1. 快速路径：直接比较系统调用错误常量（最高效）
-//  2. 中等路径：类型断言检查网络操作错误
-//  3. DNS错误：检查DNS相关的错误类型
-//  4. 字符串匹配：最后的兜底检查（性能最低）
-//
-// 支持的网络错误类型：
-//   - 系统调用错误：ECONNREFUSED、ECONNRESET、ETIMEDOUT等
-//   - 网络操作错误：超时、网络不可达等
-//   - DNS错误：域名解析失败、DNS超时
-//   - 字符串模式：常见的网络错误消息
-//
-// 性能优化：
-//   - 优先使用类型检查，避免字符串操作
-//   - 递归检查嵌套错误的内部错误
-//   - 使用预编译的错误模式数组
-//
-// 使用场景：
-//   - 区分网络错误和其他类型错误
-//   - 实现智能重试策略
-//   - 错误分类和统计
-//   - 日志记录和问题诊断
-func isNetworkError(err error) bool {
-	// 第一步：空值检查
-	if err == nil {
-		return false
+// PoolMemberStats 池中一个成员（分片）的统计
+type PoolMemberStats struct {
+	Name             string        `json:"name"`              // 成员名称
+	Shard            string        `json:"shard,omitempty"`   // AddShards分配的分片，Add加入的成员为空
+	State            string        `json:"state"`             // 连接状态
+	MessagesReceived int64         `json:"messages_received"` // 收到的消息数
+	MessagesSent     int64         `json:"messages_sent"`     // 发送的消息数
+	Lag              time.Duration `json:"lag"`               // 接收延迟：距最后一次收到消息的时长，本次连接尚未收到消息时从连接建立算起，从未连接过时为0
+	Backlog          int           `json:"backlog"`           // 入站队列中尚未分发的消息数，未启用--inbound-queue时为0
+	SequenceMissing  int64         `json:"sequence_missing"`  // 序列号跳跃中缺失的消息数，未配置--seq-path时为0
+	Routed           int64         `json:"routed"`            // 经由池路由并发送成功的消息数
+	RouteFailures    int64         `json:"route_failures"`    // 经由池路由但发送失败的次数
+}
+
+// PoolStats 客户端池的汇总统计
+// 汇总值是所有成员的合计，MaxLag是最落后的成员的接收延迟
+type PoolStats struct {
+	Members          int               `json:"members"`           // 成员数
+	Connected        int               `json:"connected"`         // 已连接的成员数
+	MessagesReceived int64             `json:"messages_received"` // 所有成员收到的消息数
+	MessagesSent     int64             `json:"messages_sent"`     // 所有成员发送的消息数
+	MaxLag           time.Duration     `json:"max_lag"`           // 成员中最大的接收延迟
+	Backlog          int               `json:"backlog"`           // 所有成员入站队列中尚未分发的消息数
+	SequenceMissing  int64             `json:"sequence_missing"`  // 所有成员序列号跳跃中缺失的消息数
+	PerMember        []PoolMemberStats `json:"per_member"`        // 每个成员的统计，顺序与加入顺序一致
+}
+
+// Stats 返回池的汇总统计和每个成员（分片）的统计
+func (p *ClientPool) Stats() PoolStats {
+	p.mu.Lock()
+	members := slices.Clone(p.members)
+	p.mu.Unlock()
+
+	stats := PoolStats{Members: len(members), PerMember: make([]PoolMemberStats, 0, len(members))}
+	for _, member := range members {
+		clientStats := member.client.GetStats()
+		state := member.client.GetState()
+		memberStats := PoolMemberStats{
+			Name:             member.name,
+			Shard:            member.shard,
+			State:            state.String(),
+			MessagesReceived: clientStats.MessagesReceived,
+			MessagesSent:     clientStats.MessagesSent,
+			Lag:              member.client.receiveLag(),
+			Backlog:          clientStats.InboundQueue.Depth,
+			SequenceMissing:  clientStats.Sequence.Missing,
+			Routed:           atomic.LoadInt64(&member.routed),
+			RouteFailures:    atomic.LoadInt64(&member.failures),
+		}
+		if state == StateConnected {
+			stats.Connected++
+		}
+		stats.MessagesReceived += memberStats.MessagesReceived
+		stats.MessagesSent += memberStats.MessagesSent
+		stats.MaxLag = max(stats.MaxLag, memberStats.Lag)
+		stats.Backlog += memberStats.Backlog
+		stats.SequenceMissing += memberStats.SequenceMissing
+		stats.PerMember = append(stats.PerMember, memberStats)
 	}
+	return stats
+}
 
-	// 第二步：快速路径 - 检查常见的系统调用错误（最高效）
-	switch err {
-	case syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ETIMEDOUT,
-		syscall.ENETUNREACH, syscall.EHOSTUNREACH, io.EOF, io.ErrUnexpectedEOF:
-		return true
+// receiveLag 返回距最后一次收到消息的时长，本次连接尚未收到消息时从连接建立算起，从未连接过时为0
+// 与--ready-max-silence的静默时长算法一致；断开期间继续增长，反映分片停止被消费的时间
+func (c *WebSocketClient) receiveLag() time.Duration {
+	c.mu.RLock()
+	since := c.lastReceiveTime
+	if since.Before(c.Stats.ConnectTime) {
+		since = c.Stats.ConnectTime
+	}
+	c.mu.RUnlock()
+	if since.IsZero() {
+		return 0
+	}
+	return time.Since(since)
+}
+
+// MetricsHandler 返回导出所有成员指标的HTTP处理器
+// 每个成员的样本带上pool_member标签（以及成员自己的--label常量标签），同名指标族合并输出，
+// 另外附加池级别的成员数、路由计数和接收延迟指标
+func (p *ClientPool) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(p.metricsText()) // 客户端断开时写入失败，无需处理
+	})
+}
+
+// metricsText 生成合并后的Prometheus文本
+func (p *ClientPool) metricsText() []byte {
+	p.mu.Lock()
+	members := slices.Clone(p.members)
+	p.mu.Unlock()
+
+	texts := make([][]byte, 0, len(members)+1)
+	var connected int
+	var own bytes.Buffer
+	fmt.Fprintf(&own, "# HELP websocket_pool_routed_total Messages sent through the pool by member\n")
+	fmt.Fprintf(&own, "# TYPE websocket_pool_routed_total counter\n")
+	for _, member := range members {
+		fmt.Fprintf(&own, "websocket_pool_routed_total{%s=%q} %d\n", PoolMemberLabel, member.name, atomic.LoadInt64(&member.routed))
+	}
+	fmt.Fprintf(&own, "# HELP websocket_pool_route_failures_total Sends through the pool that failed on a member\n")
+	fmt.Fprintf(&own, "# TYPE websocket_pool_route_failures_total counter\n")
+	for _, member := range members {
+		fmt.Fprintf(&own, "websocket_pool_route_failures_total{%s=%q} %d\n", PoolMemberLabel, member.name, atomic.LoadInt64(&member.failures))
 	}
+	fmt.Fprintf(&own, "# HELP websocket_pool_member_lag_seconds Seconds since the member last received a message\n")
+	fmt.Fprintf(&own, "# TYPE websocket_pool_member_lag_seconds gauge\n")
+	for _, member := range members {
+		fmt.Fprintf(&own, "websocket_pool_member_lag_seconds{%s=%q} %.3f\n", PoolMemberLabel, member.name, member.client.receiveLag().Seconds())
+	}
+
+	for _, member := range members {
+		if member.client.GetState() == StateConnected {
+			connected++
+		}
+		labels := maps.Clone(member.client.config.Labels)
+		if labels == nil {
+			labels = make(map[string]string, 1)
+		}
+		labels[PoolMemberLabel] = member.name
+
+		var buf bytes.Buffer
+		member.client.writeMetrics(&buf)
+		texts = append(texts, addConstantLabels(buf.Bytes(), labels))
+	}
+
+	fmt.Fprintf(&own, "# HELP websocket_pool_members Number of clients in the pool\n")
+	fmt.Fprintf(&own, "# TYPE websocket_pool_members gauge\n")
+	fmt.Fprintf(&own, "websocket_pool_members %d\n", len(members))
+	fmt.Fprintf(&own, "# HELP websocket_pool_members_connected Number of pool clients currently connected\n")
+	fmt.Fprintf(&own, "# TYPE websocket_pool_members_connected gauge\n")
+	fmt.Fprintf(&own, "websocket_pool_members_connected %d\n", connected)
+	texts = append(texts, own.Bytes())
+
+	return mergeMetricFamilies(texts...)
+}
 
-	// 第三步：中等路径 - 检查网络操作错误
-	if netErr, ok := err.(*net.OpError); ok {
-		if netErr.Timeout() {
-			return true
+// mergeMetricFamilies 合并多段Prometheus文本格式的指标
+// 文本格式要求同一指标族的样本连续出现且HELP/TYPE只出现一次，因此按指标族归并所有样本，
+// 指标族按首次出现的顺序输出
+func mergeMetricFamilies(texts ...[]byte) []byte {
+	type family struct {
+		help, kind string
+		samples    []string
+	}
+	families := make(map[string]*family)
+	var order []string
+	lookup := func(name string) *family {
+		f, ok := families[name]
+		if !ok {
+			f = &family{}
+			families[name] = f
+			order = append(order, name)
 		}
-		// 递归检查内部错误
-		return isNetworkError(netErr.Err)
+		return f
 	}
 
-	// 第四步：检查DNS错误
-	if dnsErr, ok := err.(*net.DNSError); ok {
-		return dnsErr.IsNotFound || dnsErr.IsTimeout
+	for _, text := range texts {
+		current := ""
+		for line := range strings.Lines(string(text)) {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if fields := strings.Fields(line); len(fields) >= 3 && fields[0] == "#" && (fields[1] == "HELP" || fields[1] == "TYPE") {
+				current = fields[2]
+				f := lookup(current)
+				if fields[1] == "HELP" && f.help == "" {
+					f.help = line
+				} else if fields[1] == "TYPE" && f.kind == "" {
+					f.kind = line
+				}
+				continue
+			}
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			// 样本属于最近声明的指标族，直方图等族的样本名带有后缀；不属于时以样本名作为族名
+			name := line[:max(strings.IndexAny(line, "{ "), 0)]
+			if current == "" || !strings.HasPrefix(name, current) {
+				current = name
+			}
+			f := lookup(current)
+			f.samples = append(f.samples, line)
+		}
 	}
 
-	// 第五步：最后的字符串检查（性能最低，但覆盖面广）
-	// 使用预编译的错误模式避免重复的字符串操作
-	errStr := err.Error()
-	return containsNetworkErrorPattern(errStr)
+	var out bytes.Buffer
+	for _, name := range order {
+		f := families[name]
+		out.WriteString(f.help)
+		out.WriteString(f.kind)
+		for _, sample := range f.samples {
+			out.WriteString(sample)
+		}
+	}
+	return out.Bytes()
 }
 
-// containsNetworkErrorPattern 检查错误字符串是否包含网络错误模式
-// 使用高效的字符串匹配，避免多次调用strings.Contains
+// ===== 分片连接 =====
+
+// ShardMessageFormat 分片连接未指定--message-format时的消息显示模板，在每条消息前标出分片名称
+const ShardMessageFormat = `[{{.Member}}] {{if eq .Direction "RECV"}}←{{else}}→{{end}} {{.Payload}}`
+
+// runShards 执行分片连接：--shard列出的每个分片建立一条连接，由ClientPool统一启动、停止和汇总统计
 //
 // 参数说明：
-//   - errStr: 错误消息字符串
+//   - config: 客户端配置，各分片共用，只有URL不同
 //
 // 返回值：
-//   - bool: true表示包含网络错误模式，false表示不包含
-//
-// 错误模式：
-//   - 按出现频率排序，提高匹配效率
-//   - 涵盖常见的网络错误消息
-//   - 支持多种语言和库的错误格式
-//
-// 性能优化：
-//   - 使用数组而不是切片，避免堆分配
-//   - 单次遍历检查所有模式
-//   - 按频率排序，提高早期匹配概率
-//
-// 支持的错误模式：
-//   - "connection refused": 连接被拒绝
-//   - "i/o timeout": I/O操作超时
-//   - "broken pipe": 管道断开
-//   - "network is unreachable": 网络不可达
-//   - "no such host": 主机不存在
-//   - "unexpected EOF": 意外的文件结束
-//   - "connection reset": 连接被重置
-//   - "host is down": 主机宕机
-//   - "network down": 网络断开
-//   - "protocol error": 协议错误
+//   - int: 进程退出码，创建连接失败时为1，否则为0
 //
-// 使用场景：
-//   - isNetworkError的字符串匹配后备方案
-//   - 处理第三方库的自定义错误消息
-//   - 支持多种错误格式的兼容性
-func containsNetworkErrorPattern(errStr string) bool {
-	// 预定义的网络错误模式（按出现频率排序）
-	patterns := [...]string{
-		"connection refused",     // 最常见：连接被拒绝
-		"i/o timeout",            // 常见：I/O超时
-		"broken pipe",            // 常见：管道断开
-		"network is unreachable", // 网络不可达
-		"no such host",           // DNS解析失败
-		"unexpected EOF",         // 意外的文件结束
-		"connection reset",       // 连接被重置
-		"host is down",           // 主机宕机
-		"network down",           // 网络断开
-		"protocol error",         // 协议错误
+// 注意事项：
+//   - 设置--shard-param时每个分片是URL上该查询参数的一个取值，否则命令行URL和每个--shard地址各是一条连接
+//   - 未指定--message-format时按ShardMessageFormat显示消息，便于区分来自哪个分片
+//   - 自动回复规则、JSON Schema、载荷压缩和端到端加密对每个分片分别生效
+//   - 交互模式的输入由第一条连接发送，/broadcast命令通过ClientPool.Broadcast发送给所有分片
+//   - 启用--metrics时在指标端口提供合并后的/metrics和分片汇总统计/stats
+//   - 收到中断信号或所有连接都自动退出后停止，退出前输出每个分片的消息数和接收延迟
+func runShards(config *ClientConfig) int {
+	shards := config.Shards
+	if config.ShardParam == "" {
+		shards = append([]string{config.URL}, shards...)
+	}
+	if config.MessageFormat == "" {
+		config.MessageFormat = ShardMessageFormat
 	}
 
-	// 使用单次遍历检查所有模式
-	for _, pattern := range patterns {
-		if strings.Contains(errStr, pattern) {
-			return true
+	pool := NewClientPool()
+	clients, err := pool.AddShards(config, shards, config.ShardParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	for _, client := range clients {
+		if err := setupClientFeatures(client, config); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ %v\n", err)
+			return 1
 		}
 	}
-	return false
+	fmt.Printf("🧩 分片连接: %d 个分片\n", len(clients))
+
+	var metricsServer *http.Server
+	if config.MetricsEnabled && config.MetricsPort > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", pool.MetricsHandler())
+		mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, pool.Stats())
+		})
+		metricsServer = &http.Server{
+			Addr:              fmt.Sprintf(":%d", config.MetricsPort),
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second, // 防止慢速攻击
+		}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf(tr("❌ 指标服务器启动失败: %v"), err)
+			}
+		}()
+		log.Printf(tr("📊 启动Prometheus指标服务器: http://localhost:%d/metrics"), config.MetricsPort)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	pool.Start()
+	if config.Interactive {
+		go clients[0].startInteractiveMode()
+	}
+
+	// 每个成员自动退出（最大运行时间、重试耗尽等）时取消自己的ctx，全部退出后结束
+	allDone := make(chan struct{})
+	go func() {
+		for _, client := range clients {
+			<-client.ctx.Done()
+		}
+		close(allDone)
+	}()
+	select {
+	case <-interrupt:
+		log.Print(tr("📋 收到中断信号，正在停止..."))
+	case <-allDone:
+		log.Print(tr("📋 客户端已自动退出"))
+	}
+
+	pool.Stop()
+	clients[0].restoreConsole()
+	if metricsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Printf(tr("⚠️ 关闭指标服务器失败: %v"), err)
+		}
+	}
+	printPoolStats(pool.Stats())
+	return 0
 }
 
-// --- parseArgs 辅助函数定义开始 ---
+// printPoolStats 输出客户端池的汇总统计和每个分片的消息数与接收延迟
+func printPoolStats(stats PoolStats) {
+	fmt.Printf("📋 分片汇总: %d/%d 已连接，收到 %d 条，发送 %d 条，最大接收延迟 %v\n",
+		stats.Connected, stats.Members, stats.MessagesReceived, stats.MessagesSent, stats.MaxLag.Round(time.Millisecond))
+	for _, member := range stats.PerMember {
+		fmt.Printf("  %s (%s): %s，收到 %d 条，发送 %d 条，接收延迟 %v",
+			member.Name, member.Shard, member.State, member.MessagesReceived, member.MessagesSent, member.Lag.Round(time.Millisecond))
+		if member.SequenceMissing > 0 {
+			fmt.Printf("，序列号缺失 %d", member.SequenceMissing)
+		}
+		fmt.Println()
+	}
+}
 
-// parseRetryCountArg 解析 -r 参数（重试次数）
-// 这个函数解析命令行中的重试次数参数，支持智能重试策略配置
-//
-// 参数说明：
-//   - args: 完整的命令行参数列表
-//   - currentIndex: 当前正在处理的 -r 参数的索引位置
-//   - config: 客户端配置对象，用于存储解析结果
-//
-// 返回值：
-//   - int: 更新后的参数索引（成功时跳过值参数）
-//   - error: 解析失败时的错误信息
-//
-// 参数验证：
-//  1. 检查是否有下一个参数作为值
-//  2. 验证值是否为非负整数
-//  3. 设置配置并更新索引
+// ===== JSON便捷接口 =====
+
+// jsonHandler OnJSON注册的一个处理器
+type jsonHandler struct {
+	handle func(data []byte) error // 解码并调用用户处理函数，解码失败返回解码错误
+}
+
+// SendJSON 把v编码为JSON并作为文本消息发送
 //
-// 重试策略：
-//   - 0: 5次快速重试 + 无限慢速重试
-//   - N: N次快速重试 + N次慢速重试
+// Example:
 //
-// 错误处理：
-//   - 缺少值：提示需要指定重试次数
-//   - 无效值：提示必须是非负整数
-//   - 返回详细的错误信息便于用户理解
-func parseRetryCountArg(args []string, currentIndex int, config *ClientConfig) (int, error) {
-	// 第一步：检查是否有下一个参数作为值
-	if currentIndex+1 < len(args) {
-		valStr := args[currentIndex+1]
-
-		// 第二步：验证并解析重试次数
-		if val, err := strconv.Atoi(valStr); err == nil && val >= 0 {
-			config.MaxRetries = val
-			return currentIndex + 1, nil // 成功解析，跳过下一个参数（值）
-		} else {
-			return currentIndex, fmt.Errorf("⚠️ -r 参数值 '%s' 必须是非负整数", valStr)
-		}
-	} else {
-		return currentIndex, fmt.Errorf("⚠️ -r 参数需要指定重试次数")
+//	err := client.SendJSON(map[string]any{"op": "subscribe", "channel": "trades"})
+func (c *WebSocketClient) SendJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf(tr("JSON编码失败: %w"), err)
+	}
+	return c.SendMessage(websocket.TextMessage, data)
+}
+
+// SendJSONContext 把v编码为JSON并以ctx限制本次发送，参见SendMessageContext
+func (c *WebSocketClient) SendJSONContext(ctx context.Context, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf(tr("JSON编码失败: %w"), err)
 	}
+	return c.SendMessageContext(ctx, websocket.TextMessage, data)
 }
 
-// parseRetryDelayArg 解析 -t 参数（重试间隔）
-// 这个函数解析命令行中的重试间隔参数，配置慢速重试的等待时间
+// OnJSON 注册收到文本消息时按JSON解码为T的处理器
+// 可以为不同的消息类型注册多个处理器，每条文本消息会依次交给所有处理器
 //
 // 参数说明：
-//   - args: 完整的命令行参数列表
-//   - currentIndex: 当前正在处理的 -t 参数的索引位置
-//   - config: 客户端配置对象，用于存储解析结果
+//   - c: 客户端（Go的方法不支持类型参数，因此以函数形式提供）
+//   - handler: 处理函数，参数为解码后的消息
 //
 // 返回值：
-//   - int: 更新后的参数索引（成功时跳过值参数）
-//   - error: 解析失败时的错误信息
+//   - func(): 取消注册的函数，可以重复调用
 //
-// 参数验证：
-//  1. 检查是否有下一个参数作为值
-//  2. 验证值是否为正整数（秒）
-//  3. 转换为time.Duration并设置配置
+// 错误处理：
+//   - 解码失败和handler返回的错误都记录日志并计入错误统计（ErrCodeInvalidMessage），
+//     同时交给SetEventHandlers设置的onError回调
+//   - 与T的字段无关的JSON消息也会被解码为零值字段的T，需要按字段区分消息类型时请在handler中判断
 //
-// 时间单位：
-//   - 输入值以秒为单位
-//   - 内部转换为time.Duration类型
-//   - 支持1-3600秒的合理范围
+// Example:
 //
-// 错误处理：
-//   - 缺少值：提示需要指定重试间隔
-//   - 无效值：提示必须是正整数
-//   - 提供用户友好的错误信息
-func parseRetryDelayArg(args []string, currentIndex int, config *ClientConfig) (int, error) {
-	// 第一步：检查是否有下一个参数作为值
-	if currentIndex+1 < len(args) {
-		valStr := args[currentIndex+1]
-
-		// 第二步：验证并解析重试间隔
-		if val, err := strconv.Atoi(valStr); err == nil && val > 0 {
-			config.RetryDelay = time.Duration(val) * time.Second
-			return currentIndex + 1, nil // 成功解析，跳过下一个参数（值）
-		} else {
-			return currentIndex, fmt.Errorf("⚠️ -t 参数值 '%s' 必须是正整数", valStr)
+//	type Trade struct {
+//		Symbol string  `json:"symbol"`
+//		Price  float64 `json:"price"`
+//	}
+//	cancel := OnJSON(client, func(t Trade) error {
+//		log.Printf("%s %.2f", t.Symbol, t.Price)
+//		return nil
+//	})
+//	defer cancel()
+func OnJSON[T any](c *WebSocketClient, handler func(T) error) func() {
+	h := &jsonHandler{handle: func(data []byte) error {
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf(tr("JSON解码为%T失败: %w"), v, err)
 		}
-	} else {
-		return currentIndex, fmt.Errorf("⚠️ -t 参数需要指定重试间隔")
+		return handler(v)
+	}}
+
+	c.mu.Lock()
+	c.jsonHandlers = append(c.jsonHandlers, h)
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.jsonHandlers = slices.DeleteFunc(slices.Clone(c.jsonHandlers), func(other *jsonHandler) bool { return other == h })
 	}
 }
 
-// --- parseArgs 辅助函数定义结束 ---
+// dispatchJSONHandlers 把文本消息交给OnJSON注册的处理器
+func (c *WebSocketClient) dispatchJSONHandlers(messageType int, message []byte) {
+	c.mu.RLock()
+	handlers := c.jsonHandlers
+	onError := c.onError
+	c.mu.RUnlock()
+	if len(handlers) == 0 || messageType != websocket.TextMessage {
+		return
+	}
 
-// parseArgs 解析命令行参数以创建 ClientConfig
-// 这是命令行参数解析的主入口函数，负责完整的参数处理流程
+	for _, h := range handlers {
+		if err := h.handle(message); err != nil {
+			jsonErr := &ConnectionError{
+				Code:  ErrCodeInvalidMessage,
+				Op:    "receive",
+				URL:   c.config.URL,
+				Err:   err,
+				Retry: false,
+			}
+			log.Printf(tr("❌ JSON消息处理器错误: %v"), err)
+			c.recordError(jsonErr)
+			if onError != nil {
+				onError(jsonErr)
+			}
+		}
+	}
+}
+
+// ===== 请求响应关联 =====
+
+// ResponseMatcher 判断收到的消息是否为等待中的响应
+// 可以直接传入自定义函数，也可以使用MatchRegex、MatchJSONPath构造
+type ResponseMatcher func(messageType int, data []byte) bool
+
+// responseWaiter 一个等待响应的SendAndWait调用
+type responseWaiter struct {
+	match    ResponseMatcher
+	response chan []byte // 容量为1，匹配到的响应只投递一次
+}
+
+// MatchRegex 构造按正则表达式匹配文本消息的ResponseMatcher
 //
 // 返回值：
-//   - *ClientConfig: 解析后的客户端配置对象
-//   - bool: 是否跳过证书警告（-n参数）
-//   - error: 解析过程中的错误信息
+//   - ResponseMatcher: 文本消息包含匹配的子串时返回true
+//   - error: 正则表达式无效时的错误信息
+func MatchRegex(pattern string) (ResponseMatcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf(tr("正则表达式错误: %w"), err)
+	}
+	return func(messageType int, data []byte) bool {
+		return messageType == websocket.TextMessage && re.Match(data)
+	}, nil
+}
+
+// MatchJSONPath 构造按JSON路径匹配文本消息的ResponseMatcher，路径语法与自动回复规则相同
+// 数字按原始文本比较，超过2^53的请求ID也能准确匹配
 //
-// 解析流程：
-//  1. 检查参数数量的基本要求
-//  2. 创建默认配置作为基础
-//  3. 解析所有命令行标志和选项
-//  4. 处理WebSocket URL参数
-//  5. 验证最终配置的有效性
+// 参数说明：
+//   - path: JSON路径（如 id、result.request_id、$.id）
+//   - equals: 路径取值需要等于的内容，为空时只要求路径存在
 //
-// 参数分类：
-//   - 信息类：-h, --help, --version, --build-info
-//   - 连接类：URL, -n（跳过证书验证）
-//   - 重试类：-r（重试次数）, -t（重试间隔）
-//   - 日志类：-v（详细模式）, -l（日志文件）
-//   - 交互类：-i（交互模式）
-//   - 监控类：--metrics, --metrics-port, --health-port
+// Example:
 //
-// 错误处理：
-//   - 参数不足：显示使用说明
-//   - 标志解析失败：返回具体错误
-//   - URL处理失败：返回URL相关错误
-//   - 配置验证失败：返回验证错误
+//	resp, err := client.SendAndWait(websocket.TextMessage, []byte(`{"id":42,"op":"get"}`), MatchJSONPath("id", "42"), 5*time.Second)
+func MatchJSONPath(path, equals string) ResponseMatcher {
+	return func(messageType int, data []byte) bool {
+		if messageType != websocket.TextMessage {
+			return false
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var parsed any
+		if decoder.Decode(&parsed) != nil {
+			return false
+		}
+		value, ok := lookupJSONPath(parsed, path)
+		return ok && (equals == "" || fmt.Sprint(value) == equals)
+	}
+}
+
+// SendAndWait 发送消息并等待第一条匹配的响应
+// 等待开始于发送之前，响应来得再快也不会错过
 //
-// 使用示例：
+// 参数说明：
+//   - messageType: 请求的消息类型
+//   - payload: 请求内容
+//   - match: 判断响应的函数，在接收路径上调用，应快速返回
+//   - timeout: 发送和等待的总时长上限
 //
-//	config, skipWarning, err := parseArgs()
-//	if err != nil {
-//	    log.Fatal(err)
-//	}
-func parseArgs() (*ClientConfig, bool, error) {
-	// 第一步：检查基本参数要求
-	if len(os.Args) < 2 {
-		showUsage()
-		return nil, false, fmt.Errorf("参数不足，请提供WebSocket URL")
-	}
+// 返回值：
+//   - []byte: 响应内容（副本，可以长期保留）
+//   - error: 发送失败、超时或客户端停止时的错误信息；请求已保留在发送日志中等待重发时
+//     立即返回ErrQueued，不再等待响应
+//
+// 并发安全：多个goroutine可以同时调用；一条响应只交给最早开始等待且匹配的调用，
+// 因此多个调用使用相同的匹配条件时按先后顺序各自取得一条响应。响应照常经过显示、回调等正常处理流程
+func (c *WebSocketClient) SendAndWait(messageType int, payload []byte, match ResponseMatcher, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.SendAndWaitContext(ctx, messageType, payload, match)
+}
 
-	// 第二步：创建默认配置
-	config := NewDefaultConfig("")
-	var skipCertWarning bool
-	var remainingArgs []string
+// SendAndWaitContext 与SendAndWait相同，以ctx代替超时时长
+func (c *WebSocketClient) SendAndWaitContext(ctx context.Context, messageType int, payload []byte, match ResponseMatcher) ([]byte, error) {
+	waiter := &responseWaiter{match: match, response: make(chan []byte, 1)}
+	c.waitersMu.Lock()
+	c.responseWaiters = append(c.responseWaiters, waiter)
+	c.waitersMu.Unlock()
+	defer c.removeResponseWaiter(waiter)
 
-	// 第三步：解析命令行标志
-	if err := parseFlags(config, &skipCertWarning, &remainingArgs); err != nil {
-		return nil, false, err
+	if err := c.SendMessageContext(ctx, messageType, payload); err != nil {
+		return nil, err
 	}
 
-	// 第四步：处理URL参数
-	if err := processURLArg(config, remainingArgs); err != nil {
-		return nil, false, err
+	select {
+	case response := <-waiter.response:
+		return response, nil
+	case <-ctx.Done():
+		// 响应可能恰好与超时同时到达
+		select {
+		case response := <-waiter.response:
+			return response, nil
+		default:
+		}
+		return nil, &ConnectionError{
+			Code:  ErrCodeReceiveTimeout,
+			Op:    "wait_response",
+			URL:   c.config.URL,
+			Err:   fmt.Errorf("%w: %w", ErrReadTimeout, ctx.Err()),
+			Retry: true,
+		}
+	case <-c.ctx.Done():
+		return nil, &ConnectionError{
+			Code:  ErrCodeConnectionLost,
+			Op:    "wait_response",
+			URL:   c.config.URL,
+			Err:   ErrConnectionClosed,
+			Retry: false,
+		}
 	}
+}
 
-	// 第五步：验证配置
-	if err := config.Validate(); err != nil {
-		return nil, false, fmt.Errorf("配置验证失败: %w", err)
+// removeResponseWaiter 取消一个等待，已投递或已取消时什么也不做
+func (c *WebSocketClient) removeResponseWaiter(waiter *responseWaiter) {
+	c.waitersMu.Lock()
+	defer c.waitersMu.Unlock()
+	c.responseWaiters = slices.DeleteFunc(c.responseWaiters, func(other *responseWaiter) bool { return other == waiter })
+}
+
+// deliverResponse 把收到的消息交给最早开始等待且匹配的SendAndWait调用
+func (c *WebSocketClient) deliverResponse(messageType int, message []byte) {
+	if !isDataMessage(messageType) {
+		return
+	}
+	c.waitersMu.Lock()
+	defer c.waitersMu.Unlock()
+	for i, waiter := range c.responseWaiters {
+		if waiter.match(messageType, message) {
+			waiter.response <- bytes.Clone(message)
+			c.responseWaiters = slices.Delete(c.responseWaiters, i, i+1)
+			return
+		}
 	}
+}
 
-	return config, skipCertWarning, nil
+// ===== 消息通道 =====
+
+// DefaultMessageChannelSize Messages()返回的通道的默认容量
+const DefaultMessageChannelSize = 256
+
+// Message 通过Messages()通道交付的一条接收消息
+type Message struct {
+	Type int       // 消息类型：websocket.TextMessage或websocket.BinaryMessage
+	Data []byte    // 消息内容（副本，可以长期保留）
+	Time time.Time // 接收时间
 }
 
-// parseFlags 解析命令行标志
-// 这个函数是命令行参数解析的核心，负责处理所有的标志和选项
+// Messages 返回接收消息的通道，容量为DefaultMessageChannelSize，通道满时阻塞消息分发
+// 是onMessage回调之外的另一种消费方式，调用方可以在select循环中按自己的并发模型处理消息
 //
-// 参数说明：
-//   - config: 客户端配置对象，用于存储解析结果
-//   - skipCertWarning: 指向布尔值的指针，用于设置是否跳过证书警告
-//   - remainingArgs: 指向字符串切片的指针，用于收集非标志参数
-//
-// 返回值：
-//   - error: 解析过程中的错误信息
-//
-// 支持的标志分类：
-//  1. 信息类标志：-h, --help, --version, --build-info, --health-check
-//  2. 连接类标志：-n（跳过证书验证）
-//  3. 日志类标志：-v（详细模式）, -l（日志文件）, --log-file
-//  4. 交互类标志：-i, --interactive（交互模式）
-//  5. 监控类标志：--metrics, --metrics-port, --health-port
-//  6. 重试类标志：-r（重试次数）, -t（重试间隔）
-//
-// 处理逻辑：
-//   - 信息类标志：立即执行相应功能并退出程序
-//   - 配置类标志：更新配置对象的相应字段
-//   - 带值标志：调用专门的解析函数处理
-//   - 未知标志：返回错误信息
-//   - 非标志参数：添加到remainingArgs中
+// 注意事项：
+//   - 客户端停止（Stop或自动退出）后通道被关闭，for range循环自然结束
+//   - 多次调用返回同一个通道；需要其他容量或背压策略时先调用MessagesWithOptions
+//   - 通道与onMessage回调、OnJSON处理器互不影响，每条消息都会交给所有消费方
 //
-// 错误处理：
-//   - 未知标志：返回详细的错误信息
-//   - 参数解析失败：传播子函数的错误
-//   - 提供用户友好的错误提示
+// Example:
 //
-// 并发安全：此函数在main函数中单线程调用，无需考虑并发安全
+//	for msg := range client.Messages() {
+//		log.Printf("收到 %d 字节", len(msg.Data))
+//	}
+func (c *WebSocketClient) Messages() <-chan Message {
+	ch, _ := c.MessagesWithOptions(DefaultMessageChannelSize, BackpressureBlock)
+	return ch
+}
 
-// handleInfoFlags 处理信息类标志（立即执行并退出）
-// 这些标志会立即显示信息并退出程序，不需要进一步处理
+// MessagesWithOptions 以指定容量和背压策略创建接收消息的通道
 //
 // 参数说明：
-//   - arg: 当前处理的命令行参数
+//   - capacity: 通道容量，必须为正数
+//   - policy: 通道满时的策略，与--backpressure相同：block（阻塞消息分发直到有空位）、
+//     drop-oldest（丢弃通道中最旧的消息）、drop-newest（丢弃新消息）
 //
 // 返回值：
-//   - bool: true表示已处理该标志，false表示不是信息类标志
-//
-// 支持的信息类标志：
-//   - -h, --help: 显示使用帮助
-//   - --version: 显示版本信息
-//   - --build-info: 显示详细构建信息
-//   - --health-check: 执行健康检查
-func handleInfoFlags(arg string) bool {
-	switch arg {
-	case "-h", "--help":
-		showUsage()
-		os.Exit(0)
-	case "--version":
-		showVersion()
-		os.Exit(0)
-	case "--build-info":
-		showBuildInfo()
-		os.Exit(0)
-	case "--health-check":
-		performHealthCheck()
-		os.Exit(0)
+//   - <-chan Message: 接收消息的通道；已经创建过时返回原有通道，参数不生效
+//   - error: 容量或策略无效时的错误信息
+func (c *WebSocketClient) MessagesWithOptions(capacity int, policy string) (<-chan Message, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf(tr("%w: 消息通道容量必须为正数"), ErrInvalidConfig)
+	}
+	switch policy {
+	case BackpressureBlock, BackpressureDropOldest, BackpressureDropNewest:
+	default:
+		return nil, fmt.Errorf(tr("%w: 背压策略 '%s' 无效，可选 block、drop-oldest、drop-newest"), ErrInvalidConfig, policy)
+	}
+
+	c.messageChMu.Lock()
+	defer c.messageChMu.Unlock()
+	if c.messageCh == nil {
+		c.messageCh = make(chan Message, capacity)
+		c.messageChPolicy = policy
+		if c.ctx.Err() != nil {
+			close(c.messageCh)
+			c.messageChClosed = true
+		} else {
+			context.AfterFunc(c.ctx, c.closeMessageChannel)
+		}
+	}
+	return c.messageCh, nil
+}
+
+// MessagesDropped 返回因消息通道已满而按背压策略丢弃的消息数
+func (c *WebSocketClient) MessagesDropped() int64 {
+	return atomic.LoadInt64(&c.messageChDropped)
+}
+
+// deliverToChannel 把收到的消息交给Messages()通道，未创建通道时什么也不做
+// 持有messageChMu读锁发送，关闭通道需要写锁，因此不会向已关闭的通道发送；
+// 阻塞策略下客户端停止时立即放弃发送，关闭方不会被一直阻塞
+func (c *WebSocketClient) deliverToChannel(messageType int, message []byte) {
+	if !isDataMessage(messageType) {
+		return
+	}
+	c.messageChMu.RLock()
+	defer c.messageChMu.RUnlock()
+	if c.messageCh == nil || c.messageChClosed {
+		return
+	}
+
+	msg := Message{Type: messageType, Data: bytes.Clone(message), Time: time.Now()}
+	switch c.messageChPolicy {
+	case BackpressureDropNewest:
+		select {
+		case c.messageCh <- msg:
+		default:
+			c.dropChannelMessage()
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case c.messageCh <- msg:
+				return
+			default:
+			}
+			// 通道已满：取出最旧的一条丢弃后重试（消费方可能已抢先取走）
+			select {
+			case <-c.messageCh:
+				c.dropChannelMessage()
+			default:
+			}
+		}
 	default:
-		return false
+		select {
+		case c.messageCh <- msg:
+		case <-c.ctx.Done():
+		}
 	}
-	return true
 }
 
-// handleBooleanFlags 处理简单布尔标志
-// 这些标志不需要额外的值，只是设置配置选项为true
-//
-// 参数说明：
-//   - arg: 当前处理的命令行参数
-//   - config: 客户端配置对象
-//   - skipCertWarning: TLS证书警告跳过标志
-//
-// 返回值：
-//   - bool: true表示已处理该标志，false表示不是布尔标志
-//
-// 支持的布尔标志：
-//   - -n: 跳过TLS证书验证警告
-//   - -f: 强制启用TLS证书验证
-//   - -d: 禁用自动ping功能
-//   - -v: 启用详细日志
-//   - -i, --interactive: 启用交互模式
-//   - --metrics: 启用指标收集
-func handleBooleanFlags(arg string, config *ClientConfig, skipCertWarning *bool) bool {
-	switch arg {
-	case "-n":
-		*skipCertWarning = true
-	case "-f":
-		config.ForceTLSVerify = true
-	case "-d":
-		config.DisableAutoPing = true
-	case "-v":
-		config.Verbose = true
-		config.VerbosePing = true
-	case "-i", "--interactive":
-		config.Interactive = true
-	case "--metrics":
-		config.MetricsEnabled = true
-	default:
-		return false
+// dropChannelMessage 记录一次消息通道丢弃，只在第一次丢弃时输出日志
+func (c *WebSocketClient) dropChannelMessage() {
+	if atomic.AddInt64(&c.messageChDropped, 1) == 1 {
+		log.Printf(tr("⚠️ 消息通道已满 (%d)，按 %s 策略丢弃消息 (后续丢弃只计数)"), cap(c.messageCh), c.messageChPolicy)
 	}
-	return true
 }
 
-// handleValueFlags 处理带值的标志
-// 这些标志需要额外的参数值，调用专门的解析函数处理
-//
-// 参数说明：
-//   - arg: 当前处理的命令行参数
-//   - currentIndex: 当前参数在os.Args中的索引
-//   - config: 客户端配置对象
-//
-// 返回值：
-//   - int: 更新后的参数索引
-//   - error: 解析失败时的错误信息
-//
-// 支持的带值标志：
-//   - -l: 日志文件（可选值）
-//   - --log-file: 日志文件路径（必需值）
-//   - --metrics-port: 指标服务端口
-//   - --health-port: 健康检查端口
-//   - -r: 重试次数
-//   - -t: 重试延迟
-func handleValueFlags(arg string, currentIndex int, config *ClientConfig) (int, error) {
-	switch arg {
-	case "-l":
-		return parseLogFileArg(os.Args, currentIndex, config), nil
-	case "--log-file":
-		return parseLogFilePathArg(os.Args, currentIndex, config)
-	case "--metrics-port":
-		newIndex, err := parsePortArg(os.Args, currentIndex, &config.MetricsPort, "metrics-port")
-		if err == nil {
-			config.MetricsEnabled = true // 自动启用metrics
-		}
-		return newIndex, err
-	case "--health-port":
-		return parsePortArg(os.Args, currentIndex, &config.HealthPort, "health-port")
-	case "-r":
-		return parseRetryCountArg(os.Args, currentIndex, config)
-	case "-t":
-		return parseRetryDelayArg(os.Args, currentIndex, config)
-	default:
-		return currentIndex, nil
+// closeMessageChannel 客户端停止时关闭消息通道
+func (c *WebSocketClient) closeMessageChannel() {
+	c.messageChMu.Lock()
+	defer c.messageChMu.Unlock()
+	if c.messageCh != nil && !c.messageChClosed {
+		close(c.messageCh)
+		c.messageChClosed = true
 	}
 }
 
-func parseFlags(config *ClientConfig, skipCertWarning *bool, remainingArgs *[]string) error {
-	// 遍历所有命令行参数（跳过程序名）
-	for i := 1; i < len(os.Args); i++ {
-		arg := os.Args[i]
+// ===== goroutine泄漏检测 =====
 
-		// 处理信息类标志（立即执行并退出）
-		if handled := handleInfoFlags(arg); handled {
-			continue
-		}
+// GoroutineLeakCheckInterval goroutine泄漏检查的间隔
+const GoroutineLeakCheckInterval = time.Minute
 
-		// 处理简单布尔标志
-		if handled := handleBooleanFlags(arg, config, skipCertWarning); handled {
-			continue
-		}
+// trackGoroutine 把当前goroutine登记为长期运行的goroutine
+// 返回取消登记的函数，调用方以defer c.trackGoroutine("名称")()的形式在退出时调用
+func (c *WebSocketClient) trackGoroutine(name string) func() {
+	id := c.goroutineTracker.TrackLongLived(name)
+	return func() { c.goroutineTracker.Untrack(id) }
+}
 
-		// 处理带值的标志
-		newIndex, err := handleValueFlags(arg, i, config)
-		if err != nil {
-			return err
-		}
-		if newIndex != i {
-			i = newIndex
-			continue
-		}
+// runGoroutineLeakCheck 周期性清理过期的跟踪记录并检查goroutine泄漏
+// 疑似泄漏数发生变化时记录日志，数量同时通过websocket_goroutine_leaks指标导出
+func (c *WebSocketClient) runGoroutineLeakCheck() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(GoroutineLeakCheckInterval)
+	defer ticker.Stop()
 
-		// 处理未知标志和非标志参数
-		if strings.HasPrefix(arg, "-") {
-			return fmt.Errorf("⚠️ 未知参数或标志: '%s'", arg)
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.goroutineTracker.Cleanup()
+			leaks := c.goroutineTracker.CheckLeaks()
+			previous := atomic.SwapInt64(&c.goroutineLeaks, int64(len(leaks)))
+			if int64(len(leaks)) == previous {
+				continue
+			}
+			for _, leak := range leaks {
+				log.Printf(tr("⚠️ 疑似goroutine泄漏: %s"), leak)
+			}
+			if len(leaks) == 0 {
+				log.Print(tr("✅ goroutine泄漏检查已恢复正常"))
+			}
 		}
-		*remainingArgs = append(*remainingArgs, arg)
 	}
-	return nil
 }
 
-// parseLogFileArg 解析 -l 参数
-// 这个函数处理简化的日志文件参数，支持可选的文件路径
-//
-// 参数说明：
-//   - args: 完整的命令行参数列表
-//   - currentIndex: 当前正在处理的 -l 参数的索引位置
-//   - config: 客户端配置对象，用于存储解析结果
-//
-// 返回值：
-//   - int: 更新后的参数索引
-//
-// 解析逻辑：
-//  1. 检查下一个参数是否存在且不是标志（不以-开头）
-//  2. 如果存在：使用该参数作为日志文件路径
-//  3. 如果不存在：设置为"auto"，自动生成文件名
-//
-// 自动文件名格式：
-//   - "auto"会在程序中生成类似"websocket_20240101_150405.log"的文件名
-//   - 包含时间戳，避免文件名冲突
-//
-// 使用示例：
-//   - "./wsc -l ws://example.com" -> 自动生成文件名
-//   - "./wsc -l mylog.txt ws://example.com" -> 使用指定文件名
-//
-// 注意事项：
-//   - 此函数不返回错误，总是成功
-//   - 支持灵活的参数使用方式
-func parseLogFileArg(args []string, currentIndex int, config *ClientConfig) int {
-	// 检查下一个参数是否存在且不是标志
-	if currentIndex+1 < len(args) && !strings.HasPrefix(args[currentIndex+1], "-") {
-		// 使用指定的文件路径
-		config.LogFile = args[currentIndex+1]
-		return currentIndex + 1 // 跳过文件路径参数
-	}
-	// 没有指定文件路径，使用自动生成
-	config.LogFile = "auto"
-	return currentIndex // 不跳过任何参数
-}
+// ===== 后台采样 =====
 
-// parseLogFilePathArg 解析 --log-file 参数
-// 这个函数处理完整的日志文件路径参数，要求必须提供文件路径
-//
-// 参数说明：
-//   - args: 完整的命令行参数列表
-//   - currentIndex: 当前正在处理的 --log-file 参数的索引位置
-//   - config: 客户端配置对象，用于存储解析结果
-//
-// 返回值：
-//   - int: 更新后的参数索引
-//   - error: 解析失败时的错误信息
-//
-// 解析逻辑：
-//  1. 检查下一个参数是否存在
-//  2. 如果存在：使用该参数作为日志文件路径
-//  3. 如果不存在：返回错误
-//
-// 与-l参数的区别：
-//   - --log-file 要求必须提供文件路径
-//   - -l 参数可以不提供文件路径（自动生成）
-//
-// 使用示例：
-//   - "./wsc --log-file /path/to/log.txt ws://example.com"
-//   - "./wsc --log-file ./logs/websocket.log ws://example.com"
-//
-// 错误情况：
-//   - 缺少文件路径：返回详细的错误信息
-func parseLogFilePathArg(args []string, currentIndex int, config *ClientConfig) (int, error) {
-	// 检查下一个参数是否存在
-	if currentIndex+1 < len(args) {
-		// 使用指定的文件路径
-		config.LogFile = args[currentIndex+1]
-		return currentIndex + 1, nil // 成功解析，跳过文件路径参数
-	}
-	// 缺少文件路径，返回错误
-	return currentIndex, fmt.Errorf("⚠️ --log-file 参数需要指定文件路径")
+// DefaultSampleInterval 后台采样的默认间隔
+const DefaultSampleInterval = 10 * time.Second
+
+// samplerState 上一次后台采样的结果，用于只在状态变化时记录日志
+type samplerState struct {
+	deadlocks int          // 潜在死锁数量
+	health    HealthStatus // 整体健康状态
 }
 
-// parsePortArg 解析端口参数
-// 这个函数处理各种端口相关的命令行参数，确保端口号的有效性
-//
-// 参数说明：
-//   - args: 完整的命令行参数列表
-//   - currentIndex: 当前正在处理的端口参数的索引位置
-//   - port: 指向整数的指针，用于存储解析后的端口号
-//   - argName: 参数名称，用于错误信息中的显示
-//
-// 返回值：
-//   - int: 更新后的参数索引
-//   - error: 解析失败时的错误信息
-//
-// 端口验证：
-//  1. 检查下一个参数是否存在
-//  2. 验证参数是否为有效整数
-//  3. 验证端口号范围（1-65535）
-//  4. 设置端口值并更新索引
-//
-// 端口范围说明：
-//   - 1-1023: 系统保留端口（需要管理员权限）
-//   - 1024-49151: 注册端口
-//   - 49152-65535: 动态/私有端口
-//
-// 使用示例：
-//   - "--metrics-port 9090"
-//   - "--health-port 8080"
-//
-// 错误处理：
-//   - 缺少端口号：提示需要指定端口号
-//   - 无效端口号：提示端口号范围要求
-//   - 使用参数名称提供具体的错误信息
-func parsePortArg(args []string, currentIndex int, port *int, argName string) (int, error) {
-	// 第一步：检查下一个参数是否存在
-	if currentIndex+1 < len(args) {
-		// 第二步：尝试解析端口号并验证范围
-		if p, err := strconv.Atoi(args[currentIndex+1]); err == nil && p > 0 && p <= 65535 {
-			*port = p
-			return currentIndex + 1, nil // 成功解析，跳过端口号参数
+// runBackgroundSampler 按SampleInterval周期性执行后台采样
+// 死锁检测器和性能监控器原本只在被显式调用时更新，由这个goroutine持续驱动
+func (c *WebSocketClient) runBackgroundSampler() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+	defer c.trackGoroutine("background-sampler")()
+
+	ticker := time.NewTicker(c.config.SampleInterval)
+	defer ticker.Stop()
+
+	var last samplerState
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			last = c.sampleOnce(last)
 		}
-		// 端口号无效
-		return currentIndex, fmt.Errorf("⚠️ --%s 参数值必须是有效端口号 (1-65535)", argName)
 	}
-	// 缺少端口号
-	return currentIndex, fmt.Errorf("⚠️ --%s 参数需要指定端口号", argName)
 }
 
-// processURLArg 处理URL参数
-// 这个函数验证和处理WebSocket URL参数，确保URL的有效性
+// sampleOnce 执行一次后台采样
 //
 // 参数说明：
-//   - config: 客户端配置对象，用于存储验证后的URL
-//   - remainingArgs: 解析标志后剩余的非标志参数列表
+//   - last: 上一次采样的结果
 //
 // 返回值：
-//   - error: 处理失败时的错误信息
-//
-// 验证逻辑：
-//  1. 检查是否提供了URL参数
-//  2. 检查是否只有一个URL参数
-//  3. 验证URL格式的有效性
-//  4. 设置配置中的URL字段
-//
-// URL格式要求：
-//   - 必须以"ws://"或"wss://"开头
-//   - ws://: 非加密WebSocket连接
-//   - wss://: 加密WebSocket连接（推荐）
+//   - samplerState: 本次采样的结果
 //
-// 错误处理：
-//   - 未提供URL：显示使用说明并返回错误
-//   - 多个URL：提示参数重复错误
-//   - 无效格式：提示URL格式要求
+// 采样内容：
+//  1. 死锁检查：潜在死锁数量变化时记录日志
+//  2. 系统指标：更新性能监控器的内存、goroutine和CPU指标
+//  3. 组件健康检查：更新HealthMetrics，整体状态变化时记录日志
 //
-// 使用示例：
-//   - 有效URL: "ws://localhost:8080/websocket"
-//   - 有效URL: "wss://api.example.com/ws"
-//   - 无效URL: "http://example.com" (不是WebSocket协议)
-func processURLArg(config *ClientConfig, remainingArgs []string) error {
-	// 第一步：检查是否提供了URL参数
-	if len(remainingArgs) == 0 {
-		showUsage()
-		return fmt.Errorf("未指定WebSocket URL")
-	}
+// 注意事项：
+//   - 单次采样中的panic被捕获并记录，采样goroutine继续按间隔运行
+func (c *WebSocketClient) sampleOnce(last samplerState) (next samplerState) {
+	next = last
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf(tr("❌ 后台采样出现panic: %v"), r)
+		}
+	}()
 
-	// 第二步：检查是否只有一个URL参数
-	if len(remainingArgs) > 1 {
-		return fmt.Errorf("⚠️ 参数过多或URL指定重复: '%s'", strings.Join(remainingArgs, " "))
+	// 第一步：死锁检查
+	deadlocks := c.deadlockDetector.CheckDeadlocks()
+	if len(deadlocks) != last.deadlocks {
+		for _, deadlock := range deadlocks {
+			log.Printf("🔒 %s", deadlock)
+		}
+		if len(deadlocks) == 0 {
+			log.Print(tr("✅ 潜在死锁已解除"))
+		}
 	}
+	next.deadlocks = len(deadlocks)
 
-	// 第三步：验证URL格式
-	urlArg := remainingArgs[0]
-	if !isValidWebSocketURL(urlArg) {
-		return fmt.Errorf("⚠️ 无效的WebSocket URL '%s'，必须以ws://或wss://开头", urlArg)
+	// 第二步：系统指标采样
+	c.performanceMonitor.SampleSystemMetrics()
+	c.performanceMonitor.UpdateMetrics(c.GetStats())
+
+	// 第三步：组件健康检查，首次采样为健康时不记录
+	status := c.healthChecker.CheckHealth(c.ctx)
+	if status != last.health && (last.health != HealthUnknown || status != HealthHealthy) {
+		components := c.healthChecker.GetHealthMetrics().ComponentStatus
+		var failing []string
+		for name, detail := range components {
+			if detail != "正常" {
+				failing = append(failing, name+": "+detail)
+			}
+		}
+		slices.Sort(failing)
+		if len(failing) > 0 {
+			log.Printf(tr("🩺 健康状态变化: %s -> %s (%s)"), last.health, status, strings.Join(failing, "; "))
+		} else {
+			log.Printf(tr("🩺 健康状态变化: %s -> %s"), last.health, status)
+		}
 	}
+	next.health = status
+	return next
+}
 
-	// 第四步：设置配置中的URL
-	config.URL = urlArg
-	return nil
+// ===== 自适应缓冲区 =====
+
+// 自适应缓冲区参数
+const (
+	AdaptiveBufferWindow       = 512 // 滚动窗口：按最近发送的这么多条消息统计大小分布
+	AdaptiveBufferEvalInterval = 64  // 每发送这么多条消息重新评估一次档位决策
+	AdaptiveBufferColdMissRate = 0.5 // 档位的未命中率超过该值时认为该档位的池是冷的（很少有可复用的缓冲区）
+)
+
+// bufferTierSizer 自适应缓冲区的档位选择器
+// 维护最近发送的消息大小的滚动窗口，并结合BufferPool各档位的命中情况决定是否把小消息提升到更大的档位
+//
+// 决策规则（每AdaptiveBufferEvalInterval条消息评估一次）：
+//   - 主导档位：窗口内90%的消息能放进的最小档位
+//   - 比主导档位小的某个档位未命中率超过AdaptiveBufferColdMissRate时，小消息改用主导档位的缓冲区，
+//     把缓冲区集中在一个常用的池里复用，避免在冷池中反复分配
+//   - 已经提升且主导档位未变时保持提升（提升后小档位不再有Get，不能据此判断恢复）
+//   - 内存压力下、主导档位变化后或小档位不再冷时恢复按消息大小选择
+//
+// 并发安全：使用互斥锁保护所有字段
+type bufferTierSizer struct {
+	mu   sync.Mutex
+	pool *BufferPool // 提供档位命中统计的缓冲区池
+
+	sizes     [AdaptiveBufferWindow]int // 最近消息大小的环形缓冲
+	next      int                       // 环形缓冲的下一个写入位置
+	count     int                       // 环形缓冲中的有效样本数
+	sinceEval int                       // 上次评估以来记录的消息数
+
+	tierSizes []int             // 上次评估时池的档位大小（升序），池增加档位后在下一次评估时更新
+	lastTiers []BufferTierStats // 上次评估时池的档位统计，用于计算区间内的未命中率
+	missRates map[int]float64   // 最近一个评估区间内各档位的未命中率（按档位大小）
+	promoteTo int               // 当前决策：不超过该大小的消息使用该大小的缓冲区，0表示按消息大小选择
+	decisions int64             // 决策变化次数
+	lastNote  string            // 最近一次决策变化的说明
 }
 
-// showVersion 显示版本号
-// 这个函数显示应用程序的简洁版本信息
-//
-// 输出格式：
-//   - "应用名称 v版本号"
-//   - 例如："wsc v1.0.0"
-//
-// 使用场景：
-//   - 用户使用--version参数查询版本
-//   - 脚本中检查程序版本
-//   - 快速确认程序版本信息
-//
-// 与showBuildInfo的区别：
-//   - showVersion: 只显示基本版本信息
-//   - showBuildInfo: 显示详细的构建和系统信息
-func showVersion() {
-	fmt.Printf("%s v%s\n", AppName, AppVersion)
+// newBufferTierSizer 创建档位选择器，初始按消息大小选择档位
+func newBufferTierSizer(pool *BufferPool) *bufferTierSizer {
+	s := &bufferTierSizer{
+		pool:      pool,
+		lastTiers: pool.TierStats(),
+		missRates: make(map[int]float64),
+	}
+	for _, tier := range s.lastTiers {
+		s.tierSizes = append(s.tierSizes, tier.Size)
+	}
+	return s
 }
 
-// formatBuildTime 格式化构建时间，支持多种时间格式
-// 这个函数将构建时间字符串转换为用户友好的本地时间格式
+// choose 记录一条消息的大小并返回应使用的缓冲区大小
 //
 // 参数说明：
-//   - buildTime: 构建时间字符串，可能来自不同的构建系统
+//   - messageSize: 消息字节数
+//   - pressure: 是否处于CPU或内存压力下，压力下不提升档位
 //
 // 返回值：
-//   - string: 格式化后的时间字符串，包含本地时间和时区信息
-//
-// 支持的输入格式：
-//  1. "2006-01-02 15:04:05 MST" - 新格式，包含时区
-//  2. "2006-01-02_15:04:05_MST" - 旧格式，下划线分隔
-//  3. "2006-01-02_15:04:05_UTC" - UTC格式
-//  4. "2006-01-02T15:04:05Z07:00" - ISO 8601格式
-//  5. "2006-01-02 15:04:05" - 简单格式，无时区
-//
-// 输出格式：
-//   - "2024-01-02 15:04:05 CST (UTC+08:00)"
-//   - 包含本地时间、时区名称和UTC偏移
-//
-// 处理逻辑：
-//  1. 检查特殊值（"unknown"或空字符串）
-//  2. 按优先级尝试解析不同格式
-//  3. 转换为本地时间并格式化
-//  4. 解析失败时返回原始字符串
-//
-// 时区处理：
-//   - 自动转换为系统本地时区
-//   - 显示时区名称和UTC偏移
-//   - 支持夏令时自动调整
-//
-// 使用场景：
-//   - showBuildInfo中显示构建时间
-//   - 日志记录中的时间格式化
-//   - 用户界面的时间显示
-func formatBuildTime(buildTime string) string {
-	// 第一步：处理特殊值
-	if buildTime == "unknown" || buildTime == "" {
-		return "unknown"
-	}
-
-	// 第二步：定义支持的时间格式（按常见程度排序）
-	formats := []string{
-		"2006-01-02 15:04:05 MST",   // 新格式：2024-01-02 15:04:05 CST
-		"2006-01-02_15:04:05_MST",   // 旧格式：2024-01-02_15:04:05_CST
-		"2006-01-02_15:04:05_UTC",   // UTC格式：2024-01-02_15:04:05_UTC
-		"2006-01-02T15:04:05Z07:00", // ISO格式：2024-01-02T15:04:05+08:00
-		"2006-01-02 15:04:05",       // 简单格式：2024-01-02 15:04:05
+//   - int: 缓冲区大小；超过最大档位的消息返回messageSize
+func (s *bufferTierSizer) choose(messageSize int, pressure bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.observe(messageSize)
+	if pressure && s.promoteTo > 0 {
+		s.decide(0, "内存或CPU压力，按消息大小选择缓冲区")
+	} else if s.sinceEval >= AdaptiveBufferEvalInterval {
+		s.evaluate(pressure)
 	}
 
-	// 第三步：尝试解析不同格式
-	for _, format := range formats {
-		if t, err := time.Parse(format, buildTime); err == nil {
-			// 第四步：转换为本地时间并格式化
-			localTime := t.Local()
-			return localTime.Format("2006-01-02 15:04:05 MST (UTC" + localTime.Format("-07:00") + ")")
+	for _, size := range s.tierSizes {
+		if messageSize <= size {
+			return max(size, s.promoteTo)
 		}
 	}
-
-	// 第五步：如果无法解析，返回原始字符串
-	return buildTime
+	return messageSize
 }
 
-// showBuildInfo 显示详细构建信息
-// 这个函数提供完整的应用程序构建和运行时信息，用于调试和系统分析
-//
-// 显示的信息分类：
-//  1. 构建信息：版本、构建时间、Git提交、Go版本
-//  2. 系统信息：操作系统、架构、编译器、CPU核心数
-//  3. 运行时信息：内存分配、系统内存、GC次数
-//
-// 构建信息来源：
-//   - AppVersion: 应用程序版本号（编译时注入）
-//   - BuildTime: 构建时间戳（编译时注入）
-//   - GitCommit: Git提交哈希（编译时注入）
-//   - GoVersion: Go编译器版本（编译时注入）
-//
-// 系统信息来源：
-//   - runtime.GOOS: 目标操作系统
-//   - runtime.GOARCH: 目标架构
-//   - runtime.Compiler: 编译器类型
-//   - runtime.NumCPU(): CPU核心数
-//
-// 内存信息说明：
-//   - Alloc: 当前分配的堆内存
-//   - Sys: 从系统获取的总内存
-//   - NumGC: 垃圾回收执行次数
-//
-// 使用场景：
-//   - 问题诊断和调试
-//   - 系统兼容性检查
-//   - 性能分析和优化
-//   - 部署环境验证
-func showBuildInfo() {
-	// 显示标题和分隔线
-	fmt.Printf("📋 %s 构建信息\n", AppName)
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-
-	// 构建信息部分
-	fmt.Printf("版本:       %s\n", AppVersion)
-	fmt.Printf("构建时间:   %s\n", formatBuildTime(BuildTime))
-	fmt.Printf("Git提交:    %s\n", GitCommit)
-	fmt.Printf("Go版本:     %s\n", GoVersion)
-
-	// 系统信息部分
-	fmt.Printf("操作系统:   %s\n", runtime.GOOS)
-	fmt.Printf("架构:       %s\n", runtime.GOARCH)
-	fmt.Printf("编译器:     %s\n", runtime.Compiler)
-	fmt.Printf("CPU核心:    %d\n", runtime.NumCPU())
-
-	// 运行时内存信息部分
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	fmt.Printf("内存分配:   %d KB\n", m.Alloc/1024)
-	fmt.Printf("系统内存:   %d KB\n", m.Sys/1024)
-	fmt.Printf("GC次数:     %d\n", m.NumGC)
+// observe 把消息大小加入滚动窗口（调用方需持有mu）
+func (s *bufferTierSizer) observe(size int) {
+	s.sizes[s.next] = size
+	s.next = (s.next + 1) % AdaptiveBufferWindow
+	s.count = min(s.count+1, AdaptiveBufferWindow)
+	s.sinceEval++
 }
 
-// performHealthCheck 执行自检并返回状态码
-// 这个函数执行全面的应用程序健康检查，验证各个组件的运行状态
-//
-// 检查项目：
-//  1. Go运行时版本检查
-//  2. 内存使用状态检查
-//  3. Goroutine数量检查
-//  4. 构建信息完整性检查
-//
-// 检查标准：
-//   - 内存使用：< 100MB 为正常，>= 100MB 为偏高
-//   - Goroutine数量：< 100 为正常，>= 100 为偏多
-//   - 构建信息：BuildTime、GitCommit、GoVersion 都不为"unknown"
-//
-// 输出格式：
-//   - ✅ 表示检查通过
-//   - ⚠️ 表示检查发现问题但不影响运行
-//   - ❌ 表示检查失败（当前版本无此状态）
-//
-// 使用场景：
-//   - 部署前的健康验证
-//   - 运行时状态监控
-//   - 问题诊断和调试
-//   - 自动化测试中的状态检查
-//
-// 退出行为：
-//   - 检查完成后程序会退出（os.Exit(0)）
-//   - 适用于脚本和自动化工具调用
-func performHealthCheck() {
-	// 显示标题和分隔线
-	fmt.Printf("🔍 %s 健康检查\n", AppName)
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+// histogram 统计窗口内各档位的消息数，最后一项为超过最大档位的消息数（调用方需持有mu）
+func (s *bufferTierSizer) histogram() []int {
+	counts := make([]int, len(s.tierSizes)+1)
+	for _, size := range s.sizes[:s.count] {
+		tier, _ := slices.BinarySearch(s.tierSizes, size)
+		counts[tier]++
+	}
+	return counts
+}
 
-	// 第一项：检查Go运行时版本
-	fmt.Printf("✅ Go运行时: %s\n", runtime.Version())
+// dominantTier 返回窗口内90%的消息能放进的最小档位大小，超过最大档位时返回最大档位（调用方需持有mu）
+func (s *bufferTierSizer) dominantTier() int {
+	threshold := (s.count*9 + 9) / 10
+	cumulative := 0
+	for tier, n := range s.histogram()[:len(s.tierSizes)] {
+		cumulative += n
+		if cumulative >= threshold {
+			return s.tierSizes[tier]
+		}
+	}
+	return s.tierSizes[len(s.tierSizes)-1]
+}
 
-	// 第二项：检查内存使用状态
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	if m.Alloc < 100*1024*1024 { // 小于100MB
-		fmt.Printf("✅ 内存使用: %d KB (正常)\n", m.Alloc/1024)
-	} else {
-		fmt.Printf("⚠️ 内存使用: %d KB (偏高)\n", m.Alloc/1024)
+// evaluate 根据窗口内的大小分布和池的未命中率重新评估档位决策（调用方需持有mu）
+func (s *bufferTierSizer) evaluate(pressure bool) {
+	s.sinceEval = 0
+
+	// 第一步：计算评估区间内各档位的未命中率，同时更新档位列表
+	last := make(map[int]BufferTierStats, len(s.lastTiers))
+	for _, tier := range s.lastTiers {
+		last[tier.Size] = tier
+	}
+	tiers := s.pool.TierStats()
+	s.tierSizes = s.tierSizes[:0]
+	clear(s.missRates)
+	for _, tier := range tiers {
+		s.tierSizes = append(s.tierSizes, tier.Size)
+		gets := tier.Gets - last[tier.Size].Gets
+		misses := tier.Misses - last[tier.Size].Misses
+		if gets > 0 {
+			s.missRates[tier.Size] = min(float64(misses)/float64(gets), 1)
+		}
 	}
+	s.lastTiers = tiers
 
-	// 第三项：检查goroutine数量
-	numGoroutines := runtime.NumGoroutine()
-	if numGoroutines < 100 {
-		fmt.Printf("✅ Goroutines: %d (正常)\n", numGoroutines)
-	} else {
-		fmt.Printf("⚠️ Goroutines: %d (偏多)\n", numGoroutines)
+	// 第二步：按规则决定是否提升
+	dominant := s.dominantTier()
+	if pressure {
+		s.decide(0, "内存或CPU压力，按消息大小选择缓冲区")
+		return
+	}
+	if s.promoteTo == dominant {
+		return
 	}
+	for _, size := range s.tierSizes {
+		if size >= dominant {
+			break
+		}
+		if rate := s.missRates[size]; rate > AdaptiveBufferColdMissRate {
+			s.decide(dominant, fmt.Sprintf("%d字节档位未命中率%.0f%%，90%%的消息不超过%d字节，小消息改用%d字节缓冲区",
+				size, rate*100, dominant, dominant))
+			return
+		}
+	}
+	s.decide(0, fmt.Sprintf("90%%的消息不超过%d字节，按消息大小选择缓冲区", dominant))
+}
 
-	// 第四项：检查构建信息完整性
-	if BuildTime != "unknown" && GitCommit != "unknown" && GoVersion != "unknown" {
-		fmt.Println("✅ 构建信息: 完整")
-	} else {
-		fmt.Println("⚠️ 构建信息: 不完整")
+// decide 更新档位决策，决策变化时记录日志（调用方需持有mu）
+func (s *bufferTierSizer) decide(promoteTo int, note string) {
+	if promoteTo == s.promoteTo {
+		return
 	}
+	s.promoteTo = promoteTo
+	s.decisions++
+	s.lastNote = note
+	log.Printf(tr("🔧 自适应缓冲区: %s"), note)
+}
 
-	// 显示完成信息
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println("🎉 健康检查完成")
+// report 返回当前决策和统计，加入性能报告
+// 直方图和未命中率按档位大小（字节）分组，超过最大档位的消息计入oversized
+func (s *bufferTierSizer) report() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := s.histogram()
+	histogram := make(map[string]int, len(counts))
+	for tier, size := range s.tierSizes {
+		histogram[strconv.Itoa(size)] = counts[tier]
+	}
+	histogram["oversized"] = counts[len(s.tierSizes)]
+	missRates := make(map[string]float64, len(s.missRates))
+	for size, rate := range s.missRates {
+		missRates[strconv.Itoa(size)] = rate
+	}
+	return map[string]any{
+		"window":     s.count,
+		"histogram":  histogram,
+		"miss_rates": missRates,
+		"promote_to": s.promoteTo,
+		"decisions":  s.decisions,
+		"last_note":  s.lastNote,
+	}
 }
 
-// showUsage 将命令行使用说明打印到控制台
-// 这个函数提供完整的命令行帮助信息，包括所有可用参数、使用示例和常见用法场景
-// 当用户输入-h、--help或参数错误时会调用此函数
+// ===== systemd集成 =====
+
+// sdNotifier 通过sd_notify协议向systemd发送通知
+// 只需向NOTIFY_SOCKET指向的Unix数据报套接字写入KEY=VALUE文本，无需依赖libsystemd
 //
-// 帮助信息结构：
-//  1. 程序标题和版本信息
-//  2. 基本使用方法和帮助命令
-//  3. 公共测试服务器示例
-//  4. 自定义使用示例
-//  5. 详细参数分类说明
-//  6. 监控功能和交互模式说明
-//  7. 智能重试策略说明
-//  8. 主要特性总结
+// 支持的通知：
+//   - READY=1: 首次连接成功后发送（配合Type=notify）
+//   - STATUS=...: 连接状态变化时发送，显示在systemctl status中
+//   - STOPPING=1: 开始停止时发送
+//   - WATCHDOG=1: 单元配置了WatchdogSec时按一半间隔发送，客户端不健康时停止发送
 //
-// 设计原则：
-//   - 信息层次清晰，便于快速查找
-//   - 提供实际可用的示例
-//   - 使用emoji增强可读性
-//   - 涵盖所有功能和参数
-//   - 突出企业级特性和性能优势
-func showUsage() {
-	fmt.Printf("📋 %s v%s - 高性能 WebSocket 客户端\n", AppName, AppVersion)
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println("")
-	fmt.Println("🚀 使用方法:")
-	fmt.Println("  ./wsc [选项] <WebSocket_URL>")
-	fmt.Println("  ./wsc -h, --help              显示此帮助信息")
-	fmt.Println("")
-	fmt.Println("🌐 公共测试服务器:")
-	fmt.Println("  ./wsc -n wss://echo.websocket.org")
-	fmt.Println("  ./wsc ws://echo.websocket.org")
-	fmt.Println("  ./wsc -n wss://ws.postman-echo.com/raw")
-	fmt.Println("")
-	fmt.Println("📋 自定义示例:")
-	fmt.Println("  ./wsc ws://localhost:8080/websocket")
-	fmt.Println("  ./wsc -n wss://example.com:8765/websocket")
-	fmt.Println("  ./wsc -f wss://secure-api.example.com/ws")
-	fmt.Println("  ./wsc -v -r 10 -t 5 wss://api.example.com/ws")
-	fmt.Println("")
-	fmt.Println("⚙️  可选参数:")
-	fmt.Println("    -n                    跳过 TLS 证书验证警告")
-	fmt.Println("    -f                    强制启用 TLS 证书验证 (覆盖默认跳过行为)")
-	fmt.Println("    -d                    禁用自动ping功能 (仍会响应服务器ping)")
-	fmt.Println("    -v                    启用详细日志模式 (包括消息处理和ping/pong)")
-	fmt.Println("    -i, --interactive     启用交互式消息发送模式")
-	fmt.Println("    -l [文件路径]          记录消息到日志文件 (可选路径)")
-	fmt.Println("    --log-file <路径>      指定消息日志文件路径")
-	fmt.Println("    -r <次数>             重试次数 (默认5，0=无限)")
-	fmt.Println("    -t <秒数>             重试间隔 (默认3秒)")
-	fmt.Println("")
-	fmt.Println("📋 信息查看:")
-	fmt.Println("    --version             显示版本号")
-	fmt.Println("    --build-info          显示详细构建信息")
-	fmt.Println("    --health-check        执行自检并返回状态码")
-	fmt.Println("")
-	fmt.Println("📊 监控和指标:")
-	fmt.Println("    --metrics             启用Prometheus指标导出")
-	fmt.Println("    --metrics-port <端口>  指标服务端口 (默认9090)")
-	fmt.Println("    --health-port <端口>   健康检查端口 (默认8080)")
-	fmt.Println("")
-	fmt.Println("📝 消息日志功能:")
-	fmt.Println("    -l                    自动生成日志文件名")
-	fmt.Println("    -l mylog.txt          指定日志文件名")
-	fmt.Println("    --log-file /path/to/websocket.log  完整路径")
-	fmt.Println("")
-	fmt.Println("📊 监控功能示例:")
-	fmt.Println("    --metrics             启用默认端口监控 (9090/8080)")
-	fmt.Println("    --metrics-port 9091   自定义指标端口")
-	fmt.Println("    --health-port 8081    自定义健康检查端口")
-	fmt.Println("  访问:")
-	fmt.Println("    http://localhost:9090/metrics     Prometheus指标")
-	fmt.Println("    http://localhost:8080/health      健康检查")
-	fmt.Println("    http://localhost:8080/ready       就绪检查")
-	fmt.Println("    http://localhost:8080/stats       详细统计")
-	fmt.Println("")
-	fmt.Println("💬 交互式模式:")
-	fmt.Println("    -i                    启用后可通过键盘输入发送消息")
-	fmt.Println("    特殊命令:")
-	fmt.Println("      /quit               退出程序")
-	fmt.Println("      /ping               发送 ping 消息")
-	fmt.Println("      /stats              显示连接统计信息")
-	fmt.Println("")
-	fmt.Println("🔄 智能重试策略:")
-	fmt.Println("    -r N: 前N次快速重试 + 后N次慢速重试")
-	fmt.Println("    -r 0: 前5次快速重试 + 无限慢速重试")
-	fmt.Println("  示例:")
-	fmt.Println("    -r 3: 3次快速 + 3次慢速 = 总共6次")
-	fmt.Println("    -r 5: 5次快速 + 5次慢速 = 总共10次")
-	fmt.Println("")
-	fmt.Println("🔐 TLS证书验证选项:")
-	fmt.Println("    默认行为: 跳过证书验证，显示安全警告")
-	fmt.Println("    -n: 跳过证书验证，不显示警告 (开发环境)")
-	fmt.Println("    -f: 强制启用证书验证 (生产环境推荐)")
-	fmt.Println("  注意: -f 和 -n 不能同时使用，-f 优先级更高")
-	fmt.Println("")
-	fmt.Println("✨ 主要特性:")
-	fmt.Println("    • 自动重连和智能重试")
-	fmt.Println("    • 并发安全和优雅关闭")
-	fmt.Println("    • 详细的连接统计信息")
-	fmt.Println("    • 支持自定义事件处理")
-	fmt.Println("    • 完善的错误分类处理")
-	fmt.Println("    • 灵活的TLS安全配置")
+// 并发安全：使用互斥锁保护写入
+type sdNotifier struct {
+	mu               sync.Mutex
+	conn             net.Conn      // 到NOTIFY_SOCKET的连接
+	watchdogInterval time.Duration // 看门狗通知间隔（WATCHDOG_USEC的一半），0表示未启用看门狗
 }
 
-// showCertificateWarning 当连接到WSS服务器并跳过证书验证时，在控制台显示警告信息
-// 这个函数提供重要的安全提示，确保用户了解跳过证书验证的风险
-//
-// 调用时机：
-//   - URL以"wss://"开头（HTTPS WebSocket）
-//   - 用户没有使用-n参数跳过警告
-//   - 程序启动时自动检查
-//
-// 警告内容：
-//  1. 明确说明正在跳过证书验证
-//  2. 解释安全风险和适用场景
-//  3. 提供解决方案建议
-//  4. 说明如何跳过此警告
+// newSDNotifier 根据环境变量创建systemd通知器
 //
-// 安全考虑：
-//   - 中间人攻击风险：攻击者可能拦截和修改通信
-//   - 身份验证缺失：无法确认服务器身份
-//   - 数据完整性：传输数据可能被篡改
+// 返回值：
+//   - *sdNotifier: 未在systemd下运行（没有NOTIFY_SOCKET）或无法连接时返回nil
 //
-// 适用场景：
-//   - 开发环境测试
-//   - 自签名证书服务器
-//   - 内网环境快速连接
-//   - 证书配置问题的临时解决方案
-func showCertificateWarning() {
-	fmt.Println("🔐 WSS连接证书警告")
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println("⚠️  正在使用WSS连接，将自动跳过证书验证")
-	fmt.Println("📋 这意味着:")
-	fmt.Println("   • 不会验证服务器证书的有效性")
-	fmt.Println("   • 可能存在中间人攻击风险")
-	fmt.Println("   • 适用于开发环境和自签名证书")
-	fmt.Println("")
-	fmt.Println("💡 如需严格证书验证，请联系服务器管理员配置有效证书")
-	fmt.Println("🚀 要跳过此警告，请使用 -n 参数")
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println("")
+// 注意事项：
+//   - 以@开头的地址是Linux抽象命名空间套接字
+//   - 设置了WATCHDOG_PID且与当前进程不符时不启用看门狗（通知属于其他进程）
+func newSDNotifier() *sdNotifier {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if strings.HasPrefix(addr, "@") {
+		addr = "\x00" + addr[1:]
+	}
+
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		log.Printf(tr("⚠️ 无法连接systemd通知套接字: %v"), err)
+		return nil
+	}
+
+	notifier := &sdNotifier{conn: conn}
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		if pid := os.Getenv("WATCHDOG_PID"); pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			notifier.watchdogInterval = time.Duration(usec) * time.Microsecond / 2
+		}
+	}
+	return notifier
 }
 
-// showTLSVerificationInfo 当启用强制TLS证书验证时，显示安全信息
-// 这个函数提供TLS安全验证的相关信息，确保用户了解安全连接的重要性
-//
-// 调用时机：
-//   - URL以"wss://"开头（HTTPS WebSocket）
-//   - 用户使用了-f参数强制启用证书验证
-//   - 程序启动时自动检查
-//
-// 信息内容：
-//  1. 说明正在使用严格的TLS证书验证
-//  2. 解释安全优势和连接要求
-//  3. 提供证书问题的解决建议
-//  4. 说明与默认行为的区别
-//
-// 适用场景：
-//   - 生产环境连接
-//   - 安全要求较高的环境
-//   - 需要验证服务器身份的场景
-//   - 防止中间人攻击的连接
-func showTLSVerificationInfo() {
-	fmt.Println("🔒 TLS安全验证模式")
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println("✅ 已启用严格的TLS证书验证")
-	fmt.Println("📋 这意味着:")
-	fmt.Println("   • 将验证服务器证书的有效性")
-	fmt.Println("   • 检查证书链的完整性")
-	fmt.Println("   • 验证服务器身份匹配")
-	fmt.Println("   • 防止中间人攻击")
-	fmt.Println("")
-	fmt.Println("🛡️  安全优势:")
-	fmt.Println("   • 确保连接到正确的服务器")
-	fmt.Println("   • 保护数据传输安全")
-	fmt.Println("   • 符合生产环境安全要求")
-	fmt.Println("")
-	fmt.Println("⚠️  注意事项:")
-	fmt.Println("   • 服务器必须配置有效的SSL证书")
-	fmt.Println("   • 自签名证书将导致连接失败")
-	fmt.Println("   • 证书过期或域名不匹配会被拒绝")
-	fmt.Println("")
-	fmt.Println("💡 如遇证书问题，请联系服务器管理员或使用默认模式")
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println("")
+// notify 发送一条通知，多个字段以换行分隔
+func (n *sdNotifier) notify(state string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err := n.conn.Write([]byte(state)); err != nil {
+		log.Printf(tr("⚠️ 发送systemd通知失败: %v"), err)
+	}
 }
 
-// logStartupInfo 在客户端启动时记录有关其配置的初始信息
-// 这个函数提供详细的启动日志，便于调试、监控和问题诊断
-//
-// 参数说明：
-//   - config: 客户端配置实例，包含所有运行参数
-//   - sessionID: 唯一会话标识符，用于跟踪和关联日志
-//
-// 记录的信息：
-//  1. 应用程序名称和版本
-//  2. 目标WebSocket服务器地址
-//  3. 会话ID（用于日志关联）
-//  4. 智能重试策略配置
-//  5. 超时配置详情
-//  6. 缓冲区大小设置
-//  7. 重试间隔配置
-//  8. 日志级别设置
-//
-// 使用场景：
-//   - 程序启动时的配置确认
-//   - 问题诊断和调试
-//   - 运维监控和日志分析
-//   - 配置审计和合规检查
-//
-// 日志格式：
-//   - 使用emoji增强可读性
-//   - 结构化信息便于解析
-//   - 包含关键配置参数
-func logStartupInfo(config *ClientConfig, sessionID string) {
-	// 基本信息记录
-	log.Printf("🚀 启动 %s v%s", AppName, AppVersion)
-	log.Printf("📍 目标URL: %s", config.URL)
-	log.Printf("🔗 会话ID: %s", sessionID)
+// runWatchdog 按看门狗间隔发送WATCHDOG=1
+// 只有客户端健康时才发送；客户端卡死（例如mu死锁导致GetStats阻塞）时通知停止，
+// systemd在WatchdogSec超时后按Restart=设置重启服务
+func (c *WebSocketClient) runWatchdog() {
+	c.wg.Add(1)
+	defer c.wg.Done()
 
-	// 智能重试策略信息
-	if config.MaxRetries == 0 {
-		log.Printf("🔄 智能重试: 5次快速 + 无限慢速重试")
-	} else {
-		totalRetries := config.MaxRetries * 2
-		log.Printf("🔄 智能重试: %d次快速 + %d次慢速 = 总共%d次",
-			config.MaxRetries, config.MaxRetries, totalRetries)
+	ticker := time.NewTicker(c.notifier.watchdogInterval)
+	defer ticker.Stop()
+
+	log.Printf(tr("🐕 systemd看门狗已启用，每 %v 发送一次心跳"), c.notifier.watchdogInterval)
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_ = c.GetStats() // 需要获取mu，客户端死锁时在此阻塞
+		if c.isHealthy() {
+			c.notifier.notify("WATCHDOG=1")
+		}
 	}
+}
+
+// ===== 全屏TUI模式 =====
+
+// tuiMaxLines 消息面板保留的最大行数
+const tuiMaxLines = 1000
+
+// tuiLogLines 日志面板显示的行数
+const tuiLogLines = 3
+
+// tuiView 全屏终端界面
+// 将屏幕划分为状态栏、收到的消息面板、日志面板和底部的发送输入框，
+// 高频消息流只追加到消息面板，日志单独显示，避免相互穿插
+//
+// 屏幕布局（自上而下）：
+//  1. 状态栏：连接状态、目标URL
+//  2. 统计栏：收发消息数和实时速率、错误数、握手耗时、内存
+//  3. 消息面板：收到的消息和交互命令输出，超出高度时只显示最新部分
+//  4. 日志面板：最近几条运行日志
+//  5. 输入框：编辑并发送消息，支持与交互模式相同的特殊命令
+//
+// 并发安全：使用互斥锁保护所有面板数据，渲染在单独的goroutine中进行
+type tuiView struct {
+	client *WebSocketClient // 所属客户端
 
-	// 超时配置信息
-	log.Printf("⏱️  超时配置: 握手=%v, 读取=%v, 写入=%v, Ping间隔=%v",
-		config.HandshakeTimeout, config.ReadTimeout, config.WriteTimeout, config.PingInterval)
+	mu       sync.Mutex // 保护以下所有字段
+	lines    []string   // 消息面板内容
+	logs     []string   // 日志面板内容
+	input    []rune     // 输入框当前内容
+	partial  []byte     // 尚未以换行结束的日志或命令输出
+	lastSent string     // 最近一次发送的内容
+	retrying string     // 重连进度：不在重连过程中时为空
 
-	// 缓冲区配置信息
-	log.Printf("📦 缓冲区配置: 读取=%d字节, 写入=%d字节, 最大消息=%d字节",
-		config.ReadBufferSize, config.WriteBufferSize, config.MaxMessageSize)
+	prevStats ConnectionStats // 上次渲染时的统计快照：用于计算实时速率
+	prevTime  time.Time       // 上次计算速率的时间
+	inRate    float64         // 接收速率（条/秒）
+	outRate   float64         // 发送速率（条/秒）
 
-	// 重试间隔信息
-	log.Printf("⏳ 慢速重试间隔: %v", config.RetryDelay)
+	dirty chan struct{} // 重绘通知
+}
 
-	// 日志级别信息
-	logLevels := []string{"ERROR", "WARN", "INFO", "DEBUG"}
-	if config.LogLevel >= 0 && config.LogLevel < len(logLevels) {
-		log.Printf("📝 日志级别: %s", logLevels[config.LogLevel])
+// tuiLogWriter 将日志输出重定向到TUI日志面板
+type tuiLogWriter struct{ view *tuiView }
+
+// Write 实现io.Writer接口，按行追加到日志面板
+func (w tuiLogWriter) Write(p []byte) (int, error) {
+	w.view.mu.Lock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.view.logs = append(w.view.logs, sanitizeTerminalText(line)) // 日志中可能含有服务器发来的内容
 	}
+	if len(w.view.logs) > tuiLogLines {
+		w.view.logs = w.view.logs[len(w.view.logs)-tuiLogLines:]
+	}
+	w.view.mu.Unlock()
+	w.view.markDirty()
+	return len(p), nil
 }
 
-// main 是 WebSocket 客户端应用程序的入口点
-// 这是整个程序的控制中心，负责协调各个组件的初始化和运行
-//
-// 主要职责：
-//  1. 命令行参数解析和验证
-//  2. 客户端实例创建和配置
-//  3. 信号处理和优雅关闭
-//  4. 交互模式和监控服务启动
-//  5. 程序生命周期管理
-//
-// 执行流程：
+// tuiPaneWriter 将交互命令输出（如/stats、/help）写入消息面板
+type tuiPaneWriter struct{ view *tuiView }
+
+// Write 实现io.Writer接口，完整的行追加到消息面板，不完整的部分暂存
+func (w tuiPaneWriter) Write(p []byte) (int, error) {
+	w.view.mu.Lock()
+	data := append(w.view.partial, p...)
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		w.view.appendLineLocked(string(data[:idx]))
+		data = data[idx+1:]
+	}
+	w.view.partial = append([]byte(nil), data...)
+	w.view.mu.Unlock()
+	w.view.markDirty()
+	return len(p), nil
+}
+
+// startTUI 启动全屏TUI模式
+// 切换终端到原始模式和备用屏幕，并启动输入处理与渲染goroutine
 //
-//	参数解析 -> 客户端创建 -> 信号处理设置 -> 服务启动 -> 等待退出信号 -> 优雅关闭
+// 返回值：
+//   - error: 标准输入或输出不是终端、无法切换终端模式时返回错误
 //
-// 错误处理：
-//   - 参数错误：显示使用说明并退出
-//   - 运行时错误：记录日志并尝试恢复
-//   - 致命错误：优雅关闭并退出
-func main() {
-	// ===== 第一阶段：参数解析和验证 =====
-	// 解析命令行参数，获取用户配置
-	config, skipCertWarning, err := parseArgs()
+// 注意事项：
+//   - 应在Start()之前调用，确保接收的第一条消息也显示在TUI中
+//   - 程序退出前必须调用restoreConsole恢复终端
+func (c *WebSocketClient) startTUI() error {
+	inFd, outFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(inFd) || !term.IsTerminal(outFd) {
+		return errors.New(tr("标准输入和标准输出都必须是终端"))
+	}
+	oldState, err := term.MakeRaw(inFd)
 	if err != nil {
-		// parseArgs 内部在参数不足或URL未指定时会调用 showUsage()
-		// 这里我们只打印具体的错误信息到标准错误输出，然后平静地以0退出
-		// 使用0退出码是因为这是用户输入错误，不是程序错误
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(0) // 参数错误时，平静退出
+		return fmt.Errorf(tr("无法切换终端到原始模式: %w"), err)
 	}
 
-	// ===== 第二阶段：安全提示和警告 =====
-	// 处理TLS证书验证相关的提示和警告
-	if strings.HasPrefix(config.URL, "wss://") {
-		// 检查参数冲突：同时使用 -n 和 -f
-		if skipCertWarning && config.ForceTLSVerify {
-			fmt.Println("⚠️  参数冲突：不能同时使用 -n（跳过证书警告）和 -f（强制证书验证）")
-			fmt.Println("💡 -f 参数优先级更高，将启用严格的TLS证书验证")
-			fmt.Println("")
-		}
+	view := &tuiView{client: c, prevTime: time.Now(), dirty: make(chan struct{}, 1)}
+	fmt.Print("\x1b[?1049h\x1b[2J") // 进入备用屏幕并清屏
 
-		if config.ForceTLSVerify {
-			// 强制TLS验证模式：显示安全提示
-			showTLSVerificationInfo()
-		} else if !skipCertWarning {
-			// 默认模式：显示证书跳过警告
-			showCertificateWarning()
+	c.mu.Lock()
+	c.tui = view
+	c.console = tuiPaneWriter{view: view}
+	c.consoleRestore = func() {
+		log.SetOutput(c.logOutput())
+		fmt.Print("\x1b[?1049l") // 离开备用屏幕，恢复原有终端内容
+		if err := term.Restore(inFd, oldState); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ 恢复终端状态失败: %v\n", err)
 		}
 	}
+	c.mu.Unlock()
+	// 日志面板按字符数截断显示，不使用颜色转义序列
+	log.SetOutput(newLogWriter(tuiLogWriter{view: view}, false, c.config.ASCII))
 
-	// ===== 第三阶段：客户端创建和初始化 =====
-	// 创建WebSocket客户端实例，所有组件都会在这里初始化
-	client := NewWebSocketClient(config)
+	go view.readInput()
+	go view.renderLoop()
+	return nil
+}
 
-	// 记录启动信息，便于调试和监控
-	logStartupInfo(config, client.SessionID)
+// tuiRecordMessage 将收到的消息追加到TUI消息面板（未启用TUI时不做任何事）
+func (c *WebSocketClient) tuiRecordMessage(messageType int, message []byte) {
+	c.mu.RLock()
+	view := c.tui
+	c.mu.RUnlock()
+	if view == nil {
+		return
+	}
 
-	// ===== 第四阶段：信号处理设置 =====
-	// 设置信号处理，支持优雅关闭
-	// 监听 Ctrl+C (SIGINT) 和 SIGTERM 信号
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	// 配置了--message-format时按模板显示，否则为"时间 ← 内容"
+	line, ok := c.renderMessage("RECV", messageType, message)
+	if !ok {
+		switch messageType {
+		case websocket.TextMessage:
+			line = "← " + string(message)
+		case websocket.BinaryMessage:
+			line = fmt.Sprintf("← [二进制 %d 字节]", len(message))
+		default:
+			return
+		}
+		line = time.Now().Format("15:04:05") + " " + line
+	}
+	view.mu.Lock()
+	view.appendLineLocked(line)
+	view.mu.Unlock()
+	view.markDirty()
+}
 
-	// ===== 第五阶段：服务启动 =====
-	// 启动WebSocket客户端（非阻塞）
-	// 使用goroutine确保main函数可以继续处理信号
-	go client.Start()
+// tuiSetReconnectStatus 更新TUI状态栏中的重连进度，未启用TUI时直接返回
+func (c *WebSocketClient) tuiSetReconnectStatus(text string) {
+	c.mu.RLock()
+	view := c.tui
+	c.mu.RUnlock()
+	if view == nil {
+		return
+	}
+	view.mu.Lock()
+	view.retrying = text
+	view.mu.Unlock()
+	view.markDirty()
+}
 
-	// 如果启用了交互模式，启动交互式输入处理
-	// 允许用户在运行时发送消息
-	if config.Interactive {
-		go client.startInteractiveMode()
+// appendLineLocked 追加一行到消息面板，超出上限时丢弃最旧的行（调用方需持有mu）
+// 控制字符被转义显示，服务器发来的内容不能移动光标、改变颜色或破坏面板布局
+func (v *tuiView) appendLineLocked(line string) {
+	v.lines = append(v.lines, sanitizeTerminalText(line))
+	if len(v.lines) > tuiMaxLines {
+		v.lines = slices.Delete(v.lines, 0, len(v.lines)-tuiMaxLines)
 	}
+}
 
-	// 等待中断信号或客户端自动退出
+// markDirty 通知渲染goroutine重绘，已有待处理的通知时直接返回
+func (v *tuiView) markDirty() {
 	select {
-	case <-interrupt:
-		log.Printf("📋 收到中断信号，正在停止...")
-		client.Stop()
-	case <-client.ctx.Done():
-		log.Printf("📋 客户端已自动退出")
-		// 客户端已经自动停止，无需再调用Stop()
+	case v.dirty <- struct{}{}:
+	default:
 	}
 }
 
-// startInteractiveMode 启动交互式消息发送模式
-// 这个方法允许用户通过标准输入实时发送消息和执行特殊命令
-//
-// 功能特点：
-//  1. 等待WebSocket连接建立后才开始接收输入
-//  2. 支持普通文本消息发送
-//  3. 支持特殊命令执行（/quit、/ping、/stats等）
-//  4. 提供友好的命令行界面
-//  5. 支持优雅退出和错误处理
-//
-// 工作流程：
-//  1. 等待WebSocket连接建立
-//  2. 显示交互模式提示信息
-//  3. 循环读取用户输入
-//  4. 处理特殊命令或发送普通消息
-//  5. 显示操作结果和新的输入提示
-//
-// 特殊命令：
-//   - /quit, /exit, /q: 退出程序
-//   - /ping: 发送ping消息
-//   - /stats: 显示连接统计信息
-//   - /help, /?: 显示帮助信息
-//
-// 并发安全：
-//   - 使用WaitGroup确保优雅退出
-//   - 通过context检查取消信号
-//   - 与其他goroutine安全协作
-func (c *WebSocketClient) startInteractiveMode() {
-	// 注册到WaitGroup，确保优雅退出
-	c.wg.Add(1)
-	defer c.wg.Done()
-
-	// 第一步：等待WebSocket连接建立
+// readInput 读取键盘输入并编辑输入框
+// 回车发送当前内容（支持特殊命令），退格删除，Ctrl+C/Ctrl+D退出，方向键等转义序列被忽略
+func (v *tuiView) readInput() {
+	c := v.client
+	reader := bufio.NewReader(os.Stdin)
 	for {
-		select {
-		case <-c.ctx.Done():
-			return // 客户端已停止，退出交互模式
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			return
+		}
+
+		switch r {
+		case 3, 4: // Ctrl+C / Ctrl+D
+			log.Print(tr("👋 用户请求退出"))
+			c.cancel()
+			return
+		case '\r', '\n':
+			v.mu.Lock()
+			line := string(v.input)
+			v.input = v.input[:0]
+			if strings.TrimSpace(line) != "" {
+				v.lastSent = line
+			}
+			v.mu.Unlock()
+			v.markDirty()
+			if c.handleInteractiveInput(line) {
+				return
+			}
+		case 127, 8: // 退格
+			v.mu.Lock()
+			if len(v.input) > 0 {
+				v.input = v.input[:len(v.input)-1]
+			}
+			v.mu.Unlock()
+		case 27: // 转义序列：跳过直到结束字母
+			if next, _, err := reader.ReadRune(); err == nil && next == '[' {
+				for {
+					b, _, err := reader.ReadRune()
+					if err != nil || (b >= '@' && b <= '~') {
+						break
+					}
+				}
+			}
 		default:
-			if c.isConnected() {
-				goto connected // 连接已建立，开始交互
+			if !isTerminalControl(r) {
+				v.mu.Lock()
+				v.input = append(v.input, r)
+				v.mu.Unlock()
 			}
-			time.Sleep(100 * time.Millisecond) // 短暂等待后重试
 		}
+		v.markDirty()
 	}
+}
 
-connected:
+// renderLoop 周期性重绘界面
+// 有新内容时立即重绘（最多每50毫秒一次），没有新内容时每秒刷新一次统计栏
+func (v *tuiView) renderLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.client.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-v.dirty:
+			time.Sleep(50 * time.Millisecond) // 合并高频更新
+		}
+		v.render()
+	}
+}
 
-	// 第二步：显示交互模式启动信息
-	log.Printf("💬 交互模式已启用，输入消息后按回车发送")
-	log.Printf("💡 特殊命令: /quit (退出), /ping (发送ping), /stats (显示统计)")
-	fmt.Print(">>> ")
+// render 绘制完整的一帧
+func (v *tuiView) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 || height < 10 {
+		return
+	}
 
-	// 第三步：创建输入扫描器
-	scanner := bufio.NewScanner(os.Stdin)
+	c := v.client
+	stats := c.GetStats()
+	perf := c.performanceMonitor.GetPerformanceReport()
 
-	// 第四步：主输入循环
-	for scanner.Scan() {
-		// 检查是否需要退出
-		select {
-		case <-c.ctx.Done():
-			return // 客户端已停止，退出交互模式
-		default:
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// 计算实时收发速率
+	now := time.Now()
+	if elapsed := now.Sub(v.prevTime).Seconds(); elapsed >= 1 {
+		v.inRate = float64(stats.MessagesReceived-v.prevStats.MessagesReceived) / elapsed
+		v.outRate = float64(stats.MessagesSent-v.prevStats.MessagesSent) / elapsed
+		v.prevStats, v.prevTime = stats, now
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H") // 光标回到左上角
+	writeRow := func(row int, style, text string) {
+		fmt.Fprintf(&buf, "\x1b[%d;1H\x1b[2K%s%s\x1b[0m", row, style, truncateWidth(text, width))
+	}
+
+	// 第一部分：状态栏和统计栏
+	status := fmt.Sprintf(" %s │ %s │ %s", AppName, c.GetState(), sanitizeTerminalText(c.config.URL))
+	if v.retrying != "" {
+		status += " │ " + v.retrying
+	}
+	writeRow(1, "\x1b[7m", padWidth(status, width))
+	rtt := "RTT -"
+	if stats.Ping.Samples > 0 {
+		rtt = fmt.Sprintf("RTT %.1fms (平均 %.1fms)", stats.Ping.LastMs, stats.Ping.AvgMs)
+	}
+	writeRow(2, "", fmt.Sprintf(" 收 %d (%.1f/s) │ 发 %d (%.1f/s) │ 错误 %d │ %s │ 握手 %v │ 内存 %.1fMB │ 平均 %.1f条/s",
+		stats.MessagesReceived, v.inRate, stats.MessagesSent, v.outRate, stats.Errors.TotalErrors, rtt,
+		stats.PhaseTiming.Total.Round(time.Millisecond), float64(toInt64(perf["memory_usage_bytes"]))/1024/1024,
+		toFloat64(perf["message_rate"])))
+	writeRow(3, "\x1b[2m", strings.Repeat("─", width))
+
+	// 第二部分：消息面板，只显示最新的若干行
+	paneTop, paneBottom := 4, height-tuiLogLines-3
+	paneHeight := paneBottom - paneTop + 1
+	start := max(len(v.lines)-paneHeight, 0)
+	for i := 0; i < paneHeight; i++ {
+		text := ""
+		if start+i < len(v.lines) {
+			text = v.lines[start+i]
 		}
+		writeRow(paneTop+i, "", text)
+	}
 
-		// 处理用户输入
-		input := strings.TrimSpace(scanner.Text())
-		if input == "" {
-			fmt.Print(">>> ") // 空输入，显示新提示符
-			continue
+	// 第三部分：日志面板
+	writeRow(paneBottom+1, "\x1b[2m", strings.Repeat("─", width))
+	for i := 0; i < tuiLogLines; i++ {
+		text := ""
+		if i < len(v.logs) {
+			text = v.logs[i]
 		}
+		writeRow(paneBottom+2+i, "\x1b[2m", text)
+	}
 
-		// 第五步：处理特殊命令
-		if c.handleInteractiveCommand(input) {
-			return // 用户请求退出
+	// 第四部分：输入框
+	hint := " Enter发送 │ /help查看命令 │ Ctrl+C退出"
+	if v.lastSent != "" {
+		hint += " │ 上次发送: " + sanitizeTerminalText(v.lastSent)
+	}
+	writeRow(height-1, "\x1b[7m", padWidth(hint, width))
+	prompt := sanitizeTerminalText(v.client.config.prompt("> ")) + string(v.input)
+	writeRow(height, "", prompt)
+	fmt.Fprintf(&buf, "\x1b[%d;%dH", height, min(displayWidth(prompt)+1, width))
+
+	_, _ = os.Stdout.Write(buf.Bytes())
+}
+
+// truncateRunes 按字符数截断字符串，避免超出终端宽度
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// sanitizeTerminalText 转义字符串中的C0/C1控制字符和DEL，制表符替换为空格
+// 用于TUI面板：服务器发来的换行、ANSI转义序列等原样输出会移动光标、改变终端状态或破坏布局
+func sanitizeTerminalText(s string) string {
+	if !strings.ContainsFunc(s, isTerminalControl) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			b.WriteByte(' ')
+		case isTerminalControl(r):
+			fmt.Fprintf(&b, "\\x%02x", r)
+		default:
+			b.WriteRune(r)
 		}
+	}
+	return b.String()
+}
 
-		// 第六步：发送普通文本消息
-		if err := c.SendText(input); err != nil {
-			log.Printf("❌ 发送消息失败: %v", err)
-		} else {
-			log.Printf("📤 已发送: %s", input)
+// isTerminalControl 判断字符是否为C0/C1控制字符或DEL
+func isTerminalControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r <= 0x9f)
+}
+
+// runeWidth 返回字符在终端中占用的列数：组合字符为0，东亚宽字符和emoji为2，其余为1
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || r == 0x200B:
+		return 0
+	case r >= 0x1100 && r <= 0x115F, // 谚文字母
+		r >= 0x2E80 && r <= 0x303E,   // CJK部首、符号和标点
+		r >= 0x3041 && r <= 0x33FF,   // 假名、注音、CJK兼容字符
+		r >= 0x3400 && r <= 0x4DBF,   // CJK扩展A
+		r >= 0x4E00 && r <= 0x9FFF,   // CJK统一表意文字
+		r >= 0xA000 && r <= 0xA4CF,   // 彝文
+		r >= 0xAC00 && r <= 0xD7A3,   // 谚文音节
+		r >= 0xF900 && r <= 0xFAFF,   // CJK兼容表意文字
+		r >= 0xFE30 && r <= 0xFE4F,   // CJK兼容形式
+		r >= 0xFF00 && r <= 0xFF60,   // 全角字符
+		r >= 0xFFE0 && r <= 0xFFE6,   // 全角符号
+		r >= 0x1F300 && r <= 0x1F64F, // emoji
+		r >= 0x1F900 && r <= 0x1F9FF, // 补充emoji
+		r >= 0x20000 && r <= 0x3FFFD: // CJK扩展B及以后
+		return 2
+	default:
+		return 1
+	}
+}
+
+// displayWidth 返回字符串在终端中占用的列数
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// truncateWidth 按显示宽度截断字符串，避免中文等宽字符使行超出终端宽度而折行
+func truncateWidth(s string, n int) string {
+	width := 0
+	for i, r := range s {
+		if width+runeWidth(r) > n {
+			return s[:i]
 		}
+		width += runeWidth(r)
+	}
+	return s
+}
 
-		// 显示新的输入提示符
-		fmt.Print(">>> ")
+// padWidth 用空格将字符串补齐到指定显示宽度，用于反色显示整行
+func padWidth(s string, n int) string {
+	if width := displayWidth(s); width < n {
+		return s + strings.Repeat(" ", n-width)
 	}
+	return s
+}
 
-	// 第七步：处理扫描器错误
-	if err := scanner.Err(); err != nil {
-		log.Printf("❌ 读取输入时出错: %v", err)
+// toInt64 从性能报告的any值中读取整数，类型不符时返回0
+func toInt64(v any) int64 {
+	if n, ok := v.(int64); ok {
+		return n
 	}
+	return 0
+}
+
+// toFloat64 从性能报告的any值中读取浮点数，类型不符时返回0
+func toFloat64(v any) float64 {
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	return 0
 }
 
 // handleInteractiveCommand 处理交互式模式的特殊命令
@@ -8132,13 +25145,15 @@ connected:
 //   - input: 用户输入的命令字符串
 //
 // 返回值：
-//   - bool: true表示应该退出交互模式，false表示继续
+//   - exit: true表示应该退出交互模式，false表示继续
+//   - handled: true表示输入是特殊命令且已处理，false表示应作为普通消息发送
 //
 // 支持的命令：
 //  1. 退出命令：/quit, /exit, /q - 优雅退出程序
 //  2. 网络命令：/ping - 发送WebSocket ping消息
-//  3. 信息命令：/stats - 显示详细的连接统计
-//  4. 帮助命令：/help, /? - 显示命令帮助信息
+//  3. 信息命令：/stats - 显示详细的连接统计，/state - 显示连接状态
+//  4. 连接控制：/reconnect - 强制断开并重连，/pause、/resume - 暂停和恢复消息输出
+//  5. 帮助命令：/help, /? - 显示命令帮助信息
 //
 // 命令处理逻辑：
 //   - 使用switch语句进行精确匹配
@@ -8151,36 +25166,141 @@ connected:
 //   - 提供即时反馈
 //   - 错误处理友好
 //   - 支持常用操作
-func (c *WebSocketClient) handleInteractiveCommand(input string) bool {
+func (c *WebSocketClient) handleInteractiveCommand(input string) (exit bool, handled bool) {
+	// 带参数的命令
+	if path, ok := strings.CutPrefix(input, "/sendfile "); ok {
+		// 文件发送命令：以分片方式发送文件
+		if err := c.SendFile(strings.TrimSpace(path)); err != nil {
+			log.Printf(tr("❌ 发送文件失败: %v"), err)
+		}
+		return false, true
+	}
+
+	if message, ok := strings.CutPrefix(input, "/broadcast "); ok {
+		// 广播命令：把消息发送给客户端池中的所有（或指定的）成员
+		c.broadcastInteractive(strings.TrimSpace(message))
+		return false, true
+	}
+
+	if index, ok := strings.CutPrefix(input, "/!"); ok {
+		// 历史重发命令：重新发送/history中的第N条消息
+		n, err := strconv.Atoi(index)
+		if err != nil || n < 1 {
+			log.Print(tr("⚠️ 用法: /!N，N为 /history 中的编号"))
+			return false, true
+		}
+		c.resendHistory(n)
+		return false, true
+	}
+
 	switch input {
 	case "/quit", "/exit", "/q":
 		// 退出命令：优雅停止客户端
-		log.Printf("👋 用户请求退出")
+		log.Print(tr("👋 用户请求退出"))
 		c.cancel() // 触发客户端停止
-		return true
+		return true, true
 
 	case "/ping":
 		// Ping命令：发送WebSocket ping消息测试连接
 		if err := c.sendControlMessage(websocket.PingMessage, nil); err != nil {
-			log.Printf("❌ 发送 ping 失败: %v", err)
+			log.Printf(tr("❌ 发送 ping 失败: %v"), err)
 		} else {
-			log.Printf("📡 已发送 ping 消息")
+			log.Print(tr("📤 已发送 ping 消息"))
 		}
-		return false
+		return false, true
 
 	case "/stats":
 		// 统计命令：显示详细的连接统计信息
 		c.showInteractiveStats()
-		return false
+		return false, true
+
+	case "/state":
+		// 状态命令：显示连接状态和控制开关
+		c.showInteractiveState()
+		return false, true
+
+	case "/reconnect":
+		// 重连命令：强制关闭当前连接，由Start主循环的重试机制重新建立
+		c.forceReconnect()
+		return false, true
+
+	case "/pause":
+		// 暂停命令：暂停收到消息的输出，统计和文件日志不受影响
+		if atomic.CompareAndSwapInt32(&c.outputPaused, 0, 1) {
+			atomic.StoreInt64(&c.pausedCount, 0)
+			log.Print(tr("⏸️ 已暂停消息输出，输入 /resume 恢复"))
+		}
+		return false, true
+
+	case "/resume":
+		// 恢复命令：恢复消息输出并报告暂停期间收到的消息数
+		if atomic.CompareAndSwapInt32(&c.outputPaused, 1, 0) {
+			log.Printf(tr("▶️ 已恢复消息输出，暂停期间收到 %d 条消息"), atomic.LoadInt64(&c.pausedCount))
+		}
+		return false, true
+
+	case "/resend":
+		// 重发命令：重新发送最近一条消息
+		c.resendHistory(0)
+		return false, true
+
+	case "/history":
+		// 历史命令：列出最近发送的消息及编号
+		c.showSentHistory()
+		return false, true
 
 	case "/help", "/?":
 		// 帮助命令：显示交互模式的使用说明
 		c.showInteractiveHelp()
-		return false
+		return false, true
 
 	default:
-		// 不是特殊命令，返回false继续处理为普通消息
-		return false
+		// 不是特殊命令，继续处理为普通消息
+		return false, false
+	}
+}
+
+// forceReconnect 强制关闭当前连接以触发重连
+// 使ReadMessages因读取超时退出并关闭连接，Start主循环随即按重试机制重新建立连接
+func (c *WebSocketClient) forceReconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		log.Print(tr("⚠️ 当前没有活动连接，重试机制会自动继续连接"))
+		return
+	}
+	log.Print(tr("🔄 按用户请求断开连接，即将重连..."))
+	// 让阻塞中的读取立即超时返回，连接由ReadMessages的清理逻辑统一关闭
+	atomic.StoreInt32(&c.reconnectReq, 1)
+	if err := c.conn.SetReadDeadline(time.Now()); err != nil {
+		log.Printf(tr("⚠️ 设置读取超时失败: %v"), err)
+	}
+}
+
+// showInteractiveState 显示连接状态
+// 与/stats相比只显示便于现场排查的状态信息：连接状态、重试计数、输出是否暂停和最近一次服务器关闭
+func (c *WebSocketClient) showInteractiveState() {
+	out := c.consoleOut()
+	stats := c.GetStats()
+
+	fmt.Fprintln(out, "🔎 连接状态:")
+	fmt.Fprintf(out, tr("   状态: %s\n"), c.GetState())
+	fmt.Fprintf(out, "   地址: %s\n", c.config.URL)
+	fmt.Fprintf(out, tr("   会话ID: %s\n"), c.SessionID)
+	if c.isConnected() {
+		fmt.Fprintf(out, "   已连接: %v\n", stats.Uptime.Round(time.Second))
+	}
+	fmt.Fprintf(out, "   当前重试计数: %d\n", atomic.LoadInt32(&c.RetryCount))
+	if atomic.LoadInt32(&c.outputPaused) == 1 {
+		fmt.Fprintf(out, "   消息输出: 已暂停 (期间收到 %d 条)\n", atomic.LoadInt64(&c.pausedCount))
+	} else {
+		fmt.Fprintln(out, "   消息输出: 正常")
+	}
+	if c.messageFilter != nil {
+		fmt.Fprintf(out, "   显示过滤: 已隐藏 %d 条\n", atomic.LoadInt64(&c.filteredCount))
+	}
+	if stats.LastClose.Code != 0 {
+		fmt.Fprintf(out, "   最近关闭: %d (%s) 原因=%q\n", stats.LastClose.Code, closeCodeName(stats.LastClose.Code), stats.LastClose.Reason)
 	}
 }
 
@@ -8208,21 +25328,49 @@ func (c *WebSocketClient) handleInteractiveCommand(input string) bool {
 //   - 验证消息传输
 //   - 分析连接稳定性
 func (c *WebSocketClient) showInteractiveStats() {
+	out := c.consoleOut()
 	// 获取最新的统计数据
 	stats := c.GetStats()
 	state := c.GetState()
 
 	// 显示格式化的统计信息
-	fmt.Println("📊 连接统计信息:")
-	fmt.Printf("   状态: %s\n", state)
-	fmt.Printf("   会话ID: %s\n", c.SessionID)
-	fmt.Printf("   连接时间: %s\n", stats.ConnectTime.Format("2006-01-02 15:04:05"))
-	fmt.Printf("   连接持续: %v\n", stats.Uptime)
-	fmt.Printf("   重连次数: %d\n", stats.ReconnectCount)
-	fmt.Printf("   发送消息: %d 条 (%d 字节)\n", stats.MessagesSent, stats.BytesSent)
-	fmt.Printf("   接收消息: %d 条 (%d 字节)\n", stats.MessagesReceived, stats.BytesReceived)
+	fmt.Fprintln(out, tr("📊 连接统计信息:"))
+	fmt.Fprintf(out, tr("   状态: %s\n"), state)
+	fmt.Fprintf(out, tr("   会话ID: %s\n"), c.SessionID)
+	fmt.Fprintf(out, tr("   连接时间: %s\n"), stats.ConnectTime.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(out, tr("   连接持续: %v\n"), stats.Uptime)
+	fmt.Fprintf(out, tr("   重连次数: %d\n"), stats.ReconnectCount)
+	if c.config.StateFile != "" {
+		fmt.Fprintf(out, tr("   累计统计: 首次启动于 %s, 重启 %d 次\n"), c.firstStartTime.Format("2006-01-02 15:04:05"), c.restarts)
+	}
+	fmt.Fprintf(out, tr("   握手耗时: DNS=%v, TCP=%v, TLS=%v, 首字节=%v, 总计=%v\n"),
+		stats.PhaseTiming.DNSLookup, stats.PhaseTiming.TCPConnect, stats.PhaseTiming.TLSHandshake,
+		stats.PhaseTiming.FirstByte, stats.PhaseTiming.Total)
+	if stats.LastClose.Code != 0 {
+		fmt.Fprintf(out, "   最近关闭: %d (%s) 原因=%q 时间=%s\n", stats.LastClose.Code, closeCodeName(stats.LastClose.Code),
+			stats.LastClose.Reason, stats.LastClose.Time.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintf(out, tr("   发送消息: %d 条 (%d 字节)\n"), stats.MessagesSent, stats.BytesSent)
+	fmt.Fprintf(out, tr("   接收消息: %d 条 (%d 字节)\n"), stats.MessagesReceived, stats.BytesReceived)
+	fmt.Fprintf(out, tr("   按类型发送: 文本=%d 二进制=%d ping=%d pong=%d close=%d\n"), stats.SentByType.Text, stats.SentByType.Binary,
+		stats.SentByType.Ping, stats.SentByType.Pong, stats.SentByType.Close)
+	fmt.Fprintf(out, tr("   按类型接收: 文本=%d 二进制=%d ping=%d pong=%d close=%d\n"), stats.ReceivedByType.Text, stats.ReceivedByType.Binary,
+		stats.ReceivedByType.Ping, stats.ReceivedByType.Pong, stats.ReceivedByType.Close)
+	if stats.Ping.Samples > 0 {
+		fmt.Fprintf(out, "   Ping RTT: 最近=%.1fms 最小=%.1fms 平均=%.1fms 最大=%.1fms 抖动=%.1fms (%d 次)\n",
+			stats.Ping.LastMs, stats.Ping.MinMs, stats.Ping.AvgMs, stats.Ping.MaxMs, stats.Ping.JitterMs, stats.Ping.Samples)
+	}
+	if stats.Compression != (CompressionStats{}) {
+		fmt.Fprintf(out, "   载荷压缩: 发送 %d -> %d 字节 (%.1f%%), 接收 %d -> %d 字节 (%.1f%%)\n",
+			stats.Compression.SentOriginalBytes, stats.Compression.SentCompressedBytes, stats.Compression.SentRatio()*100,
+			stats.Compression.ReceivedCompressedBytes, stats.Compression.ReceivedOriginalBytes, stats.Compression.ReceivedRatio()*100)
+	}
+	if c.config.SeqPath != "" {
+		fmt.Fprintf(out, tr("   序列号: 最大=%d 跳跃=%d 缺失=%d 重复=%d 乱序=%d 重新订阅=%d\n"), stats.Sequence.Last, stats.Sequence.Gaps,
+			stats.Sequence.Missing, stats.Sequence.Duplicates, stats.Sequence.OutOfOrder, stats.Sequence.Resubscribes)
+	}
 	if !stats.LastMessageTime.IsZero() {
-		fmt.Printf("   最后消息: %s\n", stats.LastMessageTime.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(out, tr("   最后消息: %s\n"), stats.LastMessageTime.Format("2006-01-02 15:04:05"))
 	}
 }
 
@@ -8245,11 +25393,22 @@ func (c *WebSocketClient) showInteractiveStats() {
 //   - 交互模式启动时的提示
 //   - 用户需要帮助时的参考
 func (c *WebSocketClient) showInteractiveHelp() {
-	fmt.Println("💬 交互式模式帮助:")
-	fmt.Println("   直接输入文本消息并按回车发送")
-	fmt.Println("   特殊命令:")
-	fmt.Println("     /quit, /exit, /q  - 退出程序")
-	fmt.Println("     /ping             - 发送 ping 消息")
-	fmt.Println("     /stats            - 显示连接统计信息")
-	fmt.Println("     /help, /?         - 显示此帮助信息")
+	out := c.consoleOut()
+	fmt.Fprintln(out, "💬 交互式模式帮助:")
+	fmt.Fprintln(out, "   直接输入文本消息并按回车发送")
+	fmt.Fprintln(out, "   特殊命令:")
+	fmt.Fprintln(out, "     /quit, /exit, /q  - 退出程序")
+	fmt.Fprintln(out, "     /ping             - 发送 ping 消息")
+	fmt.Fprintln(out, "     /stats            - 显示连接统计信息")
+	fmt.Fprintln(out, "     /state            - 显示连接状态")
+	fmt.Fprintln(out, "     /reconnect        - 强制断开并重新连接")
+	fmt.Fprintln(out, "     /pause, /resume   - 暂停/恢复收到消息的输出")
+	fmt.Fprintln(out, "     /sendfile <文件>  - 以分片方式发送文件")
+	fmt.Fprintln(out, "     /broadcast <消息> - 多连接 (--shard) 时发送给所有连接，@a,b 开头时只发送给指定分片")
+	fmt.Fprintln(out, "     /resend           - 重新发送最近一条消息")
+	fmt.Fprintln(out, "     /history          - 列出最近发送的消息及编号")
+	fmt.Fprintln(out, "     /!N               - 重新发送 /history 中的第N条消息")
+	fmt.Fprintln(out, "     /help, /?         - 显示此帮助信息")
+	fmt.Fprintln(out, "   终端中按 Tab 补全命令和已发送过的消息，方向键浏览历史")
+	fmt.Fprintln(out, "   消息中的 ${SEQ} ${UUID} ${NOW_ISO} ${SESSION_ID} 在发送前展开")
 }